@@ -0,0 +1,95 @@
+package driver
+
+import (
+	"github.com/sarchlab/mgpusim/v4/amd/driver/internal"
+	"github.com/sarchlab/mgpusim/v4/amd/protocol"
+)
+
+// A counterMigration is a page that a GPU has accessed remotely often enough
+// for the access counters of the GPU to ask for the page.
+type counterMigration struct {
+	page       internal.PageID
+	toDeviceID uint64
+}
+
+// processAccessCounterNotification queues the page that the access counters
+// of a GPU ask for, so that the page moves to the GPU in the next migration
+// epoch. The notifications are dropped if the access counter migration
+// policy is disabled.
+func (d *Driver) processAccessCounterNotification(
+	n *protocol.AccessCounterNotification,
+) bool {
+	if !d.accessCounterMigration {
+		return true
+	}
+
+	toDeviceID := d.gpuIDByPort(n)
+	if toDeviceID == 0 {
+		return true
+	}
+
+	page, found := d.pageTable.ReverseLookup(n.PAddr)
+	if !found {
+		return true
+	}
+
+	pageID := internal.PageID{PID: page.PID, VAddr: page.VAddr}
+	if !canPrefetch(page, toDeviceID) ||
+		d.isPreferredElsewhere(pageID, toDeviceID) ||
+		d.isCounterMigrationPending(pageID) {
+		return true
+	}
+
+	d.pendingCounterMigrations = append(d.pendingCounterMigrations,
+		&counterMigration{page: pageID, toDeviceID: toDeviceID})
+
+	return true
+}
+
+// gpuIDByPort returns the ID of the GPU that sends a notification. It returns
+// 0 if the sender is not a registered GPU.
+func (d *Driver) gpuIDByPort(n *protocol.AccessCounterNotification) uint64 {
+	for i, gpu := range d.GPUs {
+		if gpu.AsRemote() == n.Src {
+			return uint64(i + 1)
+		}
+	}
+
+	return 0
+}
+
+func (d *Driver) isCounterMigrationPending(page internal.PageID) bool {
+	for _, m := range d.pendingCounterMigrations {
+		if m.page == page {
+			return true
+		}
+	}
+
+	return false
+}
+
+// planCounterMigrations moves the pages that the access counters ask for.
+// Like the prefetched pages, only the pages that the MMU is free to migrate
+// are moved, as the pages may have changed since the notifications arrived.
+func (d *Driver) planCounterMigrations(planned map[internal.PageID]bool) {
+	for _, m := range d.currentCounterMigrations {
+		if planned[m.page] {
+			continue
+		}
+
+		page, found := d.pageTable.Find(m.page.PID, m.page.VAddr)
+		if !found || !canPrefetch(page, m.toDeviceID) ||
+			d.isPreferredElsewhere(m.page, m.toDeviceID) {
+			continue
+		}
+
+		planned[m.page] = true
+		d.currentPageMigrations = append(d.currentPageMigrations,
+			&pageMigration{
+				page:             m.page,
+				fromDeviceID:     page.DeviceID,
+				toDeviceID:       m.toDeviceID,
+				counterTriggered: true,
+			})
+	}
+}
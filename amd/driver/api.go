@@ -1,6 +1,7 @@
 package driver
 
 import (
+	"fmt"
 	"log"
 	"math"
 	"sync/atomic"
@@ -102,6 +103,7 @@ func (d *Driver) mustBeAllActualGPUs(gpuIDs []int) {
 // CreateCommandQueue creates a command queue in the driver
 func (d *Driver) CreateCommandQueue(c *Context) *CommandQueue {
 	q := new(CommandQueue)
+	q.ID = sim.GetIDGenerator().Generate()
 	q.GPUID = c.currentGPUID
 	q.Context = c
 
@@ -112,6 +114,72 @@ func (d *Driver) CreateCommandQueue(c *Context) *CommandQueue {
 	return q
 }
 
+// CreateCommandQueueWithPriority creates a command queue whose kernels are
+// scheduled with the given priority by the command processor.
+func (d *Driver) CreateCommandQueueWithPriority(
+	c *Context,
+	priority int,
+) *CommandQueue {
+	q := d.CreateCommandQueue(c)
+	q.Priority = priority
+
+	return q
+}
+
+// CreateCommandQueueWithCUMask creates a command queue whose kernels can only
+// run on the CUs in the mask. Bit i of the mask (bit i%32 of word i/32)
+// allows CU i. An error is returned if the mask allows none of the CUs of the
+// GPU.
+func (d *Driver) CreateCommandQueueWithCUMask(
+	c *Context,
+	cuMask []uint32,
+) (*CommandQueue, error) {
+	err := d.checkCUMask(c.currentGPUID, cuMask)
+	if err != nil {
+		return nil, err
+	}
+
+	q := d.CreateCommandQueue(c)
+	q.CUMask = cuMask
+
+	return q, nil
+}
+
+// checkCUMask returns an error if a CU mask allows none of the CUs of a GPU,
+// as the kernels would have no CU to run on. For unified multi-GPU devices,
+// the mask must allow a CU on each of the GPUs. A nil mask allows all the
+// CUs.
+func (d *Driver) checkCUMask(gpuID int, cuMask []uint32) error {
+	if cuMask == nil {
+		return nil
+	}
+
+	gpuIDs := []int{gpuID}
+	if dev := d.devices[gpuID]; dev.Type == internal.DeviceTypeUnifiedGPU {
+		gpuIDs = dev.UnifiedGPUIDs
+	}
+
+	for _, id := range gpuIDs {
+		numCU := d.devices[id].Properties.CUCount
+		if !cuMaskAllowsAnyCU(cuMask, numCU) {
+			return fmt.Errorf("CU mask %x allows none of the %d CUs of GPU %d",
+				cuMask, numCU, id)
+		}
+	}
+
+	return nil
+}
+
+func cuMaskAllowsAnyCU(cuMask []uint32, numCU int) bool {
+	for i := 0; i < numCU && i/32 < len(cuMask); i++ {
+		if cuMask[i/32]&(1<<uint(i%32)) != 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
 // DrainCommandQueue will return when there is no command to execute
 func (d *Driver) DrainCommandQueue(q *CommandQueue) {
 	listener := q.Subscribe()
@@ -147,12 +215,17 @@ func (d *Driver) AllocateMemory(
 	return Ptr(ptr)
 }
 
-// AllocateUnifiedMemory allocates a unified memory. Allocation is done on CPU
+// AllocateUnifiedMemory allocates a unified memory. The pages are initially
+// placed on the unified memory home device, which can be configured with the
+// driver builder, and migrate to the GPUs that access them.
 func (d *Driver) AllocateUnifiedMemory(
 	ctx *Context,
 	byteSize uint64,
 ) Ptr {
-	ptr := Ptr(d.memAllocator.AllocateUnified(ctx.pid, byteSize))
+	ptr := Ptr(d.memAllocator.AllocateUnified(
+		ctx.pid, byteSize, d.unifiedMemoryHomeDevice))
+	d.trackUnifiedPages(
+		ctx.pid, uint64(ptr), byteSize, d.unifiedMemoryHomeDevice)
 
 	ctx.buffers = append(ctx.buffers, &buffer{
 		vAddr:   ptr,
@@ -210,6 +283,8 @@ func (d *Driver) FreeMemory(ctx *Context, ptr Ptr) error {
 	for i, buffer := range ctx.buffers {
 		if buffer.vAddr == ptr {
 			ctx.buffers[i].freed = true
+			d.untrackUnifiedPages(ctx.pid, uint64(ptr), buffer.size)
+			d.forgetMemAdvice(ctx, uint64(ptr), buffer.size)
 		}
 	}
 
@@ -245,16 +320,56 @@ func (d *Driver) EnqueueMemCopyD2H(
 	d.Enqueue(queue, cmd)
 }
 
+// EnqueuePrefetch registers a PrefetchCommand in the queue. When the command
+// is processed, the unified memory pages in the given range migrate to the
+// GPU.
+func (d *Driver) EnqueuePrefetch(
+	queue *CommandQueue,
+	ptr Ptr,
+	byteSize uint64,
+	gpuID int,
+) {
+	if gpuID < 1 || gpuID > d.GetNumGPUs() {
+		log.Panicf("cannot prefetch to device %d", gpuID)
+	}
+
+	cmd := &PrefetchCommand{
+		ID:       sim.GetIDGenerator().Generate(),
+		Ptr:      ptr,
+		ByteSize: byteSize,
+		GPUID:    gpuID,
+	}
+	d.Enqueue(queue, cmd)
+}
+
 //go:embed memcopy.hsaco
 var kernelBytes []byte
 
-// EnqueueMemCopyD2D registers a MemCopyD2DCommand (LaunchKernelCommand) in the
-// queue.
+// EnqueueMemCopyD2D registers a MemCopyD2DCommand in the queue. The DMA engine
+// of the source GPU copies the data, through RDMA if the destination is on
+// another GPU. num is the total number of bytes.
 func (d *Driver) EnqueueMemCopyD2D(
 	queue *CommandQueue,
 	dst Ptr,
 	src Ptr,
 	num int,
+) {
+	cmd := &MemCopyD2DCommand{
+		ID:       sim.GetIDGenerator().Generate(),
+		Dst:      dst,
+		Src:      src,
+		ByteSize: uint64(num),
+	}
+	d.Enqueue(queue, cmd)
+}
+
+// EnqueueMemCopyD2DWithKernel registers a kernel that copies memory from a GPU
+// device to another GPU device. num is the total number of bytes.
+func (d *Driver) EnqueueMemCopyD2DWithKernel(
+	queue *CommandQueue,
+	dst Ptr,
+	src Ptr,
+	num int,
 ) {
 	co := kernels.LoadProgramFromMemory(
 		kernelBytes, "copyKernel")
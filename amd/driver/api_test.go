@@ -66,6 +66,38 @@ var _ = ginkgo.Describe("Driver async API execution", func() {
 		Expect(q.commands).To(HaveLen(0))
 	})
 
+	ginkgo.It("should synchronize events", func() {
+		context := driver.Init()
+		q1 := driver.CreateCommandQueue(context)
+		q2 := driver.CreateCommandQueue(context)
+		event := driver.CreateEvent()
+		enqueueNoopCommand(driver, q1)
+		driver.EnqueueRecordEvent(q1, event)
+		driver.EnqueueWaitEvent(q2, event)
+		enqueueNoopCommand(driver, q2)
+
+		driver.EventSynchronize(event)
+		driver.DrainCommandQueue(q2)
+
+		Expect(driver.EventQuery(event)).To(BeTrue())
+		Expect(q1.commands).To(HaveLen(0))
+		Expect(q2.commands).To(HaveLen(0))
+	})
+
+	ginkgo.It("should run host functions", func() {
+		context := driver.Init()
+		q := driver.CreateCommandQueue(context)
+		var calledAt sim.VTimeInSec
+		driver.EnqueueHostFunc(q, func() {
+			calledAt = engine.CurrentTime()
+		})
+
+		driver.DrainCommandQueue(q)
+
+		Expect(calledAt).To(BeNumerically(">=", 1e-6))
+		Expect(q.commands).To(HaveLen(0))
+	})
+
 	ginkgo.It("should allocate memory", func() {
 		context := driver.Init()
 
@@ -90,6 +122,49 @@ var _ = ginkgo.Describe("Driver async API execution", func() {
 		Expect(context.buffers[0].l2Dirty).To(BeFalse())
 	})
 
+	ginkgo.It("should pin pages on the preferred location", func() {
+		context := driver.Init()
+		ptr := driver.AllocateUnifiedMemory(context, 0x2000)
+
+		driver.MemAdvise(context, ptr, 0x1000, MemAdvice{
+			Kind:     MemAdviseSetPreferredLocation,
+			DeviceID: 1,
+		})
+
+		page, _ := pageTable.Find(context.pid, uint64(ptr))
+		Expect(page.IsPinned).To(BeTrue())
+		page, _ = pageTable.Find(context.pid, uint64(ptr)+0x1000)
+		Expect(page.IsPinned).To(BeFalse())
+	})
+
+	ginkgo.It("should pin pages accessed by other devices", func() {
+		context := driver.Init()
+		ptr := driver.AllocateUnifiedMemory(context, 0x1000)
+
+		driver.MemAdvise(context, ptr, 0x1000, MemAdvice{
+			Kind:     MemAdviseSetAccessedBy,
+			DeviceID: 2,
+		})
+		page, _ := pageTable.Find(context.pid, uint64(ptr))
+		Expect(page.IsPinned).To(BeTrue())
+
+		driver.MemAdvise(context, ptr, 0x1000, MemAdvice{
+			Kind:     MemAdviseUnsetAccessedBy,
+			DeviceID: 2,
+		})
+		page, _ = pageTable.Find(context.pid, uint64(ptr))
+		Expect(page.IsPinned).To(BeFalse())
+	})
+
+	ginkgo.It("should not prefetch to a device that does not exist", func() {
+		context := driver.Init()
+		q := driver.CreateCommandQueue(context)
+		ptr := driver.AllocateUnifiedMemory(context, 0x1000)
+
+		Expect(func() { driver.EnqueuePrefetch(q, ptr, 0x1000, 3) }).
+			To(Panic())
+	})
+
 	// ginkgo.Measure("Memory allocation", func(b ginkgo.Benchmarker) {
 	// 	context := driver.Init()
 	// 	b.Time("runtime", func() {
@@ -17,13 +17,42 @@ type Builder struct {
 	useMagicMemoryCopy  bool
 	middlewareD2HCycles int
 	middlewareH2DCycles int
+
+	pageableCopyBandwidth float64
+	hostLinkBandwidth     float64
+
+	unifiedMemoryHomeDevice     int
+	unifiedMemoryCapacity       uint64
+	unifiedMemoryEvictionPolicy string
+
+	migrationBatchSize     int
+	migrationBatchWindow   int
+	migrationPrefetcher    string
+	migrationPrefetchDepth int
+
+	maxOutstandingMigrations int
+	accessCounterMigration   bool
+
+	cpuFreq         sim.Freq
+	cpuIPC          float64
+	hostFuncLatency sim.VTimeInSec
 }
 
 // MakeBuilder creates a driver builder with some default configuration
 // parameters.
 func MakeBuilder() Builder {
 	return Builder{
-		freq: 1 * sim.GHz,
+		freq:                        1 * sim.GHz,
+		unifiedMemoryHomeDevice:     1,
+		unifiedMemoryEvictionPolicy: "lru",
+		migrationBatchSize:          1,
+		migrationPrefetcher:         "none",
+		migrationPrefetchDepth:      8,
+		maxOutstandingMigrations:    1,
+		cpuFreq:                     3 * sim.GHz,
+		cpuIPC:                      1,
+		hostFuncLatency:             1e-6,
+		hostLinkBandwidth:           31.5e9,
 	}
 }
 
@@ -74,6 +103,113 @@ func (b Builder) WithH2DCycles(h2dCycles int) Builder {
 	return b
 }
 
+// WithPageableCopyBandwidth sets the number of bytes per second that the host
+// copies between pageable memory and the pinned staging buffer when copying
+// between pageable memory and the GPUs. 0, the default, makes staging free.
+func (b Builder) WithPageableCopyBandwidth(bytesPerSecond float64) Builder {
+	b.pageableCopyBandwidth = bytesPerSecond
+	return b
+}
+
+// WithHostLinkBandwidth sets the number of bytes per second that the host link
+// transfers the data of a memory copy that is resident in the host memory,
+// such as host memory or unified memory that lives on the host. The default
+// is the bandwidth of a PCIe 4.0 x16 link. 0 copies the data instantly.
+func (b Builder) WithHostLinkBandwidth(bytesPerSecond float64) Builder {
+	b.hostLinkBandwidth = bytesPerSecond
+	return b
+}
+
+// WithUnifiedMemoryHomeDevice sets the device that unified memory pages are
+// allocated on. Use 0 to place the pages on the host, so that the pages are
+// migrated to the GPUs on the first access.
+func (b Builder) WithUnifiedMemoryHomeDevice(deviceID int) Builder {
+	b.unifiedMemoryHomeDevice = deviceID
+	return b
+}
+
+// WithUnifiedMemoryCapacity sets the number of bytes of unified memory that
+// each GPU can hold. When a page migration exceeds the capacity, some unified
+// memory pages are evicted to the host. By default, the capacity is the DRAM
+// size of the GPU.
+func (b Builder) WithUnifiedMemoryCapacity(byteSize uint64) Builder {
+	b.unifiedMemoryCapacity = byteSize
+	return b
+}
+
+// WithUnifiedMemoryEvictionPolicy sets the policy that selects the unified
+// memory pages to evict. Supported policies are "lru", "fifo", and "random".
+func (b Builder) WithUnifiedMemoryEvictionPolicy(policy string) Builder {
+	b.unifiedMemoryEvictionPolicy = policy
+	return b
+}
+
+// WithMigrationBatchSize sets the maximum number of page migration requests
+// from the MMU that are served together with one RDMA drain, TLB shootdown,
+// and restart sequence.
+func (b Builder) WithMigrationBatchSize(n int) Builder {
+	b.migrationBatchSize = n
+	return b
+}
+
+// WithMigrationBatchWindow sets the number of cycles that the driver waits
+// for more page migration requests before serving a batch that is not full.
+func (b Builder) WithMigrationBatchWindow(cycles int) Builder {
+	b.migrationBatchWindow = cycles
+	return b
+}
+
+// WithMigrationPrefetcher sets the prefetcher that selects the pages that
+// migrate together with the faulting pages. Supported prefetchers are "none",
+// "sequential", and "tree".
+func (b Builder) WithMigrationPrefetcher(name string) Builder {
+	b.migrationPrefetcher = name
+	return b
+}
+
+// WithMigrationPrefetchDepth sets the number of pages that the sequential
+// prefetcher brings in after each faulting page.
+func (b Builder) WithMigrationPrefetchDepth(n int) Builder {
+	b.migrationPrefetchDepth = n
+	return b
+}
+
+// WithMaxOutstandingMigrations sets the number of page transfers that the
+// driver lets the GPUs perform at the same time.
+func (b Builder) WithMaxOutstandingMigrations(n int) Builder {
+	b.maxOutstandingMigrations = n
+	return b
+}
+
+// WithAccessCounterMigration lets the driver move the pages that the access
+// counters of the GPUs ask for. A page is moved to the GPU that accesses it
+// remotely, unless the page is pinned or prefers another device.
+func (b Builder) WithAccessCounterMigration() Builder {
+	b.accessCounterMigration = true
+	return b
+}
+
+// WithCPUFreq sets the frequency of the host CPU.
+func (b Builder) WithCPUFreq(freq sim.Freq) Builder {
+	b.cpuFreq = freq
+	return b
+}
+
+// WithCPUIPC sets the number of instructions that the host CPU completes per
+// cycle when running host functions.
+func (b Builder) WithCPUIPC(ipc float64) Builder {
+	b.cpuIPC = ipc
+	return b
+}
+
+// WithHostFuncLatency sets the fixed time that the host spends on each host
+// function, in addition to the time estimated from the number of
+// instructions. It models the cost of waking up the host thread.
+func (b Builder) WithHostFuncLatency(latency sim.VTimeInSec) Builder {
+	b.hostFuncLatency = latency
+	return b
+}
+
 // Build creates a driver.
 func (b Builder) Build(name string) *Driver {
 	driver := new(Driver)
@@ -92,6 +228,21 @@ func (b Builder) Build(name string) *Driver {
 	driver.pageTable = b.pageTable
 	driver.globalStorage = b.globalStorage
 
+	driver.unifiedMemoryHomeDevice = b.unifiedMemoryHomeDevice
+	driver.unifiedMemoryCapacity = b.unifiedMemoryCapacity
+	driver.unifiedMemoryEvictionPolicy = b.unifiedMemoryEvictionPolicy
+	driver.residentUnifiedPages = make(map[int]internal.EvictionPolicy)
+	driver.unifiedMemoryTransfers = make(map[string]*unifiedMemoryTransfer)
+	driver.pageAdvices = make(map[internal.PageID]*pageAdvice)
+	driver.contextSaveAreas = make(map[string][]uint64)
+
+	driver.migrationBatchSize = b.migrationBatchSize
+	driver.migrationBatchWindow = b.migrationBatchWindow
+	driver.maxOutstandingMigrations = b.maxOutstandingMigrations
+	driver.accessCounterMigration = b.accessCounterMigration
+	driver.migrationPrefetcher = internal.NewMigrationPrefetcher(
+		b.migrationPrefetcher, b.log2PageSize, b.migrationPrefetchDepth)
+
 	if b.useMagicMemoryCopy {
 		globalStorageMemoryCopyMiddleware := &globalStorageMemoryCopyMiddleware{
 			driver: driver,
@@ -102,10 +253,21 @@ func (b Builder) Build(name string) *Driver {
 			driver:       driver,
 			cyclesPerD2H: b.middlewareD2HCycles,
 			cyclesPerH2D: b.middlewareH2DCycles,
+
+			pageableCopyBandwidth: b.pageableCopyBandwidth,
+			hostLinkBandwidth:     b.hostLinkBandwidth,
 		}
 		driver.middlewares = append(driver.middlewares, defaultMemoryCopyMiddleware)
 	}
 
+	driver.middlewares = append(driver.middlewares,
+		&prefetchMiddleware{driver: driver})
+	driver.middlewares = append(driver.middlewares,
+		&hostFuncMiddleware{
+			driver:  driver,
+			latency: b.hostFuncLatency,
+		})
+
 	driver.gpuPort = sim.NewPort(driver, 40960000, 40960000, "Driver.ToGPUs")
 	driver.AddPort("GPU", driver.gpuPort)
 	driver.mmuPort = sim.NewPort(driver, 1, 1, "Driver.ToMMU")
@@ -124,6 +286,10 @@ func (b *Builder) createCPU(d *Driver) {
 		ID:       0,
 		Type:     internal.DeviceTypeCPU,
 		MemState: internal.NewDeviceMemoryState(d.Log2PageSize),
+		Properties: internal.DeviceProperties{
+			Freq: b.cpuFreq,
+			IPC:  b.cpuIPC,
+		},
 	}
 	cpu.SetTotalMemSize(4 * mem.GB)
 
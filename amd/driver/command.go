@@ -75,6 +75,37 @@ func (c *MemCopyD2HCommand) RemoveReq(req sim.Msg) {
 	c.Reqs = removeMsgFromMsgList(req, c.Reqs)
 }
 
+// A MemCopyD2DCommand is a command that copies memory from a GPU to another
+// GPU, or within a GPU, when the command is processed.
+type MemCopyD2DCommand struct {
+	ID       string
+	Dst      Ptr
+	Src      Ptr
+	ByteSize uint64
+	Reqs     []sim.Msg
+}
+
+// GetID returns the ID of the command
+func (c *MemCopyD2DCommand) GetID() string {
+	return c.ID
+}
+
+// GetReqs returns the request associated with the command
+func (c *MemCopyD2DCommand) GetReqs() []sim.Msg {
+	return c.Reqs
+}
+
+// AddReq adds a request to the request list associated with the command
+func (c *MemCopyD2DCommand) AddReq(req sim.Msg) {
+	c.Reqs = append(c.Reqs, req)
+}
+
+// RemoveReq removes a request from the request list associated with the
+// command.
+func (c *MemCopyD2DCommand) RemoveReq(req sim.Msg) {
+	c.Reqs = removeMsgFromMsgList(req, c.Reqs)
+}
+
 // A LaunchKernelCommand is a command will execute a kernel when it is
 // processed.
 type LaunchKernelCommand struct {
@@ -86,6 +117,14 @@ type LaunchKernelCommand struct {
 	Packet     *kernels.HsaKernelDispatchPacket
 	DPacket    Ptr
 	Reqs       []sim.Msg
+
+	// CUMask limits the CUs that the kernel can use. If it is nil, the mask
+	// of the command queue is used.
+	CUMask []uint32
+
+	// Cooperative tells if all the work-groups of the kernel must run at the
+	// same time.
+	Cooperative bool
 }
 
 // GetID returns the ID of the command
@@ -136,6 +175,199 @@ func (c *FlushCommand) RemoveReq(req sim.Msg) {
 	c.Reqs = removeMsgFromMsgList(req, c.Reqs)
 }
 
+// A PrefetchCommand is a command that migrates a range of unified memory to a
+// GPU before the GPU accesses it.
+type PrefetchCommand struct {
+	ID       string
+	Ptr      Ptr
+	ByteSize uint64
+	GPUID    int
+	Reqs     []sim.Msg
+}
+
+// GetID returns the ID of the command
+func (c *PrefetchCommand) GetID() string {
+	return c.ID
+}
+
+// GetReqs returns the request associated with the command
+func (c *PrefetchCommand) GetReqs() []sim.Msg {
+	return c.Reqs
+}
+
+// AddReq adds a request to the request list associated with the command
+func (c *PrefetchCommand) AddReq(req sim.Msg) {
+	c.Reqs = append(c.Reqs, req)
+}
+
+// RemoveReq removes a request from the request list associated with the
+// command.
+func (c *PrefetchCommand) RemoveReq(req sim.Msg) {
+	c.Reqs = removeMsgFromMsgList(req, c.Reqs)
+}
+
+// A RecordEventCommand is a command that completes an event when it is
+// processed.
+type RecordEventCommand struct {
+	ID    string
+	Event *Event
+
+	generation int
+}
+
+// GetID returns the ID of the command
+func (c *RecordEventCommand) GetID() string {
+	return c.ID
+}
+
+// GetReqs returns the request associated with the command
+func (c *RecordEventCommand) GetReqs() []sim.Msg {
+	return nil
+}
+
+// AddReq adds a request to the request list associated with the command
+func (c *RecordEventCommand) AddReq(req sim.Msg) {
+	// No action
+}
+
+// RemoveReq removes a request from the request list associated with the
+// command.
+func (c *RecordEventCommand) RemoveReq(req sim.Msg) {
+	// No action
+}
+
+// A WaitEventCommand is a command that blocks the command queue until an
+// event completes.
+type WaitEventCommand struct {
+	ID    string
+	Event *Event
+
+	generation int
+}
+
+// GetID returns the ID of the command
+func (c *WaitEventCommand) GetID() string {
+	return c.ID
+}
+
+// GetReqs returns the request associated with the command
+func (c *WaitEventCommand) GetReqs() []sim.Msg {
+	return nil
+}
+
+// AddReq adds a request to the request list associated with the command
+func (c *WaitEventCommand) AddReq(req sim.Msg) {
+	// No action
+}
+
+// RemoveReq removes a request from the request list associated with the
+// command.
+func (c *WaitEventCommand) RemoveReq(req sim.Msg) {
+	// No action
+}
+
+// A HostFuncCommand is a command that runs a callback on the host when the
+// queue reaches it. The queue is blocked while the host runs the callback.
+//
+// If Duration is not zero, the host takes Duration to run the callback.
+// Otherwise, the time is estimated from NumInsts with the CPU model of the
+// driver.
+type HostFuncCommand struct {
+	ID       string
+	Func     func()
+	Duration sim.VTimeInSec
+	NumInsts uint64
+}
+
+// GetID returns the ID of the command
+func (c *HostFuncCommand) GetID() string {
+	return c.ID
+}
+
+// GetReqs returns the request associated with the command
+func (c *HostFuncCommand) GetReqs() []sim.Msg {
+	return nil
+}
+
+// AddReq adds a request to the request list associated with the command
+func (c *HostFuncCommand) AddReq(req sim.Msg) {
+	// No action
+}
+
+// RemoveReq removes a request from the request list associated with the
+// command.
+func (c *HostFuncCommand) RemoveReq(req sim.Msg) {
+	// No action
+}
+
+// A PreemptKernelCommand is a command that preempts the kernel that another
+// queue is running. The kernel stays in the other queue and does not make
+// progress until a ResumeKernelCommand resumes it.
+type PreemptKernelCommand struct {
+	ID     string
+	Target *CommandQueue
+	Mode   PreemptionMode
+	Reqs   []sim.Msg
+
+	// Preempted tells if the GPUs preempt the kernel. It is false if the
+	// target queue is not running a kernel or runs a cooperative kernel.
+	Preempted bool
+
+	// SavedByteSize is the number of bytes of work-group state that the GPUs
+	// save. It is set when the command completes.
+	SavedByteSize uint64
+}
+
+// GetID returns the ID of the command
+func (c *PreemptKernelCommand) GetID() string {
+	return c.ID
+}
+
+// GetReqs returns the request associated with the command
+func (c *PreemptKernelCommand) GetReqs() []sim.Msg {
+	return c.Reqs
+}
+
+// AddReq adds a request to the request list associated with the command
+func (c *PreemptKernelCommand) AddReq(req sim.Msg) {
+	c.Reqs = append(c.Reqs, req)
+}
+
+// RemoveReq removes a request from the request list associated with the
+// command.
+func (c *PreemptKernelCommand) RemoveReq(req sim.Msg) {
+	c.Reqs = removeMsgFromMsgList(req, c.Reqs)
+}
+
+// A ResumeKernelCommand is a command that resumes the preempted kernel of
+// another queue.
+type ResumeKernelCommand struct {
+	ID     string
+	Target *CommandQueue
+	Reqs   []sim.Msg
+}
+
+// GetID returns the ID of the command
+func (c *ResumeKernelCommand) GetID() string {
+	return c.ID
+}
+
+// GetReqs returns the request associated with the command
+func (c *ResumeKernelCommand) GetReqs() []sim.Msg {
+	return c.Reqs
+}
+
+// AddReq adds a request to the request list associated with the command
+func (c *ResumeKernelCommand) AddReq(req sim.Msg) {
+	c.Reqs = append(c.Reqs, req)
+}
+
+// RemoveReq removes a request from the request list associated with the
+// command.
+func (c *ResumeKernelCommand) RemoveReq(req sim.Msg) {
+	c.Reqs = removeMsgFromMsgList(req, c.Reqs)
+}
+
 // A NoopCommand is a command that does not do anything. It is used for testing
 // purposes.
 type NoopCommand struct {
@@ -184,6 +416,10 @@ type LaunchUnifiedMultiGPUKernelCommand struct {
 	PacketArray  []*kernels.HsaKernelDispatchPacket
 	DPacketArray []Ptr
 	Reqs         []sim.Msg
+
+	// CUMask limits the CUs that the kernel can use on each GPU. If it is
+	// nil, the mask of the command queue is used.
+	CUMask []uint32
 }
 
 // GetID returns the ID of the command
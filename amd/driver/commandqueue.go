@@ -9,18 +9,55 @@ import (
 // A CommandQueue maintains a queue of command where the commands from the
 // queue will executes in order.
 type CommandQueue struct {
+	ID        string
 	IsRunning bool
 	GPUID     int
 	PID       vm.PID
 	Context   *Context
 
+	// Priority is the priority of the hardware queue that the command queue
+	// maps to. Higher values are scheduled first. If it is 0, the priority
+	// in the kernel code object is used.
+	Priority int
+
+	// CUMask limits the CUs that the kernels of the queue can use. Bit i of
+	// the mask (bit i%32 of word i/32) allows CU i. A nil mask allows all the
+	// CUs.
+	CUMask []uint32
+
+	// DeviceQueue is the queue that the kernels of the command queue can
+	// launch child kernels to. It is nil if the kernels cannot launch kernels.
+	DeviceQueue *DeviceQueue
+
 	commandsMutex sync.Mutex
 	commands      []Command
 
+	errMutex sync.Mutex
+	err      error
+
 	listenerMutex sync.Mutex
 	listeners     []*CommandQueueStatusListener
 }
 
+// Err returns the first error that the GPU has reported for the commands of
+// the queue, such as a cooperative kernel whose work-groups cannot run at the
+// same time. It is nil if no command has failed.
+func (q *CommandQueue) Err() error {
+	q.errMutex.Lock()
+	defer q.errMutex.Unlock()
+
+	return q.err
+}
+
+func (q *CommandQueue) setErr(err error) {
+	q.errMutex.Lock()
+	defer q.errMutex.Unlock()
+
+	if q.err == nil {
+		q.err = err
+	}
+}
+
 // Subscribe returns a CommandQueueStatusListener that listens to the update
 // of the command queue
 func (q *CommandQueue) Subscribe() *CommandQueueStatusListener {
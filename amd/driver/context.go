@@ -15,6 +15,11 @@ type buffer struct {
 	// to this buffer. Therefore, copying from or to this buffer triggers L2
 	// flushing.
 	l2Dirty bool
+
+	// host tells if the buffer is in the host memory. The host memory is
+	// either pinned or pageable.
+	host   bool
+	pinned bool
 }
 
 // Context is an opaque struct that carries the information used by the driver.
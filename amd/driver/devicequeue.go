@@ -0,0 +1,111 @@
+package driver
+
+import (
+	"github.com/sarchlab/mgpusim/v4/amd/insts"
+	"github.com/sarchlab/mgpusim/v4/amd/protocol"
+)
+
+// A DeviceQueue is a queue in the GPU memory that kernels can write kernel
+// dispatch packets into. The Command Processor reads the packets and launches
+// the child kernels. A kernel that is launched from a command queue with a
+// device queue completes after all its child kernels complete.
+//
+// The queue starts with a header of protocol.DeviceQueueHeaderSize bytes,
+// whose first 8 bytes is the write index and the next 8 bytes is the read
+// index. A kernel launches a child kernel by writing a
+// kernels.HsaKernelDispatchPacket to slot (write index % NumSlots) and then
+// incrementing the write index. The Command Processor advances the read index
+// after it has read the packets, and a kernel must wait until the write index
+// is less than the read index plus NumSlots before it writes a packet. The read
+// index should be loaded with the GLC bit set, so that the load does not hit a
+// stale line in the L1 cache. The Command Processor panics if the kernels
+// overwrite a packet that it has not read.
+type DeviceQueue struct {
+	Address  Ptr
+	NumSlots int
+
+	kernelObjects map[*insts.HsaCo]Ptr
+	info          *protocol.DeviceQueueInfo
+}
+
+// KernelObject returns the address that the packets use to launch a child
+// kernel. The code object must be given when the device queue is created.
+func (q *DeviceQueue) KernelObject(co *insts.HsaCo) Ptr {
+	ptr, ok := q.kernelObjects[co]
+	if !ok {
+		panic("the kernel is not registered with the device queue")
+	}
+
+	return ptr
+}
+
+// SlotAddress returns the address of a packet slot.
+func (q *DeviceQueue) SlotAddress(slot int) Ptr {
+	return q.Address + Ptr(protocol.DeviceQueueHeaderSize+
+		slot*protocol.DeviceQueueSlotSize)
+}
+
+// CreateDeviceQueue creates a device queue with the given number of packet
+// slots and attaches it to the command queue. The kernels launched from the
+// command queue can launch the child kernels given here.
+func (d *Driver) CreateDeviceQueue(
+	queue *CommandQueue,
+	numSlots int,
+	childKernels ...*insts.HsaCo,
+) *DeviceQueue {
+	ctx := queue.Context
+	byteSize := uint64(protocol.DeviceQueueHeaderSize +
+		numSlots*protocol.DeviceQueueSlotSize)
+
+	q := &DeviceQueue{
+		Address:       d.AllocateMemory(ctx, byteSize),
+		NumSlots:      numSlots,
+		kernelObjects: make(map[*insts.HsaCo]Ptr),
+	}
+	d.EnqueueMemCopyH2D(queue, q.Address,
+		make([]byte, protocol.DeviceQueueHeaderSize))
+
+	for _, co := range childKernels {
+		dCoData := d.AllocateMemory(ctx, uint64(len(co.Data)))
+		d.EnqueueMemCopyH2D(queue, dCoData, co.Data)
+		q.kernelObjects[co] = dCoData
+	}
+
+	q.info = d.deviceQueueInfo(ctx, q)
+	queue.DeviceQueue = q
+
+	return q
+}
+
+// deviceQueueInfo translates the addresses of the device queue, so that the
+// Command Processor can read the queue without address translation.
+func (d *Driver) deviceQueueInfo(
+	ctx *Context,
+	q *DeviceQueue,
+) *protocol.DeviceQueueInfo {
+	info := &protocol.DeviceQueueInfo{
+		Address:     uint64(q.Address),
+		HeaderPAddr: d.physicalAddress(ctx, q.Address),
+		SlotPAddrs:  make([]uint64, q.NumSlots),
+		CodeObjects: make(map[uint64]*insts.HsaCo),
+	}
+
+	for i := range info.SlotPAddrs {
+		info.SlotPAddrs[i] = d.physicalAddress(ctx, q.SlotAddress(i))
+	}
+
+	for co, ptr := range q.kernelObjects {
+		info.CodeObjects[uint64(ptr)] = co
+	}
+
+	return info
+}
+
+func (d *Driver) physicalAddress(ctx *Context, ptr Ptr) uint64 {
+	page, found := d.pageTable.Find(ctx.pid, uint64(ptr))
+	if !found {
+		panic("page not found")
+	}
+
+	return page.PAddr + (uint64(ptr) - page.VAddr)
+}
@@ -47,8 +47,20 @@ type Driver struct {
 
 	Log2PageSize uint64
 
-	currentPageMigrationReq         *vm.PageMigrationReqToDriver
-	toSendToMMU                     *vm.PageMigrationRspFromDriver
+	currentPageMigrationReqs        []*vm.PageMigrationReqToDriver
+	pendingPageMigrationReqs        []*vm.PageMigrationReqToDriver
+	currentPageMigrations           []*pageMigration
+	migrationEpochID                string
+	migrationBatchSize              int
+	migrationBatchWindow            int
+	migrationBatchCyclesLeft        int
+	migrationPrefetcher             internal.MigrationPrefetcher
+	toSendToMMU                     []*vm.PageMigrationRspFromDriver
+	pendingPrefetches               []*queuedPrefetch
+	currentPrefetches               []*queuedPrefetch
+	accessCounterMigration          bool
+	pendingCounterMigrations        []*counterMigration
+	currentCounterMigrations        []*counterMigration
 	migrationReqToSendToCP          []*protocol.PageMigrationReqToCP
 	isCurrentlyHandlingMigrationReq bool
 	numRDMADrainACK                 uint64
@@ -56,7 +68,23 @@ type Driver struct {
 	numShootDownACK                 uint64
 	numRestartACK                   uint64
 	numPagesMigratingACK            uint64
-	isCurrentlyMigratingOnePage     bool
+	numOutstandingMigrations        int
+	maxOutstandingMigrations        int
+
+	unifiedMemoryHomeDevice     int
+	unifiedMemoryCapacity       uint64
+	unifiedMemoryEvictionPolicy string
+	unifiedMemoryMutex          sync.Mutex
+	residentUnifiedPages        map[int]internal.EvictionPolicy
+	evictionVictims             []evictionVictim
+	unifiedMemoryTransfers      map[string]*unifiedMemoryTransfer
+
+	memAdviceMutex sync.Mutex
+	pageAdvices    map[internal.PageID]*pageAdvice
+
+	// contextSaveAreas are the addresses of the context-save areas of the
+	// preempted kernels, by the ID of the LaunchKernelReq.
+	contextSaveAreas map[string][]uint64
 
 	RemotePMCPorts []sim.Port
 }
@@ -157,6 +185,9 @@ func (d *Driver) RegisterGPU(
 	gpuDevice.SetTotalMemSize(properties.DRAMSize)
 	d.memAllocator.RegisterDevice(gpuDevice)
 
+	d.residentUnifiedPages[gpuDevice.ID] =
+		internal.NewEvictionPolicy(d.unifiedMemoryEvictionPolicy)
+
 	d.devices = append(d.devices, gpuDevice)
 }
 
@@ -220,6 +251,20 @@ func (d *Driver) processReturnReq() bool {
 	case *protocol.GPURestartRsp:
 		d.gpuPort.RetrieveIncoming()
 		return d.handleGPURestartRsp(req)
+	case *protocol.PreemptKernelRsp:
+		d.gpuPort.RetrieveIncoming()
+		return d.processPreemptKernelRsp(req)
+	case *protocol.ResumeKernelRsp:
+		d.gpuPort.RetrieveIncoming()
+		return d.processResumeKernelRsp(req)
+	case *protocol.AccessCounterNotification:
+		d.gpuPort.RetrieveIncoming()
+		return d.processAccessCounterNotification(req)
+	case *sim.GeneralRsp:
+		if d.isUnifiedMemoryTransfer(req.OriginalReq) {
+			d.gpuPort.RetrieveIncoming()
+			return d.processUnifiedMemoryTransferRsp(req)
+		}
 	}
 
 	return false
@@ -276,6 +321,17 @@ func (d *Driver) processOneCommand(
 	case *NoopCommand:
 		d.logCmdStart(cmd)
 		return d.processNoopCommand(cmd, cmdQueue)
+	case *RecordEventCommand:
+		d.logCmdStart(cmd)
+		return d.processRecordEventCommand(cmd, cmdQueue)
+	case *WaitEventCommand:
+		return d.processWaitEventCommand(cmd, cmdQueue)
+	case *PreemptKernelCommand:
+		d.logCmdStart(cmd)
+		return d.processPreemptKernelCommand(cmd, cmdQueue)
+	case *ResumeKernelCommand:
+		d.logCmdStart(cmd)
+		return d.processResumeKernelCommand(cmd, cmdQueue)
 	case *LaunchUnifiedMultiGPUKernelCommand:
 		d.logCmdStart(cmd)
 		return d.processUnifiedMultiGPULaunchKernelCommand(cmd, cmdQueue)
@@ -344,6 +400,8 @@ func (d *Driver) processLaunchKernelCommand(
 		d.GPUs[queue.GPUID-1])
 	req.PID = queue.Context.pid
 	req.HsaCo = cmd.CodeObject
+	setKernelQueue(req, queue, cmd.CUMask)
+	req.Cooperative = cmd.Cooperative
 
 	req.Packet = cmd.Packet
 	req.PacketAddress = uint64(cmd.DPacket)
@@ -361,6 +419,31 @@ func (d *Driver) processLaunchKernelCommand(
 	return true
 }
 
+// setKernelQueue tells the command processor which hardware queue the kernel
+// goes to, the priority of the queue, the CUs that the kernel can use, and the
+// device queue that the kernel can launch child kernels to.
+func setKernelQueue(
+	req *protocol.LaunchKernelReq,
+	queue *CommandQueue,
+	cuMask []uint32,
+) {
+	req.QueueID = queue.ID
+	req.Priority = queue.Priority
+
+	req.CUMask = cuMask
+	if req.CUMask == nil {
+		req.CUMask = queue.CUMask
+	}
+
+	if queue.DeviceQueue != nil {
+		req.DeviceQueue = queue.DeviceQueue.info
+	}
+
+	if req.Priority == 0 && req.HsaCo != nil && req.HsaCo.HsaCoHeader != nil {
+		req.Priority = int(req.HsaCo.Priority())
+	}
+}
+
 func (d *Driver) processUnifiedMultiGPULaunchKernelCommand(
 	cmd *LaunchUnifiedMultiGPUKernelCommand,
 	queue *CommandQueue,
@@ -376,6 +459,7 @@ func (d *Driver) processUnifiedMultiGPULaunchKernelCommand(
 		req := protocol.NewLaunchKernelReq(d.gpuPort, d.GPUs[gpuID-1])
 		req.PID = queue.Context.pid
 		req.HsaCo = cmd.CodeObject
+		setKernelQueue(req, queue, cmd.CUMask)
 		req.Packet = cmd.PacketArray[i]
 		req.PacketAddress = uint64(cmd.DPacketArray[i])
 
@@ -453,6 +537,11 @@ func (d *Driver) processLaunchKernelReturn(
 ) bool {
 	req, cmd, cmdQueue := d.findCommandByReqID(rsp.RspTo)
 	cmd.RemoveReq(req)
+	d.freeContextSaveAreas(rsp.RspTo)
+
+	if rsp.Err != nil {
+		cmdQueue.setErr(rsp.Err)
+	}
 
 	d.logTaskToGPUClear(req)
 
@@ -525,28 +614,75 @@ func (d *Driver) findCommandByReqID(reqID string) (
 }
 
 func (d *Driver) parseFromMMU() bool {
-	if d.isCurrentlyHandlingMigrationReq {
-		return false
-	}
+	madeProgress := d.receiveMigrationReqsFromMMU()
 
-	req := d.mmuPort.RetrieveIncoming()
-	if req == nil {
-		return false
+	if d.isCurrentlyHandlingMigrationReq ||
+		(len(d.pendingPageMigrationReqs) == 0 &&
+			len(d.pendingPrefetches) == 0 &&
+			len(d.pendingCounterMigrations) == 0) {
+		return madeProgress
 	}
 
-	switch req := req.(type) {
-	case *vm.PageMigrationReqToDriver:
-		d.currentPageMigrationReq = req
-		d.isCurrentlyHandlingMigrationReq = true
-		d.initiateRDMADrain()
-	default:
-		log.Panicf("Driver cannot handle request of type %s",
-			reflect.TypeOf(req))
+	if len(d.pendingPageMigrationReqs) < d.migrationBatchSize &&
+		d.migrationBatchCyclesLeft > 0 {
+		d.migrationBatchCyclesLeft--
+		return true
 	}
 
+	d.startMigrationEpoch()
+
 	return true
 }
 
+// receiveMigrationReqsFromMMU buffers the page migration requests from the
+// MMU so that the requests can be served in batches.
+func (d *Driver) receiveMigrationReqsFromMMU() bool {
+	madeProgress := false
+
+	for len(d.pendingPageMigrationReqs) < d.migrationBatchSize {
+		req := d.mmuPort.RetrieveIncoming()
+		if req == nil {
+			break
+		}
+
+		switch req := req.(type) {
+		case *vm.PageMigrationReqToDriver:
+			if len(d.pendingPageMigrationReqs) == 0 {
+				d.migrationBatchCyclesLeft = d.migrationBatchWindow
+			}
+
+			d.pendingPageMigrationReqs = append(
+				d.pendingPageMigrationReqs, req)
+		default:
+			log.Panicf("Driver cannot handle request of type %s",
+				reflect.TypeOf(req))
+		}
+
+		madeProgress = true
+	}
+
+	return madeProgress
+}
+
+// startMigrationEpoch serves all the buffered page migration requests,
+// prefetch commands, and access counter notifications with one RDMA drain,
+// TLB shootdown, and restart sequence.
+func (d *Driver) startMigrationEpoch() {
+	d.currentPageMigrationReqs = d.pendingPageMigrationReqs
+	d.pendingPageMigrationReqs = nil
+	d.currentPrefetches = d.pendingPrefetches
+	d.pendingPrefetches = nil
+	d.currentCounterMigrations = d.pendingCounterMigrations
+	d.pendingCounterMigrations = nil
+	d.isCurrentlyHandlingMigrationReq = true
+
+	d.migrationEpochID = sim.GetIDGenerator().Generate()
+	tracing.StartTask(d.migrationEpochID, "", d,
+		"page_migration", "migration_epoch", d.currentPageMigrationReqs)
+
+	d.initiateRDMADrain()
+}
+
 func (d *Driver) initiateRDMADrain() bool {
 	for i := 0; i < len(d.GPUs); i++ {
 		req := protocol.NewRDMADrainCmdFromDriver(d.gpuPort,
@@ -571,31 +707,41 @@ func (d *Driver) processRDMADrainRsp(
 }
 
 func (d *Driver) sendShootDownReqs() bool {
-	vAddr := make([]uint64, 0)
-	migrationInfo := d.currentPageMigrationReq.MigrationInfo
+	d.planPageMigrations()
+	d.selectEvictionVictims()
+
+	vAddrs := make(map[vm.PID][]uint64)
+	pids := make([]vm.PID, 0)
+	addPage := func(page internal.PageID) {
+		if _, found := vAddrs[page.PID]; !found {
+			pids = append(pids, page.PID)
+		}
+		vAddrs[page.PID] = append(vAddrs[page.PID], page.VAddr)
+	}
 
-	numReqsGPUInMap := 0
-	for i := 1; i < d.GetNumGPUs()+1; i++ {
-		pages, found := migrationInfo.GPUReqToVAddrMap[uint64(i)]
+	for _, m := range d.currentPageMigrations {
+		addPage(m.page)
+	}
 
-		if found {
-			numReqsGPUInMap++
-			for j := 0; j < len(pages); j++ {
-				vAddr = append(vAddr, pages[j])
-			}
-		}
+	for _, victim := range d.evictionVictims {
+		addPage(victim.page)
 	}
 
-	accessingGPUs := d.currentPageMigrationReq.CurrAccessingGPUs
-	pid := d.currentPageMigrationReq.PID
-	d.numShootDownACK = uint64(len(accessingGPUs))
+	gpus := d.gpusInvolvedInMigration()
+	d.numShootDownACK = uint64(len(gpus) * len(pids))
 
-	for i := 0; i < len(accessingGPUs); i++ {
-		toShootdownGPU := accessingGPUs[i] - 1
-		shootDownReq := protocol.NewShootdownCommand(
-			d.gpuPort, d.GPUs[toShootdownGPU],
-			vAddr, pid)
-		d.requestsToSend = append(d.requestsToSend, shootDownReq)
+	if d.numShootDownACK == 0 {
+		d.startPageTransfers()
+		return true
+	}
+
+	for _, gpuID := range gpus {
+		for _, pid := range pids {
+			shootDownReq := protocol.NewShootdownCommand(
+				d.gpuPort, d.GPUs[gpuID-1],
+				vAddrs[pid], pid)
+			d.requestsToSend = append(d.requestsToSend, shootDownReq)
+		}
 	}
 
 	return true
@@ -607,85 +753,79 @@ func (d *Driver) processShootdownCompleteRsp(
 	d.numShootDownACK--
 
 	if d.numShootDownACK == 0 {
-		toRequestFromGPU := d.currentPageMigrationReq.CurrPageHostGPU
-		toRequestFromPMCPort := d.RemotePMCPorts[toRequestFromGPU-1]
+		d.startPageTransfers()
+		return true
+	}
 
-		migrationInfo := d.currentPageMigrationReq.MigrationInfo
+	return false
+}
 
-		requestingGPUs := d.findRequestingGPUs(migrationInfo)
-		context := d.findContext(d.currentPageMigrationReq.PID)
+func (d *Driver) startPageTransfers() {
+	if len(d.currentPageMigrations) == 0 && len(d.evictionVictims) == 0 {
+		d.finishEmptyMigrationEpoch()
+		return
+	}
 
-		pageVaddrs := make(map[uint64][]uint64)
+	for _, m := range d.currentPageMigrations {
+		page, oldPAddr := d.preparePageForMigration(m.page, m.toDeviceID)
+		d.numPagesMigratingACK++
 
-		for i := 0; i < len(requestingGPUs); i++ {
-			pageVaddrs[requestingGPUs[i]] =
-				migrationInfo.GPUReqToVAddrMap[requestingGPUs[i]+1]
+		switch {
+		case m.counterTriggered:
+			tracing.AddTaskStep(d.migrationEpochID, d, "counter_migration")
+		case m.prefetched:
+			tracing.AddTaskStep(d.migrationEpochID, d, "prefetch_migration")
+		default:
+			tracing.AddTaskStep(d.migrationEpochID, d, "demand_migration")
 		}
 
-		for gpuID, vAddrs := range pageVaddrs {
-			for i := 0; i < len(vAddrs); i++ {
-				vAddr := vAddrs[i]
-				page, oldPAddr :=
-					d.preparePageForMigration(vAddr, context, gpuID)
-
-				req := protocol.NewPageMigrationReqToCP(d.gpuPort,
-					d.GPUs[gpuID])
-				req.DestinationPMCPort = toRequestFromPMCPort
-				req.ToReadFromPhysicalAddress = oldPAddr
-				req.ToWriteToPhysicalAddress = page.PAddr
-				req.PageSize = d.currentPageMigrationReq.PageSize
-
-				d.migrationReqToSendToCP = append(d.migrationReqToSendToCP, req)
-				d.numPagesMigratingACK++
-			}
+		if m.fromDeviceID == 0 {
+			d.migratePageFromHost(page, oldPAddr, m.toDeviceID)
+			continue
 		}
-		return true
-	}
 
-	return false
-}
+		req := protocol.NewPageMigrationReqToCP(d.gpuPort,
+			d.GPUs[m.toDeviceID-1])
+		req.DestinationPMCPort = d.RemotePMCPorts[m.fromDeviceID-1]
+		req.ToReadFromPhysicalAddress = oldPAddr
+		req.ToWriteToPhysicalAddress = page.PAddr
+		req.PageSize = page.PageSize
 
-func (d *Driver) findRequestingGPUs(
-	migrationInfo *vm.PageMigrationInfo,
-) []uint64 {
-	requestingGPUs := make([]uint64, 0)
+		d.migrationReqToSendToCP = append(d.migrationReqToSendToCP, req)
+	}
 
-	for i := 1; i < d.GetNumGPUs()+1; i++ {
-		_, found := migrationInfo.GPUReqToVAddrMap[uint64(i)]
-		if found {
-			requestingGPUs = append(requestingGPUs, uint64(i-1))
-		}
+	for _, victim := range d.evictionVictims {
+		d.evictPage(victim)
+		d.numPagesMigratingACK++
+
+		tracing.AddTaskStep(d.migrationEpochID, d, "eviction")
 	}
-	return requestingGPUs
 }
 
-func (d *Driver) findContext(pid vm.PID) *Context {
-	context := &Context{}
-	for i := 0; i < len(d.contexts); i++ {
-		if d.contexts[i].pid == d.currentPageMigrationReq.PID {
-			context = d.contexts[i]
-		}
-	}
-	if context == nil {
-		log.Panicf("Process does not exist")
-	}
-	return context
+// finishEmptyMigrationEpoch ends a migration epoch that moves no pages. This
+// happens when the pages of the epoch are already on their destination or are
+// moved by another epoch. No GPU is shot down, so only the RDMA engines need
+// to restart.
+func (d *Driver) finishEmptyMigrationEpoch() {
+	d.preparePageMigrationRspToMMU()
+	d.prepareRDMARestartReqs()
 }
 
 func (d *Driver) preparePageForMigration(
-	vAddr uint64,
-	context *Context,
-	gpuID uint64,
+	pageID internal.PageID,
+	toDeviceID uint64,
 ) (*vm.Page, uint64) {
-	page, found := d.pageTable.Find(context.pid, vAddr)
+	page, found := d.pageTable.Find(pageID.PID, pageID.VAddr)
 	if !found {
 		panic("page not founds")
 	}
 	oldPAddr := page.PAddr
 
 	newPage := d.memAllocator.AllocatePageWithGivenVAddr(
-		context.pid, int(gpuID+1), vAddr, true)
-	newPage.DeviceID = gpuID + 1
+		pageID.PID, int(toDeviceID), pageID.VAddr, true)
+	newPage.DeviceID = toDeviceID
+
+	d.moveUnifiedPage(pageID, int(page.DeviceID), int(newPage.DeviceID))
 
 	newPage.IsMigrating = true
 	d.pageTable.Update(newPage)
@@ -698,7 +838,7 @@ func (d *Driver) sendMigrationReqToCP() bool {
 		return false
 	}
 
-	if d.isCurrentlyMigratingOnePage {
+	if d.numOutstandingMigrations >= d.maxOutstandingMigrations {
 		return false
 	}
 
@@ -707,7 +847,7 @@ func (d *Driver) sendMigrationReqToCP() bool {
 	err := d.gpuPort.Send(req)
 	if err == nil {
 		d.migrationReqToSendToCP = d.migrationReqToSendToCP[1:]
-		d.isCurrentlyMigratingOnePage = true
+		d.numOutstandingMigrations++
 		return true
 	}
 
@@ -717,10 +857,16 @@ func (d *Driver) sendMigrationReqToCP() bool {
 func (d *Driver) processPageMigrationRspFromCP(
 	rsp *protocol.PageMigrationRspToDriver,
 ) bool {
+	d.numOutstandingMigrations--
+
+	return d.completePageTransfer()
+}
+
+func (d *Driver) completePageTransfer() bool {
 	d.numPagesMigratingACK--
-	d.isCurrentlyMigratingOnePage = false
 
 	if d.numPagesMigratingACK == 0 {
+		d.finishPrefetchedPages()
 		d.prepareGPURestartReqs()
 		d.preparePageMigrationRspToMMU()
 	}
@@ -729,46 +875,36 @@ func (d *Driver) processPageMigrationRspFromCP(
 }
 
 func (d *Driver) prepareGPURestartReqs() {
-	accessingGPUs := d.currentPageMigrationReq.CurrAccessingGPUs
-
-	for i := 0; i < len(accessingGPUs); i++ {
-		restartGPUID := accessingGPUs[i] - 1
+	for _, gpuID := range d.gpusInvolvedInMigration() {
 		restartReq := protocol.NewGPURestartReq(
 			d.gpuPort,
-			d.GPUs[restartGPUID])
+			d.GPUs[gpuID-1])
 		d.requestsToSend = append(d.requestsToSend, restartReq)
 		d.numRestartACK++
 	}
+
+	if d.numRestartACK == 0 {
+		d.prepareRDMARestartReqs()
+	}
 }
 
 func (d *Driver) preparePageMigrationRspToMMU() {
-	requestingGPUs := make([]uint64, 0)
+	for _, migrationReq := range d.currentPageMigrationReqs {
+		migrationInfo := migrationReq.MigrationInfo
 
-	migrationInfo := d.currentPageMigrationReq.MigrationInfo
+		req := vm.NewPageMigrationRspFromDriver(d.mmuPort.AsRemote(),
+			migrationReq.Src, migrationReq)
 
-	for i := 1; i < d.GetNumGPUs()+1; i++ {
-		_, found := migrationInfo.GPUReqToVAddrMap[uint64(i)]
-		if found {
-			requestingGPUs = append(requestingGPUs, uint64(i-1))
+		for i := 1; i < d.GetNumGPUs()+1; i++ {
+			vAddrs, found := migrationInfo.GPUReqToVAddrMap[uint64(i)]
+			if found {
+				req.VAddr = append(req.VAddr, vAddrs...)
+			}
 		}
-	}
 
-	pageVaddrs := make(map[uint64][]uint64)
-
-	for i := 0; i < len(requestingGPUs); i++ {
-		pageVaddrs[requestingGPUs[i]] = migrationInfo.GPUReqToVAddrMap[requestingGPUs[i]+1]
+		req.RspToTop = migrationReq.RespondToTop
+		d.toSendToMMU = append(d.toSendToMMU, req)
 	}
-
-	req := vm.NewPageMigrationRspFromDriver(d.mmuPort.AsRemote(),
-		d.currentPageMigrationReq.Src, d.currentPageMigrationReq)
-
-	for _, vAddrs := range pageVaddrs {
-		for j := 0; j < len(vAddrs); j++ {
-			req.VAddr = append(req.VAddr, vAddrs[j])
-		}
-	}
-	req.RspToTop = d.currentPageMigrationReq.RespondToTop
-	d.toSendToMMU = req
 }
 
 func (d *Driver) handleGPURestartRsp(
@@ -794,7 +930,18 @@ func (d *Driver) processRDMARestartRspToDriver(
 	d.numRDMARestartACK--
 
 	if d.numRDMARestartACK == 0 {
-		d.currentPageMigrationReq = nil
+		if d.migrationEpochID != "" {
+			tracing.EndTask(d.migrationEpochID, d)
+		}
+
+		d.reapplyMemAdvice(d.currentPageMigrations)
+		d.completePrefetches()
+
+		d.migrationEpochID = ""
+		d.currentPageMigrationReqs = nil
+		d.currentPageMigrations = nil
+		d.currentCounterMigrations = nil
+		d.evictionVictims = nil
 		d.isCurrentlyHandlingMigrationReq = false
 		return true
 	}
@@ -802,13 +949,13 @@ func (d *Driver) processRDMARestartRspToDriver(
 }
 
 func (d *Driver) sendToMMU() bool {
-	if d.toSendToMMU == nil {
+	if len(d.toSendToMMU) == 0 {
 		return false
 	}
-	req := d.toSendToMMU
+	req := d.toSendToMMU[0]
 	err := d.mmuPort.Send(req)
 	if err == nil {
-		d.toSendToMMU = nil
+		d.toSendToMMU = d.toSendToMMU[1:]
 		return true
 	}
 
@@ -1,11 +1,17 @@
 package driver
 
 import (
+	"errors"
+	"fmt"
+
 	"github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"github.com/sarchlab/akita/v4/mem/mem"
 	"github.com/sarchlab/akita/v4/mem/vm"
 	"github.com/sarchlab/akita/v4/sim"
+	"github.com/sarchlab/mgpusim/v4/amd/driver/internal"
+	"github.com/sarchlab/mgpusim/v4/amd/insts"
+	"github.com/sarchlab/mgpusim/v4/amd/kernels"
 	"github.com/sarchlab/mgpusim/v4/amd/protocol"
 	"go.uber.org/mock/gomock"
 )
@@ -389,6 +395,122 @@ var _ = ginkgo.Describe("Driver", func() {
 			Expect(req.PID).To(Equal(vm.PID(1)))
 			Expect(driver.requestsToSend).To(HaveLen(1))
 		})
+
+		ginkgo.It("should pass the CU mask to the GPU", func() {
+			cmdQueue.CUMask = []uint32{0xf}
+			cmd := &LaunchKernelCommand{
+				GridSize: [3]uint32{256, 1, 1},
+				WGSize:   [3]uint16{64, 1, 1},
+			}
+			cmdQueue.Enqueue(cmd)
+			cmdQueue.IsRunning = false
+
+			toGPUs.EXPECT().PeekIncoming().Return(nil).AnyTimes()
+			toMMU.EXPECT().RetrieveIncoming().Return(nil)
+			engine.EXPECT().Schedule(
+				gomock.AssignableToTypeOf(sim.TickEvent{}))
+			engine.EXPECT().CurrentTime().Return(sim.VTimeInSec(11))
+
+			driver.Handle(sim.MakeTickEvent(nil, 11))
+
+			req := cmd.Reqs[0].(*protocol.LaunchKernelReq)
+			Expect(req.CUMask).To(Equal([]uint32{0xf}))
+		})
+
+		ginkgo.It("should prefer the CU mask of the kernel", func() {
+			cmdQueue.CUMask = []uint32{0xf}
+			cmd := &LaunchKernelCommand{
+				GridSize: [3]uint32{256, 1, 1},
+				WGSize:   [3]uint16{64, 1, 1},
+				CUMask:   []uint32{0x3},
+			}
+			cmdQueue.Enqueue(cmd)
+			cmdQueue.IsRunning = false
+
+			toGPUs.EXPECT().PeekIncoming().Return(nil).AnyTimes()
+			toMMU.EXPECT().RetrieveIncoming().Return(nil)
+			engine.EXPECT().Schedule(
+				gomock.AssignableToTypeOf(sim.TickEvent{}))
+			engine.EXPECT().CurrentTime().Return(sim.VTimeInSec(11))
+
+			driver.Handle(sim.MakeTickEvent(nil, 11))
+
+			req := cmd.Reqs[0].(*protocol.LaunchKernelReq)
+			Expect(req.CUMask).To(Equal([]uint32{0x3}))
+		})
+
+		ginkgo.It("should launch cooperative kernels", func() {
+			cmd := &LaunchKernelCommand{
+				GridSize:    [3]uint32{256, 1, 1},
+				WGSize:      [3]uint16{64, 1, 1},
+				Cooperative: true,
+			}
+			cmdQueue.Enqueue(cmd)
+			cmdQueue.IsRunning = false
+
+			toGPUs.EXPECT().PeekIncoming().Return(nil).AnyTimes()
+			toMMU.EXPECT().RetrieveIncoming().Return(nil)
+			engine.EXPECT().Schedule(
+				gomock.AssignableToTypeOf(sim.TickEvent{}))
+			engine.EXPECT().CurrentTime().Return(sim.VTimeInSec(11))
+
+			driver.Handle(sim.MakeTickEvent(nil, 11))
+
+			req := cmd.Reqs[0].(*protocol.LaunchKernelReq)
+			Expect(req.Cooperative).To(BeTrue())
+		})
+	})
+
+	ginkgo.It("should reject CU masks that allow no CU", func() {
+		q, err := driver.CreateCommandQueueWithCUMask(context, []uint32{0})
+		Expect(err).To(HaveOccurred())
+		Expect(q).To(BeNil())
+
+		_, err = driver.CreateCommandQueueWithCUMask(context, []uint32{0xf0})
+		Expect(err).To(HaveOccurred())
+
+		err = driver.EnqueueLaunchKernelWithCUMask(
+			cmdQueue, nil, [3]uint32{}, [3]uint16{}, nil, []uint32{})
+		Expect(err).To(HaveOccurred())
+		Expect(cmdQueue.NumCommand()).To(Equal(0))
+
+		q, err = driver.CreateCommandQueueWithCUMask(context, []uint32{0x8})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(q.CUMask).To(Equal([]uint32{0x8}))
+	})
+
+	ginkgo.It("should create device queues", func() {
+		co := insts.NewHsaCo()
+		co.Data = make([]byte, 16)
+
+		memAllocator.EXPECT().
+			Allocate(vm.PID(1), uint64(64+2*64), gomock.Any()).
+			Return(uint64(0x200000000))
+		memAllocator.EXPECT().
+			Allocate(vm.PID(1), uint64(16), gomock.Any()).
+			Return(uint64(0x200001000))
+		pageTable.EXPECT().
+			Find(vm.PID(1), gomock.Any()).
+			Return(vm.Page{
+				PID:      1,
+				VAddr:    0x200000000,
+				PAddr:    0x100000000,
+				PageSize: 4096,
+			}, true).
+			AnyTimes()
+
+		dq := driver.CreateDeviceQueue(cmdQueue, 2, co)
+
+		Expect(cmdQueue.DeviceQueue).To(BeIdenticalTo(dq))
+		Expect(cmdQueue.commands).To(HaveLen(2))
+		Expect(dq.KernelObject(co)).To(Equal(Ptr(0x200001000)))
+		Expect(dq.info.HeaderPAddr).To(Equal(uint64(0x100000000)))
+		Expect(dq.info.SlotPAddrs).To(Equal([]uint64{0x100000040, 0x100000080}))
+		Expect(dq.info.CodeObjects[0x200001000]).To(BeIdenticalTo(co))
+
+		req := protocol.NewLaunchKernelReq(toGPUs, toGPUs)
+		setKernelQueue(req, cmdQueue, nil)
+		Expect(req.DeviceQueue).To(BeIdenticalTo(dq.info))
 	})
 
 	ginkgo.It("should process LaunchKernel return", func() {
@@ -418,6 +540,23 @@ var _ = ginkgo.Describe("Driver", func() {
 
 		Expect(cmdQueue.IsRunning).To(BeFalse())
 		Expect(cmdQueue.commands).To(HaveLen(0))
+		Expect(cmdQueue.Err()).NotTo(HaveOccurred())
+	})
+
+	ginkgo.It("should keep the error of a kernel that cannot run", func() {
+		nilPort := NewMockPort(mockCtrl)
+		nilPort.EXPECT().AsRemote().AnyTimes()
+
+		req := protocol.NewLaunchKernelReq(toGPUs, nilPort)
+		cmdQueue.Enqueue(&LaunchKernelCommand{Reqs: []sim.Msg{req}})
+		cmdQueue.IsRunning = true
+		rsp := protocol.NewLaunchKernelRsp("", "", req.ID)
+		rsp.Err = errors.New("cannot fit")
+
+		Expect(driver.processLaunchKernelReturn(rsp)).To(BeTrue())
+
+		Expect(cmdQueue.commands).To(BeEmpty())
+		Expect(cmdQueue.Err()).To(MatchError("cannot fit"))
 	})
 
 	ginkgo.It("should handle page migration req from MMU ", func() {
@@ -433,11 +572,539 @@ var _ = ginkgo.Describe("Driver", func() {
 
 		driver.parseFromMMU()
 
-		Expect(driver.currentPageMigrationReq).To(Equal(req))
+		Expect(driver.currentPageMigrationReqs).To(
+			Equal([]*vm.PageMigrationReqToDriver{req}))
 		Expect(driver.isCurrentlyHandlingMigrationReq).To(BeTrue())
 		Expect(driver.numRDMADrainACK).To(Equal(uint64(2)))
 	})
 
+	ginkgo.It("should batch page migration reqs from MMU", func() {
+		req1 := vm.NewPageMigrationReqToDriver("", driver.mmuPort.AsRemote())
+		req2 := vm.NewPageMigrationReqToDriver("", driver.mmuPort.AsRemote())
+		toMMU.EXPECT().RetrieveIncoming().Return(req1)
+		toMMU.EXPECT().RetrieveIncoming().Return(req2)
+		driver.migrationBatchSize = 2
+
+		driver.parseFromMMU()
+
+		Expect(driver.currentPageMigrationReqs).To(
+			Equal([]*vm.PageMigrationReqToDriver{req1, req2}))
+		Expect(driver.isCurrentlyHandlingMigrationReq).To(BeTrue())
+		Expect(driver.numRDMADrainACK).To(Equal(uint64(2)))
+	})
+
+	ginkgo.It("should wait for more page migration reqs", func() {
+		req := vm.NewPageMigrationReqToDriver("", driver.mmuPort.AsRemote())
+		toMMU.EXPECT().RetrieveIncoming().Return(req)
+		toMMU.EXPECT().RetrieveIncoming().Return(nil)
+		driver.migrationBatchSize = 2
+		driver.migrationBatchWindow = 2
+
+		madeProgress := driver.parseFromMMU()
+
+		Expect(madeProgress).To(BeTrue())
+		Expect(driver.pendingPageMigrationReqs).To(HaveLen(1))
+		Expect(driver.migrationBatchCyclesLeft).To(Equal(1))
+		Expect(driver.isCurrentlyHandlingMigrationReq).To(BeFalse())
+	})
+
+	ginkgo.It("should prefetch pages with the faulting page", func() {
+		driver.migrationPrefetcher =
+			internal.NewMigrationPrefetcher("sequential", log2PageSize, 1)
+
+		pageMigrationReq := vm.NewPageMigrationReqToDriver(
+			"", driver.mmuPort.AsRemote())
+		pageMigrationReq.PID = 1
+		pageMigrationReq.CurrPageHostGPU = 1
+		pageMigrationReq.CurrAccessingGPUs = []uint64{1}
+		migrationInfo := new(vm.PageMigrationInfo)
+		migrationInfo.GPUReqToVAddrMap = map[uint64][]uint64{
+			2: {0x1000},
+		}
+		pageMigrationReq.MigrationInfo = migrationInfo
+		driver.currentPageMigrationReqs =
+			[]*vm.PageMigrationReqToDriver{pageMigrationReq}
+
+		pageTable.EXPECT().
+			Find(vm.PID(1), uint64(0x2000)).
+			Return(vm.Page{
+				PID:      1,
+				VAddr:    0x2000,
+				PAddr:    0x1_0000_2000,
+				PageSize: 0x1000,
+				Valid:    true,
+				DeviceID: 1,
+				Unified:  true,
+			}, true).
+			AnyTimes()
+
+		driver.planPageMigrations()
+
+		Expect(driver.currentPageMigrations).To(HaveLen(2))
+		Expect(*driver.currentPageMigrations[1]).To(Equal(pageMigration{
+			page:         internal.PageID{PID: 1, VAddr: 0x2000},
+			fromDeviceID: 1,
+			toDeviceID:   2,
+			prefetched:   true,
+		}))
+	})
+
+	ginkgo.It("should not evict the pinned pages", func() {
+		driver.unifiedMemoryCapacity = 2 << log2PageSize
+		driver.residentUnifiedPages[1].Insert(
+			internal.PageID{PID: 1, VAddr: 0x1000})
+		driver.residentUnifiedPages[1].Insert(
+			internal.PageID{PID: 1, VAddr: 0x2000})
+		driver.currentPageMigrations = []*pageMigration{{
+			page:         internal.PageID{PID: 1, VAddr: 0x3000},
+			fromDeviceID: 2,
+			toDeviceID:   1,
+		}}
+
+		pageTable.EXPECT().
+			Find(vm.PID(1), uint64(0x1000)).
+			Return(vm.Page{
+				PID:      1,
+				VAddr:    0x1000,
+				PAddr:    0x1_0000_1000,
+				PageSize: 0x1000,
+				Valid:    true,
+				DeviceID: 1,
+				Unified:  true,
+				IsPinned: true,
+			}, true).
+			AnyTimes()
+		pageTable.EXPECT().
+			Find(vm.PID(1), uint64(0x2000)).
+			Return(vm.Page{
+				PID:      1,
+				VAddr:    0x2000,
+				PAddr:    0x1_0000_2000,
+				PageSize: 0x1000,
+				Valid:    true,
+				DeviceID: 1,
+				Unified:  true,
+			}, true).
+			AnyTimes()
+
+		driver.selectEvictionVictims()
+
+		Expect(driver.evictionVictims).To(Equal([]evictionVictim{{
+			page:     internal.PageID{PID: 1, VAddr: 0x2000},
+			deviceID: 1,
+		}}))
+	})
+
+	ginkgo.Context("process event commands", func() {
+		ginkgo.It("should complete the event when recorded", func() {
+			event := driver.CreateEvent()
+			driver.EnqueueRecordEvent(cmdQueue, event)
+			engine.EXPECT().CurrentTime().Return(sim.VTimeInSec(2))
+
+			Expect(driver.EventQuery(event)).To(BeFalse())
+
+			driver.processOneCommand(cmdQueue)
+
+			Expect(cmdQueue.commands).To(BeEmpty())
+			Expect(driver.EventQuery(event)).To(BeTrue())
+			Expect(event.time).To(Equal(sim.VTimeInSec(2)))
+		})
+
+		ginkgo.It("should block the queue until the event completes", func() {
+			otherQueue := driver.CreateCommandQueue(context)
+			event := driver.CreateEvent()
+			driver.EnqueueRecordEvent(otherQueue, event)
+			driver.EnqueueWaitEvent(cmdQueue, event)
+
+			madeProgress := driver.processOneCommand(cmdQueue)
+
+			Expect(madeProgress).To(BeFalse())
+			Expect(cmdQueue.commands).To(HaveLen(1))
+
+			engine.EXPECT().CurrentTime().Return(sim.VTimeInSec(2))
+			driver.processOneCommand(otherQueue)
+			madeProgress = driver.processOneCommand(cmdQueue)
+
+			Expect(madeProgress).To(BeTrue())
+			Expect(cmdQueue.commands).To(BeEmpty())
+		})
+
+		ginkgo.It("should measure the time between events", func() {
+			start := driver.CreateEvent()
+			end := driver.CreateEvent()
+			driver.EnqueueRecordEvent(cmdQueue, start)
+			driver.EnqueueRecordEvent(cmdQueue, end)
+			engine.EXPECT().CurrentTime().Return(sim.VTimeInSec(2))
+			engine.EXPECT().CurrentTime().Return(sim.VTimeInSec(5))
+
+			driver.processOneCommand(cmdQueue)
+			driver.processOneCommand(cmdQueue)
+
+			Expect(driver.EventElapsedTime(start, end)).
+				To(Equal(sim.VTimeInSec(3)))
+		})
+	})
+
+	ginkgo.Context("process PreemptKernelCommand", func() {
+		var (
+			kernelQueue *CommandQueue
+			kernelReq   *protocol.LaunchKernelReq
+		)
+
+		ginkgo.BeforeEach(func() {
+			kernelQueue = driver.CreateCommandQueue(context)
+			kernelReq = protocol.NewLaunchKernelReq(
+				driver.gpuPort, driver.GPUs[0])
+			kernelCmd := &LaunchKernelCommand{
+				Reqs: []sim.Msg{kernelReq},
+			}
+			kernelQueue.Enqueue(kernelCmd)
+			kernelQueue.IsRunning = true
+		})
+
+		ginkgo.It("should complete if the queue is not running", func() {
+			kernelQueue.IsRunning = false
+			driver.EnqueuePreemptKernel(
+				cmdQueue, kernelQueue, PreemptionModeDrain)
+
+			driver.processOneCommand(cmdQueue)
+
+			Expect(cmdQueue.commands).To(BeEmpty())
+			Expect(driver.requestsToSend).To(BeEmpty())
+		})
+
+		ginkgo.It("should send preempt request to GPU", func() {
+			cmd := driver.EnqueuePreemptKernel(
+				cmdQueue, kernelQueue, PreemptionModeDrain)
+
+			driver.processOneCommand(cmdQueue)
+
+			Expect(cmdQueue.IsRunning).To(BeTrue())
+			Expect(cmd.Reqs).To(HaveLen(1))
+			req := driver.requestsToSend[0].(*protocol.PreemptKernelReq)
+			Expect(req.KernelID).To(Equal(kernelReq.ID))
+			Expect(req.Mode).To(Equal(PreemptionModeDrain))
+			Expect(req.ContextSaveAreaSize).To(BeZero())
+		})
+
+		ginkgo.It("should allocate a context-save area", func() {
+			kernelReq.PID = 1
+			kernelReq.HsaCo = insts.NewHsaCo()
+			kernelReq.HsaCo.WIVgprCount = 1
+			kernelReq.Packet = &kernels.HsaKernelDispatchPacket{
+				WorkgroupSizeX: 128,
+				WorkgroupSizeY: 1,
+				WorkgroupSizeZ: 1,
+			}
+
+			// 4 CUs hold 80 work-groups of 2 wavefronts, which take 512
+			// bytes each.
+			memAllocator.EXPECT().
+				Allocate(vm.PID(1), uint64(80*512), 1).
+				Return(uint64(0x100000))
+
+			driver.EnqueuePreemptKernel(
+				cmdQueue, kernelQueue, PreemptionModeSaveState)
+			driver.processOneCommand(cmdQueue)
+
+			req := driver.requestsToSend[0].(*protocol.PreemptKernelReq)
+			Expect(req.Mode).To(Equal(PreemptionModeSaveState))
+			Expect(req.ContextSaveArea).To(Equal(uint64(0x100000)))
+			Expect(req.ContextSaveAreaSize).To(Equal(uint64(80 * 512)))
+
+			memAllocator.EXPECT().Free(uint64(0x100000))
+			rsp := protocol.NewLaunchKernelRsp("", "", kernelReq.ID)
+			toGPUs.EXPECT().PeekIncoming().Return(rsp)
+			toGPUs.EXPECT().RetrieveIncoming().Return(rsp)
+
+			driver.processReturnReq()
+
+			Expect(driver.contextSaveAreas).To(BeEmpty())
+		})
+
+		ginkgo.It("should not allocate for a cooperative kernel", func() {
+			kernelReq.Cooperative = true
+
+			driver.EnqueuePreemptKernel(
+				cmdQueue, kernelQueue, PreemptionModeSaveState)
+			driver.processOneCommand(cmdQueue)
+
+			req := driver.requestsToSend[0].(*protocol.PreemptKernelReq)
+			Expect(req.ContextSaveAreaSize).To(BeZero())
+		})
+
+		ginkgo.It("should complete when the GPU responds", func() {
+			cmd := driver.EnqueuePreemptKernel(
+				cmdQueue, kernelQueue, PreemptionModeDrain)
+			driver.processOneCommand(cmdQueue)
+			req := driver.requestsToSend[0]
+
+			rsp := protocol.NewPreemptKernelRsp("", "", req.Meta().ID)
+			rsp.Preempted = true
+			rsp.SavedByteSize = 1024
+			toGPUs.EXPECT().PeekIncoming().Return(rsp)
+			toGPUs.EXPECT().RetrieveIncoming().Return(rsp)
+
+			driver.processReturnReq()
+
+			Expect(cmd.Preempted).To(BeTrue())
+			Expect(cmd.SavedByteSize).To(Equal(uint64(1024)))
+			Expect(cmdQueue.IsRunning).To(BeFalse())
+			Expect(cmdQueue.commands).To(BeEmpty())
+			Expect(kernelQueue.commands).To(HaveLen(1))
+		})
+
+		ginkgo.It("should resume the kernel", func() {
+			driver.EnqueueResumeKernel(cmdQueue, kernelQueue)
+			driver.processOneCommand(cmdQueue)
+			req := driver.requestsToSend[0].(*protocol.ResumeKernelReq)
+			Expect(req.KernelID).To(Equal(kernelReq.ID))
+
+			rsp := protocol.NewResumeKernelRsp("", "", req.ID)
+			toGPUs.EXPECT().PeekIncoming().Return(rsp)
+			toGPUs.EXPECT().RetrieveIncoming().Return(rsp)
+
+			driver.processReturnReq()
+
+			Expect(cmdQueue.IsRunning).To(BeFalse())
+			Expect(cmdQueue.commands).To(BeEmpty())
+		})
+	})
+
+	ginkgo.Context("process HostFuncCommand", func() {
+		var m *hostFuncMiddleware
+
+		ginkgo.BeforeEach(func() {
+			m = &hostFuncMiddleware{driver: driver, latency: 1e-6}
+		})
+
+		ginkgo.It("should call the function after the host time", func() {
+			called := false
+			cmd := &HostFuncCommand{
+				Func:     func() { called = true },
+				Duration: 3e-9,
+			}
+			cmdQueue.Enqueue(cmd)
+
+			m.ProcessCommand(cmd, cmdQueue)
+			for i := 0; i < 3; i++ {
+				m.Tick()
+			}
+
+			Expect(called).To(BeFalse())
+			Expect(cmdQueue.IsRunning).To(BeTrue())
+
+			m.Tick()
+
+			Expect(called).To(BeTrue())
+			Expect(cmdQueue.IsRunning).To(BeFalse())
+			Expect(cmdQueue.commands).To(BeEmpty())
+			Expect(m.running).To(BeEmpty())
+		})
+
+		ginkgo.It("should use the fixed latency by default", func() {
+			cmd := &HostFuncCommand{}
+
+			Expect(m.hostTime(cmd)).To(Equal(sim.VTimeInSec(1e-6)))
+		})
+
+		ginkgo.It("should estimate the host time with the CPU model", func() {
+			cmd := &HostFuncCommand{NumInsts: 3000}
+
+			Expect(float64(m.hostTime(cmd))).To(BeNumerically("~", 2e-6, 1e-12))
+		})
+	})
+
+	ginkgo.Context("process PrefetchCommand", func() {
+		ginkgo.It("should complete if the pages are on the GPU", func() {
+			cmd := &PrefetchCommand{Ptr: 0x1000, ByteSize: 0x1000, GPUID: 1}
+			cmdQueue.Enqueue(cmd)
+
+			pageTable.EXPECT().
+				Find(vm.PID(1), uint64(0x1000)).
+				Return(vm.Page{
+					PID:      1,
+					VAddr:    0x1000,
+					DeviceID: 1,
+					Unified:  true,
+				}, true)
+
+			driver.processOneCommand(cmdQueue)
+
+			Expect(cmdQueue.commands).To(BeEmpty())
+			Expect(driver.pendingPrefetches).To(BeEmpty())
+		})
+
+		ginkgo.It("should wait for the pages to migrate", func() {
+			cmd := &PrefetchCommand{Ptr: 0x1000, ByteSize: 0x1000, GPUID: 2}
+			cmdQueue.Enqueue(cmd)
+
+			pageTable.EXPECT().
+				Find(vm.PID(1), uint64(0x1000)).
+				Return(vm.Page{
+					PID:      1,
+					VAddr:    0x1000,
+					DeviceID: 1,
+					Unified:  true,
+				}, true)
+
+			driver.processOneCommand(cmdQueue)
+
+			Expect(cmdQueue.IsRunning).To(BeTrue())
+			Expect(driver.pendingPrefetches).To(HaveLen(1))
+			Expect(driver.pendingPrefetches[0].pages).To(Equal(
+				[]internal.PageID{{PID: 1, VAddr: 0x1000}}))
+		})
+
+		ginkgo.It("should complete when the migration finishes", func() {
+			cmd := &PrefetchCommand{Ptr: 0x1000, ByteSize: 0x1000, GPUID: 2}
+			cmdQueue.Enqueue(cmd)
+			cmdQueue.IsRunning = true
+			driver.currentPrefetches = []*queuedPrefetch{{
+				cmd:   cmd,
+				queue: cmdQueue,
+				pages: []internal.PageID{{PID: 1, VAddr: 0x1000}},
+			}}
+			driver.numRDMARestartACK = 1
+
+			driver.processRDMARestartRspToDriver(nil)
+
+			Expect(cmdQueue.IsRunning).To(BeFalse())
+			Expect(cmdQueue.commands).To(BeEmpty())
+			Expect(driver.currentPrefetches).To(BeEmpty())
+		})
+
+		ginkgo.It("should restart if the pages are already migrating", func() {
+			cmd := &PrefetchCommand{Ptr: 0x1000, ByteSize: 0x1000, GPUID: 2}
+			cmdQueue.Enqueue(cmd)
+			cmdQueue.IsRunning = true
+			driver.pendingPrefetches = []*queuedPrefetch{{
+				cmd:   cmd,
+				queue: cmdQueue,
+				pages: []internal.PageID{{PID: 1, VAddr: 0x1000}},
+			}}
+			pageTable.EXPECT().
+				Find(vm.PID(1), uint64(0x1000)).
+				Return(vm.Page{
+					PID:         1,
+					VAddr:       0x1000,
+					DeviceID:    1,
+					Unified:     true,
+					IsMigrating: true,
+				}, true)
+
+			driver.startMigrationEpoch()
+			driver.requestsToSend = nil
+			for i := 0; i < len(driver.GPUs); i++ {
+				driver.processRDMADrainRsp(nil)
+			}
+
+			Expect(driver.currentPageMigrations).To(BeEmpty())
+			Expect(driver.numShootDownACK).To(Equal(uint64(0)))
+			Expect(driver.numRDMARestartACK).To(Equal(uint64(2)))
+			Expect(driver.requestsToSend).To(HaveLen(2))
+			for _, req := range driver.requestsToSend {
+				Expect(req).To(BeAssignableToTypeOf(
+					&protocol.RDMARestartCmdFromDriver{}))
+			}
+
+			for i := 0; i < len(driver.GPUs); i++ {
+				driver.processRDMARestartRspToDriver(nil)
+			}
+
+			Expect(driver.isCurrentlyHandlingMigrationReq).To(BeFalse())
+			Expect(cmdQueue.IsRunning).To(BeFalse())
+			Expect(cmdQueue.commands).To(BeEmpty())
+		})
+	})
+
+	ginkgo.Context("process AccessCounterNotification", func() {
+		var notification *protocol.AccessCounterNotification
+
+		ginkgo.BeforeEach(func() {
+			for i := range driver.GPUs {
+				gpu := NewMockPort(mockCtrl)
+				gpu.EXPECT().AsRemote().
+					Return(sim.RemotePort(fmt.Sprintf("GPU%d", i+1))).
+					AnyTimes()
+				driver.GPUs[i] = gpu
+			}
+
+			notification = protocol.NewAccessCounterNotification(
+				"GPU2", "Driver", 0x100003000, 64)
+		})
+
+		ginkgo.It("should drop the notification if disabled", func() {
+			driver.processAccessCounterNotification(notification)
+
+			Expect(driver.pendingCounterMigrations).To(BeEmpty())
+		})
+
+		ginkgo.It("should queue the page for the GPU", func() {
+			driver.accessCounterMigration = true
+			pageTable.EXPECT().
+				ReverseLookup(uint64(0x100003000)).
+				Return(vm.Page{
+					PID:      1,
+					VAddr:    0x3000,
+					PAddr:    0x100003000,
+					DeviceID: 1,
+					Valid:    true,
+					Unified:  true,
+				}, true)
+
+			driver.processAccessCounterNotification(notification)
+
+			Expect(driver.pendingCounterMigrations).To(HaveLen(1))
+			Expect(driver.pendingCounterMigrations[0].page).To(Equal(
+				internal.PageID{PID: 1, VAddr: 0x3000}))
+			Expect(driver.pendingCounterMigrations[0].toDeviceID).
+				To(Equal(uint64(2)))
+		})
+
+		ginkgo.It("should not move pinned pages", func() {
+			driver.accessCounterMigration = true
+			pageTable.EXPECT().
+				ReverseLookup(uint64(0x100003000)).
+				Return(vm.Page{
+					PID:      1,
+					VAddr:    0x3000,
+					DeviceID: 1,
+					Valid:    true,
+					Unified:  true,
+					IsPinned: true,
+				}, true)
+
+			driver.processAccessCounterNotification(notification)
+
+			Expect(driver.pendingCounterMigrations).To(BeEmpty())
+		})
+
+		ginkgo.It("should plan the migration of the page", func() {
+			driver.currentCounterMigrations = []*counterMigration{{
+				page:       internal.PageID{PID: 1, VAddr: 0x3000},
+				toDeviceID: 2,
+			}}
+			pageTable.EXPECT().
+				Find(vm.PID(1), uint64(0x3000)).
+				Return(vm.Page{
+					PID:      1,
+					VAddr:    0x3000,
+					DeviceID: 1,
+					Valid:    true,
+					Unified:  true,
+				}, true)
+
+			driver.planPageMigrations()
+
+			Expect(driver.currentPageMigrations).To(HaveLen(1))
+			m := driver.currentPageMigrations[0]
+			Expect(m.counterTriggered).To(BeTrue())
+			Expect(m.fromDeviceID).To(Equal(uint64(1)))
+			Expect(m.toDeviceID).To(Equal(uint64(2)))
+		})
+	})
+
 	ginkgo.It("should handle RDMA Drain RSP ", func() {
 		nilPort := NewMockPort(mockCtrl)
 		nilPort.EXPECT().AsRemote().AnyTimes()
@@ -457,7 +1124,8 @@ var _ = ginkgo.Describe("Driver", func() {
 		migrationInfo.GPUReqToVAddrMap = GPUReqToVAddrMap
 		pageMigrationReq.MigrationInfo = migrationInfo
 
-		driver.currentPageMigrationReq = pageMigrationReq
+		driver.currentPageMigrationReqs =
+			[]*vm.PageMigrationReqToDriver{pageMigrationReq}
 
 		toGPUs.EXPECT().PeekIncoming().Return(req)
 		toGPUs.EXPECT().RetrieveIncoming().Return(req)
@@ -487,7 +1155,13 @@ var _ = ginkgo.Describe("Driver", func() {
 		migrationInfo := new(vm.PageMigrationInfo)
 		migrationInfo.GPUReqToVAddrMap = GPUReqToVaddrMap
 		pageMigrationReq.MigrationInfo = migrationInfo
-		driver.currentPageMigrationReq = pageMigrationReq
+		driver.currentPageMigrationReqs =
+			[]*vm.PageMigrationReqToDriver{pageMigrationReq}
+		driver.currentPageMigrations = []*pageMigration{{
+			page:         internal.PageID{PID: 0, VAddr: 0x100},
+			fromDeviceID: 1,
+			toDeviceID:   2,
+		}}
 		driver.numShootDownACK = 1
 
 		page2 := &vm.Page{
@@ -555,7 +1229,7 @@ var _ = ginkgo.Describe("Driver", func() {
 
 		madeProgress := driver.sendMigrationReqToCP()
 
-		Expect(driver.isCurrentlyMigratingOnePage).To(BeTrue())
+		Expect(driver.numOutstandingMigrations).To(Equal(1))
 		Expect(madeProgress).To(BeTrue())
 	})
 
@@ -569,10 +1243,11 @@ var _ = ginkgo.Describe("Driver", func() {
 		toGPUs.EXPECT().RetrieveIncoming().Return(req)
 
 		driver.numPagesMigratingACK = 2
+		driver.numOutstandingMigrations = 1
 		driver.processReturnReq()
 
 		Expect(driver.numPagesMigratingACK).To(Equal(uint64(1)))
-		Expect(driver.isCurrentlyMigratingOnePage).To(BeFalse())
+		Expect(driver.numOutstandingMigrations).To(Equal(0))
 
 	})
 
@@ -596,7 +1271,8 @@ var _ = ginkgo.Describe("Driver", func() {
 		migrationInfo := new(vm.PageMigrationInfo)
 		migrationInfo.GPUReqToVAddrMap = GpuReqToVaddrMap
 		pageMigrationReq.MigrationInfo = migrationInfo
-		driver.currentPageMigrationReq = pageMigrationReq
+		driver.currentPageMigrationReqs =
+			[]*vm.PageMigrationReqToDriver{pageMigrationReq}
 
 		reqToMMU := vm.NewPageMigrationRspFromDriver(driver.mmuPort.AsRemote(), pageMigrationReq.Src, pageMigrationReq)
 		reqToMMU.VAddr = append(reqToMMU.VAddr, 0x100)
@@ -604,7 +1280,8 @@ var _ = ginkgo.Describe("Driver", func() {
 
 		driver.processReturnReq()
 
-		Expect(driver.toSendToMMU).To(BeEquivalentTo(reqToMMU))
+		Expect(driver.toSendToMMU).To(HaveLen(1))
+		Expect(driver.toSendToMMU[0]).To(BeEquivalentTo(reqToMMU))
 		Expect(driver.requestsToSend).To(HaveLen(1))
 	})
 
@@ -628,7 +1305,8 @@ var _ = ginkgo.Describe("Driver", func() {
 		migrationInfo := new(vm.PageMigrationInfo)
 		migrationInfo.GPUReqToVAddrMap = GpuReqToVaddrMap
 		pageMigrationReq.MigrationInfo = migrationInfo
-		driver.currentPageMigrationReq = pageMigrationReq
+		driver.currentPageMigrationReqs =
+			[]*vm.PageMigrationReqToDriver{pageMigrationReq}
 
 		driver.processReturnReq()
 
@@ -655,23 +1333,24 @@ var _ = ginkgo.Describe("Driver", func() {
 		migrationInfo := new(vm.PageMigrationInfo)
 		migrationInfo.GPUReqToVAddrMap = GpuReqToVaddrMap
 		pageMigrationReq.MigrationInfo = migrationInfo
-		driver.currentPageMigrationReq = pageMigrationReq
+		driver.currentPageMigrationReqs =
+			[]*vm.PageMigrationReqToDriver{pageMigrationReq}
 
 		driver.processReturnReq()
 
-		Expect(driver.currentPageMigrationReq).To(BeNil())
+		Expect(driver.currentPageMigrationReqs).To(BeNil())
 		Expect(driver.isCurrentlyHandlingMigrationReq).To(BeFalse())
 	})
 
 	ginkgo.It("should send to MMU", func() {
 		reqToMMU := vm.NewPageMigrationRspFromDriver(driver.mmuPort.AsRemote(), "", nil)
-		driver.toSendToMMU = reqToMMU
+		driver.toSendToMMU = append(driver.toSendToMMU, reqToMMU)
 
 		toMMU.EXPECT().Send(reqToMMU)
 
 		madeProgress := driver.sendToMMU()
 
 		Expect(madeProgress).To(BeTrue())
-		Expect(driver.toSendToMMU).To(BeNil())
+		Expect(driver.toSendToMMU).To(BeEmpty())
 	})
 })
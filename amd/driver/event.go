@@ -0,0 +1,153 @@
+package driver
+
+import (
+	"sync"
+
+	"github.com/sarchlab/akita/v4/sim"
+)
+
+// An Event marks a point in a command queue. An event completes when all the
+// commands enqueued before the point complete. Events can synchronize command
+// queues with each other and with the host, and can measure the simulated
+// time between two points.
+type Event struct {
+	mutex sync.Mutex
+	cond  *sync.Cond
+
+	numRecorded  int
+	numCompleted int
+	time         sim.VTimeInSec
+}
+
+func (e *Event) isCompleted(generation int) bool {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	return e.numCompleted >= generation
+}
+
+func (e *Event) complete(generation int, now sim.VTimeInSec) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if generation > e.numCompleted {
+		e.numCompleted = generation
+		e.time = now
+	}
+
+	e.cond.Broadcast()
+}
+
+// CreateEvent creates a new event. An event that is never recorded is
+// considered completed.
+func (d *Driver) CreateEvent() *Event {
+	e := &Event{}
+	e.cond = sync.NewCond(&e.mutex)
+
+	return e
+}
+
+// EnqueueRecordEvent registers a RecordEventCommand in the queue. The event
+// completes when the command is processed.
+func (d *Driver) EnqueueRecordEvent(queue *CommandQueue, event *Event) {
+	event.mutex.Lock()
+	event.numRecorded++
+	generation := event.numRecorded
+	event.mutex.Unlock()
+
+	cmd := &RecordEventCommand{
+		ID:         sim.GetIDGenerator().Generate(),
+		Event:      event,
+		generation: generation,
+	}
+	d.Enqueue(queue, cmd)
+}
+
+// EnqueueWaitEvent registers a WaitEventCommand in the queue. The commands
+// that are enqueued after the WaitEventCommand do not start until the most
+// recent record of the event completes.
+func (d *Driver) EnqueueWaitEvent(queue *CommandQueue, event *Event) {
+	event.mutex.Lock()
+	generation := event.numRecorded
+	event.mutex.Unlock()
+
+	cmd := &WaitEventCommand{
+		ID:         sim.GetIDGenerator().Generate(),
+		Event:      event,
+		generation: generation,
+	}
+	d.Enqueue(queue, cmd)
+}
+
+// EventQuery checks if the most recent record of the event has completed.
+func (d *Driver) EventQuery(event *Event) bool {
+	event.mutex.Lock()
+	defer event.mutex.Unlock()
+
+	return event.numCompleted >= event.numRecorded
+}
+
+// EventSynchronize returns when the most recent record of the event
+// completes.
+func (d *Driver) EventSynchronize(event *Event) {
+	event.mutex.Lock()
+	generation := event.numRecorded
+	event.mutex.Unlock()
+
+	if event.isCompleted(generation) {
+		return
+	}
+
+	d.enqueueSignal <- true
+
+	event.mutex.Lock()
+	for event.numCompleted < generation {
+		event.cond.Wait()
+	}
+	event.mutex.Unlock()
+}
+
+// EventElapsedTime returns the simulated time between the completion of two
+// events. Both events must have completed.
+func (d *Driver) EventElapsedTime(start, end *Event) sim.VTimeInSec {
+	if !d.EventQuery(start) || !d.EventQuery(end) {
+		panic("event not completed")
+	}
+
+	start.mutex.Lock()
+	startTime := start.time
+	start.mutex.Unlock()
+
+	end.mutex.Lock()
+	endTime := end.time
+	end.mutex.Unlock()
+
+	return endTime - startTime
+}
+
+func (d *Driver) processRecordEventCommand(
+	cmd *RecordEventCommand,
+	queue *CommandQueue,
+) bool {
+	cmd.Event.complete(cmd.generation, d.Engine.CurrentTime())
+	queue.Dequeue()
+
+	d.logCmdComplete(cmd)
+
+	return true
+}
+
+func (d *Driver) processWaitEventCommand(
+	cmd *WaitEventCommand,
+	queue *CommandQueue,
+) bool {
+	if !cmd.Event.isCompleted(cmd.generation) {
+		return false
+	}
+
+	d.logCmdStart(cmd)
+	queue.Dequeue()
+	d.logCmdComplete(cmd)
+
+	return true
+}
@@ -0,0 +1,120 @@
+package driver
+
+import (
+	"github.com/sarchlab/akita/v4/sim"
+)
+
+// EnqueueHostFunc registers a HostFuncCommand in the queue. The callback runs
+// when the queue reaches the command, and the commands after it wait until
+// the callback returns. The host takes the fixed host function latency to run
+// the callback.
+//
+// The callback runs in the simulation thread. It can enqueue commands and
+// allocate memory, but it must not call the APIs that wait for the simulation,
+// such as DrainCommandQueue and EventSynchronize.
+func (d *Driver) EnqueueHostFunc(queue *CommandQueue, fn func()) {
+	cmd := &HostFuncCommand{
+		ID:   sim.GetIDGenerator().Generate(),
+		Func: fn,
+	}
+	d.Enqueue(queue, cmd)
+}
+
+// EnqueueHostFuncWithCost is similar to EnqueueHostFunc, but the time that
+// the host takes is estimated from the number of instructions that the
+// callback executes, using the host CPU model.
+func (d *Driver) EnqueueHostFuncWithCost(
+	queue *CommandQueue,
+	fn func(),
+	numInsts uint64,
+) {
+	cmd := &HostFuncCommand{
+		ID:       sim.GetIDGenerator().Generate(),
+		Func:     fn,
+		NumInsts: numInsts,
+	}
+	d.Enqueue(queue, cmd)
+}
+
+// A runningHostFunc is a host function that the host is running.
+type runningHostFunc struct {
+	cmd        *HostFuncCommand
+	queue      *CommandQueue
+	cyclesLeft uint64
+}
+
+// hostFuncMiddleware handles the host function commands. The callback is
+// called when the modeled host time elapses, so that the effects of the
+// callback appear at the right point of the timeline.
+type hostFuncMiddleware struct {
+	driver  *Driver
+	latency sim.VTimeInSec
+	running []*runningHostFunc
+}
+
+func (m *hostFuncMiddleware) ProcessCommand(
+	cmd Command,
+	queue *CommandQueue,
+) (processed bool) {
+	hostFuncCmd, ok := cmd.(*HostFuncCommand)
+	if !ok {
+		return false
+	}
+
+	m.running = append(m.running, &runningHostFunc{
+		cmd:        hostFuncCmd,
+		queue:      queue,
+		cyclesLeft: m.driver.Freq.Cycle(m.hostTime(hostFuncCmd)),
+	})
+	queue.IsRunning = true
+
+	return true
+}
+
+// hostTime returns the time that the host takes to run the host function.
+func (m *hostFuncMiddleware) hostTime(cmd *HostFuncCommand) sim.VTimeInSec {
+	if cmd.Duration > 0 {
+		return cmd.Duration
+	}
+
+	cpu := m.driver.devices[0].Properties
+	if cmd.NumInsts == 0 || cpu.Freq == 0 || cpu.IPC == 0 {
+		return m.latency
+	}
+
+	cycles := float64(cmd.NumInsts) / cpu.IPC
+
+	return m.latency + sim.VTimeInSec(cycles/float64(cpu.Freq))
+}
+
+func (m *hostFuncMiddleware) Tick() (madeProgress bool) {
+	if len(m.running) == 0 {
+		return false
+	}
+
+	stillRunning := m.running[:0]
+	for _, f := range m.running {
+		if f.cyclesLeft > 0 {
+			f.cyclesLeft--
+			stillRunning = append(stillRunning, f)
+
+			continue
+		}
+
+		m.finish(f)
+	}
+	m.running = stillRunning
+
+	return true
+}
+
+func (m *hostFuncMiddleware) finish(f *runningHostFunc) {
+	if f.cmd.Func != nil {
+		f.cmd.Func()
+	}
+
+	f.queue.IsRunning = false
+	f.queue.Dequeue()
+
+	m.driver.logCmdComplete(f.cmd)
+}
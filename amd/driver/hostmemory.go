@@ -0,0 +1,193 @@
+package driver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"log"
+
+	"github.com/sarchlab/akita/v4/sim"
+)
+
+// A hostMemoryRange is the host side of a memory copy that is in the host
+// memory that the driver allocates, rather than in a Go value.
+type hostMemoryRange struct {
+	ptr      Ptr
+	byteSize uint64
+}
+
+// AllocateHostMemory allocates host memory. Kernels can access the host memory
+// directly through the host link of the GPU (zero-copy), without copying the
+// data to the GPU memory first.
+//
+// Pinned memory is page-locked, so that the DMA engines can copy it directly.
+// The copies from and to pageable memory go through a pinned staging buffer,
+// which costs an extra copy on the host.
+func (d *Driver) AllocateHostMemory(
+	ctx *Context,
+	byteSize uint64,
+	pinned bool,
+) Ptr {
+	ptr := Ptr(d.memAllocator.Allocate(ctx.pid, byteSize, 0))
+
+	ctx.buffers = append(ctx.buffers, &buffer{
+		vAddr:  ptr,
+		size:   byteSize,
+		host:   true,
+		pinned: pinned,
+	})
+
+	return ptr
+}
+
+// EnqueueMemCopyH2DFromHostMemory registers a MemCopyH2DCommand that copies
+// from host memory that is allocated with AllocateHostMemory.
+func (d *Driver) EnqueueMemCopyH2DFromHostMemory(
+	queue *CommandQueue,
+	dst Ptr,
+	src Ptr,
+	byteSize uint64,
+) {
+	d.mustBeHostMemory(queue.Context, src)
+
+	cmd := &MemCopyH2DCommand{
+		ID:  sim.GetIDGenerator().Generate(),
+		Dst: dst,
+		Src: hostMemoryRange{ptr: src, byteSize: byteSize},
+	}
+	d.Enqueue(queue, cmd)
+}
+
+// EnqueueMemCopyD2HToHostMemory registers a MemCopyD2HCommand that copies to
+// host memory that is allocated with AllocateHostMemory.
+func (d *Driver) EnqueueMemCopyD2HToHostMemory(
+	queue *CommandQueue,
+	dst Ptr,
+	src Ptr,
+	byteSize uint64,
+) {
+	d.mustBeHostMemory(queue.Context, dst)
+
+	cmd := &MemCopyD2HCommand{
+		ID:  sim.GetIDGenerator().Generate(),
+		Dst: hostMemoryRange{ptr: dst, byteSize: byteSize},
+		Src: src,
+	}
+	d.Enqueue(queue, cmd)
+}
+
+func (d *Driver) findHostBuffer(ctx *Context, ptr Ptr) *buffer {
+	for _, b := range ctx.buffers {
+		if b.host && !b.freed && ptr >= b.vAddr && ptr < b.vAddr+Ptr(b.size) {
+			return b
+		}
+	}
+
+	return nil
+}
+
+func (d *Driver) mustBeHostMemory(ctx *Context, ptr Ptr) {
+	if d.findHostBuffer(ctx, ptr) == nil {
+		log.Panicf("0x%x is not in host memory", ptr)
+	}
+}
+
+// isPageable checks if the host side of a memory copy is pageable. Go values
+// are always pageable.
+func (d *Driver) isPageable(ctx *Context, hostSide interface{}) bool {
+	r, ok := hostSide.(hostMemoryRange)
+	if !ok {
+		return true
+	}
+
+	return !d.findHostBuffer(ctx, r.ptr).pinned
+}
+
+// copySrcBytes returns the data that a host-to-device copy copies.
+func (d *Driver) copySrcBytes(ctx *Context, src interface{}) []byte {
+	if r, ok := src.(hostMemoryRange); ok {
+		return d.readVirtualMemory(ctx, uint64(r.ptr), r.byteSize)
+	}
+
+	buffer := bytes.NewBuffer(nil)
+	err := binary.Write(buffer, binary.LittleEndian, src)
+	if err != nil {
+		panic(err)
+	}
+
+	return buffer.Bytes()
+}
+
+// copyDstByteSize returns the number of bytes that a device-to-host copy
+// copies.
+func copyDstByteSize(dst interface{}) int {
+	if r, ok := dst.(hostMemoryRange); ok {
+		return int(r.byteSize)
+	}
+
+	return binary.Size(dst)
+}
+
+// storeCopyDst stores the data that a device-to-host copy copies.
+func (d *Driver) storeCopyDst(ctx *Context, dst interface{}, data []byte) {
+	if r, ok := dst.(hostMemoryRange); ok {
+		d.writeVirtualMemory(ctx, uint64(r.ptr), data)
+		return
+	}
+
+	err := binary.Read(bytes.NewReader(data), binary.LittleEndian, dst)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func (d *Driver) readVirtualMemory(
+	ctx *Context,
+	vAddr, byteSize uint64,
+) []byte {
+	d.mustHaveGlobalStorage()
+
+	data := make([]byte, 0, byteSize)
+	for uint64(len(data)) < byteSize {
+		addr := vAddr + uint64(len(data))
+		pAddr, sizeInPage := d.translate(ctx, addr)
+		size := min(sizeInPage, byteSize-uint64(len(data)))
+
+		chunk, err := d.globalStorage.Read(pAddr, size)
+		if err != nil {
+			panic(err)
+		}
+
+		data = append(data, chunk...)
+	}
+
+	return data
+}
+
+func (d *Driver) writeVirtualMemory(ctx *Context, vAddr uint64, data []byte) {
+	d.mustHaveGlobalStorage()
+
+	offset := uint64(0)
+	for offset < uint64(len(data)) {
+		pAddr, sizeInPage := d.translate(ctx, vAddr+offset)
+		size := min(sizeInPage, uint64(len(data))-offset)
+
+		err := d.globalStorage.Write(pAddr, data[offset:offset+size])
+		if err != nil {
+			panic(err)
+		}
+
+		offset += size
+	}
+}
+
+// translate returns the physical address of a virtual address and the number
+// of bytes that are left in the page.
+func (d *Driver) translate(ctx *Context, vAddr uint64) (uint64, uint64) {
+	page, found := d.pageTable.Find(ctx.pid, vAddr)
+	if !found {
+		panic("page not found")
+	}
+
+	return page.PAddr + (vAddr - page.VAddr),
+		page.PageSize - (vAddr - page.VAddr)
+}
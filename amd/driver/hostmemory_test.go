@@ -0,0 +1,178 @@
+package driver
+
+import (
+	"github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sarchlab/akita/v4/mem/mem"
+	"github.com/sarchlab/akita/v4/mem/vm"
+	"github.com/sarchlab/akita/v4/sim"
+	"github.com/sarchlab/mgpusim/v4/amd/protocol"
+	"go.uber.org/mock/gomock"
+)
+
+var _ = ginkgo.Describe("Host memory", func() {
+	var (
+		mockCtrl   *gomock.Controller
+		gpu        *MockPort
+		storage    *mem.Storage
+		driver     *Driver
+		middleware *defaultMemoryCopyMiddleware
+		context    *Context
+		queue      *CommandQueue
+		devicePtr  Ptr
+	)
+
+	ginkgo.BeforeEach(func() {
+		mockCtrl = gomock.NewController(ginkgo.GinkgoT())
+		gpu = NewMockPort(mockCtrl)
+		gpu.EXPECT().AsRemote().AnyTimes()
+		storage = mem.NewStorage(8 * mem.GB)
+
+		driver = MakeBuilder().
+			WithLog2PageSize(12).
+			WithPageTable(vm.NewPageTable(12)).
+			WithGlobalStorage(storage).
+			WithPageableCopyBandwidth(1e9).
+			WithHostLinkBandwidth(1e9).
+			Build("Driver")
+		driver.RegisterGPU(gpu, DeviceProperties{
+			CUCount:  4,
+			DRAMSize: 4 * mem.GB,
+		})
+		middleware = driver.middlewares[0].(*defaultMemoryCopyMiddleware)
+
+		context = driver.Init()
+		context.pid = 1
+		queue = driver.CreateCommandQueue(context)
+		driver.SelectGPU(context, 1)
+		devicePtr = driver.AllocateMemory(context, 64)
+	})
+
+	ginkgo.AfterEach(func() {
+		mockCtrl.Finish()
+	})
+
+	ginkgo.It("should allocate host memory on the host", func() {
+		ptr := driver.AllocateHostMemory(context, 64, true)
+
+		pAddr, _ := driver.translate(context, uint64(ptr))
+
+		Expect(driver.memAllocator.GetDeviceIDByPAddr(pAddr)).To(Equal(0))
+	})
+
+	ginkgo.It("should write host memory without the GPUs", func() {
+		ptr := driver.AllocateHostMemory(context, 4, false)
+		cmd := &MemCopyH2DCommand{Dst: ptr, Src: []byte{1, 2, 3, 4}}
+		queue.Enqueue(cmd)
+
+		middleware.ProcessCommand(cmd, queue)
+
+		Expect(cmd.Reqs).To(BeEmpty())
+		Expect(queue.IsRunning).To(BeTrue())
+
+		for i := 0; i < 10 && queue.Peek() != nil; i++ {
+			middleware.Tick()
+		}
+
+		Expect(queue.Peek()).To(BeNil())
+		Expect(queue.IsRunning).To(BeFalse())
+		Expect(driver.readVirtualMemory(context, uint64(ptr), 4)).
+			To(Equal([]byte{1, 2, 3, 4}))
+	})
+
+	ginkgo.It("should charge the host link for host memory", func() {
+		ptr := driver.AllocateHostMemory(context, 4096, true)
+		driver.EnqueueMemCopyD2HToHostMemory(queue, ptr, ptr, 4096)
+		cmd := queue.Peek().(*MemCopyD2HCommand)
+
+		middleware.ProcessCommand(cmd, queue)
+
+		Expect(middleware.hostCopies).To(HaveLen(1))
+		Expect(middleware.hostCopies[0].cyclesLeft).To(Equal(4096))
+	})
+
+	ginkgo.It("should flush the GPUs before copying host memory", func() {
+		ptr := driver.AllocateHostMemory(context, 4, true)
+		driver.writeVirtualMemory(context, uint64(ptr), []byte{1, 2, 3, 4})
+		driver.findHostBuffer(context, ptr).l2Dirty = true
+		out := make([]byte, 4)
+		driver.EnqueueMemCopyD2H(queue, out, ptr)
+		cmd := queue.Peek().(*MemCopyD2HCommand)
+
+		middleware.ProcessCommand(cmd, queue)
+
+		Expect(cmd.Reqs).To(HaveLen(1))
+		flushReq := cmd.Reqs[0].(*protocol.FlushReq)
+
+		toGPUs := NewMockPort(mockCtrl)
+		toGPUs.EXPECT().PeekIncoming().Return(nil).AnyTimes()
+		driver.gpuPort = toGPUs
+		for i := 0; i < 10; i++ {
+			middleware.Tick()
+		}
+
+		Expect(queue.Peek()).To(BeIdenticalTo(cmd))
+
+		toGPUs.EXPECT().RetrieveIncoming()
+		middleware.processGeneralRsp(sim.GeneralRspBuilder{}.
+			WithOriginalReq(flushReq).
+			Build())
+		for i := 0; i < 10 && queue.Peek() != nil; i++ {
+			middleware.Tick()
+		}
+
+		Expect(queue.Peek()).To(BeNil())
+		Expect(out).To(Equal([]byte{1, 2, 3, 4}))
+	})
+
+	ginkgo.It("should copy from pinned memory without staging", func() {
+		ptr := driver.AllocateHostMemory(context, 4, true)
+		driver.writeVirtualMemory(context, uint64(ptr), []byte{1, 2, 3, 4})
+		driver.EnqueueMemCopyH2DFromHostMemory(queue, devicePtr, ptr, 4)
+		cmd := queue.Peek().(*MemCopyH2DCommand)
+
+		middleware.ProcessCommand(cmd, queue)
+
+		Expect(cmd.Reqs).To(HaveLen(1))
+		Expect(cmd.Reqs[0].(*protocol.MemCopyH2DReq).SrcBuffer).
+			To(Equal([]byte{1, 2, 3, 4}))
+		Expect(middleware.cyclesLeft).To(Equal(0))
+	})
+
+	ginkgo.It("should stage the copies from pageable memory", func() {
+		cmd := &MemCopyH2DCommand{Dst: devicePtr, Src: make([]byte, 64)}
+		queue.Enqueue(cmd)
+
+		middleware.ProcessCommand(cmd, queue)
+
+		Expect(cmd.Reqs).To(HaveLen(1))
+		Expect(middleware.cyclesLeft).To(Equal(64))
+	})
+
+	ginkgo.It("should copy to host memory", func() {
+		ptr := driver.AllocateHostMemory(context, 4, false)
+		driver.EnqueueMemCopyD2HToHostMemory(queue, ptr, devicePtr, 4)
+		cmd := queue.Peek().(*MemCopyD2HCommand)
+
+		middleware.ProcessCommand(cmd, queue)
+		copy(cmd.RawData, []byte{5, 6, 7, 8})
+		rsp := sim.GeneralRspBuilder{}.
+			WithOriginalReq(cmd.Reqs[0]).
+			Build()
+		toGPUs := NewMockPort(mockCtrl)
+		toGPUs.EXPECT().RetrieveIncoming()
+		driver.gpuPort = toGPUs
+
+		middleware.processGeneralRsp(rsp)
+
+		Expect(middleware.cyclesLeft).To(Equal(4))
+		Expect(driver.readVirtualMemory(context, uint64(ptr), 4)).
+			To(Equal([]byte{5, 6, 7, 8}))
+	})
+
+	ginkgo.It("should not copy from device memory as host memory", func() {
+		Expect(func() {
+			driver.EnqueueMemCopyH2DFromHostMemory(queue, devicePtr, devicePtr, 4)
+		}).To(Panic())
+	})
+})
@@ -1,5 +1,7 @@
 package internal
 
+import "github.com/sarchlab/akita/v4/sim"
+
 // DeviceType marks the type of a device.
 type DeviceType int
 
@@ -27,6 +29,11 @@ var MemoryAllocatorType = AllocatorTypeDefault
 type DeviceProperties struct {
 	CUCount  int
 	DRAMSize uint64
+
+	// Freq and IPC describe the cores of a CPU. They are used to estimate the
+	// time that the host takes to run host functions.
+	Freq sim.Freq
+	IPC  float64
 }
 
 // Device is a CPU or GPU managed by the driver.
@@ -0,0 +1,139 @@
+package internal
+
+import (
+	"container/list"
+	"math/rand"
+
+	"github.com/sarchlab/akita/v4/mem/vm"
+)
+
+// PageID identifies a page in the virtual address space of a process.
+type PageID struct {
+	PID   vm.PID
+	VAddr uint64
+}
+
+// An EvictionPolicy tracks the unified-memory pages that reside on a device
+// and decides which pages to evict when the device runs out of capacity.
+type EvictionPolicy interface {
+	// Insert starts tracking a page.
+	Insert(page PageID)
+
+	// Touch marks that a page has been accessed.
+	Touch(page PageID)
+
+	// Remove stops tracking a page.
+	Remove(page PageID)
+
+	// Has checks if a page is tracked.
+	Has(page PageID) bool
+
+	// Len returns the number of pages being tracked.
+	Len() int
+
+	// Candidates returns all the tracked pages, ordered from the most
+	// preferred victim to the least preferred victim.
+	Candidates() []PageID
+}
+
+// NewEvictionPolicy creates an eviction policy by name. Supported names are
+// "lru", "fifo", and "random".
+func NewEvictionPolicy(name string) EvictionPolicy {
+	switch name {
+	case "lru":
+		return newListEvictionPolicy(true)
+	case "fifo":
+		return newListEvictionPolicy(false)
+	case "random":
+		return &randomEvictionPolicy{
+			listEvictionPolicy: newListEvictionPolicy(false),
+			rand:               rand.New(rand.NewSource(1)),
+		}
+	default:
+		panic("unknown eviction policy " + name)
+	}
+}
+
+// listEvictionPolicy keeps the pages in a list. The front of the list is the
+// next victim. If moveOnTouch is set, accessing a page moves it to the back of
+// the list, making the policy an LRU policy. Otherwise, the pages are evicted
+// in the order that they are inserted.
+type listEvictionPolicy struct {
+	moveOnTouch bool
+	pages       *list.List
+	elements    map[PageID]*list.Element
+}
+
+func newListEvictionPolicy(moveOnTouch bool) *listEvictionPolicy {
+	return &listEvictionPolicy{
+		moveOnTouch: moveOnTouch,
+		pages:       list.New(),
+		elements:    make(map[PageID]*list.Element),
+	}
+}
+
+func (p *listEvictionPolicy) Insert(page PageID) {
+	if elem, found := p.elements[page]; found {
+		p.pages.MoveToBack(elem)
+		return
+	}
+
+	p.elements[page] = p.pages.PushBack(page)
+}
+
+func (p *listEvictionPolicy) Touch(page PageID) {
+	if !p.moveOnTouch {
+		return
+	}
+
+	elem, found := p.elements[page]
+	if !found {
+		return
+	}
+
+	p.pages.MoveToBack(elem)
+}
+
+func (p *listEvictionPolicy) Remove(page PageID) {
+	elem, found := p.elements[page]
+	if !found {
+		return
+	}
+
+	p.pages.Remove(elem)
+	delete(p.elements, page)
+}
+
+func (p *listEvictionPolicy) Has(page PageID) bool {
+	_, found := p.elements[page]
+	return found
+}
+
+func (p *listEvictionPolicy) Len() int {
+	return p.pages.Len()
+}
+
+func (p *listEvictionPolicy) Candidates() []PageID {
+	candidates := make([]PageID, 0, p.pages.Len())
+	for e := p.pages.Front(); e != nil; e = e.Next() {
+		candidates = append(candidates, e.Value.(PageID))
+	}
+
+	return candidates
+}
+
+// randomEvictionPolicy selects victims randomly. A fixed seed is used so that
+// the simulation is deterministic.
+type randomEvictionPolicy struct {
+	*listEvictionPolicy
+	rand *rand.Rand
+}
+
+func (p *randomEvictionPolicy) Candidates() []PageID {
+	candidates := p.listEvictionPolicy.Candidates()
+	p.rand.Shuffle(len(candidates), func(i, j int) {
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	})
+
+	return candidates
+}
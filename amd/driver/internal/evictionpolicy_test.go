@@ -0,0 +1,61 @@
+package internal
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("EvictionPolicy", func() {
+	var (
+		page1 = PageID{PID: 1, VAddr: 0x1000}
+		page2 = PageID{PID: 1, VAddr: 0x2000}
+		page3 = PageID{PID: 2, VAddr: 0x1000}
+	)
+
+	It("should evict the least recently used page first", func() {
+		p := NewEvictionPolicy("lru")
+		p.Insert(page1)
+		p.Insert(page2)
+		p.Insert(page3)
+
+		p.Touch(page1)
+
+		Expect(p.Candidates()).To(Equal([]PageID{page2, page3, page1}))
+	})
+
+	It("should evict the first inserted page first", func() {
+		p := NewEvictionPolicy("fifo")
+		p.Insert(page1)
+		p.Insert(page2)
+		p.Insert(page3)
+
+		p.Touch(page1)
+
+		Expect(p.Candidates()).To(Equal([]PageID{page1, page2, page3}))
+	})
+
+	It("should list all pages when evicting randomly", func() {
+		p := NewEvictionPolicy("random")
+		p.Insert(page1)
+		p.Insert(page2)
+		p.Insert(page3)
+
+		Expect(p.Candidates()).To(ConsistOf(page1, page2, page3))
+	})
+
+	It("should remove pages", func() {
+		p := NewEvictionPolicy("lru")
+		p.Insert(page1)
+		p.Insert(page2)
+
+		p.Remove(page1)
+
+		Expect(p.Len()).To(Equal(1))
+		Expect(p.Has(page1)).To(BeFalse())
+		Expect(p.Has(page2)).To(BeTrue())
+	})
+
+	It("should panic on unknown policies", func() {
+		Expect(func() { NewEvictionPolicy("mru") }).To(Panic())
+	})
+})
@@ -12,8 +12,9 @@ type MemoryAllocator interface {
 	RegisterDevice(device *Device)
 	GetDeviceIDByPAddr(pAddr uint64) int
 	Allocate(pid vm.PID, byteSize uint64, deviceID int) uint64
-	AllocateUnified(pid vm.PID, byteSize uint64) uint64
+	AllocateUnified(pid vm.PID, byteSize uint64, deviceID int) uint64
 	Free(vAddr uint64)
+	FreePhysicalPage(pAddr uint64)
 	Remap(pid vm.PID, pageVAddr, byteSize uint64, deviceID int)
 	RemovePage(vAddr uint64)
 	AllocatePageWithGivenVAddr(
@@ -115,6 +116,7 @@ func (a *memoryAllocatorImpl) Allocate(
 func (a *memoryAllocatorImpl) AllocateUnified(
 	pid vm.PID,
 	byteSize uint64,
+	deviceID int,
 ) uint64 {
 	if byteSize == 0 {
 		panic("Allocating 0 bytes.")
@@ -125,7 +127,7 @@ func (a *memoryAllocatorImpl) AllocateUnified(
 
 	pageSize := uint64(1 << a.log2PageSize)
 	numPages := (byteSize-1)/pageSize + 1
-	return a.allocatePages(int(numPages), pid, 1, true)
+	return a.allocatePages(int(numPages), pid, deviceID, true)
 }
 
 func (a *memoryAllocatorImpl) allocatePages(
@@ -212,6 +214,16 @@ func (a *memoryAllocatorImpl) removePage(vAddr uint64) {
 	a.pageTable.Remove(page.PID, page.VAddr)
 }
 
+// FreePhysicalPage returns a physical page to the device that owns it, without
+// touching the page table. It is used when a page moves to another device.
+func (a *memoryAllocatorImpl) FreePhysicalPage(pAddr uint64) {
+	a.Lock()
+	defer a.Unlock()
+
+	deviceID := a.deviceIDByPAddr(pAddr)
+	a.devices[deviceID].MemState.addSinglePAddr(pAddr)
+}
+
 func (a *memoryAllocatorImpl) AllocatePageWithGivenVAddr(
 	pid vm.PID,
 	deviceID int,
@@ -55,7 +55,23 @@ var _ = Describe("MemoryAllocatorImpl", func() {
 				Unified:  true,
 			})
 
-		ptr := allocator.AllocateUnified(1, 8)
+		ptr := allocator.AllocateUnified(1, 8, 1)
+		Expect(ptr).To(Equal(uint64(4096)))
+	})
+
+	It("should allocate unified memory on the host", func() {
+		pageTable.EXPECT().Insert(
+			vm.Page{
+				PID:      1,
+				PAddr:    0x1000,
+				VAddr:    4096,
+				PageSize: 4096,
+				DeviceID: 0,
+				Valid:    true,
+				Unified:  true,
+			})
+
+		ptr := allocator.AllocateUnified(1, 8, 0)
 		Expect(ptr).To(Equal(uint64(4096)))
 	})
 
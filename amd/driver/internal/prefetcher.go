@@ -0,0 +1,129 @@
+package internal
+
+// A MigrationPrefetcher selects the pages that migrate together with a page
+// that triggers a page fault.
+type MigrationPrefetcher interface {
+	// Prefetch returns the virtual addresses of the pages to migrate along
+	// with the faulting page. The isResident function tells if a page already
+	// resides on the device that the faulting page migrates to.
+	Prefetch(vAddr uint64, isResident func(vAddr uint64) bool) []uint64
+}
+
+// NewMigrationPrefetcher creates a prefetcher by name. Supported names are
+// "none", "sequential", and "tree". The depth is the number of pages that
+// the sequential prefetcher brings in after the faulting page.
+func NewMigrationPrefetcher(
+	name string,
+	log2PageSize uint64,
+	depth int,
+) MigrationPrefetcher {
+	switch name {
+	case "none":
+		return noPrefetcher{}
+	case "sequential":
+		return &sequentialPrefetcher{
+			log2PageSize: log2PageSize,
+			depth:        depth,
+		}
+	case "tree":
+		return &treePrefetcher{
+			log2PageSize:   log2PageSize,
+			log2RegionSize: 21,
+			densityNum:     1,
+			densityDenom:   2,
+		}
+	default:
+		panic("unknown migration prefetcher " + name)
+	}
+}
+
+type noPrefetcher struct{}
+
+func (noPrefetcher) Prefetch(
+	vAddr uint64,
+	isResident func(vAddr uint64) bool,
+) []uint64 {
+	return nil
+}
+
+// sequentialPrefetcher brings in the pages that follow the faulting page.
+type sequentialPrefetcher struct {
+	log2PageSize uint64
+	depth        int
+}
+
+func (p *sequentialPrefetcher) Prefetch(
+	vAddr uint64,
+	isResident func(vAddr uint64) bool,
+) []uint64 {
+	pageSize := uint64(1) << p.log2PageSize
+	pageVAddr := vAddr >> p.log2PageSize << p.log2PageSize
+
+	vAddrs := make([]uint64, 0, p.depth)
+	for i := 1; i <= p.depth; i++ {
+		addr := pageVAddr + uint64(i)*pageSize
+		if isResident(addr) {
+			continue
+		}
+
+		vAddrs = append(vAddrs, addr)
+	}
+
+	return vAddrs
+}
+
+// treePrefetcher implements the tree-based density prefetcher of the NVIDIA
+// UVM driver. The virtual address space is divided into regions, and each
+// region is treated as a full binary tree whose leaves are pages. On a fault,
+// the prefetcher walks from the faulting page to the root of the region and
+// selects the largest subtree in which more than the given fraction of the
+// pages would be resident after the migration. All the non-resident pages in
+// the subtree are prefetched.
+type treePrefetcher struct {
+	log2PageSize   uint64
+	log2RegionSize uint64
+	densityNum     uint64
+	densityDenom   uint64
+}
+
+func (p *treePrefetcher) Prefetch(
+	vAddr uint64,
+	isResident func(vAddr uint64) bool,
+) []uint64 {
+	pageSize := uint64(1) << p.log2PageSize
+	pageVAddr := vAddr >> p.log2PageSize << p.log2PageSize
+
+	resident := func(addr uint64) bool {
+		return addr == pageVAddr || isResident(addr)
+	}
+
+	selectedStart, selectedEnd := pageVAddr, pageVAddr+pageSize
+	log2NodeSize := p.log2PageSize + 1
+	for ; log2NodeSize <= p.log2RegionSize; log2NodeSize++ {
+		nodeStart := pageVAddr >> log2NodeSize << log2NodeSize
+		nodeEnd := nodeStart + (uint64(1) << log2NodeSize)
+
+		numPages := (nodeEnd - nodeStart) >> p.log2PageSize
+		numResident := uint64(0)
+		for addr := nodeStart; addr < nodeEnd; addr += pageSize {
+			if resident(addr) {
+				numResident++
+			}
+		}
+
+		if numResident*p.densityDenom > numPages*p.densityNum {
+			selectedStart, selectedEnd = nodeStart, nodeEnd
+		}
+	}
+
+	vAddrs := make([]uint64, 0)
+	for addr := selectedStart; addr < selectedEnd; addr += pageSize {
+		if resident(addr) {
+			continue
+		}
+
+		vAddrs = append(vAddrs, addr)
+	}
+
+	return vAddrs
+}
@@ -0,0 +1,48 @@
+package internal
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("MigrationPrefetcher", func() {
+	noneResident := func(vAddr uint64) bool { return false }
+
+	It("should not prefetch", func() {
+		p := NewMigrationPrefetcher("none", 12, 4)
+
+		Expect(p.Prefetch(0x1000, noneResident)).To(BeEmpty())
+	})
+
+	It("should prefetch the following pages", func() {
+		p := NewMigrationPrefetcher("sequential", 12, 3)
+
+		vAddrs := p.Prefetch(0x1100, func(vAddr uint64) bool {
+			return vAddr == 0x3000
+		})
+
+		Expect(vAddrs).To(Equal([]uint64{0x2000, 0x4000}))
+	})
+
+	It("should not prefetch sparse regions", func() {
+		p := NewMigrationPrefetcher("tree", 12, 0)
+
+		Expect(p.Prefetch(0x0, noneResident)).To(BeEmpty())
+	})
+
+	It("should prefetch a dense subtree", func() {
+		p := NewMigrationPrefetcher("tree", 12, 0)
+
+		// Pages 0x1000 and 0x2000 are resident. With the faulting page 0x0,
+		// 3 out of the 4 pages in [0x0, 0x4000) are resident.
+		vAddrs := p.Prefetch(0x0, func(vAddr uint64) bool {
+			return vAddr == 0x1000 || vAddr == 0x2000
+		})
+
+		Expect(vAddrs).To(Equal([]uint64{0x3000}))
+	})
+
+	It("should panic on unknown prefetchers", func() {
+		Expect(func() { NewMigrationPrefetcher("stride", 12, 1) }).To(Panic())
+	})
+})
@@ -17,23 +17,93 @@ func (d *Driver) EnqueueLaunchKernel(
 	gridSize [3]uint32,
 	wgSize [3]uint16,
 	kernelArgs interface{},
+) {
+	d.enqueueLaunchKernel(queue, co, gridSize, wgSize, kernelArgs, nil)
+}
+
+// EnqueueLaunchKernelWithCUMask schedules a kernel that can only run on the
+// CUs in the mask. Bit i of the mask (bit i%32 of word i/32) allows CU i. The
+// mask overrides the mask of the command queue. An error is returned, and the
+// kernel is not scheduled, if the mask allows none of the CUs of the GPU.
+func (d *Driver) EnqueueLaunchKernelWithCUMask(
+	queue *CommandQueue,
+	co *insts.HsaCo,
+	gridSize [3]uint32,
+	wgSize [3]uint16,
+	kernelArgs interface{},
+	cuMask []uint32,
+) error {
+	err := d.checkCUMask(queue.GPUID, cuMask)
+	if err != nil {
+		return err
+	}
+
+	d.enqueueLaunchKernel(queue, co, gridSize, wgSize, kernelArgs, cuMask)
+
+	return nil
+}
+
+func (d *Driver) enqueueLaunchKernel(
+	queue *CommandQueue,
+	co *insts.HsaCo,
+	gridSize [3]uint32,
+	wgSize [3]uint16,
+	kernelArgs interface{},
+	cuMask []uint32,
 ) {
 	dev := d.devices[queue.GPUID]
 
 	if dev.Type == internal.DeviceTypeUnifiedGPU {
-		d.enqueueLaunchUnifiedKernel(queue, co, gridSize, wgSize, kernelArgs)
+		d.enqueueLaunchUnifiedKernel(
+			queue, co, gridSize, wgSize, kernelArgs, cuMask)
 	} else {
-		dCoData, dKernArgData, dPacket := d.allocateGPUMemory(queue.Context, co)
+		d.enqueueLaunchSingleGPUKernel(
+			queue, co, gridSize, wgSize, kernelArgs, cuMask, false)
+	}
+}
 
-		packet := d.createAQLPacket(gridSize, wgSize, dCoData, dKernArgData)
-		newKernelArgs := d.prepareLocalMemory(co, kernelArgs, packet)
+// EnqueueLaunchCooperativeKernel schedules a kernel whose work-groups all run
+// at the same time, so that the work-groups can synchronize with grid
+// barriers. The GPU waits until the CUs can hold all the work-groups before
+// starting the kernel. If the work-groups cannot fit on the CUs at the same
+// time, the kernel does not run and the error is reported by the Err method of
+// the queue. Cooperative kernels cannot run on unified multi-GPU devices.
+func (d *Driver) EnqueueLaunchCooperativeKernel(
+	queue *CommandQueue,
+	co *insts.HsaCo,
+	gridSize [3]uint32,
+	wgSize [3]uint16,
+	kernelArgs interface{},
+) {
+	dev := d.devices[queue.GPUID]
+	if dev.Type == internal.DeviceTypeUnifiedGPU {
+		panic("cooperative kernels cannot run on unified multi-GPU devices")
+	}
 
-		d.EnqueueMemCopyH2D(queue, dCoData, co.Data)
-		d.EnqueueMemCopyH2D(queue, dKernArgData, newKernelArgs)
-		d.EnqueueMemCopyH2D(queue, dPacket, packet)
+	d.enqueueLaunchSingleGPUKernel(
+		queue, co, gridSize, wgSize, kernelArgs, nil, true)
+}
 
-		d.enqueueLaunchKernelCommand(queue, co, packet, dPacket)
-	}
+func (d *Driver) enqueueLaunchSingleGPUKernel(
+	queue *CommandQueue,
+	co *insts.HsaCo,
+	gridSize [3]uint32,
+	wgSize [3]uint16,
+	kernelArgs interface{},
+	cuMask []uint32,
+	cooperative bool,
+) {
+	dCoData, dKernArgData, dPacket := d.allocateGPUMemory(queue.Context, co)
+
+	packet := d.createAQLPacket(gridSize, wgSize, dCoData, dKernArgData)
+	newKernelArgs := d.prepareLocalMemory(co, kernelArgs, packet)
+
+	d.EnqueueMemCopyH2D(queue, dCoData, co.Data)
+	d.EnqueueMemCopyH2D(queue, dKernArgData, newKernelArgs)
+	d.EnqueueMemCopyH2D(queue, dPacket, packet)
+
+	d.enqueueLaunchKernelCommand(
+		queue, co, packet, dPacket, cuMask, cooperative)
 }
 
 func (d *Driver) allocateGPUMemory(
@@ -117,12 +187,16 @@ func (d *Driver) enqueueLaunchKernelCommand(
 	co *insts.HsaCo,
 	packet *kernels.HsaKernelDispatchPacket,
 	dPacket Ptr,
+	cuMask []uint32,
+	cooperative bool,
 ) {
 	cmd := &LaunchKernelCommand{
-		ID:         sim.GetIDGenerator().Generate(),
-		CodeObject: co,
-		DPacket:    dPacket,
-		Packet:     packet,
+		ID:          sim.GetIDGenerator().Generate(),
+		CodeObject:  co,
+		DPacket:     dPacket,
+		Packet:      packet,
+		CUMask:      cuMask,
+		Cooperative: cooperative,
 	}
 	d.Enqueue(queue, cmd)
 }
@@ -132,12 +206,14 @@ func (d *Driver) enqueueLaunchUnifiedKernelCommand(
 	co *insts.HsaCo,
 	packet []*kernels.HsaKernelDispatchPacket,
 	dPacket []Ptr,
+	cuMask []uint32,
 ) {
 	cmd := &LaunchUnifiedMultiGPUKernelCommand{
 		ID:           sim.GetIDGenerator().Generate(),
 		CodeObject:   co,
 		DPacketArray: dPacket,
 		PacketArray:  packet,
+		CUMask:       cuMask,
 	}
 	d.Enqueue(queue, cmd)
 }
@@ -147,6 +223,7 @@ func (d *Driver) enqueueLaunchUnifiedKernel(
 	gridSize [3]uint32,
 	wgSize [3]uint16,
 	kernelArgs interface{},
+	cuMask []uint32,
 ) {
 	dev := d.devices[queue.GPUID]
 	initGPUID := queue.Context.currentGPUID
@@ -177,5 +254,6 @@ func (d *Driver) enqueueLaunchUnifiedKernel(
 	}
 
 	queue.Context.currentGPUID = initGPUID
-	d.enqueueLaunchUnifiedKernelCommand(queue, co, packetArray, dPacketArray)
+	d.enqueueLaunchUnifiedKernelCommand(
+		queue, co, packetArray, dPacketArray, cuMask)
 }
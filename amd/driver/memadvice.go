@@ -0,0 +1,183 @@
+package driver
+
+import (
+	"log"
+
+	"github.com/sarchlab/mgpusim/v4/amd/driver/internal"
+)
+
+// A MemAdviceKind is a kind of hint about how a range of unified memory is
+// used.
+type MemAdviceKind int
+
+// The kinds of memory advice. They mirror the advice of cudaMemAdvise, except
+// for the read-mostly advice. The page table maps a page to a single device and
+// the TLBs do not tell reads from writes, so read-only copies of a page on each
+// device can neither be mapped nor invalidated on a write.
+const (
+	// MemAdviseSetPreferredLocation keeps the pages on the given device once
+	// they are there. Other devices access the pages remotely.
+	MemAdviseSetPreferredLocation MemAdviceKind = iota
+	MemAdviseUnsetPreferredLocation
+
+	// MemAdviseSetAccessedBy lets the given device access the pages wherever
+	// they are, without migrating them.
+	MemAdviseSetAccessedBy
+	MemAdviseUnsetAccessedBy
+)
+
+// A MemAdvice tells the driver how a range of unified memory is accessed.
+// DeviceID is the device that the preferred-location and accessed-by advice
+// refer to.
+type MemAdvice struct {
+	Kind     MemAdviceKind
+	DeviceID int
+}
+
+const noPreferredLocation = -1
+
+// pageAdvice is the advice that applies to a single page.
+type pageAdvice struct {
+	preferredLocation int
+	accessedBy        map[int]bool
+}
+
+// MemAdvise tells the driver how a range of unified memory is going to be
+// accessed.
+func (d *Driver) MemAdvise(
+	ctx *Context,
+	ptr Ptr,
+	byteSize uint64,
+	advice MemAdvice,
+) {
+	d.memAdviceMutex.Lock()
+	defer d.memAdviceMutex.Unlock()
+
+	pageSize := uint64(1) << d.Log2PageSize
+	startAddr := uint64(ptr) >> d.Log2PageSize << d.Log2PageSize
+	for addr := startAddr; addr < uint64(ptr)+byteSize; addr += pageSize {
+		page := internal.PageID{PID: ctx.pid, VAddr: addr}
+		d.applyMemAdvice(page, d.adviceOf(page), advice)
+		d.updatePagePinning(page)
+	}
+}
+
+func (d *Driver) adviceOf(page internal.PageID) *pageAdvice {
+	a, found := d.pageAdvices[page]
+	if !found {
+		a = &pageAdvice{
+			preferredLocation: noPreferredLocation,
+			accessedBy:        make(map[int]bool),
+		}
+		d.pageAdvices[page] = a
+	}
+
+	return a
+}
+
+func (d *Driver) applyMemAdvice(
+	page internal.PageID,
+	a *pageAdvice,
+	advice MemAdvice,
+) {
+	switch advice.Kind {
+	case MemAdviseSetPreferredLocation:
+		a.preferredLocation = advice.DeviceID
+	case MemAdviseUnsetPreferredLocation:
+		a.preferredLocation = noPreferredLocation
+	case MemAdviseSetAccessedBy:
+		a.accessedBy[advice.DeviceID] = true
+	case MemAdviseUnsetAccessedBy:
+		delete(a.accessedBy, advice.DeviceID)
+	default:
+		log.Panicf("unknown memory advice %d", advice.Kind)
+	}
+}
+
+// updatePagePinning pins the page if the advice requires the page to stay
+// where it is. Pinned pages are accessed remotely rather than migrated by the
+// MMU.
+func (d *Driver) updatePagePinning(pageID internal.PageID) {
+	a, found := d.pageAdvices[pageID]
+	if !found {
+		return
+	}
+
+	page, found := d.pageTable.Find(pageID.PID, pageID.VAddr)
+	if !found || !page.Unified {
+		return
+	}
+
+	pinned := a.preferredLocation == int(page.DeviceID)
+	for deviceID := range a.accessedBy {
+		if deviceID != int(page.DeviceID) {
+			pinned = true
+		}
+	}
+
+	if page.IsPinned == pinned {
+		return
+	}
+
+	page.IsPinned = pinned
+	d.pageTable.Update(page)
+}
+
+// isPreferredElsewhere checks if a page prefers to stay on a device other than
+// the given device.
+func (d *Driver) isPreferredElsewhere(
+	page internal.PageID,
+	deviceID uint64,
+) bool {
+	d.memAdviceMutex.Lock()
+	defer d.memAdviceMutex.Unlock()
+
+	a, found := d.pageAdvices[page]
+	if !found || a.preferredLocation == noPreferredLocation {
+		return false
+	}
+
+	return a.preferredLocation != int(deviceID)
+}
+
+// isOnPreferredLocation checks if a page is on the device that it prefers.
+func (d *Driver) isOnPreferredLocation(
+	page internal.PageID,
+	deviceID int,
+) bool {
+	d.memAdviceMutex.Lock()
+	defer d.memAdviceMutex.Unlock()
+
+	a, found := d.pageAdvices[page]
+
+	return found && a.preferredLocation == deviceID
+}
+
+// forgetMemAdvice removes the advice of the pages in the given range.
+func (d *Driver) forgetMemAdvice(
+	ctx *Context,
+	vAddr, byteSize uint64,
+) {
+	d.memAdviceMutex.Lock()
+	defer d.memAdviceMutex.Unlock()
+
+	pageSize := uint64(1) << d.Log2PageSize
+	for addr := vAddr; addr < vAddr+byteSize; addr += pageSize {
+		delete(d.pageAdvices, internal.PageID{PID: ctx.pid, VAddr: addr})
+	}
+}
+
+// reapplyMemAdvice restores the pinning that the advice requires after pages
+// migrate.
+func (d *Driver) reapplyMemAdvice(pages []*pageMigration) {
+	d.memAdviceMutex.Lock()
+	defer d.memAdviceMutex.Unlock()
+
+	if len(d.pageAdvices) == 0 {
+		return
+	}
+
+	for _, m := range pages {
+		d.updatePagePinning(m.page)
+	}
+}
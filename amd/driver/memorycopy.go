@@ -1,8 +1,7 @@
 package driver
 
 import (
-	"bytes"
-	"encoding/binary"
+	"math"
 
 	"github.com/sarchlab/akita/v4/sim"
 	"github.com/sarchlab/mgpusim/v4/amd/protocol"
@@ -17,7 +16,29 @@ type defaultMemoryCopyMiddleware struct {
 	cyclesPerD2H int
 	cyclesLeft   int
 
+	// pageableCopyBandwidth is the number of bytes per second that the host
+	// copies between pageable memory and the pinned staging buffer. 0 means
+	// that staging is free.
+	pageableCopyBandwidth float64
+
+	// hostLinkBandwidth is the number of bytes per second that the host link
+	// transfers the host-resident part of a memory copy at. 0 means that the
+	// host-resident part is copied instantly.
+	hostLinkBandwidth float64
+
 	awaitingReqs []sim.Msg
+	hostCopies   []*hostCopy
+}
+
+// A hostCopy is the part of a memory copy that is resident in the host
+// memory. The host copies the data after the flushes of the command return,
+// so that the dirty lines that the GPUs hold for the data are written back
+// first, and after the data crosses the host link.
+type hostCopy struct {
+	cmd        Command
+	queue      *CommandQueue
+	cyclesLeft int
+	copyData   []func()
 }
 
 func (m *defaultMemoryCopyMiddleware) ProcessCommand(
@@ -29,6 +50,8 @@ func (m *defaultMemoryCopyMiddleware) ProcessCommand(
 		return m.processMemCopyH2DCommand(cmd, queue)
 	case *MemCopyD2HCommand:
 		return m.processMemCopyD2HCommand(cmd, queue)
+	case *MemCopyD2DCommand:
+		return m.processMemCopyD2DCommand(cmd, queue)
 	}
 
 	return false
@@ -38,18 +61,12 @@ func (m *defaultMemoryCopyMiddleware) processMemCopyH2DCommand(
 	cmd *MemCopyH2DCommand,
 	queue *CommandQueue,
 ) bool {
-	if m.needFlushing(queue.Context, cmd.Dst, uint64(binary.Size(cmd.Src))) {
-		m.sendFlushRequest(cmd)
-	}
-
-	buffer := bytes.NewBuffer(nil)
-	err := binary.Write(buffer, binary.LittleEndian, cmd.Src)
-	if err != nil {
-		panic(err)
-	}
-	rawBytes := buffer.Bytes()
+	rawBytes := m.driver.copySrcBytes(queue.Context, cmd.Src)
 
 	offset := uint64(0)
+	stagedBytes := uint64(0)
+	hostBytes := uint64(0)
+	var copyHostData []func()
 	addr := uint64(cmd.Dst)
 	sizeLeft := uint64(len(rawBytes))
 	for sizeLeft > 0 {
@@ -65,12 +82,29 @@ func (m *defaultMemoryCopyMiddleware) processMemCopyH2DCommand(
 			sizeToCopy = sizeLeft
 		}
 
+		m.driver.touchUnifiedPages(queue.Context.pid, addr, sizeToCopy)
+
 		gpuID := m.driver.memAllocator.GetDeviceIDByPAddr(pAddr)
+		if gpuID == 0 {
+			data := rawBytes[offset : offset+sizeToCopy]
+			copyHostData = append(copyHostData, func() {
+				m.writeHostMemory(pAddr, data)
+			})
+			hostBytes += sizeToCopy
+
+			sizeLeft -= sizeToCopy
+			addr += sizeToCopy
+			offset += sizeToCopy
+
+			continue
+		}
+
 		req := protocol.NewMemCopyH2DReq(
 			m.driver.gpuPort, m.driver.GPUs[gpuID-1],
 			rawBytes[offset:offset+sizeToCopy],
 			pAddr)
 		cmd.Reqs = append(cmd.Reqs, req)
+		stagedBytes += sizeToCopy
 		m.awaitingReqs = append(m.awaitingReqs, req)
 		// m.driver.requestsToSend = append(m.driver.requestsToSend, req)
 
@@ -81,9 +115,18 @@ func (m *defaultMemoryCopyMiddleware) processMemCopyH2DCommand(
 		m.driver.logTaskToGPUInitiate(cmd, req)
 	}
 
-	m.cyclesLeft = m.cyclesPerH2D
+	if m.needFlushing(queue.Context, cmd.Dst, uint64(len(rawBytes))) {
+		m.sendFlushRequest(cmd)
+	}
+
+	if stagedBytes > 0 {
+		m.cyclesLeft = m.cyclesPerH2D +
+			m.stagingCycles(queue.Context, cmd.Src, stagedBytes)
+	}
 
 	queue.IsRunning = true
+	m.startHostCopy(cmd, queue, m.cyclesPerH2D, hostBytes, copyHostData)
+	m.completeCopyIfDone(cmd, queue)
 
 	return true
 }
@@ -92,14 +135,12 @@ func (m *defaultMemoryCopyMiddleware) processMemCopyD2HCommand(
 	cmd *MemCopyD2HCommand,
 	queue *CommandQueue,
 ) bool {
-	if m.needFlushing(queue.Context, cmd.Src, uint64(binary.Size(cmd.Dst))) {
-		m.sendFlushRequest(cmd)
-		queue.Context.removeFreedBuffers()
-	}
-
-	cmd.RawData = make([]byte, binary.Size(cmd.Dst))
+	cmd.RawData = make([]byte, copyDstByteSize(cmd.Dst))
 
 	offset := uint64(0)
+	stagedBytes := uint64(0)
+	hostBytes := uint64(0)
+	var copyHostData []func()
 	addr := uint64(cmd.Src)
 	sizeLeft := uint64(len(cmd.RawData))
 	for sizeLeft > 0 {
@@ -115,11 +156,28 @@ func (m *defaultMemoryCopyMiddleware) processMemCopyD2HCommand(
 			sizeToCopy = sizeLeft
 		}
 
+		m.driver.touchUnifiedPages(queue.Context.pid, addr, sizeToCopy)
+
 		gpuID := m.driver.memAllocator.GetDeviceIDByPAddr(pAddr)
+		if gpuID == 0 {
+			buf := cmd.RawData[offset : offset+sizeToCopy]
+			copyHostData = append(copyHostData, func() {
+				m.readHostMemory(pAddr, buf)
+			})
+			hostBytes += sizeToCopy
+
+			sizeLeft -= sizeToCopy
+			addr += sizeToCopy
+			offset += sizeToCopy
+
+			continue
+		}
+
 		req := protocol.NewMemCopyD2HReq(
 			m.driver.gpuPort, m.driver.GPUs[gpuID-1],
 			pAddr, cmd.RawData[offset:offset+sizeToCopy])
 		cmd.Reqs = append(cmd.Reqs, req)
+		stagedBytes += sizeToCopy
 		m.awaitingReqs = append(m.awaitingReqs, req)
 		// m.driver.requestsToSend = append(m.driver.requestsToSend, req)
 
@@ -130,12 +188,177 @@ func (m *defaultMemoryCopyMiddleware) processMemCopyD2HCommand(
 		m.driver.logTaskToGPUInitiate(cmd, req)
 	}
 
-	m.cyclesLeft = m.cyclesPerD2H
+	if m.needFlushing(queue.Context, cmd.Src, uint64(len(cmd.RawData))) {
+		m.sendFlushRequest(cmd)
+		queue.Context.removeFreedBuffers()
+	}
+
+	if stagedBytes > 0 {
+		m.cyclesLeft = m.cyclesPerD2H +
+			m.stagingCycles(queue.Context, cmd.Dst, stagedBytes)
+	}
 
 	queue.IsRunning = true
+	m.startHostCopy(cmd, queue, m.cyclesPerD2H, hostBytes, copyHostData)
+	m.completeCopyIfDone(cmd, queue)
+
 	return true
 }
 
+// stagingCycles returns the number of cycles that the host takes to copy the
+// data of a pageable memory copy through the pinned staging buffer.
+func (m *defaultMemoryCopyMiddleware) stagingCycles(
+	ctx *Context,
+	hostSide interface{},
+	byteSize uint64,
+) int {
+	if m.pageableCopyBandwidth <= 0 || !m.driver.isPageable(ctx, hostSide) {
+		return 0
+	}
+
+	seconds := float64(byteSize) / m.pageableCopyBandwidth
+
+	return int(math.Ceil(seconds * float64(m.driver.Freq)))
+}
+
+// startHostCopy lets the host copy the host-resident part of a memory copy.
+// The copy takes the fixed cycles of the direction, plus the time that the
+// host link takes to transfer the data.
+func (m *defaultMemoryCopyMiddleware) startHostCopy(
+	cmd Command,
+	queue *CommandQueue,
+	fixedCycles int,
+	byteSize uint64,
+	copyData []func(),
+) {
+	if len(copyData) == 0 {
+		return
+	}
+
+	m.hostCopies = append(m.hostCopies, &hostCopy{
+		cmd:        cmd,
+		queue:      queue,
+		cyclesLeft: fixedCycles + m.hostLinkCycles(byteSize),
+		copyData:   copyData,
+	})
+}
+
+// hostLinkCycles returns the number of cycles that the host link takes to
+// transfer the given number of bytes.
+func (m *defaultMemoryCopyMiddleware) hostLinkCycles(byteSize uint64) int {
+	if m.hostLinkBandwidth <= 0 {
+		return 0
+	}
+
+	seconds := float64(byteSize) / m.hostLinkBandwidth
+
+	return int(math.Ceil(seconds * float64(m.driver.Freq)))
+}
+
+// tickHostCopies counts down the host copies whose flushes have returned, and
+// copies the data of the ones that are done.
+func (m *defaultMemoryCopyMiddleware) tickHostCopies() bool {
+	madeProgress := false
+
+	for i := 0; i < len(m.hostCopies); {
+		c := m.hostCopies[i]
+		if hasPendingFlush(c.cmd) {
+			i++
+			continue
+		}
+
+		madeProgress = true
+
+		if c.cyclesLeft > 0 {
+			c.cyclesLeft--
+			i++
+
+			continue
+		}
+
+		for _, copyData := range c.copyData {
+			copyData()
+		}
+
+		m.hostCopies = append(m.hostCopies[:i], m.hostCopies[i+1:]...)
+		m.completeCopyIfDone(c.cmd, c.queue)
+	}
+
+	return madeProgress
+}
+
+func hasPendingFlush(cmd Command) bool {
+	for _, req := range cmd.GetReqs() {
+		if _, ok := req.(*protocol.FlushReq); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (m *defaultMemoryCopyMiddleware) hasHostCopy(cmd Command) bool {
+	for _, c := range m.hostCopies {
+		if c.cmd == cmd {
+			return true
+		}
+	}
+
+	return false
+}
+
+// completeCopyIfDone completes a memory copy command once the GPUs have
+// returned all the requests and the host has copied the host-resident data.
+func (m *defaultMemoryCopyMiddleware) completeCopyIfDone(
+	cmd Command,
+	queue *CommandQueue,
+) {
+	if len(cmd.GetReqs()) > 0 || m.hasHostCopy(cmd) {
+		return
+	}
+
+	switch cmd := cmd.(type) {
+	case *MemCopyD2HCommand:
+		m.driver.storeCopyDst(queue.Context, cmd.Dst, cmd.RawData)
+	case *MemCopyH2DCommand, *MemCopyD2DCommand:
+	default:
+		return
+	}
+
+	queue.IsRunning = false
+	queue.Dequeue()
+
+	m.driver.logCmdComplete(cmd)
+}
+
+// writeHostMemory writes data to host-resident unified memory.
+func (m *defaultMemoryCopyMiddleware) writeHostMemory(
+	pAddr uint64,
+	data []byte,
+) {
+	m.driver.mustHaveGlobalStorage()
+
+	err := m.driver.globalStorage.Write(pAddr, data)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// readHostMemory reads data from host-resident unified memory.
+func (m *defaultMemoryCopyMiddleware) readHostMemory(
+	pAddr uint64,
+	buf []byte,
+) {
+	m.driver.mustHaveGlobalStorage()
+
+	data, err := m.driver.globalStorage.Read(pAddr, uint64(len(buf)))
+	if err != nil {
+		panic(err)
+	}
+
+	copy(buf, data)
+}
+
 func (m *defaultMemoryCopyMiddleware) needFlushing(
 	ctx *Context,
 	vAddr Ptr,
@@ -183,7 +406,7 @@ func (m *defaultMemoryCopyMiddleware) sendFlushRequest(
 }
 
 func (m *defaultMemoryCopyMiddleware) Tick() (madeProgress bool) {
-	madeProgress = false
+	madeProgress = m.tickHostCopies()
 
 	if m.cyclesLeft > 0 {
 		m.cyclesLeft--
@@ -214,6 +437,10 @@ func (m *defaultMemoryCopyMiddleware) processGeneralRsp(
 	madeProgress := false
 	originalReq := rsp.OriginalReq
 
+	if m.driver.isUnifiedMemoryTransfer(originalReq) {
+		return false
+	}
+
 	switch originalReq := originalReq.(type) {
 	case *protocol.FlushReq:
 		madeProgress = m.processFlushReturn(originalReq)
@@ -221,6 +448,8 @@ func (m *defaultMemoryCopyMiddleware) processGeneralRsp(
 		madeProgress = m.processMemCopyH2DReturn(originalReq)
 	case *protocol.MemCopyD2HReq:
 		madeProgress = m.processMemCopyD2HReturn(originalReq)
+	case *protocol.MemCopyD2DReq:
+		madeProgress = m.processMemCopyD2DReturn(originalReq)
 	}
 
 	return madeProgress
@@ -244,12 +473,7 @@ func (m *defaultMemoryCopyMiddleware) processMemCopyH2DReturn(
 	}
 	copyCmd.Reqs = newReqs
 
-	if len(copyCmd.Reqs) == 0 {
-		cmdQueue.IsRunning = false
-		cmdQueue.Dequeue()
-
-		m.driver.logCmdComplete(cmd)
-	}
+	m.completeCopyIfDone(copyCmd, cmdQueue)
 
 	return true
 }
@@ -266,18 +490,7 @@ func (m *defaultMemoryCopyMiddleware) processMemCopyD2HReturn(
 	copyCmd := cmd.(*MemCopyD2HCommand)
 	copyCmd.RemoveReq(req)
 
-	if len(copyCmd.Reqs) == 0 {
-		cmdQueue.IsRunning = false
-		buf := bytes.NewReader(copyCmd.RawData)
-		err := binary.Read(buf, binary.LittleEndian, copyCmd.Dst)
-		if err != nil {
-			panic(err)
-		}
-
-		cmdQueue.Dequeue()
-
-		m.driver.logCmdComplete(copyCmd)
-	}
+	m.completeCopyIfDone(copyCmd, cmdQueue)
 
 	return true
 }
@@ -289,11 +502,13 @@ func (m *defaultMemoryCopyMiddleware) processFlushReturn(
 
 	m.driver.logTaskToGPUClear(req)
 
-	cmd, _ := m.driver.findCommandByReq(req)
+	cmd, cmdQueue := m.driver.findCommandByReq(req)
 
 	cmd.RemoveReq(req)
 
 	m.driver.logTaskToGPUClear(req)
 
+	m.completeCopyIfDone(cmd, cmdQueue)
+
 	return true
 }
@@ -2,9 +2,133 @@ package driver
 
 import (
 	"github.com/onsi/ginkgo/v2"
-	// . "github.com/onsi/gomega"
+	. "github.com/onsi/gomega"
+	"github.com/sarchlab/akita/v4/mem/mem"
+	"github.com/sarchlab/akita/v4/mem/vm"
+	"github.com/sarchlab/akita/v4/sim"
+	"github.com/sarchlab/mgpusim/v4/amd/protocol"
+	"go.uber.org/mock/gomock"
 )
 
 var _ = ginkgo.Describe("Defaultmemorycopymiddleware", func() {
+	var (
+		mockCtrl   *gomock.Controller
+		gpu1, gpu2 *MockPort
+		driver     *Driver
+		middleware *defaultMemoryCopyMiddleware
+		context    *Context
+		queue      *CommandQueue
+	)
 
+	ginkgo.BeforeEach(func() {
+		mockCtrl = gomock.NewController(ginkgo.GinkgoT())
+		gpu1 = NewMockPort(mockCtrl)
+		gpu2 = NewMockPort(mockCtrl)
+		gpu1.EXPECT().AsRemote().Return(sim.RemotePort("GPU1")).AnyTimes()
+		gpu2.EXPECT().AsRemote().Return(sim.RemotePort("GPU2")).AnyTimes()
+
+		driver = MakeBuilder().
+			WithLog2PageSize(12).
+			WithPageTable(vm.NewPageTable(12)).
+			WithGlobalStorage(mem.NewStorage(12 * mem.GB)).
+			Build("Driver")
+		driver.RegisterGPU(gpu1, DeviceProperties{
+			CUCount:  4,
+			DRAMSize: 4 * mem.GB,
+		})
+		driver.RegisterGPU(gpu2, DeviceProperties{
+			CUCount:  4,
+			DRAMSize: 4 * mem.GB,
+		})
+		middleware = driver.middlewares[0].(*defaultMemoryCopyMiddleware)
+
+		context = driver.Init()
+		context.pid = 1
+		queue = driver.CreateCommandQueue(context)
+	})
+
+	ginkgo.AfterEach(func() {
+		mockCtrl.Finish()
+	})
+
+	ginkgo.It("should let the DMA engine of the source GPU copy", func() {
+		driver.SelectGPU(context, 1)
+		src := driver.AllocateMemory(context, 64)
+		driver.SelectGPU(context, 2)
+		dst := driver.AllocateMemory(context, 64)
+
+		driver.EnqueueMemCopyD2D(queue, dst, src, 64)
+		cmd := queue.Peek().(*MemCopyD2DCommand)
+
+		middleware.ProcessCommand(cmd, queue)
+
+		srcPAddr, _ := driver.translate(context, uint64(src))
+		dstPAddr, _ := driver.translate(context, uint64(dst))
+		Expect(cmd.Reqs).To(HaveLen(1))
+		req := cmd.Reqs[0].(*protocol.MemCopyD2DReq)
+		Expect(req.Dst).To(Equal(gpu1.AsRemote()))
+		Expect(req.SrcAddress).To(Equal(srcPAddr))
+		Expect(req.DstAddress).To(Equal(dstPAddr))
+		Expect(req.ByteSize).To(Equal(uint64(64)))
+		Expect(queue.IsRunning).To(BeTrue())
+	})
+
+	ginkgo.It("should split the copy at the page boundaries", func() {
+		driver.SelectGPU(context, 1)
+		src := driver.AllocateMemory(context, 8192)
+		dst := driver.AllocateMemory(context, 8192)
+
+		driver.EnqueueMemCopyD2D(queue, dst+16, src, 4096)
+		cmd := queue.Peek().(*MemCopyD2DCommand)
+
+		middleware.ProcessCommand(cmd, queue)
+
+		Expect(cmd.Reqs).To(HaveLen(2))
+		Expect(cmd.Reqs[0].(*protocol.MemCopyD2DReq).ByteSize).
+			To(Equal(uint64(4080)))
+		Expect(cmd.Reqs[1].(*protocol.MemCopyD2DReq).ByteSize).
+			To(Equal(uint64(16)))
+	})
+
+	ginkgo.It("should complete the command when the copies return", func() {
+		driver.SelectGPU(context, 1)
+		src := driver.AllocateMemory(context, 64)
+		dst := driver.AllocateMemory(context, 64)
+		driver.EnqueueMemCopyD2D(queue, dst, src, 64)
+		cmd := queue.Peek().(*MemCopyD2DCommand)
+		middleware.ProcessCommand(cmd, queue)
+
+		rsp := sim.GeneralRspBuilder{}.
+			WithOriginalReq(cmd.Reqs[0]).
+			Build()
+		toGPUs := NewMockPort(mockCtrl)
+		toGPUs.EXPECT().RetrieveIncoming()
+		driver.gpuPort = toGPUs
+
+		middleware.processGeneralRsp(rsp)
+
+		Expect(cmd.Reqs).To(BeEmpty())
+		Expect(queue.IsRunning).To(BeFalse())
+		Expect(queue.Peek()).To(BeNil())
+	})
+
+	ginkgo.It("should copy within the host memory without the GPUs", func() {
+		src := driver.AllocateHostMemory(context, 4, true)
+		dst := driver.AllocateHostMemory(context, 4, true)
+		driver.writeVirtualMemory(context, uint64(src), []byte{1, 2, 3, 4})
+		driver.EnqueueMemCopyD2D(queue, dst, src, 4)
+		cmd := queue.Peek().(*MemCopyD2DCommand)
+
+		middleware.ProcessCommand(cmd, queue)
+
+		Expect(cmd.Reqs).To(BeEmpty())
+
+		for i := 0; i < 10 && queue.Peek() != nil; i++ {
+			middleware.Tick()
+		}
+
+		Expect(queue.Peek()).To(BeNil())
+		Expect(driver.readVirtualMemory(context, uint64(dst), 4)).
+			To(Equal([]byte{1, 2, 3, 4}))
+	})
 })
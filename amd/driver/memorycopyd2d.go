@@ -0,0 +1,86 @@
+package driver
+
+import (
+	"github.com/sarchlab/mgpusim/v4/amd/protocol"
+)
+
+// processMemCopyD2DCommand lets the DMA engines copy the data. A piece of data
+// is copied by the GPU that holds the source, or by the GPU that holds the
+// destination if the source is in the host memory. The DMA engine reaches the
+// memory of the other device through RDMA.
+func (m *defaultMemoryCopyMiddleware) processMemCopyD2DCommand(
+	cmd *MemCopyD2DCommand,
+	queue *CommandQueue,
+) bool {
+	ctx := queue.Context
+	m.driver.touchUnifiedPages(ctx.pid, uint64(cmd.Src), cmd.ByteSize)
+	m.driver.touchUnifiedPages(ctx.pid, uint64(cmd.Dst), cmd.ByteSize)
+
+	offset := uint64(0)
+	hostBytes := uint64(0)
+	var copyHostData []func()
+	for offset < cmd.ByteSize {
+		srcPAddr, srcSizeInPage := m.driver.translate(ctx, uint64(cmd.Src)+offset)
+		dstPAddr, dstSizeInPage := m.driver.translate(ctx, uint64(cmd.Dst)+offset)
+		sizeToCopy := min(cmd.ByteSize-offset, srcSizeInPage, dstSizeInPage)
+		offset += sizeToCopy
+
+		gpuID := m.driver.memAllocator.GetDeviceIDByPAddr(srcPAddr)
+		if gpuID == 0 {
+			gpuID = m.driver.memAllocator.GetDeviceIDByPAddr(dstPAddr)
+		}
+
+		if gpuID == 0 {
+			copyHostData = append(copyHostData, func() {
+				data := make([]byte, sizeToCopy)
+				m.readHostMemory(srcPAddr, data)
+				m.writeHostMemory(dstPAddr, data)
+			})
+			hostBytes += sizeToCopy
+
+			continue
+		}
+
+		req := protocol.NewMemCopyD2DReq(
+			m.driver.gpuPort, m.driver.GPUs[gpuID-1],
+			srcPAddr, dstPAddr, sizeToCopy)
+		cmd.Reqs = append(cmd.Reqs, req)
+		m.awaitingReqs = append(m.awaitingReqs, req)
+
+		m.driver.logTaskToGPUInitiate(cmd, req)
+	}
+
+	hasGPUReqs := len(cmd.Reqs) > 0
+
+	if m.needFlushing(ctx, cmd.Src, cmd.ByteSize) ||
+		m.needFlushing(ctx, cmd.Dst, cmd.ByteSize) {
+		m.sendFlushRequest(cmd)
+	}
+
+	if hasGPUReqs {
+		m.cyclesLeft = 0
+	}
+
+	queue.IsRunning = true
+	m.startHostCopy(cmd, queue, 0, hostBytes, copyHostData)
+	m.completeCopyIfDone(cmd, queue)
+
+	return true
+}
+
+func (m *defaultMemoryCopyMiddleware) processMemCopyD2DReturn(
+	req *protocol.MemCopyD2DReq,
+) bool {
+	m.driver.gpuPort.RetrieveIncoming()
+
+	m.driver.logTaskToGPUClear(req)
+
+	cmd, cmdQueue := m.driver.findCommandByReq(req)
+
+	copyCmd := cmd.(*MemCopyD2DCommand)
+	copyCmd.RemoveReq(req)
+
+	m.completeCopyIfDone(copyCmd, cmdQueue)
+
+	return true
+}
@@ -1,10 +1,5 @@
 package driver
 
-import (
-	"bytes"
-	"encoding/binary"
-)
-
 // defaultMemoryCopyMiddleware handles memory copy commands and related
 // communication.
 type globalStorageMemoryCopyMiddleware struct {
@@ -20,6 +15,8 @@ func (m *globalStorageMemoryCopyMiddleware) ProcessCommand(
 		return m.processMemCopyH2DCommand(cmd, queue)
 	case *MemCopyD2HCommand:
 		return m.processMemCopyD2HCommand(cmd, queue)
+	case *MemCopyD2DCommand:
+		return m.processMemCopyD2DCommand(cmd, queue)
 	}
 
 	return false
@@ -29,12 +26,7 @@ func (m *globalStorageMemoryCopyMiddleware) processMemCopyH2DCommand(
 	cmd *MemCopyH2DCommand,
 	queue *CommandQueue,
 ) bool {
-	buffer := bytes.NewBuffer(nil)
-	err := binary.Write(buffer, binary.LittleEndian, cmd.Src)
-	if err != nil {
-		panic(err)
-	}
-	rawBytes := buffer.Bytes()
+	rawBytes := m.driver.copySrcBytes(queue.Context, cmd.Src)
 
 	offset := uint64(0)
 	addr := uint64(cmd.Dst)
@@ -69,7 +61,7 @@ func (m *globalStorageMemoryCopyMiddleware) processMemCopyD2HCommand(
 	cmd *MemCopyD2HCommand,
 	queue *CommandQueue,
 ) bool {
-	cmd.RawData = make([]byte, binary.Size(cmd.Dst))
+	cmd.RawData = make([]byte, copyDstByteSize(cmd.Dst))
 
 	offset := uint64(0)
 	addr := uint64(cmd.Src)
@@ -95,11 +87,20 @@ func (m *globalStorageMemoryCopyMiddleware) processMemCopyD2HCommand(
 		offset += sizeToCopy
 	}
 
-	buf := bytes.NewReader(cmd.RawData)
-	err := binary.Read(buf, binary.LittleEndian, cmd.Dst)
-	if err != nil {
-		panic(err)
-	}
+	m.driver.storeCopyDst(queue.Context, cmd.Dst, cmd.RawData)
+
+	queue.IsRunning = false
+	queue.Dequeue()
+	return true
+}
+
+func (m *globalStorageMemoryCopyMiddleware) processMemCopyD2DCommand(
+	cmd *MemCopyD2DCommand,
+	queue *CommandQueue,
+) bool {
+	data := m.driver.readVirtualMemory(
+		queue.Context, uint64(cmd.Src), cmd.ByteSize)
+	m.driver.writeVirtualMemory(queue.Context, uint64(cmd.Dst), data)
 
 	queue.IsRunning = false
 	queue.Dequeue()
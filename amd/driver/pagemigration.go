@@ -0,0 +1,169 @@
+package driver
+
+import (
+	"github.com/sarchlab/akita/v4/mem/vm"
+	"github.com/sarchlab/mgpusim/v4/amd/driver/internal"
+)
+
+// A pageMigration is a page that moves to a GPU in the current migration
+// epoch. The page is requested by the MMU, brought in by the prefetcher, or
+// asked for by the access counters.
+type pageMigration struct {
+	page             internal.PageID
+	fromDeviceID     uint64
+	toDeviceID       uint64
+	prefetched       bool
+	counterTriggered bool
+}
+
+// planPageMigrations decides the pages to move in the current migration epoch.
+// The pages that the MMU requests are followed by the pages that the
+// prefetcher selects and the pages that the access counters ask for.
+func (d *Driver) planPageMigrations() {
+	d.currentPageMigrations = nil
+	planned := make(map[internal.PageID]bool)
+
+	for _, req := range d.currentPageMigrationReqs {
+		migrationInfo := req.MigrationInfo
+
+		for i := 1; i < d.GetNumGPUs()+1; i++ {
+			vAddrs, found := migrationInfo.GPUReqToVAddrMap[uint64(i)]
+			if !found {
+				continue
+			}
+
+			for _, vAddr := range vAddrs {
+				page := internal.PageID{PID: req.PID, VAddr: vAddr}
+				if planned[page] {
+					continue
+				}
+
+				planned[page] = true
+				d.currentPageMigrations = append(d.currentPageMigrations,
+					&pageMigration{
+						page:         page,
+						fromDeviceID: req.CurrPageHostGPU,
+						toDeviceID:   uint64(i),
+					})
+			}
+		}
+	}
+
+	numDemandMigrations := len(d.currentPageMigrations)
+
+	for _, p := range d.currentPrefetches {
+		d.planPrefetchCommand(p, planned)
+	}
+
+	for i := 0; i < numDemandMigrations; i++ {
+		d.planPrefetches(d.currentPageMigrations[i], planned)
+	}
+
+	d.planCounterMigrations(planned)
+}
+
+// planPrefetchCommand moves the pages that a prefetch command asks for. Unlike
+// the pages that the prefetcher selects, pinned pages are also moved.
+func (d *Driver) planPrefetchCommand(
+	p *queuedPrefetch,
+	planned map[internal.PageID]bool,
+) {
+	toDeviceID := uint64(p.cmd.GPUID)
+
+	for _, pageID := range p.pages {
+		if planned[pageID] {
+			continue
+		}
+
+		page, found := d.pageTable.Find(pageID.PID, pageID.VAddr)
+		if !found || page.IsMigrating || page.DeviceID == toDeviceID {
+			continue
+		}
+
+		planned[pageID] = true
+		d.currentPageMigrations = append(d.currentPageMigrations,
+			&pageMigration{
+				page:         pageID,
+				fromDeviceID: page.DeviceID,
+				toDeviceID:   toDeviceID,
+				prefetched:   true,
+			})
+	}
+}
+
+func (d *Driver) planPrefetches(
+	m *pageMigration,
+	planned map[internal.PageID]bool,
+) {
+	pid := m.page.PID
+
+	isResident := func(vAddr uint64) bool {
+		page, found := d.pageTable.Find(pid, vAddr)
+		return found && page.DeviceID == m.toDeviceID
+	}
+
+	for _, vAddr := range d.migrationPrefetcher.Prefetch(
+		m.page.VAddr, isResident) {
+		pageID := internal.PageID{PID: pid, VAddr: vAddr}
+		if planned[pageID] {
+			continue
+		}
+
+		page, found := d.pageTable.Find(pid, vAddr)
+		if !found || !canPrefetch(page, m.toDeviceID) ||
+			d.isPreferredElsewhere(pageID, m.toDeviceID) {
+			continue
+		}
+
+		planned[pageID] = true
+		d.currentPageMigrations = append(d.currentPageMigrations,
+			&pageMigration{
+				page:         pageID,
+				fromDeviceID: page.DeviceID,
+				toDeviceID:   m.toDeviceID,
+				prefetched:   true,
+			})
+	}
+}
+
+// canPrefetch checks if a page can be moved to a device without the MMU
+// asking for it. Only the pages that the MMU is free to migrate are
+// prefetched.
+func canPrefetch(page vm.Page, toDeviceID uint64) bool {
+	return page.Valid &&
+		page.Unified &&
+		!page.IsMigrating &&
+		!page.IsPinned &&
+		page.DeviceID != toDeviceID
+}
+
+// finishPrefetchedPages marks the prefetched pages and the pages that the
+// access counters ask for as accessible again. The MMU does the same for the
+// pages that it requests.
+func (d *Driver) finishPrefetchedPages() {
+	for _, m := range d.currentPageMigrations {
+		if !m.prefetched && !m.counterTriggered {
+			continue
+		}
+
+		page, found := d.pageTable.Find(m.page.PID, m.page.VAddr)
+		if !found {
+			panic("page not found")
+		}
+
+		page.IsMigrating = false
+		d.pageTable.Update(page)
+	}
+}
+
+// isPlannedForMigration checks if a page moves in the current migration
+// epoch.
+func (d *Driver) isPlannedForMigration(page internal.PageID) bool {
+	for _, m := range d.currentPageMigrations {
+		if m.page == page {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,228 @@
+package driver
+
+import (
+	"github.com/sarchlab/akita/v4/sim"
+	"github.com/sarchlab/mgpusim/v4/amd/protocol"
+)
+
+// A PreemptionMode determines how a preempted kernel releases the CUs.
+type PreemptionMode = protocol.PreemptionMode
+
+// The supported preemption modes.
+const (
+	// PreemptionModeDrain lets the running work-groups complete.
+	PreemptionModeDrain = protocol.PreemptionModeDrain
+
+	// PreemptionModeSaveState saves the VGPRs, SGPRs, and LDS of the running
+	// work-groups to memory, so that the CUs are released sooner.
+	PreemptionModeSaveState = protocol.PreemptionModeSaveState
+)
+
+// maxWavefrontsPerCU is the number of wavefronts that a CU can hold. It bounds
+// the number of work-groups that a preemption saves.
+const maxWavefrontsPerCU = 40
+
+// EnqueuePreemptKernel registers a PreemptKernelCommand in the queue. When the
+// command is processed, the kernel that the target queue is running is
+// preempted. The command completes when the GPUs release the CUs that the
+// kernel uses. If the target queue is not running a kernel, the command
+// completes immediately. Cooperative kernels are not preempted.
+//
+// In the save-state mode, the driver allocates a context-save area on each
+// GPU that runs the kernel, and the CUs write the state of the running
+// work-groups there through the memory hierarchy. The areas are freed when the
+// kernel completes.
+func (d *Driver) EnqueuePreemptKernel(
+	queue *CommandQueue,
+	target *CommandQueue,
+	mode PreemptionMode,
+) *PreemptKernelCommand {
+	cmd := &PreemptKernelCommand{
+		ID:     sim.GetIDGenerator().Generate(),
+		Target: target,
+		Mode:   mode,
+	}
+	d.Enqueue(queue, cmd)
+
+	return cmd
+}
+
+// EnqueueResumeKernel registers a ResumeKernelCommand in the queue. When the
+// command is processed, the preempted kernel of the target queue continues.
+func (d *Driver) EnqueueResumeKernel(
+	queue *CommandQueue,
+	target *CommandQueue,
+) {
+	cmd := &ResumeKernelCommand{
+		ID:     sim.GetIDGenerator().Generate(),
+		Target: target,
+	}
+	d.Enqueue(queue, cmd)
+}
+
+// runningKernelReqs returns the LaunchKernelReqs of the kernel that the queue
+// is running.
+func runningKernelReqs(queue *CommandQueue) []*protocol.LaunchKernelReq {
+	if !queue.IsRunning {
+		return nil
+	}
+
+	cmd := queue.Peek()
+	if cmd == nil {
+		return nil
+	}
+
+	reqs := make([]*protocol.LaunchKernelReq, 0)
+	for _, r := range cmd.GetReqs() {
+		if req, ok := r.(*protocol.LaunchKernelReq); ok {
+			reqs = append(reqs, req)
+		}
+	}
+
+	return reqs
+}
+
+func (d *Driver) processPreemptKernelCommand(
+	cmd *PreemptKernelCommand,
+	queue *CommandQueue,
+) bool {
+	kernelReqs := runningKernelReqs(cmd.Target)
+	if len(kernelReqs) == 0 {
+		queue.Dequeue()
+		d.logCmdComplete(cmd)
+
+		return true
+	}
+
+	for _, kernelReq := range kernelReqs {
+		req := protocol.NewPreemptKernelReq(
+			d.gpuPort.AsRemote(), kernelReq.Dst, kernelReq.ID, cmd.Mode)
+
+		if cmd.Mode == PreemptionModeSaveState && !kernelReq.Cooperative {
+			d.allocateContextSaveArea(req, kernelReq)
+		}
+
+		cmd.AddReq(req)
+		d.requestsToSend = append(d.requestsToSend, req)
+		d.logTaskToGPUInitiate(cmd, req)
+	}
+
+	queue.IsRunning = true
+
+	return true
+}
+
+// allocateContextSaveArea allocates the memory that the GPU saves the state of
+// the running work-groups of the kernel to. The area can hold as many
+// work-groups as the CUs of the GPU can run at the same time.
+func (d *Driver) allocateContextSaveArea(
+	req *protocol.PreemptKernelReq,
+	kernelReq *protocol.LaunchKernelReq,
+) {
+	gpuID := d.gpuIDOfPort(kernelReq.Dst)
+	numCUs := d.devices[gpuID].Properties.CUCount
+
+	packet := kernelReq.Packet
+	wgSize := int(packet.WorkgroupSizeX) *
+		int(packet.WorkgroupSizeY) *
+		int(packet.WorkgroupSizeZ)
+	numWfsPerWG := (wgSize-1)/64 + 1
+
+	numWGs := numCUs * maxWavefrontsPerCU / numWfsPerWG
+	if numWGs == 0 {
+		numWGs = 1
+	}
+
+	byteSize := uint64(numWGs) *
+		protocol.WGContextByteSize(kernelReq.HsaCo, packet)
+	ptr := d.memAllocator.Allocate(kernelReq.PID, byteSize, gpuID)
+
+	req.ContextSaveArea = ptr
+	req.ContextSaveAreaSize = byteSize
+	d.contextSaveAreas[kernelReq.ID] =
+		append(d.contextSaveAreas[kernelReq.ID], ptr)
+}
+
+func (d *Driver) gpuIDOfPort(port sim.RemotePort) int {
+	for i, gpu := range d.GPUs {
+		if gpu.AsRemote() == port {
+			return i + 1
+		}
+	}
+
+	panic("the request is not sent to a GPU")
+}
+
+// freeContextSaveAreas frees the context-save areas of a kernel that
+// completes.
+func (d *Driver) freeContextSaveAreas(kernelReqID string) {
+	for _, ptr := range d.contextSaveAreas[kernelReqID] {
+		d.memAllocator.Free(ptr)
+	}
+
+	delete(d.contextSaveAreas, kernelReqID)
+}
+
+func (d *Driver) processResumeKernelCommand(
+	cmd *ResumeKernelCommand,
+	queue *CommandQueue,
+) bool {
+	kernelReqs := runningKernelReqs(cmd.Target)
+	if len(kernelReqs) == 0 {
+		queue.Dequeue()
+		d.logCmdComplete(cmd)
+
+		return true
+	}
+
+	for _, kernelReq := range kernelReqs {
+		req := protocol.NewResumeKernelReq(
+			d.gpuPort.AsRemote(), kernelReq.Dst, kernelReq.ID)
+		cmd.AddReq(req)
+		d.requestsToSend = append(d.requestsToSend, req)
+		d.logTaskToGPUInitiate(cmd, req)
+	}
+
+	queue.IsRunning = true
+
+	return true
+}
+
+func (d *Driver) processPreemptKernelRsp(
+	rsp *protocol.PreemptKernelRsp,
+) bool {
+	req, cmd, queue := d.findCommandByReqID(rsp.RspTo)
+	preemptCmd := cmd.(*PreemptKernelCommand)
+	preemptCmd.Preempted = preemptCmd.Preempted || rsp.Preempted
+	preemptCmd.SavedByteSize += rsp.SavedByteSize
+
+	d.completeReqOfCommand(req, cmd, queue)
+
+	return true
+}
+
+func (d *Driver) processResumeKernelRsp(
+	rsp *protocol.ResumeKernelRsp,
+) bool {
+	req, cmd, queue := d.findCommandByReqID(rsp.RspTo)
+
+	d.completeReqOfCommand(req, cmd, queue)
+
+	return true
+}
+
+func (d *Driver) completeReqOfCommand(
+	req sim.Msg,
+	cmd Command,
+	queue *CommandQueue,
+) {
+	cmd.RemoveReq(req)
+	d.logTaskToGPUClear(req)
+
+	if len(cmd.GetReqs()) == 0 {
+		queue.IsRunning = false
+		queue.Dequeue()
+
+		d.logCmdComplete(cmd)
+	}
+}
@@ -0,0 +1,91 @@
+package driver
+
+import (
+	"github.com/sarchlab/mgpusim/v4/amd/driver/internal"
+)
+
+// A queuedPrefetch is a prefetch command that waits for a migration epoch to
+// move its pages.
+type queuedPrefetch struct {
+	cmd   *PrefetchCommand
+	queue *CommandQueue
+	pages []internal.PageID
+}
+
+// prefetchMiddleware handles the prefetch commands. The pages are moved by the
+// driver's page migration pipeline, together with the page migration requests
+// from the MMU.
+type prefetchMiddleware struct {
+	driver *Driver
+}
+
+func (m *prefetchMiddleware) ProcessCommand(
+	cmd Command,
+	queue *CommandQueue,
+) (processed bool) {
+	prefetchCmd, ok := cmd.(*PrefetchCommand)
+	if !ok {
+		return false
+	}
+
+	pages := m.pagesToMove(queue.Context, prefetchCmd)
+	if len(pages) == 0 {
+		queue.Dequeue()
+		return true
+	}
+
+	m.driver.pendingPrefetches = append(m.driver.pendingPrefetches,
+		&queuedPrefetch{
+			cmd:   prefetchCmd,
+			queue: queue,
+			pages: pages,
+		})
+	queue.IsRunning = true
+
+	return true
+}
+
+// pagesToMove returns the unified memory pages in the range of the command
+// that are not on the destination GPU yet.
+func (m *prefetchMiddleware) pagesToMove(
+	ctx *Context,
+	cmd *PrefetchCommand,
+) []internal.PageID {
+	log2PageSize := m.driver.Log2PageSize
+	pageSize := uint64(1) << log2PageSize
+	startAddr := uint64(cmd.Ptr) >> log2PageSize << log2PageSize
+	endAddr := uint64(cmd.Ptr) + cmd.ByteSize
+
+	pages := make([]internal.PageID, 0)
+	for addr := startAddr; addr < endAddr; addr += pageSize {
+		page, found := m.driver.pageTable.Find(ctx.pid, addr)
+		if !found {
+			panic("page not found")
+		}
+
+		if !page.Unified || page.DeviceID == uint64(cmd.GPUID) {
+			continue
+		}
+
+		pages = append(pages, internal.PageID{PID: ctx.pid, VAddr: addr})
+	}
+
+	return pages
+}
+
+func (m *prefetchMiddleware) Tick() (madeProgress bool) {
+	return false
+}
+
+// completePrefetches finishes the prefetch commands served by the current
+// migration epoch.
+func (d *Driver) completePrefetches() {
+	for _, p := range d.currentPrefetches {
+		p.queue.IsRunning = false
+		p.queue.Dequeue()
+
+		d.logCmdComplete(p.cmd)
+	}
+
+	d.currentPrefetches = nil
+}
@@ -0,0 +1,272 @@
+package driver
+
+import (
+	"github.com/sarchlab/akita/v4/mem/vm"
+	"github.com/sarchlab/akita/v4/sim"
+	"github.com/sarchlab/mgpusim/v4/amd/driver/internal"
+	"github.com/sarchlab/mgpusim/v4/amd/protocol"
+)
+
+// An evictionVictim is a unified memory page that is moved from a GPU back to
+// the host to make room for the pages that are migrating to the GPU.
+type evictionVictim struct {
+	page     internal.PageID
+	deviceID int
+}
+
+// A unifiedMemoryTransfer is a page copy between the host and a GPU. The copy
+// is carried out by the DMA engine of the GPU.
+type unifiedMemoryTransfer struct {
+	req      sim.Msg
+	oldPAddr uint64
+	newPAddr uint64
+}
+
+// trackUnifiedPages records the unified memory pages that are allocated on a
+// GPU so that they can be considered for eviction.
+func (d *Driver) trackUnifiedPages(
+	pid vm.PID,
+	vAddr, byteSize uint64,
+	deviceID int,
+) {
+	d.unifiedMemoryMutex.Lock()
+	defer d.unifiedMemoryMutex.Unlock()
+
+	resident, found := d.residentUnifiedPages[deviceID]
+	if !found {
+		return
+	}
+
+	pageSize := uint64(1) << d.Log2PageSize
+	for addr := vAddr; addr < vAddr+byteSize; addr += pageSize {
+		resident.Insert(internal.PageID{PID: pid, VAddr: addr})
+	}
+}
+
+// untrackUnifiedPages stops considering the pages in the given range for
+// eviction.
+func (d *Driver) untrackUnifiedPages(pid vm.PID, vAddr, byteSize uint64) {
+	d.unifiedMemoryMutex.Lock()
+	defer d.unifiedMemoryMutex.Unlock()
+
+	pageSize := uint64(1) << d.Log2PageSize
+	for addr := vAddr; addr < vAddr+byteSize; addr += pageSize {
+		for _, resident := range d.residentUnifiedPages {
+			resident.Remove(internal.PageID{PID: pid, VAddr: addr})
+		}
+	}
+}
+
+// touchUnifiedPages marks the pages in the given range as recently used.
+func (d *Driver) touchUnifiedPages(pid vm.PID, vAddr, byteSize uint64) {
+	d.unifiedMemoryMutex.Lock()
+	defer d.unifiedMemoryMutex.Unlock()
+
+	pageSize := uint64(1) << d.Log2PageSize
+	startAddr := vAddr >> d.Log2PageSize << d.Log2PageSize
+	for addr := startAddr; addr < vAddr+byteSize; addr += pageSize {
+		for _, resident := range d.residentUnifiedPages {
+			resident.Touch(internal.PageID{PID: pid, VAddr: addr})
+		}
+	}
+}
+
+func (d *Driver) moveUnifiedPage(
+	page internal.PageID,
+	fromDeviceID, toDeviceID int,
+) {
+	d.unifiedMemoryMutex.Lock()
+	defer d.unifiedMemoryMutex.Unlock()
+
+	if resident, found := d.residentUnifiedPages[fromDeviceID]; found {
+		resident.Remove(page)
+	}
+
+	if resident, found := d.residentUnifiedPages[toDeviceID]; found {
+		resident.Insert(page)
+	}
+}
+
+func (d *Driver) unifiedMemoryCapacityInPages(deviceID int) int {
+	capacity := d.unifiedMemoryCapacity
+	if capacity == 0 {
+		capacity = d.devices[deviceID].Properties.DRAMSize
+	}
+
+	return int(capacity >> d.Log2PageSize)
+}
+
+// selectEvictionVictims decides which pages to evict so that the GPUs that
+// receive the migrating pages do not exceed their unified memory capacity.
+func (d *Driver) selectEvictionVictims() {
+	d.unifiedMemoryMutex.Lock()
+	defer d.unifiedMemoryMutex.Unlock()
+
+	d.evictionVictims = nil
+
+	numIncoming := make(map[uint64]int)
+	for _, m := range d.currentPageMigrations {
+		numIncoming[m.toDeviceID]++
+	}
+
+	for i := 1; i < d.GetNumGPUs()+1; i++ {
+		if numIncoming[uint64(i)] == 0 {
+			continue
+		}
+
+		d.selectEvictionVictimsOnDevice(i, numIncoming[uint64(i)])
+	}
+}
+
+func (d *Driver) selectEvictionVictimsOnDevice(deviceID, numIncoming int) {
+	resident := d.residentUnifiedPages[deviceID]
+	numToEvict := resident.Len() + numIncoming -
+		d.unifiedMemoryCapacityInPages(deviceID)
+
+	for _, candidate := range resident.Candidates() {
+		if numToEvict <= 0 {
+			return
+		}
+
+		page, found := d.pageTable.Find(candidate.PID, candidate.VAddr)
+		if !found || page.DeviceID != uint64(deviceID) {
+			resident.Remove(candidate)
+			continue
+		}
+
+		// A pinned page may be mapped by the other GPUs. Evicting it would
+		// leave their TLBs pointing at the freed physical page.
+		if page.IsMigrating || page.IsPinned ||
+			d.isPlannedForMigration(candidate) ||
+			d.isOnPreferredLocation(candidate, deviceID) {
+			continue
+		}
+
+		d.evictionVictims = append(d.evictionVictims, evictionVictim{
+			page:     candidate,
+			deviceID: deviceID,
+		})
+		numToEvict--
+	}
+}
+
+// gpusInvolvedInMigration returns the IDs of the GPUs that need to be paused
+// during the current page migration.
+func (d *Driver) gpusInvolvedInMigration() []uint64 {
+	gpus := make([]uint64, 0)
+	added := make(map[uint64]bool)
+
+	add := func(deviceID uint64) {
+		if deviceID == 0 || added[deviceID] {
+			return
+		}
+
+		added[deviceID] = true
+		gpus = append(gpus, deviceID)
+	}
+
+	for _, req := range d.currentPageMigrationReqs {
+		for _, gpuID := range req.CurrAccessingGPUs {
+			add(gpuID)
+		}
+	}
+
+	for _, m := range d.currentPageMigrations {
+		if m.prefetched || m.counterTriggered {
+			add(m.fromDeviceID)
+		}
+	}
+
+	if len(d.currentPrefetches) > 0 || len(d.currentCounterMigrations) > 0 {
+		// The pages that a prefetch command moves may be pinned, and the
+		// pages that the access counters ask for are accessed remotely. Any
+		// GPU may be accessing these pages remotely.
+		for i := 1; i < d.GetNumGPUs()+1; i++ {
+			add(uint64(i))
+		}
+	}
+
+	for _, victim := range d.evictionVictims {
+		add(uint64(victim.deviceID))
+	}
+
+	return gpus
+}
+
+func (d *Driver) mustHaveGlobalStorage() {
+	if d.globalStorage == nil {
+		panic("host-resident unified memory requires the global storage")
+	}
+}
+
+// migratePageFromHost copies a page from the host memory to a GPU.
+func (d *Driver) migratePageFromHost(
+	page *vm.Page,
+	oldPAddr uint64,
+	deviceID uint64,
+) {
+	d.mustHaveGlobalStorage()
+
+	data, err := d.globalStorage.Read(oldPAddr, page.PageSize)
+	if err != nil {
+		panic(err)
+	}
+
+	req := protocol.NewMemCopyH2DReq(
+		d.gpuPort, d.GPUs[deviceID-1], data, page.PAddr)
+	d.unifiedMemoryTransfers[req.ID] = &unifiedMemoryTransfer{
+		req:      req,
+		oldPAddr: oldPAddr,
+		newPAddr: page.PAddr,
+	}
+
+	d.requestsToSend = append(d.requestsToSend, req)
+}
+
+// evictPage moves a page from a GPU back to the host memory.
+func (d *Driver) evictPage(victim evictionVictim) {
+	d.mustHaveGlobalStorage()
+
+	page, found := d.pageTable.Find(victim.page.PID, victim.page.VAddr)
+	if !found {
+		panic("page not found")
+	}
+
+	hostPage := d.memAllocator.AllocatePageWithGivenVAddr(
+		victim.page.PID, 0, victim.page.VAddr, true)
+	d.moveUnifiedPage(victim.page, victim.deviceID, 0)
+
+	req := protocol.NewMemCopyD2HReq(
+		d.gpuPort, d.GPUs[victim.deviceID-1],
+		page.PAddr, make([]byte, page.PageSize))
+	d.unifiedMemoryTransfers[req.ID] = &unifiedMemoryTransfer{
+		req:      req,
+		oldPAddr: page.PAddr,
+		newPAddr: hostPage.PAddr,
+	}
+
+	d.requestsToSend = append(d.requestsToSend, req)
+}
+
+// isUnifiedMemoryTransfer checks if a request is a page copy issued by the
+// driver for unified memory.
+func (d *Driver) isUnifiedMemoryTransfer(req sim.Msg) bool {
+	_, found := d.unifiedMemoryTransfers[req.Meta().ID]
+	return found
+}
+
+func (d *Driver) processUnifiedMemoryTransferRsp(rsp *sim.GeneralRsp) bool {
+	transfer := d.unifiedMemoryTransfers[rsp.OriginalReq.Meta().ID]
+	delete(d.unifiedMemoryTransfers, rsp.OriginalReq.Meta().ID)
+
+	if req, ok := transfer.req.(*protocol.MemCopyD2HReq); ok {
+		err := d.globalStorage.Write(transfer.newPAddr, req.DstBuffer)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	d.memAllocator.FreePhysicalPage(transfer.oldPAddr)
+
+	return d.completePageTransfer()
+}
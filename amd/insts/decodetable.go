@@ -1033,7 +1033,7 @@ func (d *Disassembler) initializeDecodeTable() {
 	d.addInstType(&InstType{"ds_gws_sema_v", 154, FormatTable[DS], 0, ExeUnitLDS, 0, 0, 0, 0, 0})
 	d.addInstType(&InstType{"ds_gws_sema_br", 155, FormatTable[DS], 0, ExeUnitLDS, 0, 0, 0, 0, 0})
 	d.addInstType(&InstType{"ds_gws_sema_p", 156, FormatTable[DS], 0, ExeUnitLDS, 0, 0, 0, 0, 0})
-	d.addInstType(&InstType{"ds_gws_barrier", 157, FormatTable[DS], 0, ExeUnitLDS, 0, 0, 0, 0, 0})
+	d.addInstType(&InstType{"ds_gws_barrier", 157, FormatTable[DS], 0, ExeUnitSpecial, 0, 0, 0, 0, 0})
 	d.addInstType(&InstType{"ds_consume", 189, FormatTable[DS], 0, ExeUnitLDS, 0, 0, 0, 0, 0})
 	d.addInstType(&InstType{"ds_append", 190, FormatTable[DS], 0, ExeUnitLDS, 0, 0, 0, 0, 0})
 	d.addInstType(&InstType{"ds_ordered_count", 191, FormatTable[DS], 0, ExeUnitLDS, 0, 0, 0, 0, 0})
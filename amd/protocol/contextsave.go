@@ -0,0 +1,40 @@
+package protocol
+
+import (
+	"github.com/sarchlab/mgpusim/v4/amd/insts"
+	"github.com/sarchlab/mgpusim/v4/amd/kernels"
+)
+
+// contextSaveAlignment aligns the parts of a context-save area to cache lines.
+const contextSaveAlignment = 64
+
+// WfContextByteSize returns the number of bytes that a wavefront of the kernel
+// takes in a context-save area. The VGPRs of the 64 lanes come first, lane by
+// lane, and the SGPRs follow.
+func WfContextByteSize(co *insts.HsaCo) uint64 {
+	vgprBytes := uint64(co.WIVgprCount) * 4 * 64
+	sgprBytes := uint64(co.WFSgprCount) * 4
+
+	return alignToCacheLine(vgprBytes + sgprBytes)
+}
+
+// WGContextByteSize returns the number of bytes that a work-group of the
+// kernel takes in a context-save area. The wavefronts come first, in the order
+// of the work-group, and the LDS follows.
+func WGContextByteSize(
+	co *insts.HsaCo,
+	packet *kernels.HsaKernelDispatchPacket,
+) uint64 {
+	wgSize := uint64(packet.WorkgroupSizeX) *
+		uint64(packet.WorkgroupSizeY) *
+		uint64(packet.WorkgroupSizeZ)
+	numWfs := (wgSize + 63) / 64
+
+	return numWfs*WfContextByteSize(co) +
+		alignToCacheLine(uint64(packet.GroupSegmentSize))
+}
+
+func alignToCacheLine(n uint64) uint64 {
+	return (n + contextSaveAlignment - 1) /
+		contextSaveAlignment * contextSaveAlignment
+}
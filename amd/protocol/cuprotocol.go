@@ -198,6 +198,10 @@ type MapWGReq struct {
 	WorkGroup  *kernels.WorkGroup
 	PID        vm.PID
 	Wavefronts []WfDispatchLocation
+
+	// SavedState is the state of a preempted work-group that the CU restores.
+	// It is nil if the work-group starts from the beginning.
+	SavedState interface{}
 }
 
 // Meta returns the meta data associated with the MapWGReq.
@@ -215,10 +219,11 @@ func (r *MapWGReq) Clone() sim.Msg {
 
 // MapWGReqBuilder can build MapWGReqs.
 type MapWGReqBuilder struct {
-	src, dst sim.RemotePort
-	pid      vm.PID
-	wg       *kernels.WorkGroup
-	wfs      []WfDispatchLocation
+	src, dst   sim.RemotePort
+	pid        vm.PID
+	wg         *kernels.WorkGroup
+	wfs        []WfDispatchLocation
+	savedState interface{}
 }
 
 // WithSrc sets the source of the message.
@@ -251,6 +256,12 @@ func (b MapWGReqBuilder) AddWf(wf WfDispatchLocation) MapWGReqBuilder {
 	return b
 }
 
+// WithSavedState sets the state of a preempted work-group to restore.
+func (b MapWGReqBuilder) WithSavedState(state interface{}) MapWGReqBuilder {
+	b.savedState = state
+	return b
+}
+
 // Build creates the MapWGReq.
 func (b MapWGReqBuilder) Build() *MapWGReq {
 	r := &MapWGReq{}
@@ -260,6 +271,7 @@ func (b MapWGReqBuilder) Build() *MapWGReq {
 	r.PID = b.pid
 	r.WorkGroup = b.wg
 	r.Wavefronts = b.wfs
+	r.SavedState = b.savedState
 	return r
 }
 
@@ -322,3 +334,152 @@ func (b WGCompletionMsgBuilder) Build() *WGCompletionMsg {
 	msg.RspTo = b.rspTo
 	return msg
 }
+
+// A SaveWGReq asks a CU to stop a work-group and to save the state of the
+// work-group so that the work-group can continue later, possibly on another
+// CU.
+type SaveWGReq struct {
+	sim.MsgMeta
+
+	// MapReqID is the ID of the MapWGReq that dispatched the work-group.
+	MapReqID string
+
+	// Address is the virtual address in the context-save area that the CU
+	// writes the state of the work-group to.
+	Address uint64
+}
+
+// Meta returns the meta data associated with the message.
+func (r *SaveWGReq) Meta() *sim.MsgMeta {
+	return &r.MsgMeta
+}
+
+// Clone returns a clone of the SaveWGReq with different ID.
+func (r *SaveWGReq) Clone() sim.Msg {
+	cloneMsg := *r
+	cloneMsg.ID = sim.GetIDGenerator().Generate()
+
+	return &cloneMsg
+}
+
+// SaveWGReqBuilder can build SaveWGReqs.
+type SaveWGReqBuilder struct {
+	src, dst sim.RemotePort
+	mapReqID string
+	address  uint64
+}
+
+// WithSrc sets the source of the message.
+func (b SaveWGReqBuilder) WithSrc(src sim.RemotePort) SaveWGReqBuilder {
+	b.src = src
+	return b
+}
+
+// WithDst sets the destination of the message.
+func (b SaveWGReqBuilder) WithDst(dst sim.RemotePort) SaveWGReqBuilder {
+	b.dst = dst
+	return b
+}
+
+// WithMapReqID sets the ID of the MapWGReq that dispatched the work-group to
+// save.
+func (b SaveWGReqBuilder) WithMapReqID(id string) SaveWGReqBuilder {
+	b.mapReqID = id
+	return b
+}
+
+// WithAddress sets the address that the state of the work-group is saved to.
+func (b SaveWGReqBuilder) WithAddress(address uint64) SaveWGReqBuilder {
+	b.address = address
+	return b
+}
+
+// Build creates the SaveWGReq.
+func (b SaveWGReqBuilder) Build() *SaveWGReq {
+	r := &SaveWGReq{}
+	r.Meta().ID = sim.GetIDGenerator().Generate()
+	r.Meta().Src = b.src
+	r.Meta().Dst = b.dst
+	r.MapReqID = b.mapReqID
+	r.Address = b.address
+	return r
+}
+
+// A SaveWGRsp tells the dispatcher that the state of a work-group is saved and
+// that the resources of the work-group are released.
+type SaveWGRsp struct {
+	sim.MsgMeta
+
+	// RspTo is the ID of the MapWGReq that dispatched the work-group.
+	RspTo string
+
+	// State is the saved state that is restored with a MapWGReq. The VGPRs,
+	// SGPRs, and LDS are in the context-save area, and the state only tells
+	// where they are.
+	State interface{}
+
+	// StateByteSize is the number of bytes of VGPRs, SGPRs, and LDS that are
+	// written to the context-save area.
+	StateByteSize uint64
+}
+
+// Meta returns the meta data associated with the message.
+func (r *SaveWGRsp) Meta() *sim.MsgMeta {
+	return &r.MsgMeta
+}
+
+// Clone returns a clone of the SaveWGRsp with different ID.
+func (r *SaveWGRsp) Clone() sim.Msg {
+	cloneMsg := *r
+	cloneMsg.ID = sim.GetIDGenerator().Generate()
+
+	return &cloneMsg
+}
+
+// SaveWGRspBuilder can build SaveWGRsps.
+type SaveWGRspBuilder struct {
+	src, dst      sim.RemotePort
+	rspTo         string
+	state         interface{}
+	stateByteSize uint64
+}
+
+// WithSrc sets the source of the message.
+func (b SaveWGRspBuilder) WithSrc(src sim.RemotePort) SaveWGRspBuilder {
+	b.src = src
+	return b
+}
+
+// WithDst sets the destination of the message.
+func (b SaveWGRspBuilder) WithDst(dst sim.RemotePort) SaveWGRspBuilder {
+	b.dst = dst
+	return b
+}
+
+// WithRspTo sets the ID of the MapWGReq that dispatched the saved work-group.
+func (b SaveWGRspBuilder) WithRspTo(id string) SaveWGRspBuilder {
+	b.rspTo = id
+	return b
+}
+
+// WithState sets the saved state of the work-group.
+func (b SaveWGRspBuilder) WithState(
+	state interface{},
+	byteSize uint64,
+) SaveWGRspBuilder {
+	b.state = state
+	b.stateByteSize = byteSize
+	return b
+}
+
+// Build creates the SaveWGRsp.
+func (b SaveWGRspBuilder) Build() *SaveWGRsp {
+	r := &SaveWGRsp{}
+	r.Meta().ID = sim.GetIDGenerator().Generate()
+	r.Meta().Src = b.src
+	r.Meta().Dst = b.dst
+	r.RspTo = b.rspTo
+	r.State = b.state
+	r.StateByteSize = b.stateByteSize
+	return r
+}
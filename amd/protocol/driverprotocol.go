@@ -45,6 +45,62 @@ type LaunchKernelReq struct {
 	PacketAddress uint64
 	HsaCo         *insts.HsaCo
 	WGFilter      kernels.WGFilterFunc
+
+	// QueueID identifies the command queue that launches the kernel. Kernels
+	// from the same command queue go to the same hardware queue.
+	QueueID string
+
+	// Priority is the priority of the hardware queue. Kernels with higher
+	// priority values are scheduled first.
+	Priority int
+
+	// CUMask limits the CUs that the kernel can use. Bit i of the mask
+	// (bit i%32 of word i/32) allows CU i. A nil mask allows all the CUs.
+	CUMask []uint32
+
+	// DeviceQueue is the queue that the kernel can launch child kernels to. It
+	// is nil if the kernel cannot launch kernels.
+	DeviceQueue *DeviceQueueInfo
+
+	// Cooperative tells if all the work-groups of the kernel must run on the
+	// GPU at the same time, so that the work-groups can synchronize with grid
+	// barriers. A cooperative kernel waits until all its work-groups fit.
+	Cooperative bool
+}
+
+const (
+	// DeviceQueueHeaderSize is the number of bytes before the first packet
+	// slot of a device queue. The first 8 bytes of the header is the write
+	// index, which counts the packets that the kernels have written.
+	DeviceQueueHeaderSize = 64
+
+	// DeviceQueueReadIndexOffset is the offset of the read index in the
+	// header of a device queue. The read index counts the packets that the
+	// command processor has read, so a slot can be written again once the
+	// read index has passed it.
+	DeviceQueueReadIndexOffset = 8
+
+	// DeviceQueueSlotSize is the number of bytes of a packet slot in a device
+	// queue. Packet i is written to slot i % NumSlots.
+	DeviceQueueSlotSize = 64
+)
+
+// DeviceQueueInfo describes a queue in the GPU memory that kernels write
+// kernel dispatch packets into. The command processor reads the packets and
+// launches the kernels.
+type DeviceQueueInfo struct {
+	// Address is the virtual address of the queue.
+	Address uint64
+
+	// HeaderPAddr is the physical address of the header of the queue.
+	HeaderPAddr uint64
+
+	// SlotPAddrs are the physical addresses of the packet slots.
+	SlotPAddrs []uint64
+
+	// CodeObjects maps the kernel object addresses that the packets can use
+	// to the code objects.
+	CodeObjects map[uint64]*insts.HsaCo
 }
 
 // Meta returns the meta data associated with the message.
@@ -77,6 +133,10 @@ type LaunchKernelRsp struct {
 	sim.MsgMeta
 
 	RspTo string
+
+	// Err is the reason that the GPU cannot run the kernel. It is nil if the
+	// kernel has completed.
+	Err error
 }
 
 // Meta returns the meta data associated with the message.
@@ -181,6 +241,45 @@ func NewMemCopyD2HReq(
 	return req
 }
 
+// A MemCopyD2DReq is a request that asks the DMAEngine to copy memory from
+// one device address to another. Either address can be on another GPU, in
+// which case the DMAEngine accesses the memory through the RDMA engine.
+type MemCopyD2DReq struct {
+	sim.MsgMeta
+	SrcAddress uint64
+	DstAddress uint64
+	ByteSize   uint64
+}
+
+// Meta returns the meta data associated with the message.
+func (m *MemCopyD2DReq) Meta() *sim.MsgMeta {
+	return &m.MsgMeta
+}
+
+// Clone returns a clone of the MemCopyD2DReq with different ID.
+func (m *MemCopyD2DReq) Clone() sim.Msg {
+	cloneMsg := *m
+	cloneMsg.ID = sim.GetIDGenerator().Generate()
+
+	return &cloneMsg
+}
+
+// NewMemCopyD2DReq creates a new MemCopyD2DReq
+func NewMemCopyD2DReq(
+	src, dst sim.Port,
+	srcAddress, dstAddress uint64,
+	byteSize uint64,
+) *MemCopyD2DReq {
+	req := new(MemCopyD2DReq)
+	req.ID = sim.GetIDGenerator().Generate()
+	req.Src = src.AsRemote()
+	req.Dst = dst.AsRemote()
+	req.SrcAddress = srcAddress
+	req.DstAddress = dstAddress
+	req.ByteSize = byteSize
+	return req
+}
+
 // ShootDownCommand requests the GPU to perform a TLB shootdown and invalidate
 // the corresponding PTE's
 type ShootDownCommand struct {
@@ -512,3 +611,206 @@ func NewRDMARestartRspToDriver(
 	cmd.Dst = dst.AsRemote()
 	return cmd
 }
+
+// A PreemptionMode determines how the work-groups that are running are
+// handled when a kernel is preempted.
+type PreemptionMode int
+
+// The supported preemption modes.
+const (
+	// PreemptionModeDrain lets the running work-groups complete. No more
+	// work-groups are dispatched until the kernel resumes.
+	PreemptionModeDrain PreemptionMode = iota
+
+	// PreemptionModeSaveState stops the running work-groups and saves their
+	// VGPRs, SGPRs, and LDS to memory. The work-groups are restored when the
+	// kernel resumes.
+	PreemptionModeSaveState
+)
+
+// A PreemptKernelReq asks a GPU to stop running a kernel and to release the
+// CUs that the kernel uses.
+type PreemptKernelReq struct {
+	sim.MsgMeta
+
+	// KernelID is the ID of the LaunchKernelReq that launched the kernel.
+	KernelID string
+	Mode     PreemptionMode
+
+	// ContextSaveArea is the virtual address of the buffer that the CUs save
+	// the state of the work-groups to in the save-state mode. Each saved
+	// work-group takes WGContextByteSize bytes of the buffer.
+	ContextSaveArea     uint64
+	ContextSaveAreaSize uint64
+}
+
+// Meta returns the meta data associated with the message.
+func (m *PreemptKernelReq) Meta() *sim.MsgMeta {
+	return &m.MsgMeta
+}
+
+// Clone returns a clone of the PreemptKernelReq with different ID.
+func (m *PreemptKernelReq) Clone() sim.Msg {
+	cloneMsg := *m
+	cloneMsg.ID = sim.GetIDGenerator().Generate()
+
+	return &cloneMsg
+}
+
+// NewPreemptKernelReq creates a new PreemptKernelReq.
+func NewPreemptKernelReq(
+	src, dst sim.RemotePort,
+	kernelID string,
+	mode PreemptionMode,
+) *PreemptKernelReq {
+	r := new(PreemptKernelReq)
+	r.ID = sim.GetIDGenerator().Generate()
+	r.Src = src
+	r.Dst = dst
+	r.KernelID = kernelID
+	r.Mode = mode
+	return r
+}
+
+// A PreemptKernelRsp tells the driver that a kernel is preempted. If the
+// kernel is not running on the GPU or is a cooperative kernel, Preempted is
+// false.
+type PreemptKernelRsp struct {
+	sim.MsgMeta
+
+	RspTo     string
+	Preempted bool
+
+	// SavedByteSize is the number of bytes of work-group state that is saved.
+	SavedByteSize uint64
+}
+
+// Meta returns the meta data associated with the message.
+func (m *PreemptKernelRsp) Meta() *sim.MsgMeta {
+	return &m.MsgMeta
+}
+
+// Clone returns a clone of the PreemptKernelRsp with different ID.
+func (m *PreemptKernelRsp) Clone() sim.Msg {
+	cloneMsg := *m
+	cloneMsg.ID = sim.GetIDGenerator().Generate()
+
+	return &cloneMsg
+}
+
+// NewPreemptKernelRsp creates a new PreemptKernelRsp.
+func NewPreemptKernelRsp(
+	src, dst sim.RemotePort,
+	rspTo string,
+) *PreemptKernelRsp {
+	r := new(PreemptKernelRsp)
+	r.ID = sim.GetIDGenerator().Generate()
+	r.Src = src
+	r.Dst = dst
+	r.RspTo = rspTo
+	return r
+}
+
+// A ResumeKernelReq asks a GPU to continue running a preempted kernel.
+type ResumeKernelReq struct {
+	sim.MsgMeta
+
+	// KernelID is the ID of the LaunchKernelReq that launched the kernel.
+	KernelID string
+}
+
+// Meta returns the meta data associated with the message.
+func (m *ResumeKernelReq) Meta() *sim.MsgMeta {
+	return &m.MsgMeta
+}
+
+// Clone returns a clone of the ResumeKernelReq with different ID.
+func (m *ResumeKernelReq) Clone() sim.Msg {
+	cloneMsg := *m
+	cloneMsg.ID = sim.GetIDGenerator().Generate()
+
+	return &cloneMsg
+}
+
+// NewResumeKernelReq creates a new ResumeKernelReq.
+func NewResumeKernelReq(
+	src, dst sim.RemotePort,
+	kernelID string,
+) *ResumeKernelReq {
+	r := new(ResumeKernelReq)
+	r.ID = sim.GetIDGenerator().Generate()
+	r.Src = src
+	r.Dst = dst
+	r.KernelID = kernelID
+	return r
+}
+
+// A ResumeKernelRsp tells the driver that a preempted kernel runs again.
+type ResumeKernelRsp struct {
+	sim.MsgMeta
+
+	RspTo string
+}
+
+// Meta returns the meta data associated with the message.
+func (m *ResumeKernelRsp) Meta() *sim.MsgMeta {
+	return &m.MsgMeta
+}
+
+// Clone returns a clone of the ResumeKernelRsp with different ID.
+func (m *ResumeKernelRsp) Clone() sim.Msg {
+	cloneMsg := *m
+	cloneMsg.ID = sim.GetIDGenerator().Generate()
+
+	return &cloneMsg
+}
+
+// NewResumeKernelRsp creates a new ResumeKernelRsp.
+func NewResumeKernelRsp(
+	src, dst sim.RemotePort,
+	rspTo string,
+) *ResumeKernelRsp {
+	r := new(ResumeKernelRsp)
+	r.ID = sim.GetIDGenerator().Generate()
+	r.Src = src
+	r.Dst = dst
+	r.RspTo = rspTo
+	return r
+}
+
+// An AccessCounterNotification tells the driver that the remote accesses of a
+// GPU to a page have reached the threshold of its access counters.
+type AccessCounterNotification struct {
+	sim.MsgMeta
+
+	PAddr uint64
+	Count uint32
+}
+
+// Meta returns the meta data associated with the message.
+func (m *AccessCounterNotification) Meta() *sim.MsgMeta {
+	return &m.MsgMeta
+}
+
+// Clone returns a clone of the AccessCounterNotification with different ID.
+func (m *AccessCounterNotification) Clone() sim.Msg {
+	cloneMsg := *m
+	cloneMsg.ID = sim.GetIDGenerator().Generate()
+
+	return &cloneMsg
+}
+
+// NewAccessCounterNotification creates a new AccessCounterNotification.
+func NewAccessCounterNotification(
+	src, dst sim.RemotePort,
+	pAddr uint64,
+	count uint32,
+) *AccessCounterNotification {
+	m := new(AccessCounterNotification)
+	m.ID = sim.GetIDGenerator().Generate()
+	m.Src = src
+	m.Dst = dst
+	m.PAddr = pAddr
+	m.Count = count
+	return m
+}
@@ -0,0 +1,61 @@
+package protocol
+
+import (
+	"github.com/sarchlab/akita/v4/mem/mem"
+)
+
+// AccessInfo is the information that a CU attaches to a vector memory access,
+// in the Info field of a ReadReq or a WriteReq. The caches do not pass the
+// information on to the lower levels.
+type AccessInfo struct {
+	// PC is the address of the instruction that generates the access.
+	PC uint64
+
+	// Policy follows the cache-control bits of the instruction.
+	Policy CachePolicy
+}
+
+// CachePolicy is the cache-control hint of a memory access.
+type CachePolicy struct {
+	// GLC (globally coherent) asks the access to skip the L1 caches, so that
+	// a load observes the data that the other CUs have written to the L2
+	// caches.
+	GLC bool
+
+	// SLC (system level coherent) marks the access as streaming. The data is
+	// not expected to be reused, so the caches should not allocate it. The
+	// access skips the L1 caches, and skips the L2 caches too unless they may
+	// hold the line.
+	SLC bool
+}
+
+// BypassL1 returns true if an access with the policy should skip the L1
+// caches.
+func (p CachePolicy) BypassL1() bool {
+	return p.GLC || p.SLC
+}
+
+// AccessInfoOf returns the information that a request carries. It returns the
+// zero value if the request carries none.
+func AccessInfoOf(req mem.AccessReq) AccessInfo {
+	var info interface{}
+
+	switch req := req.(type) {
+	case *mem.ReadReq:
+		info = req.Info
+	case *mem.WriteReq:
+		info = req.Info
+	}
+
+	if info, ok := info.(AccessInfo); ok {
+		return info
+	}
+
+	return AccessInfo{}
+}
+
+// CachePolicyOf returns the cache policy that a request carries. The policy
+// is the default one, which sets neither bit, if the request carries none.
+func CachePolicyOf(req mem.AccessReq) CachePolicy {
+	return AccessInfoOf(req).Policy
+}
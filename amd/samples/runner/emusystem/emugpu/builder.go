@@ -152,6 +152,7 @@ func (b *Builder) buildGPU() {
 	b.dmaEngine = cp.NewDMAEngine(
 		fmt.Sprintf("%s.DMA", b.gpuName), b.engine, localDataSource)
 	b.commandProcessor.DMAEngine = b.dmaEngine.ToCP
+	b.commandProcessor.DeviceQueueMemory = localDataSource
 }
 
 func (b *Builder) connectInternalComponents() {
@@ -163,6 +164,7 @@ func (b *Builder) connectInternalComponents() {
 	b.simulation.RegisterComponent(connection)
 
 	connection.PlugIn(b.commandProcessor.ToDMA)
+	connection.PlugIn(b.commandProcessor.ToMem)
 	connection.PlugIn(b.commandProcessor.ToCUs)
 	connection.PlugIn(b.gpuMem.GetPortByName("Top"))
 	connection.PlugIn(b.dmaEngine.ToCP)
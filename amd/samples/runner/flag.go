@@ -45,6 +45,31 @@ var bufferLevelTracePeriodFlag = flag.Float64("buffer-level-trace-period", 0.0,
 	"The period to dump the buffer level trace.")
 var simdBusyTimeTracerFlag = flag.Bool("report-busy-time", false, "Report SIMD Unit's busy time")
 var reportCPIStackFlag = flag.Bool("report-cpi-stack", false, "Report CPI stack")
+var pageMigrationReportFlag = flag.Bool("report-page-migration", false,
+	"Report the number of migrated pages and the time spent on migration.")
+var migrationRecordsReportFlag = flag.Bool("report-migration-records", false,
+	"Report the latency breakdown of every page migration, in addition to "+
+		"the page migration report. -report-all does not include the records.")
+var accessCounterReportFlag = flag.Bool("report-access-counter", false,
+	"Report the remote accesses that the access counters count and the "+
+		"notifications that they send to the driver.")
+var hwQueueReportFlag = flag.Bool("report-hw-queue", false,
+	"Report the kernel latency and throughput of each hardware queue and "+
+		"the CU occupancy of each CU mask.")
+var dmaReportFlag = flag.Bool("report-dma", false,
+	"Report the utilization of each copy engine and the host link of each "+
+		"DMA engine.")
+var prefetchReportFlag = flag.Bool("report-prefetch", false,
+	"Report the accuracy, coverage, and timeliness of each prefetcher.")
+var pageWalkReportFlag = flag.Bool("report-page-walk", false,
+	"Report the latency and the queueing of the page walks and the page walk "+
+		"cache hit rate of each page walker.")
+var iommuFlag = flag.Bool("iommu", false,
+	"Let the GPUs share the TLB of an IOMMU, which serves the misses of their "+
+		"L2 TLBs.")
+var cacheHintsFlag = flag.Bool("cache-hints", false,
+	"Let the vector memory accesses that set the GLC or the SLC bit bypass "+
+		"the caches.")
 var customPortForAkitaRTM = flag.Int("akitartm-port", 0,
 	`Custom port to host AkitaRTM. A 4-digit or 5-digit port number is required. If 
 this number is not given or a invalid number is given number, a random port 
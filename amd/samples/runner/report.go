@@ -1,6 +1,8 @@
 package runner
 
 import (
+	"fmt"
+	"math"
 	"sort"
 	"strings"
 
@@ -8,7 +10,13 @@ import (
 	"github.com/sarchlab/akita/v4/sim"
 	"github.com/sarchlab/akita/v4/simulation"
 	"github.com/sarchlab/akita/v4/tracing"
+	"github.com/sarchlab/mgpusim/v4/amd/timing/accesscounter"
+	"github.com/sarchlab/mgpusim/v4/amd/timing/cp"
 	"github.com/sarchlab/mgpusim/v4/amd/timing/cu"
+	"github.com/sarchlab/mgpusim/v4/amd/timing/dramtracer"
+	"github.com/sarchlab/mgpusim/v4/amd/timing/pagemigrationcontroller"
+	"github.com/sarchlab/mgpusim/v4/amd/timing/pagewalker"
+	"github.com/sarchlab/mgpusim/v4/amd/timing/prefetcher"
 	"github.com/sarchlab/mgpusim/v4/amd/timing/rdma"
 )
 
@@ -69,6 +77,13 @@ type cuCPIStackTracer struct {
 	tracer *cu.CPIStackTracer
 }
 
+type pageMigrationTracer struct {
+	stallTimeTracer *tracing.BusyTimeTracer
+	epochTracer     *tracing.AverageTimeTracer
+	pageCountTracer *tracing.StepCountTracer
+	driver          tracing.NamedHookable
+}
+
 type reporter struct {
 	dataRecorder datarecording.DataRecorder
 
@@ -82,6 +97,13 @@ type reporter struct {
 	rdmaTransactionCounters []*rdmaTransactionCountTracer
 	simdBusyTimeTracers     []*simdBusyTimeTracer
 	cuCPITraces             []*cuCPIStackTracer
+	pageMigrationTracer     *pageMigrationTracer
+	commandProcessors       []*cp.CommandProcessor
+	dmaEngines              []*cp.DMAEngine
+	prefetchers             []*prefetcher.Comp
+	pageMigrationCtrls      []*pagemigrationcontroller.PageMigrationController
+	accessCounters          []*accesscounter.Comp
+	pageWalkers             []*pagewalker.Comp
 
 	ReportInstCount            bool
 	ReportCacheLatency         bool
@@ -91,6 +113,12 @@ type reporter struct {
 	ReportDRAMTransactionCount bool
 	ReportSIMDBusyTime         bool
 	ReportCPIStack             bool
+	ReportPageMigration        bool
+	ReportAccessCounter        bool
+	ReportHWQueue              bool
+	ReportDMA                  bool
+	ReportPrefetch             bool
+	ReportPageWalk             bool
 }
 
 func newReporter(s *simulation.Simulation) *reporter {
@@ -115,6 +143,13 @@ func (r *reporter) injectTracers(s *simulation.Simulation) {
 	r.injectRDMAEngineTracer(s)
 	r.injectDRAMTracer(s)
 	r.injectSIMDBusyTimeTracer(s)
+	r.injectPageMigrationTracer(s)
+	r.collectCommandProcessors(s)
+	r.collectDMAEngines(s)
+	r.collectPrefetchers(s)
+	r.collectPageMigrationControllers(s)
+	r.collectAccessCounters(s)
+	r.collectPageWalkers(s)
 }
 
 func (r *reporter) injectKernelTimeTracer(s *simulation.Simulation) {
@@ -352,6 +387,107 @@ func (r *reporter) injectSIMDBusyTimeTracer(s *simulation.Simulation) {
 	}
 }
 
+func (r *reporter) injectPageMigrationTracer(s *simulation.Simulation) {
+	if !*reportAll && !*pageMigrationReportFlag {
+		return
+	}
+
+	isMigrationEpoch := func(task tracing.Task) bool {
+		return task.Kind == "page_migration"
+	}
+
+	t := &pageMigrationTracer{
+		driver: s.GetComponentByName("Driver").(tracing.NamedHookable),
+		stallTimeTracer: tracing.NewBusyTimeTracer(
+			s.GetEngine(), isMigrationEpoch),
+		epochTracer: tracing.NewAverageTimeTracer(
+			s.GetEngine(), isMigrationEpoch),
+		pageCountTracer: tracing.NewStepCountTracer(isMigrationEpoch),
+	}
+
+	tracing.CollectTrace(t.driver, t.stallTimeTracer)
+	tracing.CollectTrace(t.driver, t.epochTracer)
+	tracing.CollectTrace(t.driver, t.pageCountTracer)
+
+	r.pageMigrationTracer = t
+}
+
+func (r *reporter) collectCommandProcessors(s *simulation.Simulation) {
+	if !*reportAll && !*hwQueueReportFlag {
+		return
+	}
+
+	for _, comp := range s.Components() {
+		if commandProcessor, ok := comp.(*cp.CommandProcessor); ok {
+			r.commandProcessors = append(r.commandProcessors, commandProcessor)
+		}
+	}
+}
+
+func (r *reporter) collectDMAEngines(s *simulation.Simulation) {
+	if !*reportAll && !*dmaReportFlag {
+		return
+	}
+
+	for _, comp := range s.Components() {
+		if dmaEngine, ok := comp.(*cp.DMAEngine); ok {
+			r.dmaEngines = append(r.dmaEngines, dmaEngine)
+		}
+	}
+}
+
+func (r *reporter) collectPrefetchers(s *simulation.Simulation) {
+	if !*reportAll && !*prefetchReportFlag {
+		return
+	}
+
+	for _, comp := range s.Components() {
+		if p, ok := comp.(*prefetcher.Comp); ok {
+			r.prefetchers = append(r.prefetchers, p)
+		}
+	}
+}
+
+func (r *reporter) collectPageWalkers(s *simulation.Simulation) {
+	if !*reportAll && !*pageWalkReportFlag {
+		return
+	}
+
+	for _, comp := range s.Components() {
+		if w, ok := comp.(*pagewalker.Comp); ok {
+			r.pageWalkers = append(r.pageWalkers, w)
+		}
+	}
+}
+
+func (r *reporter) collectPageMigrationControllers(
+	s *simulation.Simulation,
+) {
+	if !*reportAll && !*pageMigrationReportFlag &&
+		!*migrationRecordsReportFlag {
+		return
+	}
+
+	for _, comp := range s.Components() {
+		pmc, ok := comp.(*pagemigrationcontroller.PageMigrationController)
+		if ok {
+			r.pageMigrationCtrls = append(r.pageMigrationCtrls, pmc)
+		}
+	}
+}
+
+func (r *reporter) collectAccessCounters(s *simulation.Simulation) {
+	if !*reportAll && !*accessCounterReportFlag {
+		return
+	}
+
+	for _, comp := range s.Components() {
+		if counter, ok := comp.(*accesscounter.Comp); ok {
+			r.accessCounters = append(r.accessCounters, counter)
+		}
+	}
+}
+
 func (r *reporter) report() {
 	r.reportKernelTime()
 	r.reportInstCount()
@@ -362,6 +498,13 @@ func (r *reporter) report() {
 	r.reportTLBHitRate()
 	r.reportRDMATransactionCount()
 	r.reportDRAMTransactionCount()
+	r.reportPageMigration()
+	r.reportPageMigrationControllers()
+	r.reportAccessCounters()
+	r.reportHWQueue()
+	r.reportDMA()
+	r.reportPrefetch()
+	r.reportPageWalk()
 }
 
 func (r *reporter) reportKernelTime() {
@@ -632,6 +775,135 @@ func (r *reporter) reportRDMATransactionCount() {
 				Unit:     "count",
 			},
 		)
+
+		r.reportRDMALinkBytes(t.rdmaEngine)
+		r.reportRDMALinks(t.rdmaEngine)
+		r.reportRDMARemoteCache(t.rdmaEngine)
+	}
+}
+
+// reportRDMARemoteCache reports how often the remote-data cache of the RDMA
+// engine serves the remote reads and how many bytes it keeps off the fabric.
+func (r *reporter) reportRDMARemoteCache(rdmaEngine *rdma.Comp) {
+	if !rdmaEngine.HasRemoteCache() {
+		return
+	}
+
+	location := rdmaEngine.Name() + ".RemoteCache"
+	stats := rdmaEngine.RemoteCacheStats()
+
+	r.dataRecorder.InsertData(tableName, metric{
+		Location: location,
+		What:     "hit",
+		Value:    float64(stats.NumHits),
+		Unit:     "count",
+	})
+	r.dataRecorder.InsertData(tableName, metric{
+		Location: location,
+		What:     "miss",
+		Value:    float64(stats.NumMisses),
+		Unit:     "count",
+	})
+	r.dataRecorder.InsertData(tableName, metric{
+		Location: location,
+		What:     "hit_rate",
+		Value:    stats.HitRate(),
+		Unit:     "ratio",
+	})
+	r.dataRecorder.InsertData(tableName, metric{
+		Location: location,
+		What:     "invalidated_lines",
+		Value:    float64(stats.NumInvalidations),
+		Unit:     "count",
+	})
+	r.dataRecorder.InsertData(tableName, metric{
+		Location: location,
+		What:     "saved_fabric_bytes",
+		Value:    float64(stats.SavedBytes),
+		Unit:     "bytes",
+	})
+}
+
+func (r *reporter) reportRDMALinkBytes(rdmaEngine *rdma.Comp) {
+	linkBytes := rdmaEngine.LinkBytes()
+
+	devices := make([]string, 0, len(linkBytes))
+	for device := range linkBytes {
+		devices = append(devices, device)
+	}
+	sort.Strings(devices)
+
+	for _, device := range devices {
+		r.dataRecorder.InsertData(
+			tableName,
+			metric{
+				Location: fmt.Sprintf("%s.Link[%s]", rdmaEngine.Name(), device),
+				What:     "link_bytes",
+				Value:    float64(linkBytes[device]),
+				Unit:     "bytes",
+			},
+		)
+	}
+}
+
+// reportRDMALinks reports the utilization and the packet latencies of the
+// links that the RDMA engine models.
+func (r *reporter) reportRDMALinks(rdmaEngine *rdma.Comp) {
+	links := rdmaEngine.Links()
+	duration := rdmaEngine.CurrentTime()
+
+	devices := make([]string, 0, len(links))
+	for device := range links {
+		devices = append(devices, device)
+	}
+	sort.Strings(devices)
+
+	for _, device := range devices {
+		location := fmt.Sprintf("%s.Link[%s]", rdmaEngine.Name(), device)
+		stats := links[device].Stats()
+
+		r.dataRecorder.InsertData(tableName, metric{
+			Location: location,
+			What:     "packet_count",
+			Value:    float64(stats.NumPackets),
+			Unit:     "count",
+		})
+		r.dataRecorder.InsertData(tableName, metric{
+			Location: location,
+			What:     "wire_bytes",
+			Value:    float64(stats.NumBytes),
+			Unit:     "bytes",
+		})
+		r.dataRecorder.InsertData(tableName, metric{
+			Location: location,
+			What:     "utilization",
+			Value:    stats.Utilization(duration),
+			Unit:     "ratio",
+		})
+		r.dataRecorder.InsertData(tableName, metric{
+			Location: location,
+			What:     "mean_latency",
+			Value:    float64(stats.MeanLatency()),
+			Unit:     "second",
+		})
+		r.dataRecorder.InsertData(tableName, metric{
+			Location: location,
+			What:     "p50_latency",
+			Value:    float64(stats.LatencyPercentile(0.5)),
+			Unit:     "second",
+		})
+		r.dataRecorder.InsertData(tableName, metric{
+			Location: location,
+			What:     "p99_latency",
+			Value:    float64(stats.LatencyPercentile(0.99)),
+			Unit:     "second",
+		})
+		r.dataRecorder.InsertData(tableName, metric{
+			Location: location,
+			What:     "max_latency",
+			Value:    float64(stats.MaxLatency),
+			Unit:     "second",
+		})
 	}
 }
 
@@ -691,5 +963,444 @@ func (r *reporter) reportDRAMTransactionCount() {
 				Unit:     "bytes",
 			},
 		)
+
+		stats := dramtracer.Find(t.dram)
+		if stats != nil {
+			r.reportDRAMStats(t.dram.Name(), stats, t.tracer.CurrentTime())
+		}
+	}
+}
+
+func (r *reporter) reportDRAMStats(
+	name string,
+	stats *dramtracer.Tracer,
+	duration sim.VTimeInSec,
+) {
+	r.dataRecorder.InsertData(
+		tableName,
+		metric{
+			Location: name,
+			What:     "row_buffer_hit_rate",
+			Value:    stats.RowBufferHitRate(),
+			Unit:     "ratio",
+		},
+	)
+	r.dataRecorder.InsertData(
+		tableName,
+		metric{
+			Location: name,
+			What:     "bandwidth_utilization",
+			Value:    stats.BandwidthUtilization(duration),
+			Unit:     "ratio",
+		},
+	)
+}
+
+func (r *reporter) reportPageMigration() {
+	t := r.pageMigrationTracer
+	if t == nil {
+		return
+	}
+
+	r.dataRecorder.InsertData(tableName, metric{
+		Location: t.driver.Name(),
+		What:     "migration_epoch_count",
+		Value:    float64(t.epochTracer.TotalCount()),
+		Unit:     "count",
+	})
+	r.dataRecorder.InsertData(tableName, metric{
+		Location: t.driver.Name(),
+		What:     "demand_migration_count",
+		Value:    float64(t.pageCountTracer.GetStepCount("demand_migration")),
+		Unit:     "count",
+	})
+	r.dataRecorder.InsertData(tableName, metric{
+		Location: t.driver.Name(),
+		What:     "prefetch_migration_count",
+		Value: float64(
+			t.pageCountTracer.GetStepCount("prefetch_migration")),
+		Unit: "count",
+	})
+	r.dataRecorder.InsertData(tableName, metric{
+		Location: t.driver.Name(),
+		What:     "counter_migration_count",
+		Value: float64(
+			t.pageCountTracer.GetStepCount("counter_migration")),
+		Unit: "count",
+	})
+	r.dataRecorder.InsertData(tableName, metric{
+		Location: t.driver.Name(),
+		What:     "eviction_count",
+		Value:    float64(t.pageCountTracer.GetStepCount("eviction")),
+		Unit:     "count",
+	})
+	r.dataRecorder.InsertData(tableName, metric{
+		Location: t.driver.Name(),
+		What:     "migration_stall_time",
+		Value:    float64(t.stallTimeTracer.BusyTime()),
+		Unit:     "second",
+	})
+}
+
+// migrationStages are the stages of the page migrations that the report
+// breaks the latency into.
+var migrationStages = []struct {
+	name string
+	time func(pagemigrationcontroller.MigrationRecord) sim.VTimeInSec
+}{
+	{"queue_time", func(m pagemigrationcontroller.MigrationRecord) sim.VTimeInSec {
+		return m.QueueTime
+	}},
+	{"latency", func(m pagemigrationcontroller.MigrationRecord) sim.VTimeInSec {
+		return m.Latency
+	}},
+	{"chunk_read_time", func(m pagemigrationcontroller.MigrationRecord) sim.VTimeInSec {
+		return m.ReadTime
+	}},
+	{"chunk_link_wait_time", func(m pagemigrationcontroller.MigrationRecord) sim.VTimeInSec {
+		return m.LinkWaitTime
+	}},
+	{"chunk_transfer_time", func(m pagemigrationcontroller.MigrationRecord) sim.VTimeInSec {
+		return m.TransferTime
+	}},
+	{"chunk_write_time", func(m pagemigrationcontroller.MigrationRecord) sim.VTimeInSec {
+		return m.WriteTime
+	}},
+}
+
+// reportPageMigrationControllers reports the mean and the percentiles of the
+// latency breakdown of the page migrations that each page migration
+// controller performs. The breakdown of every migration is reported only
+// with -report-migration-records.
+func (r *reporter) reportPageMigrationControllers() {
+	for _, pmc := range r.pageMigrationCtrls {
+		records := pmc.MigrationRecords()
+
+		r.dataRecorder.InsertData(tableName, metric{
+			Location: pmc.Name(),
+			What:     "migration_count",
+			Value:    float64(len(records)),
+			Unit:     "count",
+		})
+		r.dataRecorder.InsertData(tableName, metric{
+			Location: pmc.Name(),
+			What:     "total_data_transfer_time",
+			Value:    float64(pmc.TotalDataTransferTime),
+			Unit:     "second",
+		})
+
+		if len(records) > 0 {
+			for _, stage := range migrationStages {
+				r.reportMigrationStage(pmc.Name(), stage.name, records, stage.time)
+			}
+		}
+
+		if !*migrationRecordsReportFlag {
+			continue
+		}
+
+		for i, record := range records {
+			r.reportMigrationRecord(
+				fmt.Sprintf("%s.Migration[%d]", pmc.Name(), i), record)
+		}
+	}
+}
+
+func (r *reporter) reportMigrationStage(
+	location, stage string,
+	records []pagemigrationcontroller.MigrationRecord,
+	time func(pagemigrationcontroller.MigrationRecord) sim.VTimeInSec,
+) {
+	times := make([]sim.VTimeInSec, 0, len(records))
+	total := sim.VTimeInSec(0)
+
+	for _, record := range records {
+		times = append(times, time(record))
+		total += time(record)
+	}
+
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+
+	r.dataRecorder.InsertData(tableName, metric{
+		Location: location,
+		What:     "mean_" + stage,
+		Value:    float64(total / sim.VTimeInSec(len(times))),
+		Unit:     "second",
+	})
+	r.dataRecorder.InsertData(tableName, metric{
+		Location: location,
+		What:     "p50_" + stage,
+		Value:    float64(percentile(times, 0.5)),
+		Unit:     "second",
+	})
+	r.dataRecorder.InsertData(tableName, metric{
+		Location: location,
+		What:     "p99_" + stage,
+		Value:    float64(percentile(times, 0.99)),
+		Unit:     "second",
+	})
+}
+
+// percentile returns the smallest of the sorted times that the given fraction
+// of the times do not exceed.
+func percentile(sorted []sim.VTimeInSec, p float64) sim.VTimeInSec {
+	rank := int(math.Ceil(p * float64(len(sorted))))
+
+	return sorted[max(rank, 1)-1]
+}
+
+// reportAccessCounters reports the remote accesses that the access counters
+// of the GPUs count and the notifications that they send to the driver.
+func (r *reporter) reportAccessCounters() {
+	for _, counter := range r.accessCounters {
+		r.dataRecorder.InsertData(tableName, metric{
+			Location: counter.Name(),
+			What:     "remote_access_count",
+			Value:    float64(counter.NumRemoteAccesses()),
+			Unit:     "count",
+		})
+		r.dataRecorder.InsertData(tableName, metric{
+			Location: counter.Name(),
+			What:     "notification_count",
+			Value:    float64(counter.NumNotifications()),
+			Unit:     "count",
+		})
+	}
+}
+
+// reportMigrationRecord reports the latency breakdown of one page migration.
+func (r *reporter) reportMigrationRecord(
+	location string,
+	record pagemigrationcontroller.MigrationRecord,
+) {
+	r.dataRecorder.InsertData(tableName, metric{
+		Location: location,
+		What:     "queue_time",
+		Value:    float64(record.QueueTime),
+		Unit:     "second",
+	})
+	r.dataRecorder.InsertData(tableName, metric{
+		Location: location,
+		What:     "latency",
+		Value:    float64(record.Latency),
+		Unit:     "second",
+	})
+	r.dataRecorder.InsertData(tableName, metric{
+		Location: location,
+		What:     "chunk_read_time",
+		Value:    float64(record.ReadTime),
+		Unit:     "second",
+	})
+	r.dataRecorder.InsertData(tableName, metric{
+		Location: location,
+		What:     "chunk_link_wait_time",
+		Value:    float64(record.LinkWaitTime),
+		Unit:     "second",
+	})
+	r.dataRecorder.InsertData(tableName, metric{
+		Location: location,
+		What:     "chunk_transfer_time",
+		Value:    float64(record.TransferTime),
+		Unit:     "second",
+	})
+	r.dataRecorder.InsertData(tableName, metric{
+		Location: location,
+		What:     "chunk_write_time",
+		Value:    float64(record.WriteTime),
+		Unit:     "second",
+	})
+}
+
+func (r *reporter) reportHWQueue() {
+	for _, commandProcessor := range r.commandProcessors {
+		for _, stats := range commandProcessor.HWQueueStats() {
+			location := commandProcessor.Name() + ".Queue[" + stats.QueueID + "]"
+
+			r.dataRecorder.InsertData(tableName, metric{
+				Location: location,
+				What:     "kernel_count",
+				Value:    float64(stats.NumKernels),
+				Unit:     "count",
+			})
+			r.dataRecorder.InsertData(tableName, metric{
+				Location: location,
+				What:     "kernel_avg_latency",
+				Value:    float64(stats.AverageLatency()),
+				Unit:     "second",
+			})
+			r.dataRecorder.InsertData(tableName, metric{
+				Location: location,
+				What:     "kernel_throughput",
+				Value:    stats.Throughput(),
+				Unit:     "kernels/second",
+			})
+		}
+
+		for _, stats := range commandProcessor.CUMaskStats() {
+			location := commandProcessor.Name() + ".CUMask[" + stats.Mask + "]"
+
+			r.dataRecorder.InsertData(tableName, metric{
+				Location: location,
+				What:     "wg_count",
+				Value:    float64(stats.NumWGs),
+				Unit:     "count",
+			})
+			r.dataRecorder.InsertData(tableName, metric{
+				Location: location,
+				What:     "cus_used",
+				Value:    float64(stats.NumCUsUsed()),
+				Unit:     "count",
+			})
+			r.dataRecorder.InsertData(tableName, metric{
+				Location: location,
+				What:     "cu_occupancy",
+				Value:    stats.Occupancy(),
+				Unit:     "ratio",
+			})
+		}
+	}
+}
+
+func (r *reporter) reportDMA() {
+	for _, dmaEngine := range r.dmaEngines {
+		duration := dmaEngine.CurrentTime()
+
+		for i, stats := range dmaEngine.CopyEngineStats() {
+			location := fmt.Sprintf("%s.CopyEngine[%d]", dmaEngine.Name(), i)
+
+			r.dataRecorder.InsertData(tableName, metric{
+				Location: location,
+				What:     "copy_count",
+				Value:    float64(stats.NumCopies),
+				Unit:     "count",
+			})
+			r.dataRecorder.InsertData(tableName, metric{
+				Location: location,
+				What:     "copy_bytes",
+				Value:    float64(stats.NumBytes),
+				Unit:     "bytes",
+			})
+			r.dataRecorder.InsertData(tableName, metric{
+				Location: location,
+				What:     "utilization",
+				Value:    stats.Utilization(duration),
+				Unit:     "ratio",
+			})
+		}
+
+		r.reportHostLink(dmaEngine, cp.HostToDevice, "h2d", duration)
+		r.reportHostLink(dmaEngine, cp.DeviceToHost, "d2h", duration)
+	}
+}
+
+func (r *reporter) reportHostLink(
+	dmaEngine *cp.DMAEngine,
+	dir cp.HostLinkDirection,
+	dirName string,
+	duration sim.VTimeInSec,
+) {
+	link := dmaEngine.HostLink
+	location := dmaEngine.Name() + ".HostLink"
+
+	utilization := 0.0
+	if duration > 0 {
+		utilization = float64(link.BusyTime(dir) / duration)
+	}
+
+	r.dataRecorder.InsertData(tableName, metric{
+		Location: location,
+		What:     dirName + "_bytes",
+		Value:    float64(link.NumBytes(dir)),
+		Unit:     "bytes",
+	})
+	r.dataRecorder.InsertData(tableName, metric{
+		Location: location,
+		What:     dirName + "_utilization",
+		Value:    utilization,
+		Unit:     "ratio",
+	})
+}
+
+func (r *reporter) reportPrefetch() {
+	for _, p := range r.prefetchers {
+		r.dataRecorder.InsertData(tableName, metric{
+			Location: p.Name(),
+			What:     "prefetch_issued",
+			Value:    float64(p.NumIssued()),
+			Unit:     "count",
+		})
+		r.dataRecorder.InsertData(tableName, metric{
+			Location: p.Name(),
+			What:     "prefetch_useful",
+			Value:    float64(p.NumUseful()),
+			Unit:     "count",
+		})
+		r.dataRecorder.InsertData(tableName, metric{
+			Location: p.Name(),
+			What:     "prefetch_late",
+			Value:    float64(p.NumLate()),
+			Unit:     "count",
+		})
+		r.dataRecorder.InsertData(tableName, metric{
+			Location: p.Name(),
+			What:     "prefetch_accuracy",
+			Value:    p.Accuracy(),
+			Unit:     "ratio",
+		})
+		r.dataRecorder.InsertData(tableName, metric{
+			Location: p.Name(),
+			What:     "prefetch_coverage",
+			Value:    p.Coverage(),
+			Unit:     "ratio",
+		})
+		r.dataRecorder.InsertData(tableName, metric{
+			Location: p.Name(),
+			What:     "prefetch_timeliness",
+			Value:    p.Timeliness(),
+			Unit:     "ratio",
+		})
+	}
+}
+
+func (r *reporter) reportPageWalk() {
+	for _, w := range r.pageWalkers {
+		stats := w.Stats()
+
+		r.dataRecorder.InsertData(tableName, metric{
+			Location: w.Name(),
+			What:     "walk_count",
+			Value:    float64(stats.NumWalks),
+			Unit:     "count",
+		})
+		r.dataRecorder.InsertData(tableName, metric{
+			Location: w.Name(),
+			What:     "level_read_count",
+			Value:    float64(stats.NumLevelReads),
+			Unit:     "count",
+		})
+		r.dataRecorder.InsertData(tableName, metric{
+			Location: w.Name(),
+			What:     "avg_walk_latency",
+			Value:    float64(stats.AvgWalkLatency()),
+			Unit:     "second",
+		})
+		r.dataRecorder.InsertData(tableName, metric{
+			Location: w.Name(),
+			What:     "avg_queue_time",
+			Value:    float64(stats.AvgQueueTime()),
+			Unit:     "second",
+		})
+		r.dataRecorder.InsertData(tableName, metric{
+			Location: w.Name(),
+			What:     "max_queue_length",
+			Value:    float64(stats.MaxQueueLength),
+			Unit:     "count",
+		})
+		r.dataRecorder.InsertData(tableName, metric{
+			Location: w.Name(),
+			What:     "pwc_hit_rate",
+			Value:    stats.PWCHitRate(),
+			Unit:     "ratio",
+		})
 	}
 }
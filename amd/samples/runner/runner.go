@@ -15,6 +15,7 @@ import (
 	"github.com/sarchlab/mgpusim/v4/amd/driver"
 	"github.com/sarchlab/mgpusim/v4/amd/samples/runner/emusystem"
 	"github.com/sarchlab/mgpusim/v4/amd/samples/runner/timingconfig"
+	"github.com/sarchlab/mgpusim/v4/amd/samples/runner/timingconfig/r9nano"
 	"github.com/sarchlab/mgpusim/v4/amd/timing/tlbtracer"
 	"github.com/sarchlab/mgpusim/v4/amd/sampling"
 )
@@ -89,11 +90,20 @@ func (r *Runner) buildTimingPlatform() {
 		WithSimulation(r.simulation).
 		WithNumGPUs(r.GPUIDs[len(r.GPUIDs)-1])
 
+	if *iommuFlag {
+		b = b.WithIOMMU(r9nano.MakeIOMMUBuilder())
+	}
+
+	if *cacheHintsFlag {
+		b = b.WithGPUBuilder(r9nano.MakeBuilder().WithCacheHints(true))
+	}
+
 	// if *magicMemoryCopy {
 	// 	b = b.WithMagicMemoryCopy()
 	// }
 
 	r.platform, r.tlbTracers = b.Build()
+	r.reporter = newReporter(r.simulation)
 	r.configureVisTracing()
 }
 
@@ -1,21 +1,52 @@
+// Package timingconfig contains the configuration for timing simulation.
 package timingconfig
 
 import (
+	"fmt"
+
+	"github.com/sarchlab/akita/v4/mem/mem"
+	"github.com/sarchlab/akita/v4/mem/vm"
+	"github.com/sarchlab/akita/v4/mem/vm/mmu"
 	"github.com/sarchlab/akita/v4/sim"
+	"github.com/sarchlab/akita/v4/sim/directconnection"
 	"github.com/sarchlab/akita/v4/simulation"
 	"github.com/sarchlab/mgpusim/v4/amd/driver"
+	"github.com/sarchlab/mgpusim/v4/amd/samples/runner/timingconfig/r9nano"
+	"github.com/sarchlab/mgpusim/v4/amd/timing/hostmemory"
+	"github.com/sarchlab/mgpusim/v4/amd/timing/rdma"
 	"github.com/sarchlab/mgpusim/v4/amd/timing/tlbtracer"
 )
 
 // Builder builds a platform for timing simulation.
 type Builder struct {
-	simulation *simulation.Simulation
-	numGPUs    int
+	simulation   *simulation.Simulation
+	numGPUs      int
+	log2PageSize uint64
+	memSize      uint64
+	gpuBuilder   r9nano.Builder
+	useIOMMU     bool
+	iommuBuilder r9nano.IOMMUBuilder
+
+	storage          *mem.Storage
+	pageTable        vm.PageTable
+	driver           *driver.Driver
+	mmu              *mmu.Comp
+	hostMemory       *hostmemory.Comp
+	iommu            *sim.Domain
+	connection       *directconnection.Comp
+	rdmaAddressTable *mem.BankedAddressPortMapper
+	pmcAddressTable  *mem.BankedAddressPortMapper
+	rdmaDeviceTable  *rdma.DeviceTable
 }
 
 // MakeBuilder creates a new builder.
 func MakeBuilder() Builder {
-	return Builder{}
+	return Builder{
+		numGPUs:      4,
+		log2PageSize: 12,
+		memSize:      4 * mem.GB,
+		gpuBuilder:   r9nano.MakeBuilder(),
+	}
 }
 
 // WithSimulation sets the simulation to use.
@@ -30,17 +61,60 @@ func (b Builder) WithNumGPUs(n int) Builder {
 	return b
 }
 
+// WithPageTable sets the page table that the driver and the MMU share. A new
+// page table is created if none is set.
+func (b Builder) WithPageTable(pageTable vm.PageTable) Builder {
+	b.pageTable = pageTable
+	return b
+}
+
+// WithGPUBuilder sets the builder that builds each GPU. The platform sets the
+// simulation, the ID, the memory range, the MMU, and the address tables of
+// each GPU, so that the builder only needs to describe the organization of
+// the GPUs.
+func (b Builder) WithGPUBuilder(gpuBuilder r9nano.Builder) Builder {
+	b.gpuBuilder = gpuBuilder
+	return b
+}
+
+// WithIOMMU lets the GPUs share an IOMMU that the builder builds. The misses
+// of the L2 TLBs go to the TLB of the IOMMU instead of the MMU. The platform
+// sets the simulation, the page size, the MMU, and the number of GPUs of the
+// IOMMU.
+func (b Builder) WithIOMMU(iommuBuilder r9nano.IOMMUBuilder) Builder {
+	b.useIOMMU = true
+	b.iommuBuilder = iommuBuilder
+	return b
+}
+
 // Build builds the platform.
+//
+// The host memory takes the first memSize bytes of the physical address
+// space, followed by the memory of each GPU. The GPUs reach the memory of the
+// host and of the other GPUs through their RDMA engines.
 func (b Builder) Build() (*sim.Domain, []*tlbtracer.TLBTracer) {
 	platform := sim.NewDomain("Platform")
 
-	driverBuilder := driver.MakeBuilder().WithEngine(b.simulation.GetEngine())
-	driver := driverBuilder.Build("Driver")
-	b.simulation.RegisterComponent(driver)
+	b.storage = mem.NewStorage(uint64(b.numGPUs+1) * b.memSize)
+	if b.pageTable == nil {
+		b.pageTable = vm.NewPageTable(b.log2PageSize)
+	}
+
+	b.buildDriver()
+	b.buildMMU()
+	b.buildHostMemory()
+	b.buildConnection()
+	b.buildIOMMU()
+	b.buildAddressTables()
+
+	for i := 1; i <= b.numGPUs; i++ {
+		b.buildGPU(i)
+	}
 
 	tracers := []*tlbtracer.TLBTracer{}
-	for i := 0; i < b.numGPUs; i++ {
-		tracer, err := tlbtracer.NewTLBTracer("GPU.TLBTracer", b.simulation.GetEngine())
+	for i := 1; i <= b.numGPUs; i++ {
+		tracer, err := tlbtracer.NewTLBTracer(
+			fmt.Sprintf("GPU[%d].TLBTracer", i), b.simulation.GetEngine())
 		if err != nil {
 			panic(err)
 		}
@@ -49,4 +123,131 @@ func (b Builder) Build() (*sim.Domain, []*tlbtracer.TLBTracer) {
 	}
 
 	return platform, tracers
-}
\ No newline at end of file
+}
+
+func (b *Builder) buildDriver() {
+	b.driver = driver.MakeBuilder().
+		WithEngine(b.simulation.GetEngine()).
+		WithPageTable(b.pageTable).
+		WithLog2PageSize(b.log2PageSize).
+		WithGlobalStorage(b.storage).
+		Build("Driver")
+	b.simulation.RegisterComponent(b.driver)
+}
+
+func (b *Builder) buildMMU() {
+	b.mmu = mmu.MakeBuilder().
+		WithEngine(b.simulation.GetEngine()).
+		WithFreq(1 * sim.GHz).
+		WithLog2PageSize(b.log2PageSize).
+		WithPageTable(b.pageTable).
+		WithMigrationServiceProvider(
+			b.driver.GetPortByName("MMU").AsRemote()).
+		WithMaxNumReqInFlight(64).
+		WithPageWalkingLatency(100).
+		Build("MMU")
+	b.simulation.RegisterComponent(b.mmu)
+}
+
+func (b *Builder) buildHostMemory() {
+	b.hostMemory = hostmemory.MakeBuilder().
+		WithEngine(b.simulation.GetEngine()).
+		WithStorage(b.storage).
+		Build("HostMemory")
+	b.simulation.RegisterComponent(b.hostMemory)
+}
+
+func (b *Builder) buildConnection() {
+	b.connection = directconnection.MakeBuilder().
+		WithEngine(b.simulation.GetEngine()).
+		WithFreq(1 * sim.GHz).
+		Build("ExternalConn")
+	b.simulation.RegisterComponent(b.connection)
+
+	b.connection.PlugIn(b.driver.GetPortByName("GPU"))
+	b.connection.PlugIn(b.driver.GetPortByName("MMU"))
+	b.connection.PlugIn(b.mmu.GetPortByName("Top"))
+	b.connection.PlugIn(b.mmu.GetPortByName("Migration"))
+	b.connection.PlugIn(b.hostMemory.Top)
+}
+
+func (b *Builder) buildIOMMU() {
+	if !b.useIOMMU {
+		return
+	}
+
+	b.iommu = b.iommuBuilder.
+		WithSimulation(b.simulation).
+		WithLog2PageSize(b.log2PageSize).
+		WithMMU(b.mmu).
+		WithNumGPUs(b.numGPUs).
+		Build("IOMMU")
+
+	b.connection.PlugIn(b.iommu.GetPortByName("Top"))
+	b.connection.PlugIn(b.iommu.GetPortByName("Translation"))
+}
+
+// buildAddressTables creates the tables that find the device that holds a
+// physical address. The RDMA engines send the accesses to the host memory
+// to the host memory component. As the host does not migrate pages, the
+// host entry of the page migration table is left empty. The device table
+// tells the RDMA engines which device owns each port that they send to.
+func (b *Builder) buildAddressTables() {
+	b.rdmaDeviceTable = rdma.NewDeviceTable()
+	b.rdmaDeviceTable.AddDevice("HostMemory", b.hostMemory.Top.AsRemote())
+
+	b.rdmaAddressTable = mem.NewBankedAddressPortMapper(b.memSize)
+	b.rdmaAddressTable.LowModules = append(b.rdmaAddressTable.LowModules,
+		b.hostMemory.Top.AsRemote())
+
+	b.pmcAddressTable = mem.NewBankedAddressPortMapper(b.memSize)
+	b.pmcAddressTable.LowModules = append(b.pmcAddressTable.LowModules, "")
+}
+
+func (b *Builder) buildGPU(id int) {
+	gpuBuilder := b.gpuBuilder
+	if b.iommu != nil {
+		gpuBuilder = gpuBuilder.WithSharedTLB(
+			b.iommu.GetPortByName("Top").AsRemote(),
+			b.iommu.GetPortByName(fmt.Sprintf("Control[%d]", id-1)))
+	}
+
+	gpu := gpuBuilder.
+		WithSimulation(b.simulation).
+		WithGPUID(uint64(id)).
+		WithLog2PageSize(b.log2PageSize).
+		WithMemAddrOffset(uint64(id) * b.memSize).
+		WithDRAMSize(b.memSize).
+		WithMMU(b.mmu).
+		WithDriver(b.driver).
+		WithGlobalStorage(b.storage).
+		WithRDMAAddressMapper(b.rdmaAddressTable).
+		WithPMCAddressMapper(b.pmcAddressTable).
+		WithRDMADeviceTable(b.rdmaDeviceTable).
+		WithHostMemory(b.hostMemory).
+		Build(fmt.Sprintf("GPU[%d]", id))
+
+	cpPort := gpu.GetPortByName("CommandProcessor")
+	b.driver.RegisterGPU(cpPort, driver.DeviceProperties{
+		CUCount:  64,
+		DRAMSize: b.memSize,
+	})
+
+	b.driver.RemotePMCPorts = append(b.driver.RemotePMCPorts,
+		gpu.GetPortByName("PageMigrationController"))
+
+	b.connection.PlugIn(cpPort)
+	b.connection.PlugIn(gpu.GetPortByName("RDMARequest"))
+	b.connection.PlugIn(gpu.GetPortByName("RDMAData"))
+	b.connection.PlugIn(gpu.GetPortByName("PageMigrationController"))
+	b.connection.PlugIn(gpu.GetPortByName("Translation_00"))
+
+	b.rdmaAddressTable.LowModules = append(b.rdmaAddressTable.LowModules,
+		gpu.GetPortByName("RDMAData").AsRemote())
+	b.pmcAddressTable.LowModules = append(b.pmcAddressTable.LowModules,
+		gpu.GetPortByName("PageMigrationController").AsRemote())
+	b.rdmaDeviceTable.AddDevice(gpu.Name(),
+		gpu.GetPortByName("RDMARequest").AsRemote(),
+		gpu.GetPortByName("RDMAData").AsRemote(),
+		gpu.GetPortByName("PageMigrationController").AsRemote())
+}
@@ -0,0 +1,68 @@
+package timingconfig_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sarchlab/mgpusim/v4/amd/driver"
+	"github.com/sarchlab/mgpusim/v4/amd/kernels"
+	"github.com/sarchlab/mgpusim/v4/amd/protocol"
+	"github.com/sarchlab/mgpusim/v4/amd/samples/runner/timingconfig"
+)
+
+var _ = Describe("Device Queue", func() {
+	It("should launch the child kernels that a kernel writes", func() {
+		_, d := buildPlatform(timingconfig.MakeBuilder().WithNumGPUs(1))
+
+		co := kernels.LoadProgram("../../../driver/memcopy.hsaco", "copyKernel")
+		Expect(co).NotTo(BeNil())
+
+		const byteSize = 1024
+		data := make([]byte, byteSize)
+		for i := range data {
+			data[i] = byte(i*3 + 1)
+		}
+
+		ctx := d.Init()
+		childSrc := d.AllocateMemory(ctx, byteSize)
+		childDst := d.AllocateMemory(ctx, byteSize)
+		kernArgs := d.AllocateMemory(ctx, 24)
+		packetBuf := d.AllocateMemory(ctx, 64)
+		writeIndexBuf := d.AllocateMemory(ctx, 8)
+		d.MemCopyH2D(ctx, childSrc, data)
+		d.MemCopyH2D(ctx, childDst, make([]byte, byteSize))
+		d.MemCopyH2D(ctx, kernArgs, &driver.KernelMemCopyArgs{
+			Src: childSrc,
+			Dst: childDst,
+			N:   byteSize,
+		})
+		d.MemCopyH2D(ctx, writeIndexBuf, uint64(1))
+
+		queue := d.CreateCommandQueue(ctx)
+		dq := d.CreateDeviceQueue(queue, 2, co)
+		d.MemCopyH2D(ctx, packetBuf, &kernels.HsaKernelDispatchPacket{
+			WorkgroupSizeX: 64,
+			WorkgroupSizeY: 1,
+			WorkgroupSizeZ: 1,
+			GridSizeX:      byteSize / 4,
+			GridSizeY:      1,
+			GridSizeZ:      1,
+			KernelObject:   uint64(dq.KernelObject(co)),
+			KernargAddress: uint64(kernArgs),
+		})
+
+		// The kernels write the packet and then the write index, so that the
+		// Command Processor can only find them in the L2 caches.
+		d.EnqueueMemCopyD2DWithKernel(queue, dq.SlotAddress(0), packetBuf, 64)
+		d.EnqueueMemCopyD2DWithKernel(queue, dq.Address, writeIndexBuf, 8)
+		d.DrainCommandQueue(queue)
+
+		result := make([]byte, byteSize)
+		d.MemCopyD2H(ctx, result, childDst)
+		Expect(result).To(Equal(data))
+
+		readIndex := uint64(0)
+		d.MemCopyD2H(ctx, &readIndex,
+			dq.Address+protocol.DeviceQueueReadIndexOffset)
+		Expect(readIndex).To(Equal(uint64(1)))
+	})
+})
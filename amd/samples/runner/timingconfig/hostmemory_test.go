@@ -0,0 +1,43 @@
+package timingconfig_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sarchlab/mgpusim/v4/amd/samples/runner/timingconfig"
+	"github.com/sarchlab/mgpusim/v4/amd/timing/rdma"
+)
+
+var _ = Describe("Zero-Copy Host Memory", func() {
+	It("should let kernels read and write the host memory", func() {
+		s, d := buildPlatform(timingconfig.MakeBuilder().WithNumGPUs(1))
+
+		const byteSize = 4096
+		data := make([]byte, byteSize)
+		for i := range data {
+			data[i] = byte(i * 7)
+		}
+
+		ctx := d.Init()
+		hostSrc := d.AllocateHostMemory(ctx, byteSize, true)
+		hostDst := d.AllocateHostMemory(ctx, byteSize, true)
+		gpuBuf := d.AllocateMemory(ctx, byteSize)
+		d.MemCopyH2D(ctx, hostSrc, data)
+
+		queue := d.CreateCommandQueue(ctx)
+		d.EnqueueMemCopyD2DWithKernel(queue, gpuBuf, hostSrc, byteSize)
+		d.EnqueueMemCopyD2DWithKernel(queue, hostDst, gpuBuf, byteSize)
+		d.DrainCommandQueue(queue)
+
+		fromGPU := make([]byte, byteSize)
+		d.MemCopyD2H(ctx, fromGPU, gpuBuf)
+		Expect(fromGPU).To(Equal(data))
+
+		fromHost := make([]byte, byteSize)
+		d.MemCopyD2H(ctx, fromHost, hostDst)
+		Expect(fromHost).To(Equal(data))
+
+		rdmaEngine := s.GetComponentByName("GPU[1].RDMA").(*rdma.Comp)
+		Expect(rdmaEngine.LinkBytes()["HostMemory"]).
+			To(BeNumerically(">=", 2*byteSize))
+	})
+})
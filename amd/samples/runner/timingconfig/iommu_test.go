@@ -0,0 +1,44 @@
+package timingconfig_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sarchlab/mgpusim/v4/amd/samples/runner/timingconfig"
+	"github.com/sarchlab/mgpusim/v4/amd/samples/runner/timingconfig/r9nano"
+)
+
+var _ = Describe("IOMMU", func() {
+	It("should translate the addresses of all the GPUs", func() {
+		_, d := buildPlatform(timingconfig.MakeBuilder().
+			WithNumGPUs(2).
+			WithIOMMU(r9nano.MakeIOMMUBuilder()))
+
+		const n = 8192
+		data := make([]byte, n)
+		for i := range data {
+			data[i] = byte(i*7 + 3)
+		}
+
+		ctx := d.Init()
+		d.SelectGPU(ctx, 2)
+		src := d.AllocateMemory(ctx, n)
+		d.MemCopyH2D(ctx, src, data)
+
+		d.SelectGPU(ctx, 1)
+		dst := d.AllocateMemory(ctx, n)
+		d.MemCopyH2D(ctx, dst, make([]byte, n))
+
+		q := d.CreateCommandQueue(ctx)
+		d.EnqueueMemCopyD2DWithKernel(q, dst, src, n)
+		d.DrainCommandQueue(q)
+
+		d.SelectGPU(ctx, 2)
+		q = d.CreateCommandQueue(ctx)
+		d.EnqueueMemCopyD2DWithKernel(q, src, dst, n)
+		d.DrainCommandQueue(q)
+
+		res := make([]byte, n)
+		d.MemCopyD2H(ctx, res, src)
+		Expect(res).To(Equal(data))
+	})
+})
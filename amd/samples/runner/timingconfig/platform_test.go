@@ -0,0 +1,128 @@
+package timingconfig_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sarchlab/akita/v4/mem/vm/mmu"
+	"github.com/sarchlab/mgpusim/v4/amd/samples/runner/timingconfig"
+	"github.com/sarchlab/mgpusim/v4/amd/samples/runner/timingconfig/r9nano"
+	"github.com/sarchlab/mgpusim/v4/amd/samples/runner/timingconfig/shaderarray"
+	"github.com/sarchlab/mgpusim/v4/amd/timing/cachepolicy"
+	"github.com/sarchlab/mgpusim/v4/amd/timing/cp"
+	"github.com/sarchlab/mgpusim/v4/amd/timing/dram"
+	"github.com/sarchlab/mgpusim/v4/amd/timing/dramtracer"
+)
+
+var _ = Describe("Platform", func() {
+	It("should build a GPU for each device of the driver", func() {
+		s, d := buildPlatform(timingconfig.MakeBuilder().WithNumGPUs(2))
+
+		Expect(d.GetNumGPUs()).To(Equal(2))
+		Expect(s.GetComponentByName("MMU")).
+			To(BeAssignableToTypeOf(&mmu.Comp{}))
+		Expect(s.GetComponentByName("GPU[1].CommandProcessor")).
+			To(BeAssignableToTypeOf(&cp.CommandProcessor{}))
+		Expect(s.GetComponentByName("GPU[2].CommandProcessor")).
+			To(BeAssignableToTypeOf(&cp.CommandProcessor{}))
+	})
+
+	It("should let a kernel copy the memory of another GPU", func() {
+		_, d := buildPlatform(timingconfig.MakeBuilder().WithNumGPUs(2))
+
+		const byteSize = 8192
+		data := make([]byte, byteSize)
+		for i := range data {
+			data[i] = byte(i*7 + 3)
+		}
+
+		ctx := d.Init()
+		d.SelectGPU(ctx, 2)
+		src := d.AllocateMemory(ctx, byteSize)
+		d.MemCopyH2D(ctx, src, data)
+
+		d.SelectGPU(ctx, 1)
+		dst := d.AllocateMemory(ctx, byteSize)
+		d.MemCopyH2D(ctx, dst, make([]byte, byteSize))
+
+		queue := d.CreateCommandQueue(ctx)
+		d.EnqueueMemCopyD2DWithKernel(queue, dst, src, byteSize)
+		d.DrainCommandQueue(queue)
+
+		res := make([]byte, byteSize)
+		d.MemCopyD2H(ctx, res, dst)
+		Expect(res).To(Equal(data))
+	})
+
+	It("should not build cache policy filters without the cache hints",
+		func() {
+			s, _ := buildPlatform(timingconfig.MakeBuilder().WithNumGPUs(1))
+
+			for _, c := range s.Components() {
+				Expect(c).NotTo(BeAssignableToTypeOf(&cachepolicy.Comp{}))
+			}
+		})
+
+	It("should build cache policy filters with the cache hints", func() {
+		s, _ := buildPlatform(timingconfig.MakeBuilder().
+			WithNumGPUs(1).
+			WithGPUBuilder(r9nano.MakeBuilder().WithCacheHints(true)))
+
+		Expect(s.GetComponentByName("GPU[1].L2Policy[0]")).
+			To(BeAssignableToTypeOf(&cachepolicy.Comp{}))
+		Expect(s.GetComponentByName("GPU[1].SA[0].L1VPolicy[0]")).
+			To(BeAssignableToTypeOf(&cachepolicy.Comp{}))
+	})
+
+	It("should refuse the L1 replacement policies that are not supported",
+		func() {
+			config := shaderarray.DefaultL1VCacheConfig()
+			config.ReplacementPolicy = "random"
+
+			Expect(func() {
+				buildPlatform(timingconfig.MakeBuilder().
+					WithNumGPUs(1).
+					WithGPUBuilder(r9nano.MakeBuilder().WithL1VCache(config)))
+			}).To(PanicWith(ContainSubstring(`replacement policy "random"`)))
+		})
+
+	DescribeTable("should run kernels on the detailed DRAM",
+		func(dramType, pagePolicy string) {
+			s, d := buildPlatform(timingconfig.MakeBuilder().
+				WithNumGPUs(1).
+				WithGPUBuilder(r9nano.MakeBuilder().
+					WithDRAMType(dramType).
+					WithDRAMPagePolicy(pagePolicy)))
+
+			const byteSize = 64 * 1024
+			data := make([]byte, byteSize)
+			for i := range data {
+				data[i] = byte(i*3 + 1)
+			}
+
+			ctx := d.Init()
+			src := d.AllocateMemory(ctx, byteSize)
+			dst := d.AllocateMemory(ctx, byteSize)
+			d.MemCopyH2D(ctx, src, data)
+
+			queue := d.CreateCommandQueue(ctx)
+			d.EnqueueMemCopyD2DWithKernel(queue, dst, src, byteSize)
+			d.DrainCommandQueue(queue)
+
+			res := make([]byte, byteSize)
+			d.MemCopyD2H(ctx, res, dst)
+			Expect(res).To(Equal(data))
+
+			ctrl := s.GetComponentByName("GPU[1].DRAM[0]").(*dram.Comp)
+			stats := dramtracer.Find(ctrl)
+			Expect(stats.NumAccesses()).To(BeNumerically(">", 0))
+			if pagePolicy == "open" {
+				Expect(stats.RowBufferHitRate()).To(BeNumerically(">", 0))
+			} else {
+				Expect(stats.RowBufferHitRate()).To(Equal(0.0))
+			}
+		},
+		Entry("HBM2 with open pages", "hbm2", "open"),
+		Entry("GDDR5 with open pages", "gddr5", "open"),
+		Entry("GDDR6 with closed pages", "gddr6", "close"),
+	)
+})
@@ -0,0 +1,44 @@
+package timingconfig_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sarchlab/mgpusim/v4/amd/driver"
+	"github.com/sarchlab/mgpusim/v4/amd/samples/runner/timingconfig"
+)
+
+var _ = Describe("Preemption", func() {
+	It("should save the running work-groups and restore them", func() {
+		_, d := buildPlatform(timingconfig.MakeBuilder().WithNumGPUs(1))
+
+		const byteSize = 256 * 1024
+		data := make([]byte, byteSize)
+		for i := range data {
+			data[i] = byte(i*5 + 7)
+		}
+
+		ctx := d.Init()
+		src := d.AllocateMemory(ctx, byteSize)
+		dst := d.AllocateMemory(ctx, byteSize)
+		d.MemCopyH2D(ctx, src, data)
+
+		kernelQueue := d.CreateCommandQueue(ctx)
+		ctrlQueue := d.CreateCommandQueue(ctx)
+		d.EnqueueMemCopyD2DWithKernel(kernelQueue, dst, src, byteSize)
+
+		// The host function gives the kernel time to fill the CUs.
+		d.EnqueueHostFunc(ctrlQueue, nil)
+		cmd := d.EnqueuePreemptKernel(
+			ctrlQueue, kernelQueue, driver.PreemptionModeSaveState)
+		d.EnqueueResumeKernel(ctrlQueue, kernelQueue)
+		d.DrainCommandQueue(ctrlQueue)
+		d.DrainCommandQueue(kernelQueue)
+
+		Expect(cmd.Preempted).To(BeTrue())
+		Expect(cmd.SavedByteSize).To(BeNumerically(">", 0))
+
+		result := make([]byte, byteSize)
+		d.MemCopyD2H(ctx, result, dst)
+		Expect(result).To(Equal(data))
+	})
+})
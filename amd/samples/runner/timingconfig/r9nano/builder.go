@@ -6,18 +6,25 @@ import (
 	"fmt"
 
 	"github.com/sarchlab/akita/v4/mem/cache/writeback"
-	"github.com/sarchlab/akita/v4/mem/dram"
-	"github.com/sarchlab/akita/v4/mem/idealmemcontroller"
 	"github.com/sarchlab/akita/v4/mem/mem"
 	"github.com/sarchlab/akita/v4/mem/vm/mmu"
 	"github.com/sarchlab/akita/v4/mem/vm/tlb"
 	"github.com/sarchlab/akita/v4/sim"
 	"github.com/sarchlab/akita/v4/sim/directconnection"
 	"github.com/sarchlab/akita/v4/simulation"
+	"github.com/sarchlab/mgpusim/v4/amd/driver"
 	"github.com/sarchlab/mgpusim/v4/amd/samples/runner/timingconfig/shaderarray"
+	"github.com/sarchlab/mgpusim/v4/amd/timing/accesscounter"
+	"github.com/sarchlab/mgpusim/v4/amd/timing/cachepolicy"
+	"github.com/sarchlab/mgpusim/v4/amd/timing/coherence"
 	"github.com/sarchlab/mgpusim/v4/amd/timing/cp"
+	"github.com/sarchlab/mgpusim/v4/amd/timing/cu"
+	"github.com/sarchlab/mgpusim/v4/amd/timing/hostmemory"
 	"github.com/sarchlab/mgpusim/v4/amd/timing/pagemigrationcontroller"
+	"github.com/sarchlab/mgpusim/v4/amd/timing/pagewalker"
+	"github.com/sarchlab/mgpusim/v4/amd/timing/prefetcher"
 	"github.com/sarchlab/mgpusim/v4/amd/timing/rdma"
+	"github.com/sarchlab/mgpusim/v4/amd/timing/tlbcontrol"
 )
 
 // Builder builds a hardware platform for timing simulation.
@@ -38,22 +45,70 @@ type Builder struct {
 	dramSize                       uint64
 	globalStorage                  *mem.Storage
 	mmu                            *mmu.Comp
+	driver                         *driver.Driver
 	rdmaAddressMapper              mem.AddressToPortMapper
+	rdmaDeviceTable                *rdma.DeviceTable
+	numHWQueues                    int
+	cpSchedulingPolicy             string
+	dispatchingAlg                 string
+	gridBarrierPollInterval        int
+	hostLink                       string
+	numCopyEngines                 int
+	numDMAChannels                 int
+	hostMemory                     *hostmemory.Comp
+	dramType                       string
+	dramPagePolicy                 string
+	dramAddressMapping             string
+	coherenceMode                  string
+	cacheHints                     bool
+	leaseCycles                    int
+	l1vPrefetchPolicy              string
+	l2PrefetchPolicy               string
+	prefetchDegree                 int
+	maxInflightPrefetches          int
+	prefetchAccuracyThreshold      float64
+	l1vCacheConfig                 shaderarray.L1CacheConfig
+	l1sCacheConfig                 shaderarray.L1CacheConfig
+	l1iCacheConfig                 shaderarray.L1CacheConfig
+	sharedL1V                      bool
+	rdmaLink                       string
+	rdmaRemoteCacheSize            uint64
+	rdmaRemoteCacheWays            int
+	pmcTransferSize                uint64
+	pmcMaxMigrations               int
+	pmcMaxInflightChunks           int
+	accessCounterThreshold         uint32
+	accessCounterBits              int
+	accessCounterDecayInterval     uint64
+	l1vTLBConfig                   shaderarray.TLBConfig
+	l1sTLBConfig                   shaderarray.TLBConfig
+	l1iTLBConfig                   shaderarray.TLBConfig
+	l2TLBConfig                    shaderarray.TLBConfig
+	pageWalkerThreads              int
+	pageWalkCacheEntries           int
+	sharedTLB                      sim.RemotePort
+	sharedTLBCtrl                  sim.Port
 
 	gpu                *sim.Domain
 	cp                 *cp.CommandProcessor
 	rdmaEngine         *rdma.Comp
 	pmc                *pagemigrationcontroller.PageMigrationController
+	accessCounter      *accesscounter.Comp
 	dmaEngine          *cp.DMAEngine
 	sas                []*sim.Domain
 	l2Caches           []*writeback.Comp
+	l2Prefetchers      []*prefetcher.Comp
+	l2PolicyFilters    []*cachepolicy.Comp
 	l2TLBs             []*tlb.Comp
+	pageWalker         *pagewalker.Comp
 	drams              []sim.Component
 	internalConn       *directconnection.Comp
 	l2ToDramConnection *directconnection.Comp
 	l1AddressMapper    *mem.InterleavedAddressPortMapper
 	l1TLBAddressMapper *mem.SinglePortMapper
 	pmcAddressMapper   mem.AddressToPortMapper
+	coherenceDirectory *mem.SinglePortMapper
+	sharerDirectory    *coherence.Directory
 }
 
 // MakeBuilder creates a new builder.
@@ -69,6 +124,32 @@ func MakeBuilder() Builder {
 		log2MemoryBankInterleavingSize: 7,
 		memAddrOffset:                  0,
 		dramSize:                       4 * mem.GB,
+		numHWQueues:                    8,
+		cpSchedulingPolicy:             "fifo",
+		dispatchingAlg:                 "round-robin",
+		gridBarrierPollInterval:        64,
+		hostLink:                       "ideal",
+		numCopyEngines:                 4,
+		dramType:                       "ideal",
+		dramPagePolicy:                 "open",
+		dramAddressMapping:             "row-rank-bank-column-bankgroup",
+		coherenceMode:                  "none",
+		leaseCycles:                    1000,
+		l1vPrefetchPolicy:              "none",
+		l2PrefetchPolicy:               "none",
+		prefetchDegree:                 2,
+		maxInflightPrefetches:          8,
+		l1vCacheConfig:                 shaderarray.DefaultL1VCacheConfig(),
+		l1sCacheConfig:                 shaderarray.DefaultL1SCacheConfig(),
+		l1iCacheConfig:                 shaderarray.DefaultL1ICacheConfig(),
+		rdmaLink:                       "none",
+		pmcTransferSize:                64,
+		pmcMaxMigrations:               4,
+		pmcMaxInflightChunks:           16,
+		l1vTLBConfig:                   shaderarray.DefaultL1TLBConfig(),
+		l1sTLBConfig:                   shaderarray.DefaultL1TLBConfig(),
+		l1iTLBConfig:                   shaderarray.DefaultL1TLBConfig(),
+		l2TLBConfig:                    DefaultL2TLBConfig(),
 	}
 }
 
@@ -151,6 +232,12 @@ func (b Builder) WithMMU(mmu *mmu.Comp) Builder {
 	return b
 }
 
+// WithDriver sets the GPU driver that the command processor responds to.
+func (b Builder) WithDriver(d *driver.Driver) Builder {
+	b.driver = d
+	return b
+}
+
 // WithGlobalStorage sets the global storage that can provide the ultimate address translation.
 func (b Builder) WithGlobalStorage(
 	globalStorage *mem.Storage,
@@ -171,6 +258,305 @@ func (b Builder) WithRDMAAddressMapper(mapper mem.AddressToPortMapper) Builder {
 	return b
 }
 
+// WithRDMADeviceTable sets the table that finds the device that owns each
+// port that the RDMA engine sends to, so that the RDMA engine models one link
+// to each device.
+func (b Builder) WithRDMADeviceTable(devices *rdma.DeviceTable) Builder {
+	b.rdmaDeviceTable = devices
+	return b
+}
+
+// WithPMCAddressMapper sets the mapper that finds the page migration
+// controller of the device that holds a page.
+func (b Builder) WithPMCAddressMapper(mapper mem.AddressToPortMapper) Builder {
+	b.pmcAddressMapper = mapper
+	return b
+}
+
+// WithNumHWQueues sets the number of hardware queues in the Command Processor.
+func (b Builder) WithNumHWQueues(n int) Builder {
+	b.numHWQueues = n
+	return b
+}
+
+// WithCPSchedulingPolicy sets how the Command Processor schedules the kernels
+// from different hardware queues. The policy can be "fifo", "priority",
+// "spatial", or "fair-share".
+func (b Builder) WithCPSchedulingPolicy(policy string) Builder {
+	b.cpSchedulingPolicy = policy
+	return b
+}
+
+// WithDispatchingAlg sets how the Command Processor dispatches work-groups to
+// CUs. The algorithm can be "round-robin", "greedy", "partition",
+// "shader-array-affinity", "throttling", or "batch-interleaved".
+func (b Builder) WithDispatchingAlg(alg string) Builder {
+	b.dispatchingAlg = alg
+	return b
+}
+
+// WithGridBarrierPollInterval sets the number of cycles between two reads of
+// the arrival counter by a work-group that waits at a grid barrier.
+func (b Builder) WithGridBarrierPollInterval(cycles int) Builder {
+	b.gridBarrierPollInterval = cycles
+	return b
+}
+
+// WithHostLink sets the link between the host and the GPU that the memory
+// copies go through. The link can be "ideal", "pcie3", "pcie4", or "pcie5".
+func (b Builder) WithHostLink(link string) Builder {
+	b.hostLink = link
+	return b
+}
+
+// WithNumCopyEngines sets the number of memory copies that the DMA engine can
+// process at the same time.
+func (b Builder) WithNumCopyEngines(n int) Builder {
+	b.numCopyEngines = n
+	return b
+}
+
+// WithNumDMAChannels sets the number of memory accesses that each copy engine
+// can keep in flight. 0 means unlimited.
+func (b Builder) WithNumDMAChannels(n int) Builder {
+	b.numDMAChannels = n
+	return b
+}
+
+// WithHostMemory sets the host memory that the kernels can access directly.
+// The accesses share the host link with the memory copies of the GPU. The RDMA
+// address mapper needs to map the host memory addresses to the host memory.
+func (b Builder) WithHostMemory(hostMemory *hostmemory.Comp) Builder {
+	b.hostMemory = hostMemory
+	return b
+}
+
+// WithDRAMType sets the memory technology of the DRAM controllers. It can be
+// "ideal", "hbm2", "gddr5", or "gddr6". The ideal controllers respond after a
+// fixed latency, while the others model the banks, the row buffers, the
+// refreshes, and the timing constraints of the technology.
+func (b Builder) WithDRAMType(dramType string) Builder {
+	b.dramType = dramType
+	return b
+}
+
+// WithDRAMPagePolicy sets whether the DRAM controllers keep the rows open
+// after the accesses. It can be "open" or "close". It does not apply to the
+// ideal controllers.
+func (b Builder) WithDRAMPagePolicy(policy string) Builder {
+	b.dramPagePolicy = policy
+	return b
+}
+
+// WithDRAMAddressMapping sets how the DRAM controllers map the address to the
+// channel, the rank, the bank group, the bank, the row, and the column. The
+// mapping lists "channel", "rank", "bankgroup", "bank", "row", and "column"
+// from the highest bits to the lowest bits, separated by "-". The items that
+// have only one instance can be left out. The bits that interleave the
+// controllers are removed before the mapping. It does not apply to the ideal
+// controllers.
+func (b Builder) WithDRAMAddressMapping(mapping string) Builder {
+	b.dramAddressMapping = mapping
+	return b
+}
+
+// WithCoherenceMode sets how the L1 vector caches stay coherent with the
+// memory of the other GPUs. It can be "none", "no-remote-caching", "lease", or
+// "directory". In the directory mode, the RDMA engine tracks which GPUs have
+// read the local cache lines and invalidates the lines in the L1 vector caches
+// of those GPUs that have read them when the lines are written.
+func (b Builder) WithCoherenceMode(mode string) Builder {
+	b.coherenceMode = mode
+	return b
+}
+
+// WithCacheHints lets the vector memory accesses follow the GLC and the SLC
+// bits. The accesses that set either bit bypass the L1 vector caches, and the
+// accesses that set the SLC bit do not allocate lines in the L2 caches.
+// Without it, the caches ignore the hints, and no policy filter is built in
+// front of them.
+func (b Builder) WithCacheHints(enabled bool) Builder {
+	b.cacheHints = enabled
+	return b
+}
+
+// WithLeaseCycles sets the number of cycles that the L1 vector caches can keep
+// the data from the other GPUs in the lease mode.
+func (b Builder) WithLeaseCycles(n int) Builder {
+	b.leaseCycles = n
+	return b
+}
+
+// WithL1VPrefetcher sets the policy of the prefetchers in front of the L1
+// vector caches. It can be "none", "next-line", "stride", or "stream".
+func (b Builder) WithL1VPrefetcher(policy string) Builder {
+	b.l1vPrefetchPolicy = policy
+	return b
+}
+
+// WithL2Prefetcher sets the policy of the prefetchers in front of the L2
+// caches. It can be "none", "next-line", "stride", or "stream". The L1 caches
+// do not pass the PC of the instructions to the L2 caches, so the stride
+// policy can only find the strides between all the reads of a bank.
+func (b Builder) WithL2Prefetcher(policy string) Builder {
+	b.l2PrefetchPolicy = policy
+	return b
+}
+
+// WithPrefetchDegree sets the maximum number of lines that a prefetcher
+// fetches after each read.
+func (b Builder) WithPrefetchDegree(n int) Builder {
+	b.prefetchDegree = n
+	return b
+}
+
+// WithMaxInflightPrefetches sets the number of prefetches that each
+// prefetcher can keep in flight.
+func (b Builder) WithMaxInflightPrefetches(n int) Builder {
+	b.maxInflightPrefetches = n
+	return b
+}
+
+// WithPrefetchAccuracyThreshold sets the accuracy below which the prefetchers
+// fetch fewer lines after each read. A threshold of 0 disables the
+// throttling.
+func (b Builder) WithPrefetchAccuracyThreshold(threshold float64) Builder {
+	b.prefetchAccuracyThreshold = threshold
+	return b
+}
+
+// WithL1VCache sets the organization of the L1 vector caches.
+func (b Builder) WithL1VCache(config shaderarray.L1CacheConfig) Builder {
+	b.l1vCacheConfig = config
+	return b
+}
+
+// WithL1SCache sets the organization of the L1 scalar caches.
+func (b Builder) WithL1SCache(config shaderarray.L1CacheConfig) Builder {
+	b.l1sCacheConfig = config
+	return b
+}
+
+// WithL1ICache sets the organization of the L1 instruction caches.
+func (b Builder) WithL1ICache(config shaderarray.L1CacheConfig) Builder {
+	b.l1iCacheConfig = config
+	return b
+}
+
+// WithSharedL1VCache sets whether the CUs of each shader array share a single
+// L1 vector cache, instead of having a private one each.
+func (b Builder) WithSharedL1VCache(shared bool) Builder {
+	b.sharedL1V = shared
+	return b
+}
+
+// WithRDMALink sets the link that the RDMA engine reaches the other GPUs
+// through. It can be "none", "ideal", "pcie3", "pcie4", "pcie5", "nvlink", or
+// "xgmi". Each direction of the link between two GPUs is modeled by the RDMA
+// engine that sends over it. The accesses to the host memory go through the
+// host link instead.
+func (b Builder) WithRDMALink(link string) Builder {
+	b.rdmaLink = link
+	return b
+}
+
+// WithPageMigrationTransferSize sets the number of bytes that the page
+// migration controller pulls from the other GPUs at a time.
+func (b Builder) WithPageMigrationTransferSize(byteSize uint64) Builder {
+	b.pmcTransferSize = byteSize
+	return b
+}
+
+// WithMaxOutstandingPageMigrations sets the number of page migrations that
+// the page migration controller performs at the same time.
+func (b Builder) WithMaxOutstandingPageMigrations(n int) Builder {
+	b.pmcMaxMigrations = n
+	return b
+}
+
+// WithMaxInflightMigrationChunks sets the number of chunks of a page that the
+// page migration controller keeps in flight, which overlaps reading the
+// remote memory, crossing the link, and writing the local memory.
+func (b Builder) WithMaxInflightMigrationChunks(n int) Builder {
+	b.pmcMaxInflightChunks = n
+	return b
+}
+
+// WithRDMARemoteCache lets the RDMA engine cache the data that the GPU reads
+// from the other GPUs, so that the L1 misses that hit in the cache do not
+// cross the fabric. The cache is invalidated before each kernel and after
+// each page migration. A size of 0 disables the cache.
+func (b Builder) WithRDMARemoteCache(
+	byteSize uint64,
+	wayAssociativity int,
+) Builder {
+	b.rdmaRemoteCacheSize = byteSize
+	b.rdmaRemoteCacheWays = wayAssociativity
+	return b
+}
+
+// WithAccessCounters lets the GPU count its accesses to the pages in the
+// memory of the other devices, as seen by the RDMA engine.
+// The driver is notified when the count of a page reaches the threshold.
+// The counters have the given width in bits and are halved every
+// decayInterval cycles. A threshold of 0 disables the counters.
+func (b Builder) WithAccessCounters(
+	threshold uint32,
+	counterBits int,
+	decayInterval uint64,
+) Builder {
+	b.accessCounterThreshold = threshold
+	b.accessCounterBits = counterBits
+	b.accessCounterDecayInterval = decayInterval
+	return b
+}
+
+// WithL1VTLB sets the organization of the L1 vector TLBs.
+func (b Builder) WithL1VTLB(config shaderarray.TLBConfig) Builder {
+	b.l1vTLBConfig = config
+	return b
+}
+
+// WithL1STLB sets the organization of the L1 scalar TLBs.
+func (b Builder) WithL1STLB(config shaderarray.TLBConfig) Builder {
+	b.l1sTLBConfig = config
+	return b
+}
+
+// WithL1ITLB sets the organization of the L1 instruction TLBs.
+func (b Builder) WithL1ITLB(config shaderarray.TLBConfig) Builder {
+	b.l1iTLBConfig = config
+	return b
+}
+
+// WithL2TLB sets the organization of the L2 TLB. If the number of sets is 0,
+// the L2 TLB has enough sets to cover the whole DRAM of the GPU.
+func (b Builder) WithL2TLB(config shaderarray.TLBConfig) Builder {
+	b.l2TLBConfig = config
+	return b
+}
+
+// WithPageWalker puts a page-table walker with the given number of threads
+// between the L2 TLB and the MMU, so that the misses of the L2 TLB pay for
+// the page walks. The walker keeps a page walk cache of the given number of
+// entries. A number of threads of 0 disables the walker.
+func (b Builder) WithPageWalker(numThreads, pageWalkCacheEntries int) Builder {
+	b.pageWalkerThreads = numThreads
+	b.pageWalkCacheEntries = pageWalkCacheEntries
+	return b
+}
+
+// WithSharedTLB sends the misses of the L2 TLB to a TLB that the GPUs share,
+// such as the one of an IOMMU, instead of the MMU. The Command Processor
+// shoots down the shared TLB through the given control port, which the GPU
+// plugs into its internal connection. The shared TLB walks the page table for
+// the GPU, so it cannot be used with a page walker of the GPU.
+func (b Builder) WithSharedTLB(top sim.RemotePort, ctrl sim.Port) Builder {
+	b.sharedTLB = top
+	b.sharedTLBCtrl = ctrl
+	return b
+}
+
 // Build builds the hardware platform.
 func (b Builder) Build(name string) *sim.Domain {
 	b.name = name
@@ -184,17 +570,27 @@ func (b Builder) Build(name string) *sim.Domain {
 	b.l1AddressMapper.UseAddressSpaceLimitation = true
 
 	b.l1TLBAddressMapper = &mem.SinglePortMapper{}
+	b.coherenceDirectory = &mem.SinglePortMapper{}
+	if b.coherenceMode == "directory" {
+		b.sharerDirectory = coherence.NewDirectory(b.log2CacheLineSize)
+	}
 
 	b.buildSAs()
 	b.buildDRAMControllers()
 	b.buildL2Caches()
+	b.buildL2PolicyFilters()
+	b.buildL2Prefetchers()
 	b.buildCP()
+	b.buildPageWalker()
 	b.buildL2TLB()
 
 	b.connectCP()
 	b.connectL2AndDRAM()
 	b.connectL1ToL2()
+	b.connectL2PolicyFilters()
+	b.connectL2Prefetchers()
 	b.connectL1TLBToL2TLB()
+	b.connectL2TLBToPageWalker()
 
 	b.populateExternalPorts()
 
@@ -209,6 +605,11 @@ func (b *Builder) populateExternalPorts() {
 	b.gpu.AddPort("PageMigrationController",
 		b.pmc.GetPortByName("Remote"))
 
+	if b.pageWalker != nil {
+		b.gpu.AddPort("Translation_00", b.pageWalker.GetPortByName("Bottom"))
+		return
+	}
+
 	for i, l2TLB := range b.l2TLBs {
 		name := fmt.Sprintf("Translation_%02d", i)
 		b.gpu.AddPort(name, l2TLB.GetPortByName("Bottom"))
@@ -240,6 +641,12 @@ func (b *Builder) connectCP() {
 	b.cp.PMC = pmcControlPort
 	b.internalConn.PlugIn(pmcControlPort)
 
+	if b.accessCounter != nil {
+		b.internalConn.PlugIn(b.cp.ToAccessCounter)
+		b.accessCounter.CP = b.cp.ToAccessCounter.AsRemote()
+		b.internalConn.PlugIn(b.accessCounter.GetPortByName("ToCP"))
+	}
+
 	b.connectCPWithCUs()
 	b.connectCPWithAddressTranslators()
 	b.connectCPWithTLBs()
@@ -257,21 +664,99 @@ func (b *Builder) connectL1ToL2() {
 	l1ToL2Conn.PlugIn(b.rdmaEngine.RDMARequestInside)
 	l1ToL2Conn.PlugIn(b.rdmaEngine.RDMADataInside)
 
-	for _, l2 := range b.l2Caches {
-		l1ToL2Conn.PlugIn(l2.GetPortByName("Top"))
+	b.dmaEngine.ToRemote = sim.NewPort(b.dmaEngine, 64, 64,
+		b.dmaEngine.Name()+".ToRemote")
+	b.dmaEngine.SetRemoteDataSource(
+		&mem.SinglePortMapper{Port: b.rdmaEngine.RDMARequestInside.AsRemote()},
+		b.memAddrOffset, b.memAddrOffset+b.dramSize)
+	l1ToL2Conn.PlugIn(b.dmaEngine.ToRemote)
+
+	b.cp.DeviceQueueMemory = b.l1AddressMapper
+	l1ToL2Conn.PlugIn(b.cp.ToMem)
+
+	for i := range b.l2Caches {
+		if b.l2Prefetchers != nil {
+			l1ToL2Conn.PlugIn(b.l2Prefetchers[i].GetPortByName("Top"))
+			continue
+		}
+
+		l1ToL2Conn.PlugIn(b.l2Front(i))
 	}
 
 	for _, sa := range b.sas {
-		for i := range b.numCUPerShaderArray {
+		for i := range b.numL1VCachePerShaderArray() {
 			l1ToL2Conn.PlugIn(
 				sa.GetPortByName(fmt.Sprintf("L1VCacheBottom[%d]", i)))
 		}
 
+		if b.cacheHints {
+			for i := range b.numL1VCachePerShaderArray() {
+				l1ToL2Conn.PlugIn(
+					sa.GetPortByName(fmt.Sprintf("L1VPolicyBottom[%d]", i)))
+			}
+		}
+
+		if b.coherenceMode != "none" {
+			for i := range b.numL1VCachePerShaderArray() {
+				filter := sa.GetPortByName(
+					fmt.Sprintf("L1VCoherenceBottom[%d]", i))
+				cache := sa.GetPortByName(
+					fmt.Sprintf("L1VCacheBottom[%d]", i))
+				l1ToL2Conn.PlugIn(filter)
+				b.rdmaEngine.AddInvalidationListener(
+					filter.AsRemote(), cache.AsRemote())
+			}
+		}
+
 		l1ToL2Conn.PlugIn(sa.GetPortByName("L1SCacheBottom"))
 		l1ToL2Conn.PlugIn(sa.GetPortByName("L1ICacheBottom"))
 	}
 }
 
+func (b *Builder) connectL2Prefetchers() {
+	if b.l2Prefetchers == nil {
+		return
+	}
+
+	conn := directconnection.MakeBuilder().
+		WithEngine(b.simulation.GetEngine()).
+		WithFreq(b.freq).
+		Build(b.name + ".L2Prefetch")
+	b.simulation.RegisterComponent(conn)
+
+	for i, p := range b.l2Prefetchers {
+		conn.PlugIn(p.GetPortByName("Bottom"))
+		conn.PlugIn(b.l2Front(i))
+	}
+}
+
+// l2Front returns the port that the requests to the i-th L2 cache enter,
+// which is the top port of the policy filter if there is one.
+func (b *Builder) l2Front(i int) sim.Port {
+	if b.l2PolicyFilters != nil {
+		return b.l2PolicyFilters[i].GetPortByName("Top")
+	}
+
+	return b.l2Caches[i].GetPortByName("Top")
+}
+
+func (b *Builder) connectL2PolicyFilters() {
+	if b.l2PolicyFilters == nil {
+		return
+	}
+
+	conn := directconnection.MakeBuilder().
+		WithEngine(b.simulation.GetEngine()).
+		WithFreq(b.freq).
+		Build(b.name + ".L2Policy")
+	b.simulation.RegisterComponent(conn)
+
+	for i, filter := range b.l2PolicyFilters {
+		conn.PlugIn(filter.GetPortByName("ToCache"))
+		conn.PlugIn(b.l2Caches[i].GetPortByName("Top"))
+	}
+}
+
 func (b *Builder) connectL2AndDRAM() {
 	b.l2ToDramConnection = directconnection.MakeBuilder().
 		WithEngine(b.simulation.GetEngine()).
@@ -284,6 +769,10 @@ func (b *Builder) connectL2AndDRAM() {
 
 	for i, l2 := range b.l2Caches {
 		b.l2ToDramConnection.PlugIn(l2.GetPortByName("Bottom"))
+		if b.l2PolicyFilters != nil {
+			b.l2ToDramConnection.PlugIn(
+				b.l2PolicyFilters[i].GetPortByName("Bottom"))
+		}
 		l2.SetAddressToPortMapper(&mem.SinglePortMapper{
 			Port: b.drams[i].GetPortByName("Top").AsRemote(),
 		})
@@ -379,18 +868,35 @@ func (b *Builder) connectCPWithCUs() {
 	}
 }
 
+// connectCPWithAddressTranslators lets the CP discard the transactions of the
+// address translators and the reorder buffers during a TLB shootdown. Both
+// take the same control messages. The CUs replay their in-flight accesses
+// after the restart, so a reorder buffer that kept the discarded transactions
+// would wait for responses that never arrive.
 func (b *Builder) connectCPWithAddressTranslators() {
 	for _, sa := range b.sas {
 		for i := range b.numCUPerShaderArray {
+			rob := sa.GetPortByName(fmt.Sprintf("L1VROBCtrl[%d]", i))
+			b.cp.AddressTranslators = append(b.cp.AddressTranslators, rob)
+			b.internalConn.PlugIn(rob)
+
 			at := sa.GetPortByName(fmt.Sprintf("L1VAddrTransCtrl[%d]", i))
 			b.cp.AddressTranslators = append(b.cp.AddressTranslators, at)
 			b.internalConn.PlugIn(at)
 		}
 
+		l1sROB := sa.GetPortByName("L1SROBCtrl")
+		b.cp.AddressTranslators = append(b.cp.AddressTranslators, l1sROB)
+		b.internalConn.PlugIn(l1sROB)
+
 		l1sAT := sa.GetPortByName("L1SAddrTransCtrl")
 		b.cp.AddressTranslators = append(b.cp.AddressTranslators, l1sAT)
 		b.internalConn.PlugIn(l1sAT)
 
+		l1iROB := sa.GetPortByName("L1IROBCtrl")
+		b.cp.AddressTranslators = append(b.cp.AddressTranslators, l1iROB)
+		b.internalConn.PlugIn(l1iROB)
+
 		l1iAT := sa.GetPortByName("L1IAddrTransCtrl")
 		b.cp.AddressTranslators = append(b.cp.AddressTranslators, l1iAT)
 		b.internalConn.PlugIn(l1iAT)
@@ -419,14 +925,46 @@ func (b *Builder) connectCPWithTLBs() {
 		b.cp.TLBs = append(b.cp.TLBs, ctrlPort)
 		b.internalConn.PlugIn(ctrlPort)
 	}
+
+	// The page walk cache and the shared TLB are shot down with the TLBs.
+	if b.pageWalker != nil {
+		ctrlPort := b.pageWalker.GetPortByName("Control")
+		b.cp.TLBs = append(b.cp.TLBs, ctrlPort)
+		b.internalConn.PlugIn(ctrlPort)
+	}
+
+	if b.sharedTLBCtrl != nil {
+		b.cp.TLBs = append(b.cp.TLBs, b.sharedTLBCtrl)
+		b.internalConn.PlugIn(b.sharedTLBCtrl)
+	}
 }
 
 func (b *Builder) connectCPWithCaches() {
 	for _, sa := range b.sas {
+		firstL1V := len(b.cp.L1VCaches)
 		for i := range b.numCUPerShaderArray {
+			l1v := firstL1V
+			if !b.sharedL1V {
+				l1v += i
+			}
+
+			b.cp.L1VCacheOfCU = append(b.cp.L1VCacheOfCU, l1v)
+		}
+
+		for i := range b.numL1VCachePerShaderArray() {
 			cache := sa.GetPortByName(fmt.Sprintf("L1VCacheCtrl[%d]", i))
 			b.cp.L1VCaches = append(b.cp.L1VCaches, cache)
 			b.internalConn.PlugIn(cache)
+
+			if b.cacheHints {
+				b.internalConn.PlugIn(sa.GetPortByName(
+					fmt.Sprintf("L1VPolicyCtrl[%d]", i)))
+			}
+
+			if b.coherenceMode != "none" {
+				b.internalConn.PlugIn(sa.GetPortByName(
+					fmt.Sprintf("L1VCoherenceCtrl[%d]", i)))
+			}
 		}
 
 		l1sCache := sa.GetPortByName("L1SCacheCtrl")
@@ -454,7 +992,25 @@ func (b *Builder) buildSAs() {
 		WithLog2CacheLineSize(b.log2CacheLineSize).
 		WithLog2PageSize(b.log2PageSize).
 		WithL1AddressMapper(b.l1AddressMapper).
-		WithL1TLBAddressMapper(b.l1TLBAddressMapper)
+		WithL1TLBAddressMapper(b.l1TLBAddressMapper).
+		WithGridBarrier(b.buildGridBarrier()).
+		WithCoherenceMode(b.coherenceMode).
+		WithCacheHints(b.cacheHints).
+		WithLeaseCycles(b.leaseCycles).
+		WithLocalAddressRange(b.memAddrOffset, b.memAddrOffset+b.dramSize).
+		WithCoherenceDirectory(b.coherenceDirectory).
+		WithSharerDirectory(b.sharerDirectory).
+		WithL1VPrefetcher(b.l1vPrefetchPolicy).
+		WithPrefetchDegree(b.prefetchDegree).
+		WithMaxInflightPrefetches(b.maxInflightPrefetches).
+		WithPrefetchAccuracyThreshold(b.prefetchAccuracyThreshold).
+		WithL1VCache(b.l1vCacheConfig).
+		WithL1SCache(b.l1sCacheConfig).
+		WithL1ICache(b.l1iCacheConfig).
+		WithSharedL1VCache(b.sharedL1V).
+		WithL1VTLB(b.l1vTLBConfig).
+		WithL1STLB(b.l1sTLBConfig).
+		WithL1ITLB(b.l1iTLBConfig)
 
 	// if b.enableISADebugging {
 	// 	saBuilder = saBuilder.withIsaDebugging()
@@ -472,6 +1028,13 @@ func (b *Builder) buildSAs() {
 	}
 }
 
+func (b *Builder) buildGridBarrier() *cu.GridBarrier {
+	gridBarrier := cu.NewGridBarrier()
+	gridBarrier.PollInterval = b.gridBarrierPollInterval
+
+	return gridBarrier
+}
+
 func (b *Builder) buildL2Caches() {
 	byteSize := b.l2CacheSize / uint64(b.numMemoryBank)
 	l2Builder := writeback.MakeBuilder().
@@ -507,94 +1070,111 @@ func (b *Builder) buildL2Caches() {
 	}
 }
 
-func (b *Builder) buildDRAMControllers() {
-	// memCtrlBuilder := b.createDramControllerBuilder()
+// buildL2PolicyFilters builds a policy filter in front of each L2 cache, which
+// sends the SLC accesses to the DRAM controller of the cache. The L1 caches
+// and the RDMA engine send the requests to the filters instead of the L2
+// caches. No filter is built if the cache hints are disabled.
+func (b *Builder) buildL2PolicyFilters() {
+	if !b.cacheHints {
+		return
+	}
 
-	for i := 0; i < b.numMemoryBank; i++ {
-		dramName := fmt.Sprintf("%s.DRAM[%d]", b.name, i)
-		dram := idealmemcontroller.MakeBuilder().
-			WithEngine(b.simulation.GetEngine()).
-			WithFreq(b.freq).
-			WithLatency(100).
-			WithStorage(b.globalStorage).
-			Build(dramName)
-		b.simulation.RegisterComponent(dram)
-		b.drams = append(b.drams, dram)
+	builder := cachepolicy.MakeBuilder().
+		WithEngine(b.simulation.GetEngine()).
+		WithFreq(b.freq).
+		WithLevel("l2").
+		WithLog2LineSize(b.log2CacheLineSize).
+		WithNumReqPerCycle(16).
+		WithBufferSize(64)
 
-		// if b.enableMemTracing {
-		// 	tracing.CollectTrace(dram, b.memTracer)
-		// }
+	for i, l2 := range b.l2Caches {
+		name := fmt.Sprintf("%s.L2Policy[%d]", b.name, i)
+		filter := builder.
+			WithCache(l2.GetPortByName("Top").AsRemote(), "").
+			WithLowModuleFinder(&mem.SinglePortMapper{
+				Port: b.drams[i].GetPortByName("Top").AsRemote(),
+			}).
+			Build(name)
+		filter.WatchFlushes(l2)
+		b.simulation.RegisterComponent(filter)
+		b.l2PolicyFilters = append(b.l2PolicyFilters, filter)
+
+		b.l1AddressMapper.LowModules[i] = filter.GetPortByName("Top").AsRemote()
 	}
 }
 
-func (b *Builder) createDramControllerBuilder() dram.Builder {
-	memBankSize := 4 * mem.GB / uint64(b.numMemoryBank)
-	if 4*mem.GB%uint64(b.numMemoryBank) != 0 {
-		panic("GPU memory size is not a multiple of the number of memory banks")
+// buildL2Prefetchers builds a prefetcher in front of each L2 cache and its
+// policy filter, unless prefetching is disabled. The L1 caches and the RDMA
+// engine send the requests to the prefetchers instead. As the prefetched lines
+// can belong to the other banks, the prefetchers find the banks by the same
+// interleaving as the L1 caches.
+func (b *Builder) buildL2Prefetchers() {
+	if b.l2PrefetchPolicy == "none" {
+		return
 	}
 
-	dramCol := 64
-	dramRow := 16384
-	dramDeviceWidth := 128
-	dramBankSize := dramCol * dramRow * dramDeviceWidth
-	dramBank := 4
-	dramBankGroup := 4
-	dramBusWidth := 256
-	dramDevicePerRank := dramBusWidth / dramDeviceWidth
-	dramRankSize := dramBankSize * dramDevicePerRank * dramBank
-	dramRank := int(memBankSize * 8 / uint64(dramRankSize))
+	l2Finder := mem.NewInterleavedAddressPortMapper(
+		1 << b.log2MemoryBankInterleavingSize)
+	l2Finder.LowModules = append(l2Finder.LowModules,
+		b.l1AddressMapper.LowModules...)
 
-	memCtrlBuilder := dram.MakeBuilder().
+	builder := prefetcher.MakeBuilder().
 		WithEngine(b.simulation.GetEngine()).
-		WithFreq(500 * sim.MHz).
-		WithProtocol(dram.HBM).
-		WithBurstLength(4).
-		WithDeviceWidth(dramDeviceWidth).
-		WithBusWidth(dramBusWidth).
-		WithNumChannel(1).
-		WithNumRank(dramRank).
-		WithNumBankGroup(dramBankGroup).
-		WithNumBank(dramBank).
-		WithNumCol(dramCol).
-		WithNumRow(dramRow).
-		WithCommandQueueSize(8).
-		WithTransactionQueueSize(32).
-		WithTCL(7).
-		WithTCWL(2).
-		WithTRCDRD(7).
-		WithTRCDWR(7).
-		WithTRP(7).
-		WithTRAS(17).
-		WithTREFI(1950).
-		WithTRRDS(2).
-		WithTRRDL(3).
-		WithTWTRS(3).
-		WithTWTRL(4).
-		WithTWR(8).
-		WithTCCDS(1).
-		WithTCCDL(1).
-		WithTRTRS(0).
-		WithTRTP(3).
-		WithTPPD(2)
-
-	if b.globalStorage != nil {
-		memCtrlBuilder = memCtrlBuilder.WithGlobalStorage(b.globalStorage)
-	}
-
-	return memCtrlBuilder
+		WithFreq(b.freq).
+		WithPolicy(b.l2PrefetchPolicy).
+		WithLog2LineSize(b.log2CacheLineSize).
+		WithLog2PageSize(b.log2PageSize).
+		WithNumReqPerCycle(16).
+		WithBufferSize(64).
+		WithDegree(b.prefetchDegree).
+		WithMaxInflightPrefetches(b.maxInflightPrefetches).
+		WithAccuracyThreshold(b.prefetchAccuracyThreshold).
+		WithLowModuleFinder(l2Finder)
+
+	for i := range b.l2Caches {
+		name := fmt.Sprintf("%s.L2Prefetcher[%d]", b.name, i)
+		p := builder.Build(name)
+		b.simulation.RegisterComponent(p)
+		b.l2Prefetchers = append(b.l2Prefetchers, p)
+
+		b.l1AddressMapper.LowModules[i] = p.GetPortByName("Top").AsRemote()
+	}
 }
 
 func (b *Builder) buildRDMAEngine() {
 	name := fmt.Sprintf("%s.RDMA", b.name)
-	b.rdmaEngine = rdma.MakeBuilder().
+	rdmaBuilder := rdma.MakeBuilder().
 		WithEngine(b.simulation.GetEngine()).
 		WithFreq(1 * sim.GHz).
 		WithLocalModules(b.l1AddressMapper).
-		Build(name)
+		WithDeviceTable(b.rdmaDeviceTable).
+		WithLink(b.rdmaLink)
+
+	if b.sharerDirectory != nil {
+		rdmaBuilder = rdmaBuilder.WithDirectory(b.sharerDirectory)
+	}
+
+	if b.rdmaRemoteCacheSize > 0 {
+		rdmaBuilder = rdmaBuilder.WithRemoteCache(b.rdmaRemoteCacheSize,
+			b.rdmaRemoteCacheWays, b.log2CacheLineSize)
+	}
+
+	b.rdmaEngine = rdmaBuilder.Build(name)
+	b.coherenceDirectory.Port = b.rdmaEngine.RDMARequestInside.AsRemote()
 
 	b.rdmaEngine.RemoteRDMAAddressTable = b.rdmaAddressMapper
 
 	b.simulation.RegisterComponent(b.rdmaEngine)
+
+	if b.hostMemory != nil {
+		b.hostMemory.SetLink(
+			b.rdmaEngine.RDMARequestOutside.AsRemote(), b.dmaEngine.HostLink)
+	}
+
+	if b.hostMemory != nil && b.rdmaLink != "none" {
+		b.rdmaEngine.SetLink(
+			b.hostMemory.Top.AsRemote(), rdma.NewLink("ideal"))
+	}
 }
 
 func (b *Builder) buildPageMigrationController() {
@@ -603,6 +1183,12 @@ func (b *Builder) buildPageMigrationController() {
 		b.simulation.GetEngine(),
 		b.pmcAddressMapper,
 		nil)
+	b.pmc.SetDataTransferSize(b.pmcTransferSize)
+	b.pmc.SetMaxOutstandingMigrations(b.pmcMaxMigrations)
+	b.pmc.SetMaxInflightChunks(b.pmcMaxInflightChunks)
+
+	// The migrations cross the same links as the remote accesses.
+	b.pmc.SetLinkFinder(b.rdmaEngine)
 
 	b.simulation.RegisterComponent(b.pmc)
 }
@@ -612,41 +1198,92 @@ func (b *Builder) buildDMAEngine() {
 		fmt.Sprintf("%s.DMA", b.name),
 		b.simulation.GetEngine(),
 		nil)
+	b.dmaEngine.HostLink = cp.NewHostLink(b.hostLink)
+	b.dmaEngine.SetNumCopyEngines(b.numCopyEngines)
+	b.dmaEngine.SetNumChannels(b.numDMAChannels)
 
 	b.simulation.RegisterComponent(b.dmaEngine)
 }
 
 func (b *Builder) buildCP() {
-	b.cp = cp.MakeBuilder().
+	cpBuilder := cp.MakeBuilder().
 		WithEngine(b.simulation.GetEngine()).
 		WithVisTracer(b.simulation.GetVisTracer()).
 		WithFreq(b.freq).
 		WithMonitor(b.simulation.GetMonitor()).
-		Build(b.name + ".CommandProcessor")
+		WithNumHWQueues(b.numHWQueues).
+		WithSchedulingPolicy(b.cpSchedulingPolicy).
+		WithDispatchingAlg(b.dispatchingAlg).
+		WithNumCUPerShaderArray(b.numCUPerShaderArray)
+
+	if b.rdmaRemoteCacheSize > 0 {
+		cpBuilder = cpBuilder.WithRemoteCacheInvalidation()
+	}
+
+	b.cp = cpBuilder.Build(b.name + ".CommandProcessor")
+	if b.driver != nil {
+		b.cp.Driver = b.driver.GetPortByName("GPU")
+	}
 
 	b.simulation.RegisterComponent(b.cp)
 
 	b.buildDMAEngine()
 	b.buildRDMAEngine()
 	b.buildPageMigrationController()
+	b.buildAccessCounter()
+}
+
+func (b *Builder) buildAccessCounter() {
+	if b.accessCounterThreshold == 0 {
+		return
+	}
+
+	b.accessCounter = accesscounter.MakeBuilder().
+		WithEngine(b.simulation.GetEngine()).
+		WithFreq(b.freq).
+		WithLog2PageSize(b.log2PageSize).
+		WithLocalAddressRange(b.memAddrOffset, b.memAddrOffset+b.dramSize).
+		WithThreshold(b.accessCounterThreshold).
+		WithCounterBits(b.accessCounterBits).
+		WithDecayInterval(b.accessCounterDecayInterval).
+		Build(fmt.Sprintf("%s.AccessCounter", b.name))
+
+	b.accessCounter.Observe(b.rdmaEngine.RDMARequestOutside)
+
+	b.simulation.RegisterComponent(b.accessCounter)
 }
 
 func (b *Builder) buildL2TLB() {
-    numWays := 64
-    builder := tlb.MakeBuilder().
-        WithEngine(b.simulation.GetEngine()).
-        WithFreq(b.freq).
-        WithNumWays(numWays).
-        WithNumSets(int(b.dramSize / (1 << b.log2PageSize) / uint64(numWays))).
-        WithNumMSHREntry(64).
-        WithNumReqPerCycle(1024).
-        WithPageSize(1 << b.log2PageSize).
-        WithLowModule(b.mmu.GetPortByName("Top").AsRemote()).
-        WithTranslationProviderMapper(&mem.SinglePortMapper{
-            Port: b.mmu.GetPortByName("Top").AsRemote(),
-        })
-
-	l2TLB := builder.Build(fmt.Sprintf("%s.L2TLB", b.name))
+	config := b.l2TLBConfig
+	numSets := config.NumSets
+	if numSets == 0 {
+		numSets = int(b.dramSize / (1 << b.log2PageSize) /
+			uint64(config.NumWays))
+	}
+
+	name := fmt.Sprintf("%s.L2TLB", b.name)
+	provider := b.mmu.GetPortByName("Top").AsRemote()
+	if b.pageWalker != nil {
+		provider = b.pageWalker.GetPortByName("Top").AsRemote()
+	} else if b.sharedTLB != "" {
+		provider = b.sharedTLB
+	}
+
+	l2TLB := tlb.MakeBuilder().
+		WithEngine(b.simulation.GetEngine()).
+		WithFreq(b.freq).
+		WithNumWays(config.NumWays).
+		WithNumSets(numSets).
+		WithNumMSHREntry(config.NumMSHREntry).
+		WithNumReqPerCycle(config.NumReqPerCycle).
+		WithLatency(config.Latency).
+		WithPageSize(1 << b.log2PageSize).
+		WithLowModule(provider).
+		WithTranslationProviderMapper(&mem.SinglePortMapper{
+			Port: provider,
+		}).
+		Build(name)
+	tlbcontrol.AcceptShootdowns(l2TLB)
 
 	b.simulation.RegisterComponent(l2TLB)
 	b.l2TLBs = append(b.l2TLBs, l2TLB)
@@ -654,6 +1291,49 @@ func (b *Builder) buildL2TLB() {
 	b.l1TLBAddressMapper.Port = l2TLB.GetPortByName("Top").AsRemote()
 }
 
+func (b *Builder) buildPageWalker() {
+	if b.pageWalkerThreads == 0 {
+		return
+	}
+
+	if b.sharedTLB != "" {
+		panic("a GPU with a shared TLB cannot have its own page walker")
+	}
+
+	b.pageWalker = pagewalker.MakeBuilder().
+		WithEngine(b.simulation.GetEngine()).
+		WithFreq(b.freq).
+		WithNumThreads(b.pageWalkerThreads).
+		WithPageWalkCache(b.pageWalkCacheEntries).
+		WithLog2PageSize(b.log2PageSize).
+		WithTranslationProvider(b.mmu.GetPortByName("Top").AsRemote()).
+		Build(fmt.Sprintf("%s.L2TLB.PageWalker", b.name))
+
+	b.simulation.RegisterComponent(b.pageWalker)
+}
+
+func (b *Builder) connectL2TLBToPageWalker() {
+	if b.pageWalker == nil {
+		return
+	}
+
+	conn := directconnection.MakeBuilder().
+		WithEngine(b.simulation.GetEngine()).
+		WithFreq(b.freq).
+		Build(b.name + ".L2TLBToPageWalker")
+
+	conn.PlugIn(b.l2TLBs[0].GetPortByName("Bottom"))
+	conn.PlugIn(b.pageWalker.GetPortByName("Top"))
+}
+
+func (b *Builder) numL1VCachePerShaderArray() int {
+	if b.sharedL1V {
+		return 1
+	}
+
+	return b.numCUPerShaderArray
+}
+
 func (b *Builder) numCU() int {
 	return b.numCUPerShaderArray * b.numShaderArray
 }
@@ -0,0 +1,243 @@
+package r9nano
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/sarchlab/akita/v4/mem/idealmemcontroller"
+	"github.com/sarchlab/akita/v4/sim"
+	"github.com/sarchlab/akita/v4/tracing"
+	"github.com/sarchlab/mgpusim/v4/amd/timing/dram"
+	"github.com/sarchlab/mgpusim/v4/amd/timing/dramtracer"
+)
+
+// A dramPreset is the organization and the timing of a memory technology. Each
+// DRAM controller drives one channel. The timing parameters are in the cycles
+// of the command clock.
+type dramPreset struct {
+	freq sim.Freq
+
+	// transfersPerCycle is the number of data transfers in each cycle of the
+	// command clock.
+	transfersPerCycle int
+
+	busWidth     int
+	burstLength  int
+	deviceWidth  int
+	numBankGroup int
+	numBank      int
+	numRow       int
+	numCol       int
+
+	tCL, tCWL      int
+	tRCDRD, tRCDWR int
+	tRP, tRAS      int
+	tRRDS, tRRDL   int
+	tWTRS, tWTRL   int
+	tWR, tRTP      int
+	tCCDS, tCCDL   int
+	tRTRS, tPPD    int
+	tREFI, tRFC    int
+}
+
+var dramPresets = map[string]dramPreset{
+	"hbm2": {
+		freq:              1 * sim.GHz,
+		transfersPerCycle: 2,
+		busWidth:          128,
+		burstLength:       4,
+		deviceWidth:       128,
+		numBankGroup:      4,
+		numBank:           4,
+		numRow:            16384,
+		numCol:            64,
+		tCL:               14,
+		tCWL:              4,
+		tRCDRD:            14,
+		tRCDWR:            10,
+		tRP:               14,
+		tRAS:              34,
+		tRRDS:             4,
+		tRRDL:             6,
+		tWTRS:             3,
+		tWTRL:             8,
+		tWR:               16,
+		tRTP:              5,
+		tCCDS:             2,
+		tCCDL:             4,
+		tRTRS:             1,
+		tPPD:              2,
+		tREFI:             3900,
+		tRFC:              260,
+	},
+	"gddr5": {
+		freq:              1750 * sim.MHz,
+		transfersPerCycle: 4,
+		busWidth:          32,
+		burstLength:       8,
+		deviceWidth:       32,
+		numBankGroup:      4,
+		numBank:           4,
+		numRow:            16384,
+		numCol:            512,
+		tCL:               20,
+		tCWL:              6,
+		tRCDRD:            21,
+		tRCDWR:            16,
+		tRP:               21,
+		tRAS:              49,
+		tRRDS:             10,
+		tRRDL:             10,
+		tWTRS:             9,
+		tWTRL:             9,
+		tWR:               21,
+		tRTP:              3,
+		tCCDS:             2,
+		tCCDL:             3,
+		tRTRS:             1,
+		tPPD:              2,
+		tREFI:             6825,
+		tRFC:              114,
+	},
+	"gddr6": {
+		freq:              875 * sim.MHz,
+		transfersPerCycle: 16,
+		busWidth:          32,
+		burstLength:       16,
+		deviceWidth:       16,
+		numBankGroup:      4,
+		numBank:           4,
+		numRow:            16384,
+		numCol:            1024,
+		tCL:               16,
+		tCWL:              6,
+		tRCDRD:            16,
+		tRCDWR:            13,
+		tRP:               16,
+		tRAS:              28,
+		tRRDS:             5,
+		tRRDL:             6,
+		tWTRS:             5,
+		tWTRL:             7,
+		tWR:               16,
+		tRTP:              2,
+		tCCDS:             1,
+		tCCDL:             2,
+		tRTRS:             1,
+		tPPD:              2,
+		tREFI:             1660,
+		tRFC:              210,
+	},
+}
+
+func (b *Builder) buildDRAMControllers() {
+	for i := 0; i < b.numMemoryBank; i++ {
+		dramName := fmt.Sprintf("%s.DRAM[%d]", b.name, i)
+
+		var ctrl sim.Component
+		if b.dramType == "ideal" {
+			ctrl = idealmemcontroller.MakeBuilder().
+				WithEngine(b.simulation.GetEngine()).
+				WithFreq(b.freq).
+				WithLatency(100).
+				WithStorage(b.globalStorage).
+				Build(dramName)
+		} else {
+			ctrl = b.buildDetailedDRAMController(dramName, i)
+		}
+
+		b.simulation.RegisterComponent(ctrl)
+		b.drams = append(b.drams, ctrl)
+	}
+}
+
+// buildDetailedDRAMController builds the index-th controller of the memory
+// technology. The controller maps the address to the banks after removing the
+// bits that interleave the controllers, while the global storage is still
+// accessed with the physical address.
+func (b *Builder) buildDetailedDRAMController(
+	name string,
+	index int,
+) *dram.Comp {
+	p, ok := dramPresets[b.dramType]
+	if !ok {
+		log.Panicf("unknown DRAM type %s", b.dramType)
+	}
+
+	memCtrlBuilder := dram.MakeBuilder().
+		WithEngine(b.simulation.GetEngine()).
+		WithFreq(p.freq).
+		WithPagePolicy(b.dramPagePolicy).
+		WithAddressMapping(b.dramAddressMapping).
+		WithInterleavingAddrConversion(
+			1<<b.log2MemoryBankInterleavingSize,
+			b.numMemoryBank, index, b.memAddrOffset).
+		WithBurstLength(p.burstLength).
+		WithDeviceWidth(p.deviceWidth).
+		WithBusWidth(p.busWidth).
+		WithNumChannel(1).
+		WithNumRank(p.numRank(b.dramSize / uint64(b.numMemoryBank))).
+		WithNumBankGroup(p.numBankGroup).
+		WithNumBank(p.numBank).
+		WithNumCol(p.numCol).
+		WithNumRow(p.numRow).
+		WithQueueSize(32).
+		WithTiming(p.timing())
+
+	if b.globalStorage != nil {
+		memCtrlBuilder = memCtrlBuilder.WithStorage(b.globalStorage)
+	}
+
+	ctrl := memCtrlBuilder.Build(name)
+
+	tracer := dramtracer.NewTracer(p.peakBandwidth())
+	tracing.CollectTrace(ctrl, tracer)
+	tracer.Register(ctrl)
+
+	return ctrl
+}
+
+func (p dramPreset) timing() dram.Timing {
+	return dram.Timing{
+		BurstCycles: p.burstLength / p.transfersPerCycle,
+		TCL:         p.tCL,
+		TCWL:        p.tCWL,
+		TRCDRD:      p.tRCDRD,
+		TRCDWR:      p.tRCDWR,
+		TRP:         p.tRP,
+		TRAS:        p.tRAS,
+		TRRDS:       p.tRRDS,
+		TRRDL:       p.tRRDL,
+		TWTRS:       p.tWTRS,
+		TWTRL:       p.tWTRL,
+		TWR:         p.tWR,
+		TRTP:        p.tRTP,
+		TCCDS:       p.tCCDS,
+		TCCDL:       p.tCCDL,
+		TRTRS:       p.tRTRS,
+		TPPD:        p.tPPD,
+		TREFI:       p.tREFI,
+		TRFC:        p.tRFC,
+	}
+}
+
+// peakBandwidth returns the number of bytes per second that a channel can
+// transfer.
+func (p dramPreset) peakBandwidth() float64 {
+	return float64(p.busWidth/8*p.transfersPerCycle) * float64(p.freq)
+}
+
+// numRank returns the number of ranks that a channel needs to hold the given
+// number of bytes. The number of ranks is a power of 2.
+func (p dramPreset) numRank(byteSize uint64) int {
+	devicePerRank := p.busWidth / p.deviceWidth
+	rankSize := uint64(p.numCol*p.numRow*p.deviceWidth/8) *
+		uint64(devicePerRank*p.numBankGroup*p.numBank)
+
+	numRank := 1
+	for uint64(numRank*2)*rankSize <= byteSize {
+		numRank *= 2
+	}
+
+	return numRank
+}
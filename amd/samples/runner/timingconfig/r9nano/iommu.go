@@ -0,0 +1,191 @@
+package r9nano
+
+import (
+	"fmt"
+
+	"github.com/sarchlab/akita/v4/mem/mem"
+	"github.com/sarchlab/akita/v4/mem/vm/mmu"
+	"github.com/sarchlab/akita/v4/mem/vm/tlb"
+	"github.com/sarchlab/akita/v4/sim"
+	"github.com/sarchlab/akita/v4/sim/directconnection"
+	"github.com/sarchlab/akita/v4/simulation"
+	"github.com/sarchlab/mgpusim/v4/amd/samples/runner/timingconfig/shaderarray"
+	"github.com/sarchlab/mgpusim/v4/amd/timing/pagewalker"
+	"github.com/sarchlab/mgpusim/v4/amd/timing/sharedtlb"
+	"github.com/sarchlab/mgpusim/v4/amd/timing/tlbcontrol"
+)
+
+// IOMMUBuilder builds an IOMMU-style TLB that the GPUs share. The GPUs send
+// the misses of their L2 TLBs to the "Top" port of the IOMMU, and GPU i shoots
+// down the shared TLB through the "Control[i]" port, as set with
+// Builder.WithSharedTLB. The misses of the shared TLB go to the MMU through
+// the "Translation" port, after an optional page walker.
+type IOMMUBuilder struct {
+	simulation           *simulation.Simulation
+	freq                 sim.Freq
+	numGPUs              int
+	log2PageSize         uint64
+	mmu                  *mmu.Comp
+	tlbConfig            shaderarray.TLBConfig
+	pageWalkerThreads    int
+	pageWalkCacheEntries int
+}
+
+// MakeIOMMUBuilder creates a new IOMMU builder.
+func MakeIOMMUBuilder() IOMMUBuilder {
+	return IOMMUBuilder{
+		freq:         1 * sim.GHz,
+		numGPUs:      1,
+		log2PageSize: 12,
+		tlbConfig: shaderarray.TLBConfig{
+			NumSets:        64,
+			NumWays:        32,
+			NumMSHREntry:   64,
+			NumReqPerCycle: 16,
+			Latency:        20,
+		},
+	}
+}
+
+// WithSimulation sets the simulation to use.
+func (b IOMMUBuilder) WithSimulation(s *simulation.Simulation) IOMMUBuilder {
+	b.simulation = s
+	return b
+}
+
+// WithFreq sets the frequency that the IOMMU works at.
+func (b IOMMUBuilder) WithFreq(freq sim.Freq) IOMMUBuilder {
+	b.freq = freq
+	return b
+}
+
+// WithNumGPUs sets the number of GPUs that share the IOMMU.
+func (b IOMMUBuilder) WithNumGPUs(n int) IOMMUBuilder {
+	b.numGPUs = n
+	return b
+}
+
+// WithLog2PageSize sets the page size, as a power of 2.
+func (b IOMMUBuilder) WithLog2PageSize(n uint64) IOMMUBuilder {
+	b.log2PageSize = n
+	return b
+}
+
+// WithMMU sets the MMU that provides the translations.
+func (b IOMMUBuilder) WithMMU(mmu *mmu.Comp) IOMMUBuilder {
+	b.mmu = mmu
+	return b
+}
+
+// WithTLB sets the organization of the shared TLB.
+func (b IOMMUBuilder) WithTLB(config shaderarray.TLBConfig) IOMMUBuilder {
+	b.tlbConfig = config
+	return b
+}
+
+// WithPageWalker puts a page-table walker with the given number of threads
+// between the shared TLB and the MMU. The walker keeps a page walk cache of
+// the given number of entries. A number of threads of 0 disables the walker.
+func (b IOMMUBuilder) WithPageWalker(
+	numThreads, pageWalkCacheEntries int,
+) IOMMUBuilder {
+	b.pageWalkerThreads = numThreads
+	b.pageWalkCacheEntries = pageWalkCacheEntries
+	return b
+}
+
+// Build builds the IOMMU.
+func (b IOMMUBuilder) Build(name string) *sim.Domain {
+	iommu := sim.NewDomain(name)
+
+	conn := directconnection.MakeBuilder().
+		WithEngine(b.simulation.GetEngine()).
+		WithFreq(b.freq).
+		Build(name + ".InternalConn")
+	b.simulation.RegisterComponent(conn)
+
+	provider := b.mmu.GetPortByName("Top").AsRemote()
+
+	walker := b.buildPageWalker(name, provider)
+	if walker != nil {
+		provider = walker.GetPortByName("Top").AsRemote()
+	}
+
+	sharedTLB := tlb.MakeBuilder().
+		WithEngine(b.simulation.GetEngine()).
+		WithFreq(b.freq).
+		WithNumSets(b.tlbConfig.NumSets).
+		WithNumWays(b.tlbConfig.NumWays).
+		WithNumMSHREntry(b.tlbConfig.NumMSHREntry).
+		WithNumReqPerCycle(b.tlbConfig.NumReqPerCycle).
+		WithLatency(b.tlbConfig.Latency).
+		WithPageSize(1 << b.log2PageSize).
+		WithLowModule(provider).
+		WithTranslationProviderMapper(&mem.SinglePortMapper{
+			Port: provider,
+		}).
+		Build(name + ".TLB")
+	tlbcontrol.AcceptShootdowns(sharedTLB)
+	b.simulation.RegisterComponent(sharedTLB)
+
+	ctrlBuilder := sharedtlb.MakeBuilder().
+		WithEngine(b.simulation.GetEngine()).
+		WithFreq(b.freq).
+		WithNumGPUs(b.numGPUs).
+		WithNumReqPerCycle(b.tlbConfig.NumReqPerCycle).
+		WithTLB(sharedTLB.GetPortByName("Top").AsRemote(),
+			sharedTLB.GetPortByName("Control").AsRemote())
+	if walker != nil {
+		ctrlBuilder = ctrlBuilder.WithFlushTarget(
+			walker.GetPortByName("Control").AsRemote())
+	}
+
+	shootdownCtrl := ctrlBuilder.Build(name + ".ShootdownCtrl")
+	b.simulation.RegisterComponent(shootdownCtrl)
+
+	conn.PlugIn(shootdownCtrl.GetPortByName("Bottom"))
+	conn.PlugIn(shootdownCtrl.GetPortByName("ToControl"))
+	conn.PlugIn(sharedTLB.GetPortByName("Top"))
+	conn.PlugIn(sharedTLB.GetPortByName("Control"))
+
+	iommu.AddPort("Top", shootdownCtrl.GetPortByName("Top"))
+
+	for i := 0; i < b.numGPUs; i++ {
+		port := fmt.Sprintf("Control[%d]", i)
+		iommu.AddPort(port, shootdownCtrl.GetPortByName(port))
+	}
+
+	if walker == nil {
+		iommu.AddPort("Translation", sharedTLB.GetPortByName("Bottom"))
+		return iommu
+	}
+
+	conn.PlugIn(sharedTLB.GetPortByName("Bottom"))
+	conn.PlugIn(walker.GetPortByName("Top"))
+	conn.PlugIn(walker.GetPortByName("Control"))
+
+	iommu.AddPort("Translation", walker.GetPortByName("Bottom"))
+
+	return iommu
+}
+
+func (b IOMMUBuilder) buildPageWalker(
+	name string,
+	provider sim.RemotePort,
+) *pagewalker.Comp {
+	if b.pageWalkerThreads == 0 {
+		return nil
+	}
+
+	walker := pagewalker.MakeBuilder().
+		WithEngine(b.simulation.GetEngine()).
+		WithFreq(b.freq).
+		WithNumThreads(b.pageWalkerThreads).
+		WithPageWalkCache(b.pageWalkCacheEntries).
+		WithLog2PageSize(b.log2PageSize).
+		WithTranslationProvider(provider).
+		Build(name + ".PageWalker")
+	b.simulation.RegisterComponent(walker)
+
+	return walker
+}
@@ -0,0 +1,17 @@
+package r9nano
+
+import (
+	"github.com/sarchlab/mgpusim/v4/amd/samples/runner/timingconfig/shaderarray"
+)
+
+// DefaultL2TLBConfig returns the organization of the L2 TLB of an R9 Nano.
+// The number of sets is left as 0, so that the L2 TLB covers the whole DRAM.
+func DefaultL2TLBConfig() shaderarray.TLBConfig {
+	return shaderarray.TLBConfig{
+		NumSets:        0,
+		NumWays:        64,
+		NumMSHREntry:   64,
+		NumReqPerCycle: 1024,
+		Latency:        4,
+	}
+}
@@ -4,15 +4,16 @@ package shaderarray
 import (
 	"fmt"
 
-	"github.com/sarchlab/akita/v4/mem/cache/writearound"
-	"github.com/sarchlab/akita/v4/mem/cache/writethrough"
 	"github.com/sarchlab/akita/v4/mem/mem"
 	"github.com/sarchlab/akita/v4/mem/vm/addresstranslator"
 	"github.com/sarchlab/akita/v4/mem/vm/tlb"
 	"github.com/sarchlab/akita/v4/sim"
 	"github.com/sarchlab/akita/v4/sim/directconnection"
 	"github.com/sarchlab/akita/v4/simulation"
+	"github.com/sarchlab/mgpusim/v4/amd/timing/cachepolicy"
+	"github.com/sarchlab/mgpusim/v4/amd/timing/coherence"
 	"github.com/sarchlab/mgpusim/v4/amd/timing/cu"
+	"github.com/sarchlab/mgpusim/v4/amd/timing/prefetcher"
 	"github.com/sarchlab/mgpusim/v4/amd/timing/rob"
 )
 
@@ -28,6 +29,25 @@ type Builder struct {
 	log2PageSize       uint64
 	l1AddressMapper    mem.AddressToPortMapper
 	l1TLBAddressMapper mem.AddressToPortMapper
+	gridBarrier        *cu.GridBarrier
+	coherenceMode      string
+	cacheHints         bool
+	leaseCycles        int
+	localLowAddress    uint64
+	localHighAddress   uint64
+	coherenceDirectory mem.AddressToPortMapper
+	sharerDirectory    *coherence.Directory
+	l1vPrefetchPolicy  string
+	prefetchDegree     int
+	prefetchInflight   int
+	prefetchAccuracy   float64
+	l1vCacheConfig     L1CacheConfig
+	l1sCacheConfig     L1CacheConfig
+	l1iCacheConfig     L1CacheConfig
+	sharedL1V          bool
+	l1vTLBConfig       TLBConfig
+	l1sTLBConfig       TLBConfig
+	l1iTLBConfig       TLBConfig
 
 	sa        *sim.Domain
 	cus       []*cu.ComputeUnit
@@ -37,9 +57,9 @@ type Builder struct {
 	l1vATs    []*addresstranslator.Comp
 	l1sAT     *addresstranslator.Comp
 	l1iAT     *addresstranslator.Comp
-	l1vCaches []*writearound.Comp
-	l1sCache  *writethrough.Comp
-	l1iCache  *writethrough.Comp
+	l1vCaches []sim.Component
+	l1sCache  sim.Component
+	l1iCache  sim.Component
     l1vTLBs   []*tlb.Comp
     l1sTLB    *tlb.Comp
     l1iTLB    *tlb.Comp
@@ -57,6 +77,18 @@ type Builder struct {
     l1iCacheMapper *mem.SinglePortMapper
     l1iTransMapper *mem.SinglePortMapper
 
+    // Coherence filters between the vector ATs and the L1V caches. Nil if
+    // the coherence mode is "none".
+    l1vFilters []*coherence.Comp
+
+    // Policy filters in front of the L1V caches, which let the GLC and SLC
+    // accesses bypass the caches. Nil if the cache hints are disabled.
+    l1vPolicyFilters []*cachepolicy.Comp
+
+    // Prefetchers between the policy filters and the L1V caches, if
+    // prefetching is enabled.
+    l1vPrefetchers []*prefetcher.Comp
+
     connectionCount int
 }
 
@@ -67,6 +99,17 @@ func MakeBuilder() Builder {
 		freq:              1 * sim.GHz,
 		log2CacheLineSize: 6,
 		log2PageSize:      12,
+		coherenceMode:     "none",
+		leaseCycles:       1000,
+		l1vPrefetchPolicy: "none",
+		prefetchDegree:    2,
+		prefetchInflight:  8,
+		l1vCacheConfig:    DefaultL1VCacheConfig(),
+		l1sCacheConfig:    DefaultL1SCacheConfig(),
+		l1iCacheConfig:    DefaultL1ICacheConfig(),
+		l1vTLBConfig:      DefaultL1TLBConfig(),
+		l1sTLBConfig:      DefaultL1TLBConfig(),
+		l1iTLBConfig:      DefaultL1TLBConfig(),
 	}
 }
 
@@ -122,6 +165,155 @@ func (b Builder) WithL1TLBAddressMapper(
 	return b
 }
 
+// WithGridBarrier sets the grid barrier that the CUs share with the CUs of the
+// other shader arrays.
+func (b Builder) WithGridBarrier(gridBarrier *cu.GridBarrier) Builder {
+	b.gridBarrier = gridBarrier
+	return b
+}
+
+// WithCoherenceMode sets how the L1 vector caches stay coherent with the
+// memory of the other GPUs. It can be "none", "no-remote-caching", "lease", or
+// "directory". With "none", the L1 vector caches are only flushed at the kernel
+// boundaries. The L1 scalar and instruction caches are not affected.
+func (b Builder) WithCoherenceMode(mode string) Builder {
+	b.coherenceMode = mode
+	return b
+}
+
+// WithCacheHints lets the vector memory accesses that set the GLC or the SLC
+// bit bypass the L1 vector caches. Without it, the caches ignore the hints, and
+// no policy filter is built in front of them.
+func (b Builder) WithCacheHints(enabled bool) Builder {
+	b.cacheHints = enabled
+	return b
+}
+
+// WithLeaseCycles sets the number of cycles that the L1 vector caches can keep
+// the data from the other GPUs in the lease mode.
+func (b Builder) WithLeaseCycles(n int) Builder {
+	b.leaseCycles = n
+	return b
+}
+
+// WithLocalAddressRange sets the range of the addresses that are in the
+// memory of the GPU.
+func (b Builder) WithLocalAddressRange(low, high uint64) Builder {
+	b.localLowAddress = low
+	b.localHighAddress = high
+	return b
+}
+
+// WithCoherenceDirectory sets the mapper that finds where the notifications
+// of the writes to the local memory go in the directory mode.
+func (b Builder) WithCoherenceDirectory(m mem.AddressToPortMapper) Builder {
+	b.coherenceDirectory = m
+	return b
+}
+
+// WithSharerDirectory sets the directory that records which GPUs share the
+// lines of the local memory in the directory mode, so that the writes to the
+// lines that no GPU shares are not notified.
+func (b Builder) WithSharerDirectory(d *coherence.Directory) Builder {
+	b.sharerDirectory = d
+	return b
+}
+
+// WithL1VPrefetcher sets the policy of the prefetchers in front of the L1
+// vector caches. It can be "none", "next-line", "stride", or "stream". With
+// "none", no prefetcher is built.
+func (b Builder) WithL1VPrefetcher(policy string) Builder {
+	b.l1vPrefetchPolicy = policy
+	return b
+}
+
+// WithPrefetchDegree sets the maximum number of lines that a prefetcher
+// fetches after each read.
+func (b Builder) WithPrefetchDegree(n int) Builder {
+	b.prefetchDegree = n
+	return b
+}
+
+// WithMaxInflightPrefetches sets the number of prefetches that each
+// prefetcher can keep in flight.
+func (b Builder) WithMaxInflightPrefetches(n int) Builder {
+	b.prefetchInflight = n
+	return b
+}
+
+// WithPrefetchAccuracyThreshold sets the accuracy below which the prefetchers
+// fetch fewer lines after each read. A threshold of 0 disables the
+// throttling.
+func (b Builder) WithPrefetchAccuracyThreshold(threshold float64) Builder {
+	b.prefetchAccuracy = threshold
+	return b
+}
+
+// WithL1VCache sets the organization of the L1 vector caches.
+func (b Builder) WithL1VCache(config L1CacheConfig) Builder {
+	b.l1vCacheConfig = config
+	return b
+}
+
+// WithL1SCache sets the organization of the L1 scalar cache.
+func (b Builder) WithL1SCache(config L1CacheConfig) Builder {
+	b.l1sCacheConfig = config
+	return b
+}
+
+// WithL1ICache sets the organization of the L1 instruction cache.
+func (b Builder) WithL1ICache(config L1CacheConfig) Builder {
+	b.l1iCacheConfig = config
+	return b
+}
+
+// WithL1VTLB sets the organization of the L1 vector TLBs.
+func (b Builder) WithL1VTLB(config TLBConfig) Builder {
+	b.l1vTLBConfig = config
+	return b
+}
+
+// WithL1STLB sets the organization of the L1 scalar TLB.
+func (b Builder) WithL1STLB(config TLBConfig) Builder {
+	b.l1sTLBConfig = config
+	return b
+}
+
+// WithL1ITLB sets the organization of the L1 instruction TLB.
+func (b Builder) WithL1ITLB(config TLBConfig) Builder {
+	b.l1iTLBConfig = config
+	return b
+}
+
+// WithSharedL1VCache sets whether the CUs of the shader array share a single
+// L1 vector cache. Otherwise, each CU has a private L1 vector cache. The
+// filters and the prefetcher of an L1 vector cache are shared with the cache.
+// With a shared cache, the external ports of the L1 vector cache and its
+// filters only have the index 0.
+func (b Builder) WithSharedL1VCache(shared bool) Builder {
+	b.sharedL1V = shared
+	return b
+}
+
+// numL1VCaches returns the number of L1 vector caches that the shader array
+// has.
+func (b *Builder) numL1VCaches() int {
+	if b.sharedL1V {
+		return 1
+	}
+
+	return b.numCUs
+}
+
+// l1vIndex returns the index of the L1 vector cache that a CU uses.
+func (b *Builder) l1vIndex(cuIndex int) int {
+	if b.sharedL1V {
+		return 0
+	}
+
+	return cuIndex
+}
+
 // Build builds the shader array.
 func (b Builder) Build(name string) *sim.Domain {
 	b.name = name
@@ -140,6 +332,9 @@ func (b *Builder) buildComponents() {
     b.buildL1VReorderBuffers()
     b.buildL1VAddressTranslators()
     b.buildL1VCaches()
+    b.buildL1VPrefetchers()
+    b.buildL1VPolicyFilters()
+    b.buildL1VCoherenceFilters()
     b.buildL1VTLBs()
 
     b.buildL1SReorderBuffer()
@@ -167,12 +362,28 @@ func (b *Builder) populateExternalPorts() {
 			b.l1vATs[i].GetPortByName("Control"))
 		b.sa.AddPort(fmt.Sprintf("L1VTLBCtrl[%d]", i),
 			b.l1vTLBs[i].GetPortByName("Control"))
+		b.sa.AddPort(fmt.Sprintf("L1VTLBBottom[%d]", i),
+			b.l1vTLBs[i].GetPortByName("Bottom"))
+	}
+
+	for i := range b.l1vCaches {
 		b.sa.AddPort(fmt.Sprintf("L1VCacheCtrl[%d]", i),
 			b.l1vCaches[i].GetPortByName("Control"))
 		b.sa.AddPort(fmt.Sprintf("L1VCacheBottom[%d]", i),
 			b.l1vCaches[i].GetPortByName("Bottom"))
-		b.sa.AddPort(fmt.Sprintf("L1VTLBBottom[%d]", i),
-			b.l1vTLBs[i].GetPortByName("Bottom"))
+		if b.l1vPolicyFilters != nil {
+			b.sa.AddPort(fmt.Sprintf("L1VPolicyCtrl[%d]", i),
+				b.l1vPolicyFilters[i].GetPortByName("Control"))
+			b.sa.AddPort(fmt.Sprintf("L1VPolicyBottom[%d]", i),
+				b.l1vPolicyFilters[i].GetPortByName("Bottom"))
+		}
+
+		if b.l1vFilters != nil {
+			b.sa.AddPort(fmt.Sprintf("L1VCoherenceCtrl[%d]", i),
+				b.l1vFilters[i].GetPortByName("Control"))
+			b.sa.AddPort(fmt.Sprintf("L1VCoherenceBottom[%d]", i),
+				b.l1vFilters[i].GetPortByName("Bottom"))
+		}
 	}
 
 	b.sa.AddPort("L1SROBCtrl", b.l1sROB.GetPortByName("Control"))
@@ -202,12 +413,12 @@ func (b *Builder) connectVectorMem() {
         cu := b.cus[i]
         rob := b.l1vROBs[i]
         at := b.l1vATs[i]
-        l1v := b.l1vCaches[i]
         tlb := b.l1vTLBs[i]
 
         // Set mapper targets now that cache/TLB are built
+        memTop := b.l1vFront(b.l1vIndex(i))
         if b.l1vMemMappers != nil && i < len(b.l1vMemMappers) && b.l1vMemMappers[i] != nil {
-            b.l1vMemMappers[i].Port = l1v.GetPortByName("Top").AsRemote()
+            b.l1vMemMappers[i].Port = memTop.AsRemote()
         }
         if b.l1vTransMappers != nil && i < len(b.l1vTransMappers) && b.l1vTransMappers[i] != nil {
             b.l1vTransMappers[i].Port = tlb.GetPortByName("Top").AsRemote()
@@ -228,11 +439,76 @@ func (b *Builder) connectVectorMem() {
         b.connectWithDirectConnection(
             at.GetPortByName("Translation"), tlbTopPort, 8)
 
-        b.connectWithDirectConnection(l1v.GetPortByName("Top"),
-            at.GetPortByName("Bottom"), 8)
+        if !b.sharedL1V {
+            b.connectWithDirectConnection(memTop,
+                at.GetPortByName("Bottom"), 8)
+        }
+    }
+
+    if b.sharedL1V {
+        b.connectSharedL1V()
+    }
+
+    for i, l1v := range b.l1vCaches {
+        l1vTop := l1v.GetPortByName("Top")
+        if b.l1vPrefetchers != nil {
+            prefetcher := b.l1vPrefetchers[i]
+            b.connectWithDirectConnection(l1vTop,
+                prefetcher.GetPortByName("Bottom"), 8)
+            l1vTop = prefetcher.GetPortByName("Top")
+        }
+
+        if b.l1vPolicyFilters != nil {
+            policyFilter := b.l1vPolicyFilters[i]
+            b.connectWithDirectConnection(l1vTop,
+                policyFilter.GetPortByName("ToCache"), 8)
+            l1vTop = policyFilter.GetPortByName("Top")
+        }
+
+        if b.l1vFilters != nil {
+            b.connectWithDirectConnection(l1vTop,
+                b.l1vFilters[i].GetPortByName("ToL1"), 8)
+        }
     }
 }
 
+// l1vFront returns the port that the address translators send the requests
+// to the i-th L1 vector cache to, which is the top port of the coherence
+// filter if there is one.
+func (b *Builder) l1vFront(i int) sim.Port {
+	if b.l1vFilters != nil {
+		return b.l1vFilters[i].GetPortByName("Top")
+	}
+
+	return b.l1vPolicyTop(i)
+}
+
+// l1vPolicyTop returns the port that the requests to the i-th L1 vector cache
+// enter after the coherence filter, which is the top port of the policy
+// filter if there is one.
+func (b *Builder) l1vPolicyTop(i int) sim.Port {
+	if b.l1vPolicyFilters != nil {
+		return b.l1vPolicyFilters[i].GetPortByName("Top")
+	}
+
+	return b.l1vTop(i)
+}
+
+// connectSharedL1V connects the vector address translators of all the CUs to
+// the front of the shared L1 vector cache.
+func (b *Builder) connectSharedL1V() {
+	conn := directconnection.MakeBuilder().
+		WithEngine(b.simulation.GetEngine()).
+		WithFreq(b.freq).
+		Build(b.name + ".VectorMemConn")
+	b.simulation.RegisterComponent(conn)
+
+	conn.PlugIn(b.l1vFront(0))
+	for _, at := range b.l1vATs {
+		conn.PlugIn(at.GetPortByName("Bottom"))
+	}
+}
+
 func (b *Builder) connectScalarMem() {
     rob := b.l1sROB
     at := b.l1sAT
@@ -333,7 +609,8 @@ func (b *Builder) buildCUs() {
 	cuBuilder := cu.MakeBuilder().
 		WithEngine(b.simulation.GetEngine()).
 		WithFreq(b.freq).
-		WithLog2CachelineSize(b.log2CacheLineSize)
+		WithLog2CachelineSize(b.log2CacheLineSize).
+		WithGridBarrier(b.gridBarrier)
 
 	for i := 0; i < b.numCUs; i++ {
 		cuName := fmt.Sprintf("%s.CU[%d]", b.name, i)
@@ -400,40 +677,18 @@ func (b *Builder) buildL1VAddressTranslators() {
 }
 
 func (b *Builder) buildL1VTLBs() {
-    builder := tlb.MakeBuilder().
-        WithEngine(b.simulation.GetEngine()).
-        WithFreq(b.freq).
-        WithNumMSHREntry(4).
-        WithNumSets(1).
-        WithNumWays(64).
-        WithNumReqPerCycle(4).
-        WithTranslationProviderMapper(b.l1TLBAddressMapper)
-
 	for i := 0; i < b.numCUs; i++ {
 		name := fmt.Sprintf("%s.L1VTLB[%d]", b.name, i)
-		tlb := builder.Build(name)
+		tlb := b.buildTLB(name, b.l1vTLBConfig, b.l1TLBAddressMapper)
 		b.l1vTLBs = append(b.l1vTLBs, tlb)
-		b.simulation.RegisterComponent(tlb)
 	}
 }
 
 func (b *Builder) buildL1VCaches() {
-	builder := writearound.MakeBuilder().
-		WithEngine(b.simulation.GetEngine()).
-		WithFreq(b.freq).
-		WithBankLatency(60).
-		WithNumBanks(1).
-		WithLog2BlockSize(b.log2CacheLineSize).
-		WithWayAssociativity(4).
-		WithNumMSHREntry(16).
-		WithTotalByteSize(16 * mem.KB).
-		WithAddressToPortMapper(b.l1AddressMapper)
-
-	for i := 0; i < b.numCUs; i++ {
+	for i := 0; i < b.numL1VCaches(); i++ {
 		name := fmt.Sprintf("%s.L1VCache[%d]", b.name, i)
-		cache := builder.Build(name)
+		cache := b.buildL1Cache(name, b.l1vCacheConfig, b.l1AddressMapper)
 		b.l1vCaches = append(b.l1vCaches, cache)
-		b.simulation.RegisterComponent(cache)
 
 		// if b.memTracer != nil {
 		// 	tracing.CollectTrace(cache, b.memTracer)
@@ -441,6 +696,118 @@ func (b *Builder) buildL1VCaches() {
 	}
 }
 
+// buildL1VPolicyFilters builds a policy filter in front of each L1 vector
+// cache. No filter is built if the cache hints are disabled.
+func (b *Builder) buildL1VPolicyFilters() {
+	if !b.cacheHints {
+		return
+	}
+
+	builder := cachepolicy.MakeBuilder().
+		WithEngine(b.simulation.GetEngine()).
+		WithFreq(b.freq).
+		WithLevel("l1").
+		WithLowModuleFinder(b.l1AddressMapper).
+		WithLog2LineSize(b.log2CacheLineSize).
+		WithMaxStaleLines(b.maxStaleL1VLines())
+
+	for i := 0; i < len(b.l1vCaches); i++ {
+		name := fmt.Sprintf("%s.L1VPolicy[%d]", b.name, i)
+		filter := builder.
+			WithCache(
+				b.l1vTop(i).AsRemote(),
+				b.l1vCaches[i].GetPortByName("Control").AsRemote(),
+			).
+			Build(name)
+		b.l1vPolicyFilters = append(b.l1vPolicyFilters, filter)
+		b.simulation.RegisterComponent(filter)
+	}
+}
+
+// buildL1VCoherenceFilters builds a coherence filter in front of each L1
+// vector cache. No filter is built if the coherence mode is "none".
+func (b *Builder) buildL1VCoherenceFilters() {
+	if b.coherenceMode == "none" {
+		return
+	}
+
+	builder := coherence.MakeBuilder().
+		WithEngine(b.simulation.GetEngine()).
+		WithFreq(b.freq).
+		WithMode(b.coherenceMode).
+		WithLeaseCycles(b.leaseCycles).
+		WithLocalAddressRange(b.localLowAddress, b.localHighAddress).
+		WithLowModuleFinder(b.l1AddressMapper).
+		WithDirectoryFinder(b.coherenceDirectory).
+		WithDirectory(b.sharerDirectory).
+		WithLog2LineSize(b.log2CacheLineSize).
+		WithMaxStaleLines(b.maxStaleL1VLines())
+
+	for i := 0; i < len(b.l1vCaches); i++ {
+		name := fmt.Sprintf("%s.L1VCoherence[%d]", b.name, i)
+		filter := builder.
+			WithL1Cache(
+				b.l1vPolicyTop(i).AsRemote(),
+				b.l1vCaches[i].GetPortByName("Control").AsRemote(),
+			).
+			Build(name)
+		b.l1vFilters = append(b.l1vFilters, filter)
+		b.simulation.RegisterComponent(filter)
+	}
+}
+
+// maxStaleL1VLines returns the number of stale lines that a coherence filter or
+// a policy filter can bypass the L1 vector cache for, which is the number of
+// lines that the cache holds. A write-back cache is flushed on each
+// invalidation instead, so that it writes its dirty lines back, and receives
+// the stores with hints.
+func (b *Builder) maxStaleL1VLines() int {
+	if b.l1vCacheConfig.WritePolicy == "writeback" {
+		return 0
+	}
+
+	return int(b.l1vCacheConfig.ByteSize >> b.log2CacheLineSize)
+}
+
+// buildL1VPrefetchers builds a prefetcher in front of each L1 vector cache,
+// unless prefetching is disabled.
+func (b *Builder) buildL1VPrefetchers() {
+	if b.l1vPrefetchPolicy == "none" {
+		return
+	}
+
+	builder := prefetcher.MakeBuilder().
+		WithEngine(b.simulation.GetEngine()).
+		WithFreq(b.freq).
+		WithPolicy(b.l1vPrefetchPolicy).
+		WithLog2LineSize(b.log2CacheLineSize).
+		WithLog2PageSize(b.log2PageSize).
+		WithDegree(b.prefetchDegree).
+		WithMaxInflightPrefetches(b.prefetchInflight).
+		WithAccuracyThreshold(b.prefetchAccuracy)
+
+	for i := 0; i < len(b.l1vCaches); i++ {
+		name := fmt.Sprintf("%s.L1VPrefetcher[%d]", b.name, i)
+		p := builder.
+			WithLowModuleFinder(&mem.SinglePortMapper{
+				Port: b.l1vCaches[i].GetPortByName("Top").AsRemote(),
+			}).
+			Build(name)
+		b.l1vPrefetchers = append(b.l1vPrefetchers, p)
+		b.simulation.RegisterComponent(p)
+	}
+}
+
+// l1vTop returns the port that the requests to the i-th L1 vector cache
+// enter, which is the top port of the prefetcher if there is one.
+func (b *Builder) l1vTop(i int) sim.Port {
+	if b.l1vPrefetchers != nil {
+		return b.l1vPrefetchers[i].GetPortByName("Top")
+	}
+
+	return b.l1vCaches[i].GetPortByName("Top")
+}
+
 func (b *Builder) buildL1SReorderBuffer() {
 	builder := rob.MakeBuilder().
 		WithEngine(b.simulation.GetEngine()).
@@ -477,37 +844,13 @@ func (b *Builder) buildL1SAddressTranslator() {
 }
 
 func (b *Builder) buildL1STLB() {
-    builder := tlb.MakeBuilder().
-        WithEngine(b.simulation.GetEngine()).
-        WithFreq(b.freq).
-        WithNumMSHREntry(4).
-        WithNumSets(1).
-        WithNumWays(64).
-        WithNumReqPerCycle(4).
-        WithTranslationProviderMapper(b.l1TLBAddressMapper)
-
 	name := fmt.Sprintf("%s.L1STLB", b.name)
-	tlb := builder.Build(name)
-	b.l1sTLB = tlb
-	b.simulation.RegisterComponent(tlb)
+	b.l1sTLB = b.buildTLB(name, b.l1sTLBConfig, b.l1TLBAddressMapper)
 }
 
 func (b *Builder) buildL1SCache() {
-	builder := writethrough.MakeBuilder().
-		WithEngine(b.simulation.GetEngine()).
-		WithFreq(b.freq).
-		WithBankLatency(1).
-		WithNumBanks(1).
-		WithLog2BlockSize(b.log2CacheLineSize).
-		WithWayAssociativity(4).
-		WithNumMSHREntry(16).
-		WithTotalByteSize(16 * mem.KB).
-		WithAddressToPortMapper(b.l1AddressMapper)
-
 	name := fmt.Sprintf("%s.L1SCache", b.name)
-	cache := builder.Build(name)
-	b.l1sCache = cache
-	b.simulation.RegisterComponent(cache)
+	b.l1sCache = b.buildL1Cache(name, b.l1sCacheConfig, b.l1AddressMapper)
 
 	// if b.memTracer != nil {
 	// 	tracing.CollectTrace(cache, b.memTracer)
@@ -546,41 +889,17 @@ func (b *Builder) buildL1IAddressTranslator() {
 }
 
 func (b *Builder) buildL1ITLB() {
-    builder := tlb.MakeBuilder().
-        WithEngine(b.simulation.GetEngine()).
-        WithFreq(b.freq).
-        WithNumMSHREntry(4).
-        WithNumSets(1).
-        WithNumWays(64).
-        WithNumReqPerCycle(4).
-        WithTranslationProviderMapper(b.l1TLBAddressMapper)
-
 	name := fmt.Sprintf("%s.L1ITLB", b.name)
-	tlb := builder.Build(name)
-	b.l1iTLB = tlb
-	b.simulation.RegisterComponent(tlb)
+	b.l1iTLB = b.buildTLB(name, b.l1iTLBConfig, b.l1TLBAddressMapper)
 }
 
 func (b *Builder) buildL1ICache() {
     if b.l1iCacheMapper == nil {
         b.l1iCacheMapper = &mem.SinglePortMapper{}
     }
-    builder := writethrough.MakeBuilder().
-        WithEngine(b.simulation.GetEngine()).
-        WithFreq(b.freq).
-        WithBankLatency(1).
-        WithNumBanks(1).
-        WithLog2BlockSize(b.log2CacheLineSize).
-        WithWayAssociativity(4).
-        WithNumMSHREntry(16).
-        WithTotalByteSize(32 * mem.KB).
-        WithNumReqsPerCycle(4).
-        WithAddressToPortMapper(b.l1iCacheMapper)
 
 	name := fmt.Sprintf("%s.L1ICache", b.name)
-	cache := builder.Build(name)
-	b.l1iCache = cache
-	b.simulation.RegisterComponent(cache)
+	b.l1iCache = b.buildL1Cache(name, b.l1iCacheConfig, b.l1iCacheMapper)
 	// if b.memTracer != nil {
 	// 	tracing.CollectTrace(cache, b.memTracer)
 	// }
@@ -0,0 +1,157 @@
+package shaderarray
+
+import (
+	"log"
+
+	"github.com/sarchlab/akita/v4/mem/cache/writearound"
+	"github.com/sarchlab/akita/v4/mem/cache/writeback"
+	"github.com/sarchlab/akita/v4/mem/cache/writethrough"
+	"github.com/sarchlab/akita/v4/mem/mem"
+	"github.com/sarchlab/akita/v4/sim"
+	"github.com/sarchlab/mgpusim/v4/amd/timing/cachecontrol"
+)
+
+// L1CacheConfig is the organization of an L1 cache.
+type L1CacheConfig struct {
+	// WritePolicy can be "writearound", "writethrough", or "writeback". A
+	// write-around cache sends the writes to the lower level without
+	// allocating them, a write-through cache allocates the writes and sends
+	// them to the lower level, and a write-back cache keeps the dirty lines
+	// until they are evicted or flushed.
+	WritePolicy string
+
+	// ReplacementPolicy decides which line to evict. The akita caches fix
+	// the victim finder when they are built, so only "lru" is supported.
+	// The builder panics on any other policy rather than silently evicting
+	// the least recently used lines.
+	ReplacementPolicy string
+
+	ByteSize         uint64
+	WayAssociativity int
+	NumMSHREntry     int
+	NumReqPerCycle   int
+	DirectoryLatency int
+	BankLatency      int
+
+	// NumBanks is the number of banks that serve the hits in parallel. The
+	// write-back cache has a single bank and ignores the number.
+	NumBanks int
+}
+
+// DefaultL1VCacheConfig returns the organization of the L1 vector caches of
+// an R9 Nano.
+func DefaultL1VCacheConfig() L1CacheConfig {
+	return L1CacheConfig{
+		WritePolicy:       "writearound",
+		ReplacementPolicy: "lru",
+		ByteSize:          16 * mem.KB,
+		WayAssociativity:  4,
+		NumMSHREntry:      16,
+		NumReqPerCycle:    4,
+		DirectoryLatency:  2,
+		BankLatency:       60,
+		NumBanks:          1,
+	}
+}
+
+// DefaultL1SCacheConfig returns the organization of the L1 scalar cache of an
+// R9 Nano.
+func DefaultL1SCacheConfig() L1CacheConfig {
+	return L1CacheConfig{
+		WritePolicy:       "writethrough",
+		ReplacementPolicy: "lru",
+		ByteSize:          16 * mem.KB,
+		WayAssociativity:  4,
+		NumMSHREntry:      16,
+		NumReqPerCycle:    4,
+		DirectoryLatency:  0,
+		BankLatency:       1,
+		NumBanks:          1,
+	}
+}
+
+// DefaultL1ICacheConfig returns the organization of the L1 instruction cache
+// of an R9 Nano.
+func DefaultL1ICacheConfig() L1CacheConfig {
+	return L1CacheConfig{
+		WritePolicy:       "writethrough",
+		ReplacementPolicy: "lru",
+		ByteSize:          32 * mem.KB,
+		WayAssociativity:  4,
+		NumMSHREntry:      16,
+		NumReqPerCycle:    4,
+		DirectoryLatency:  0,
+		BankLatency:       1,
+		NumBanks:          1,
+	}
+}
+
+// buildL1Cache builds a cache with the given organization. The requests that
+// miss go to the ports that the mapper finds.
+func (b *Builder) buildL1Cache(
+	name string,
+	config L1CacheConfig,
+	lowModuleFinder mem.AddressToPortMapper,
+) sim.Component {
+	if config.ReplacementPolicy != "lru" {
+		log.Panicf("%s: replacement policy %q is not supported, "+
+			"the L1 caches can only evict the least recently used lines "+
+			"(\"lru\")", name, config.ReplacementPolicy)
+	}
+
+	var cache sim.Component
+
+	switch config.WritePolicy {
+	case "writearound":
+		c := writearound.MakeBuilder().
+			WithEngine(b.simulation.GetEngine()).
+			WithFreq(b.freq).
+			WithLog2BlockSize(b.log2CacheLineSize).
+			WithTotalByteSize(config.ByteSize).
+			WithWayAssociativity(config.WayAssociativity).
+			WithNumMSHREntry(config.NumMSHREntry).
+			WithNumReqsPerCycle(config.NumReqPerCycle).
+			WithDirectoryLatency(config.DirectoryLatency).
+			WithBankLatency(config.BankLatency).
+			WithNumBanks(config.NumBanks).
+			WithAddressToPortMapper(lowModuleFinder).
+			Build(name)
+		cachecontrol.DiscardDirectoryOnFlush(c)
+		cache = c
+	case "writethrough":
+		c := writethrough.MakeBuilder().
+			WithEngine(b.simulation.GetEngine()).
+			WithFreq(b.freq).
+			WithLog2BlockSize(b.log2CacheLineSize).
+			WithTotalByteSize(config.ByteSize).
+			WithWayAssociativity(config.WayAssociativity).
+			WithNumMSHREntry(config.NumMSHREntry).
+			WithNumReqsPerCycle(config.NumReqPerCycle).
+			WithDirectoryLatency(config.DirectoryLatency).
+			WithBankLatency(config.BankLatency).
+			WithNumBanks(config.NumBanks).
+			WithAddressToPortMapper(lowModuleFinder).
+			Build(name)
+		cachecontrol.DiscardDirectoryOnFlush(c)
+		cache = c
+	case "writeback":
+		cache = writeback.MakeBuilder().
+			WithEngine(b.simulation.GetEngine()).
+			WithFreq(b.freq).
+			WithLog2BlockSize(b.log2CacheLineSize).
+			WithByteSize(config.ByteSize).
+			WithWayAssociativity(config.WayAssociativity).
+			WithNumMSHREntry(config.NumMSHREntry).
+			WithNumReqPerCycle(config.NumReqPerCycle).
+			WithDirectoryLatency(config.DirectoryLatency).
+			WithBankLatency(config.BankLatency).
+			WithAddressToPortMapper(lowModuleFinder).
+			Build(name)
+	default:
+		log.Panicf("unknown write policy %s", config.WritePolicy)
+	}
+
+	b.simulation.RegisterComponent(cache)
+
+	return cache
+}
@@ -0,0 +1,55 @@
+package shaderarray
+
+import (
+	"github.com/sarchlab/akita/v4/mem/mem"
+	"github.com/sarchlab/akita/v4/mem/vm/tlb"
+	"github.com/sarchlab/mgpusim/v4/amd/timing/tlbcontrol"
+)
+
+// TLBConfig is the organization of a TLB.
+type TLBConfig struct {
+	NumSets        int
+	NumWays        int
+	NumMSHREntry   int
+	NumReqPerCycle int
+
+	// Latency is the number of cycles of each lookup, counted in both the
+	// hit and the miss cases.
+	Latency int
+}
+
+// DefaultL1TLBConfig returns the organization of the L1 TLBs of an R9 Nano.
+// The vector, the scalar, and the instruction TLBs are the same.
+func DefaultL1TLBConfig() TLBConfig {
+	return TLBConfig{
+		NumSets:        1,
+		NumWays:        64,
+		NumMSHREntry:   4,
+		NumReqPerCycle: 4,
+		Latency:        4,
+	}
+}
+
+// buildTLB builds a TLB with the given organization. The misses go to the
+// ports that the mapper finds.
+func (b *Builder) buildTLB(
+	name string,
+	config TLBConfig,
+	translationProviderMapper mem.AddressToPortMapper,
+) *tlb.Comp {
+	t := tlb.MakeBuilder().
+		WithEngine(b.simulation.GetEngine()).
+		WithFreq(b.freq).
+		WithNumSets(config.NumSets).
+		WithNumWays(config.NumWays).
+		WithNumMSHREntry(config.NumMSHREntry).
+		WithNumReqPerCycle(config.NumReqPerCycle).
+		WithLatency(config.Latency).
+		WithTranslationProviderMapper(translationProviderMapper).
+		Build(name)
+	tlbcontrol.AcceptShootdowns(t)
+
+	b.simulation.RegisterComponent(t)
+
+	return t
+}
@@ -0,0 +1,42 @@
+package timingconfig_test
+
+import (
+	"log"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sarchlab/akita/v4/simulation"
+	"github.com/sarchlab/mgpusim/v4/amd/driver"
+	"github.com/sarchlab/mgpusim/v4/amd/samples/runner/timingconfig"
+)
+
+func TestTimingConfig(t *testing.T) {
+	log.SetOutput(GinkgoWriter)
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Timing Config Suite")
+}
+
+// buildPlatform builds a timing platform and starts its driver. The driver
+// and the simulation are terminated after the spec.
+func buildPlatform(
+	b timingconfig.Builder,
+) (*simulation.Simulation, *driver.Driver) {
+	s := simulation.MakeBuilder().
+		WithoutMonitoring().
+		WithOutputFileName(filepath.Join(GinkgoT().TempDir(), "sim")).
+		Build()
+
+	b.WithSimulation(s).Build()
+
+	d := s.GetComponentByName("Driver").(*driver.Driver)
+	d.Run()
+
+	DeferCleanup(func() {
+		d.Terminate()
+		s.Terminate()
+	})
+
+	return s, d
+}
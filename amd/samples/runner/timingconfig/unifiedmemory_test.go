@@ -0,0 +1,79 @@
+package timingconfig_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sarchlab/akita/v4/mem/vm"
+	"github.com/sarchlab/mgpusim/v4/amd/driver"
+	"github.com/sarchlab/mgpusim/v4/amd/samples/runner/timingconfig"
+)
+
+// recordingPageTable remembers the PID of the pages that the driver inserts,
+// so that the specs can look up the pages of a context.
+type recordingPageTable struct {
+	vm.PageTable
+	pid vm.PID
+}
+
+func (t *recordingPageTable) Insert(page vm.Page) {
+	t.pid = page.PID
+	t.PageTable.Insert(page)
+}
+
+// devices returns the device that holds each page of the buffer.
+func (t *recordingPageTable) devices(ptr driver.Ptr, byteSize uint64) []uint64 {
+	devices := []uint64{}
+
+	for addr := uint64(ptr); addr < uint64(ptr)+byteSize; addr += 4096 {
+		page, found := t.Find(t.pid, addr)
+		Expect(found).To(BeTrue())
+
+		devices = append(devices, page.DeviceID)
+	}
+
+	return devices
+}
+
+var _ = Describe("Unified Memory", func() {
+	It("should migrate the pages to the GPU that accesses them", func() {
+		pageTable := &recordingPageTable{PageTable: vm.NewPageTable(12)}
+		_, d := buildPlatform(timingconfig.MakeBuilder().
+			WithNumGPUs(2).
+			WithPageTable(pageTable))
+
+		const byteSize = 8 * 4096
+		data := make([]byte, byteSize)
+		for i := range data {
+			data[i] = byte(i*7 + 3)
+		}
+
+		ctx := d.Init()
+		unified := d.AllocateUnifiedMemory(ctx, byteSize)
+		d.MemCopyH2D(ctx, unified, data)
+		Expect(pageTable.devices(unified, byteSize)).To(HaveEach(uint64(1)))
+
+		d.SelectGPU(ctx, 2)
+		onGPU2 := d.AllocateMemory(ctx, byteSize)
+		q := d.CreateCommandQueue(ctx)
+		d.EnqueueMemCopyD2DWithKernel(q, onGPU2, unified, byteSize)
+		d.DrainCommandQueue(q)
+		Expect(pageTable.devices(unified, byteSize)).To(HaveEach(uint64(2)))
+
+		d.SelectGPU(ctx, 1)
+		onGPU1 := d.AllocateMemory(ctx, byteSize)
+		q = d.CreateCommandQueue(ctx)
+		d.EnqueueMemCopyD2DWithKernel(q, onGPU1, unified, byteSize)
+		d.DrainCommandQueue(q)
+
+		// The MMU pins the pages that it has migrated on demand, so GPU 1
+		// reads them remotely instead of taking them back.
+		Expect(pageTable.devices(unified, byteSize)).To(HaveEach(uint64(2)))
+
+		res := make([]byte, byteSize)
+		d.MemCopyD2H(ctx, res, onGPU1)
+		Expect(res).To(Equal(data))
+
+		d.MemCopyD2H(ctx, res, onGPU2)
+		Expect(res).To(Equal(data))
+	})
+})
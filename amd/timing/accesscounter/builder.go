@@ -0,0 +1,101 @@
+package accesscounter
+
+import (
+	"github.com/sarchlab/akita/v4/sim"
+)
+
+// A Builder can build access counters.
+type Builder struct {
+	engine        sim.Engine
+	freq          sim.Freq
+	log2PageSize  uint64
+	localLow      uint64
+	localHigh     uint64
+	counterBits   int
+	threshold     uint32
+	decayInterval uint64
+	bufferSize    int
+}
+
+// MakeBuilder creates a builder with default parameters.
+func MakeBuilder() Builder {
+	return Builder{
+		freq:          1 * sim.GHz,
+		log2PageSize:  12,
+		counterBits:   8,
+		threshold:     64,
+		decayInterval: 100000,
+		bufferSize:    16,
+	}
+}
+
+// WithEngine sets the engine to use.
+func (b Builder) WithEngine(engine sim.Engine) Builder {
+	b.engine = engine
+	return b
+}
+
+// WithFreq sets the frequency that the access counter works at.
+func (b Builder) WithFreq(freq sim.Freq) Builder {
+	b.freq = freq
+	return b
+}
+
+// WithLog2PageSize sets the page size, as a power of 2. Each page has its own
+// counter.
+func (b Builder) WithLog2PageSize(n uint64) Builder {
+	b.log2PageSize = n
+	return b
+}
+
+// WithLocalAddressRange sets the physical addresses of the local memory of
+// the GPU. The accesses to the local memory are not counted.
+func (b Builder) WithLocalAddressRange(low, high uint64) Builder {
+	b.localLow = low
+	b.localHigh = high
+	return b
+}
+
+// WithCounterBits sets the width of each counter. A counter stops counting
+// when it reaches the largest value that it can hold.
+func (b Builder) WithCounterBits(n int) Builder {
+	b.counterBits = n
+	return b
+}
+
+// WithThreshold sets the number of remote accesses to a page that triggers a
+// notification. The threshold must fit in the counters.
+func (b Builder) WithThreshold(n uint32) Builder {
+	b.threshold = n
+	return b
+}
+
+// WithDecayInterval sets the number of cycles between two halvings of the
+// counters. An interval of 0 disables the decay.
+func (b Builder) WithDecayInterval(cycles uint64) Builder {
+	b.decayInterval = cycles
+	return b
+}
+
+// WithBufferSize sets the number of messages that the port can buffer.
+func (b Builder) WithBufferSize(n int) Builder {
+	b.bufferSize = n
+	return b
+}
+
+// Build creates an access counter with the given parameters.
+func (b Builder) Build(name string) *Comp {
+	c := &Comp{}
+	c.TickingComponent = sim.NewTickingComponent(name, b.engine, b.freq, c)
+
+	c.table = newTable(b.counterBits, b.threshold)
+	c.log2PageSize = b.log2PageSize
+	c.localLow = b.localLow
+	c.localHigh = b.localHigh
+	c.decayInterval = b.decayInterval
+
+	c.toCP = sim.NewPort(c, b.bufferSize, b.bufferSize, name+".ToCP")
+	c.AddPort("ToCP", c.toCP)
+
+	return c
+}
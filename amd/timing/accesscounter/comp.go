@@ -0,0 +1,164 @@
+// Package accesscounter counts the accesses that a GPU makes to the pages in
+// the memory of the other devices, so that the driver can move the pages that
+// are accessed remotely the most.
+//
+// The counters watch the requests that the RDMA engine sends to the other
+// devices. Only the accesses to addresses outside of the local memory of the
+// GPU are counted. Each page has
+// a saturating counter of a configurable width. When the counter of a page
+// reaches the threshold, the access counter notifies the Command Processor,
+// which passes the notification on to the driver.
+//
+// The counters decay by halving at a fixed interval, so that pages that are
+// no longer accessed are forgotten. A counter that falls below the threshold
+// notifies again when it reaches the threshold again. Wider counters keep a
+// hot page above the threshold for longer after it cools down.
+package accesscounter
+
+import (
+	"sync"
+
+	"github.com/sarchlab/akita/v4/mem/mem"
+	"github.com/sarchlab/akita/v4/sim"
+)
+
+// Comp is the access counter unit of a GPU.
+type Comp struct {
+	*sim.TickingComponent
+	sync.Mutex
+
+	// CP is the port of the Command Processor that receives the
+	// notifications.
+	CP sim.RemotePort
+
+	toCP sim.Port
+
+	table         *table
+	log2PageSize  uint64
+	localLow      uint64
+	localHigh     uint64
+	decayInterval uint64
+	lastDecay     uint64
+
+	toNotify []*Notification
+
+	numRemoteAccesses uint64
+	numLocalAccesses  uint64
+	numNotifications  uint64
+}
+
+// NumRemoteAccesses returns the number of accesses to the memory of the other
+// devices that have been counted.
+func (c *Comp) NumRemoteAccesses() uint64 {
+	c.Lock()
+	defer c.Unlock()
+
+	return c.numRemoteAccesses
+}
+
+// NumLocalAccesses returns the number of accesses to the local memory that
+// have been observed and not counted.
+func (c *Comp) NumLocalAccesses() uint64 {
+	c.Lock()
+	defer c.Unlock()
+
+	return c.numLocalAccesses
+}
+
+// NumNotifications returns the number of times that a page has reached the
+// threshold.
+func (c *Comp) NumNotifications() uint64 {
+	c.Lock()
+	defer c.Unlock()
+
+	return c.numNotifications
+}
+
+// Observe lets the access counter count the requests that are sent out from
+// the port.
+func (c *Comp) Observe(port sim.Hookable) {
+	port.AcceptHook(c)
+}
+
+// Func counts the memory accesses sent out from the observed ports.
+func (c *Comp) Func(ctx sim.HookCtx) {
+	if ctx.Pos != sim.HookPosPortMsgSend {
+		return
+	}
+
+	req, ok := ctx.Item.(mem.AccessReq)
+	if !ok {
+		return
+	}
+
+	if c.count(req.GetAddress()) {
+		c.TickLater()
+	}
+}
+
+// count counts an access to an address. It returns true if the access makes
+// the page reach the threshold.
+func (c *Comp) count(addr uint64) bool {
+	c.Lock()
+	defer c.Unlock()
+
+	if addr >= c.localLow && addr < c.localHigh {
+		c.numLocalAccesses++
+		return false
+	}
+
+	c.numRemoteAccesses++
+	c.decay()
+
+	page := addr >> c.log2PageSize << c.log2PageSize
+	if !c.table.access(page) {
+		return false
+	}
+
+	n := NotificationBuilder{}.
+		WithSrc(c.toCP.AsRemote()).
+		WithDst(c.CP).
+		WithPAddr(page).
+		WithCount(c.table.count(page)).
+		Build()
+	c.toNotify = append(c.toNotify, n)
+	c.numNotifications++
+
+	return true
+}
+
+// decay halves the counters once for each decay interval that has passed
+// since the last decay.
+func (c *Comp) decay() {
+	if c.decayInterval == 0 {
+		return
+	}
+
+	cycle := c.Freq.Cycle(c.Engine.CurrentTime())
+	times := (cycle - c.lastDecay) / c.decayInterval
+	if times == 0 {
+		return
+	}
+
+	c.table.decay(times)
+	c.lastDecay += times * c.decayInterval
+}
+
+// Tick sends the notifications to the Command Processor.
+func (c *Comp) Tick() bool {
+	c.Lock()
+	defer c.Unlock()
+
+	if len(c.toNotify) == 0 {
+		return false
+	}
+
+	err := c.toCP.Send(c.toNotify[0])
+	if err != nil {
+		return false
+	}
+
+	c.toNotify = c.toNotify[1:]
+
+	return true
+}
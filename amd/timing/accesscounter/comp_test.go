@@ -0,0 +1,105 @@
+package accesscounter
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sarchlab/akita/v4/mem/mem"
+	"github.com/sarchlab/akita/v4/sim"
+	"go.uber.org/mock/gomock"
+)
+
+var _ = Describe("Access Counter", func() {
+	var (
+		mockCtrl *gomock.Controller
+		engine   *MockEngine
+		toCP     *MockPort
+		c        *Comp
+		now      sim.VTimeInSec
+	)
+
+	send := func(addr uint64) {
+		req := mem.ReadReqBuilder{}.
+			WithSrc("RDMA").
+			WithAddress(addr).
+			WithByteSize(64).
+			Build()
+
+		c.Func(sim.HookCtx{
+			Pos:  sim.HookPosPortMsgSend,
+			Item: req,
+		})
+	}
+
+	BeforeEach(func() {
+		mockCtrl = gomock.NewController(GinkgoT())
+		engine = NewMockEngine(mockCtrl)
+		toCP = NewMockPort(mockCtrl)
+		toCP.EXPECT().AsRemote().Return(sim.RemotePort("ToCP")).AnyTimes()
+		now = 0
+		engine.EXPECT().CurrentTime().
+			DoAndReturn(func() sim.VTimeInSec { return now }).AnyTimes()
+		engine.EXPECT().Schedule(gomock.Any()).AnyTimes()
+
+		c = MakeBuilder().
+			WithEngine(engine).
+			WithLocalAddressRange(0x100000, 0x200000).
+			WithCounterBits(4).
+			WithThreshold(2).
+			WithDecayInterval(1000).
+			Build("AccessCounter")
+		c.toCP = toCP
+		c.CP = "CP"
+	})
+
+	AfterEach(func() {
+		mockCtrl.Finish()
+	})
+
+	It("should not count the accesses to the local memory", func() {
+		send(0x100040)
+		send(0x100080)
+
+		Expect(c.NumLocalAccesses()).To(Equal(uint64(2)))
+		Expect(c.NumRemoteAccesses()).To(Equal(uint64(0)))
+		Expect(c.toNotify).To(BeEmpty())
+	})
+
+	It("should notify the CP when a page reaches the threshold", func() {
+		send(0x3040)
+		send(0x3080)
+
+		Expect(c.NumNotifications()).To(Equal(uint64(1)))
+
+		toCP.EXPECT().Send(gomock.Any()).
+			DoAndReturn(func(msg sim.Msg) *sim.SendError {
+				n := msg.(*Notification)
+				Expect(n.Dst).To(Equal(sim.RemotePort("CP")))
+				Expect(n.PAddr).To(Equal(uint64(0x3000)))
+				Expect(n.Count).To(Equal(uint32(2)))
+				return nil
+			})
+
+		Expect(c.Tick()).To(BeTrue())
+		Expect(c.toNotify).To(BeEmpty())
+	})
+
+	It("should decay the counters over time", func() {
+		send(0x3040)
+
+		now = 2e-6
+		send(0x3080)
+
+		Expect(c.NumRemoteAccesses()).To(Equal(uint64(2)))
+		Expect(c.NumNotifications()).To(Equal(uint64(0)))
+		Expect(c.table.count(0x3000)).To(Equal(uint32(1)))
+	})
+
+	It("should ignore the messages that are not memory accesses", func() {
+		c.Func(sim.HookCtx{
+			Pos:  sim.HookPosPortMsgSend,
+			Item: &Notification{},
+		})
+
+		Expect(c.NumRemoteAccesses()).To(Equal(uint64(0)))
+	})
+})
@@ -0,0 +1,73 @@
+package accesscounter
+
+import (
+	"github.com/sarchlab/akita/v4/sim"
+)
+
+// A Notification tells the Command Processor that the remote accesses of the
+// GPU to a page have reached the threshold.
+type Notification struct {
+	sim.MsgMeta
+
+	// PAddr is the physical address of the page.
+	PAddr uint64
+
+	// Count is the number of remote accesses counted for the page.
+	Count uint32
+}
+
+// Meta returns the meta data associated with the message.
+func (n *Notification) Meta() *sim.MsgMeta {
+	return &n.MsgMeta
+}
+
+// Clone returns a clone of the Notification with different ID.
+func (n *Notification) Clone() sim.Msg {
+	cloneMsg := *n
+	cloneMsg.ID = sim.GetIDGenerator().Generate()
+
+	return &cloneMsg
+}
+
+// NotificationBuilder can build access counter notifications.
+type NotificationBuilder struct {
+	src, dst sim.RemotePort
+	pAddr    uint64
+	count    uint32
+}
+
+// WithSrc sets the source of the notification to build.
+func (b NotificationBuilder) WithSrc(src sim.RemotePort) NotificationBuilder {
+	b.src = src
+	return b
+}
+
+// WithDst sets the destination of the notification to build.
+func (b NotificationBuilder) WithDst(dst sim.RemotePort) NotificationBuilder {
+	b.dst = dst
+	return b
+}
+
+// WithPAddr sets the physical address of the page.
+func (b NotificationBuilder) WithPAddr(pAddr uint64) NotificationBuilder {
+	b.pAddr = pAddr
+	return b
+}
+
+// WithCount sets the number of remote accesses counted for the page.
+func (b NotificationBuilder) WithCount(count uint32) NotificationBuilder {
+	b.count = count
+	return b
+}
+
+// Build creates a new Notification.
+func (b NotificationBuilder) Build() *Notification {
+	n := &Notification{}
+	n.ID = sim.GetIDGenerator().Generate()
+	n.Src = b.src
+	n.Dst = b.dst
+	n.PAddr = b.pAddr
+	n.Count = b.count
+
+	return n
+}
@@ -0,0 +1,70 @@
+package accesscounter
+
+import "log"
+
+// A table keeps a saturating counter for each page that has been accessed.
+type table struct {
+	maxCount  uint32
+	threshold uint32
+	counts    map[uint64]uint32
+}
+
+func newTable(counterBits int, threshold uint32) *table {
+	if counterBits <= 0 || counterBits > 32 {
+		log.Panicf("cannot build %d-bit access counters", counterBits)
+	}
+
+	maxCount := uint32((uint64(1) << counterBits) - 1)
+	if threshold == 0 || threshold > maxCount {
+		log.Panicf("threshold %d does not fit in %d-bit access counters",
+			threshold, counterBits)
+	}
+
+	return &table{
+		maxCount:  maxCount,
+		threshold: threshold,
+		counts:    make(map[uint64]uint32),
+	}
+}
+
+// access counts an access to a page. It returns true if the count of the page
+// reaches the threshold with the access.
+func (t *table) access(page uint64) bool {
+	count := t.counts[page]
+	if count == t.maxCount {
+		return false
+	}
+
+	count++
+	t.counts[page] = count
+
+	return count == t.threshold
+}
+
+// count returns the current count of a page.
+func (t *table) count(page uint64) uint32 {
+	return t.counts[page]
+}
+
+// decay halves all the counters the given number of times. The pages whose
+// counters drop to 0 are forgotten.
+func (t *table) decay(times uint64) {
+	if times == 0 {
+		return
+	}
+
+	for page, count := range t.counts {
+		if times >= 32 {
+			count = 0
+		} else {
+			count >>= times
+		}
+
+		if count == 0 {
+			delete(t.counts, page)
+			continue
+		}
+
+		t.counts[page] = count
+	}
+}
@@ -0,0 +1,45 @@
+package accesscounter
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Table", func() {
+	It("should report the access that reaches the threshold", func() {
+		t := newTable(4, 3)
+
+		Expect(t.access(0x1000)).To(BeFalse())
+		Expect(t.access(0x1000)).To(BeFalse())
+		Expect(t.access(0x1000)).To(BeTrue())
+		Expect(t.access(0x1000)).To(BeFalse())
+		Expect(t.access(0x2000)).To(BeFalse())
+	})
+
+	It("should saturate the counters", func() {
+		t := newTable(2, 2)
+
+		for i := 0; i < 10; i++ {
+			t.access(0x1000)
+		}
+
+		Expect(t.count(0x1000)).To(Equal(uint32(3)))
+	})
+
+	It("should halve the counters and forget the cold pages", func() {
+		t := newTable(8, 100)
+		for i := 0; i < 10; i++ {
+			t.access(0x1000)
+		}
+		t.access(0x2000)
+
+		t.decay(2)
+
+		Expect(t.count(0x1000)).To(Equal(uint32(2)))
+		Expect(t.counts).NotTo(HaveKey(uint64(0x2000)))
+	})
+
+	It("should panic if the threshold does not fit in the counters", func() {
+		Expect(func() { newTable(4, 16) }).To(Panic())
+	})
+})
@@ -0,0 +1,110 @@
+// Package cachecontrol lets the akita write-around and write-through caches
+// be flushed while requests are on their way through them.
+//
+// When a flush discards the in-flight transactions, the caches reset their
+// buffers, MSHRs, and bank stages, but not the pipeline of their directory
+// stage. The requests left in that pipeline come out after the cache
+// restarts. They allocate MSHR entries and fetch from the lower level, but
+// their transactions are gone, so the fetched data is dropped and the MSHR
+// entries are never freed. Every later read of those cache lines waits on the
+// stale entries forever, which hangs the GPU after the first TLB shootdown.
+package cachecontrol
+
+import (
+	"reflect"
+	"unsafe"
+
+	"github.com/sarchlab/akita/v4/mem/cache"
+	"github.com/sarchlab/akita/v4/pipelining"
+	"github.com/sarchlab/akita/v4/sim"
+)
+
+// Comp is a cache whose middlewares can be replaced.
+type Comp interface {
+	sim.Component
+	Middlewares() []sim.Middleware
+}
+
+// flushMiddleware empties the directory pipeline of the cache when the cache
+// takes a flush that discards the in-flight transactions.
+type flushMiddleware struct {
+	sim.Middleware
+
+	ctrlPort    sim.Port
+	dirPipeline pipelining.Pipeline
+	dirBuf      sim.Buffer
+}
+
+func (m *flushMiddleware) Tick() bool {
+	req, isFlush := m.ctrlPort.PeekIncoming().(*cache.FlushReq)
+
+	madeProgress := m.Middleware.Tick()
+
+	if isFlush && req.DiscardInflight && m.ctrlPort.PeekIncoming() != req {
+		m.dirPipeline.Clear()
+		m.dirBuf.Clear()
+	}
+
+	return madeProgress
+}
+
+// DiscardDirectoryOnFlush makes the discarding flushes of the cache also drop
+// the requests in its directory pipeline. The write-back caches reset their
+// directory stage themselves and are left untouched.
+func DiscardDirectoryOnFlush(c Comp) {
+	pipeline, buf, ok := directoryStage(c)
+	if !ok {
+		return
+	}
+
+	middlewares := c.Middlewares()
+	for i, m := range middlewares {
+		middlewares[i] = &flushMiddleware{
+			Middleware:  m,
+			ctrlPort:    c.GetPortByName("Control"),
+			dirPipeline: pipeline,
+			dirBuf:      buf,
+		}
+	}
+}
+
+// directoryStage finds the pipeline of the directory stage and the buffer
+// after it. The fields are unexported, so they are found by their names, in
+// the same way that the akita monitor finds the buffers of the components. If
+// a later version of akita renames them, the cache is left untouched.
+func directoryStage(
+	c Comp,
+) (pipeline pipelining.Pipeline, buf sim.Buffer, ok bool) {
+	v := reflect.ValueOf(c)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return nil, nil, false
+	}
+
+	stage := v.Elem().FieldByName("directoryStage")
+	if !stage.IsValid() || stage.Kind() != reflect.Ptr || stage.IsNil() {
+		return nil, nil, false
+	}
+
+	pipelineField := stage.Elem().FieldByName("pipeline")
+	bufField := stage.Elem().FieldByName("buf")
+
+	pipelineType := reflect.TypeOf((*pipelining.Pipeline)(nil)).Elem()
+	bufferType := reflect.TypeOf((*sim.Buffer)(nil)).Elem()
+
+	if !pipelineField.IsValid() || pipelineField.Type() != pipelineType ||
+		!bufField.IsValid() || bufField.Type() != bufferType {
+		return nil, nil, false
+	}
+
+	pipeline = reflect.NewAt(
+		pipelineField.Type(),
+		unsafe.Pointer(pipelineField.UnsafeAddr()),
+	).Elem().Interface().(pipelining.Pipeline)
+
+	buf = reflect.NewAt(
+		bufField.Type(),
+		unsafe.Pointer(bufField.UnsafeAddr()),
+	).Elem().Interface().(sim.Buffer)
+
+	return pipeline, buf, true
+}
@@ -0,0 +1,16 @@
+package cachecontrol
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+//go:generate mockgen -destination "mock_sim_test.go" -package $GOPACKAGE -write_package_comment=false github.com/sarchlab/akita/v4/sim Port,Engine,Buffer,Middleware
+//go:generate mockgen -destination "mock_pipelining_test.go" -package $GOPACKAGE -write_package_comment=false github.com/sarchlab/akita/v4/pipelining Pipeline
+
+func TestCacheControl(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Cache Control Suite")
+}
@@ -0,0 +1,127 @@
+package cachecontrol
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sarchlab/akita/v4/mem/cache"
+	"github.com/sarchlab/akita/v4/mem/cache/writearound"
+	"github.com/sarchlab/akita/v4/mem/cache/writeback"
+	"github.com/sarchlab/akita/v4/mem/cache/writethrough"
+	"github.com/sarchlab/akita/v4/mem/mem"
+	"go.uber.org/mock/gomock"
+)
+
+var _ = Describe("Flush Middleware", func() {
+	var (
+		mockCtrl *gomock.Controller
+		inner    *MockMiddleware
+		ctrlPort *MockPort
+		pipeline *MockPipeline
+		buf      *MockBuffer
+		m        *flushMiddleware
+	)
+
+	BeforeEach(func() {
+		mockCtrl = gomock.NewController(GinkgoT())
+		inner = NewMockMiddleware(mockCtrl)
+		ctrlPort = NewMockPort(mockCtrl)
+		pipeline = NewMockPipeline(mockCtrl)
+		buf = NewMockBuffer(mockCtrl)
+		m = &flushMiddleware{
+			Middleware:  inner,
+			ctrlPort:    ctrlPort,
+			dirPipeline: pipeline,
+			dirBuf:      buf,
+		}
+	})
+
+	AfterEach(func() {
+		mockCtrl.Finish()
+	})
+
+	It("should empty the directory pipeline on a discarding flush", func() {
+		req := cache.FlushReqBuilder{}.DiscardInflight().Build()
+		gomock.InOrder(
+			ctrlPort.EXPECT().PeekIncoming().Return(req),
+			inner.EXPECT().Tick().Return(true),
+			ctrlPort.EXPECT().PeekIncoming().Return(nil),
+		)
+		pipeline.EXPECT().Clear()
+		buf.EXPECT().Clear()
+
+		Expect(m.Tick()).To(BeTrue())
+	})
+
+	It("should keep the directory pipeline until the flush is taken", func() {
+		req := cache.FlushReqBuilder{}.DiscardInflight().Build()
+		ctrlPort.EXPECT().PeekIncoming().Return(req).Times(2)
+		inner.EXPECT().Tick().Return(false)
+
+		Expect(m.Tick()).To(BeFalse())
+	})
+
+	It("should keep the directory pipeline if the flush waits", func() {
+		req := cache.FlushReqBuilder{}.Build()
+		ctrlPort.EXPECT().PeekIncoming().Return(req)
+		inner.EXPECT().Tick().Return(true)
+
+		Expect(m.Tick()).To(BeTrue())
+	})
+})
+
+var _ = Describe("DiscardDirectoryOnFlush", func() {
+	var (
+		mockCtrl  *gomock.Controller
+		engine    *MockEngine
+		lowModule *mem.SinglePortMapper
+	)
+
+	BeforeEach(func() {
+		mockCtrl = gomock.NewController(GinkgoT())
+		engine = NewMockEngine(mockCtrl)
+		lowModule = &mem.SinglePortMapper{Port: "L2"}
+	})
+
+	AfterEach(func() {
+		mockCtrl.Finish()
+	})
+
+	It("should wrap the middleware of the write-around caches", func() {
+		c := writearound.MakeBuilder().
+			WithEngine(engine).
+			WithAddressToPortMapper(lowModule).
+			Build("Cache")
+
+		DiscardDirectoryOnFlush(c)
+
+		Expect(c.Middlewares()).To(HaveLen(1))
+		wrapped := c.Middlewares()[0].(*flushMiddleware)
+		Expect(wrapped.ctrlPort).To(BeIdenticalTo(c.GetPortByName("Control")))
+		Expect(wrapped.dirPipeline).NotTo(BeNil())
+		Expect(wrapped.dirBuf).NotTo(BeNil())
+	})
+
+	It("should wrap the middleware of the write-through caches", func() {
+		c := writethrough.MakeBuilder().
+			WithEngine(engine).
+			WithAddressToPortMapper(lowModule).
+			Build("Cache")
+
+		DiscardDirectoryOnFlush(c)
+
+		Expect(c.Middlewares()[0]).
+			To(BeAssignableToTypeOf(&flushMiddleware{}))
+	})
+
+	It("should leave the write-back caches untouched", func() {
+		c := writeback.MakeBuilder().
+			WithEngine(engine).
+			WithAddressToPortMapper(lowModule).
+			Build("Cache")
+
+		DiscardDirectoryOnFlush(c)
+
+		Expect(c.Middlewares()[0]).
+			NotTo(BeAssignableToTypeOf(&flushMiddleware{}))
+	})
+})
@@ -0,0 +1,137 @@
+package cachepolicy
+
+import (
+	"log"
+
+	"github.com/sarchlab/akita/v4/mem/mem"
+	"github.com/sarchlab/akita/v4/sim"
+)
+
+// A Builder can build policy filters.
+type Builder struct {
+	engine          sim.Engine
+	freq            sim.Freq
+	level           string
+	numReqPerCycle  int
+	bufferSize      int
+	log2LineSize    uint64
+	maxStaleLines   int
+	cache           sim.RemotePort
+	cacheCtrl       sim.RemotePort
+	lowModuleFinder mem.AddressToPortMapper
+}
+
+// MakeBuilder creates a builder with default parameters.
+func MakeBuilder() Builder {
+	return Builder{
+		freq:           1 * sim.GHz,
+		level:          "l1",
+		numReqPerCycle: 4,
+		bufferSize:     8,
+		log2LineSize:   6,
+	}
+}
+
+// WithEngine sets the engine to use.
+func (b Builder) WithEngine(engine sim.Engine) Builder {
+	b.engine = engine
+	return b
+}
+
+// WithFreq sets the frequency that the filter works at.
+func (b Builder) WithFreq(freq sim.Freq) Builder {
+	b.freq = freq
+	return b
+}
+
+// WithLevel sets the level of the cache that the filter guards. It can be
+// "l1" or "l2".
+func (b Builder) WithLevel(level string) Builder {
+	b.level = level
+	return b
+}
+
+// WithNumReqPerCycle sets the number of requests that the filter can forward
+// in each cycle.
+func (b Builder) WithNumReqPerCycle(n int) Builder {
+	b.numReqPerCycle = n
+	return b
+}
+
+// WithBufferSize sets the number of messages that each port can buffer.
+func (b Builder) WithBufferSize(n int) Builder {
+	b.bufferSize = n
+	return b
+}
+
+// WithLog2LineSize sets the cache line size of the cache, as a power of 2.
+func (b Builder) WithLog2LineSize(n uint64) Builder {
+	b.log2LineSize = n
+	return b
+}
+
+// WithMaxStaleLines sets the number of lines that the filter keeps bypassing
+// the L1 cache for after the stores with hints, before it flushes the whole
+// L1 cache instead. With 0, the stores with hints go through the L1 cache,
+// which a write-back L1 cache needs to keep the stores to its dirty lines in
+// order.
+func (b Builder) WithMaxStaleLines(n int) Builder {
+	b.maxStaleLines = n
+	return b
+}
+
+// WithCache sets the top port and the control port of the cache that the
+// filter guards. The filter only flushes the L1 caches, so the control port
+// of an L2 cache can be empty.
+func (b Builder) WithCache(top, ctrl sim.RemotePort) Builder {
+	b.cache = top
+	b.cacheCtrl = ctrl
+	return b
+}
+
+// WithLowModuleFinder sets the mapper that finds where the requests that
+// bypass the cache go.
+func (b Builder) WithLowModuleFinder(m mem.AddressToPortMapper) Builder {
+	b.lowModuleFinder = m
+	return b
+}
+
+// Build creates a policy filter with the given parameters.
+func (b Builder) Build(name string) *Comp {
+	switch b.level {
+	case "l1", "l2":
+	default:
+		log.Panicf("unknown cache level %s", b.level)
+	}
+
+	c := &Comp{}
+	c.TickingComponent = sim.NewTickingComponent(name, b.engine, b.freq, c)
+
+	c.level = b.level
+	c.numReqPerCycle = b.numReqPerCycle
+	c.log2LineSize = b.log2LineSize
+	c.maxStaleLines = b.maxStaleLines
+	c.cache = b.cache
+	c.cacheCtrl = b.cacheCtrl
+	c.lowModuleFinder = b.lowModuleFinder
+	c.inflight = make(map[string]transaction)
+	c.staleLines = make(map[uint64]bool)
+	c.cachedLines = make(map[uint64]bool)
+	c.flushTasks = make(map[string]bool)
+
+	c.topPort = sim.NewPort(c, b.bufferSize, b.bufferSize, name+".TopPort")
+	c.AddPort("Top", c.topPort)
+
+	c.toCachePort = sim.NewPort(
+		c, b.bufferSize, b.bufferSize, name+".ToCachePort")
+	c.AddPort("ToCache", c.toCachePort)
+
+	c.bottomPort = sim.NewPort(
+		c, b.bufferSize, b.bufferSize, name+".BottomPort")
+	c.AddPort("Bottom", c.bottomPort)
+
+	c.ctrlPort = sim.NewPort(c, 1, 1, name+".ControlPort")
+	c.AddPort("Control", c.ctrlPort)
+
+	return c
+}
@@ -0,0 +1,351 @@
+// Package cachepolicy lets the memory accesses follow the cache-control hints
+// that they carry.
+//
+// The vector memory instructions can set the GLC and the SLC bits, which the
+// requests carry as a protocol.CachePolicy. A policy filter sits in front of
+// a cache and sends the accesses that must not use the cache to the lower
+// module directly. The filter works at one of the following levels:
+//
+//   - "l1": the accesses that set the GLC or the SLC bit bypass the L1 cache,
+//     so that the L2 caches receive the hints. As the L1 cache may keep a
+//     copy of a line that a store has bypassed, the filter marks the line
+//     stale, and the later accesses to the line bypass the L1 cache too. Once
+//     more lines are stale than the limit set with Builder.WithMaxStaleLines,
+//     the filter flushes the L1 cache and forgets the stale lines.
+//   - "l2": the accesses that set the SLC bit go to the DRAM without
+//     allocating lines in the L2 cache. The accesses to the lines that the L2
+//     cache may hold still go through the L2 cache, so that they observe the
+//     dirty data. The filter learns that the L2 cache holds no line when it
+//     sees an invalidating flush of the L2 cache complete, which it watches
+//     with WatchFlushes.
+package cachepolicy
+
+import (
+	"log"
+	"reflect"
+	"sync"
+
+	"github.com/sarchlab/akita/v4/mem/cache"
+	"github.com/sarchlab/akita/v4/mem/mem"
+	"github.com/sarchlab/akita/v4/sim"
+	"github.com/sarchlab/mgpusim/v4/amd/protocol"
+)
+
+type transaction struct {
+	req     mem.AccessReq
+	toCache bool
+}
+
+// Comp is a policy filter in front of a cache.
+type Comp struct {
+	*sim.TickingComponent
+
+	topPort     sim.Port
+	toCachePort sim.Port
+	bottomPort  sim.Port
+	ctrlPort    sim.Port
+
+	level          string
+	numReqPerCycle int
+	log2LineSize   uint64
+	maxStaleLines  int
+
+	cache           sim.RemotePort
+	cacheCtrl       sim.RemotePort
+	lowModuleFinder mem.AddressToPortMapper
+
+	inflight           map[string]transaction
+	numInflightToCache int
+
+	staleLines   map[uint64]bool
+	flushing     bool
+	currFlushReq *cache.FlushReq
+
+	cachedLines map[uint64]bool
+
+	flushLock        sync.Mutex
+	flushTasks       map[string]bool
+	cacheInvalidated bool
+
+	numBypasses uint64
+	numFlushes  uint64
+}
+
+// NumBypasses returns the number of requests that have bypassed the cache.
+func (c *Comp) NumBypasses() uint64 {
+	return c.numBypasses
+}
+
+// NumFlushes returns the number of times that the filter has flushed the
+// cache to drop the stale lines.
+func (c *Comp) NumFlushes() uint64 {
+	return c.numFlushes
+}
+
+// Tick updates the state of the filter.
+func (c *Comp) Tick() bool {
+	madeProgress := false
+
+	madeProgress = c.forgetCachedLines() || madeProgress
+	madeProgress = c.parseFromCtrl() || madeProgress
+	madeProgress = c.parseFromBottom() || madeProgress
+	madeProgress = c.parseFromCache() || madeProgress
+	madeProgress = c.flush() || madeProgress
+
+	for i := 0; i < c.numReqPerCycle; i++ {
+		madeProgress = c.parseFromTop() || madeProgress
+	}
+
+	return madeProgress
+}
+
+// forgetCachedLines keeps only the lines of the requests that have not
+// completed in the cache, after the cache has been invalidated.
+func (c *Comp) forgetCachedLines() bool {
+	c.flushLock.Lock()
+	defer c.flushLock.Unlock()
+
+	if !c.cacheInvalidated {
+		return false
+	}
+
+	c.cacheInvalidated = false
+	c.cachedLines = make(map[uint64]bool)
+
+	for _, t := range c.inflight {
+		if t.toCache {
+			c.cachedLines[c.lineAddress(t.req.GetAddress())] = true
+		}
+	}
+
+	return true
+}
+
+func (c *Comp) parseFromCtrl() bool {
+	msg := c.ctrlPort.PeekIncoming()
+	if msg == nil {
+		return false
+	}
+
+	rsp, ok := msg.(*cache.FlushRsp)
+	if !ok {
+		log.Panicf("cannot process message of type %s", reflect.TypeOf(msg))
+	}
+
+	if c.currFlushReq == nil || rsp.RspTo != c.currFlushReq.ID {
+		log.Panicf("flush response %s is not expected", rsp.RspTo)
+	}
+
+	c.ctrlPort.RetrieveIncoming()
+
+	c.currFlushReq = nil
+	c.flushing = false
+	c.staleLines = make(map[uint64]bool)
+	c.numFlushes++
+
+	return true
+}
+
+func (c *Comp) parseFromBottom() bool {
+	return c.parseRsp(c.bottomPort)
+}
+
+func (c *Comp) parseFromCache() bool {
+	return c.parseRsp(c.toCachePort)
+}
+
+func (c *Comp) parseRsp(port sim.Port) bool {
+	msg := port.PeekIncoming()
+	if msg == nil {
+		return false
+	}
+
+	rsp, ok := msg.(mem.AccessRsp)
+	if !ok {
+		log.Panicf("cannot process message of type %s", reflect.TypeOf(msg))
+	}
+
+	t, found := c.inflight[rsp.GetRspTo()]
+	if !found {
+		log.Panicf("request %s not found", rsp.GetRspTo())
+	}
+
+	rspToTop := c.cloneRsp(rsp, t.req.Meta().ID)
+	rspToTop.Meta().Src = c.topPort.AsRemote()
+	rspToTop.Meta().Dst = t.req.Meta().Src
+
+	err := c.topPort.Send(rspToTop)
+	if err != nil {
+		return false
+	}
+
+	port.RetrieveIncoming()
+	delete(c.inflight, rsp.GetRspTo())
+
+	if t.toCache {
+		c.numInflightToCache--
+	}
+
+	return true
+}
+
+// flush flushes the cache once all the requests that have been sent to the
+// cache complete.
+func (c *Comp) flush() bool {
+	if !c.flushing || c.currFlushReq != nil || c.numInflightToCache > 0 {
+		return false
+	}
+
+	req := cache.FlushReqBuilder{}.
+		WithSrc(c.ctrlPort.AsRemote()).
+		WithDst(c.cacheCtrl).
+		InvalidateAllCacheLines().
+		Build()
+
+	err := c.ctrlPort.Send(req)
+	if err != nil {
+		return false
+	}
+
+	c.currFlushReq = req
+
+	return true
+}
+
+func (c *Comp) parseFromTop() bool {
+	if c.flushing {
+		return false
+	}
+
+	msg := c.topPort.PeekIncoming()
+	if msg == nil {
+		return false
+	}
+
+	req, ok := msg.(mem.AccessReq)
+	if !ok {
+		log.Panicf("cannot process message of type %s", reflect.TypeOf(msg))
+	}
+
+	if c.level == "l2" {
+		return c.routeAtL2(req)
+	}
+
+	return c.routeAtL1(req)
+}
+
+func (c *Comp) routeAtL1(req mem.AccessReq) bool {
+	line := c.lineAddress(req.GetAddress())
+	_, isWrite := req.(*mem.WriteReq)
+
+	switch {
+	case c.staleLines[line]:
+		return c.bypass(req)
+	case !protocol.CachePolicyOf(req).BypassL1():
+		return c.forwardToCache(req)
+	case !isWrite:
+		return c.bypass(req)
+	case c.maxStaleLines > 0:
+		if !c.bypass(req) {
+			return false
+		}
+
+		c.markStale(line)
+
+		return true
+	default:
+		return c.forwardToCache(req)
+	}
+}
+
+// markStale marks a line stale, or starts to flush the cache if too many
+// lines are stale.
+func (c *Comp) markStale(line uint64) {
+	c.staleLines[line] = true
+
+	if len(c.staleLines) > c.maxStaleLines {
+		c.flushing = true
+	}
+}
+
+func (c *Comp) routeAtL2(req mem.AccessReq) bool {
+	line := c.lineAddress(req.GetAddress())
+
+	if protocol.CachePolicyOf(req).SLC && !c.cachedLines[line] {
+		return c.bypass(req)
+	}
+
+	if !c.forwardToCache(req) {
+		return false
+	}
+
+	c.cachedLines[line] = true
+
+	return true
+}
+
+func (c *Comp) lineAddress(addr uint64) uint64 {
+	return addr >> c.log2LineSize << c.log2LineSize
+}
+
+func (c *Comp) bypass(req mem.AccessReq) bool {
+	dst := c.lowModuleFinder.Find(req.GetAddress())
+	if !c.forward(req, c.bottomPort, dst, false) {
+		return false
+	}
+
+	c.numBypasses++
+
+	return true
+}
+
+func (c *Comp) forwardToCache(req mem.AccessReq) bool {
+	if !c.forward(req, c.toCachePort, c.cache, true) {
+		return false
+	}
+
+	c.numInflightToCache++
+
+	return true
+}
+
+func (c *Comp) forward(
+	req mem.AccessReq,
+	port sim.Port,
+	dst sim.RemotePort,
+	toCache bool,
+) bool {
+	cloned := req.Clone().(mem.AccessReq)
+	cloned.Meta().Src = port.AsRemote()
+	cloned.Meta().Dst = dst
+
+	err := port.Send(cloned)
+	if err != nil {
+		return false
+	}
+
+	c.topPort.RetrieveIncoming()
+	c.inflight[cloned.Meta().ID] = transaction{req: req, toCache: toCache}
+
+	return true
+}
+
+func (c *Comp) cloneRsp(origin mem.AccessRsp, rspTo string) mem.AccessRsp {
+	switch origin := origin.(type) {
+	case *mem.DataReadyRsp:
+		rsp := origin.Clone().(*mem.DataReadyRsp)
+		rsp.RespondTo = rspTo
+
+		return rsp
+	case *mem.WriteDoneRsp:
+		rsp := origin.Clone().(*mem.WriteDoneRsp)
+		rsp.RespondTo = rspTo
+
+		return rsp
+	default:
+		log.Panicf("cannot clone response of type %s",
+			reflect.TypeOf(origin))
+	}
+
+	return nil
+}
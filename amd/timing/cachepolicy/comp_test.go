@@ -0,0 +1,314 @@
+package cachepolicy
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sarchlab/akita/v4/mem/cache"
+	"github.com/sarchlab/akita/v4/mem/mem"
+	"github.com/sarchlab/akita/v4/sim"
+	"github.com/sarchlab/akita/v4/tracing"
+	"github.com/sarchlab/mgpusim/v4/amd/protocol"
+	"go.uber.org/mock/gomock"
+)
+
+var _ = Describe("Policy Filter", func() {
+	var (
+		mockCtrl    *gomock.Controller
+		engine      *MockEngine
+		topPort     *MockPort
+		toCachePort *MockPort
+		bottomPort  *MockPort
+		ctrlPort    *MockPort
+		builder     Builder
+		c           *Comp
+	)
+
+	read := func(policy protocol.CachePolicy) *mem.ReadReq {
+		return mem.ReadReqBuilder{}.
+			WithSrc("AT").
+			WithAddress(0x100).
+			WithByteSize(64).
+			WithInfo(protocol.AccessInfo{Policy: policy}).
+			Build()
+	}
+
+	write := func(policy protocol.CachePolicy) *mem.WriteReq {
+		return mem.WriteReqBuilder{}.
+			WithSrc("AT").
+			WithAddress(0x100).
+			WithData(make([]byte, 4)).
+			WithInfo(protocol.AccessInfo{Policy: policy}).
+			Build()
+	}
+
+	build := func() {
+		c = builder.Build("Filter")
+		c.topPort = topPort
+		c.toCachePort = toCachePort
+		c.bottomPort = bottomPort
+		c.ctrlPort = ctrlPort
+	}
+
+	expectSend := func(port *MockPort, dst sim.RemotePort) {
+		port.EXPECT().Send(gomock.Any()).
+			DoAndReturn(func(msg sim.Msg) *sim.SendError {
+				Expect(msg.Meta().Dst).To(Equal(dst))
+				return nil
+			})
+	}
+
+	accept := func(req mem.AccessReq) {
+		topPort.EXPECT().PeekIncoming().Return(req)
+		topPort.EXPECT().RetrieveIncoming().Return(req)
+	}
+
+	BeforeEach(func() {
+		mockCtrl = gomock.NewController(GinkgoT())
+		engine = NewMockEngine(mockCtrl)
+		topPort = NewMockPort(mockCtrl)
+		toCachePort = NewMockPort(mockCtrl)
+		bottomPort = NewMockPort(mockCtrl)
+		ctrlPort = NewMockPort(mockCtrl)
+		topPort.EXPECT().AsRemote().Return(sim.RemotePort("Top")).AnyTimes()
+		toCachePort.EXPECT().AsRemote().
+			Return(sim.RemotePort("ToCache")).AnyTimes()
+		bottomPort.EXPECT().AsRemote().
+			Return(sim.RemotePort("Bottom")).AnyTimes()
+		ctrlPort.EXPECT().AsRemote().
+			Return(sim.RemotePort("Control")).AnyTimes()
+
+		builder = MakeBuilder().
+			WithEngine(engine).
+			WithCache("Cache", "CacheCtrl").
+			WithLowModuleFinder(&mem.SinglePortMapper{Port: "L2"})
+	})
+
+	AfterEach(func() {
+		mockCtrl.Finish()
+	})
+
+	It("should panic on unknown levels", func() {
+		Expect(func() { builder.WithLevel("l3").Build("Filter") }).To(Panic())
+	})
+
+	Context("at the L1 level", func() {
+		BeforeEach(func() {
+			build()
+		})
+
+		It("should send the loads without hints to the cache", func() {
+			req := read(protocol.CachePolicy{})
+			topPort.EXPECT().PeekIncoming().Return(req)
+			topPort.EXPECT().RetrieveIncoming().Return(req)
+			toCachePort.EXPECT().Send(gomock.Any()).
+				DoAndReturn(func(msg sim.Msg) *sim.SendError {
+					Expect(msg.Meta().Dst).To(Equal(sim.RemotePort("Cache")))
+					return nil
+				})
+
+			Expect(c.parseFromTop()).To(BeTrue())
+			Expect(c.NumBypasses()).To(Equal(uint64(0)))
+		})
+
+		It("should let the GLC loads bypass the cache", func() {
+			req := read(protocol.CachePolicy{GLC: true})
+			topPort.EXPECT().PeekIncoming().Return(req)
+			topPort.EXPECT().RetrieveIncoming().Return(req)
+			bottomPort.EXPECT().Send(gomock.Any()).
+				DoAndReturn(func(msg sim.Msg) *sim.SendError {
+					Expect(msg.Meta().Dst).To(Equal(sim.RemotePort("L2")))
+					Expect(protocol.CachePolicyOf(msg.(*mem.ReadReq)).GLC).
+						To(BeTrue())
+					return nil
+				})
+
+			Expect(c.parseFromTop()).To(BeTrue())
+			Expect(c.NumBypasses()).To(Equal(uint64(1)))
+		})
+
+		It("should send the SLC stores to a write-back cache", func() {
+			req := write(protocol.CachePolicy{SLC: true})
+			topPort.EXPECT().PeekIncoming().Return(req)
+			topPort.EXPECT().RetrieveIncoming().Return(req)
+			toCachePort.EXPECT().Send(gomock.Any())
+
+			Expect(c.parseFromTop()).To(BeTrue())
+			Expect(c.NumBypasses()).To(Equal(uint64(0)))
+		})
+
+		It("should wait if the request cannot be sent", func() {
+			req := read(protocol.CachePolicy{SLC: true})
+			topPort.EXPECT().PeekIncoming().Return(req)
+			bottomPort.EXPECT().Send(gomock.Any()).Return(sim.NewSendError())
+
+			Expect(c.parseFromTop()).To(BeFalse())
+			Expect(c.NumBypasses()).To(Equal(uint64(0)))
+		})
+
+		It("should return the responses to the requester", func() {
+			req := read(protocol.CachePolicy{GLC: true})
+			c.inflight["Forwarded"] = transaction{req: req}
+			rsp := mem.DataReadyRspBuilder{}.
+				WithRspTo("Forwarded").
+				WithData(make([]byte, 64)).
+				Build()
+			bottomPort.EXPECT().PeekIncoming().Return(rsp)
+			bottomPort.EXPECT().RetrieveIncoming().Return(rsp)
+			topPort.EXPECT().Send(gomock.Any()).
+				DoAndReturn(func(msg sim.Msg) *sim.SendError {
+					Expect(msg.(*mem.DataReadyRsp).RespondTo).To(Equal(req.ID))
+					Expect(msg.Meta().Dst).To(Equal(sim.RemotePort("AT")))
+					return nil
+				})
+
+			Expect(c.parseFromBottom()).To(BeTrue())
+			Expect(c.inflight).To(BeEmpty())
+		})
+	})
+
+	Context("at the L1 level with stale lines", func() {
+		BeforeEach(func() {
+			builder = builder.WithMaxStaleLines(1)
+			build()
+		})
+
+		It("should let the SLC stores bypass the cache", func() {
+			accept(write(protocol.CachePolicy{SLC: true}))
+			expectSend(bottomPort, "L2")
+
+			Expect(c.parseFromTop()).To(BeTrue())
+			Expect(c.NumBypasses()).To(Equal(uint64(1)))
+			Expect(c.staleLines).To(HaveKey(uint64(0x100)))
+			Expect(c.flushing).To(BeFalse())
+		})
+
+		It("should let the accesses to the stale lines bypass the cache",
+			func() {
+				c.staleLines[0x100] = true
+				accept(read(protocol.CachePolicy{}))
+				expectSend(bottomPort, "L2")
+
+				Expect(c.parseFromTop()).To(BeTrue())
+				Expect(c.NumBypasses()).To(Equal(uint64(1)))
+			})
+
+		It("should flush the cache if too many lines are stale", func() {
+			c.staleLines[0x200] = true
+			accept(write(protocol.CachePolicy{GLC: true}))
+			expectSend(bottomPort, "L2")
+
+			Expect(c.parseFromTop()).To(BeTrue())
+			Expect(c.flushing).To(BeTrue())
+			Expect(c.parseFromTop()).To(BeFalse())
+		})
+
+		It("should wait for the requests in the cache before flushing",
+			func() {
+				c.flushing = true
+				c.numInflightToCache = 1
+
+				Expect(c.flush()).To(BeFalse())
+			})
+
+		It("should flush the cache", func() {
+			c.flushing = true
+			ctrlPort.EXPECT().Send(gomock.Any()).
+				DoAndReturn(func(msg sim.Msg) *sim.SendError {
+					req := msg.(*cache.FlushReq)
+					Expect(req.Dst).To(Equal(sim.RemotePort("CacheCtrl")))
+					Expect(req.InvalidateAllCachelines).To(BeTrue())
+					return nil
+				})
+
+			Expect(c.flush()).To(BeTrue())
+			Expect(c.currFlushReq).NotTo(BeNil())
+		})
+
+		It("should forget the stale lines after the flush", func() {
+			c.flushing = true
+			c.staleLines[0x100] = true
+			c.currFlushReq = cache.FlushReqBuilder{}.Build()
+			rsp := cache.FlushRspBuilder{}.
+				WithRspTo(c.currFlushReq.ID).
+				Build()
+			ctrlPort.EXPECT().PeekIncoming().Return(rsp)
+			ctrlPort.EXPECT().RetrieveIncoming().Return(rsp)
+
+			Expect(c.parseFromCtrl()).To(BeTrue())
+			Expect(c.flushing).To(BeFalse())
+			Expect(c.staleLines).To(BeEmpty())
+			Expect(c.NumFlushes()).To(Equal(uint64(1)))
+		})
+	})
+
+	Context("at the L2 level", func() {
+		BeforeEach(func() {
+			builder = builder.
+				WithLevel("l2").
+				WithLowModuleFinder(&mem.SinglePortMapper{Port: "DRAM"})
+			build()
+		})
+
+		It("should let the SLC accesses bypass the cache", func() {
+			accept(write(protocol.CachePolicy{SLC: true}))
+			expectSend(bottomPort, "DRAM")
+
+			Expect(c.parseFromTop()).To(BeTrue())
+			Expect(c.NumBypasses()).To(Equal(uint64(1)))
+			Expect(c.cachedLines).To(BeEmpty())
+		})
+
+		It("should send the GLC accesses to the cache", func() {
+			accept(read(protocol.CachePolicy{GLC: true}))
+			expectSend(toCachePort, "Cache")
+
+			Expect(c.parseFromTop()).To(BeTrue())
+			Expect(c.cachedLines).To(HaveKey(uint64(0x100)))
+		})
+
+		It("should send the SLC accesses to the cached lines to the cache",
+			func() {
+				c.cachedLines[0x100] = true
+				accept(read(protocol.CachePolicy{SLC: true}))
+				expectSend(toCachePort, "Cache")
+
+				Expect(c.parseFromTop()).To(BeTrue())
+				Expect(c.NumBypasses()).To(Equal(uint64(0)))
+			})
+
+		It("should forget the cached lines after an invalidating flush",
+			func() {
+				c.cachedLines[0x100] = true
+				c.cachedLines[0x200] = true
+				c.inflight["InCache"] = transaction{
+					req:     read(protocol.CachePolicy{}),
+					toCache: true,
+				}
+				watcher := &flushWatcher{comp: c}
+				flush := cache.FlushReqBuilder{}.
+					InvalidateAllCacheLines().
+					Build()
+
+				watcher.StartTask(tracing.Task{ID: "Flush", Detail: flush})
+				Expect(c.forgetCachedLines()).To(BeFalse())
+
+				watcher.EndTask(tracing.Task{ID: "Flush"})
+				Expect(c.forgetCachedLines()).To(BeTrue())
+				Expect(c.cachedLines).To(HaveLen(1))
+				Expect(c.cachedLines).To(HaveKey(uint64(0x100)))
+			})
+
+		It("should keep the cached lines after a flush that does not "+
+			"invalidate", func() {
+			c.cachedLines[0x100] = true
+			watcher := &flushWatcher{comp: c}
+			flush := cache.FlushReqBuilder{}.Build()
+
+			watcher.StartTask(tracing.Task{ID: "Flush", Detail: flush})
+			watcher.EndTask(tracing.Task{ID: "Flush"})
+
+			Expect(c.forgetCachedLines()).To(BeFalse())
+			Expect(c.cachedLines).To(HaveKey(uint64(0x100)))
+		})
+	})
+})
@@ -0,0 +1,55 @@
+package cachepolicy
+
+import (
+	"github.com/sarchlab/akita/v4/mem/cache"
+	"github.com/sarchlab/akita/v4/tracing"
+)
+
+// WatchFlushes lets the filter learn when the cache that it guards is
+// invalidated. The cache must trace the flush requests that it receives, as
+// the akita caches do.
+func (c *Comp) WatchFlushes(cache tracing.NamedHookable) {
+	tracing.CollectTrace(cache, &flushWatcher{comp: c})
+}
+
+// A flushWatcher tells a filter when the invalidating flushes of a cache
+// complete.
+type flushWatcher struct {
+	comp *Comp
+}
+
+// StartTask records the invalidating flushes.
+func (w *flushWatcher) StartTask(task tracing.Task) {
+	req, ok := task.Detail.(*cache.FlushReq)
+	if !ok || !req.InvalidateAllCachelines {
+		return
+	}
+
+	w.comp.flushLock.Lock()
+	defer w.comp.flushLock.Unlock()
+
+	w.comp.flushTasks[task.ID] = true
+}
+
+// StepTask does nothing.
+func (w *flushWatcher) StepTask(_ tracing.Task) {
+	// Do nothing
+}
+
+// AddMilestone does nothing.
+func (w *flushWatcher) AddMilestone(_ tracing.Milestone) {
+	// Do nothing
+}
+
+// EndTask marks the cache invalidated when an invalidating flush completes.
+func (w *flushWatcher) EndTask(task tracing.Task) {
+	w.comp.flushLock.Lock()
+	defer w.comp.flushLock.Unlock()
+
+	if !w.comp.flushTasks[task.ID] {
+		return
+	}
+
+	delete(w.comp.flushTasks, task.ID)
+	w.comp.cacheInvalidated = true
+}
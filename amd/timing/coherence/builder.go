@@ -0,0 +1,177 @@
+package coherence
+
+import (
+	"log"
+
+	"github.com/sarchlab/akita/v4/mem/mem"
+	"github.com/sarchlab/akita/v4/sim"
+)
+
+// A Builder can build coherence filters.
+type Builder struct {
+	engine           sim.Engine
+	freq             sim.Freq
+	mode             string
+	leaseCycles      int
+	numReqPerCycle   int
+	bufferSize       int
+	localLowAddress  uint64
+	localHighAddress uint64
+	l1Cache          sim.RemotePort
+	l1CacheCtrl      sim.RemotePort
+	lowModuleFinder  mem.AddressToPortMapper
+	directoryFinder  mem.AddressToPortMapper
+	directory        *Directory
+	log2LineSize     uint64
+	maxStaleLines    int
+}
+
+// MakeBuilder creates a builder with default parameters.
+func MakeBuilder() Builder {
+	return Builder{
+		freq:           1 * sim.GHz,
+		mode:           "no-remote-caching",
+		leaseCycles:    1000,
+		numReqPerCycle: 4,
+		bufferSize:     8,
+		log2LineSize:   6,
+	}
+}
+
+// WithEngine sets the engine to use.
+func (b Builder) WithEngine(engine sim.Engine) Builder {
+	b.engine = engine
+	return b
+}
+
+// WithFreq sets the frequency that the filter works at.
+func (b Builder) WithFreq(freq sim.Freq) Builder {
+	b.freq = freq
+	return b
+}
+
+// WithMode sets the coherence mode. It can be "no-remote-caching", "lease",
+// or "directory".
+func (b Builder) WithMode(mode string) Builder {
+	b.mode = mode
+	return b
+}
+
+// WithLeaseCycles sets the number of cycles that the L1 cache can keep the
+// data from the other GPUs in the lease mode.
+func (b Builder) WithLeaseCycles(n int) Builder {
+	b.leaseCycles = n
+	return b
+}
+
+// WithNumReqPerCycle sets the number of requests that the filter can forward
+// in each cycle.
+func (b Builder) WithNumReqPerCycle(n int) Builder {
+	b.numReqPerCycle = n
+	return b
+}
+
+// WithBufferSize sets the number of messages that each port can buffer.
+func (b Builder) WithBufferSize(n int) Builder {
+	b.bufferSize = n
+	return b
+}
+
+// WithLocalAddressRange sets the range of the addresses that are in the
+// memory of the GPU. All the other addresses are remote.
+func (b Builder) WithLocalAddressRange(low, high uint64) Builder {
+	b.localLowAddress = low
+	b.localHighAddress = high
+	return b
+}
+
+// WithL1Cache sets the top port and the control port of the L1 cache that
+// the filter guards.
+func (b Builder) WithL1Cache(top, ctrl sim.RemotePort) Builder {
+	b.l1Cache = top
+	b.l1CacheCtrl = ctrl
+	return b
+}
+
+// WithLowModuleFinder sets the mapper that finds where the requests that
+// bypass the L1 cache go.
+func (b Builder) WithLowModuleFinder(m mem.AddressToPortMapper) Builder {
+	b.lowModuleFinder = m
+	return b
+}
+
+// WithDirectoryFinder sets the mapper that finds where the notifications of
+// the writes to the local memory go in the directory mode.
+func (b Builder) WithDirectoryFinder(m mem.AddressToPortMapper) Builder {
+	b.directoryFinder = m
+	return b
+}
+
+// WithDirectory sets the directory that records which GPUs share the lines
+// of the local memory in the directory mode. If set, the writes to the lines
+// that no GPU shares are not notified.
+func (b Builder) WithDirectory(d *Directory) Builder {
+	b.directory = d
+	return b
+}
+
+// WithLog2LineSize sets the cache line size of the L1 cache, as a power of 2.
+func (b Builder) WithLog2LineSize(n uint64) Builder {
+	b.log2LineSize = n
+	return b
+}
+
+// WithMaxStaleLines sets the number of invalidated lines that the filter
+// keeps bypassing the L1 cache for, before it flushes the whole L1 cache
+// instead. With 0, each invalidation flushes the L1 cache, which a write-back
+// L1 cache needs to write its dirty lines back.
+func (b Builder) WithMaxStaleLines(n int) Builder {
+	b.maxStaleLines = n
+	return b
+}
+
+// Build creates a coherence filter with the given parameters.
+func (b Builder) Build(name string) *Comp {
+	switch b.mode {
+	case "no-remote-caching", "lease", "directory":
+	default:
+		log.Panicf("unknown coherence mode %s", b.mode)
+	}
+
+	c := &Comp{}
+	c.TickingComponent = sim.NewTickingComponent(name, b.engine, b.freq, c)
+
+	c.mode = b.mode
+	c.leaseCycles = b.leaseCycles
+	c.numReqPerCycle = b.numReqPerCycle
+	c.localLowAddress = b.localLowAddress
+	c.localHighAddress = b.localHighAddress
+	c.l1Cache = b.l1Cache
+	c.l1CacheCtrl = b.l1CacheCtrl
+	c.lowModuleFinder = b.lowModuleFinder
+	c.directoryFinder = b.directoryFinder
+	c.directory = b.directory
+	c.log2LineSize = b.log2LineSize
+	c.maxStaleLines = b.maxStaleLines
+	c.staleLines = make(map[uint64]bool)
+	c.inflight = make(map[string]mem.AccessReq)
+
+	b.createPorts(name, c)
+
+	return c
+}
+
+func (b *Builder) createPorts(name string, c *Comp) {
+	c.topPort = sim.NewPort(c, b.bufferSize, b.bufferSize, name+".TopPort")
+	c.AddPort("Top", c.topPort)
+
+	c.toL1Port = sim.NewPort(c, b.bufferSize, b.bufferSize, name+".ToL1Port")
+	c.AddPort("ToL1", c.toL1Port)
+
+	c.bottomPort = sim.NewPort(
+		c, b.bufferSize, b.bufferSize, name+".BottomPort")
+	c.AddPort("Bottom", c.bottomPort)
+
+	c.ctrlPort = sim.NewPort(c, 1, 1, name+".ControlPort")
+	c.AddPort("Control", c.ctrlPort)
+}
@@ -0,0 +1,379 @@
+// Package coherence keeps the L1 vector caches coherent with the memory of the
+// other GPUs.
+//
+// The L1 vector caches of a GPU can cache the data that they fetch from the
+// other GPUs through the RDMA engine. Nothing invalidates the copies when the
+// other GPUs write the data, except the cache flushes at the kernel
+// boundaries. A coherence filter sits between the address translator and an
+// L1 vector cache and enforces one of the following modes:
+//
+//   - "no-remote-caching": the accesses to the memory of the other GPUs bypass
+//     the L1 cache and go to the RDMA engine directly.
+//   - "lease": the data from the other GPUs can be cached for a fixed number
+//     of cycles. After the lease expires, the next access to the memory of the
+//     other GPUs invalidates the L1 cache first.
+//   - "directory": the RDMA engine of the GPU that owns the data records which
+//     GPUs have read each cache line and notifies them when the line is
+//     written. The filters only report the writes to the lines that other
+//     GPUs share. The RDMA engine of a notified GPU forwards the notification
+//     to the filters of the L1 caches that have read the line, which
+//     invalidate the line.
+//
+// A filter invalidates its L1 cache by stopping to accept requests, waiting
+// for the in-flight requests to complete, and flushing the cache. A
+// write-back L1 cache writes the dirty lines back during the flush.
+//
+// As the L1 caches cannot invalidate a single line, a filter invalidates a
+// line by marking it stale instead. The accesses to the stale lines bypass
+// the L1 cache until the filter flushes the cache, which it does once more
+// lines are stale than the limit set with Builder.WithMaxStaleLines.
+package coherence
+
+import (
+	"log"
+	"reflect"
+
+	"github.com/sarchlab/akita/v4/mem/cache"
+	"github.com/sarchlab/akita/v4/mem/mem"
+	"github.com/sarchlab/akita/v4/sim"
+)
+
+// Comp is a coherence filter in front of an L1 vector cache.
+type Comp struct {
+	*sim.TickingComponent
+
+	topPort    sim.Port
+	toL1Port   sim.Port
+	bottomPort sim.Port
+	ctrlPort   sim.Port
+
+	mode             string
+	leaseCycles      int
+	numReqPerCycle   int
+	localLowAddress  uint64
+	localHighAddress uint64
+
+	l1Cache         sim.RemotePort
+	l1CacheCtrl     sim.RemotePort
+	lowModuleFinder mem.AddressToPortMapper
+	directoryFinder mem.AddressToPortMapper
+	directory       *Directory
+
+	log2LineSize  uint64
+	maxStaleLines int
+	staleLines    map[uint64]bool
+
+	inflight        map[string]mem.AccessReq
+	numInflightToL1 int
+	notifiedReqID   string
+
+	leaseActive  bool
+	leaseExpiry  sim.VTimeInSec
+	invalidating bool
+	currFlushReq *cache.FlushReq
+
+	numBypasses      uint64
+	numInvalidations uint64
+}
+
+// NumBypasses returns the number of requests that have bypassed the L1 cache.
+func (c *Comp) NumBypasses() uint64 {
+	return c.numBypasses
+}
+
+// NumInvalidations returns the number of times that the L1 cache has been
+// invalidated.
+func (c *Comp) NumInvalidations() uint64 {
+	return c.numInvalidations
+}
+
+// Tick updates the state of the filter.
+func (c *Comp) Tick() bool {
+	madeProgress := false
+
+	madeProgress = c.parseFromCtrl() || madeProgress
+	madeProgress = c.parseFromBottom() || madeProgress
+	madeProgress = c.parseFromL1() || madeProgress
+	madeProgress = c.invalidate() || madeProgress
+
+	for i := 0; i < c.numReqPerCycle; i++ {
+		madeProgress = c.parseFromTop() || madeProgress
+	}
+
+	return madeProgress
+}
+
+func (c *Comp) parseFromCtrl() bool {
+	msg := c.ctrlPort.PeekIncoming()
+	if msg == nil {
+		return false
+	}
+
+	switch msg := msg.(type) {
+	case *cache.FlushRsp:
+		c.ctrlPort.RetrieveIncoming()
+		c.completeInvalidation(msg)
+	default:
+		log.Panicf("cannot process message of type %s", reflect.TypeOf(msg))
+	}
+
+	return true
+}
+
+func (c *Comp) completeInvalidation(rsp *cache.FlushRsp) {
+	if c.currFlushReq == nil || rsp.RspTo != c.currFlushReq.ID {
+		log.Panicf("flush response %s is not expected", rsp.RspTo)
+	}
+
+	c.currFlushReq = nil
+	c.invalidating = false
+	c.leaseActive = false
+	c.staleLines = make(map[uint64]bool)
+	c.numInvalidations++
+}
+
+func (c *Comp) parseFromBottom() bool {
+	msg := c.bottomPort.PeekIncoming()
+	if msg == nil {
+		return false
+	}
+
+	switch msg := msg.(type) {
+	case *InvalidateReq:
+		c.bottomPort.RetrieveIncoming()
+		c.invalidateLine(msg.Address)
+
+		return true
+	case mem.AccessRsp:
+		return c.respond(c.bottomPort, msg)
+	default:
+		log.Panicf("cannot process message of type %s", reflect.TypeOf(msg))
+		return false
+	}
+}
+
+func (c *Comp) parseFromL1() bool {
+	msg := c.toL1Port.PeekIncoming()
+	if msg == nil {
+		return false
+	}
+
+	rsp, ok := msg.(mem.AccessRsp)
+	if !ok {
+		log.Panicf("cannot process message of type %s", reflect.TypeOf(msg))
+	}
+
+	if !c.respond(c.toL1Port, rsp) {
+		return false
+	}
+
+	c.numInflightToL1--
+
+	return true
+}
+
+func (c *Comp) respond(port sim.Port, rsp mem.AccessRsp) bool {
+	req, found := c.inflight[rsp.GetRspTo()]
+	if !found {
+		log.Panicf("request %s not found", rsp.GetRspTo())
+	}
+
+	rspToTop := c.cloneRsp(rsp, req.Meta().ID)
+	rspToTop.Meta().Src = c.topPort.AsRemote()
+	rspToTop.Meta().Dst = req.Meta().Src
+
+	err := c.topPort.Send(rspToTop)
+	if err != nil {
+		return false
+	}
+
+	port.RetrieveIncoming()
+	delete(c.inflight, rsp.GetRspTo())
+
+	return true
+}
+
+// invalidateLine marks a line stale, or flushes the L1 cache if too many
+// lines are stale.
+func (c *Comp) invalidateLine(addr uint64) {
+	c.staleLines[c.lineAddress(addr)] = true
+
+	if len(c.staleLines) > c.maxStaleLines {
+		c.invalidating = true
+	}
+}
+
+func (c *Comp) lineAddress(addr uint64) uint64 {
+	return addr >> c.log2LineSize << c.log2LineSize
+}
+
+// invalidate flushes the L1 cache once all the requests that have been sent
+// to the L1 cache complete.
+func (c *Comp) invalidate() bool {
+	if !c.invalidating || c.currFlushReq != nil || c.numInflightToL1 > 0 {
+		return false
+	}
+
+	req := cache.FlushReqBuilder{}.
+		WithSrc(c.ctrlPort.AsRemote()).
+		WithDst(c.l1CacheCtrl).
+		InvalidateAllCacheLines().
+		Build()
+
+	err := c.ctrlPort.Send(req)
+	if err != nil {
+		return false
+	}
+
+	c.currFlushReq = req
+
+	return true
+}
+
+func (c *Comp) parseFromTop() bool {
+	if c.invalidating {
+		return false
+	}
+
+	msg := c.topPort.PeekIncoming()
+	if msg == nil {
+		return false
+	}
+
+	req, ok := msg.(mem.AccessReq)
+	if !ok {
+		log.Panicf("cannot process message of type %s", reflect.TypeOf(msg))
+	}
+
+	if c.staleLines[c.lineAddress(req.GetAddress())] {
+		return c.forwardToBottom(req)
+	}
+
+	remote := c.isRemote(req.GetAddress())
+
+	switch c.mode {
+	case "no-remote-caching":
+		if remote {
+			return c.forwardToBottom(req)
+		}
+	case "lease":
+		if remote && c.leaseExpired() {
+			c.invalidating = true
+			return true
+		}
+	case "directory":
+		if !remote && !c.notifyDirectory(req) {
+			return false
+		}
+	}
+
+	return c.forwardToL1(req, remote)
+}
+
+func (c *Comp) isRemote(addr uint64) bool {
+	return addr < c.localLowAddress || addr >= c.localHighAddress
+}
+
+func (c *Comp) leaseExpired() bool {
+	return c.leaseActive && c.CurrentTime() >= c.leaseExpiry
+}
+
+func (c *Comp) startLease() {
+	if c.leaseActive {
+		return
+	}
+
+	c.leaseActive = true
+	c.leaseExpiry = c.Freq.NCyclesLater(c.leaseCycles, c.CurrentTime())
+}
+
+// notifyDirectory tells the RDMA engine that a local cache line is written,
+// so that the GPUs that have read the line can invalidate their copies. The
+// writes to the lines that no other GPU shares are not notified. It returns
+// false if the notification cannot be sent in this cycle.
+func (c *Comp) notifyDirectory(req mem.AccessReq) bool {
+	if _, isWrite := req.(*mem.WriteReq); !isWrite {
+		return true
+	}
+
+	if c.directory != nil && !c.directory.HasSharers(req.GetAddress()) {
+		return true
+	}
+
+	if c.notifiedReqID == req.Meta().ID {
+		return true
+	}
+
+	notice := InvalidateReqBuilder{}.
+		WithSrc(c.bottomPort.AsRemote()).
+		WithDst(c.directoryFinder.Find(req.GetAddress())).
+		WithAddress(req.GetAddress()).
+		Build()
+
+	err := c.bottomPort.Send(notice)
+	if err != nil {
+		return false
+	}
+
+	c.notifiedReqID = req.Meta().ID
+
+	return true
+}
+
+func (c *Comp) forwardToBottom(req mem.AccessReq) bool {
+	cloned := req.Clone().(mem.AccessReq)
+	cloned.Meta().Src = c.bottomPort.AsRemote()
+	cloned.Meta().Dst = c.lowModuleFinder.Find(req.GetAddress())
+
+	err := c.bottomPort.Send(cloned)
+	if err != nil {
+		return false
+	}
+
+	c.topPort.RetrieveIncoming()
+	c.inflight[cloned.Meta().ID] = req
+	c.numBypasses++
+
+	return true
+}
+
+func (c *Comp) forwardToL1(req mem.AccessReq, remote bool) bool {
+	cloned := req.Clone().(mem.AccessReq)
+	cloned.Meta().Src = c.toL1Port.AsRemote()
+	cloned.Meta().Dst = c.l1Cache
+
+	err := c.toL1Port.Send(cloned)
+	if err != nil {
+		return false
+	}
+
+	c.topPort.RetrieveIncoming()
+	c.inflight[cloned.Meta().ID] = req
+	c.numInflightToL1++
+
+	if remote && c.mode == "lease" {
+		c.startLease()
+	}
+
+	return true
+}
+
+func (c *Comp) cloneRsp(origin mem.AccessRsp, rspTo string) mem.AccessRsp {
+	switch origin := origin.(type) {
+	case *mem.DataReadyRsp:
+		rsp := origin.Clone().(*mem.DataReadyRsp)
+		rsp.RespondTo = rspTo
+
+		return rsp
+	case *mem.WriteDoneRsp:
+		rsp := origin.Clone().(*mem.WriteDoneRsp)
+		rsp.RespondTo = rspTo
+
+		return rsp
+	default:
+		log.Panicf("cannot clone response of type %s",
+			reflect.TypeOf(origin))
+	}
+
+	return nil
+}
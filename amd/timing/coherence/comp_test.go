@@ -0,0 +1,303 @@
+package coherence
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sarchlab/akita/v4/mem/cache"
+	"github.com/sarchlab/akita/v4/mem/mem"
+	"github.com/sarchlab/akita/v4/sim"
+	"go.uber.org/mock/gomock"
+)
+
+var _ = Describe("Coherence Filter", func() {
+	var (
+		mockCtrl   *gomock.Controller
+		engine     *MockEngine
+		topPort    *MockPort
+		toL1Port   *MockPort
+		bottomPort *MockPort
+		ctrlPort   *MockPort
+		builder    Builder
+		c          *Comp
+	)
+
+	localRead := func() *mem.ReadReq {
+		return mem.ReadReqBuilder{}.
+			WithSrc("AT").
+			WithAddress(0x100).
+			WithByteSize(64).
+			Build()
+	}
+
+	remoteRead := func() *mem.ReadReq {
+		return mem.ReadReqBuilder{}.
+			WithSrc("AT").
+			WithAddress(0x10100).
+			WithByteSize(64).
+			Build()
+	}
+
+	build := func() {
+		c = builder.Build("Filter")
+		c.topPort = topPort
+		c.toL1Port = toL1Port
+		c.bottomPort = bottomPort
+		c.ctrlPort = ctrlPort
+	}
+
+	BeforeEach(func() {
+		mockCtrl = gomock.NewController(GinkgoT())
+		engine = NewMockEngine(mockCtrl)
+		topPort = NewMockPort(mockCtrl)
+		toL1Port = NewMockPort(mockCtrl)
+		bottomPort = NewMockPort(mockCtrl)
+		ctrlPort = NewMockPort(mockCtrl)
+		topPort.EXPECT().AsRemote().Return(sim.RemotePort("Top")).AnyTimes()
+		toL1Port.EXPECT().AsRemote().Return(sim.RemotePort("ToL1")).AnyTimes()
+		bottomPort.EXPECT().AsRemote().
+			Return(sim.RemotePort("Bottom")).AnyTimes()
+		ctrlPort.EXPECT().AsRemote().Return(sim.RemotePort("Ctrl")).AnyTimes()
+
+		builder = MakeBuilder().
+			WithEngine(engine).
+			WithLocalAddressRange(0, 0x10000).
+			WithL1Cache("L1", "L1Ctrl").
+			WithLowModuleFinder(&mem.SinglePortMapper{Port: "RDMA"}).
+			WithDirectoryFinder(&mem.SinglePortMapper{Port: "RDMA"}).
+			WithLeaseCycles(10)
+	})
+
+	AfterEach(func() {
+		mockCtrl.Finish()
+	})
+
+	It("should panic on unknown modes", func() {
+		Expect(func() { builder.WithMode("mesi").Build("Filter") }).To(Panic())
+	})
+
+	Context("without remote caching", func() {
+		BeforeEach(func() {
+			builder = builder.WithMode("no-remote-caching")
+			build()
+		})
+
+		It("should send local accesses to the L1 cache", func() {
+			read := localRead()
+			topPort.EXPECT().PeekIncoming().Return(read)
+			topPort.EXPECT().RetrieveIncoming().Return(read)
+			toL1Port.EXPECT().Send(gomock.Any()).
+				DoAndReturn(func(msg sim.Msg) *sim.SendError {
+					Expect(msg.Meta().Dst).To(Equal(sim.RemotePort("L1")))
+					Expect(msg.Meta().Src).To(Equal(sim.RemotePort("ToL1")))
+					return nil
+				})
+
+			Expect(c.parseFromTop()).To(BeTrue())
+			Expect(c.inflight).To(HaveLen(1))
+			Expect(c.numInflightToL1).To(Equal(1))
+		})
+
+		It("should let remote accesses bypass the L1 cache", func() {
+			read := remoteRead()
+			topPort.EXPECT().PeekIncoming().Return(read)
+			topPort.EXPECT().RetrieveIncoming().Return(read)
+			bottomPort.EXPECT().Send(gomock.Any()).
+				DoAndReturn(func(msg sim.Msg) *sim.SendError {
+					Expect(msg.Meta().Dst).To(Equal(sim.RemotePort("RDMA")))
+					Expect(msg.(*mem.ReadReq).Address).
+						To(Equal(uint64(0x10100)))
+					return nil
+				})
+
+			Expect(c.parseFromTop()).To(BeTrue())
+			Expect(c.NumBypasses()).To(Equal(uint64(1)))
+			Expect(c.numInflightToL1).To(Equal(0))
+		})
+
+		It("should return the responses to the original requests", func() {
+			read := remoteRead()
+			c.inflight["sent"] = read
+			rsp := mem.DataReadyRspBuilder{}.
+				WithRspTo("sent").
+				WithData(make([]byte, 64)).
+				Build()
+			bottomPort.EXPECT().PeekIncoming().Return(rsp)
+			bottomPort.EXPECT().RetrieveIncoming().Return(rsp)
+			topPort.EXPECT().Send(gomock.Any()).
+				DoAndReturn(func(msg sim.Msg) *sim.SendError {
+					dr := msg.(*mem.DataReadyRsp)
+					Expect(dr.RespondTo).To(Equal(read.ID))
+					Expect(dr.Dst).To(Equal(sim.RemotePort("AT")))
+					return nil
+				})
+
+			Expect(c.parseFromBottom()).To(BeTrue())
+			Expect(c.inflight).To(BeEmpty())
+		})
+	})
+
+	Context("with leases", func() {
+		BeforeEach(func() {
+			builder = builder.WithMode("lease")
+			build()
+		})
+
+		It("should start a lease with the first remote access", func() {
+			read := remoteRead()
+			engine.EXPECT().CurrentTime().Return(sim.VTimeInSec(0)).AnyTimes()
+			topPort.EXPECT().PeekIncoming().Return(read)
+			topPort.EXPECT().RetrieveIncoming().Return(read)
+			toL1Port.EXPECT().Send(gomock.Any())
+
+			Expect(c.parseFromTop()).To(BeTrue())
+			Expect(c.leaseActive).To(BeTrue())
+			Expect(c.leaseExpiry).To(BeNumerically("~", 10e-9))
+		})
+
+		It("should invalidate the L1 cache when the lease expires", func() {
+			c.leaseActive = true
+			c.leaseExpiry = 10e-9
+			engine.EXPECT().CurrentTime().Return(sim.VTimeInSec(11e-9))
+			topPort.EXPECT().PeekIncoming().Return(remoteRead())
+
+			Expect(c.parseFromTop()).To(BeTrue())
+			Expect(c.invalidating).To(BeTrue())
+			Expect(c.parseFromTop()).To(BeFalse())
+		})
+	})
+
+	Context("with a directory", func() {
+		var directory *Directory
+
+		BeforeEach(func() {
+			directory = NewDirectory(6)
+			builder = builder.WithMode("directory").WithDirectory(directory)
+			build()
+		})
+
+		It("should notify the directory of local writes", func() {
+			directory.AddSharer(0x100, "GPU2")
+			write := mem.WriteReqBuilder{}.
+				WithAddress(0x100).
+				WithData(make([]byte, 4)).
+				Build()
+			topPort.EXPECT().PeekIncoming().Return(write).Times(2)
+			bottomPort.EXPECT().Send(gomock.Any()).
+				DoAndReturn(func(msg sim.Msg) *sim.SendError {
+					req := msg.(*InvalidateReq)
+					Expect(req.Address).To(Equal(uint64(0x100)))
+					Expect(req.Dst).To(Equal(sim.RemotePort("RDMA")))
+					return nil
+				})
+			toL1Port.EXPECT().Send(gomock.Any()).
+				Return(sim.NewSendError())
+			toL1Port.EXPECT().Send(gomock.Any())
+			topPort.EXPECT().RetrieveIncoming().Return(write)
+
+			Expect(c.parseFromTop()).To(BeFalse())
+			Expect(c.parseFromTop()).To(BeTrue())
+		})
+
+		It("should invalidate the L1 cache when notified", func() {
+			req := InvalidateReqBuilder{}.WithAddress(0x10100).Build()
+			bottomPort.EXPECT().PeekIncoming().Return(req)
+			bottomPort.EXPECT().RetrieveIncoming().Return(req)
+
+			Expect(c.parseFromBottom()).To(BeTrue())
+			Expect(c.invalidating).To(BeTrue())
+		})
+
+		It("should not notify the directory of unshared lines", func() {
+			write := mem.WriteReqBuilder{}.
+				WithAddress(0x100).
+				WithData(make([]byte, 4)).
+				Build()
+			topPort.EXPECT().PeekIncoming().Return(write)
+			toL1Port.EXPECT().Send(gomock.Any())
+			topPort.EXPECT().RetrieveIncoming().Return(write)
+
+			Expect(c.parseFromTop()).To(BeTrue())
+		})
+
+		Context("with stale lines", func() {
+			BeforeEach(func() {
+				builder = builder.WithMaxStaleLines(1)
+				build()
+			})
+
+			It("should only invalidate the notified line", func() {
+				req := InvalidateReqBuilder{}.WithAddress(0x10100).Build()
+				bottomPort.EXPECT().PeekIncoming().Return(req)
+				bottomPort.EXPECT().RetrieveIncoming().Return(req)
+
+				Expect(c.parseFromBottom()).To(BeTrue())
+				Expect(c.invalidating).To(BeFalse())
+				Expect(c.staleLines).To(HaveKey(uint64(0x10100)))
+			})
+
+			It("should bypass the L1 cache for the stale lines", func() {
+				c.staleLines[0x10100] = true
+				read := remoteRead()
+				topPort.EXPECT().PeekIncoming().Return(read)
+				bottomPort.EXPECT().Send(gomock.Any()).
+					DoAndReturn(func(msg sim.Msg) *sim.SendError {
+						Expect(msg.Meta().Dst).To(Equal(sim.RemotePort("RDMA")))
+						return nil
+					})
+				topPort.EXPECT().RetrieveIncoming().Return(read)
+
+				Expect(c.parseFromTop()).To(BeTrue())
+				Expect(c.NumBypasses()).To(Equal(uint64(1)))
+			})
+
+			It("should flush the L1 cache if too many lines are stale", func() {
+				c.invalidateLine(0x10100)
+				c.invalidateLine(0x10200)
+
+				Expect(c.invalidating).To(BeTrue())
+			})
+		})
+	})
+
+	Context("when invalidating", func() {
+		BeforeEach(func() {
+			build()
+			c.invalidating = true
+		})
+
+		It("should wait for the in-flight requests", func() {
+			c.numInflightToL1 = 1
+
+			Expect(c.invalidate()).To(BeFalse())
+		})
+
+		It("should flush the L1 cache", func() {
+			ctrlPort.EXPECT().Send(gomock.Any()).
+				DoAndReturn(func(msg sim.Msg) *sim.SendError {
+					Expect(msg.Meta().Dst).To(Equal(sim.RemotePort("L1Ctrl")))
+					return nil
+				})
+
+			Expect(c.invalidate()).To(BeTrue())
+			Expect(c.currFlushReq).NotTo(BeNil())
+			Expect(c.invalidate()).To(BeFalse())
+		})
+
+		It("should resume after the flush completes", func() {
+			c.currFlushReq = cache.FlushReqBuilder{}.Build()
+			c.staleLines[0x10100] = true
+			c.leaseActive = true
+			rsp := cache.FlushRspBuilder{}.
+				WithRspTo(c.currFlushReq.ID).
+				Build()
+			ctrlPort.EXPECT().PeekIncoming().Return(rsp)
+			ctrlPort.EXPECT().RetrieveIncoming().Return(rsp)
+
+			Expect(c.parseFromCtrl()).To(BeTrue())
+			Expect(c.invalidating).To(BeFalse())
+			Expect(c.staleLines).To(BeEmpty())
+			Expect(c.leaseActive).To(BeFalse())
+			Expect(c.NumInvalidations()).To(Equal(uint64(1)))
+		})
+	})
+})
@@ -0,0 +1,90 @@
+package coherence
+
+import (
+	"sort"
+
+	"github.com/sarchlab/akita/v4/sim"
+)
+
+// A Directory records which GPUs may have cached each line of the local
+// memory of a GPU.
+//
+// The RDMA engine of the GPU updates the directory with the accesses from the
+// other GPUs. The coherence filters of the GPU look the directory up, so that
+// only the writes to the lines that other GPUs share are notified. The lookup
+// takes no time, as if the sharers were recorded next to the lines.
+type Directory struct {
+	log2LineSize uint64
+	sharers      map[uint64]map[sim.RemotePort]bool
+}
+
+// NewDirectory creates a directory that tracks lines of 2^log2LineSize bytes.
+func NewDirectory(log2LineSize uint64) *Directory {
+	return &Directory{
+		log2LineSize: log2LineSize,
+		sharers:      make(map[uint64]map[sim.RemotePort]bool),
+	}
+}
+
+// LineAddress returns the address of the line that holds the address.
+func (d *Directory) LineAddress(addr uint64) uint64 {
+	return addr >> d.log2LineSize << d.log2LineSize
+}
+
+// AddSharer records that the sharer has read the line that holds the address.
+func (d *Directory) AddSharer(addr uint64, sharer sim.RemotePort) {
+	line := d.LineAddress(addr)
+	if d.sharers[line] == nil {
+		d.sharers[line] = make(map[sim.RemotePort]bool)
+	}
+
+	d.sharers[line][sharer] = true
+}
+
+// HasSharers tells whether any GPU may have cached the line that holds the
+// address.
+func (d *Directory) HasSharers(addr uint64) bool {
+	return len(d.sharers[d.LineAddress(addr)]) > 0
+}
+
+// Sharers returns the sharers of the line that holds the address, in order.
+func (d *Directory) Sharers(addr uint64) []sim.RemotePort {
+	sharers := make([]sim.RemotePort, 0, len(d.sharers[d.LineAddress(addr)]))
+	for sharer := range d.sharers[d.LineAddress(addr)] {
+		sharers = append(sharers, sharer)
+	}
+
+	sort.Slice(sharers, func(i, j int) bool { return sharers[i] < sharers[j] })
+
+	return sharers
+}
+
+// RemoveSharers removes all the sharers of the line that holds the address,
+// except the writer, and returns the removed sharers in order. The writer is
+// empty if the line is written locally.
+func (d *Directory) RemoveSharers(
+	addr uint64,
+	writer sim.RemotePort,
+) []sim.RemotePort {
+	line := d.LineAddress(addr)
+
+	removed := make([]sim.RemotePort, 0, len(d.sharers[line]))
+	for _, sharer := range d.Sharers(line) {
+		if sharer != writer {
+			removed = append(removed, sharer)
+		}
+	}
+
+	if d.sharers[line][writer] {
+		d.sharers[line] = map[sim.RemotePort]bool{writer: true}
+	} else {
+		delete(d.sharers, line)
+	}
+
+	return removed
+}
+
+// NumSharedLines returns the number of lines that have sharers.
+func (d *Directory) NumSharedLines() int {
+	return len(d.sharers)
+}
@@ -0,0 +1,68 @@
+package coherence
+
+import (
+	"github.com/sarchlab/akita/v4/sim"
+)
+
+// InvalidateReq notifies that the data at an address has been written and
+// that the copies of the cache line in the L1 caches are stale.
+//
+// In the directory mode, a coherence filter sends the request to the RDMA
+// engine of its GPU when a shared local cache line is written. The RDMA engine
+// that is the home of the line sends the request to the RDMA engines of the
+// GPUs that have read the line, which then forward the request to the
+// coherence filters of the L1 caches that have read the line. No
+// acknowledgement is sent back.
+type InvalidateReq struct {
+	sim.MsgMeta
+
+	Address uint64
+}
+
+// Meta returns the meta data associated with the message.
+func (r *InvalidateReq) Meta() *sim.MsgMeta {
+	return &r.MsgMeta
+}
+
+// Clone returns a clone of the InvalidateReq with different ID.
+func (r *InvalidateReq) Clone() sim.Msg {
+	cloneMsg := *r
+	cloneMsg.ID = sim.GetIDGenerator().Generate()
+
+	return &cloneMsg
+}
+
+// InvalidateReqBuilder can build invalidate requests.
+type InvalidateReqBuilder struct {
+	src, dst sim.RemotePort
+	address  uint64
+}
+
+// WithSrc sets the source of the request to build.
+func (b InvalidateReqBuilder) WithSrc(src sim.RemotePort) InvalidateReqBuilder {
+	b.src = src
+	return b
+}
+
+// WithDst sets the destination of the request to build.
+func (b InvalidateReqBuilder) WithDst(dst sim.RemotePort) InvalidateReqBuilder {
+	b.dst = dst
+	return b
+}
+
+// WithAddress sets the address of the cache line that is written.
+func (b InvalidateReqBuilder) WithAddress(address uint64) InvalidateReqBuilder {
+	b.address = address
+	return b
+}
+
+// Build creates a new InvalidateReq.
+func (b InvalidateReqBuilder) Build() *InvalidateReq {
+	r := &InvalidateReq{}
+	r.ID = sim.GetIDGenerator().Generate()
+	r.Src = b.src
+	r.Dst = b.dst
+	r.Address = b.address
+
+	return r
+}
@@ -20,13 +20,48 @@ type Builder struct {
 	monitor        *monitoring.Monitor
 	perfAnalyzer   *analysis.PerfAnalyzer
 	numDispatchers int
+
+	numHWQueues      int
+	schedulingPolicy string
+
+	dispatchingAlg      string
+	numCUPerShaderArray int
+	dispatchBatchSize   int
+
+	driverSubmissionLatency int
+	doorbellLatency         int
+	packetProcessorLatency  int
+	kernargFetchLatency     int
+	wgDispatchLatencyTable  []int
+	cacheWritebackLatency   int
+	cacheInvalidateLatency  int
+
+	deviceQueuePollInterval int
+
+	invalidateRemoteCache bool
 }
 
 // MakeBuilder creates a new builder with default configuration values.
 func MakeBuilder() Builder {
 	b := Builder{
-		freq:           1 * sim.GHz,
-		numDispatchers: 8,
+		freq:             1 * sim.GHz,
+		numDispatchers:   8,
+		numHWQueues:      8,
+		schedulingPolicy: "fifo",
+
+		dispatchingAlg:      "round-robin",
+		numCUPerShaderArray: 4,
+		dispatchBatchSize:   4,
+
+		deviceQueuePollInterval: 100,
+
+		wgDispatchLatencyTable: []int{
+			1,
+			4, 4, 4, 4,
+			5, 6, 7, 8,
+			9, 10, 11, 12,
+			13, 14, 15, 16,
+		},
 	}
 	return b
 }
@@ -65,6 +100,132 @@ func (b Builder) WithPerfAnalyzer(
 	return b
 }
 
+// WithNumHWQueues sets the number of hardware queues. Each command queue that
+// launches kernels on the GPU occupies a hardware queue until its kernels
+// complete.
+func (b Builder) WithNumHWQueues(n int) Builder {
+	b.numHWQueues = n
+	return b
+}
+
+// WithSchedulingPolicy sets how the command processor arbitrates among the
+// hardware queues and allocates CUs to the concurrent kernels. The policies
+// are:
+//
+//   - "fifo": Kernels start in the order that they arrive and share all the
+//     CUs.
+//   - "priority": Kernels from the queues with higher priorities start first
+//     and take the CU resources before the other kernels.
+//   - "spatial": The CUs are split evenly among the hardware queues. A kernel
+//     only uses the CUs of its hardware queue.
+//   - "fair-share": The CUs are split evenly among the hardware queues that
+//     are running kernels. The split changes when kernels start or complete.
+func (b Builder) WithSchedulingPolicy(policy string) Builder {
+	switch policy {
+	case "fifo", "priority", "spatial", "fair-share":
+		b.schedulingPolicy = policy
+	default:
+		panic("unknown scheduling policy " + policy)
+	}
+
+	return b
+}
+
+// WithDispatchingAlg sets how the dispatchers assign work-groups to CUs. The
+// algorithms are "round-robin", "greedy", "partition",
+// "shader-array-affinity", "throttling", and "batch-interleaved". The
+// throttling algorithm reads the miss rates of the L1 vector caches.
+func (b Builder) WithDispatchingAlg(alg string) Builder {
+	switch alg {
+	case "round-robin", "greedy", "partition",
+		"shader-array-affinity", "throttling", "batch-interleaved":
+		b.dispatchingAlg = alg
+	default:
+		panic("unknown dispatching algorithm " + alg)
+	}
+
+	return b
+}
+
+// WithNumCUPerShaderArray sets the number of CUs in a shader array. The
+// shader-array-affinity algorithm keeps neighboring work-groups in the same
+// shader array.
+func (b Builder) WithNumCUPerShaderArray(n int) Builder {
+	b.numCUPerShaderArray = n
+	return b
+}
+
+// WithDispatchBatchSize sets the number of consecutive work-groups that the
+// batch-interleaved algorithm dispatches to the same CU.
+func (b Builder) WithDispatchBatchSize(n int) Builder {
+	b.dispatchBatchSize = n
+	return b
+}
+
+// WithDriverSubmissionLatency sets the number of cycles that the driver takes
+// to write a kernel dispatch packet into the queue.
+func (b Builder) WithDriverSubmissionLatency(cycles int) Builder {
+	b.driverSubmissionLatency = cycles
+	return b
+}
+
+// WithDoorbellLatency sets the number of cycles from the driver ringing the
+// doorbell to the Command Processor noticing the new packet.
+func (b Builder) WithDoorbellLatency(cycles int) Builder {
+	b.doorbellLatency = cycles
+	return b
+}
+
+// WithPacketProcessorLatency sets the number of cycles that the packet
+// processor takes to decode a kernel dispatch packet.
+func (b Builder) WithPacketProcessorLatency(cycles int) Builder {
+	b.packetProcessorLatency = cycles
+	return b
+}
+
+// WithKernargFetchLatency sets the number of cycles to fetch the kernel
+// arguments before the first work-group is dispatched.
+func (b Builder) WithKernargFetchLatency(cycles int) Builder {
+	b.kernargFetchLatency = cycles
+	return b
+}
+
+// WithWGDispatchLatencyTable sets the number of cycles to dispatch a
+// work-group. The i-th entry is the latency of a work-group with i wavefronts.
+// Work-groups with more wavefronts use the last entry.
+func (b Builder) WithWGDispatchLatencyTable(table []int) Builder {
+	b.wgDispatchLatencyTable = table
+	return b
+}
+
+// WithCacheWritebackLatency sets the number of cycles to write back the dirty
+// cache lines at the end of a kernel.
+func (b Builder) WithCacheWritebackLatency(cycles int) Builder {
+	b.cacheWritebackLatency = cycles
+	return b
+}
+
+// WithCacheInvalidateLatency sets the number of cycles to invalidate the
+// caches at the end of a kernel.
+func (b Builder) WithCacheInvalidateLatency(cycles int) Builder {
+	b.cacheInvalidateLatency = cycles
+	return b
+}
+
+// WithDeviceQueuePollInterval sets the number of cycles between two reads of
+// the write index of a device queue.
+func (b Builder) WithDeviceQueuePollInterval(cycles int) Builder {
+	b.deviceQueuePollInterval = cycles
+	return b
+}
+
+// WithRemoteCacheInvalidation lets the Command Processor invalidate the
+// remote-data cache of the RDMA engine before starting each kernel.
+func (b Builder) WithRemoteCacheInvalidation() Builder {
+	b.invalidateRemoteCache = true
+	return b
+}
+
 // Build builds a new Command Processor
 func (b Builder) Build(name string) *CommandProcessor {
 	cp := new(CommandProcessor)
@@ -78,9 +239,18 @@ func (b Builder) Build(name string) *CommandProcessor {
 		make(map[string]*protocol.MemCopyH2DReq)
 	cp.bottomMemCopyD2HReqIDToTopReqMap =
 		make(map[string]*protocol.MemCopyD2HReq)
+	cp.bottomMemCopyD2DReqIDToTopReqMap =
+		make(map[string]*protocol.MemCopyD2DReq)
 
 	b.buildDispatchers(cp)
 
+	cp.schedulingPolicy = b.schedulingPolicy
+	cp.hwQueues = make([]*hwQueue, b.numHWQueues)
+	cp.deviceQueueReads = make(map[string]*deviceQueueRead)
+	cp.deviceQueueWrites = make(map[string]*kernelTree)
+	cp.deviceQueuePollInterval = b.deviceQueuePollInterval
+	cp.invalidateRemoteCache = b.invalidateRemoteCache
+
 	cp.middleware = &cpMiddleware{cp}
 	cp.ctrlMiddleware = &ctrlMiddleware{cp}
 
@@ -98,6 +268,8 @@ func (Builder) createPorts(cp *CommandProcessor, name string) {
 	cp.ToTLBs = sim.NewPort(cp, 4096, 4096, name+".ToTLBs")
 	cp.ToRDMA = sim.NewPort(cp, 4096, 4096, name+".ToRDMA")
 	cp.ToPMC = sim.NewPort(cp, 4096, 4096, name+".ToPMC")
+	cp.ToAccessCounter = sim.NewPort(cp, 4096, 4096, name+".ToAccessCounter")
+	cp.ToMem = sim.NewPort(cp, 4096, 4096, name+".ToMem")
 	cp.ToAddressTranslators = sim.NewPort(cp, 4096, 4096,
 		name+".ToAddressTranslators")
 	cp.ToCaches = sim.NewPort(cp, 4096, 4096, name+".ToCaches")
@@ -107,7 +279,13 @@ func (b *Builder) buildDispatchers(cp *CommandProcessor) {
 	cuResourcePool := resource.NewCUResourcePool()
 	builder := dispatching.MakeBuilder().
 		WithCP(cp).
-		WithAlg("round-robin").
+		WithAlg(b.dispatchingAlg).
+		WithNumCUPerShaderArray(b.numCUPerShaderArray).
+		WithBatchSize(b.dispatchBatchSize).
+		WithCacheMissFeedback(&cacheMissMonitor{cp: cp}).
+		WithLatencyTable(b.wgDispatchLatencyTable).
+		WithKernelLaunchOverhead(b.kernelLaunchOverhead()).
+		WithKernelCompletionOverhead(b.kernelCompletionOverhead()).
 		WithCUResourcePool(cuResourcePool).
 		WithDispatchingPort(cp.ToCUs).
 		WithRespondingPort(cp.ToDriver).
@@ -123,3 +301,18 @@ func (b *Builder) buildDispatchers(cp *CommandProcessor) {
 		cp.Dispatchers = append(cp.Dispatchers, disp)
 	}
 }
+
+// kernelLaunchOverhead is the number of cycles from the arrival of a kernel to
+// the dispatch of its first work-group.
+func (b *Builder) kernelLaunchOverhead() int {
+	return b.driverSubmissionLatency +
+		b.doorbellLatency +
+		b.packetProcessorLatency +
+		b.kernargFetchLatency
+}
+
+// kernelCompletionOverhead is the number of cycles from the completion of the
+// last work-group of a kernel to the completion of the kernel.
+func (b *Builder) kernelCompletionOverhead() int {
+	return b.cacheWritebackLatency + b.cacheInvalidateLatency
+}
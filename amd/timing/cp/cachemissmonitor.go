@@ -0,0 +1,81 @@
+package cp
+
+import (
+	"github.com/sarchlab/akita/v4/tracing"
+)
+
+// A cacheMissMonitor counts the hits and misses of the L1 vector caches of the
+// CUs, so that the dispatchers can adapt to the cache behavior at runtime.
+// The caches are hooked when the miss rate is first read, as the caches are
+// connected to the Command Processor after it is built.
+type cacheMissMonitor struct {
+	cp *CommandProcessor
+
+	hooked     bool
+	tracers    []*tracing.StepCountTracer
+	lastHits   map[int]uint64
+	lastMisses map[int]uint64
+}
+
+// MissRate returns the read miss rate of the L1 vector cache of a CU since the
+// previous call for the same CU. If the CUs share a cache, the rate covers the
+// accesses of all the CUs that share it.
+func (m *cacheMissMonitor) MissRate(cuID int) (float64, bool) {
+	m.hookCaches()
+
+	cacheID := m.cacheOfCU(cuID)
+	if cacheID < 0 || cacheID >= len(m.tracers) || m.tracers[cacheID] == nil {
+		return 0, false
+	}
+
+	t := m.tracers[cacheID]
+	hits := t.GetStepCount("read-hit") + t.GetStepCount("read-mshr-hit")
+	misses := t.GetStepCount("read-miss")
+
+	newHits := hits - m.lastHits[cuID]
+	newMisses := misses - m.lastMisses[cuID]
+	m.lastHits[cuID] = hits
+	m.lastMisses[cuID] = misses
+
+	if newHits+newMisses == 0 {
+		return 0, false
+	}
+
+	return float64(newMisses) / float64(newHits+newMisses), true
+}
+
+func (m *cacheMissMonitor) hookCaches() {
+	if m.hooked {
+		return
+	}
+
+	m.hooked = true
+	m.tracers = make([]*tracing.StepCountTracer, len(m.cp.L1VCaches))
+	m.lastHits = make(map[int]uint64)
+	m.lastMisses = make(map[int]uint64)
+
+	for i, port := range m.cp.L1VCaches {
+		cache, ok := port.Component().(tracing.NamedHookable)
+		if !ok {
+			continue
+		}
+
+		m.tracers[i] = tracing.NewStepCountTracer(
+			func(task tracing.Task) bool { return true })
+		tracing.CollectTrace(cache, m.tracers[i])
+	}
+}
+
+// cacheOfCU returns the index of the L1 vector cache that a CU uses. It
+// returns -1 if the CU is unknown.
+func (m *cacheMissMonitor) cacheOfCU(cuID int) int {
+	if len(m.cp.L1VCacheOfCU) == 0 {
+		return cuID
+	}
+
+	if cuID >= len(m.cp.L1VCacheOfCU) {
+		return -1
+	}
+
+	return m.cp.L1VCacheOfCU[cuID]
+}
@@ -0,0 +1,66 @@
+package cp
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sarchlab/akita/v4/tracing"
+)
+
+var _ = Describe("Cache Miss Monitor", func() {
+	var (
+		cp      *CommandProcessor
+		monitor *cacheMissMonitor
+		tracer  *tracing.StepCountTracer
+	)
+
+	access := func(id, what string) {
+		task := tracing.Task{ID: id}
+		tracer.StartTask(task)
+		task.Steps = []tracing.TaskStep{{What: what}}
+		tracer.StepTask(task)
+	}
+
+	BeforeEach(func() {
+		cp = &CommandProcessor{}
+		tracer = tracing.NewStepCountTracer(
+			func(task tracing.Task) bool { return true })
+		monitor = &cacheMissMonitor{
+			cp:         cp,
+			hooked:     true,
+			tracers:    []*tracing.StepCountTracer{tracer},
+			lastHits:   make(map[int]uint64),
+			lastMisses: make(map[int]uint64),
+		}
+	})
+
+	It("should read the cache with the index of the CU by default", func() {
+		access("1", "read-miss")
+
+		rate, ok := monitor.MissRate(0)
+		Expect(ok).To(BeTrue())
+		Expect(rate).To(Equal(1.0))
+
+		_, ok = monitor.MissRate(1)
+		Expect(ok).To(BeFalse())
+	})
+
+	It("should read the cache that the CUs share", func() {
+		cp.L1VCacheOfCU = []int{0, 0}
+		access("1", "read-miss")
+		access("2", "read-hit")
+
+		rate, ok := monitor.MissRate(0)
+		Expect(ok).To(BeTrue())
+		Expect(rate).To(Equal(0.5))
+
+		rate, ok = monitor.MissRate(1)
+		Expect(ok).To(BeTrue())
+		Expect(rate).To(Equal(0.5))
+
+		_, ok = monitor.MissRate(0)
+		Expect(ok).To(BeFalse())
+
+		_, ok = monitor.MissRate(2)
+		Expect(ok).To(BeFalse())
+	})
+})
@@ -2,6 +2,7 @@ package cp
 
 import (
 	"github.com/sarchlab/akita/v4/mem/idealmemcontroller"
+	"github.com/sarchlab/akita/v4/mem/mem"
 	"github.com/sarchlab/akita/v4/sim"
 	"github.com/sarchlab/mgpusim/v4/amd/protocol"
 	"github.com/sarchlab/mgpusim/v4/amd/timing/cp/internal/dispatching"
@@ -28,6 +29,16 @@ type CommandProcessor struct {
 	L2Caches           []sim.Port
 	DRAMControllers    []*idealmemcontroller.Comp
 
+	// DeviceQueueMemory finds the module that serves the reads of the device
+	// queues. In a GPU with caches, the reads must go to the L2 caches to see
+	// the writes of the wavefronts.
+	DeviceQueueMemory mem.AddressToPortMapper
+
+	// L1VCacheOfCU maps each CU to the index of the L1 vector cache in
+	// L1VCaches that the CU uses. If empty, each CU uses the L1 vector cache
+	// with the same index.
+	L1VCacheOfCU []int
+
 	ToDriver             sim.Port
 	ToDMA                sim.Port
 	ToCUs                sim.Port
@@ -36,6 +47,8 @@ type CommandProcessor struct {
 	ToCaches             sim.Port
 	ToRDMA               sim.Port
 	ToPMC                sim.Port
+	ToAccessCounter      sim.Port
+	ToMem                sim.Port
 
 	currShootdownRequest *protocol.ShootDownCommand
 	currFlushRequest     *protocol.FlushReq
@@ -46,11 +59,27 @@ type CommandProcessor struct {
 	numTLBAck                    uint64
 	numCacheACK                  uint64
 
-	shootDownInProcess bool
+	shootDownInProcess  bool
+	restartingL1ICaches bool
 
 	bottomKernelLaunchReqIDToTopReqMap map[string]*protocol.LaunchKernelReq
 	bottomMemCopyH2DReqIDToTopReqMap   map[string]*protocol.MemCopyH2DReq
 	bottomMemCopyD2HReqIDToTopReqMap   map[string]*protocol.MemCopyD2HReq
+	bottomMemCopyD2DReqIDToTopReqMap   map[string]*protocol.MemCopyD2DReq
+
+	schedulingPolicy string
+	hwQueues         []*hwQueue
+	hwQueueStats     []*HWQueueStats
+	cuMaskStats      []*CUMaskStats
+	nextKernelSeq    uint64
+
+	kernelTrees             []*kernelTree
+	deviceQueueReads        map[string]*deviceQueueRead
+	deviceQueueWrites       map[string]*kernelTree
+	deviceQueuePollInterval int
+
+	invalidateRemoteCache bool
+	invalidatingKernels   []*hwQueueKernel
 
 	middleware     *cpMiddleware
 	ctrlMiddleware *ctrlMiddleware
@@ -78,6 +107,10 @@ func (p *CommandProcessor) Tick() bool {
 	madeProgress := false
 
 	madeProgress = p.tickDispatchers() || madeProgress
+	madeProgress = p.collectCompletedKernels() || madeProgress
+	madeProgress = p.scheduleKernels() || madeProgress
+	madeProgress = p.sendRDMACacheInvalidations() || madeProgress
+	madeProgress = p.processKernelTrees() || madeProgress
 	madeProgress = p.processReqFromDriver() || madeProgress
 	madeProgress = p.processRspFromInternal() || madeProgress
 
@@ -85,7 +118,7 @@ func (p *CommandProcessor) Tick() bool {
 }
 
 func (p *CommandProcessor) tickDispatchers() (madeProgress bool) {
-	for _, d := range p.Dispatchers {
+	for _, d := range p.dispatchersInTickOrder() {
 		madeProgress = d.Tick() || madeProgress
 	}
 
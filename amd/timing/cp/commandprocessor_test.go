@@ -10,6 +10,7 @@ import (
 	"github.com/sarchlab/akita/v4/mem/vm/tlb"
 	"github.com/sarchlab/akita/v4/sim"
 	"github.com/sarchlab/mgpusim/v4/amd/protocol"
+	"github.com/sarchlab/mgpusim/v4/amd/timing/accesscounter"
 	"github.com/sarchlab/mgpusim/v4/amd/timing/cp/internal/dispatching"
 	"github.com/sarchlab/mgpusim/v4/amd/timing/pagemigrationcontroller"
 	"github.com/sarchlab/mgpusim/v4/amd/timing/rdma"
@@ -166,7 +167,9 @@ var _ = Describe("CommandProcessor", func() {
 	It("should forward kernel launching request to a Dispatcher", func() {
 		req := protocol.NewLaunchKernelReq(driver, commandProcessor.ToDriver)
 
+		engine.EXPECT().CurrentTime().Return(sim.VTimeInSec(0)).AnyTimes()
 		dispatcher.EXPECT().IsDispatching().Return(false)
+		dispatcher.EXPECT().SetCUMask(nil)
 		dispatcher.EXPECT().StartDispatching(req)
 		toDriver.EXPECT().RetrieveIncoming()
 
@@ -175,14 +178,68 @@ var _ = Describe("CommandProcessor", func() {
 		Expect(madeProgress).To(BeTrue())
 	})
 
-	It("should wait if there is no dispatcher available", func() {
+	It("should queue the kernel if there is no dispatcher available", func() {
 		req := protocol.NewLaunchKernelReq(driver, commandProcessor.ToDriver)
 
+		engine.EXPECT().CurrentTime().Return(sim.VTimeInSec(0)).AnyTimes()
 		dispatcher.EXPECT().IsDispatching().Return(true)
+		toDriver.EXPECT().RetrieveIncoming()
 
 		madeProgress := commandProcessor.middleware.processLaunchKernelReq(req)
 
-		Expect(madeProgress).To(BeFalse())
+		Expect(madeProgress).To(BeTrue())
+		Expect(commandProcessor.hwQueues[0].pending).To(HaveLen(1))
+	})
+
+	It("should forward preemption request to the Dispatcher", func() {
+		req := protocol.NewPreemptKernelReq(
+			driver.AsRemote(), toDriver.AsRemote(),
+			"kernel", protocol.PreemptionModeSaveState)
+
+		dispatcher.EXPECT().DispatchingKernelID().Return("kernel")
+		dispatcher.EXPECT().Preempt(req).Return(true)
+		toDriver.EXPECT().RetrieveIncoming()
+
+		madeProgress := commandProcessor.middleware.processPreemptKernelReq(req)
+
+		Expect(madeProgress).To(BeTrue())
+	})
+
+	It("should respond if the kernel is not being dispatched", func() {
+		req := protocol.NewPreemptKernelReq(
+			driver.AsRemote(), toDriver.AsRemote(),
+			"kernel", protocol.PreemptionModeDrain)
+
+		dispatcher.EXPECT().DispatchingKernelID().Return("")
+		toDriver.EXPECT().
+			Send(gomock.Any()).
+			Do(func(msg sim.Msg) {
+				rsp := msg.(*protocol.PreemptKernelRsp)
+				Expect(rsp.RspTo).To(Equal(req.ID))
+				Expect(rsp.Preempted).To(BeFalse())
+			}).
+			Return(nil)
+		toDriver.EXPECT().RetrieveIncoming()
+
+		madeProgress := commandProcessor.middleware.processPreemptKernelReq(req)
+
+		Expect(madeProgress).To(BeTrue())
+	})
+
+	It("should resume a preempted kernel", func() {
+		req := protocol.NewResumeKernelReq(
+			driver.AsRemote(), toDriver.AsRemote(), "kernel")
+
+		dispatcher.EXPECT().DispatchingKernelID().Return("kernel")
+		dispatcher.EXPECT().Resume().Return(true)
+		toDriver.EXPECT().
+			Send(gomock.AssignableToTypeOf(&protocol.ResumeKernelRsp{})).
+			Return(nil)
+		toDriver.EXPECT().RetrieveIncoming()
+
+		madeProgress := commandProcessor.middleware.processResumeKernelReq(req)
+
+		Expect(madeProgress).To(BeTrue())
 	})
 
 	It("should handle a RDMA drain req from driver", func() {
@@ -362,14 +419,6 @@ var _ = Describe("CommandProcessor", func() {
 		nilPort.EXPECT().AsRemote().AnyTimes()
 		req := protocol.NewGPURestartReq(nilPort, commandProcessor.ToDriver)
 
-		for i := 0; i < 10; i++ {
-			cacheRestartReq := cache.RestartReqBuilder{}.Build()
-			cacheRestartReq.Src = commandProcessor.ToCaches.AsRemote()
-			cacheRestartReq.Dst = commandProcessor.L1ICaches[i].AsRemote()
-			toCaches.EXPECT().
-				Send(gomock.AssignableToTypeOf(cacheRestartReq))
-		}
-
 		for i := 0; i < 10; i++ {
 			cacheRestartReq := cache.RestartReqBuilder{}.Build()
 			cacheRestartReq.Src = commandProcessor.ToCaches.AsRemote()
@@ -399,7 +448,7 @@ var _ = Describe("CommandProcessor", func() {
 		madeProgress := commandProcessor.ctrlMiddleware.processGPURestartReq(req)
 
 		Expect(madeProgress).To(BeTrue())
-		Expect(commandProcessor.numCacheACK).To(Equal(uint64(40)))
+		Expect(commandProcessor.numCacheACK).To(Equal(uint64(30)))
 	})
 
 	It("should handle a cache restart rsp", func() {
@@ -448,19 +497,43 @@ var _ = Describe("CommandProcessor", func() {
 			Build()
 		commandProcessor.numAddrTranslationRestartAck = 1
 
+		for i := 0; i < 10; i++ {
+			cacheRestartReq := cache.RestartReqBuilder{}.Build()
+			cacheRestartReq.Src = commandProcessor.ToCaches.AsRemote()
+			cacheRestartReq.Dst = commandProcessor.L1ICaches[i].AsRemote()
+			toCaches.EXPECT().
+				Send(gomock.AssignableToTypeOf(cacheRestartReq))
+		}
+		toAddressTranslator.EXPECT().RetrieveIncoming()
+
+		madeProgress :=
+			commandProcessor.ctrlMiddleware.processAddressTranslatorRestartRsp(req)
+
+		Expect(commandProcessor.numCacheACK).To(Equal(uint64(10)))
+		Expect(commandProcessor.restartingL1ICaches).To(BeTrue())
+		Expect(madeProgress).To(BeTrue())
+	})
+
+	It("should restart the CUs after the instruction caches", func() {
+		req := cache.RestartRspBuilder{}.Build()
+		req.Dst = commandProcessor.ToCaches.AsRemote()
+
+		commandProcessor.numCacheACK = 1
+		commandProcessor.restartingL1ICaches = true
+
 		for i := 0; i < 10; i++ {
 			cuRestartReq := protocol.CUPipelineRestartReqBuilder{}.Build()
 			cuRestartReq.Src = commandProcessor.ToCUs.AsRemote()
 			cuRestartReq.Dst = commandProcessor.CUs[i]
 			toCU.EXPECT().Send(gomock.AssignableToTypeOf(cuRestartReq))
 		}
-		toAddressTranslator.EXPECT().RetrieveIncoming()
+		toCaches.EXPECT().RetrieveIncoming()
 
-		madeProgress :=
-			commandProcessor.ctrlMiddleware.processAddressTranslatorRestartRsp(req)
+		madeProgress := commandProcessor.ctrlMiddleware.processCacheRestartRsp(req)
 
-		Expect(commandProcessor.numCUAck).To(Equal(uint64(10)))
 		Expect(madeProgress).To(BeTrue())
+		Expect(commandProcessor.numCUAck).To(Equal(uint64(10)))
+		Expect(commandProcessor.restartingL1ICaches).To(BeFalse())
 	})
 
 	It("should handle a CU pipeline restart rsp", func() {
@@ -523,4 +596,29 @@ var _ = Describe("CommandProcessor", func() {
 		Expect(madeProgress).To(BeTrue())
 	})
 
+	It("should pass the access counter notifications to the driver", func() {
+		toAccessCounter := NewMockPort(mockCtrl)
+		commandProcessor.ToAccessCounter = toAccessCounter
+
+		n := accesscounter.NotificationBuilder{}.
+			WithPAddr(0x3000).
+			WithCount(64).
+			Build()
+
+		toAccessCounter.EXPECT().PeekIncoming().Return(n)
+		toAccessCounter.EXPECT().RetrieveIncoming()
+		toDriver.EXPECT().Send(gomock.Any()).
+			DoAndReturn(func(msg sim.Msg) *sim.SendError {
+				req := msg.(*protocol.AccessCounterNotification)
+				Expect(req.PAddr).To(Equal(uint64(0x3000)))
+				Expect(req.Count).To(Equal(uint32(64)))
+				return nil
+			})
+
+		madeProgress := commandProcessor.ctrlMiddleware.
+			processAccessCounterNotification()
+
+		Expect(madeProgress).To(BeTrue())
+	})
+
 })
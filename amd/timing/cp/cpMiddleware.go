@@ -5,7 +5,6 @@ import (
 	"github.com/sarchlab/akita/v4/sim"
 	"github.com/sarchlab/akita/v4/tracing"
 	"github.com/sarchlab/mgpusim/v4/amd/protocol"
-	"github.com/sarchlab/mgpusim/v4/amd/sampling"
 	"github.com/sarchlab/mgpusim/v4/amd/timing/cp/internal/dispatching"
 )
 
@@ -28,8 +27,13 @@ func (m *cpMiddleware) Handle() bool {
 		return m.processLaunchKernelReq(req)
 	case *protocol.FlushReq:
 		return m.processFlushReq(req)
-	case *protocol.MemCopyH2DReq, *protocol.MemCopyD2HReq:
+	case *protocol.MemCopyH2DReq, *protocol.MemCopyD2HReq,
+		*protocol.MemCopyD2DReq:
 		return m.processMemCopyReq(req)
+	case *protocol.PreemptKernelReq:
+		return m.processPreemptKernelReq(req)
+	case *protocol.ResumeKernelReq:
+		return m.processResumeKernelReq(req)
 	}
 	return false
 }
@@ -91,32 +95,36 @@ func (m *cpMiddleware) findAndRemoveOriginalMemCopyRequest(
 		return originalD2HReq
 	}
 
+	originalD2DReq, ok := m.bottomMemCopyD2DReqIDToTopReqMap[rspTo]
+	if ok {
+		delete(m.bottomMemCopyD2DReqIDToTopReqMap, rspTo)
+		return originalD2DReq
+	}
+
 	panic("never")
 }
 
 func (m *cpMiddleware) processLaunchKernelReq(
 	req *protocol.LaunchKernelReq,
 ) bool {
-	d := m.findAvailableDispatcher()
-
-	if d == nil {
+	if !m.enqueueKernel(req) {
 		return false
 	}
 
-	if *sampling.SampledRunnerFlag {
-		sampling.SampledEngineInstance.Reset()
-	}
-	d.StartDispatching(req)
 	m.ToDriver.RetrieveIncoming()
 
 	tracing.TraceReqReceive(req, m.CommandProcessor)
 
+	m.scheduleKernels()
+
 	return true
 }
 
-func (m *cpMiddleware) findAvailableDispatcher() dispatching.Dispatcher {
+func (m *cpMiddleware) findDispatcherOfKernel(
+	kernelID string,
+) dispatching.Dispatcher {
 	for _, d := range m.Dispatchers {
-		if !d.IsDispatching() {
+		if d.DispatchingKernelID() == kernelID {
 			return d
 		}
 	}
@@ -124,6 +132,52 @@ func (m *cpMiddleware) findAvailableDispatcher() dispatching.Dispatcher {
 	return nil
 }
 
+func (m *cpMiddleware) processPreemptKernelReq(
+	req *protocol.PreemptKernelReq,
+) bool {
+	d := m.findDispatcherOfKernel(req.KernelID)
+	if d != nil {
+		if !d.Preempt(req) {
+			return false
+		}
+
+		m.ToDriver.RetrieveIncoming()
+
+		tracing.TraceReqReceive(req, m.CommandProcessor)
+
+		return true
+	}
+
+	rsp := protocol.NewPreemptKernelRsp(req.Dst, req.Src, req.ID)
+	err := m.ToDriver.Send(rsp)
+	if err != nil {
+		return false
+	}
+
+	m.ToDriver.RetrieveIncoming()
+
+	return true
+}
+
+func (m *cpMiddleware) processResumeKernelReq(
+	req *protocol.ResumeKernelReq,
+) bool {
+	d := m.findDispatcherOfKernel(req.KernelID)
+	if d != nil && !d.Resume() {
+		return false
+	}
+
+	rsp := protocol.NewResumeKernelRsp(req.Dst, req.Src, req.ID)
+	err := m.ToDriver.Send(rsp)
+	if err != nil {
+		return false
+	}
+
+	m.ToDriver.RetrieveIncoming()
+
+	return true
+}
+
 func (m *cpMiddleware) processFlushReq(
 	req *protocol.FlushReq,
 ) bool {
@@ -177,6 +231,8 @@ func (m *cpMiddleware) processMemCopyReq(
 		cloned = m.cloneMemCopyH2DReq(req)
 	case *protocol.MemCopyD2HReq:
 		cloned = m.cloneMemCopyD2HReq(req)
+	case *protocol.MemCopyD2DReq:
+		cloned = m.cloneMemCopyD2DReq(req)
 	default:
 		panic("unknown type")
 	}
@@ -211,6 +267,15 @@ func (m *cpMiddleware) cloneMemCopyD2HReq(
 	return &cloned
 }
 
+func (m *cpMiddleware) cloneMemCopyD2DReq(
+	req *protocol.MemCopyD2DReq,
+) *protocol.MemCopyD2DReq {
+	cloned := *req
+	cloned.ID = sim.GetIDGenerator().Generate()
+	m.bottomMemCopyD2DReqIDToTopReqMap[cloned.ID] = req
+	return &cloned
+}
+
 func (m *cpMiddleware) flushCache(port sim.Port) {
 	flushReq := cache.FlushReqBuilder{}.
 		WithSrc(m.ToCaches.AsRemote()).
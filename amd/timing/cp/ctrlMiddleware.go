@@ -7,6 +7,7 @@ import (
 	"github.com/sarchlab/akita/v4/sim"
 	"github.com/sarchlab/akita/v4/tracing"
 	"github.com/sarchlab/mgpusim/v4/amd/protocol"
+	"github.com/sarchlab/mgpusim/v4/amd/timing/accesscounter"
 	"github.com/sarchlab/mgpusim/v4/amd/timing/pagemigrationcontroller"
 	"github.com/sarchlab/mgpusim/v4/amd/timing/rdma"
 )
@@ -48,6 +49,7 @@ func (m *ctrlMiddleware) HandleInternal() bool {
 	madeProgress = m.processRspFromCaches() || madeProgress
 	madeProgress = m.processRspFromTLBs() || madeProgress
 	madeProgress = m.processRspFromPMC() || madeProgress
+	madeProgress = m.processAccessCounterNotification() || madeProgress
 	return madeProgress
 }
 
@@ -62,6 +64,11 @@ func (m *ctrlMiddleware) processRspFromRDMAs() bool {
 		return m.processRDMADrainRsp(req)
 	case *rdma.RestartRsp:
 		return m.processRDMARestartRsp(req)
+	case *rdma.InvalidateCacheRsp:
+		m.ToRDMA.RetrieveIncoming()
+		m.completeRDMACacheInvalidation(req)
+
+		return true
 	}
 
 	panic("never")
@@ -146,6 +153,28 @@ func (m *ctrlMiddleware) processRspFromPMC() bool {
 	panic("never")
 }
 
+// processAccessCounterNotification passes the notifications of the access
+// counters on to the driver.
+func (m *ctrlMiddleware) processAccessCounterNotification() bool {
+	msg := m.ToAccessCounter.PeekIncoming()
+	if msg == nil {
+		return false
+	}
+
+	n := msg.(*accesscounter.Notification)
+	req := protocol.NewAccessCounterNotification(
+		m.ToDriver.AsRemote(), m.Driver.AsRemote(), n.PAddr, n.Count)
+
+	err := m.ToDriver.Send(req)
+	if err != nil {
+		return false
+	}
+
+	m.ToAccessCounter.RetrieveIncoming()
+
+	return true
+}
+
 func (m *ctrlMiddleware) processRDMADrainRsp(
 	rsp *rdma.DrainRsp,
 ) bool {
@@ -322,7 +351,10 @@ func (m *ctrlMiddleware) processCacheRestartRsp(
 	rsp *cache.RestartRsp,
 ) bool {
 	m.numCacheACK--
-	if m.numCacheACK == 0 {
+	if m.numCacheACK == 0 && m.restartingL1ICaches {
+		m.restartingL1ICaches = false
+		m.restartCUs()
+	} else if m.numCacheACK == 0 {
 		for i := 0; i < len(m.TLBs); i++ {
 			m.numTLBAck++
 
@@ -370,15 +402,7 @@ func (m *ctrlMiddleware) processAddressTranslatorRestartRsp(
 	m.numAddrTranslationRestartAck--
 
 	if m.numAddrTranslationRestartAck == 0 {
-		for i := 0; i < len(m.CUs); i++ {
-			req := protocol.CUPipelineRestartReqBuilder{}.
-				WithSrc(m.ToCUs.AsRemote()).
-				WithDst(m.CUs[i]).
-				Build()
-			m.ToCUs.Send(req)
-
-			m.numCUAck++
-		}
+		m.restartL1ICachesOrCUs()
 	}
 
 	m.ToAddressTranslators.RetrieveIncoming()
@@ -386,6 +410,36 @@ func (m *ctrlMiddleware) processAddressTranslatorRestartRsp(
 	return true
 }
 
+// restartL1ICachesOrCUs restarts the instruction caches once the address
+// translators are running again. The instruction caches sit above their
+// address translators. Had they restarted first, the fetches that were still
+// on their way to the caches when the GPU was flushed would be passed to the
+// paused address translators and dropped when those restart, leaving the
+// caches waiting for them forever.
+func (m *ctrlMiddleware) restartL1ICachesOrCUs() {
+	if len(m.L1ICaches) == 0 {
+		m.restartCUs()
+		return
+	}
+
+	m.restartingL1ICaches = true
+	for _, port := range m.L1ICaches {
+		m.restartCache(port)
+	}
+}
+
+func (m *ctrlMiddleware) restartCUs() {
+	for i := 0; i < len(m.CUs); i++ {
+		req := protocol.CUPipelineRestartReqBuilder{}.
+			WithSrc(m.ToCUs.AsRemote()).
+			WithDst(m.CUs[i]).
+			Build()
+		m.ToCUs.Send(req)
+
+		m.numCUAck++
+	}
+}
+
 func (m *ctrlMiddleware) processCUPipelineRestartRsp(
 	rsp *protocol.CUPipelineRestartRsp,
 ) bool {
@@ -473,15 +527,14 @@ func (m *ctrlMiddleware) processShootdownCommand(
 	return true
 }
 
+// processGPURestartReq restarts the caches. The instruction caches are left
+// paused until the address translators restart.
 func (m *ctrlMiddleware) processGPURestartReq(
 	cmd *protocol.GPURestartReq,
 ) bool {
 	for _, port := range m.L2Caches {
 		m.restartCache(port)
 	}
-	for _, port := range m.L1ICaches {
-		m.restartCache(port)
-	}
 	for _, port := range m.L1SCaches {
 		m.restartCache(port)
 	}
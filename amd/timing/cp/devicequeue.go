@@ -0,0 +1,384 @@
+package cp
+
+import (
+	"encoding/binary"
+	"log"
+	"reflect"
+
+	"github.com/sarchlab/akita/v4/mem/mem"
+	"github.com/sarchlab/akita/v4/tracing"
+	"github.com/sarchlab/mgpusim/v4/amd/kernels"
+	"github.com/sarchlab/mgpusim/v4/amd/protocol"
+)
+
+// A kernelTree is a kernel that the driver launches with a device queue,
+// together with the child kernels that the kernels launch to the device
+// queue. The Command Processor polls the device queue while the tree runs and
+// responds to the driver after all the kernels in the tree complete.
+type kernelTree struct {
+	req       *protocol.LaunchKernelReq
+	parentReq *protocol.LaunchKernelReq
+	queue     *protocol.DeviceQueueInfo
+
+	readIndex       uint64
+	numOutstanding  int
+	numPacketReads  int
+	readsToSend     []*deviceQueueRead
+	indexWrite      *mem.WriteReq
+	pendingChildren []*protocol.LaunchKernelReq
+
+	parentDone    bool
+	polling       bool
+	publishing    bool
+	pollCountdown int
+	drained       bool
+}
+
+// A deviceQueueRead is a read of the header or a packet of a device queue. The
+// reads go through the L2 caches, as the wavefronts write the device queues
+// through the caches.
+type deviceQueueRead struct {
+	tree *kernelTree
+	req  *mem.ReadReq
+
+	isHeader bool
+	slot     int
+
+	// afterAllDone tells if the read is issued after the parent kernel and all
+	// the child kernels complete.
+	afterAllDone bool
+}
+
+// enqueueParentKernel dispatches a copy of a kernel that has a device queue.
+// The copy responds to the Command Processor, which holds the response to the
+// driver until the child kernels complete.
+func (p *CommandProcessor) enqueueParentKernel(
+	req *protocol.LaunchKernelReq,
+) bool {
+	tree := &kernelTree{
+		req:   req,
+		queue: req.DeviceQueue,
+	}
+
+	tree.parentReq = req.Clone().(*protocol.LaunchKernelReq)
+	tree.parentReq.Src = p.ToDriver.AsRemote()
+	tree.parentReq.Dst = p.ToDriver.AsRemote()
+
+	if !p.enqueueKernelOfTree(tree.parentReq, tree) {
+		return false
+	}
+
+	p.kernelTrees = append(p.kernelTrees, tree)
+	tracing.TraceReqReceive(tree.parentReq, p)
+
+	return true
+}
+
+// processKernelTrees polls the device queues, launches the child kernels, and
+// responds to the driver when the kernel trees complete.
+func (p *CommandProcessor) processKernelTrees() bool {
+	madeProgress := false
+
+	madeProgress = p.receiveDeviceQueueData() || madeProgress
+
+	trees := p.kernelTrees[:0]
+	for _, tree := range p.kernelTrees {
+		madeProgress = p.sendDeviceQueueReads(tree) || madeProgress
+		madeProgress = p.sendReadIndex(tree) || madeProgress
+		madeProgress = p.enqueueChildKernels(tree) || madeProgress
+		madeProgress = p.pollDeviceQueue(tree) || madeProgress
+
+		if tree.drained && p.respondKernelTree(tree) {
+			madeProgress = true
+			continue
+		}
+
+		trees = append(trees, tree)
+	}
+	p.kernelTrees = trees
+
+	return madeProgress
+}
+
+// pollDeviceQueue reads the write index of the device queue. The queue is not
+// polled until the packets of the last poll are read and the read index is
+// published.
+func (p *CommandProcessor) pollDeviceQueue(tree *kernelTree) bool {
+	if tree.polling || tree.drained || len(tree.readsToSend) > 0 ||
+		tree.numPacketReads > 0 || tree.publishing {
+		return false
+	}
+
+	if tree.pollCountdown > 0 {
+		tree.pollCountdown--
+		return true
+	}
+
+	tree.readsToSend = append(tree.readsToSend, &deviceQueueRead{
+		tree:         tree,
+		req:          p.deviceQueueReadReq(tree.queue.HeaderPAddr, 8),
+		isHeader:     true,
+		afterAllDone: tree.parentDone && tree.numOutstanding == 0,
+	})
+	tree.polling = true
+	tree.pollCountdown = p.deviceQueuePollInterval
+
+	return p.sendDeviceQueueReads(tree)
+}
+
+func (p *CommandProcessor) deviceQueueReadReq(
+	addr, byteSize uint64,
+) *mem.ReadReq {
+	return mem.ReadReqBuilder{}.
+		WithSrc(p.ToMem.AsRemote()).
+		WithDst(p.DeviceQueueMemory.Find(addr)).
+		WithAddress(addr).
+		WithByteSize(byteSize).
+		Build()
+}
+
+func (p *CommandProcessor) sendDeviceQueueReads(tree *kernelTree) bool {
+	madeProgress := false
+
+	for len(tree.readsToSend) > 0 {
+		read := tree.readsToSend[0]
+
+		err := p.ToMem.Send(read.req)
+		if err != nil {
+			break
+		}
+
+		p.deviceQueueReads[read.req.ID] = read
+		tree.readsToSend = tree.readsToSend[1:]
+		madeProgress = true
+	}
+
+	return madeProgress
+}
+
+// sendReadIndex writes the read index to the header of the device queue, so
+// that the kernels can reuse the slots that the CP has read.
+func (p *CommandProcessor) sendReadIndex(tree *kernelTree) bool {
+	if tree.indexWrite == nil {
+		return false
+	}
+
+	err := p.ToMem.Send(tree.indexWrite)
+	if err != nil {
+		return false
+	}
+
+	p.deviceQueueWrites[tree.indexWrite.ID] = tree
+	tree.indexWrite = nil
+
+	return true
+}
+
+func (p *CommandProcessor) publishReadIndex(tree *kernelTree) {
+	addr := tree.queue.HeaderPAddr + protocol.DeviceQueueReadIndexOffset
+	data := make([]byte, 8)
+	binary.LittleEndian.PutUint64(data, tree.readIndex)
+
+	tree.indexWrite = mem.WriteReqBuilder{}.
+		WithSrc(p.ToMem.AsRemote()).
+		WithDst(p.DeviceQueueMemory.Find(addr)).
+		WithAddress(addr).
+		WithData(data).
+		Build()
+	tree.publishing = true
+}
+
+func (p *CommandProcessor) enqueueChildKernels(tree *kernelTree) bool {
+	madeProgress := false
+
+	for len(tree.pendingChildren) > 0 {
+		req := tree.pendingChildren[0]
+		if !p.enqueueKernelOfTree(req, tree) {
+			break
+		}
+
+		tracing.TraceReqReceive(req, p)
+		tree.pendingChildren = tree.pendingChildren[1:]
+		madeProgress = true
+	}
+
+	if madeProgress {
+		p.scheduleKernels()
+	}
+
+	return madeProgress
+}
+
+func (p *CommandProcessor) respondKernelTree(tree *kernelTree) bool {
+	req := tree.req
+	rsp := protocol.NewLaunchKernelRsp(req.Dst, req.Src, req.ID)
+
+	err := p.ToDriver.Send(rsp)
+	if err != nil {
+		return false
+	}
+
+	tracing.TraceReqComplete(req, p)
+
+	return true
+}
+
+// receiveDeviceQueueData handles the responses of the device queue reads and
+// the read index writes.
+func (p *CommandProcessor) receiveDeviceQueueData() bool {
+	madeProgress := false
+
+	for {
+		msg := p.ToMem.RetrieveIncoming()
+		if msg == nil {
+			return madeProgress
+		}
+
+		switch rsp := msg.(type) {
+		case *mem.DataReadyRsp:
+			p.processDeviceQueueRsp(rsp)
+		case *mem.WriteDoneRsp:
+			p.processReadIndexWriteDone(rsp)
+		default:
+			log.Panicf("cannot handle %s from the memory",
+				reflect.TypeOf(msg))
+		}
+
+		madeProgress = true
+	}
+}
+
+func (p *CommandProcessor) processReadIndexWriteDone(rsp *mem.WriteDoneRsp) {
+	tree, ok := p.deviceQueueWrites[rsp.RespondTo]
+	if !ok {
+		panic("cannot find the device queue write")
+	}
+
+	delete(p.deviceQueueWrites, rsp.RespondTo)
+	tree.publishing = false
+}
+
+func (p *CommandProcessor) processDeviceQueueRsp(rsp *mem.DataReadyRsp) {
+	read, ok := p.deviceQueueReads[rsp.RespondTo]
+	if !ok {
+		panic("cannot find the device queue read")
+	}
+
+	delete(p.deviceQueueReads, rsp.RespondTo)
+
+	if read.isHeader {
+		p.processDeviceQueueHeader(read, rsp.Data)
+	} else {
+		p.processDeviceQueuePacket(read, rsp.Data)
+	}
+}
+
+func (p *CommandProcessor) processDeviceQueueHeader(
+	read *deviceQueueRead,
+	data []byte,
+) {
+	tree := read.tree
+	tree.polling = false
+
+	writeIndex := binary.LittleEndian.Uint64(data)
+	if writeIndex <= tree.readIndex {
+		if read.afterAllDone {
+			tree.drained = true
+		}
+
+		return
+	}
+
+	numSlots := uint64(len(tree.queue.SlotPAddrs))
+	if writeIndex-tree.readIndex > numSlots {
+		log.Panicf("device queue at 0x%x overflowed, the write index is %d "+
+			"but the CP has only read %d packets of the %d slots, the "+
+			"kernels must wait for the read index before writing a packet",
+			tree.queue.Address, writeIndex, tree.readIndex, numSlots)
+	}
+
+	for i := tree.readIndex; i < writeIndex; i++ {
+		slot := int(i % numSlots)
+		tree.readsToSend = append(tree.readsToSend, &deviceQueueRead{
+			tree: tree,
+			req: p.deviceQueueReadReq(tree.queue.SlotPAddrs[slot],
+				protocol.DeviceQueueSlotSize),
+			slot: slot,
+		})
+		tree.numOutstanding++
+		tree.numPacketReads++
+	}
+
+	tree.readIndex = writeIndex
+}
+
+func (p *CommandProcessor) processDeviceQueuePacket(
+	read *deviceQueueRead,
+	data []byte,
+) {
+	tree := read.tree
+	packet := decodeKernelDispatchPacket(data)
+
+	tree.numPacketReads--
+	if tree.numPacketReads == 0 {
+		p.publishReadIndex(tree)
+	}
+
+	co, ok := tree.queue.CodeObjects[packet.KernelObject]
+	if !ok {
+		panic("the kernel object is not registered with the device queue")
+	}
+
+	req := protocol.NewLaunchKernelReq(p.ToDriver, p.ToDriver)
+	req.PID = tree.req.PID
+	req.HsaCo = co
+	req.Packet = packet
+	req.PacketAddress = tree.queue.Address +
+		protocol.DeviceQueueHeaderSize +
+		uint64(read.slot*protocol.DeviceQueueSlotSize)
+	req.QueueID = tree.req.QueueID + ".DeviceQueue"
+	req.Priority = tree.req.Priority
+	req.CUMask = tree.req.CUMask
+
+	tree.pendingChildren = append(tree.pendingChildren, req)
+}
+
+// completeTreeKernel updates the kernel tree when one of its kernels
+// completes.
+func (p *CommandProcessor) completeTreeKernel(k *hwQueueKernel) {
+	tree := k.tree
+	if tree == nil {
+		return
+	}
+
+	if k.req == tree.parentReq {
+		tree.parentDone = true
+		return
+	}
+
+	tree.numOutstanding--
+}
+
+// decodeKernelDispatchPacket decodes an AQL kernel dispatch packet from its
+// 64-byte little-endian memory layout.
+func decodeKernelDispatchPacket(
+	buf []byte,
+) *kernels.HsaKernelDispatchPacket {
+	le := binary.LittleEndian
+
+	return &kernels.HsaKernelDispatchPacket{
+		Header:             le.Uint16(buf[0:]),
+		Setup:              le.Uint16(buf[2:]),
+		WorkgroupSizeX:     le.Uint16(buf[4:]),
+		WorkgroupSizeY:     le.Uint16(buf[6:]),
+		WorkgroupSizeZ:     le.Uint16(buf[8:]),
+		GridSizeX:          le.Uint32(buf[12:]),
+		GridSizeY:          le.Uint32(buf[16:]),
+		GridSizeZ:          le.Uint32(buf[20:]),
+		PrivateSegmentSize: le.Uint32(buf[24:]),
+		GroupSegmentSize:   le.Uint32(buf[28:]),
+		KernelObject:       le.Uint64(buf[32:]),
+		KernargAddress:     le.Uint64(buf[40:]),
+		CompletionSignal:   le.Uint64(buf[56:]),
+	}
+}
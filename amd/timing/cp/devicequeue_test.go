@@ -0,0 +1,386 @@
+package cp
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sarchlab/akita/v4/mem/mem"
+	"github.com/sarchlab/akita/v4/sim"
+	"github.com/sarchlab/mgpusim/v4/amd/insts"
+	"github.com/sarchlab/mgpusim/v4/amd/kernels"
+	"github.com/sarchlab/mgpusim/v4/amd/protocol"
+	"go.uber.org/mock/gomock"
+)
+
+var _ = Describe("Device Queue", func() {
+	var (
+		mockCtrl *gomock.Controller
+		engine   *MockEngine
+		toDriver *MockPort
+		toMem    *MockPort
+		cp       *CommandProcessor
+		co       *insts.HsaCo
+		queue    *protocol.DeviceQueueInfo
+	)
+
+	BeforeEach(func() {
+		mockCtrl = gomock.NewController(GinkgoT())
+		engine = NewMockEngine(mockCtrl)
+		toDriver = NewMockPort(mockCtrl)
+		toMem = NewMockPort(mockCtrl)
+
+		engine.EXPECT().CurrentTime().Return(sim.VTimeInSec(1)).AnyTimes()
+		toDriver.EXPECT().AsRemote().Return(sim.RemotePort("ToDriver")).
+			AnyTimes()
+		toMem.EXPECT().AsRemote().Return(sim.RemotePort("ToMem")).AnyTimes()
+
+		cp = MakeBuilder().
+			WithEngine(engine).
+			WithFreq(1).
+			WithDeviceQueuePollInterval(2).
+			Build("CP")
+		cp.ToDriver = toDriver
+		cp.ToMem = toMem
+		cp.DeviceQueueMemory = &mem.SinglePortMapper{Port: "L2"}
+		cp.Dispatchers = nil
+
+		co = insts.NewHsaCo()
+		queue = &protocol.DeviceQueueInfo{
+			Address:     0x1000,
+			HeaderPAddr: 0x2000,
+			SlotPAddrs:  []uint64{0x2040, 0x2080},
+			CodeObjects: map[uint64]*insts.HsaCo{0x3000: co},
+		}
+	})
+
+	AfterEach(func() {
+		mockCtrl.Finish()
+	})
+
+	launchParent := func() *kernelTree {
+		req := protocol.NewLaunchKernelReq(toDriver, toDriver)
+		req.Src = "Driver"
+		req.QueueID = "q0"
+		req.DeviceQueue = queue
+
+		Expect(cp.enqueueKernel(req)).To(BeTrue())
+
+		return cp.kernelTrees[0]
+	}
+
+	respond := func(read *deviceQueueRead, data []byte) {
+		rsp := mem.DataReadyRspBuilder{}.
+			WithRspTo(read.req.ID).
+			WithData(data).
+			Build()
+
+		cp.processDeviceQueueRsp(rsp)
+	}
+
+	writeIndex := func(index uint64) []byte {
+		data := make([]byte, 8)
+		binary.LittleEndian.PutUint64(data, index)
+
+		return data
+	}
+
+	It("should decode kernel dispatch packets", func() {
+		packet := kernels.HsaKernelDispatchPacket{
+			WorkgroupSizeX:   64,
+			WorkgroupSizeY:   1,
+			WorkgroupSizeZ:   1,
+			GridSizeX:        256,
+			GridSizeY:        2,
+			GridSizeZ:        1,
+			GroupSegmentSize: 128,
+			KernelObject:     0x3000,
+			KernargAddress:   0x4000,
+			CompletionSignal: 0x5000,
+		}
+		buf := bytes.NewBuffer(nil)
+		Expect(binary.Write(buf, binary.LittleEndian, packet)).To(Succeed())
+
+		Expect(*decodeKernelDispatchPacket(buf.Bytes())).To(Equal(packet))
+	})
+
+	It("should dispatch a copy of the kernel that responds to the CP", func() {
+		tree := launchParent()
+
+		k := cp.hwQueues[0].pending[0]
+		Expect(k.req).To(BeIdenticalTo(tree.parentReq))
+		Expect(k.req.ID).NotTo(Equal(tree.req.ID))
+		Expect(k.req.Src).To(Equal(sim.RemotePort("ToDriver")))
+		Expect(k.tree).To(BeIdenticalTo(tree))
+	})
+
+	It("should read the write index of the device queue", func() {
+		tree := launchParent()
+
+		toMem.EXPECT().RetrieveIncoming().Return(nil)
+		toMem.EXPECT().Send(gomock.Any()).
+			Do(func(req *mem.ReadReq) {
+				Expect(req.Address).To(Equal(uint64(0x2000)))
+				Expect(req.AccessByteSize).To(Equal(uint64(8)))
+				Expect(req.Dst).To(Equal(sim.RemotePort("L2")))
+			})
+
+		madeProgress := cp.processKernelTrees()
+
+		Expect(madeProgress).To(BeTrue())
+		Expect(tree.polling).To(BeTrue())
+		Expect(tree.pollCountdown).To(Equal(2))
+		Expect(cp.deviceQueueReads).To(HaveLen(1))
+	})
+
+	It("should read the new packets", func() {
+		tree := launchParent()
+		toMem.EXPECT().RetrieveIncoming().Return(nil).Times(2)
+		toMem.EXPECT().Send(gomock.Any()).Times(3)
+		cp.processKernelTrees()
+
+		var header *deviceQueueRead
+		for _, read := range cp.deviceQueueReads {
+			header = read
+		}
+		tree.readIndex = 1
+		respond(header, writeIndex(3))
+		cp.processKernelTrees()
+
+		Expect(tree.polling).To(BeFalse())
+		Expect(tree.readIndex).To(Equal(uint64(3)))
+		Expect(tree.numOutstanding).To(Equal(2))
+		Expect(tree.numPacketReads).To(Equal(2))
+		Expect(cp.deviceQueueReads).To(HaveLen(2))
+
+		addrs := []uint64{}
+		for _, read := range cp.deviceQueueReads {
+			addrs = append(addrs, read.req.Address)
+		}
+		Expect(addrs).To(ConsistOf(uint64(0x2080), uint64(0x2040)))
+	})
+
+	It("should launch the child kernel in the packet", func() {
+		tree := launchParent()
+
+		packet := kernels.HsaKernelDispatchPacket{
+			WorkgroupSizeX: 64,
+			GridSizeX:      256,
+			KernelObject:   0x3000,
+		}
+		buf := bytes.NewBuffer(nil)
+		Expect(binary.Write(buf, binary.LittleEndian, packet)).To(Succeed())
+
+		read := &deviceQueueRead{
+			tree: tree,
+			req:  cp.deviceQueueReadReq(0x2080, protocol.DeviceQueueSlotSize),
+			slot: 1,
+		}
+		cp.deviceQueueReads[read.req.ID] = read
+		tree.numOutstanding = 1
+		tree.numPacketReads = 1
+
+		respond(read, buf.Bytes())
+		cp.enqueueChildKernels(tree)
+
+		child := cp.hwQueues[1].pending[0]
+		Expect(child.req.HsaCo).To(BeIdenticalTo(co))
+		Expect(child.req.Packet.GridSizeX).To(Equal(uint32(256)))
+		Expect(child.req.PacketAddress).To(Equal(uint64(0x1080)))
+		Expect(child.req.QueueID).To(Equal("q0.DeviceQueue"))
+		Expect(child.tree).To(BeIdenticalTo(tree))
+	})
+
+	It("should publish the read index after reading the packets", func() {
+		tree := launchParent()
+		tree.readIndex = 2
+		tree.numPacketReads = 2
+
+		reads := []*deviceQueueRead{}
+		for slot, addr := range queue.SlotPAddrs {
+			read := &deviceQueueRead{
+				tree: tree,
+				req: cp.deviceQueueReadReq(addr,
+					protocol.DeviceQueueSlotSize),
+				slot: slot,
+			}
+			cp.deviceQueueReads[read.req.ID] = read
+			reads = append(reads, read)
+		}
+
+		packet := make([]byte, protocol.DeviceQueueSlotSize)
+		binary.LittleEndian.PutUint64(packet[32:], 0x3000)
+
+		respond(reads[0], packet)
+		Expect(tree.indexWrite).To(BeNil())
+
+		respond(reads[1], packet)
+		Expect(tree.publishing).To(BeTrue())
+		Expect(tree.indexWrite.Address).To(Equal(uint64(0x2008)))
+		Expect(tree.indexWrite.Data).To(Equal(writeIndex(2)))
+
+		write := tree.indexWrite
+		toMem.EXPECT().Send(write)
+		Expect(cp.sendReadIndex(tree)).To(BeTrue())
+		Expect(tree.indexWrite).To(BeNil())
+
+		toMem.EXPECT().RetrieveIncoming().Return(
+			mem.WriteDoneRspBuilder{}.WithRspTo(write.ID).Build())
+		toMem.EXPECT().RetrieveIncoming().Return(nil)
+		Expect(cp.receiveDeviceQueueData()).To(BeTrue())
+		Expect(tree.publishing).To(BeFalse())
+		Expect(cp.deviceQueueWrites).To(BeEmpty())
+	})
+
+	It("should not poll before the read index is published", func() {
+		tree := launchParent()
+		tree.publishing = true
+
+		Expect(cp.pollDeviceQueue(tree)).To(BeFalse())
+		Expect(tree.polling).To(BeFalse())
+	})
+
+	It("should panic if the kernels overwrite unread packets", func() {
+		tree := launchParent()
+		tree.polling = true
+
+		read := &deviceQueueRead{
+			tree:     tree,
+			req:      cp.deviceQueueReadReq(0x2000, 8),
+			isHeader: true,
+		}
+		cp.deviceQueueReads[read.req.ID] = read
+
+		Expect(func() { respond(read, writeIndex(3)) }).To(Panic())
+	})
+
+	It("should launch more children than the queue has slots", func() {
+		const numChildren = 5
+
+		// memory holds the header and the two slots of the queue.
+		memory := make([]byte, 0xc0)
+		inflight := []sim.Msg{}
+
+		toMem.EXPECT().Send(gomock.Any()).
+			DoAndReturn(func(msg sim.Msg) *sim.SendError {
+				switch req := msg.(type) {
+				case *mem.ReadReq:
+					offset := req.Address - 0x2000
+					data := make([]byte, req.AccessByteSize)
+					copy(data, memory[offset:])
+					inflight = append(inflight, mem.DataReadyRspBuilder{}.
+						WithRspTo(req.ID).
+						WithData(data).
+						Build())
+				case *mem.WriteReq:
+					copy(memory[req.Address-0x2000:], req.Data)
+					inflight = append(inflight, mem.WriteDoneRspBuilder{}.
+						WithRspTo(req.ID).
+						Build())
+				}
+
+				return nil
+			}).AnyTimes()
+		toMem.EXPECT().RetrieveIncoming().
+			DoAndReturn(func() sim.Msg {
+				if len(inflight) == 0 {
+					return nil
+				}
+
+				msg := inflight[0]
+				inflight = inflight[1:]
+
+				return msg
+			}).AnyTimes()
+
+		// enqueueChild writes a packet like a kernel does, waiting for a free
+		// slot.
+		numWritten := uint64(0)
+		enqueueChild := func() {
+			readIndex := binary.LittleEndian.Uint64(memory[8:])
+			if numWritten >= numChildren || numWritten-readIndex >= 2 {
+				return
+			}
+
+			slot := 0x40 + (numWritten%2)*protocol.DeviceQueueSlotSize
+			binary.LittleEndian.PutUint32(memory[slot+12:], uint32(numWritten))
+			binary.LittleEndian.PutUint64(memory[slot+32:], 0x3000)
+
+			numWritten++
+			binary.LittleEndian.PutUint64(memory, numWritten)
+		}
+
+		launchParent()
+		for i := 0; i < 200; i++ {
+			enqueueChild()
+			cp.processKernelTrees()
+		}
+
+		gridSizes := []uint32{}
+		for _, k := range cp.hwQueues[1].pending {
+			gridSizes = append(gridSizes, k.req.Packet.GridSizeX)
+		}
+		Expect(gridSizes).To(Equal([]uint32{0, 1, 2, 3, 4}))
+		Expect(binary.LittleEndian.Uint64(memory[8:])).
+			To(Equal(uint64(numChildren)))
+	})
+
+	It("should respond to the driver after the tree drains", func() {
+		tree := launchParent()
+		tree.parentDone = true
+
+		var header *deviceQueueRead
+		toMem.EXPECT().RetrieveIncoming().Return(nil).Times(2)
+		toMem.EXPECT().Send(gomock.Any())
+		cp.processKernelTrees()
+		for _, read := range cp.deviceQueueReads {
+			header = read
+		}
+		Expect(header.afterAllDone).To(BeTrue())
+
+		respond(header, writeIndex(0))
+		Expect(tree.drained).To(BeTrue())
+
+		toDriver.EXPECT().Send(gomock.Any()).
+			Do(func(rsp *protocol.LaunchKernelRsp) {
+				Expect(rsp.RspTo).To(Equal(tree.req.ID))
+				Expect(rsp.Dst).To(Equal(sim.RemotePort("Driver")))
+			})
+
+		cp.processKernelTrees()
+
+		Expect(cp.kernelTrees).To(BeEmpty())
+	})
+
+	It("should not drain while child kernels run", func() {
+		tree := launchParent()
+		tree.parentDone = true
+		tree.numOutstanding = 1
+
+		toMem.EXPECT().RetrieveIncoming().Return(nil)
+		toMem.EXPECT().Send(gomock.Any())
+		cp.processKernelTrees()
+
+		for _, read := range cp.deviceQueueReads {
+			respond(read, writeIndex(0))
+		}
+
+		Expect(tree.drained).To(BeFalse())
+	})
+
+	It("should count the completion of the child kernels", func() {
+		tree := launchParent()
+		tree.numOutstanding = 1
+
+		cp.completeTreeKernel(&hwQueueKernel{
+			req:  protocol.NewLaunchKernelReq(toDriver, toDriver),
+			tree: tree,
+		})
+		Expect(tree.numOutstanding).To(Equal(0))
+		Expect(tree.parentDone).To(BeFalse())
+
+		cp.completeTreeKernel(&hwQueueKernel{req: tree.parentReq, tree: tree})
+		Expect(tree.parentDone).To(BeTrue())
+	})
+})
@@ -17,6 +17,13 @@ type RequestCollection struct {
 	superiorRequest       sim.Msg
 	subordinateRequestIDs []string
 	subordinateCount      int
+
+	engine   *copyEngine
+	byteSize uint64
+
+	// doneAt is the time that the last byte of a device-to-host copy arrives
+	// at the host.
+	doneAt sim.VTimeInSec
 }
 
 // removeIDIfExists reduces the subordinate count if a specific ID is present in
@@ -60,25 +67,83 @@ func NewRequestCollection(
 	return rqC
 }
 
+// A copyEngine is an independent engine of a DMAEngine that processes one
+// memory copy at a time.
+type copyEngine struct {
+	processing  *RequestCollection
+	startTime   sim.VTimeInSec
+	toSendToMem []sim.Msg
+	numInflight int
+	stats       CopyEngineStats
+}
+
+// CopyEngineStats summarizes the memory copies that a copy engine processes.
+type CopyEngineStats struct {
+	// NumCopies is the number of completed memory copies.
+	NumCopies int
+
+	// NumBytes is the number of bytes that the completed memory copies copy.
+	NumBytes uint64
+
+	// BusyTime is the total time that the copy engine processes memory
+	// copies.
+	BusyTime sim.VTimeInSec
+}
+
+// Utilization returns the fraction of the given duration that the copy engine
+// is busy.
+func (s CopyEngineStats) Utilization(duration sim.VTimeInSec) float64 {
+	if duration <= 0 {
+		return 0
+	}
+
+	return float64(s.BusyTime / duration)
+}
+
 // A DMAEngine is responsible for accessing data that does not belongs to
 // the GPU that the DMAEngine works in.
+//
+// The DMAEngine has several copy engines that work independently, so that
+// the memory copies from different queues can overlap. Each copy engine
+// processes one memory copy at a time and keeps a limited number of memory
+// accesses in flight. The copy engines share the host link, which carries the
+// data of the memory copies between the host and the GPU.
 type DMAEngine struct {
 	*sim.TickingComponent
 
 	Log2AccessSize uint64
 
+	// HostLink is the link between the host and the GPU.
+	HostLink *HostLink
+
 	localDataSource mem.AddressToPortMapper
 
 	processingReqs []*RequestCollection
+	finishingReqs  []*RequestCollection
 
 	maxRequestCount uint64
+	numChannels     int
+	copyEngines     []*copyEngine
+	nextCopyEngine  int
+
+	accessEngines   map[string]*copyEngine
+	accessReadyTime map[string]sim.VTimeInSec
 
-	toSendToMem []sim.Msg
 	toSendToCP  []sim.Msg
 	pendingReqs []sim.Msg
 
+	// remoteDataSource locates the RDMA engine that accesses the addresses
+	// outside of the local address range. If it is nil, all the addresses are
+	// local.
+	remoteDataSource mem.AddressToPortMapper
+	localLowAddress  uint64
+	localHighAddress uint64
+
 	ToCP  sim.Port
 	ToMem sim.Port
+
+	// ToRemote accesses the memory of other devices through the RDMA engine.
+	ToRemote sim.Port
 }
 
 // SetLocalDataSource sets the table that maps from addresses to port that can
@@ -87,13 +152,53 @@ func (dma *DMAEngine) SetLocalDataSource(s mem.AddressToPortMapper) {
 	dma.localDataSource = s
 }
 
+// SetRemoteDataSource lets the DMAEngine access the addresses outside of
+// [low, high) through the RDMA engine that the mapper finds.
+func (dma *DMAEngine) SetRemoteDataSource(
+	m mem.AddressToPortMapper,
+	low, high uint64,
+) {
+	dma.remoteDataSource = m
+	dma.localLowAddress = low
+	dma.localHighAddress = high
+}
+
+// SetNumCopyEngines sets the number of memory copies that the DMAEngine can
+// process at the same time.
+func (dma *DMAEngine) SetNumCopyEngines(n int) {
+	dma.maxRequestCount = uint64(n)
+	dma.copyEngines = make([]*copyEngine, n)
+
+	for i := range dma.copyEngines {
+		dma.copyEngines[i] = &copyEngine{}
+	}
+}
+
+// SetNumChannels sets the number of memory accesses that each copy engine can
+// keep in flight. 0 means unlimited.
+func (dma *DMAEngine) SetNumChannels(n int) {
+	dma.numChannels = n
+}
+
+// CopyEngineStats returns the statistics of each copy engine.
+func (dma *DMAEngine) CopyEngineStats() []CopyEngineStats {
+	stats := make([]CopyEngineStats, len(dma.copyEngines))
+	for i, e := range dma.copyEngines {
+		stats[i] = e.stats
+	}
+
+	return stats
+}
+
 // Tick ticks
 func (dma *DMAEngine) Tick() bool {
 	madeProgress := false
 
 	madeProgress = dma.send(dma.ToCP, &dma.toSendToCP) || madeProgress
-	madeProgress = dma.send(dma.ToMem, &dma.toSendToMem) || madeProgress
+	madeProgress = dma.sendToMem() || madeProgress
+	madeProgress = dma.finishCopies() || madeProgress
 	madeProgress = dma.parseFromMem() || madeProgress
+	madeProgress = dma.parseFromRemote() || madeProgress
 	madeProgress = dma.parseFromCP() || madeProgress
 
 	return madeProgress
@@ -117,8 +222,60 @@ func (dma *DMAEngine) send(
 	return false
 }
 
+// sendToMem sends one memory access per cycle, taking turns among the copy
+// engines. An access waits if its data has not arrived from the host or if
+// its copy engine has no free channel.
+func (dma *DMAEngine) sendToMem() bool {
+	now := dma.CurrentTime()
+	waiting := false
+
+	for i := 0; i < len(dma.copyEngines); i++ {
+		engineID := (dma.nextCopyEngine + i) % len(dma.copyEngines)
+		e := dma.copyEngines[engineID]
+		if len(e.toSendToMem) == 0 {
+			continue
+		}
+
+		req := e.toSendToMem[0]
+		if dma.accessReadyTime[req.Meta().ID] > now {
+			waiting = true
+			continue
+		}
+
+		if dma.numChannels > 0 && e.numInflight >= dma.numChannels {
+			continue
+		}
+
+		err := dma.portToSend(req).Send(req)
+		if err != nil {
+			return waiting
+		}
+
+		e.toSendToMem = e.toSendToMem[1:]
+		e.numInflight++
+		delete(dma.accessReadyTime, req.Meta().ID)
+		dma.nextCopyEngine = (engineID + 1) % len(dma.copyEngines)
+
+		return true
+	}
+
+	return waiting
+}
+
 func (dma *DMAEngine) parseFromMem() bool {
-	req := dma.ToMem.RetrieveIncoming()
+	return dma.parseRspFrom(dma.ToMem)
+}
+
+func (dma *DMAEngine) parseFromRemote() bool {
+	if dma.ToRemote == nil {
+		return false
+	}
+
+	return dma.parseRspFrom(dma.ToRemote)
+}
+
+func (dma *DMAEngine) parseRspFrom(port sim.Port) bool {
+	req := port.RetrieveIncoming()
 	if req == nil {
 		return false
 	}
@@ -140,6 +297,7 @@ func (dma *DMAEngine) processDataReadyRsp(
 ) {
 	req := dma.removeReqFromPendingReqList(rsp.RespondTo).(*mem.ReadReq)
 	tracing.TraceReqFinalize(req, dma)
+	dma.releaseChannel(req.ID)
 
 	found := false
 	result := &RequestCollection{}
@@ -154,22 +312,28 @@ func (dma *DMAEngine) processDataReadyRsp(
 		panic("couldn't find requestcollection")
 	}
 
+	if processing, ok := result.getSuperior().(*protocol.MemCopyD2DReq); ok {
+		dma.writeD2DData(processing, result, req, rsp)
+		return
+	}
+
 	processing := result.getSuperior().(*protocol.MemCopyD2HReq)
 
 	offset := req.Address - processing.SrcAddress
 	copy(processing.DstBuffer[offset:], rsp.Data)
 	// fmt.Printf("Dma DataReady %x, %v\n", req.Address, rsp.Data)
 
+	now := dma.CurrentTime()
+	result.doneAt = max(result.doneAt,
+		dma.HostLink.Transfer(DeviceToHost, uint64(len(rsp.Data)), now))
+
 	if result.isFinished() {
-		tracing.TraceReqComplete(processing, dma)
-		dma.removeReqFromProcessingReqList(processing.Meta().ID)
+		if result.doneAt > now {
+			dma.finishingReqs = append(dma.finishingReqs, result)
+			return
+		}
 
-		rsp := sim.GeneralRspBuilder{}.
-			WithDst(processing.Src).
-			WithSrc(processing.Dst).
-			WithOriginalReq(processing).
-			Build()
-		dma.toSendToCP = append(dma.toSendToCP, rsp)
+		dma.completeCopy(result, now)
 	}
 }
 
@@ -178,6 +342,7 @@ func (dma *DMAEngine) processDoneRsp(
 ) {
 	r := dma.removeReqFromPendingReqList(rsp.RespondTo)
 	tracing.TraceReqFinalize(r, dma)
+	dma.releaseChannel(r.Meta().ID)
 
 	found := false
 	result := &RequestCollection{}
@@ -193,17 +358,64 @@ func (dma *DMAEngine) processDoneRsp(
 	}
 
 	if result.isFinished() {
-		processing := result.getSuperior().(*protocol.MemCopyH2DReq)
-		tracing.TraceReqComplete(processing, dma)
-		dma.removeReqFromProcessingReqList(processing.Meta().ID)
-
-		rsp := sim.GeneralRspBuilder{}.
-			WithDst(processing.Src).
-			WithSrc(processing.Dst).
-			WithOriginalReq(processing).
-			Build()
-		dma.toSendToCP = append(dma.toSendToCP, rsp)
+		dma.completeCopy(result, dma.CurrentTime())
+	}
+}
+
+// finishCopies completes the device-to-host copies whose data has arrived at
+// the host.
+func (dma *DMAEngine) finishCopies() bool {
+	if len(dma.finishingReqs) == 0 {
+		return false
+	}
+
+	now := dma.CurrentTime()
+	finishing := dma.finishingReqs[:0]
+	for _, rc := range dma.finishingReqs {
+		if rc.doneAt > now {
+			finishing = append(finishing, rc)
+			continue
+		}
+
+		dma.completeCopy(rc, now)
+	}
+	dma.finishingReqs = finishing
+
+	return true
+}
+
+// completeCopy responds to the memory copy and frees its copy engine.
+func (dma *DMAEngine) completeCopy(
+	rc *RequestCollection,
+	now sim.VTimeInSec,
+) {
+	processing := rc.getSuperior()
+	tracing.TraceReqComplete(processing, dma)
+	dma.removeReqFromProcessingReqList(processing.Meta().ID)
+
+	if e := rc.engine; e != nil {
+		e.processing = nil
+		e.stats.NumCopies++
+		e.stats.NumBytes += rc.byteSize
+		e.stats.BusyTime += now - e.startTime
+	}
+
+	rsp := sim.GeneralRspBuilder{}.
+		WithDst(processing.Meta().Src).
+		WithSrc(processing.Meta().Dst).
+		WithOriginalReq(processing).
+		Build()
+	dma.toSendToCP = append(dma.toSendToCP, rsp)
+}
+
+func (dma *DMAEngine) releaseChannel(id string) {
+	e, ok := dma.accessEngines[id]
+	if !ok {
+		return
 	}
+
+	e.numInflight--
+	delete(dma.accessEngines, id)
 }
 
 func (dma *DMAEngine) removeReqFromPendingReqList(id string) sim.Msg {
@@ -247,6 +459,11 @@ func (dma *DMAEngine) parseFromCP() bool {
 		return false
 	}
 
+	e := dma.idleCopyEngine()
+	if e == nil {
+		return false
+	}
+
 	req := dma.ToCP.RetrieveIncoming()
 	if req == nil {
 		return false
@@ -254,6 +471,9 @@ func (dma *DMAEngine) parseFromCP() bool {
 	tracing.TraceReqReceive(req, dma)
 
 	rqC := NewRequestCollection(req)
+	rqC.engine = e
+	e.processing = rqC
+	e.startTime = dma.CurrentTime()
 
 	dma.processingReqs = append(dma.processingReqs, rqC)
 	switch req := req.(type) {
@@ -261,6 +481,8 @@ func (dma *DMAEngine) parseFromCP() bool {
 		dma.parseMemCopyH2D(req, rqC)
 	case *protocol.MemCopyD2HReq:
 		dma.parseMemCopyD2H(req, rqC)
+	case *protocol.MemCopyD2DReq:
+		dma.parseMemCopyD2D(req, rqC)
 	default:
 		log.Panicf("cannot process request of type %s", reflect.TypeOf(req))
 	}
@@ -268,6 +490,35 @@ func (dma *DMAEngine) parseFromCP() bool {
 	return true
 }
 
+func (dma *DMAEngine) idleCopyEngine() *copyEngine {
+	for _, e := range dma.copyEngines {
+		if e.processing == nil {
+			return e
+		}
+	}
+
+	return nil
+}
+
+// addAccess queues a memory access of a memory copy on the copy engine of the
+// copy. The access cannot be sent before the ready time.
+func (dma *DMAEngine) addAccess(
+	rqC *RequestCollection,
+	req sim.Msg,
+	readyTime sim.VTimeInSec,
+) {
+	e := rqC.engine
+	e.toSendToMem = append(e.toSendToMem, req)
+	dma.accessEngines[req.Meta().ID] = e
+
+	if readyTime > dma.CurrentTime() {
+		dma.accessReadyTime[req.Meta().ID] = readyTime
+	}
+
+	dma.pendingReqs = append(dma.pendingReqs, req)
+	rqC.appendSubordinateID(req.Meta().ID)
+}
+
 func (dma *DMAEngine) parseMemCopyH2D(
 	req *protocol.MemCopyH2DReq,
 	rqC *RequestCollection,
@@ -275,6 +526,8 @@ func (dma *DMAEngine) parseMemCopyH2D(
 	offset := uint64(0)
 	lengthLeft := uint64(len(req.SrcBuffer))
 	addr := req.DstAddress
+	now := dma.CurrentTime()
+	rqC.byteSize = lengthLeft
 
 	for lengthLeft > 0 {
 		addrUnitFirstByte := addr & (^uint64(0) << dma.Log2AccessSize)
@@ -293,9 +546,8 @@ func (dma *DMAEngine) parseMemCopyH2D(
 			WithAddress(addr).
 			WithData(req.SrcBuffer[offset : offset+length]).
 			Build()
-		dma.toSendToMem = append(dma.toSendToMem, reqToBottom)
-		dma.pendingReqs = append(dma.pendingReqs, reqToBottom)
-		rqC.appendSubordinateID(reqToBottom.Meta().ID)
+		dma.addAccess(rqC, reqToBottom,
+			dma.HostLink.Transfer(HostToDevice, length, now))
 
 		tracing.TraceReqInitiate(reqToBottom, dma,
 			tracing.MsgIDAtReceiver(req, dma))
@@ -313,6 +565,7 @@ func (dma *DMAEngine) parseMemCopyD2H(
 	offset := uint64(0)
 	lengthLeft := uint64(len(req.DstBuffer))
 	addr := req.SrcAddress
+	rqC.byteSize = lengthLeft
 
 	for lengthLeft > 0 {
 		addrUnitFirstByte := addr & (^uint64(0) << dma.Log2AccessSize)
@@ -331,9 +584,7 @@ func (dma *DMAEngine) parseMemCopyD2H(
 			WithAddress(addr).
 			WithByteSize(length).
 			Build()
-		dma.toSendToMem = append(dma.toSendToMem, reqToBottom)
-		dma.pendingReqs = append(dma.pendingReqs, reqToBottom)
-		rqC.appendSubordinateID(reqToBottom.Meta().ID)
+		dma.addAccess(rqC, reqToBottom, 0)
 
 		tracing.TraceReqInitiate(reqToBottom, dma,
 			tracing.MsgIDAtReceiver(req, dma))
@@ -357,8 +608,11 @@ func NewDMAEngine(
 
 	dma.Log2AccessSize = 6
 	dma.localDataSource = localDataSource
+	dma.HostLink = NewHostLink("ideal")
+	dma.accessEngines = make(map[string]*copyEngine)
+	dma.accessReadyTime = make(map[string]sim.VTimeInSec)
 
-	dma.maxRequestCount = 4
+	dma.SetNumCopyEngines(4)
 
 	dma.ToCP = sim.NewPort(dma, 40960000, 40960000, name+".ToCP")
 	dma.ToMem = sim.NewPort(dma, 64, 64, name+".ToMem")
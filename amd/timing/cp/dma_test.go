@@ -27,6 +27,7 @@ var _ = Describe("DMAEngine", func() {
 
 		toCP.EXPECT().AsRemote().AnyTimes()
 		toMem.EXPECT().AsRemote().AnyTimes()
+		engine.EXPECT().CurrentTime().Return(sim.VTimeInSec(0)).AnyTimes()
 
 		localModuleFinder = new(mem.SinglePortMapper)
 		dmaEngine = NewDMAEngine("DMA", engine, localModuleFinder)
@@ -52,7 +53,9 @@ var _ = Describe("DMAEngine", func() {
 
 		madeProgress := dmaEngine.parseFromCP()
 
-		Expect(dmaEngine.toSendToMem).To(HaveLen(0))
+		for _, e := range dmaEngine.copyEngines {
+			Expect(e.toSendToMem).To(HaveLen(0))
+		}
 		Expect(madeProgress).To(BeFalse())
 	})
 
@@ -68,12 +71,12 @@ var _ = Describe("DMAEngine", func() {
 		madeProgress := dmaEngine.parseFromCP()
 
 		Expect(dmaEngine.processingReqs[0].superiorRequest).To(BeIdenticalTo(req))
-		Expect(dmaEngine.toSendToMem).To(HaveLen(3))
-		Expect(dmaEngine.toSendToMem[0].(*mem.WriteReq).Address).
+		Expect(dmaEngine.copyEngines[0].toSendToMem).To(HaveLen(3))
+		Expect(dmaEngine.copyEngines[0].toSendToMem[0].(*mem.WriteReq).Address).
 			To(Equal(uint64(20)))
-		Expect(dmaEngine.toSendToMem[1].(*mem.WriteReq).Address).
+		Expect(dmaEngine.copyEngines[0].toSendToMem[1].(*mem.WriteReq).Address).
 			To(Equal(uint64(64)))
-		Expect(dmaEngine.toSendToMem[2].(*mem.WriteReq).Address).
+		Expect(dmaEngine.copyEngines[0].toSendToMem[2].(*mem.WriteReq).Address).
 			To(Equal(uint64(128)))
 		Expect(madeProgress).To(BeTrue())
 		Expect(dmaEngine.pendingReqs).To(HaveLen(3))
@@ -91,12 +94,12 @@ var _ = Describe("DMAEngine", func() {
 		madeProgress := dmaEngine.parseFromCP()
 
 		Expect(dmaEngine.processingReqs[0].superiorRequest).To(BeIdenticalTo(req))
-		Expect(dmaEngine.toSendToMem).To(HaveLen(3))
-		Expect(dmaEngine.toSendToMem[0].(*mem.ReadReq).Address).
+		Expect(dmaEngine.copyEngines[0].toSendToMem).To(HaveLen(3))
+		Expect(dmaEngine.copyEngines[0].toSendToMem[0].(*mem.ReadReq).Address).
 			To(Equal(uint64(20)))
-		Expect(dmaEngine.toSendToMem[1].(*mem.ReadReq).Address).
+		Expect(dmaEngine.copyEngines[0].toSendToMem[1].(*mem.ReadReq).Address).
 			To(Equal(uint64(64)))
-		Expect(dmaEngine.toSendToMem[2].(*mem.ReadReq).Address).
+		Expect(dmaEngine.copyEngines[0].toSendToMem[2].(*mem.ReadReq).Address).
 			To(Equal(uint64(128)))
 		Expect(madeProgress).To(BeTrue())
 		Expect(dmaEngine.pendingReqs).To(HaveLen(3))
@@ -279,4 +282,181 @@ var _ = Describe("DMAEngine", func() {
 		Expect(dmaEngine.toSendToCP[0].(*sim.GeneralRsp).OriginalReq).
 			To(BeIdenticalTo(req))
 	})
+
+	It("should process memory copies on different copy engines", func() {
+		nilPort := NewMockPort(mockCtrl)
+		nilPort.EXPECT().AsRemote().AnyTimes()
+
+		h2d := protocol.NewMemCopyH2DReq(nilPort, toCP, make([]byte, 64), 0)
+		d2h := protocol.NewMemCopyD2HReq(nilPort, toCP, 64, make([]byte, 64))
+		toCP.EXPECT().RetrieveIncoming().Return(h2d)
+		toCP.EXPECT().RetrieveIncoming().Return(d2h)
+
+		dmaEngine.parseFromCP()
+		dmaEngine.parseFromCP()
+
+		Expect(dmaEngine.copyEngines[0].processing.superiorRequest).
+			To(BeIdenticalTo(h2d))
+		Expect(dmaEngine.copyEngines[1].processing.superiorRequest).
+			To(BeIdenticalTo(d2h))
+		Expect(dmaEngine.copyEngines[0].toSendToMem).To(HaveLen(1))
+		Expect(dmaEngine.copyEngines[1].toSendToMem).To(HaveLen(1))
+	})
+
+	It("should take turns among the copy engines to send", func() {
+		nilPort := NewMockPort(mockCtrl)
+		nilPort.EXPECT().AsRemote().AnyTimes()
+
+		h2d := protocol.NewMemCopyH2DReq(nilPort, toCP, make([]byte, 128), 0)
+		d2h := protocol.NewMemCopyD2HReq(nilPort, toCP, 64, make([]byte, 64))
+		toCP.EXPECT().RetrieveIncoming().Return(h2d)
+		toCP.EXPECT().RetrieveIncoming().Return(d2h)
+		dmaEngine.parseFromCP()
+		dmaEngine.parseFromCP()
+
+		write := dmaEngine.copyEngines[0].toSendToMem[0]
+		read := dmaEngine.copyEngines[1].toSendToMem[0]
+		toMem.EXPECT().Send(write).Return(nil)
+		toMem.EXPECT().Send(read).Return(nil)
+
+		Expect(dmaEngine.sendToMem()).To(BeTrue())
+		Expect(dmaEngine.sendToMem()).To(BeTrue())
+		Expect(dmaEngine.copyEngines[0].toSendToMem).To(HaveLen(1))
+		Expect(dmaEngine.copyEngines[1].toSendToMem).To(BeEmpty())
+	})
+
+	It("should wait for the data to arrive from the host link", func() {
+		nilPort := NewMockPort(mockCtrl)
+		nilPort.EXPECT().AsRemote().AnyTimes()
+
+		dmaEngine.HostLink = NewHostLink("pcie3")
+		h2d := protocol.NewMemCopyH2DReq(nilPort, toCP, make([]byte, 64), 0)
+		toCP.EXPECT().RetrieveIncoming().Return(h2d)
+		dmaEngine.parseFromCP()
+
+		madeProgress := dmaEngine.sendToMem()
+
+		Expect(madeProgress).To(BeTrue())
+		Expect(dmaEngine.copyEngines[0].toSendToMem).To(HaveLen(1))
+	})
+
+	It("should limit the in-flight accesses of a copy engine", func() {
+		nilPort := NewMockPort(mockCtrl)
+		nilPort.EXPECT().AsRemote().AnyTimes()
+
+		dmaEngine.SetNumChannels(1)
+		d2h := protocol.NewMemCopyD2HReq(nilPort, toCP, 0, make([]byte, 128))
+		toCP.EXPECT().RetrieveIncoming().Return(d2h)
+		dmaEngine.parseFromCP()
+
+		toMem.EXPECT().Send(gomock.Any()).Return(nil)
+
+		Expect(dmaEngine.sendToMem()).To(BeTrue())
+		Expect(dmaEngine.sendToMem()).To(BeFalse())
+		Expect(dmaEngine.copyEngines[0].toSendToMem).To(HaveLen(1))
+	})
+
+	It("should respond MemCopyD2H after the data arrives at the host", func() {
+		nilPort := NewMockPort(mockCtrl)
+		nilPort.EXPECT().AsRemote().AnyTimes()
+
+		dmaEngine.HostLink = NewHostLink("pcie3")
+		dstBuf := make([]byte, 64)
+		d2h := protocol.NewMemCopyD2HReq(nilPort, toCP, 0, dstBuf)
+		toCP.EXPECT().RetrieveIncoming().Return(d2h)
+		dmaEngine.parseFromCP()
+
+		read := dmaEngine.copyEngines[0].toSendToMem[0]
+		dataReady := mem.DataReadyRspBuilder{}.
+			WithDst(toMem.AsRemote()).
+			WithRspTo(read.Meta().ID).
+			WithData(make([]byte, 64)).
+			Build()
+		toMem.EXPECT().RetrieveIncoming().Return(dataReady)
+
+		dmaEngine.parseFromMem()
+
+		Expect(dmaEngine.toSendToCP).To(BeEmpty())
+		Expect(dmaEngine.finishingReqs).To(HaveLen(1))
+		Expect(dmaEngine.finishCopies()).To(BeTrue())
+		Expect(dmaEngine.toSendToCP).To(BeEmpty())
+	})
+
+	Context("when copying between devices", func() {
+		var (
+			toRemote *MockPort
+			rdma     *MockPort
+		)
+
+		BeforeEach(func() {
+			toRemote = NewMockPort(mockCtrl)
+			rdma = NewMockPort(mockCtrl)
+			toRemote.EXPECT().AsRemote().
+				Return(sim.RemotePort("DMA.ToRemote")).AnyTimes()
+			rdma.EXPECT().AsRemote().
+				Return(sim.RemotePort("RDMA.RDMARequestInside")).AnyTimes()
+
+			dmaEngine.ToRemote = toRemote
+			dmaEngine.SetRemoteDataSource(
+				&mem.SinglePortMapper{Port: rdma.AsRemote()}, 0x1000, 0x2000)
+		})
+
+		It("should read the source data from the remote device", func() {
+			nilPort := NewMockPort(mockCtrl)
+			nilPort.EXPECT().AsRemote().AnyTimes()
+
+			req := protocol.NewMemCopyD2DReq(nilPort, toCP, 0x3020, 0x1000, 96)
+			toCP.EXPECT().RetrieveIncoming().Return(req)
+
+			dmaEngine.parseFromCP()
+
+			toSend := dmaEngine.copyEngines[0].toSendToMem
+			Expect(toSend).To(HaveLen(3))
+			Expect(toSend[0].(*mem.ReadReq).Address).To(Equal(uint64(0x3020)))
+			Expect(toSend[0].(*mem.ReadReq).AccessByteSize).To(Equal(uint64(32)))
+			Expect(toSend[0].Meta().Dst).To(Equal(rdma.AsRemote()))
+			Expect(toSend[1].(*mem.ReadReq).Address).To(Equal(uint64(0x3040)))
+			Expect(toSend[2].(*mem.ReadReq).AccessByteSize).To(Equal(uint64(32)))
+
+			toRemote.EXPECT().Send(toSend[0]).Return(nil)
+
+			Expect(dmaEngine.sendToMem()).To(BeTrue())
+		})
+
+		It("should write the data to the destination when it arrives", func() {
+			nilPort := NewMockPort(mockCtrl)
+			nilPort.EXPECT().AsRemote().AnyTimes()
+
+			req := protocol.NewMemCopyD2DReq(nilPort, toCP, 0x3000, 0x1000, 64)
+			toCP.EXPECT().RetrieveIncoming().Return(req)
+			dmaEngine.parseFromCP()
+
+			read := dmaEngine.copyEngines[0].toSendToMem[0]
+			dataReady := mem.DataReadyRspBuilder{}.
+				WithDst(toRemote.AsRemote()).
+				WithRspTo(read.Meta().ID).
+				WithData(make([]byte, 64)).
+				Build()
+			toRemote.EXPECT().RetrieveIncoming().Return(dataReady)
+
+			dmaEngine.parseFromRemote()
+
+			write := dmaEngine.copyEngines[0].toSendToMem[1].(*mem.WriteReq)
+			Expect(write.Address).To(Equal(uint64(0x1000)))
+			Expect(write.Src).To(Equal(toMem.AsRemote()))
+			Expect(dmaEngine.toSendToCP).To(BeEmpty())
+
+			done := mem.WriteDoneRspBuilder{}.
+				WithDst(toMem.AsRemote()).
+				WithRspTo(write.ID).
+				Build()
+			toMem.EXPECT().RetrieveIncoming().Return(done)
+
+			dmaEngine.parseFromMem()
+
+			Expect(dmaEngine.processingReqs).To(BeEmpty())
+			Expect(dmaEngine.toSendToCP[0].(*sim.GeneralRsp).OriginalReq).
+				To(BeIdenticalTo(req))
+		})
+	})
 })
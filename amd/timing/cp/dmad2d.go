@@ -0,0 +1,96 @@
+package cp
+
+import (
+	"github.com/sarchlab/akita/v4/mem/mem"
+	"github.com/sarchlab/akita/v4/sim"
+	"github.com/sarchlab/akita/v4/tracing"
+	"github.com/sarchlab/mgpusim/v4/amd/protocol"
+)
+
+// isRemote checks if an address is in the memory of another device.
+func (dma *DMAEngine) isRemote(addr uint64) bool {
+	if dma.remoteDataSource == nil {
+		return false
+	}
+
+	return addr < dma.localLowAddress || addr >= dma.localHighAddress
+}
+
+// accessTarget returns the port that the DMAEngine accesses an address
+// through and the module that serves the access.
+func (dma *DMAEngine) accessTarget(addr uint64) (sim.Port, sim.RemotePort) {
+	if dma.isRemote(addr) {
+		return dma.ToRemote, dma.remoteDataSource.Find(addr)
+	}
+
+	return dma.ToMem, dma.localDataSource.Find(addr)
+}
+
+func (dma *DMAEngine) portToSend(req sim.Msg) sim.Port {
+	if dma.ToRemote != nil && req.Meta().Src == dma.ToRemote.AsRemote() {
+		return dma.ToRemote
+	}
+
+	return dma.ToMem
+}
+
+// bytesLeftInUnit returns the number of bytes from the address to the end of
+// the access unit that contains the address.
+func (dma *DMAEngine) bytesLeftInUnit(addr uint64) uint64 {
+	unitFirstByte := addr & (^uint64(0) << dma.Log2AccessSize)
+
+	return (1 << dma.Log2AccessSize) - (addr - unitFirstByte)
+}
+
+// parseMemCopyD2D reads the source data. Each piece of data is written to the
+// destination when it arrives, so that neither side of the copy is accessed
+// across the boundary of an access unit.
+func (dma *DMAEngine) parseMemCopyD2D(
+	req *protocol.MemCopyD2DReq,
+	rqC *RequestCollection,
+) {
+	rqC.byteSize = req.ByteSize
+
+	offset := uint64(0)
+	for offset < req.ByteSize {
+		src := req.SrcAddress + offset
+		dst := req.DstAddress + offset
+		length := min(req.ByteSize-offset,
+			dma.bytesLeftInUnit(src), dma.bytesLeftInUnit(dst))
+
+		port, module := dma.accessTarget(src)
+		reqToBottom := mem.ReadReqBuilder{}.
+			WithSrc(port.AsRemote()).
+			WithDst(module).
+			WithAddress(src).
+			WithByteSize(length).
+			Build()
+		dma.addAccess(rqC, reqToBottom, 0)
+
+		tracing.TraceReqInitiate(reqToBottom, dma,
+			tracing.MsgIDAtReceiver(req, dma))
+
+		offset += length
+	}
+}
+
+func (dma *DMAEngine) writeD2DData(
+	processing *protocol.MemCopyD2DReq,
+	rqC *RequestCollection,
+	read *mem.ReadReq,
+	rsp *mem.DataReadyRsp,
+) {
+	addr := processing.DstAddress + (read.Address - processing.SrcAddress)
+
+	port, module := dma.accessTarget(addr)
+	reqToBottom := mem.WriteReqBuilder{}.
+		WithSrc(port.AsRemote()).
+		WithDst(module).
+		WithAddress(addr).
+		WithData(rsp.Data).
+		Build()
+	dma.addAccess(rqC, reqToBottom, 0)
+
+	tracing.TraceReqInitiate(reqToBottom, dma,
+		tracing.MsgIDAtReceiver(processing, dma))
+}
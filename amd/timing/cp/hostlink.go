@@ -0,0 +1,81 @@
+package cp
+
+import (
+	"github.com/sarchlab/akita/v4/sim"
+)
+
+// A HostLinkDirection is the direction that data travels on the host link.
+type HostLinkDirection int
+
+// The directions of the host link.
+const (
+	HostToDevice HostLinkDirection = iota
+	DeviceToHost
+)
+
+// A HostLink models the link between the host and the GPU, which the copy
+// engines of a DMA engine share. The two directions of the link transfer data
+// independently, and each direction transfers one block of data at a time.
+type HostLink struct {
+	// Bandwidth is the number of bytes that each direction of the link
+	// transfers per second. A bandwidth of 0 transfers data instantly.
+	Bandwidth float64
+
+	// Latency is the time that data takes to travel across the link.
+	Latency sim.VTimeInSec
+
+	busyUntil [2]sim.VTimeInSec
+	busyTime  [2]sim.VTimeInSec
+	numBytes  [2]uint64
+}
+
+// NewHostLink creates a host link of a PCIe generation with 16 lanes. The
+// preset can be "ideal", "pcie3", "pcie4", or "pcie5". The ideal link
+// transfers data instantly.
+func NewHostLink(preset string) *HostLink {
+	switch preset {
+	case "ideal":
+		return &HostLink{}
+	case "pcie3":
+		return &HostLink{Bandwidth: 15.75e9, Latency: 1e-6}
+	case "pcie4":
+		return &HostLink{Bandwidth: 31.5e9, Latency: 1e-6}
+	case "pcie5":
+		return &HostLink{Bandwidth: 63e9, Latency: 1e-6}
+	default:
+		panic("unknown host link preset " + preset)
+	}
+}
+
+// Transfer reserves the link to transfer a block of data and returns the time
+// that the data arrives at the other side of the link.
+func (l *HostLink) Transfer(
+	dir HostLinkDirection,
+	byteSize uint64,
+	now sim.VTimeInSec,
+) sim.VTimeInSec {
+	start := max(now, l.busyUntil[dir])
+
+	duration := sim.VTimeInSec(0)
+	if l.Bandwidth > 0 {
+		duration = sim.VTimeInSec(float64(byteSize) / l.Bandwidth)
+	}
+
+	l.busyUntil[dir] = start + duration
+	l.busyTime[dir] += duration
+	l.numBytes[dir] += byteSize
+
+	return start + duration + l.Latency
+}
+
+// BusyTime returns the total time that a direction of the link transfers
+// data.
+func (l *HostLink) BusyTime(dir HostLinkDirection) sim.VTimeInSec {
+	return l.busyTime[dir]
+}
+
+// NumBytes returns the number of bytes that a direction of the link has
+// transferred.
+func (l *HostLink) NumBytes(dir HostLinkDirection) uint64 {
+	return l.numBytes[dir]
+}
@@ -0,0 +1,42 @@
+package cp
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sarchlab/akita/v4/sim"
+)
+
+var _ = Describe("HostLink", func() {
+	It("should transfer data instantly on the ideal link", func() {
+		link := NewHostLink("ideal")
+
+		Expect(link.Transfer(HostToDevice, 64, 1)).To(Equal(sim.VTimeInSec(1)))
+		Expect(link.NumBytes(HostToDevice)).To(Equal(uint64(64)))
+	})
+
+	It("should serialize the transfers in the same direction", func() {
+		link := &HostLink{Bandwidth: 1e9, Latency: 1e-6}
+
+		Expect(link.Transfer(HostToDevice, 1000, 0)).
+			To(BeNumerically("~", 2e-6, 1e-12))
+		Expect(link.Transfer(HostToDevice, 1000, 0)).
+			To(BeNumerically("~", 3e-6, 1e-12))
+		Expect(link.BusyTime(HostToDevice)).
+			To(BeNumerically("~", 2e-6, 1e-12))
+	})
+
+	It("should transfer the two directions independently", func() {
+		link := &HostLink{Bandwidth: 1e9}
+
+		link.Transfer(HostToDevice, 1000, 0)
+
+		Expect(link.Transfer(DeviceToHost, 1000, 0)).
+			To(BeNumerically("~", 1e-6, 1e-12))
+		Expect(link.BusyTime(DeviceToHost)).
+			To(BeNumerically("~", 1e-6, 1e-12))
+	})
+
+	It("should panic on unknown presets", func() {
+		Expect(func() { NewHostLink("pcie9") }).To(Panic())
+	})
+})
@@ -0,0 +1,640 @@
+package cp
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/sarchlab/akita/v4/sim"
+	"github.com/sarchlab/mgpusim/v4/amd/protocol"
+	"github.com/sarchlab/mgpusim/v4/amd/sampling"
+	"github.com/sarchlab/mgpusim/v4/amd/timing/cp/internal/dispatching"
+	"github.com/sarchlab/mgpusim/v4/amd/timing/rdma"
+)
+
+// A hwQueue is a hardware queue descriptor (HQD). A command queue in the
+// driver is mapped to a hardware queue when it launches a kernel, and is
+// unmapped when all its kernels complete.
+type hwQueue struct {
+	slot     int
+	queueID  string
+	priority int
+	pending  []*hwQueueKernel
+	running  []*hwQueueKernel
+	stats    *HWQueueStats
+}
+
+func (q *hwQueue) isIdle() bool {
+	return len(q.pending) == 0 && len(q.running) == 0
+}
+
+// A hwQueueKernel is a kernel that waits in or runs from a hardware queue.
+type hwQueueKernel struct {
+	req        *protocol.LaunchKernelReq
+	queue      *hwQueue
+	seq        uint64
+	arrival    sim.VTimeInSec
+	dispatcher dispatching.Dispatcher
+
+	// cuMask is the CU mask of the kernel. Nil allows all the CUs.
+	cuMask []bool
+
+	// tree is the kernel tree that the kernel belongs to. It is nil if the
+	// kernel does not use a device queue.
+	tree *kernelTree
+
+	// invalidation asks the RDMA engine to drop its remote-data cache before
+	// the kernel starts dispatching. It is nil if the kernel does not wait
+	// for the RDMA engine.
+	invalidation     *rdma.InvalidateCacheReq
+	invalidationSent bool
+}
+
+// HWQueueStats are the statistics of the kernels that a command queue
+// launches on a GPU.
+type HWQueueStats struct {
+	QueueID  string
+	Priority int
+
+	// NumKernels is the number of completed kernels.
+	NumKernels int
+
+	// TotalLatency is the sum of the time from the arrival of each kernel at
+	// the command processor to its completion.
+	TotalLatency sim.VTimeInSec
+
+	FirstArrival   sim.VTimeInSec
+	LastCompletion sim.VTimeInSec
+}
+
+// AverageLatency returns the average time from the arrival of a kernel to its
+// completion.
+func (s HWQueueStats) AverageLatency() sim.VTimeInSec {
+	if s.NumKernels == 0 {
+		return 0
+	}
+
+	return s.TotalLatency / sim.VTimeInSec(s.NumKernels)
+}
+
+// Throughput returns the number of kernels that complete per second, from the
+// arrival of the first kernel to the completion of the last kernel.
+func (s HWQueueStats) Throughput() float64 {
+	duration := float64(s.LastCompletion - s.FirstArrival)
+	if s.NumKernels == 0 || duration <= 0 {
+		return 0
+	}
+
+	return float64(s.NumKernels) / duration
+}
+
+// HWQueueStats returns the statistics of the command queues that have
+// launched kernels on the GPU, in the order of their first kernel.
+func (p *CommandProcessor) HWQueueStats() []HWQueueStats {
+	stats := make([]HWQueueStats, 0, len(p.hwQueueStats))
+	for _, s := range p.hwQueueStats {
+		stats = append(stats, *s)
+	}
+
+	return stats
+}
+
+// CUMaskStats are the statistics of the kernels that run with the same CU
+// mask.
+type CUMaskStats struct {
+	// Mask is the CU mask in hexadecimal, with the word of the highest CUs
+	// first, or "all" if the kernels can use all the CUs.
+	Mask string
+
+	// NumCUsInMask is the number of CUs that the mask allows.
+	NumCUsInMask int
+
+	// NumKernels is the number of completed kernels.
+	NumKernels int
+
+	// NumWGs is the number of work-groups that the kernels dispatch.
+	NumWGs int
+
+	// WGsPerCU is the number of work-groups dispatched to each CU.
+	WGsPerCU []int
+}
+
+// NumCUsUsed returns the number of CUs that receive at least one work-group.
+func (s CUMaskStats) NumCUsUsed() int {
+	n := 0
+	for _, numWG := range s.WGsPerCU {
+		if numWG > 0 {
+			n++
+		}
+	}
+
+	return n
+}
+
+// Occupancy returns the fraction of the CUs in the mask that receive at least
+// one work-group.
+func (s CUMaskStats) Occupancy() float64 {
+	if s.NumCUsInMask == 0 {
+		return 0
+	}
+
+	return float64(s.NumCUsUsed()) / float64(s.NumCUsInMask)
+}
+
+// CUMaskStats returns the statistics of each CU mask that the completed
+// kernels use, in the order that the masks are first used.
+func (p *CommandProcessor) CUMaskStats() []CUMaskStats {
+	stats := make([]CUMaskStats, 0, len(p.cuMaskStats))
+	for _, s := range p.cuMaskStats {
+		c := *s
+		c.WGsPerCU = append([]int(nil), s.WGsPerCU...)
+		stats = append(stats, c)
+	}
+
+	return stats
+}
+
+func (p *CommandProcessor) findOrCreateCUMaskStats(
+	req *protocol.LaunchKernelReq,
+) *CUMaskStats {
+	mask := cuMaskString(req.CUMask)
+	for _, s := range p.cuMaskStats {
+		if s.Mask == mask {
+			return s
+		}
+	}
+
+	s := &CUMaskStats{
+		Mask:         mask,
+		NumCUsInMask: len(p.CUs),
+		WGsPerCU:     make([]int, len(p.CUs)),
+	}
+
+	if cuMask := decodeCUMask(req.CUMask, len(p.CUs)); cuMask != nil {
+		s.NumCUsInMask = 0
+		for _, allowed := range cuMask {
+			if allowed {
+				s.NumCUsInMask++
+			}
+		}
+	}
+
+	p.cuMaskStats = append(p.cuMaskStats, s)
+
+	return s
+}
+
+// decodeCUMask converts the CU mask words of a kernel into one flag per CU.
+// Bit i%32 of word i/32 allows CU i. A nil mask allows all the CUs. The driver
+// rejects the masks that allow none of the CUs, so such a mask is a bug.
+func decodeCUMask(words []uint32, numCU int) []bool {
+	if words == nil {
+		return nil
+	}
+
+	mask := make([]bool, numCU)
+	empty := true
+	for i := range mask {
+		word := i / 32
+		if word < len(words) {
+			mask[i] = words[word]&(1<<uint(i%32)) != 0
+		}
+		empty = empty && !mask[i]
+	}
+
+	if empty {
+		log.Panicf("CU mask %s allows none of the %d CUs",
+			cuMaskString(words), numCU)
+	}
+
+	return mask
+}
+
+func cuMaskString(words []uint32) string {
+	if words == nil {
+		return "all"
+	}
+
+	var b strings.Builder
+	b.WriteString("0x")
+	for i := len(words) - 1; i >= 0; i-- {
+		fmt.Fprintf(&b, "%08x", words[i])
+	}
+
+	return b.String()
+}
+
+// combineCUMasks returns the CUs that both masks allow. A nil mask allows all
+// the CUs. The kernel mask wins if the two masks do not share any CU, so that
+// the kernel can always make progress.
+func combineCUMasks(kernelMask, policyMask []bool) []bool {
+	if kernelMask == nil {
+		return policyMask
+	}
+
+	if policyMask == nil {
+		return kernelMask
+	}
+
+	mask := make([]bool, len(kernelMask))
+	empty := true
+	for i := range mask {
+		mask[i] = kernelMask[i] && i < len(policyMask) && policyMask[i]
+		empty = empty && !mask[i]
+	}
+
+	if empty {
+		return kernelMask
+	}
+
+	return mask
+}
+
+// enqueueKernel puts a kernel into the hardware queue of its command queue.
+// It returns false if the command queue is not mapped and all the hardware
+// queues are in use.
+func (p *CommandProcessor) enqueueKernel(req *protocol.LaunchKernelReq) bool {
+	if req.DeviceQueue != nil {
+		return p.enqueueParentKernel(req)
+	}
+
+	return p.enqueueKernelOfTree(req, nil)
+}
+
+func (p *CommandProcessor) enqueueKernelOfTree(
+	req *protocol.LaunchKernelReq,
+	tree *kernelTree,
+) bool {
+	q := p.findHWQueue(req.QueueID)
+	if q == nil {
+		q = p.mapHWQueue(req)
+		if q == nil {
+			return false
+		}
+	}
+
+	q.pending = append(q.pending, &hwQueueKernel{
+		req:     req,
+		queue:   q,
+		seq:     p.nextKernelSeq,
+		arrival: p.Engine.CurrentTime(),
+		cuMask:  decodeCUMask(req.CUMask, len(p.CUs)),
+		tree:    tree,
+	})
+	p.nextKernelSeq++
+
+	return true
+}
+
+func (p *CommandProcessor) findHWQueue(queueID string) *hwQueue {
+	for _, q := range p.hwQueues {
+		if q != nil && q.queueID == queueID {
+			return q
+		}
+	}
+
+	return nil
+}
+
+func (p *CommandProcessor) mapHWQueue(req *protocol.LaunchKernelReq) *hwQueue {
+	for slot, q := range p.hwQueues {
+		if q != nil {
+			continue
+		}
+
+		q = &hwQueue{
+			slot:     slot,
+			queueID:  req.QueueID,
+			priority: req.Priority,
+			stats:    p.findOrCreateHWQueueStats(req),
+		}
+		p.hwQueues[slot] = q
+
+		return q
+	}
+
+	return nil
+}
+
+func (p *CommandProcessor) findOrCreateHWQueueStats(
+	req *protocol.LaunchKernelReq,
+) *HWQueueStats {
+	for _, s := range p.hwQueueStats {
+		if s.QueueID == req.QueueID {
+			return s
+		}
+	}
+
+	s := &HWQueueStats{
+		QueueID:      req.QueueID,
+		Priority:     req.Priority,
+		FirstArrival: p.Engine.CurrentTime(),
+	}
+	p.hwQueueStats = append(p.hwQueueStats, s)
+
+	return s
+}
+
+// scheduleKernels starts the pending kernels on the idle dispatchers, in the
+// order that the scheduling policy decides.
+func (p *CommandProcessor) scheduleKernels() bool {
+	madeProgress := false
+
+	for {
+		k := p.nextKernelToStart()
+		if k == nil {
+			break
+		}
+
+		d := p.findAvailableDispatcher()
+		if d == nil {
+			break
+		}
+
+		p.startKernel(k, d)
+		madeProgress = true
+	}
+
+	if madeProgress {
+		p.updateCUMasks()
+	}
+
+	return madeProgress
+}
+
+func (p *CommandProcessor) findAvailableDispatcher() dispatching.Dispatcher {
+	for _, d := range p.Dispatchers {
+		if !d.IsDispatching() && !p.isReservedForInvalidation(d) {
+			return d
+		}
+	}
+
+	return nil
+}
+
+// isReservedForInvalidation tells whether a kernel waits for the RDMA engine
+// before it starts on the dispatcher.
+func (p *CommandProcessor) isReservedForInvalidation(
+	d dispatching.Dispatcher,
+) bool {
+	for _, k := range p.invalidatingKernels {
+		if k.dispatcher == d {
+			return true
+		}
+	}
+
+	return false
+}
+
+// nextKernelToStart picks the kernel at the head of a hardware queue. The
+// priority policy picks the queue with the highest priority. The other
+// policies pick the kernel that arrives first.
+func (p *CommandProcessor) nextKernelToStart() *hwQueueKernel {
+	var next *hwQueueKernel
+
+	for _, q := range p.hwQueues {
+		if q == nil || len(q.pending) == 0 {
+			continue
+		}
+
+		k := q.pending[0]
+		if next == nil || p.startsBefore(k, next) {
+			next = k
+		}
+	}
+
+	return next
+}
+
+func (p *CommandProcessor) startsBefore(a, b *hwQueueKernel) bool {
+	if p.schedulingPolicy == "priority" &&
+		a.queue.priority != b.queue.priority {
+		return a.queue.priority > b.queue.priority
+	}
+
+	return a.seq < b.seq
+}
+
+func (p *CommandProcessor) startKernel(
+	k *hwQueueKernel,
+	d dispatching.Dispatcher,
+) {
+	q := k.queue
+	q.pending = q.pending[1:]
+	q.running = append(q.running, k)
+	k.dispatcher = d
+
+	if *sampling.SampledRunnerFlag {
+		sampling.SampledEngineInstance.Reset()
+	}
+
+	if p.invalidateRemoteCache {
+		p.invalidateRDMACache(k)
+		return
+	}
+
+	p.dispatchKernel(k)
+}
+
+func (p *CommandProcessor) dispatchKernel(k *hwQueueKernel) {
+	var policyMask []bool
+	if p.schedulingPolicy == "spatial" {
+		policyMask = cuRangeMask(len(p.CUs), k.queue.slot, len(p.hwQueues))
+	}
+
+	k.dispatcher.SetCUMask(combineCUMasks(k.cuMask, policyMask))
+	k.dispatcher.StartDispatching(k.req)
+}
+
+// invalidateRDMACache asks the RDMA engine to drop the data that it has cached
+// from the other GPUs, as the other GPUs may have written the data in the
+// earlier kernels. The kernel starts dispatching after the RDMA engine
+// acknowledges the request.
+func (p *CommandProcessor) invalidateRDMACache(k *hwQueueKernel) {
+	k.invalidation = rdma.InvalidateCacheReqBuilder{}.
+		WithSrc(p.ToRDMA.AsRemote()).
+		WithDst(p.RDMA.AsRemote()).
+		Build()
+	p.invalidatingKernels = append(p.invalidatingKernels, k)
+
+	p.sendRDMACacheInvalidations()
+}
+
+// sendRDMACacheInvalidations sends the invalidation requests that have not
+// been sent, in order. The requests that cannot be sent are retried in the
+// next cycle.
+func (p *CommandProcessor) sendRDMACacheInvalidations() bool {
+	madeProgress := false
+
+	for _, k := range p.invalidatingKernels {
+		if k.invalidationSent {
+			continue
+		}
+
+		err := p.ToRDMA.Send(k.invalidation)
+		if err != nil {
+			return madeProgress
+		}
+
+		k.invalidationSent = true
+		madeProgress = true
+	}
+
+	return madeProgress
+}
+
+// completeRDMACacheInvalidation starts the kernel that has been waiting for
+// the RDMA engine to drop its remote-data cache.
+func (p *CommandProcessor) completeRDMACacheInvalidation(
+	rsp *rdma.InvalidateCacheRsp,
+) {
+	for i, k := range p.invalidatingKernels {
+		if k.invalidation.ID != rsp.RespondTo {
+			continue
+		}
+
+		p.invalidatingKernels = append(
+			p.invalidatingKernels[:i], p.invalidatingKernels[i+1:]...)
+		k.invalidation = nil
+
+		p.dispatchKernel(k)
+		p.updateCUMasks()
+
+		return
+	}
+
+	log.Panicf("RDMA cache invalidation %s is not expected", rsp.RespondTo)
+}
+
+// collectCompletedKernels finds the kernels whose dispatchers have completed
+// them and unmaps the hardware queues that become idle.
+func (p *CommandProcessor) collectCompletedKernels() bool {
+	madeProgress := false
+
+	for slot, q := range p.hwQueues {
+		if q == nil {
+			continue
+		}
+
+		running := q.running[:0]
+		for _, k := range q.running {
+			if k.invalidation != nil ||
+				k.dispatcher.DispatchingKernelID() == k.req.ID {
+				running = append(running, k)
+				continue
+			}
+
+			p.completeHWQueueKernel(k)
+			madeProgress = true
+		}
+		q.running = running
+
+		if q.isIdle() {
+			p.hwQueues[slot] = nil
+		}
+	}
+
+	if madeProgress {
+		p.updateCUMasks()
+	}
+
+	return madeProgress
+}
+
+func (p *CommandProcessor) completeHWQueueKernel(k *hwQueueKernel) {
+	now := p.Engine.CurrentTime()
+	stats := k.queue.stats
+
+	stats.NumKernels++
+	stats.TotalLatency += now - k.arrival
+	stats.LastCompletion = now
+
+	p.completeTreeKernel(k)
+
+	maskStats := p.findOrCreateCUMaskStats(k.req)
+	maskStats.NumKernels++
+	for cuID, numWG := range k.dispatcher.NumWGsPerCU() {
+		for len(maskStats.WGsPerCU) <= cuID {
+			maskStats.WGsPerCU = append(maskStats.WGsPerCU, 0)
+		}
+
+		maskStats.WGsPerCU[cuID] += numWG
+		maskStats.NumWGs += numWG
+	}
+}
+
+// updateCUMasks splits the CUs evenly among the hardware queues that are
+// running kernels under the fair-share policy. The share of a queue is further
+// limited by the CU mask of each kernel.
+func (p *CommandProcessor) updateCUMasks() {
+	if p.schedulingPolicy != "fair-share" {
+		return
+	}
+
+	active := make([]*hwQueue, 0, len(p.hwQueues))
+	for _, q := range p.hwQueues {
+		if q != nil && len(q.running) > 0 {
+			active = append(active, q)
+		}
+	}
+
+	for i, q := range active {
+		mask := cuRangeMask(len(p.CUs), i, len(active))
+		for _, k := range q.running {
+			k.dispatcher.SetCUMask(combineCUMasks(k.cuMask, mask))
+		}
+	}
+}
+
+// cuRangeMask returns a mask that allows the index-th of the numShares
+// contiguous ranges of CUs. If there are fewer CUs than shares, the shares
+// take turns to use the CUs.
+func cuRangeMask(numCU, index, numShares int) []bool {
+	mask := make([]bool, numCU)
+	if numCU == 0 {
+		return mask
+	}
+
+	start := index * numCU / numShares
+	end := (index + 1) * numCU / numShares
+
+	if start == end {
+		mask[index%numCU] = true
+		return mask
+	}
+
+	for i := start; i < end; i++ {
+		mask[i] = true
+	}
+
+	return mask
+}
+
+// dispatchersInTickOrder returns the dispatchers in the order that they
+// reserve CU resources. Under the priority policy, the dispatchers of the
+// kernels with higher priorities go first.
+func (p *CommandProcessor) dispatchersInTickOrder() []dispatching.Dispatcher {
+	if p.schedulingPolicy != "priority" {
+		return p.Dispatchers
+	}
+
+	priorities := make(map[dispatching.Dispatcher]int)
+	for _, q := range p.hwQueues {
+		if q == nil {
+			continue
+		}
+
+		for _, k := range q.running {
+			priorities[k.dispatcher] = q.priority
+		}
+	}
+
+	dispatchers := make([]dispatching.Dispatcher, len(p.Dispatchers))
+	copy(dispatchers, p.Dispatchers)
+	sort.SliceStable(dispatchers, func(i, j int) bool {
+		return priorities[dispatchers[i]] > priorities[dispatchers[j]]
+	})
+
+	return dispatchers
+}
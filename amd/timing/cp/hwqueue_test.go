@@ -0,0 +1,347 @@
+package cp
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sarchlab/akita/v4/sim"
+	"github.com/sarchlab/mgpusim/v4/amd/protocol"
+	"github.com/sarchlab/mgpusim/v4/amd/timing/cp/internal/dispatching"
+	"github.com/sarchlab/mgpusim/v4/amd/timing/rdma"
+	"go.uber.org/mock/gomock"
+)
+
+var _ = Describe("Hardware Queue Scheduling", func() {
+	var (
+		mockCtrl    *gomock.Controller
+		engine      *MockEngine
+		dispatcher0 *MockDispatcher
+		dispatcher1 *MockDispatcher
+		port        *MockPort
+		cp          *CommandProcessor
+	)
+
+	buildCP := func(policy string, numHWQueues int) {
+		cp = MakeBuilder().
+			WithEngine(engine).
+			WithFreq(1).
+			WithNumHWQueues(numHWQueues).
+			WithSchedulingPolicy(policy).
+			Build("CP")
+		cp.Dispatchers = []dispatching.Dispatcher{dispatcher0, dispatcher1}
+		cp.CUs = []sim.RemotePort{"CU0", "CU1", "CU2", "CU3"}
+	}
+
+	launch := func(queueID string, priority int) *protocol.LaunchKernelReq {
+		req := protocol.NewLaunchKernelReq(port, port)
+		req.QueueID = queueID
+		req.Priority = priority
+
+		Expect(cp.enqueueKernel(req)).To(BeTrue())
+
+		return req
+	}
+
+	BeforeEach(func() {
+		mockCtrl = gomock.NewController(GinkgoT())
+		engine = NewMockEngine(mockCtrl)
+		dispatcher0 = NewMockDispatcher(mockCtrl)
+		dispatcher1 = NewMockDispatcher(mockCtrl)
+		port = NewMockPort(mockCtrl)
+		port.EXPECT().AsRemote().AnyTimes()
+
+		engine.EXPECT().CurrentTime().Return(sim.VTimeInSec(1)).AnyTimes()
+	})
+
+	AfterEach(func() {
+		mockCtrl.Finish()
+	})
+
+	It("should panic if the policy is unknown", func() {
+		Expect(func() {
+			MakeBuilder().WithSchedulingPolicy("unknown")
+		}).To(Panic())
+	})
+
+	It("should wait if all the hardware queues are in use", func() {
+		buildCP("fifo", 1)
+		launch("q0", 0)
+
+		req := protocol.NewLaunchKernelReq(port, port)
+		req.QueueID = "q1"
+
+		Expect(cp.enqueueKernel(req)).To(BeFalse())
+	})
+
+	It("should start the kernel that arrives first", func() {
+		buildCP("fifo", 2)
+		req0 := launch("q0", 0)
+		launch("q1", 2)
+
+		dispatcher0.EXPECT().IsDispatching().Return(false)
+		dispatcher0.EXPECT().SetCUMask(nil)
+		dispatcher0.EXPECT().StartDispatching(req0)
+		dispatcher0.EXPECT().IsDispatching().Return(true)
+		dispatcher1.EXPECT().IsDispatching().Return(true)
+
+		madeProgress := cp.scheduleKernels()
+
+		Expect(madeProgress).To(BeTrue())
+		Expect(cp.hwQueues[0].running).To(HaveLen(1))
+		Expect(cp.hwQueues[1].pending).To(HaveLen(1))
+	})
+
+	Context("with remote-data cache invalidation", func() {
+		var (
+			toRDMA       *MockPort
+			invalidation *rdma.InvalidateCacheReq
+		)
+
+		BeforeEach(func() {
+			cp = MakeBuilder().
+				WithEngine(engine).
+				WithFreq(1).
+				WithNumHWQueues(2).
+				WithRemoteCacheInvalidation().
+				Build("CP")
+			cp.Dispatchers = []dispatching.Dispatcher{dispatcher0}
+			cp.CUs = []sim.RemotePort{"CU0", "CU1", "CU2", "CU3"}
+			toRDMA = NewMockPort(mockCtrl)
+			toRDMA.EXPECT().AsRemote().AnyTimes()
+			cp.ToRDMA = toRDMA
+			cp.RDMA = port
+		})
+
+		acknowledge := func() {
+			rsp := rdma.InvalidateCacheRspBuilder{}.
+				WithRspTo(invalidation.ID).
+				Build()
+			cp.completeRDMACacheInvalidation(rsp)
+		}
+
+		It("should invalidate the remote-data cache before starting a kernel",
+			func() {
+				req0 := launch("q0", 0)
+
+				dispatcher0.EXPECT().IsDispatching().Return(false)
+				toRDMA.EXPECT().
+					Send(gomock.AssignableToTypeOf(&rdma.InvalidateCacheReq{})).
+					DoAndReturn(func(msg sim.Msg) *sim.SendError {
+						invalidation = msg.(*rdma.InvalidateCacheReq)
+						return nil
+					})
+
+				Expect(cp.scheduleKernels()).To(BeTrue())
+
+				dispatcher0.EXPECT().SetCUMask(nil)
+				dispatcher0.EXPECT().StartDispatching(req0)
+
+				acknowledge()
+
+				Expect(cp.invalidatingKernels).To(BeEmpty())
+			})
+
+		It("should retry the invalidation if it cannot be sent", func() {
+			req0 := launch("q0", 0)
+
+			dispatcher0.EXPECT().IsDispatching().Return(false)
+			toRDMA.EXPECT().
+				Send(gomock.AssignableToTypeOf(&rdma.InvalidateCacheReq{})).
+				Return(sim.NewSendError())
+
+			Expect(cp.scheduleKernels()).To(BeTrue())
+
+			toRDMA.EXPECT().
+				Send(gomock.AssignableToTypeOf(&rdma.InvalidateCacheReq{})).
+				DoAndReturn(func(msg sim.Msg) *sim.SendError {
+					invalidation = msg.(*rdma.InvalidateCacheReq)
+					return nil
+				})
+
+			Expect(cp.sendRDMACacheInvalidations()).To(BeTrue())
+			Expect(cp.sendRDMACacheInvalidations()).To(BeFalse())
+
+			dispatcher0.EXPECT().SetCUMask(nil)
+			dispatcher0.EXPECT().StartDispatching(req0)
+
+			acknowledge()
+		})
+
+		It("should keep the dispatcher for the kernel that waits for the "+
+			"RDMA engine", func() {
+			launch("q0", 0)
+			launch("q1", 0)
+
+			dispatcher0.EXPECT().IsDispatching().Return(false).Times(2)
+			toRDMA.EXPECT().
+				Send(gomock.AssignableToTypeOf(&rdma.InvalidateCacheReq{})).
+				Return(nil)
+
+			Expect(cp.scheduleKernels()).To(BeTrue())
+			Expect(cp.hwQueues[1].pending).To(HaveLen(1))
+			Expect(cp.collectCompletedKernels()).To(BeFalse())
+			Expect(cp.hwQueues[0].running).To(HaveLen(1))
+		})
+	})
+
+	It("should start the kernel with the highest priority", func() {
+		buildCP("priority", 2)
+		launch("q0", 0)
+		req1 := launch("q1", 2)
+
+		dispatcher0.EXPECT().IsDispatching().Return(false)
+		dispatcher0.EXPECT().SetCUMask(nil)
+		dispatcher0.EXPECT().StartDispatching(req1)
+		dispatcher0.EXPECT().IsDispatching().Return(true)
+		dispatcher1.EXPECT().IsDispatching().Return(true)
+
+		cp.scheduleKernels()
+
+		Expect(cp.hwQueues[1].running).To(HaveLen(1))
+	})
+
+	It("should tick the dispatchers of high-priority kernels first", func() {
+		buildCP("priority", 2)
+		low := &hwQueue{slot: 0, priority: 0}
+		low.running = []*hwQueueKernel{{queue: low, dispatcher: dispatcher0}}
+		high := &hwQueue{slot: 1, priority: 2}
+		high.running = []*hwQueueKernel{{queue: high, dispatcher: dispatcher1}}
+		cp.hwQueues = []*hwQueue{low, high}
+
+		Expect(cp.dispatchersInTickOrder()).
+			To(Equal([]dispatching.Dispatcher{dispatcher1, dispatcher0}))
+	})
+
+	It("should give each hardware queue a fixed part of the CUs", func() {
+		buildCP("spatial", 2)
+		cp.hwQueues[0] = &hwQueue{slot: 0, queueID: "other",
+			stats: &HWQueueStats{}}
+		req := launch("q1", 0)
+
+		dispatcher0.EXPECT().IsDispatching().Return(false)
+		dispatcher0.EXPECT().SetCUMask([]bool{false, false, true, true})
+		dispatcher0.EXPECT().StartDispatching(req)
+
+		cp.scheduleKernels()
+	})
+
+	It("should split the CUs among the running kernels", func() {
+		buildCP("fair-share", 2)
+		req0 := launch("q0", 0)
+		req1 := launch("q1", 0)
+
+		dispatcher0.EXPECT().IsDispatching().Return(false)
+		dispatcher0.EXPECT().SetCUMask(nil)
+		dispatcher0.EXPECT().StartDispatching(req0)
+		dispatcher0.EXPECT().IsDispatching().Return(true)
+		dispatcher1.EXPECT().IsDispatching().Return(false)
+		dispatcher1.EXPECT().SetCUMask(nil)
+		dispatcher1.EXPECT().StartDispatching(req1)
+		dispatcher0.EXPECT().SetCUMask([]bool{true, true, false, false})
+		dispatcher1.EXPECT().SetCUMask([]bool{false, false, true, true})
+
+		cp.scheduleKernels()
+
+		dispatcher0.EXPECT().DispatchingKernelID().Return("")
+		dispatcher0.EXPECT().NumWGsPerCU().Return(nil)
+		dispatcher1.EXPECT().DispatchingKernelID().Return(req1.ID)
+		dispatcher1.EXPECT().SetCUMask([]bool{true, true, true, true})
+
+		cp.collectCompletedKernels()
+	})
+
+	It("should record the statistics of completed kernels", func() {
+		buildCP("fifo", 2)
+		req := launch("q0", 0)
+		cp.hwQueues[0].pending[0].arrival = 0.5
+
+		dispatcher0.EXPECT().IsDispatching().Return(false)
+		dispatcher0.EXPECT().SetCUMask(nil)
+		dispatcher0.EXPECT().StartDispatching(req)
+		cp.scheduleKernels()
+
+		dispatcher0.EXPECT().DispatchingKernelID().Return("")
+		dispatcher0.EXPECT().NumWGsPerCU().Return(nil)
+		madeProgress := cp.collectCompletedKernels()
+
+		Expect(madeProgress).To(BeTrue())
+		Expect(cp.hwQueues[0]).To(BeNil())
+
+		stats := cp.HWQueueStats()
+		Expect(stats).To(HaveLen(1))
+		Expect(stats[0].QueueID).To(Equal("q0"))
+		Expect(stats[0].NumKernels).To(Equal(1))
+		Expect(stats[0].AverageLatency()).To(Equal(sim.VTimeInSec(0.5)))
+		Expect(stats[0].LastCompletion).To(Equal(sim.VTimeInSec(1)))
+	})
+
+	It("should only run the kernel on the CUs in its mask", func() {
+		buildCP("fifo", 2)
+		req := protocol.NewLaunchKernelReq(port, port)
+		req.CUMask = []uint32{0x6}
+		Expect(cp.enqueueKernel(req)).To(BeTrue())
+
+		dispatcher0.EXPECT().IsDispatching().Return(false)
+		dispatcher0.EXPECT().SetCUMask([]bool{false, true, true, false})
+		dispatcher0.EXPECT().StartDispatching(req)
+
+		cp.scheduleKernels()
+	})
+
+	It("should refuse the masks that allow none of the CUs", func() {
+		buildCP("fifo", 2)
+		req := protocol.NewLaunchKernelReq(port, port)
+		req.CUMask = []uint32{0xf0}
+
+		Expect(func() { cp.enqueueKernel(req) }).To(Panic())
+	})
+
+	It("should combine the kernel mask with the spatial partition", func() {
+		buildCP("spatial", 2)
+		cp.hwQueues[0] = &hwQueue{slot: 0, queueID: "other",
+			stats: &HWQueueStats{}}
+		req := protocol.NewLaunchKernelReq(port, port)
+		req.QueueID = "q1"
+		req.CUMask = []uint32{0x6}
+		Expect(cp.enqueueKernel(req)).To(BeTrue())
+
+		dispatcher0.EXPECT().IsDispatching().Return(false)
+		dispatcher0.EXPECT().SetCUMask([]bool{false, false, true, false})
+		dispatcher0.EXPECT().StartDispatching(req)
+
+		cp.scheduleKernels()
+	})
+
+	It("should keep the kernel mask if it has no CU in the partition", func() {
+		mask := combineCUMasks(
+			[]bool{true, false, false, false},
+			[]bool{false, false, true, true})
+
+		Expect(mask).To(Equal([]bool{true, false, false, false}))
+	})
+
+	It("should record the CU occupancy of each mask", func() {
+		buildCP("fifo", 2)
+		req := protocol.NewLaunchKernelReq(port, port)
+		req.CUMask = []uint32{0x7}
+		Expect(cp.enqueueKernel(req)).To(BeTrue())
+
+		dispatcher0.EXPECT().IsDispatching().Return(false)
+		dispatcher0.EXPECT().SetCUMask([]bool{true, true, true, false})
+		dispatcher0.EXPECT().StartDispatching(req)
+		cp.scheduleKernels()
+
+		dispatcher0.EXPECT().DispatchingKernelID().Return("")
+		dispatcher0.EXPECT().NumWGsPerCU().Return([]int{3, 0, 2})
+		cp.collectCompletedKernels()
+
+		stats := cp.CUMaskStats()
+		Expect(stats).To(HaveLen(1))
+		Expect(stats[0].Mask).To(Equal("0x00000007"))
+		Expect(stats[0].NumCUsInMask).To(Equal(3))
+		Expect(stats[0].NumKernels).To(Equal(1))
+		Expect(stats[0].NumWGs).To(Equal(5))
+		Expect(stats[0].WGsPerCU).To(Equal([]int{3, 0, 2, 0}))
+		Expect(stats[0].NumCUsUsed()).To(Equal(2))
+		Expect(stats[0].Occupancy()).To(BeNumerically("~", 2.0/3.0))
+	})
+})
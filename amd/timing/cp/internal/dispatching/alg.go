@@ -13,6 +13,33 @@ type dispatchLocation struct {
 	cu        sim.RemotePort
 	wg        *kernels.WorkGroup
 	locations []protocol.WfDispatchLocation
+
+	// savedState is the state of a preempted work-group to restore.
+	savedState interface{}
+}
+
+// A cuMask marks the CUs that a kernel can use. A nil mask allows all the CUs.
+type cuMask []bool
+
+// makeCUMask converts a mask into a cuMask over numCU CUs. A mask that allows
+// none of the CUs allows all the CUs instead, so that every algorithm can
+// still complete the kernel.
+func makeCUMask(mask []bool, numCU int) cuMask {
+	for i := 0; i < numCU && i < len(mask); i++ {
+		if mask[i] {
+			return mask
+		}
+	}
+
+	return nil
+}
+
+func (m cuMask) allows(cuID int) bool {
+	if m == nil {
+		return true
+	}
+
+	return cuID < len(m) && m[cuID]
 }
 
 // algorithm defines the CTA scheduling scheme.
@@ -35,4 +62,42 @@ type algorithm interface {
 
 	// FreeResources marks the dispatched resources available.
 	FreeResources(location dispatchLocation)
+
+	// SetCUMask limits the CUs that the following work-groups can be
+	// dispatched to. A nil mask allows all the CUs.
+	SetCUMask(mask []bool)
+}
+
+// A CacheMissFeedback reports the cache miss rates that the CUs observe at
+// runtime.
+type CacheMissFeedback interface {
+	// MissRate returns the miss rate of the L1 vector cache of a CU since the
+	// previous call for the same CU. It returns false if the cache has not
+	// been accessed since then.
+	MissRate(cuID int) (rate float64, ok bool)
+}
+
+// reserveOnCU tries to reserve the resources of a CU for a work-group.
+func reserveOnCU(
+	cu resource.CUResource,
+	cuID int,
+	wg *kernels.WorkGroup,
+) (dispatchLocation, bool) {
+	locations, ok := cu.ReserveResourceForWG(wg)
+	if !ok {
+		return dispatchLocation{}, false
+	}
+
+	dispatch := dispatchLocation{
+		valid: true,
+		cu:    cu.DispatchingPort(),
+		cuID:  cuID,
+		wg:    wg,
+	}
+	dispatch.locations = make([]protocol.WfDispatchLocation, len(locations))
+	for i, location := range locations {
+		dispatch.locations[i] = protocol.WfDispatchLocation(location)
+	}
+
+	return dispatch, true
 }
@@ -0,0 +1,97 @@
+package dispatching
+
+import (
+	"github.com/sarchlab/mgpusim/v4/amd/kernels"
+	"github.com/sarchlab/mgpusim/v4/amd/timing/cp/internal/resource"
+)
+
+// batchInterleavedAlgorithm dispatches batches of consecutive work-groups to
+// the same CU and interleaves the batches among the CUs in a round robin
+// fashion.
+type batchInterleavedAlgorithm struct {
+	gridBuilder kernels.GridBuilder
+	cuPool      resource.CUResourcePool
+	batchSize   int
+
+	cuMask           cuMask
+	currWG           *kernels.WorkGroup
+	currCU           int
+	numWGInBatch     int
+	numDispatchedWGs int
+}
+
+// RegisterCU allows the batchInterleavedAlgorithm to dispatch work-group to
+// the CU.
+func (a *batchInterleavedAlgorithm) RegisterCU(cu resource.DispatchableCU) {
+	a.cuPool.RegisterCU(cu)
+}
+
+// StartNewKernel lets the algorithms to start dispatching a new kernel.
+func (a *batchInterleavedAlgorithm) StartNewKernel(
+	info kernels.KernelLaunchInfo,
+) {
+	a.numDispatchedWGs = 0
+	a.numWGInBatch = 0
+	a.gridBuilder.SetKernel(info)
+}
+
+// NumWG returns the number of work-groups in the currently-dispatching
+// work-group.
+func (a *batchInterleavedAlgorithm) NumWG() int {
+	return a.gridBuilder.NumWG()
+}
+
+// HasNext check if there are more work-groups to dispatch.
+func (a *batchInterleavedAlgorithm) HasNext() bool {
+	return a.numDispatchedWGs < a.gridBuilder.NumWG()
+}
+
+// Next finds the location to dispatch the next work-group. If the CU of the
+// current batch is full, a new batch starts on the next CU that has free
+// resources.
+func (a *batchInterleavedAlgorithm) Next() (location dispatchLocation) {
+	if a.currWG == nil {
+		a.currWG = a.gridBuilder.NextWG()
+	}
+
+	numCU := a.cuPool.NumCU()
+	for i := 0; i < numCU; i++ {
+		cuID := (a.currCU + i) % numCU
+		if !a.cuMask.allows(cuID) {
+			continue
+		}
+
+		dispatch, ok := reserveOnCU(a.cuPool.GetCU(cuID), cuID, a.currWG)
+		if !ok {
+			continue
+		}
+
+		if cuID != a.currCU {
+			a.currCU = cuID
+			a.numWGInBatch = 0
+		}
+
+		a.numWGInBatch++
+		if a.numWGInBatch >= a.batchSize {
+			a.currCU = (cuID + 1) % numCU
+			a.numWGInBatch = 0
+		}
+
+		a.currWG = nil
+		a.numDispatchedWGs++
+
+		return dispatch
+	}
+
+	return dispatchLocation{}
+}
+
+// SetCUMask limits the CUs that the following work-groups can use.
+func (a *batchInterleavedAlgorithm) SetCUMask(mask []bool) {
+	a.cuMask = makeCUMask(mask, a.cuPool.NumCU())
+}
+
+// FreeResources marks the dispatched location to be available.
+func (a *batchInterleavedAlgorithm) FreeResources(location dispatchLocation) {
+	a.cuPool.GetCU(location.cuID).FreeResourcesForWG(location.wg)
+}
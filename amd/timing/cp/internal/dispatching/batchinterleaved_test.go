@@ -0,0 +1,106 @@
+package dispatching
+
+import (
+	"strconv"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sarchlab/akita/v4/sim"
+	"github.com/sarchlab/mgpusim/v4/amd/kernels"
+	"github.com/sarchlab/mgpusim/v4/amd/timing/cp/internal/resource"
+	"go.uber.org/mock/gomock"
+)
+
+var _ = Describe("Batch Interleaved Algorithm", func() {
+	var (
+		ctrl        *gomock.Controller
+		gridBuilder *MockGridBuilder
+		pool        *MockCUResourcePool
+		cus         []*MockCUResource
+		alg         *batchInterleavedAlgorithm
+	)
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		gridBuilder = NewMockGridBuilder(ctrl)
+
+		cus = make([]*MockCUResource, 2)
+		for i := 0; i < 2; i++ {
+			cus[i] = NewMockCUResource(ctrl)
+			cus[i].EXPECT().DispatchingPort().
+				Return(sim.RemotePort("CUPort" + strconv.Itoa(i))).
+				AnyTimes()
+		}
+
+		pool = NewMockCUResourcePool(ctrl)
+		pool.EXPECT().NumCU().Return(len(cus)).AnyTimes()
+		pool.EXPECT().
+			GetCU(gomock.Any()).
+			DoAndReturn(func(i int) resource.CUResource {
+				return cus[i]
+			}).
+			AnyTimes()
+
+		alg = &batchInterleavedAlgorithm{
+			gridBuilder: gridBuilder,
+			cuPool:      pool,
+			batchSize:   2,
+		}
+	})
+
+	AfterEach(func() {
+		ctrl.Finish()
+	})
+
+	It("should dispatch batches of work-groups to the same CU", func() {
+		cuIDs := make([]int, 0, 4)
+		for _, cuID := range []int{0, 0, 1, 1} {
+			wg := kernels.NewWorkGroup()
+			gridBuilder.EXPECT().NextWG().Return(wg)
+			cus[cuID].EXPECT().ReserveResourceForWG(wg).
+				Return([]resource.WfLocation{}, true)
+
+			location := alg.Next()
+
+			Expect(location.valid).To(BeTrue())
+			cuIDs = append(cuIDs, location.cuID)
+		}
+
+		Expect(cuIDs).To(Equal([]int{0, 0, 1, 1}))
+		Expect(alg.currCU).To(Equal(0))
+	})
+
+	It("should start a new batch if the CU is full", func() {
+		wg := kernels.NewWorkGroup()
+
+		alg.numWGInBatch = 1
+
+		gridBuilder.EXPECT().NextWG().Return(wg)
+		cus[0].EXPECT().ReserveResourceForWG(wg).
+			Return([]resource.WfLocation{}, false)
+		cus[1].EXPECT().ReserveResourceForWG(wg).
+			Return([]resource.WfLocation{}, true)
+
+		location := alg.Next()
+
+		Expect(location.valid).To(BeTrue())
+		Expect(location.cuID).To(Equal(1))
+		Expect(alg.currCU).To(Equal(1))
+		Expect(alg.numWGInBatch).To(Equal(1))
+	})
+
+	It("should return invalid location if dispatch is not possible", func() {
+		wg := kernels.NewWorkGroup()
+
+		gridBuilder.EXPECT().NextWG().Return(wg)
+		cus[0].EXPECT().ReserveResourceForWG(wg).
+			Return([]resource.WfLocation{}, false)
+		cus[1].EXPECT().ReserveResourceForWG(wg).
+			Return([]resource.WfLocation{}, false)
+
+		location := alg.Next()
+
+		Expect(location.valid).To(BeFalse())
+		Expect(alg.numDispatchedWGs).To(Equal(0))
+	})
+})
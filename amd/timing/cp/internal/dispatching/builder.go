@@ -17,12 +17,37 @@ type Builder struct {
 	respondingPort  sim.Port
 	dispatchingPort sim.Port
 	monitor         *monitoring.Monitor
+
+	numCUPerShaderArray int
+	batchSize           int
+	cacheMissFeedback   CacheMissFeedback
+	maxWGsPerCU         int
+	minWGsPerCU         int
+	highMissRate        float64
+	lowMissRate         float64
+
+	latencyTable             []int
+	kernelLaunchOverhead     int
+	kernelCompletionOverhead int
 }
 
 // MakeBuilder creates a builder with default dispatching configurations.
 func MakeBuilder() Builder {
 	b := Builder{
-		alg: "partition",
+		alg:                 "partition",
+		numCUPerShaderArray: 4,
+		batchSize:           4,
+		maxWGsPerCU:         16,
+		minWGsPerCU:         1,
+		highMissRate:        0.5,
+		lowMissRate:         0.2,
+		latencyTable: []int{
+			1,
+			4, 4, 4, 4,
+			5, 6, 7, 8,
+			9, 10, 11, 12,
+			13, 14, 15, 16,
+		},
 	}
 	return b
 }
@@ -53,10 +78,21 @@ func (b Builder) WithDispatchingPort(p sim.Port) Builder {
 	return b
 }
 
-// WithAlg sets the dispatching algorithm.
+// WithAlg sets the dispatching algorithm. The algorithms are:
+//
+//   - "round-robin": Each work-group goes to the next CU.
+//   - "greedy": Work-groups fill a CU before moving to the next CU.
+//   - "partition": Each CU gets a contiguous range of work-groups.
+//   - "shader-array-affinity": Runs of neighboring work-groups go to the CUs
+//     of the same shader array.
+//   - "throttling": Like round-robin, but the number of work-groups on each
+//     CU is capped according to the cache miss rate of the CU.
+//   - "batch-interleaved": Batches of consecutive work-groups go to the same
+//     CU, and the batches are interleaved among the CUs.
 func (b Builder) WithAlg(alg string) Builder {
 	switch alg {
-	case "round-robin", "greedy", "partition":
+	case "round-robin", "greedy", "partition",
+		"shader-array-affinity", "throttling", "batch-interleaved":
 		b.alg = alg
 	default:
 		panic("unknown dispatching algorithm " + alg)
@@ -65,6 +101,66 @@ func (b Builder) WithAlg(alg string) Builder {
 	return b
 }
 
+// WithNumCUPerShaderArray sets the number of CUs in a shader array, which is
+// used by the shader-array-affinity algorithm.
+func (b Builder) WithNumCUPerShaderArray(n int) Builder {
+	b.numCUPerShaderArray = n
+	return b
+}
+
+// WithBatchSize sets the number of consecutive work-groups that the
+// batch-interleaved algorithm dispatches to the same CU.
+func (b Builder) WithBatchSize(n int) Builder {
+	b.batchSize = n
+	return b
+}
+
+// WithCacheMissFeedback sets where the throttling algorithm reads the cache
+// miss rates of the CUs. Without the feedback, the throttling algorithm only
+// enforces the maximum number of work-groups per CU.
+func (b Builder) WithCacheMissFeedback(f CacheMissFeedback) Builder {
+	b.cacheMissFeedback = f
+	return b
+}
+
+// WithWGsPerCURange sets the range of the number of work-groups that the
+// throttling algorithm allows on each CU.
+func (b Builder) WithWGsPerCURange(minWGs, maxWGs int) Builder {
+	b.minWGsPerCU = minWGs
+	b.maxWGsPerCU = maxWGs
+	return b
+}
+
+// WithMissRateThresholds sets the cache miss rates above which the throttling
+// algorithm lowers the cap of a CU and below which it raises the cap.
+func (b Builder) WithMissRateThresholds(low, high float64) Builder {
+	b.lowMissRate = low
+	b.highMissRate = high
+	return b
+}
+
+// WithLatencyTable sets the number of cycles to dispatch a work-group. The
+// i-th entry is the latency of a work-group with i wavefronts. Work-groups with
+// more wavefronts use the last entry.
+func (b Builder) WithLatencyTable(table []int) Builder {
+	b.latencyTable = table
+	return b
+}
+
+// WithKernelLaunchOverhead sets the number of cycles from the start of a
+// kernel to the dispatch of its first work-group.
+func (b Builder) WithKernelLaunchOverhead(cycles int) Builder {
+	b.kernelLaunchOverhead = cycles
+	return b
+}
+
+// WithKernelCompletionOverhead sets the number of cycles from the completion
+// of the last work-group of a kernel to the response to the driver.
+func (b Builder) WithKernelCompletionOverhead(cycles int) Builder {
+	b.kernelCompletionOverhead = cycles
+	return b
+}
+
 // WithMonitor sets the monitor that manages progress bars.
 func (b Builder) WithMonitor(monitor *monitoring.Monitor) Builder {
 	b.monitor = monitor
@@ -74,20 +170,18 @@ func (b Builder) WithMonitor(monitor *monitoring.Monitor) Builder {
 // Build creates a dispatcher.
 func (b Builder) Build(name string) Dispatcher {
 	d := &DispatcherImpl{
-		name:            name,
-		cp:              b.cp,
-		respondingPort:  b.respondingPort,
-		dispatchingPort: b.dispatchingPort,
-		inflightWGs:     make(map[string]dispatchLocation),
-		originalReqs:    make(map[string]*protocol.MapWGReq),
-		latencyTable: []int{
-			1,
-			4, 4, 4, 4,
-			5, 6, 7, 8,
-			9, 10, 11, 12,
-			13, 14, 15, 16,
-		},
-		constantKernelOverhead: 0,
+		name:                   name,
+		cp:                     b.cp,
+		respondingPort:         b.respondingPort,
+		dispatchingPort:        b.dispatchingPort,
+		gridBuilder:            kernels.NewGridBuilder(),
+		cuPool:                 b.cuResourcePool,
+		saveReqSent:            make(map[string]bool),
+		inflightWGs:            make(map[string]dispatchLocation),
+		originalReqs:           make(map[string]*protocol.MapWGReq),
+		latencyTable:           b.latencyTable,
+		kernelLaunchOverhead:   b.kernelLaunchOverhead,
+		constantKernelOverhead: b.kernelCompletionOverhead,
 		monitor:                b.monitor,
 	}
 
@@ -106,6 +200,28 @@ func (b Builder) Build(name string) Dispatcher {
 		d.alg = &partitionAlgorithm{
 			cuPool: b.cuResourcePool,
 		}
+	case "shader-array-affinity":
+		d.alg = &shaderArrayAffinityAlgorithm{
+			gridBuilder: kernels.NewGridBuilder(),
+			cuPool:      b.cuResourcePool,
+			numCUPerSA:  b.numCUPerShaderArray,
+		}
+	case "throttling":
+		d.alg = &throttlingAlgorithm{
+			gridBuilder:  kernels.NewGridBuilder(),
+			cuPool:       b.cuResourcePool,
+			feedback:     b.cacheMissFeedback,
+			maxWGsPerCU:  b.maxWGsPerCU,
+			minWGsPerCU:  b.minWGsPerCU,
+			highMissRate: b.highMissRate,
+			lowMissRate:  b.lowMissRate,
+		}
+	case "batch-interleaved":
+		d.alg = &batchInterleavedAlgorithm{
+			gridBuilder: kernels.NewGridBuilder(),
+			cuPool:      b.cuResourcePool,
+			batchSize:   b.batchSize,
+		}
 	default:
 		panic("unknown dispatching algorithm " + b.alg)
 	}
@@ -0,0 +1,103 @@
+package dispatching
+
+import (
+	"fmt"
+
+	"github.com/sarchlab/mgpusim/v4/amd/kernels"
+	"github.com/sarchlab/mgpusim/v4/amd/protocol"
+)
+
+// hasNextWG checks if there are more work-groups of the kernel to dispatch.
+func (d *DispatcherImpl) hasNextWG() bool {
+	if d.dispatching != nil && d.dispatching.Cooperative {
+		if d.err != nil {
+			return false
+		}
+
+		return !d.gridReserved || len(d.coResidentWGs) > 0
+	}
+
+	return d.alg.HasNext()
+}
+
+// nextCoResidentWG returns the next work-group of a cooperative kernel. The
+// resources of all the work-groups are reserved before the first work-group
+// is dispatched, so that the work-groups never wait at a grid barrier for a
+// work-group that cannot start.
+func (d *DispatcherImpl) nextCoResidentWG() dispatchLocation {
+	if !d.gridReserved && !d.reserveGrid() {
+		return dispatchLocation{}
+	}
+
+	if len(d.coResidentWGs) == 0 {
+		return dispatchLocation{}
+	}
+
+	location := d.coResidentWGs[0]
+	d.coResidentWGs = d.coResidentWGs[1:]
+
+	return location
+}
+
+// reserveGrid reserves the resources of all the work-groups of the kernel at
+// the same time. If the CUs are busy with other kernels, the reservation is
+// retried later. If the work-groups do not fit even on idle CUs, the kernel
+// would wait forever, so it completes with an error instead.
+func (d *DispatcherImpl) reserveGrid() bool {
+	req := d.dispatching
+	d.gridBuilder.SetKernel(kernels.KernelLaunchInfo{
+		CodeObject: req.HsaCo,
+		Packet:     req.Packet,
+		PacketAddr: req.PacketAddress,
+		WGFilter:   req.WGFilter,
+	})
+
+	wgs := make([]*kernels.WorkGroup, 0, d.gridBuilder.NumWG())
+	for i := 0; i < d.gridBuilder.NumWG(); i++ {
+		wgs = append(wgs, d.gridBuilder.NextWG())
+	}
+
+	cuIDs, locations, ok := d.cuPool.ReserveCoResident(wgs, d.cuMask)
+	if !ok {
+		if d.areAllowedCUsIdle() {
+			d.err = fmt.Errorf("the %d work-groups of the cooperative "+
+				"kernel cannot run on the CUs at the same time", len(wgs))
+		}
+
+		return false
+	}
+
+	d.coResidentWGs = make([]dispatchLocation, len(wgs))
+	for i, wg := range wgs {
+		cu := d.cuPool.GetCU(cuIDs[i])
+		location := dispatchLocation{
+			valid: true,
+			cu:    cu.DispatchingPort(),
+			cuID:  cuIDs[i],
+			wg:    wg,
+		}
+		location.locations =
+			make([]protocol.WfDispatchLocation, len(locations[i]))
+		for j, l := range locations[i] {
+			location.locations[j] = protocol.WfDispatchLocation(l)
+		}
+
+		d.coResidentWGs[i] = location
+	}
+
+	d.gridReserved = true
+
+	return true
+}
+
+// areAllowedCUsIdle checks if no work-group runs on the CUs that the kernel
+// can use.
+func (d *DispatcherImpl) areAllowedCUsIdle() bool {
+	for i := 0; i < d.cuPool.NumCU(); i++ {
+		if d.cuMask.allows(i) && !d.cuPool.GetCU(i).IsIdle() {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,135 @@
+package dispatching
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sarchlab/akita/v4/sim"
+	"github.com/sarchlab/mgpusim/v4/amd/kernels"
+	"github.com/sarchlab/mgpusim/v4/amd/protocol"
+	"github.com/sarchlab/mgpusim/v4/amd/timing/cp/internal/resource"
+	"go.uber.org/mock/gomock"
+)
+
+var _ = Describe("Cooperative Dispatching", func() {
+	var (
+		ctrl *gomock.Controller
+
+		cp              *MockNamedHookable
+		alg             *MockAlgorithm
+		gridBuilder     *MockGridBuilder
+		cuPool          *MockCUResourcePool
+		cu              *MockCUResource
+		dispatchingPort *MockPort
+		respondingPort  *MockPort
+
+		dispatcher *DispatcherImpl
+		req        *protocol.LaunchKernelReq
+		wgs        []*kernels.WorkGroup
+	)
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+
+		cp = NewMockNamedHookable(ctrl)
+		cp.EXPECT().Name().Return("CP").AnyTimes()
+		cp.EXPECT().NumHooks().Return(0).AnyTimes()
+		cp.EXPECT().InvokeHook(gomock.Any()).AnyTimes()
+		alg = NewMockAlgorithm(ctrl)
+		gridBuilder = NewMockGridBuilder(ctrl)
+		cuPool = NewMockCUResourcePool(ctrl)
+		cu = NewMockCUResource(ctrl)
+		dispatchingPort = NewMockPort(ctrl)
+		respondingPort = NewMockPort(ctrl)
+
+		dispatchingPort.EXPECT().AsRemote().AnyTimes()
+		respondingPort.EXPECT().AsRemote().AnyTimes()
+		cu.EXPECT().DispatchingPort().Return(sim.RemotePort("CU")).AnyTimes()
+
+		dispatcher = MakeBuilder().
+			WithCP(cp).
+			WithDispatchingPort(dispatchingPort).
+			WithRespondingPort(respondingPort).
+			Build("dispatcher").(*DispatcherImpl)
+		dispatcher.alg = alg
+		dispatcher.gridBuilder = gridBuilder
+		dispatcher.cuPool = cuPool
+
+		req = protocol.NewLaunchKernelReq(respondingPort, respondingPort)
+		req.Cooperative = true
+		dispatcher.dispatching = req
+
+		wgs = []*kernels.WorkGroup{
+			kernels.NewWorkGroup(),
+			kernels.NewWorkGroup(),
+		}
+		gridBuilder.EXPECT().SetKernel(gomock.Any()).AnyTimes()
+		gridBuilder.EXPECT().NumWG().Return(2).AnyTimes()
+		gridBuilder.EXPECT().NextWG().Return(wgs[0])
+		gridBuilder.EXPECT().NextWG().Return(wgs[1])
+	})
+
+	AfterEach(func() {
+		ctrl.Finish()
+	})
+
+	It("should reserve all the work-groups before dispatching", func() {
+		cuPool.EXPECT().
+			ReserveCoResident(wgs, gomock.Any()).
+			Return([]int{0, 1}, [][]resource.WfLocation{{{}}, {{}, {}}}, true)
+		cuPool.EXPECT().GetCU(gomock.Any()).Return(cu).Times(2)
+		dispatchingPort.EXPECT().PeekIncoming().Return(nil)
+		dispatchingPort.EXPECT().Send(gomock.Any()).
+			Do(func(req *protocol.MapWGReq) {
+				Expect(req.WorkGroup).To(BeIdenticalTo(wgs[0]))
+			})
+
+		madeProgress := dispatcher.Tick()
+
+		Expect(madeProgress).To(BeTrue())
+		Expect(dispatcher.gridReserved).To(BeTrue())
+		Expect(dispatcher.coResidentWGs).To(HaveLen(1))
+		Expect(dispatcher.coResidentWGs[0].cuID).To(Equal(1))
+		Expect(dispatcher.coResidentWGs[0].locations).To(HaveLen(2))
+		Expect(dispatcher.hasNextWG()).To(BeTrue())
+	})
+
+	It("should wait if the CUs are busy", func() {
+		cuPool.EXPECT().
+			ReserveCoResident(wgs, gomock.Any()).
+			Return(nil, nil, false)
+		cuPool.EXPECT().NumCU().Return(1).AnyTimes()
+		cuPool.EXPECT().GetCU(0).Return(cu)
+		cu.EXPECT().IsIdle().Return(false)
+		dispatchingPort.EXPECT().PeekIncoming().Return(nil)
+
+		madeProgress := dispatcher.Tick()
+
+		Expect(madeProgress).To(BeFalse())
+		Expect(dispatcher.gridReserved).To(BeFalse())
+		Expect(dispatcher.kernelCompleted()).To(BeFalse())
+	})
+
+	It("should respond with an error if the work-groups can never fit",
+		func() {
+			cuPool.EXPECT().
+				ReserveCoResident(wgs, gomock.Any()).
+				Return(nil, nil, false)
+			cuPool.EXPECT().NumCU().Return(1).AnyTimes()
+			cuPool.EXPECT().GetCU(0).Return(cu)
+			cu.EXPECT().IsIdle().Return(true)
+			dispatchingPort.EXPECT().PeekIncoming().Return(nil).Times(2)
+
+			Expect(dispatcher.Tick()).To(BeTrue())
+			Expect(dispatcher.kernelCompleted()).To(BeTrue())
+
+			req.Src = "Driver"
+			respondingPort.EXPECT().Send(gomock.Any()).
+				Do(func(rsp *protocol.LaunchKernelRsp) {
+					Expect(rsp.RspTo).To(Equal(req.ID))
+					Expect(rsp.Err).To(HaveOccurred())
+				})
+
+			Expect(dispatcher.Tick()).To(BeTrue())
+			Expect(dispatcher.IsDispatching()).To(BeFalse())
+		})
+})
@@ -21,6 +21,29 @@ type Dispatcher interface {
 	IsDispatching() bool
 	StartDispatching(req *protocol.LaunchKernelReq)
 	Tick() (madeProgress bool)
+
+	// DispatchingKernelID returns the ID of the LaunchKernelReq of the kernel
+	// that is being dispatched. It returns an empty string if the dispatcher
+	// is idle.
+	DispatchingKernelID() string
+
+	// Preempt stops dispatching the kernel and releases the CUs that the
+	// kernel uses. The dispatcher responds to the request when the CUs are
+	// released. It returns false if another preemption is in progress.
+	Preempt(req *protocol.PreemptKernelReq) bool
+
+	// Resume continues dispatching a preempted kernel. It returns false if
+	// the kernel is still being preempted.
+	Resume() bool
+
+	// SetCUMask limits the CUs that the dispatcher can dispatch work-groups
+	// to. A nil mask allows all the CUs.
+	SetCUMask(mask []bool)
+
+	// NumWGsPerCU returns the number of work-groups of the current or the
+	// most recent kernel that are dispatched to each CU. The CUs after the
+	// last CU that receives work-groups are omitted.
+	NumWGsPerCU() []int
 }
 
 // A DispatcherImpl is a ticking component that can dispatch work-groups.
@@ -32,16 +55,39 @@ type DispatcherImpl struct {
 	respondingPort         sim.Port
 	dispatchingPort        sim.Port
 	alg                    algorithm
+	gridBuilder            kernels.GridBuilder
+	cuPool                 resource.CUResourcePool
+	cuMask                 cuMask
 	dispatching            *protocol.LaunchKernelReq
 	currWG                 dispatchLocation
 	cycleLeft              int
 	numDispatchedWGs       int
 	numCompletedWGs        int
+	numWGsPerCU            []int
 	inflightWGs            map[string]dispatchLocation
 	originalReqs           map[string]*protocol.MapWGReq
 	latencyTable           []int
+	kernelLaunchOverhead   int
 	constantKernelOverhead int
 
+	// gridReserved tells if the resources of all the work-groups of the
+	// cooperative kernel are reserved. The reserved work-groups that are not
+	// dispatched yet are in coResidentWGs.
+	gridReserved  bool
+	coResidentWGs []dispatchLocation
+
+	// err is the reason that the kernel cannot run. The kernel completes
+	// without dispatching any work-group and the error is sent back with the
+	// response.
+	err error
+
+	preemptReq        *protocol.PreemptKernelReq
+	isPreempted       bool
+	saveReqSent       map[string]bool
+	preemptedWGs      []preemptedWG
+	savedByteSize     uint64
+	contextSaveOffset uint64
+
 	monitor     *monitoring.Monitor
 	progressBar *monitoring.ProgressBar
 }
@@ -56,6 +102,18 @@ func (d *DispatcherImpl) RegisterCU(cu resource.DispatchableCU) {
 	d.alg.RegisterCU(cu)
 }
 
+// SetCUMask limits the CUs that the dispatcher can dispatch work-groups to.
+func (d *DispatcherImpl) SetCUMask(mask []bool) {
+	d.cuMask = makeCUMask(mask, d.cuPool.NumCU())
+	d.alg.SetCUMask(mask)
+}
+
+// NumWGsPerCU returns the number of work-groups of the current or the most
+// recent kernel that are dispatched to each CU.
+func (d *DispatcherImpl) NumWGsPerCU() []int {
+	return d.numWGsPerCU
+}
+
 // IsDispatching checks if the dispatcher is dispatching another kernel.
 func (d *DispatcherImpl) IsDispatching() bool {
 	return d.dispatching != nil
@@ -75,6 +133,11 @@ func (d *DispatcherImpl) StartDispatching(req *protocol.LaunchKernelReq) {
 
 	d.numDispatchedWGs = 0
 	d.numCompletedWGs = 0
+	d.numWGsPerCU = nil
+	d.cycleLeft = d.kernelLaunchOverhead
+	d.gridReserved = false
+	d.coResidentWGs = nil
+	d.err = nil
 
 	d.initializeProgressBar(req.ID)
 }
@@ -102,9 +165,13 @@ func (d *DispatcherImpl) Tick() (madeProgress bool) {
 	}
 
 	if d.dispatching != nil {
-		if d.kernelCompleted() {
+		switch {
+		case d.preemptReq != nil:
+			madeProgress = d.doPreemption() || madeProgress
+		case d.isPreempted:
+		case d.kernelCompleted():
 			madeProgress = d.completeKernel() || madeProgress
-		} else {
+		default:
 			madeProgress = d.dispatchNextWG() || madeProgress
 		}
 	}
@@ -114,6 +181,29 @@ func (d *DispatcherImpl) Tick() (madeProgress bool) {
 	return madeProgress
 }
 
+// dispatchLatency returns the number of cycles to dispatch a work-group with
+// the given number of wavefronts. Work-groups with more wavefronts than the
+// latency table covers use the last entry of the table.
+func (d *DispatcherImpl) dispatchLatency(numWf int) int {
+	if len(d.latencyTable) == 0 {
+		return 0
+	}
+
+	if numWf >= len(d.latencyTable) {
+		return d.latencyTable[len(d.latencyTable)-1]
+	}
+
+	return d.latencyTable[numWf]
+}
+
+func (d *DispatcherImpl) countWGOnCU(cuID int) {
+	for len(d.numWGsPerCU) <= cuID {
+		d.numWGsPerCU = append(d.numWGsPerCU, 0)
+	}
+
+	d.numWGsPerCU[cuID]++
+}
+
 func (d *DispatcherImpl) collectSamplingData(locations []protocol.WfDispatchLocation) {
 	if *sampling.SampledRunnerFlag {
 		for _, l := range locations {
@@ -168,6 +258,8 @@ func (d *DispatcherImpl) processMessagesFromCU() bool {
 
 		d.dispatchingPort.RetrieveIncoming()
 		return true
+	case *protocol.SaveWGRsp:
+		return d.processSaveWGRsp(msg)
 	}
 
 	return false
@@ -178,7 +270,11 @@ func (d *DispatcherImpl) kernelCompleted() bool {
 		return false
 	}
 
-	if d.alg.HasNext() {
+	if d.hasNextWG() {
+		return false
+	}
+
+	if len(d.preemptedWGs) > 0 {
 		return false
 	}
 
@@ -194,9 +290,16 @@ func (d *DispatcherImpl) completeKernel() (
 ) {
 	req := d.dispatching
 
-	rsp := protocol.NewLaunchKernelRsp(req.Dst, req.Src, req.ID)
+	var err *sim.SendError
+	if req.Src != d.respondingPort.AsRemote() {
+		// The kernels that the Command Processor launches itself, such as
+		// the kernels of the device queues, are tracked by the Command
+		// Processor and need no response.
+		rsp := protocol.NewLaunchKernelRsp(req.Dst, req.Src, req.ID)
+		rsp.Err = d.err
+		err = d.respondingPort.Send(rsp)
+	}
 
-	err := d.respondingPort.Send(rsp)
 	if err == nil {
 		d.dispatching = nil
 
@@ -214,12 +317,18 @@ func (d *DispatcherImpl) completeKernel() (
 
 func (d *DispatcherImpl) dispatchNextWG() (madeProgress bool) {
 	if !d.currWG.valid {
-		if !d.alg.HasNext() {
-			return false
+		switch {
+		case len(d.preemptedWGs) > 0:
+			d.currWG = d.placePreemptedWG()
+		case d.dispatching.Cooperative:
+			d.currWG = d.nextCoResidentWG()
+		case d.alg.HasNext():
+			d.currWG = d.alg.Next()
 		}
-		d.currWG = d.alg.Next()
+
 		if !d.currWG.valid {
-			return false
+			// A kernel that cannot run completes on the next tick.
+			return d.err != nil
 		}
 	}
 
@@ -227,7 +336,8 @@ func (d *DispatcherImpl) dispatchNextWG() (madeProgress bool) {
 		WithSrc(d.dispatchingPort.AsRemote()).
 		WithDst(d.currWG.cu).
 		WithPID(d.dispatching.PID).
-		WithWG(d.currWG.wg)
+		WithWG(d.currWG.wg).
+		WithSavedState(d.currWG.savedState)
 	for _, l := range d.currWG.locations {
 		reqBuilder = reqBuilder.AddWf(l)
 	}
@@ -237,14 +347,20 @@ func (d *DispatcherImpl) dispatchNextWG() (madeProgress bool) {
 	// fmt.Printf("%.10f, %d, %d\n", now, d.currWG.wg.IDX, d.currWG.cuID)
 
 	if err == nil {
+		isRestored := d.currWG.savedState != nil
 		d.currWG.valid = false
+		d.currWG.savedState = nil
 		d.numDispatchedWGs++
 		d.inflightWGs[req.ID] = d.currWG
 		d.originalReqs[req.ID] = req
-		d.cycleLeft = d.latencyTable[len(d.currWG.locations)]
+		d.cycleLeft = d.dispatchLatency(len(d.currWG.locations))
+
+		if !isRestored {
+			d.countWGOnCU(d.currWG.cuID)
 
-		if d.progressBar != nil {
-			d.progressBar.IncrementInProgress(1)
+			if d.progressBar != nil {
+				d.progressBar.IncrementInProgress(1)
+			}
 		}
 
 		tracing.TraceReqInitiate(req, d,
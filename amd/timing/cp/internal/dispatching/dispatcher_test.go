@@ -34,7 +34,9 @@ var _ = Describe("Dispatcher", func() {
 		respondingPort = NewMockPort(ctrl)
 
 		dispatchingPort.EXPECT().AsRemote().AnyTimes()
-		respondingPort.EXPECT().AsRemote().AnyTimes()
+		respondingPort.EXPECT().AsRemote().
+			Return(sim.RemotePort("CP.ToDriver")).
+			AnyTimes()
 
 		dispatcher = MakeBuilder().
 			WithCP(cp).
@@ -105,9 +107,23 @@ var _ = Describe("Dispatcher", func() {
 		Expect(dispatcher.currWG.valid).To(BeFalse())
 		Expect(dispatcher.numDispatchedWGs).To(Equal(1))
 		Expect(dispatcher.inflightWGs).To(HaveLen(1))
+		Expect(dispatcher.NumWGsPerCU()).To(Equal([]int{1}))
 		Expect(dispatcher.cycleLeft).NotTo(Equal(0))
 	})
 
+	It("should not respond to the kernels launched by the CP", func() {
+		req := protocol.NewLaunchKernelReq(respondingPort, respondingPort)
+		dispatcher.dispatching = req
+
+		alg.EXPECT().HasNext().Return(false).AnyTimes()
+		dispatchingPort.EXPECT().PeekIncoming().Return(nil)
+
+		madeProgress := dispatcher.Tick()
+
+		Expect(madeProgress).To(BeTrue())
+		Expect(dispatcher.dispatching).To(BeNil())
+	})
+
 	It("should wait until cycle left becomes 0", func() {
 		nilPort := NewMockPort(ctrl)
 		nilPort.EXPECT().AsRemote().AnyTimes()
@@ -122,6 +138,27 @@ var _ = Describe("Dispatcher", func() {
 		Expect(dispatcher.cycleLeft).To(Equal(2))
 	})
 
+	It("should wait for the kernel launch overhead", func() {
+		dispatcher.kernelLaunchOverhead = 5
+
+		nilPort := NewMockPort(ctrl)
+		nilPort.EXPECT().AsRemote().AnyTimes()
+
+		req := protocol.NewLaunchKernelReq(nilPort, respondingPort)
+		alg.EXPECT().StartNewKernel(gomock.Any())
+
+		dispatcher.StartDispatching(req)
+
+		Expect(dispatcher.cycleLeft).To(Equal(5))
+	})
+
+	It("should use the last latency for large work-groups", func() {
+		dispatcher.latencyTable = []int{1, 2, 3}
+
+		Expect(dispatcher.dispatchLatency(1)).To(Equal(2))
+		Expect(dispatcher.dispatchLatency(8)).To(Equal(3))
+	})
+
 	It("should pause if no work-group can be executed", func() {
 		nilPort := NewMockPort(ctrl)
 		nilPort.EXPECT().AsRemote().AnyTimes()
@@ -321,4 +358,218 @@ var _ = Describe("Dispatcher", func() {
 		Expect(madeProgress).To(BeFalse())
 		Expect(dispatcher.dispatching).To(BeIdenticalTo(req))
 	})
+
+	Context("preemption", func() {
+		var (
+			nilPort *MockPort
+			req     *protocol.LaunchKernelReq
+		)
+
+		BeforeEach(func() {
+			nilPort = NewMockPort(ctrl)
+			nilPort.EXPECT().AsRemote().AnyTimes()
+
+			req = protocol.NewLaunchKernelReq(nilPort, respondingPort)
+			dispatcher.dispatching = req
+		})
+
+		It("should panic if the kernel is not being dispatched", func() {
+			preemptReq := protocol.NewPreemptKernelReq(
+				"", "", "other", protocol.PreemptionModeDrain)
+
+			Expect(func() { dispatcher.Preempt(preemptReq) }).To(Panic())
+		})
+
+		It("should put back the work-group that is not dispatched", func() {
+			wg := &kernels.WorkGroup{}
+			location := dispatchLocation{valid: true, wg: wg}
+			dispatcher.currWG = location
+			preemptReq := protocol.NewPreemptKernelReq(
+				"", "", req.ID, protocol.PreemptionModeDrain)
+
+			alg.EXPECT().FreeResources(location)
+
+			Expect(dispatcher.Preempt(preemptReq)).To(BeTrue())
+			Expect(dispatcher.currWG.valid).To(BeFalse())
+			Expect(dispatcher.preemptedWGs).To(HaveLen(1))
+			Expect(dispatcher.preemptedWGs[0].wg).To(BeIdenticalTo(wg))
+		})
+
+		It("should not accept another preemption", func() {
+			preemptReq := protocol.NewPreemptKernelReq(
+				"", "", req.ID, protocol.PreemptionModeDrain)
+
+			Expect(dispatcher.Preempt(preemptReq)).To(BeTrue())
+			Expect(dispatcher.Preempt(preemptReq)).To(BeFalse())
+			Expect(dispatcher.Resume()).To(BeFalse())
+		})
+
+		It("should wait for the running work-groups to drain", func() {
+			dispatcher.inflightWGs["wg"] = dispatchLocation{}
+			preemptReq := protocol.NewPreemptKernelReq(
+				"", "", req.ID, protocol.PreemptionModeDrain)
+			dispatcher.Preempt(preemptReq)
+
+			dispatchingPort.EXPECT().PeekIncoming().Return(nil)
+
+			madeProgress := dispatcher.Tick()
+
+			Expect(madeProgress).To(BeFalse())
+			Expect(dispatcher.isPreempted).To(BeFalse())
+		})
+
+		It("should respond when no work-group is running", func() {
+			preemptReq := protocol.NewPreemptKernelReq(
+				"", "", req.ID, protocol.PreemptionModeDrain)
+			dispatcher.Preempt(preemptReq)
+
+			dispatchingPort.EXPECT().PeekIncoming().Return(nil)
+			respondingPort.EXPECT().
+				Send(gomock.Any()).
+				Do(func(msg sim.Msg) {
+					rsp := msg.(*protocol.PreemptKernelRsp)
+					Expect(rsp.RspTo).To(Equal(preemptReq.ID))
+					Expect(rsp.Preempted).To(BeTrue())
+				}).
+				Return(nil)
+
+			madeProgress := dispatcher.Tick()
+
+			Expect(madeProgress).To(BeTrue())
+			Expect(dispatcher.isPreempted).To(BeTrue())
+			Expect(dispatcher.preemptReq).To(BeNil())
+		})
+
+		It("should ask the CUs to save the running work-groups", func() {
+			req.HsaCo = insts.NewHsaCo()
+			req.HsaCo.WIVgprCount = 1
+			req.Packet = &kernels.HsaKernelDispatchPacket{
+				WorkgroupSizeX: 64,
+				WorkgroupSizeY: 1,
+				WorkgroupSizeZ: 1,
+			}
+			dispatcher.inflightWGs["wg1"] = dispatchLocation{
+				cu: nilPort.AsRemote(),
+			}
+			dispatcher.inflightWGs["wg2"] = dispatchLocation{
+				cu: nilPort.AsRemote(),
+			}
+			preemptReq := protocol.NewPreemptKernelReq(
+				"", "", req.ID, protocol.PreemptionModeSaveState)
+			preemptReq.ContextSaveArea = 0x10000
+			preemptReq.ContextSaveAreaSize = 512
+			dispatcher.Preempt(preemptReq)
+
+			saveReqs := make([]*protocol.SaveWGReq, 0)
+			dispatchingPort.EXPECT().PeekIncoming().Return(nil).Times(3)
+			dispatchingPort.EXPECT().
+				Send(gomock.Any()).
+				Do(func(msg sim.Msg) {
+					saveReqs = append(saveReqs, msg.(*protocol.SaveWGReq))
+				}).
+				Return(nil).
+				Times(2)
+
+			Expect(dispatcher.Tick()).To(BeTrue())
+			Expect(dispatcher.Tick()).To(BeTrue())
+			Expect(dispatcher.Tick()).To(BeFalse())
+
+			Expect(saveReqs[0].MapReqID).To(Equal("wg1"))
+			Expect(saveReqs[0].Address).To(Equal(uint64(0x10000)))
+			Expect(saveReqs[1].MapReqID).To(Equal("wg2"))
+			Expect(saveReqs[1].Address).To(Equal(uint64(0x10100)))
+		})
+
+		It("should panic if the context-save area is too small", func() {
+			req.HsaCo = insts.NewHsaCo()
+			req.HsaCo.WIVgprCount = 1
+			req.Packet = &kernels.HsaKernelDispatchPacket{
+				WorkgroupSizeX: 64,
+				WorkgroupSizeY: 1,
+				WorkgroupSizeZ: 1,
+			}
+			dispatcher.inflightWGs["wg"] = dispatchLocation{
+				cu: nilPort.AsRemote(),
+			}
+			preemptReq := protocol.NewPreemptKernelReq(
+				"", "", req.ID, protocol.PreemptionModeSaveState)
+			preemptReq.ContextSaveArea = 0x10000
+			preemptReq.ContextSaveAreaSize = 128
+			dispatcher.Preempt(preemptReq)
+
+			Expect(func() { dispatcher.Tick() }).To(Panic())
+		})
+
+		It("should not preempt a cooperative kernel", func() {
+			req.Cooperative = true
+			dispatcher.inflightWGs["wg"] = dispatchLocation{
+				cu: nilPort.AsRemote(),
+			}
+			preemptReq := protocol.NewPreemptKernelReq(
+				"", "", req.ID, protocol.PreemptionModeSaveState)
+
+			Expect(dispatcher.Preempt(preemptReq)).To(BeTrue())
+
+			dispatchingPort.EXPECT().PeekIncoming().Return(nil)
+			respondingPort.EXPECT().
+				Send(gomock.Any()).
+				Do(func(msg sim.Msg) {
+					rsp := msg.(*protocol.PreemptKernelRsp)
+					Expect(rsp.RspTo).To(Equal(preemptReq.ID))
+					Expect(rsp.Preempted).To(BeFalse())
+				}).
+				Return(nil)
+
+			Expect(dispatcher.Tick()).To(BeTrue())
+			Expect(dispatcher.preemptReq).To(BeNil())
+			Expect(dispatcher.isPreempted).To(BeFalse())
+			Expect(dispatcher.inflightWGs).To(HaveLen(1))
+		})
+
+		It("should keep the saved work-group state", func() {
+			wg := &kernels.WorkGroup{}
+			location := dispatchLocation{wg: wg}
+			mapWGReq := protocol.MapWGReqBuilder{}.Build()
+			dispatcher.inflightWGs[mapWGReq.ID] = location
+			dispatcher.originalReqs[mapWGReq.ID] = mapWGReq
+			dispatcher.numDispatchedWGs = 1
+			dispatcher.isPreempted = true
+
+			state := "state"
+			rsp := protocol.SaveWGRspBuilder{}.
+				WithRspTo(mapWGReq.ID).
+				WithState(state, 256).
+				Build()
+
+			alg.EXPECT().FreeResources(location)
+			dispatchingPort.EXPECT().PeekIncoming().Return(rsp)
+			dispatchingPort.EXPECT().RetrieveIncoming()
+
+			madeProgress := dispatcher.Tick()
+
+			Expect(madeProgress).To(BeTrue())
+			Expect(dispatcher.inflightWGs).To(BeEmpty())
+			Expect(dispatcher.numDispatchedWGs).To(Equal(0))
+			Expect(dispatcher.savedByteSize).To(Equal(uint64(256)))
+			Expect(dispatcher.preemptedWGs).To(HaveLen(1))
+			Expect(dispatcher.preemptedWGs[0].state).To(Equal(state))
+		})
+
+		It("should stop dispatching when preempted", func() {
+			dispatcher.isPreempted = true
+
+			dispatchingPort.EXPECT().PeekIncoming().Return(nil)
+
+			madeProgress := dispatcher.Tick()
+
+			Expect(madeProgress).To(BeFalse())
+		})
+
+		It("should resume", func() {
+			dispatcher.isPreempted = true
+
+			Expect(dispatcher.Resume()).To(BeTrue())
+			Expect(dispatcher.isPreempted).To(BeFalse())
+		})
+	})
 })
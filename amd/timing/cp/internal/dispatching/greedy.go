@@ -11,6 +11,7 @@ type greedyAlgorithm struct {
 	gridBuilder kernels.GridBuilder
 	cuPool      resource.CUResourcePool
 
+	cuMask           cuMask
 	currWG           *kernels.WorkGroup
 	numDispatchedWGs int
 }
@@ -45,6 +46,10 @@ func (a *greedyAlgorithm) Next() (location dispatchLocation) {
 
 	for i := 0; i < a.cuPool.NumCU(); i++ {
 		cuID := i
+		if !a.cuMask.allows(cuID) {
+			continue
+		}
+
 		cu := a.cuPool.GetCU(cuID)
 
 		locations, ok := cu.ReserveResourceForWG(a.currWG)
@@ -71,6 +76,11 @@ func (a *greedyAlgorithm) Next() (location dispatchLocation) {
 	return dispatchLocation{}
 }
 
+// SetCUMask limits the CUs that the following work-groups can use.
+func (a *greedyAlgorithm) SetCUMask(mask []bool) {
+	a.cuMask = makeCUMask(mask, a.cuPool.NumCU())
+}
+
 // FreeResources marks the dispatched location to be available.
 func (a *greedyAlgorithm) FreeResources(location dispatchLocation) {
 	a.cuPool.GetCU(location.cuID).FreeResourcesForWG(location.wg)
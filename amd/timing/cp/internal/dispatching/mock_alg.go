@@ -107,6 +107,18 @@ func (mr *MockAlgorithmMockRecorder) RegisterCU(cu any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RegisterCU", reflect.TypeOf((*MockAlgorithm)(nil).RegisterCU), cu)
 }
 
+// SetCUMask mocks base method.
+func (m *MockAlgorithm) SetCUMask(mask []bool) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SetCUMask", mask)
+}
+
+// SetCUMask indicates an expected call of SetCUMask.
+func (mr *MockAlgorithmMockRecorder) SetCUMask(mask any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetCUMask", reflect.TypeOf((*MockAlgorithm)(nil).SetCUMask), mask)
+}
+
 // StartNewKernel mocks base method.
 func (m *MockAlgorithm) StartNewKernel(info kernels.KernelLaunchInfo) {
 	m.ctrl.T.Helper()
@@ -118,3 +130,42 @@ func (mr *MockAlgorithmMockRecorder) StartNewKernel(info any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StartNewKernel", reflect.TypeOf((*MockAlgorithm)(nil).StartNewKernel), info)
 }
+
+// MockCacheMissFeedback is a mock of CacheMissFeedback interface.
+type MockCacheMissFeedback struct {
+	ctrl     *gomock.Controller
+	recorder *MockCacheMissFeedbackMockRecorder
+	isgomock struct{}
+}
+
+// MockCacheMissFeedbackMockRecorder is the mock recorder for MockCacheMissFeedback.
+type MockCacheMissFeedbackMockRecorder struct {
+	mock *MockCacheMissFeedback
+}
+
+// NewMockCacheMissFeedback creates a new mock instance.
+func NewMockCacheMissFeedback(ctrl *gomock.Controller) *MockCacheMissFeedback {
+	mock := &MockCacheMissFeedback{ctrl: ctrl}
+	mock.recorder = &MockCacheMissFeedbackMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockCacheMissFeedback) EXPECT() *MockCacheMissFeedbackMockRecorder {
+	return m.recorder
+}
+
+// MissRate mocks base method.
+func (m *MockCacheMissFeedback) MissRate(cuID int) (float64, bool) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MissRate", cuID)
+	ret0, _ := ret[0].(float64)
+	ret1, _ := ret[1].(bool)
+	return ret0, ret1
+}
+
+// MissRate indicates an expected call of MissRate.
+func (mr *MockCacheMissFeedbackMockRecorder) MissRate(cuID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MissRate", reflect.TypeOf((*MockCacheMissFeedback)(nil).MissRate), cuID)
+}
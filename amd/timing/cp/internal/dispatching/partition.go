@@ -16,6 +16,10 @@ type partition struct {
 type partitionAlgorithm struct {
 	partitions []*partition
 	cuPool     resource.CUResourcePool
+	cuMask     cuMask
+
+	// partitionCUs are the IDs of the CUs that the partitions map to.
+	partitionCUs []int
 
 	nextPartition     int
 	currWGs           []*kernels.WorkGroup
@@ -38,7 +42,8 @@ func (a *partitionAlgorithm) StartNewKernel(info kernels.KernelLaunchInfo) {
 	gb := kernels.NewGridBuilder()
 	gb.SetKernel(info)
 	a.numWG = gb.NumWG()
-	numCU := a.cuPool.NumCU()
+	a.partitionCUs = a.allowedCUs()
+	numCU := len(a.partitionCUs)
 	a.numWGPerPartition = (a.numWG-1)/numCU + 1
 
 	a.partitions = nil
@@ -81,13 +86,14 @@ func (a *partitionAlgorithm) Next() (location dispatchLocation) {
 			continue
 		}
 
-		cu := a.cuPool.GetCU(i)
+		cuID := a.partitionCUs[i]
+		cu := a.cuPool.GetCU(cuID)
 		locations, ok := cu.ReserveResourceForWG(wgToDispatch)
 		if ok {
 			dispatch := dispatchLocation{
 				valid: true,
 				cu:    cu.DispatchingPort(),
-				cuID:  i,
+				cuID:  cuID,
 				wg:    wgToDispatch,
 			}
 
@@ -146,6 +152,25 @@ func (a *partitionAlgorithm) noWGInPartition(partitionIndex int) bool {
 	return false
 }
 
+// SetCUMask limits the CUs that the following kernels can use. The partitions
+// are decided when a kernel starts, so the mask does not affect the kernel
+// that is being dispatched.
+func (a *partitionAlgorithm) SetCUMask(mask []bool) {
+	a.cuMask = makeCUMask(mask, a.cuPool.NumCU())
+}
+
+// allowedCUs returns the IDs of the CUs that the mask allows.
+func (a *partitionAlgorithm) allowedCUs() []int {
+	cus := make([]int, 0, a.cuPool.NumCU())
+	for i := 0; i < a.cuPool.NumCU(); i++ {
+		if a.cuMask.allows(i) {
+			cus = append(cus, i)
+		}
+	}
+
+	return cus
+}
+
 // FreeResources marks the dispatched location to be available.
 func (a *partitionAlgorithm) FreeResources(location dispatchLocation) {
 	a.cuPool.GetCU(location.cuID).FreeResourcesForWG(location.wg)
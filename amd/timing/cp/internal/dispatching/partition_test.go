@@ -53,6 +53,7 @@ var _ = Describe("Partition Algorithm", func() {
 				},
 			},
 			cuPool:            pool,
+			partitionCUs:      []int{0, 1},
 			numWG:             16,
 			numWGPerPartition: 8,
 			currWGs:           make([]*kernels.WorkGroup, 2),
@@ -123,4 +124,31 @@ var _ = Describe("Partition Algorithm", func() {
 		Expect(alg.currWGs[0]).To(BeNil())
 		Expect(alg.numDispatchedWG).To(Equal(1))
 	})
+
+	It("should only partition the CUs in the mask", func() {
+		info := kernels.KernelLaunchInfo{
+			Packet: &kernels.HsaKernelDispatchPacket{
+				GridSizeX:      256,
+				GridSizeY:      1,
+				GridSizeZ:      1,
+				WorkgroupSizeX: 64,
+				WorkgroupSizeY: 1,
+				WorkgroupSizeZ: 1,
+			},
+		}
+
+		alg.SetCUMask([]bool{false, true})
+		alg.StartNewKernel(info)
+
+		Expect(alg.partitions).To(HaveLen(1))
+		Expect(alg.partitionCUs).To(Equal([]int{1}))
+
+		cus[1].EXPECT().ReserveResourceForWG(gomock.Any()).
+			Return([]resource.WfLocation{}, true)
+
+		location := alg.Next()
+
+		Expect(location.valid).To(BeTrue())
+		Expect(location.cuID).To(Equal(1))
+	})
 })
@@ -0,0 +1,238 @@
+package dispatching
+
+import (
+	"log"
+	"sort"
+
+	"github.com/sarchlab/akita/v4/tracing"
+	"github.com/sarchlab/mgpusim/v4/amd/kernels"
+	"github.com/sarchlab/mgpusim/v4/amd/protocol"
+)
+
+// A preemptedWG is a work-group that needs to be dispatched again when the
+// kernel resumes. The state is nil if the work-group has not started.
+type preemptedWG struct {
+	wg    *kernels.WorkGroup
+	state interface{}
+}
+
+// DispatchingKernelID returns the ID of the LaunchKernelReq of the kernel that
+// is being dispatched.
+func (d *DispatcherImpl) DispatchingKernelID() string {
+	if d.dispatching == nil {
+		return ""
+	}
+
+	return d.dispatching.ID
+}
+
+// Preempt stops dispatching the kernel. In the drain mode, the running
+// work-groups complete. In the save-state mode, the running work-groups are
+// saved by the CUs to the context-save area of the request.
+//
+// A cooperative kernel is not preempted, as its work-groups wait for each
+// other at the grid barriers. They can neither complete while the others wait
+// to be dispatched nor continue on other CUs, since the CUs track the
+// work-groups that wait at a grid barrier. The kernel keeps running and the
+// response tells that it is not preempted.
+func (d *DispatcherImpl) Preempt(req *protocol.PreemptKernelReq) bool {
+	if d.dispatching == nil || d.dispatching.ID != req.KernelID {
+		panic("preempting a kernel that is not being dispatched")
+	}
+
+	if d.preemptReq != nil {
+		return false
+	}
+
+	if req.Mode == protocol.PreemptionModeSaveState &&
+		req.ContextSaveAreaSize == 0 &&
+		!d.dispatching.Cooperative {
+		panic("saving the state of a kernel without a context-save area")
+	}
+
+	d.preemptReq = req
+	d.savedByteSize = 0
+	d.contextSaveOffset = 0
+
+	if d.dispatching.Cooperative {
+		return true
+	}
+
+	if d.currWG.valid {
+		d.alg.FreeResources(d.currWG)
+		d.preemptedWGs = append(d.preemptedWGs, preemptedWG{
+			wg:    d.currWG.wg,
+			state: d.currWG.savedState,
+		})
+		d.currWG = dispatchLocation{}
+	}
+
+	return true
+}
+
+// Resume continues dispatching a preempted kernel. The work-groups that are
+// preempted are dispatched before the other work-groups.
+func (d *DispatcherImpl) Resume() bool {
+	if d.preemptReq != nil {
+		return false
+	}
+
+	d.isPreempted = false
+
+	return true
+}
+
+func (d *DispatcherImpl) doPreemption() (madeProgress bool) {
+	if d.dispatching.Cooperative {
+		return d.refusePreemption()
+	}
+
+	if d.preemptReq.Mode == protocol.PreemptionModeSaveState {
+		madeProgress = d.sendSaveWGReq()
+	}
+
+	if len(d.inflightWGs) > 0 {
+		return madeProgress
+	}
+
+	req := d.preemptReq
+	rsp := protocol.NewPreemptKernelRsp(req.Dst, req.Src, req.ID)
+	rsp.Preempted = true
+	rsp.SavedByteSize = d.savedByteSize
+
+	err := d.respondingPort.Send(rsp)
+	if err != nil {
+		return madeProgress
+	}
+
+	d.preemptReq = nil
+	d.isPreempted = true
+	d.saveReqSent = make(map[string]bool)
+
+	tracing.TraceReqComplete(req, d.cp)
+
+	return true
+}
+
+func (d *DispatcherImpl) refusePreemption() bool {
+	req := d.preemptReq
+	rsp := protocol.NewPreemptKernelRsp(req.Dst, req.Src, req.ID)
+
+	err := d.respondingPort.Send(rsp)
+	if err != nil {
+		return false
+	}
+
+	d.preemptReq = nil
+
+	tracing.TraceReqComplete(req, d.cp)
+
+	return true
+}
+
+func (d *DispatcherImpl) sendSaveWGReq() bool {
+	ids := make([]string, 0, len(d.inflightWGs))
+	for id := range d.inflightWGs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		if d.saveReqSent[id] {
+			continue
+		}
+
+		location := d.inflightWGs[id]
+		byteSize := protocol.WGContextByteSize(
+			d.dispatching.HsaCo, d.dispatching.Packet)
+
+		if d.contextSaveOffset+byteSize > d.preemptReq.ContextSaveAreaSize {
+			log.Panicf("the context-save area of %d bytes cannot hold "+
+				"the state of the running work-groups",
+				d.preemptReq.ContextSaveAreaSize)
+		}
+
+		req := protocol.SaveWGReqBuilder{}.
+			WithSrc(d.dispatchingPort.AsRemote()).
+			WithDst(location.cu).
+			WithMapReqID(id).
+			WithAddress(d.preemptReq.ContextSaveArea + d.contextSaveOffset).
+			Build()
+
+		err := d.dispatchingPort.Send(req)
+		if err != nil {
+			return false
+		}
+
+		d.saveReqSent[id] = true
+		d.contextSaveOffset += byteSize
+
+		return true
+	}
+
+	return false
+}
+
+func (d *DispatcherImpl) processSaveWGRsp(rsp *protocol.SaveWGRsp) bool {
+	location, ok := d.inflightWGs[rsp.RspTo]
+	if !ok {
+		return false
+	}
+
+	d.alg.FreeResources(location)
+	delete(d.inflightWGs, rsp.RspTo)
+	d.numDispatchedWGs--
+
+	d.preemptedWGs = append(d.preemptedWGs, preemptedWG{
+		wg:    location.wg,
+		state: rsp.State,
+	})
+	d.savedByteSize += rsp.StateByteSize
+
+	originalReq := d.originalReqs[rsp.RspTo]
+	delete(d.originalReqs, rsp.RspTo)
+	tracing.TraceReqFinalize(originalReq, d)
+
+	d.dispatchingPort.RetrieveIncoming()
+
+	return true
+}
+
+// placePreemptedWG finds a CU that has enough resources for the first
+// preempted work-group. The work-group can go to any CU in the mask, not
+// necessarily the one that it ran on before the preemption.
+func (d *DispatcherImpl) placePreemptedWG() dispatchLocation {
+	p := d.preemptedWGs[0]
+
+	for i := 0; i < d.cuPool.NumCU(); i++ {
+		if !d.cuMask.allows(i) {
+			continue
+		}
+
+		cu := d.cuPool.GetCU(i)
+
+		locations, ok := cu.ReserveResourceForWG(p.wg)
+		if !ok {
+			continue
+		}
+
+		location := dispatchLocation{
+			valid:      true,
+			cu:         cu.DispatchingPort(),
+			cuID:       i,
+			wg:         p.wg,
+			savedState: p.state,
+		}
+		location.locations =
+			make([]protocol.WfDispatchLocation, len(locations))
+		for j, l := range locations {
+			location.locations[j] = protocol.WfDispatchLocation(l)
+		}
+
+		d.preemptedWGs = d.preemptedWGs[1:]
+
+		return location
+	}
+
+	return dispatchLocation{}
+}
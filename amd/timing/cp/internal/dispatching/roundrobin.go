@@ -12,6 +12,7 @@ type roundRobinAlgorithm struct {
 	gridBuilder kernels.GridBuilder
 	cuPool      resource.CUResourcePool
 
+	cuMask           cuMask
 	currWG           *kernels.WorkGroup
 	nextCU           int
 	numDispatchedWGs int
@@ -47,6 +48,10 @@ func (a *roundRobinAlgorithm) Next() (location dispatchLocation) {
 
 	for i := 0; i < a.cuPool.NumCU(); i++ {
 		cuID := (a.nextCU + i) % a.cuPool.NumCU()
+		if !a.cuMask.allows(cuID) {
+			continue
+		}
+
 		cu := a.cuPool.GetCU(cuID)
 
 		locations, ok := cu.ReserveResourceForWG(a.currWG)
@@ -75,6 +80,11 @@ func (a *roundRobinAlgorithm) Next() (location dispatchLocation) {
 	return dispatchLocation{}
 }
 
+// SetCUMask limits the CUs that the following work-groups can use.
+func (a *roundRobinAlgorithm) SetCUMask(mask []bool) {
+	a.cuMask = makeCUMask(mask, a.cuPool.NumCU())
+}
+
 // FreeResources marks the dispatched location to be available.
 func (a *roundRobinAlgorithm) FreeResources(location dispatchLocation) {
 	a.cuPool.GetCU(location.cuID).FreeResourcesForWG(location.wg)
@@ -103,4 +103,36 @@ var _ = Describe("Round Robin Algorithm", func() {
 		Expect(location.valid).To(BeFalse())
 		Expect(alg.numDispatchedWGs).To(Equal(0))
 	})
+
+	It("should skip the CUs that are not in the mask", func() {
+		wg := kernels.NewWorkGroup()
+
+		alg.nextCU = 0
+		alg.SetCUMask([]bool{false, true})
+
+		gridBuilder.EXPECT().NextWG().Return(wg)
+		cus[1].EXPECT().ReserveResourceForWG(wg).
+			Return([]resource.WfLocation{}, true)
+
+		location := alg.Next()
+
+		Expect(location.valid).To(BeTrue())
+		Expect(location.cuID).To(Equal(1))
+	})
+
+	It("should use all the CUs if the mask allows none of them", func() {
+		wg := kernels.NewWorkGroup()
+
+		alg.nextCU = 0
+		alg.SetCUMask([]bool{false, false, true})
+
+		gridBuilder.EXPECT().NextWG().Return(wg)
+		cus[0].EXPECT().ReserveResourceForWG(wg).
+			Return([]resource.WfLocation{}, true)
+
+		location := alg.Next()
+
+		Expect(location.valid).To(BeTrue())
+		Expect(location.cuID).To(Equal(0))
+	})
 })
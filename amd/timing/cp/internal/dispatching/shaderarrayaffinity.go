@@ -0,0 +1,132 @@
+package dispatching
+
+import (
+	"github.com/sarchlab/mgpusim/v4/amd/kernels"
+	"github.com/sarchlab/mgpusim/v4/amd/timing/cp/internal/resource"
+)
+
+// shaderArrayAffinityAlgorithm dispatches runs of neighboring work-groups to
+// the CUs of the same shader array, so that they share the L1 caches of the
+// shader array. Within a shader array, the work-groups go to the CUs in a
+// round robin fashion.
+type shaderArrayAffinityAlgorithm struct {
+	gridBuilder kernels.GridBuilder
+	cuPool      resource.CUResourcePool
+	numCUPerSA  int
+
+	cuMask           cuMask
+	currWG           *kernels.WorkGroup
+	currSA           int
+	numWGInRun       int
+	nextCUInSA       []int
+	numDispatchedWGs int
+}
+
+// RegisterCU allows the shaderArrayAffinityAlgorithm to dispatch work-group to
+// the CU.
+func (a *shaderArrayAffinityAlgorithm) RegisterCU(
+	cu resource.DispatchableCU,
+) {
+	a.cuPool.RegisterCU(cu)
+}
+
+// StartNewKernel lets the algorithms to start dispatching a new kernel.
+func (a *shaderArrayAffinityAlgorithm) StartNewKernel(
+	info kernels.KernelLaunchInfo,
+) {
+	a.numDispatchedWGs = 0
+	a.currSA = 0
+	a.numWGInRun = 0
+	a.gridBuilder.SetKernel(info)
+}
+
+// NumWG returns the number of work-groups in the currently-dispatching
+// work-group.
+func (a *shaderArrayAffinityAlgorithm) NumWG() int {
+	return a.gridBuilder.NumWG()
+}
+
+// HasNext check if there are more work-groups to dispatch.
+func (a *shaderArrayAffinityAlgorithm) HasNext() bool {
+	return a.numDispatchedWGs < a.gridBuilder.NumWG()
+}
+
+// Next finds the location to dispatch the next work-group. The work-group goes
+// to the current shader array. If the current shader array is full, the run
+// moves to the next shader array that has free resources.
+func (a *shaderArrayAffinityAlgorithm) Next() (location dispatchLocation) {
+	if a.currWG == nil {
+		a.currWG = a.gridBuilder.NextWG()
+	}
+
+	numSA := a.numSA()
+	for i := 0; i < numSA; i++ {
+		sa := (a.currSA + i) % numSA
+
+		dispatch, ok := a.dispatchToSA(sa)
+		if !ok {
+			continue
+		}
+
+		if sa != a.currSA {
+			a.currSA = sa
+			a.numWGInRun = 0
+		}
+
+		a.numWGInRun++
+		if a.numWGInRun >= a.numCUPerSA {
+			a.currSA = (sa + 1) % numSA
+			a.numWGInRun = 0
+		}
+
+		a.currWG = nil
+		a.numDispatchedWGs++
+
+		return dispatch
+	}
+
+	return dispatchLocation{}
+}
+
+func (a *shaderArrayAffinityAlgorithm) numSA() int {
+	return (a.cuPool.NumCU() + a.numCUPerSA - 1) / a.numCUPerSA
+}
+
+func (a *shaderArrayAffinityAlgorithm) dispatchToSA(
+	sa int,
+) (dispatchLocation, bool) {
+	for len(a.nextCUInSA) <= sa {
+		a.nextCUInSA = append(a.nextCUInSA, 0)
+	}
+
+	firstCU := sa * a.numCUPerSA
+	numCU := min(a.numCUPerSA, a.cuPool.NumCU()-firstCU)
+
+	for i := 0; i < numCU; i++ {
+		offset := (a.nextCUInSA[sa] + i) % numCU
+		cuID := firstCU + offset
+		if !a.cuMask.allows(cuID) {
+			continue
+		}
+
+		dispatch, ok := reserveOnCU(a.cuPool.GetCU(cuID), cuID, a.currWG)
+		if ok {
+			a.nextCUInSA[sa] = (offset + 1) % numCU
+			return dispatch, true
+		}
+	}
+
+	return dispatchLocation{}, false
+}
+
+// SetCUMask limits the CUs that the following work-groups can use.
+func (a *shaderArrayAffinityAlgorithm) SetCUMask(mask []bool) {
+	a.cuMask = makeCUMask(mask, a.cuPool.NumCU())
+}
+
+// FreeResources marks the dispatched location to be available.
+func (a *shaderArrayAffinityAlgorithm) FreeResources(
+	location dispatchLocation,
+) {
+	a.cuPool.GetCU(location.cuID).FreeResourcesForWG(location.wg)
+}
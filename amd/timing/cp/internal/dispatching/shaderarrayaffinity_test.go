@@ -0,0 +1,122 @@
+package dispatching
+
+import (
+	"strconv"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sarchlab/akita/v4/sim"
+	"github.com/sarchlab/mgpusim/v4/amd/kernels"
+	"github.com/sarchlab/mgpusim/v4/amd/timing/cp/internal/resource"
+	"go.uber.org/mock/gomock"
+)
+
+var _ = Describe("Shader Array Affinity Algorithm", func() {
+	var (
+		ctrl        *gomock.Controller
+		gridBuilder *MockGridBuilder
+		pool        *MockCUResourcePool
+		cus         []*MockCUResource
+		alg         *shaderArrayAffinityAlgorithm
+	)
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		gridBuilder = NewMockGridBuilder(ctrl)
+
+		cus = make([]*MockCUResource, 4)
+		for i := 0; i < 4; i++ {
+			cus[i] = NewMockCUResource(ctrl)
+			cus[i].EXPECT().DispatchingPort().
+				Return(sim.RemotePort("CUPort" + strconv.Itoa(i))).
+				AnyTimes()
+		}
+
+		pool = NewMockCUResourcePool(ctrl)
+		pool.EXPECT().NumCU().Return(len(cus)).AnyTimes()
+		pool.EXPECT().
+			GetCU(gomock.Any()).
+			DoAndReturn(func(i int) resource.CUResource {
+				return cus[i]
+			}).
+			AnyTimes()
+
+		alg = &shaderArrayAffinityAlgorithm{
+			gridBuilder: gridBuilder,
+			cuPool:      pool,
+			numCUPerSA:  2,
+		}
+	})
+
+	AfterEach(func() {
+		ctrl.Finish()
+	})
+
+	It("should keep neighboring work-groups in the same shader array", func() {
+		cuIDs := make([]int, 0, 4)
+		for i := 0; i < 4; i++ {
+			wg := kernels.NewWorkGroup()
+			gridBuilder.EXPECT().NextWG().Return(wg)
+			cus[i].EXPECT().ReserveResourceForWG(wg).
+				Return([]resource.WfLocation{}, true)
+
+			location := alg.Next()
+
+			Expect(location.valid).To(BeTrue())
+			cuIDs = append(cuIDs, location.cuID)
+		}
+
+		Expect(cuIDs).To(Equal([]int{0, 1, 2, 3}))
+		Expect(alg.numDispatchedWGs).To(Equal(4))
+	})
+
+	It("should move to the next shader array if the current one is full",
+		func() {
+			wg := kernels.NewWorkGroup()
+
+			gridBuilder.EXPECT().NextWG().Return(wg)
+			cus[0].EXPECT().ReserveResourceForWG(wg).
+				Return([]resource.WfLocation{}, false)
+			cus[1].EXPECT().ReserveResourceForWG(wg).
+				Return([]resource.WfLocation{}, false)
+			cus[2].EXPECT().ReserveResourceForWG(wg).
+				Return([]resource.WfLocation{}, true)
+
+			location := alg.Next()
+
+			Expect(location.valid).To(BeTrue())
+			Expect(location.cuID).To(Equal(2))
+			Expect(alg.currSA).To(Equal(1))
+			Expect(alg.numWGInRun).To(Equal(1))
+		})
+
+	It("should return invalid location if dispatch is not possible", func() {
+		wg := kernels.NewWorkGroup()
+
+		gridBuilder.EXPECT().NextWG().Return(wg)
+		for _, cu := range cus {
+			cu.EXPECT().ReserveResourceForWG(wg).
+				Return([]resource.WfLocation{}, false)
+		}
+
+		location := alg.Next()
+
+		Expect(location.valid).To(BeFalse())
+		Expect(alg.numDispatchedWGs).To(Equal(0))
+	})
+
+	It("should skip the CUs that are not in the mask", func() {
+		wg := kernels.NewWorkGroup()
+
+		alg.SetCUMask([]bool{false, false, false, true})
+
+		gridBuilder.EXPECT().NextWG().Return(wg)
+		cus[3].EXPECT().ReserveResourceForWG(wg).
+			Return([]resource.WfLocation{}, true)
+
+		location := alg.Next()
+
+		Expect(location.valid).To(BeTrue())
+		Expect(location.cuID).To(Equal(3))
+	})
+})
@@ -0,0 +1,127 @@
+package dispatching
+
+import (
+	"github.com/sarchlab/mgpusim/v4/amd/kernels"
+	"github.com/sarchlab/mgpusim/v4/amd/timing/cp/internal/resource"
+)
+
+// throttlingAlgorithm dispatches work-groups to CUs in a round robin fashion,
+// but caps the number of work-groups that run on each CU. When a work-group
+// completes, the cap of its CU is lowered if the L1 vector cache of the CU
+// misses too often and is raised if the cache mostly hits.
+type throttlingAlgorithm struct {
+	gridBuilder kernels.GridBuilder
+	cuPool      resource.CUResourcePool
+	feedback    CacheMissFeedback
+
+	maxWGsPerCU  int
+	minWGsPerCU  int
+	highMissRate float64
+	lowMissRate  float64
+
+	cuMask           cuMask
+	currWG           *kernels.WorkGroup
+	nextCU           int
+	numDispatchedWGs int
+	wgCaps           []int
+	numWGsOnCU       []int
+}
+
+// RegisterCU allows the throttlingAlgorithm to dispatch work-group to the CU.
+func (a *throttlingAlgorithm) RegisterCU(cu resource.DispatchableCU) {
+	a.cuPool.RegisterCU(cu)
+}
+
+// StartNewKernel lets the algorithms to start dispatching a new kernel.
+func (a *throttlingAlgorithm) StartNewKernel(info kernels.KernelLaunchInfo) {
+	a.numDispatchedWGs = 0
+	a.gridBuilder.SetKernel(info)
+}
+
+// NumWG returns the number of work-groups in the currently-dispatching
+// work-group.
+func (a *throttlingAlgorithm) NumWG() int {
+	return a.gridBuilder.NumWG()
+}
+
+// HasNext check if there are more work-groups to dispatch.
+func (a *throttlingAlgorithm) HasNext() bool {
+	return a.numDispatchedWGs < a.gridBuilder.NumWG()
+}
+
+// Next finds the location to dispatch the next work-group. The CUs that have
+// reached their caps are skipped.
+func (a *throttlingAlgorithm) Next() (location dispatchLocation) {
+	if a.currWG == nil {
+		a.currWG = a.gridBuilder.NextWG()
+	}
+
+	numCU := a.cuPool.NumCU()
+	a.growCUStates(numCU)
+
+	for i := 0; i < numCU; i++ {
+		cuID := (a.nextCU + i) % numCU
+		if !a.cuMask.allows(cuID) || a.numWGsOnCU[cuID] >= a.wgCaps[cuID] {
+			continue
+		}
+
+		dispatch, ok := reserveOnCU(a.cuPool.GetCU(cuID), cuID, a.currWG)
+		if !ok {
+			continue
+		}
+
+		a.nextCU = (cuID + 1) % numCU
+		a.numWGsOnCU[cuID]++
+		a.currWG = nil
+		a.numDispatchedWGs++
+
+		return dispatch
+	}
+
+	return dispatchLocation{}
+}
+
+func (a *throttlingAlgorithm) growCUStates(numCU int) {
+	for len(a.wgCaps) < numCU {
+		a.wgCaps = append(a.wgCaps, a.maxWGsPerCU)
+		a.numWGsOnCU = append(a.numWGsOnCU, 0)
+	}
+}
+
+// SetCUMask limits the CUs that the following work-groups can use.
+func (a *throttlingAlgorithm) SetCUMask(mask []bool) {
+	a.cuMask = makeCUMask(mask, a.cuPool.NumCU())
+}
+
+// FreeResources marks the dispatched location to be available and adjusts
+// the cap of the CU according to the cache miss rate of the CU.
+func (a *throttlingAlgorithm) FreeResources(location dispatchLocation) {
+	a.cuPool.GetCU(location.cuID).FreeResourcesForWG(location.wg)
+
+	cuID := location.cuID
+	a.growCUStates(cuID + 1)
+
+	if a.numWGsOnCU[cuID] > 0 {
+		a.numWGsOnCU[cuID]--
+	}
+
+	a.adjustCap(cuID)
+}
+
+func (a *throttlingAlgorithm) adjustCap(cuID int) {
+	if a.feedback == nil {
+		return
+	}
+
+	rate, ok := a.feedback.MissRate(cuID)
+	if !ok {
+		return
+	}
+
+	switch {
+	case rate > a.highMissRate && a.wgCaps[cuID] > a.minWGsPerCU:
+		a.wgCaps[cuID]--
+	case rate < a.lowMissRate && a.wgCaps[cuID] < a.maxWGsPerCU:
+		a.wgCaps[cuID]++
+	}
+}
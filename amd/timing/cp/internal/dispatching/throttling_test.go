@@ -0,0 +1,161 @@
+package dispatching
+
+import (
+	"strconv"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sarchlab/akita/v4/sim"
+	"github.com/sarchlab/mgpusim/v4/amd/kernels"
+	"github.com/sarchlab/mgpusim/v4/amd/timing/cp/internal/resource"
+	"go.uber.org/mock/gomock"
+)
+
+var _ = Describe("Throttling Algorithm", func() {
+	var (
+		ctrl        *gomock.Controller
+		gridBuilder *MockGridBuilder
+		pool        *MockCUResourcePool
+		cus         []*MockCUResource
+		feedback    *MockCacheMissFeedback
+		alg         *throttlingAlgorithm
+	)
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		gridBuilder = NewMockGridBuilder(ctrl)
+		feedback = NewMockCacheMissFeedback(ctrl)
+
+		cus = make([]*MockCUResource, 2)
+		for i := 0; i < 2; i++ {
+			cus[i] = NewMockCUResource(ctrl)
+			cus[i].EXPECT().DispatchingPort().
+				Return(sim.RemotePort("CUPort" + strconv.Itoa(i))).
+				AnyTimes()
+		}
+
+		pool = NewMockCUResourcePool(ctrl)
+		pool.EXPECT().NumCU().Return(len(cus)).AnyTimes()
+		pool.EXPECT().
+			GetCU(gomock.Any()).
+			DoAndReturn(func(i int) resource.CUResource {
+				return cus[i]
+			}).
+			AnyTimes()
+
+		alg = &throttlingAlgorithm{
+			gridBuilder:  gridBuilder,
+			cuPool:       pool,
+			feedback:     feedback,
+			maxWGsPerCU:  2,
+			minWGsPerCU:  1,
+			highMissRate: 0.5,
+			lowMissRate:  0.2,
+		}
+	})
+
+	AfterEach(func() {
+		ctrl.Finish()
+	})
+
+	It("should dispatch next wg", func() {
+		wg := kernels.NewWorkGroup()
+
+		gridBuilder.EXPECT().NextWG().Return(wg)
+		cus[0].EXPECT().ReserveResourceForWG(wg).
+			Return([]resource.WfLocation{}, true)
+
+		location := alg.Next()
+
+		Expect(location.valid).To(BeTrue())
+		Expect(location.cuID).To(Equal(0))
+		Expect(alg.numWGsOnCU).To(Equal([]int{1, 0}))
+		Expect(alg.numDispatchedWGs).To(Equal(1))
+	})
+
+	It("should skip the CUs that reach their caps", func() {
+		wg := kernels.NewWorkGroup()
+
+		alg.wgCaps = []int{1, 2}
+		alg.numWGsOnCU = []int{1, 0}
+
+		gridBuilder.EXPECT().NextWG().Return(wg)
+		cus[1].EXPECT().ReserveResourceForWG(wg).
+			Return([]resource.WfLocation{}, true)
+
+		location := alg.Next()
+
+		Expect(location.valid).To(BeTrue())
+		Expect(location.cuID).To(Equal(1))
+	})
+
+	It("should return invalid location if all CUs reach their caps", func() {
+		wg := kernels.NewWorkGroup()
+
+		alg.wgCaps = []int{1, 1}
+		alg.numWGsOnCU = []int{1, 1}
+
+		gridBuilder.EXPECT().NextWG().Return(wg)
+
+		location := alg.Next()
+
+		Expect(location.valid).To(BeFalse())
+	})
+
+	It("should lower the cap if the cache misses too often", func() {
+		wg := kernels.NewWorkGroup()
+
+		alg.wgCaps = []int{2, 2}
+		alg.numWGsOnCU = []int{2, 0}
+
+		cus[0].EXPECT().FreeResourcesForWG(wg)
+		feedback.EXPECT().MissRate(0).Return(0.8, true)
+
+		alg.FreeResources(dispatchLocation{cuID: 0, wg: wg})
+
+		Expect(alg.wgCaps).To(Equal([]int{1, 2}))
+		Expect(alg.numWGsOnCU).To(Equal([]int{1, 0}))
+	})
+
+	It("should not lower the cap below the minimum", func() {
+		wg := kernels.NewWorkGroup()
+
+		alg.wgCaps = []int{1, 2}
+		alg.numWGsOnCU = []int{1, 0}
+
+		cus[0].EXPECT().FreeResourcesForWG(wg)
+		feedback.EXPECT().MissRate(0).Return(0.8, true)
+
+		alg.FreeResources(dispatchLocation{cuID: 0, wg: wg})
+
+		Expect(alg.wgCaps).To(Equal([]int{1, 2}))
+	})
+
+	It("should raise the cap if the cache mostly hits", func() {
+		wg := kernels.NewWorkGroup()
+
+		alg.wgCaps = []int{1, 2}
+		alg.numWGsOnCU = []int{1, 0}
+
+		cus[0].EXPECT().FreeResourcesForWG(wg)
+		feedback.EXPECT().MissRate(0).Return(0.1, true)
+
+		alg.FreeResources(dispatchLocation{cuID: 0, wg: wg})
+
+		Expect(alg.wgCaps).To(Equal([]int{2, 2}))
+	})
+
+	It("should keep the cap if there is no feedback", func() {
+		wg := kernels.NewWorkGroup()
+
+		alg.wgCaps = []int{1, 2}
+		alg.numWGsOnCU = []int{1, 0}
+
+		cus[0].EXPECT().FreeResourcesForWG(wg)
+		feedback.EXPECT().MissRate(0).Return(0.0, false)
+
+		alg.FreeResources(dispatchLocation{cuID: 0, wg: wg})
+
+		Expect(alg.wgCaps).To(Equal([]int{1, 2}))
+	})
+})
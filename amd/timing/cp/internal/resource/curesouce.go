@@ -13,4 +13,7 @@ type CUResource interface {
 	)
 	FreeResourcesForWG(wg *kernels.WorkGroup)
 	DispatchingPort() sim.RemotePort
+
+	// IsIdle checks if no work-group holds the resources of the CU.
+	IsIdle() bool
 }
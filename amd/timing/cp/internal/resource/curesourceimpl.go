@@ -36,6 +36,11 @@ func (r *CUResourceImpl) DispatchingPort() sim.RemotePort {
 	return r.port
 }
 
+// IsIdle checks if no work-group holds the resources of the CU.
+func (r *CUResourceImpl) IsIdle() bool {
+	return len(r.reservedWGs) == 0
+}
+
 // ReserveResourceForWG checks if there is space to hold the work-group. If so,
 // this function reserves the resouces for the work-group and returns how the
 // resources are allocated.
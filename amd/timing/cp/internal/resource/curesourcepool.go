@@ -32,6 +32,17 @@ type CUResourcePool interface {
 	NumCU() int
 	GetCU(i int) CUResource
 	RegisterCU(cu DispatchableCU)
+
+	// ReserveCoResident reserves the resources for all the work-groups at
+	// the same time, so that the work-groups can run concurrently. The
+	// work-groups are spread over the CUs that the mask allows in a round
+	// robin fashion. A nil mask allows all the CUs. If any of the work-groups
+	// does not fit, nothing is reserved and ok is false.
+	ReserveCoResident(wgs []*kernels.WorkGroup, mask []bool) (
+		cuIDs []int,
+		locations [][]WfLocation,
+		ok bool,
+	)
 }
 
 // CUResourcePoolImpl centralizes the resources of CUs.
@@ -78,6 +89,54 @@ func (p *CUResourcePoolImpl) RegisterCU(cu DispatchableCU) {
 	p.registeredCUs[cu.DispatchingPort()] = true
 }
 
+// ReserveCoResident reserves the resources for all the work-groups at the
+// same time. Nothing is reserved if the work-groups do not fit.
+func (p *CUResourcePoolImpl) ReserveCoResident(
+	wgs []*kernels.WorkGroup,
+	mask []bool,
+) (cuIDs []int, locations [][]WfLocation, ok bool) {
+	cuIDs = make([]int, 0, len(wgs))
+	locations = make([][]WfLocation, 0, len(wgs))
+	nextCU := 0
+
+	for _, wg := range wgs {
+		cuID, wgLocations, found := p.reserveOnAnyCU(wg, mask, nextCU)
+		if !found {
+			for i, id := range cuIDs {
+				p.cus[id].FreeResourcesForWG(wgs[i])
+			}
+
+			return nil, nil, false
+		}
+
+		cuIDs = append(cuIDs, cuID)
+		locations = append(locations, wgLocations)
+		nextCU = (cuID + 1) % len(p.cus)
+	}
+
+	return cuIDs, locations, true
+}
+
+func (p *CUResourcePoolImpl) reserveOnAnyCU(
+	wg *kernels.WorkGroup,
+	mask []bool,
+	firstCU int,
+) (cuID int, locations []WfLocation, ok bool) {
+	for i := 0; i < len(p.cus); i++ {
+		cuID = (firstCU + i) % len(p.cus)
+		if mask != nil && (cuID >= len(mask) || !mask[cuID]) {
+			continue
+		}
+
+		locations, ok = p.cus[cuID].ReserveResourceForWG(wg)
+		if ok {
+			return cuID, locations, true
+		}
+	}
+
+	return 0, nil, false
+}
+
 func (p *CUResourcePoolImpl) createSRegMask(
 	r *CUResourceImpl,
 	u DispatchableCU,
@@ -0,0 +1,80 @@
+package resource
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sarchlab/akita/v4/sim"
+	"github.com/sarchlab/mgpusim/v4/amd/insts"
+	"github.com/sarchlab/mgpusim/v4/amd/kernels"
+)
+
+type smallCU struct {
+	port sim.RemotePort
+}
+
+func (u *smallCU) DispatchingPort() sim.RemotePort { return u.port }
+func (u *smallCU) WfPoolSizes() []int              { return []int{1, 1, 1, 1} }
+func (u *smallCU) VRegCounts() []int               { return []int{256, 256, 256, 256} }
+func (u *smallCU) SRegCount() int                  { return 3200 }
+func (u *smallCU) LDSBytes() int                   { return 64 * 1024 }
+
+var _ = Describe("CUResourcePool", func() {
+	var (
+		pool *CUResourcePoolImpl
+		co   *insts.HsaCo
+	)
+
+	BeforeEach(func() {
+		pool = NewCUResourcePool()
+		pool.RegisterCU(&smallCU{port: "CU0"})
+		pool.RegisterCU(&smallCU{port: "CU1"})
+
+		co = insts.NewHsaCo()
+	})
+
+	makeWGs := func(n int) []*kernels.WorkGroup {
+		wgs := make([]*kernels.WorkGroup, n)
+		for i := range wgs {
+			wgs[i] = kernels.NewWorkGroup()
+			wgs[i].CodeObject = co
+			for j := 0; j < 4; j++ {
+				wgs[i].Wavefronts = append(wgs[i].Wavefronts,
+					kernels.NewWavefront())
+			}
+		}
+
+		return wgs
+	}
+
+	It("should reserve co-resident work-groups", func() {
+		wgs := makeWGs(2)
+
+		cuIDs, locations, ok := pool.ReserveCoResident(wgs, nil)
+
+		Expect(ok).To(BeTrue())
+		Expect(cuIDs).To(Equal([]int{0, 1}))
+		Expect(locations).To(HaveLen(2))
+		Expect(locations[0]).To(HaveLen(4))
+		Expect(pool.GetCU(0).IsIdle()).To(BeFalse())
+		Expect(pool.GetCU(1).IsIdle()).To(BeFalse())
+	})
+
+	It("should only use the CUs in the mask", func() {
+		wgs := makeWGs(2)
+
+		_, _, ok := pool.ReserveCoResident(wgs, []bool{false, true})
+
+		Expect(ok).To(BeFalse())
+		Expect(pool.GetCU(1).IsIdle()).To(BeTrue())
+	})
+
+	It("should not reserve anything if the work-groups do not fit", func() {
+		wgs := makeWGs(3)
+
+		_, _, ok := pool.ReserveCoResident(wgs, nil)
+
+		Expect(ok).To(BeFalse())
+		Expect(pool.GetCU(0).IsIdle()).To(BeTrue())
+		Expect(pool.GetCU(1).IsIdle()).To(BeTrue())
+	})
+})
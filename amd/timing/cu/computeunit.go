@@ -72,6 +72,16 @@ type ComputeUnit struct {
 
 	currentFlushReq   *protocol.CUPipelineFlushReq
 	currentRestartReq *protocol.CUPipelineRestartReq
+
+	savingWGs    []*wgContextSwitch
+	restoringWGs []*wgContextSwitch
+
+	// GridBarrier synchronizes the work-groups of cooperative kernels across
+	// the Compute Units. It is nil if the CU cannot run grid barriers.
+	GridBarrier *GridBarrier
+
+	internalAccesses map[string]*internalMemAccess
+
 	//for sampling
 	wftime map[string]sim.VTimeInSec
 }
@@ -122,6 +132,7 @@ func (cu *ComputeUnit) Tick() bool {
 	madeProgress = cu.sendToCP() || madeProgress
 	madeProgress = cu.processInput() || madeProgress
 	madeProgress = cu.doFlush() || madeProgress
+	madeProgress = cu.doContextSwitch() || madeProgress
 
 	return madeProgress
 }
@@ -266,6 +277,7 @@ func (cu *ComputeUnit) flushPipeline() bool {
 	cu.populateShadowBuffers()
 	cu.setWavesToReady()
 	cu.Scheduler.Flush()
+	cu.flushInternalAccesses()
 	cu.flushInternalComponents()
 	cu.Scheduler.Pause()
 	cu.isPaused = true
@@ -307,6 +319,8 @@ func (cu *ComputeUnit) processInputFromACE() bool {
 	switch req := req.(type) {
 	case *protocol.MapWGReq:
 		return cu.handleMapWGReq(req)
+	case *protocol.SaveWGReq:
+		return cu.handleSaveWGReq(req)
 	default:
 		panic("unknown req type")
 	}
@@ -367,6 +381,15 @@ func (cu *ComputeUnit) handleWfCompletionEvent(
 func (cu *ComputeUnit) handleMapWGReq(
 	req *protocol.MapWGReq,
 ) bool {
+	if req.SavedState != nil {
+		tracing.TraceReqReceive(req, cu)
+		cu.restoreWG(req)
+		cu.running = true
+		cu.TickLater()
+
+		return true
+	}
+
 	now := cu.CurrentTime()
 
 	wg := cu.wrapWG(req.WorkGroup, req)
@@ -572,6 +595,10 @@ func (cu *ComputeUnit) processInputFromVectorMem() bool {
 		return false
 	}
 
+	if cu.handleInternalAccessRsp(rsp) {
+		return true
+	}
+
 	switch rsp := rsp.(type) {
 	case *mem.DataReadyRsp:
 		cu.handleVectorDataLoadReturn(rsp)
@@ -666,6 +693,62 @@ func (cu *ComputeUnit) handleVectorDataStoreRsp(
 	}
 }
 
+// sendInternalAccess sends a memory access that the CU makes on its own
+// through the vector memory port.
+func (cu *ComputeUnit) sendInternalAccess(access *internalMemAccess) bool {
+	req := access.req
+	meta := req.Meta()
+	meta.ID = sim.GetIDGenerator().Generate()
+	meta.Src = cu.ToVectorMem.AsRemote()
+	meta.Dst = cu.VectorMemModules.Find(req.GetAddress())
+
+	err := cu.ToVectorMem.Send(req)
+	if err != nil {
+		return false
+	}
+
+	access.sent = true
+	access.sentAt = cu.CurrentTime()
+	cu.internalAccesses[meta.ID] = access
+
+	tracing.TraceReqInitiate(req, cu, access.taskID)
+
+	return true
+}
+
+func (cu *ComputeUnit) handleInternalAccessRsp(rsp sim.Msg) bool {
+	accessRsp, ok := rsp.(mem.AccessRsp)
+	if !ok {
+		return false
+	}
+
+	access, found := cu.internalAccesses[accessRsp.GetRspTo()]
+	if !found {
+		return false
+	}
+
+	delete(cu.internalAccesses, accessRsp.GetRspTo())
+	access.done = true
+
+	if dataReady, ok := rsp.(*mem.DataReadyRsp); ok {
+		access.data = dataReady.Data
+	}
+
+	tracing.TraceReqFinalize(access.req, cu)
+
+	return true
+}
+
+// flushInternalAccesses drops the internal accesses in flight, as the flush
+// discards them. Their owners send them again after the pipeline restarts.
+func (cu *ComputeUnit) flushInternalAccesses() {
+	for _, access := range cu.internalAccesses {
+		access.sent = false
+	}
+
+	cu.internalAccesses = make(map[string]*internalMemAccess)
+}
+
 // UpdatePCAndSetReady is self explained
 func (cu *ComputeUnit) UpdatePCAndSetReady(wf *wavefront.Wavefront) {
 	wf.State = wavefront.WfReady
@@ -874,6 +957,8 @@ func NewComputeUnit(
 	cu.TickingComponent = sim.NewTickingComponent(
 		name, engine, 1*sim.GHz, cu)
 
+	cu.internalAccesses = make(map[string]*internalMemAccess)
+
 	cu.ToACE = sim.NewPort(cu, 4, 4, name+".ToACE")
 	cu.ToInstMem = sim.NewPort(cu, 4, 4, name+".ToInstMem")
 	cu.ToScalarMem = sim.NewPort(cu, 4, 4, name+".ToScalarMem")
@@ -20,6 +20,8 @@ type Builder struct {
 	sgprCount         int
 	log2CachelineSize uint64
 
+	gridBarrier *GridBarrier
+
 	decoder            emu.Decoder
 	scratchpadPreparer ScratchpadPreparer
 	alu                emu.ALU
@@ -80,6 +82,13 @@ func (b Builder) WithLog2CachelineSize(n uint64) Builder {
 	return b
 }
 
+// WithGridBarrier sets the grid barrier that the Compute Unit shares with the
+// other Compute Units of the GPU.
+func (b Builder) WithGridBarrier(gridBarrier *GridBarrier) Builder {
+	b.gridBarrier = gridBarrier
+	return b
+}
+
 // WithVisTracer adds a tracer to the builder.
 func (b Builder) WithVisTracer(t tracing.Tracer) Builder {
 	b.enableVisTracing = true
@@ -96,6 +105,7 @@ func (b *Builder) Build(name string) *ComputeUnit {
 	cu.Decoder = insts.NewDisassembler()
 	cu.WfDispatcher = NewWfDispatcher(cu)
 	cu.InFlightVectorMemAccessLimit = 512
+	cu.GridBarrier = b.gridBarrier
 
 	b.alu = emu.NewALU(nil)
 	b.scratchpadPreparer = NewScratchpadPreparerImpl(cu)
@@ -3,6 +3,7 @@ package cu
 import (
 	"github.com/sarchlab/akita/v4/mem/mem"
 	"github.com/sarchlab/mgpusim/v4/amd/insts"
+	"github.com/sarchlab/mgpusim/v4/amd/protocol"
 	"github.com/sarchlab/mgpusim/v4/amd/timing/wavefront"
 )
 
@@ -15,16 +16,34 @@ func (c defaultCoalescer) generateMemTransactions(
 ) []VectorMemAccessInfo {
 	c.mustBeAFlatLoadOrStore(wf)
 	var transactions []VectorMemAccessInfo
+	info := c.accessInfo(wf.Inst())
 	if c.isLoadInst(wf.Inst()) {
 		reqs := c.generateReadReqs(wf)
+		for _, req := range reqs {
+			req.Info = info
+		}
 		transactions = c.generateReadTransactions(wf, reqs)
 	} else {
 		reqs := c.generateWriteReqs(wf)
+		for _, req := range reqs {
+			req.Info = info
+		}
 		transactions = c.generateWriteTransactions(wf, reqs)
 	}
 	return transactions
 }
 
+// accessInfo returns the PC and the cache-control hint of the instruction.
+func (c defaultCoalescer) accessInfo(inst *insts.Inst) protocol.AccessInfo {
+	return protocol.AccessInfo{
+		PC: inst.PC,
+		Policy: protocol.CachePolicy{
+			GLC: inst.GlobalLevelCoherent,
+			SLC: inst.SystemLevelCoherent,
+		},
+	}
+}
+
 func (c defaultCoalescer) mustBeAFlatLoadOrStore(
 	wf *wavefront.Wavefront,
 ) {
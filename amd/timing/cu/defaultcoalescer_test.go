@@ -4,6 +4,7 @@ import (
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"github.com/sarchlab/mgpusim/v4/amd/insts"
+	"github.com/sarchlab/mgpusim/v4/amd/protocol"
 	"github.com/sarchlab/mgpusim/v4/amd/timing/wavefront"
 )
 
@@ -101,4 +102,27 @@ var _ = Describe("Default Coalescer", func() {
 
 		Expect(memTransactions).To(HaveLen(4))
 	})
+
+	It("should carry the PC and the cache-control bits on the requests", func() {
+		inst := insts.NewInst()
+		inst.FormatType = insts.FLAT
+		inst.Opcode = 20 // flat_load_dword
+		inst.Dst = insts.NewRegOperand(0, 0, 1)
+		inst.GlobalLevelCoherent = true
+		inst.PC = 0x40
+		wf.SetDynamicInst(wavefront.NewInst(inst))
+
+		sp := wf.Scratchpad().AsFlat()
+		sp.EXEC = 0x1
+		sp.ADDR[0] = 0x1000
+
+		memTransactions := c.generateMemTransactions(wf)
+
+		Expect(memTransactions).To(HaveLen(1))
+		Expect(protocol.AccessInfoOf(memTransactions[0].Read)).
+			To(Equal(protocol.AccessInfo{
+				PC:     0x40,
+				Policy: protocol.CachePolicy{GLC: true},
+			}))
+	})
 })
@@ -44,7 +44,7 @@ func (a *FetchArbiter) Arbitrate(
 }
 
 func (a *FetchArbiter) canFetchFromWF(wf *wavefront.Wavefront) bool {
-	if wf.IsFetching {
+	if wf.IsFetching || wf.IsPreempting {
 		return false
 	}
 
@@ -0,0 +1,181 @@
+package cu
+
+import (
+	"sync"
+
+	"github.com/sarchlab/akita/v4/sim"
+	"github.com/sarchlab/mgpusim/v4/amd/kernels"
+)
+
+// gridBarrierCounterOffset is the offset of the arrival counter of a grid
+// barrier in the dispatch packet of the kernel. The counter uses the reserved
+// 8 bytes before the completion signal, which the driver writes as zeros.
+const gridBarrierCounterOffset = 48
+
+// A GridBarrier synchronizes all the work-groups of a cooperative kernel
+// across the Compute Units of a GPU. Kernels reach the barrier with the
+// ds_gws_barrier instruction.
+//
+// The barrier follows the software grid barrier of cooperative groups. Each
+// work-group increments an arrival counter in global memory and then polls
+// the counter until all the work-groups arrive. The increments and the polls
+// are sent through the vector memory port of the Compute Unit, so they
+// contend with the other memory accesses and show up in the cache and DRAM
+// statistics.
+//
+// The memory hierarchy has no atomic requests, so an increment is a write of
+// the value that the increment would produce. The GridBarrier hands out the
+// values in the order that the work-groups arrive, and it tells the
+// work-groups when the last increment has reached the memory. A poll that is
+// sent after that releases the work-group. The work-group whose increment is
+// the last passes without polling, as its atomic would have returned the
+// final count.
+type GridBarrier struct {
+	sync.Mutex
+
+	// PollInterval is the number of cycles between two reads of the arrival
+	// counter by a waiting work-group.
+	PollInterval int
+
+	grids map[*kernels.HsaKernelDispatchPacket]*gridBarrierState
+}
+
+type gridBarrierState struct {
+	numWGs     int
+	numArrived int
+	generation int
+	numWritten map[int]int
+	releases   map[int]*gridBarrierRelease
+}
+
+type gridBarrierRelease struct {
+	time      sim.VTimeInSec
+	numToPass int
+}
+
+// NewGridBarrier creates a grid barrier.
+func NewGridBarrier() *GridBarrier {
+	return &GridBarrier{
+		PollInterval: 64,
+		grids: make(
+			map[*kernels.HsaKernelDispatchPacket]*gridBarrierState),
+	}
+}
+
+// Arrive records that a work-group reaches the barrier. It returns the
+// generation of the barrier, which counts the barriers that the grid has
+// passed, and the value that the work-group writes to the arrival counter.
+func (b *GridBarrier) Arrive(
+	wg *kernels.WorkGroup,
+) (generation int, count uint32) {
+	b.Lock()
+	defer b.Unlock()
+
+	state := b.gridState(wg)
+
+	generation = state.generation
+	state.numArrived++
+	count = uint32(generation*state.numWGs + state.numArrived)
+
+	if state.numArrived == state.numWGs {
+		state.generation++
+		state.numArrived = 0
+	}
+
+	return generation, count
+}
+
+// CounterWritten records that the increment of a work-group has reached the
+// memory. It returns true if the increment is the last one of the
+// generation, which releases all the work-groups.
+func (b *GridBarrier) CounterWritten(
+	wg *kernels.WorkGroup,
+	generation int,
+	now sim.VTimeInSec,
+) bool {
+	b.Lock()
+	defer b.Unlock()
+
+	state := b.grids[wg.Packet]
+
+	state.numWritten[generation]++
+	if state.numWritten[generation] < state.numWGs {
+		return false
+	}
+
+	delete(state.numWritten, generation)
+	state.releases[generation] = &gridBarrierRelease{
+		time:      now,
+		numToPass: state.numWGs,
+	}
+
+	return true
+}
+
+// ReleaseTime returns the time that the last increment of the given
+// generation reached the memory. It returns false if some increments have not
+// reached the memory.
+func (b *GridBarrier) ReleaseTime(
+	wg *kernels.WorkGroup,
+	generation int,
+) (sim.VTimeInSec, bool) {
+	b.Lock()
+	defer b.Unlock()
+
+	state, ok := b.grids[wg.Packet]
+	if !ok {
+		return 0, false
+	}
+
+	release, ok := state.releases[generation]
+	if !ok {
+		return 0, false
+	}
+
+	return release.time, true
+}
+
+// Pass records that a work-group passes the barrier of the given generation.
+func (b *GridBarrier) Pass(wg *kernels.WorkGroup, generation int) {
+	b.Lock()
+	defer b.Unlock()
+
+	state := b.grids[wg.Packet]
+	release := state.releases[generation]
+
+	release.numToPass--
+	if release.numToPass > 0 {
+		return
+	}
+
+	delete(state.releases, generation)
+
+	if len(state.releases) == 0 && len(state.numWritten) == 0 &&
+		state.numArrived == 0 {
+		delete(b.grids, wg.Packet)
+	}
+}
+
+func (b *GridBarrier) gridState(wg *kernels.WorkGroup) *gridBarrierState {
+	state, ok := b.grids[wg.Packet]
+	if ok {
+		return state
+	}
+
+	state = &gridBarrierState{
+		numWGs:     numWGsInGrid(wg.Packet),
+		numWritten: make(map[int]int),
+		releases:   make(map[int]*gridBarrierRelease),
+	}
+	b.grids[wg.Packet] = state
+
+	return state
+}
+
+func numWGsInGrid(p *kernels.HsaKernelDispatchPacket) int {
+	numWGX := (int(p.GridSizeX)-1)/int(p.WorkgroupSizeX) + 1
+	numWGY := (int(p.GridSizeY)-1)/int(p.WorkgroupSizeY) + 1
+	numWGZ := (int(p.GridSizeZ)-1)/int(p.WorkgroupSizeZ) + 1
+
+	return numWGX * numWGY * numWGZ
+}
@@ -0,0 +1,95 @@
+package cu
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sarchlab/akita/v4/sim"
+	"github.com/sarchlab/mgpusim/v4/amd/kernels"
+)
+
+var _ = Describe("Grid Barrier", func() {
+	var (
+		barrier *GridBarrier
+		wgs     []*kernels.WorkGroup
+	)
+
+	BeforeEach(func() {
+		barrier = NewGridBarrier()
+
+		packet := &kernels.HsaKernelDispatchPacket{
+			GridSizeX:      128,
+			GridSizeY:      1,
+			GridSizeZ:      1,
+			WorkgroupSizeX: 64,
+			WorkgroupSizeY: 1,
+			WorkgroupSizeZ: 1,
+		}
+		for i := 0; i < 2; i++ {
+			wg := kernels.NewWorkGroup()
+			wg.Packet = packet
+			wgs = append(wgs, wg)
+		}
+	})
+
+	AfterEach(func() {
+		wgs = nil
+	})
+
+	It("should hand out the counts in the arrival order", func() {
+		generation0, count0 := barrier.Arrive(wgs[1])
+		generation1, count1 := barrier.Arrive(wgs[0])
+
+		Expect(generation0).To(Equal(0))
+		Expect(count0).To(Equal(uint32(1)))
+		Expect(generation1).To(Equal(0))
+		Expect(count1).To(Equal(uint32(2)))
+	})
+
+	It("should wait for all the increments to be written", func() {
+		barrier.Arrive(wgs[0])
+		barrier.Arrive(wgs[1])
+
+		Expect(barrier.CounterWritten(wgs[0], 0, 10)).To(BeFalse())
+
+		_, released := barrier.ReleaseTime(wgs[0], 0)
+		Expect(released).To(BeFalse())
+	})
+
+	It("should release after the last increment is written", func() {
+		barrier.Arrive(wgs[0])
+		barrier.Arrive(wgs[1])
+		barrier.CounterWritten(wgs[1], 0, 10)
+
+		Expect(barrier.CounterWritten(wgs[0], 0, 20)).To(BeTrue())
+
+		releaseTime, released := barrier.ReleaseTime(wgs[1], 0)
+		Expect(released).To(BeTrue())
+		Expect(releaseTime).To(Equal(sim.VTimeInSec(20)))
+	})
+
+	It("should start a new generation", func() {
+		barrier.Arrive(wgs[0])
+		barrier.Arrive(wgs[1])
+		barrier.CounterWritten(wgs[0], 0, 10)
+		barrier.CounterWritten(wgs[1], 0, 10)
+		barrier.Pass(wgs[0], 0)
+
+		generation, count := barrier.Arrive(wgs[0])
+
+		Expect(generation).To(Equal(1))
+		Expect(count).To(Equal(uint32(3)))
+		_, released := barrier.ReleaseTime(wgs[1], 0)
+		Expect(released).To(BeTrue())
+	})
+
+	It("should forget the grid after all the work-groups pass", func() {
+		barrier.Arrive(wgs[0])
+		barrier.Arrive(wgs[1])
+		barrier.CounterWritten(wgs[0], 0, 10)
+		barrier.CounterWritten(wgs[1], 0, 10)
+		barrier.Pass(wgs[0], 0)
+		barrier.Pass(wgs[1], 0)
+
+		Expect(barrier.grids).To(BeEmpty())
+	})
+})
@@ -34,6 +34,10 @@ func (a *IssueArbiter) Arbitrate(
 				continue
 			}
 
+			if wf.IsPreempting {
+				continue
+			}
+
 			if typeMask[wf.InstToIssue.ExeUnit] == false {
 				wfToIssue = append(wfToIssue, wf)
 				typeMask[wf.InstToIssue.ExeUnit] = true
@@ -2,6 +2,7 @@ package cu
 
 import (
 	"github.com/sarchlab/akita/v4/mem/mem"
+	"github.com/sarchlab/akita/v4/sim"
 	"github.com/sarchlab/mgpusim/v4/amd/insts"
 	"github.com/sarchlab/mgpusim/v4/amd/timing/wavefront"
 )
@@ -42,3 +43,17 @@ type ScalarMemAccessInfo struct {
 	DstSGPR   *insts.Reg
 	Inst      *wavefront.Inst
 }
+
+// internalMemAccess is a memory access that the CU makes on its own rather
+// than for the lanes of an instruction, such as a read or a write of the
+// arrival counter of a grid barrier or of a context-save area.
+type internalMemAccess struct {
+	req    mem.AccessReq
+	taskID string
+	sent   bool
+	sentAt sim.VTimeInSec
+	done   bool
+
+	// data is the data that a read returns.
+	data []byte
+}
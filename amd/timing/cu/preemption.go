@@ -0,0 +1,475 @@
+package cu
+
+import (
+	"github.com/sarchlab/akita/v4/mem/mem"
+	"github.com/sarchlab/akita/v4/tracing"
+	"github.com/sarchlab/mgpusim/v4/amd/insts"
+	"github.com/sarchlab/mgpusim/v4/amd/protocol"
+	"github.com/sarchlab/mgpusim/v4/amd/timing/wavefront"
+)
+
+// contextAccessByteSize is the number of bytes of a read or a write of a
+// context-save area, which is a cache line.
+const contextAccessByteSize = 64
+
+// A savedWf is the state of a wavefront that is preempted.
+type savedWf struct {
+	state wavefront.WfState
+}
+
+// A savedWG is a work-group that is preempted. The VGPRs, SGPRs, and LDS are
+// in the context-save area at the address, laid out as
+// protocol.WGContextByteSize describes.
+type savedWG struct {
+	wg      *wavefront.WorkGroup
+	wfs     []savedWf
+	address uint64
+}
+
+// A contextSegment is a part of a context-save area that holds the registers
+// of a wavefront or, if wf is nil, the LDS of the work-group.
+type contextSegment struct {
+	wf       *wavefront.Wavefront
+	address  uint64
+	byteSize int
+	accesses []*internalMemAccess
+}
+
+// A wgContextSwitch is a work-group whose state is being written to or read
+// from a context-save area.
+type wgContextSwitch struct {
+	saveReq  *protocol.SaveWGReq
+	wg       *wavefront.WorkGroup
+	saved    *savedWG
+	segments []*contextSegment
+	byteSize uint64
+}
+
+func (cu *ComputeUnit) handleSaveWGReq(req *protocol.SaveWGReq) bool {
+	wg := cu.findWGByMapReqID(req.MapReqID)
+	if wg == nil {
+		// The work-group has completed. The dispatcher learns about it from
+		// the WGCompletionMsg.
+		return true
+	}
+
+	for _, wf := range wg.Wfs {
+		wf.IsPreempting = true
+	}
+
+	cu.savingWGs = append(cu.savingWGs, &wgContextSwitch{
+		saveReq: req,
+		wg:      wg,
+	})
+
+	return true
+}
+
+func (cu *ComputeUnit) findWGByMapReqID(id string) *wavefront.WorkGroup {
+	for _, wfPool := range cu.WfPools {
+		for _, wf := range wfPool.wfs {
+			if wf.WG.MapReq.ID == id {
+				return wf.WG
+			}
+		}
+	}
+
+	return nil
+}
+
+func (cu *ComputeUnit) doContextSwitch() bool {
+	madeProgress := false
+
+	madeProgress = cu.saveWGs() || madeProgress
+	madeProgress = cu.restoreWGs() || madeProgress
+
+	return madeProgress
+}
+
+func (cu *ComputeUnit) saveWGs() bool {
+	madeProgress := false
+
+	stillSaving := cu.savingWGs[:0]
+	for _, s := range cu.savingWGs {
+		done, progress := cu.saveWG(s)
+		madeProgress = progress || madeProgress
+
+		if !done {
+			stillSaving = append(stillSaving, s)
+		}
+	}
+	cu.savingWGs = stillSaving
+
+	return madeProgress
+}
+
+// saveWG writes the state of the work-group to the context-save area once the
+// work-group stops. The CU releases the work-group right away and responds to
+// the dispatcher when all the writes complete.
+func (cu *ComputeUnit) saveWG(s *wgContextSwitch) (done, madeProgress bool) {
+	if s.saved == nil {
+		if cu.findWGByMapReqID(s.saveReq.MapReqID) == nil {
+			return true, true
+		}
+
+		if !cu.canSaveWG(s.wg) {
+			return false, false
+		}
+
+		cu.startSavingWG(s)
+
+		return false, true
+	}
+
+	madeProgress = cu.sendContextAccesses(s)
+	if !isContextTransferred(s) {
+		return false, madeProgress
+	}
+
+	rsp := protocol.SaveWGRspBuilder{}.
+		WithSrc(cu.ToACE.AsRemote()).
+		WithDst(s.saveReq.Src).
+		WithRspTo(s.saveReq.MapReqID).
+		WithState(s.saved, s.byteSize).
+		Build()
+
+	err := cu.ToACE.Send(rsp)
+	if err != nil {
+		return false, madeProgress
+	}
+
+	tracing.TraceReqComplete(s.wg.MapReq, cu)
+
+	return true, true
+}
+
+// canSaveWG checks if all the wavefronts of the work-group stop at an
+// instruction boundary, with no instruction or memory access in flight.
+func (cu *ComputeUnit) canSaveWG(wg *wavefront.WorkGroup) bool {
+	for _, wf := range wg.Wfs {
+		switch wf.State {
+		case wavefront.WfReady, wavefront.WfAtBarrier, wavefront.WfCompleted:
+		default:
+			return false
+		}
+
+		if wf.IsFetching ||
+			wf.OutstandingScalarMemAccess > 0 ||
+			wf.OutstandingVectorMemAccess > 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (cu *ComputeUnit) startSavingWG(s *wgContextSwitch) {
+	wg := s.wg
+	s.saved = &savedWG{wg: wg, address: s.saveReq.Address}
+
+	for _, wf := range wg.Wfs {
+		s.saved.wfs = append(s.saved.wfs, savedWf{state: wf.State})
+	}
+
+	s.segments = cu.contextSegments(s.saved)
+	for _, seg := range s.segments {
+		var data []byte
+		if seg.wf == nil {
+			data = wg.LDS
+		} else {
+			data = append(cu.readVRegs(seg.wf), cu.readSRegs(seg.wf)...)
+		}
+
+		seg.accesses = cu.contextWrites(wg, seg, data)
+		s.byteSize += uint64(seg.byteSize)
+	}
+
+	wg.LDS = nil
+	cu.removeWG(wg)
+}
+
+// contextSegments returns the parts of the context-save area that the
+// work-group uses. The completed wavefronts are not saved.
+func (cu *ComputeUnit) contextSegments(saved *savedWG) []*contextSegment {
+	wg := saved.wg
+	wfByteSize := protocol.WfContextByteSize(wg.CodeObject)
+	segments := make([]*contextSegment, 0, len(wg.Wfs)+1)
+
+	for i, wf := range wg.Wfs {
+		if saved.wfs[i].state == wavefront.WfCompleted {
+			continue
+		}
+
+		segments = append(segments, &contextSegment{
+			wf:      wf,
+			address: saved.address + uint64(i)*wfByteSize,
+			byteSize: int(wf.CodeObject.WIVgprCount)*4*64 +
+				int(wf.CodeObject.WFSgprCount)*4,
+		})
+	}
+
+	ldsByteSize := int(wg.Packet.GroupSegmentSize)
+	if ldsByteSize > 0 {
+		segments = append(segments, &contextSegment{
+			address:  saved.address + uint64(len(wg.Wfs))*wfByteSize,
+			byteSize: ldsByteSize,
+		})
+	}
+
+	return segments
+}
+
+func (cu *ComputeUnit) contextWrites(
+	wg *wavefront.WorkGroup,
+	seg *contextSegment,
+	data []byte,
+) []*internalMemAccess {
+	accesses := make([]*internalMemAccess, 0)
+
+	for offset := 0; offset < seg.byteSize; offset += contextAccessByteSize {
+		end := min(offset+contextAccessByteSize, seg.byteSize)
+
+		write := mem.WriteReqBuilder{}.
+			WithAddress(seg.address + uint64(offset)).
+			WithPID(wg.Wfs[0].PID()).
+			WithData(data[offset:end]).
+			Build()
+
+		accesses = append(accesses, &internalMemAccess{
+			req:    write,
+			taskID: tracing.MsgIDAtReceiver(wg.MapReq, cu),
+		})
+	}
+
+	return accesses
+}
+
+func (cu *ComputeUnit) contextReads(
+	wg *wavefront.WorkGroup,
+	seg *contextSegment,
+) []*internalMemAccess {
+	accesses := make([]*internalMemAccess, 0)
+
+	for offset := 0; offset < seg.byteSize; offset += contextAccessByteSize {
+		end := min(offset+contextAccessByteSize, seg.byteSize)
+
+		read := mem.ReadReqBuilder{}.
+			WithAddress(seg.address + uint64(offset)).
+			WithPID(wg.Wfs[0].PID()).
+			WithByteSize(uint64(end - offset)).
+			Build()
+
+		accesses = append(accesses, &internalMemAccess{
+			req:    read,
+			taskID: tracing.MsgIDAtReceiver(wg.MapReq, cu),
+		})
+	}
+
+	return accesses
+}
+
+// sendContextAccesses sends the reads or the writes of the context-save area
+// that are not sent yet, as many as the vector memory port takes. Nothing is
+// sent while the pipeline is flushed, as the flush would lose the accesses.
+func (cu *ComputeUnit) sendContextAccesses(s *wgContextSwitch) bool {
+	if cu.isPaused {
+		return false
+	}
+
+	madeProgress := false
+
+	for _, seg := range s.segments {
+		for _, access := range seg.accesses {
+			if access.sent || access.done {
+				continue
+			}
+
+			if !cu.sendInternalAccess(access) {
+				return madeProgress
+			}
+
+			madeProgress = true
+		}
+	}
+
+	return madeProgress
+}
+
+func isContextTransferred(s *wgContextSwitch) bool {
+	for _, seg := range s.segments {
+		for _, access := range seg.accesses {
+			if !access.done {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func (cu *ComputeUnit) readVRegs(wf *wavefront.Wavefront) []byte {
+	numRegs := int(wf.CodeObject.WIVgprCount)
+	data := make([]byte, numRegs*4*64)
+
+	if numRegs == 0 {
+		return data
+	}
+
+	for lane := 0; lane < 64; lane++ {
+		cu.VRegFile[wf.SIMDID].Read(RegisterAccess{
+			Reg:        insts.VReg(0),
+			RegCount:   numRegs,
+			LaneID:     lane,
+			WaveOffset: wf.VRegOffset,
+			Data:       data[lane*numRegs*4 : (lane+1)*numRegs*4],
+		})
+	}
+
+	return data
+}
+
+func (cu *ComputeUnit) readSRegs(wf *wavefront.Wavefront) []byte {
+	numRegs := int(wf.CodeObject.WFSgprCount)
+	data := make([]byte, numRegs*4)
+
+	if numRegs == 0 {
+		return data
+	}
+
+	cu.SRegFile.Read(RegisterAccess{
+		Reg:        insts.SReg(0),
+		RegCount:   numRegs,
+		WaveOffset: wf.SRegOffset,
+		Data:       data,
+	})
+
+	return data
+}
+
+// removeWG takes the wavefronts of a saved work-group out of the CU.
+func (cu *ComputeUnit) removeWG(wg *wavefront.WorkGroup) {
+	s := cu.Scheduler.(*SchedulerImpl)
+	s.removeAllWfFromBarrierBuffer(wg)
+
+	for _, wf := range wg.Wfs {
+		if wf.State != wavefront.WfCompleted {
+			s.resetRegisterValue(wf)
+		}
+	}
+
+	cu.clearWGResource(wg)
+}
+
+// restoreWG puts a preempted work-group back to the CU at the locations that
+// the dispatcher selects. The wavefronts do not run until the state is read
+// back from the context-save area.
+func (cu *ComputeUnit) restoreWG(req *protocol.MapWGReq) {
+	saved := req.SavedState.(*savedWG)
+	wg := saved.wg
+	wg.MapReq = req
+	wg.LDS = make([]byte, wg.Packet.GroupSegmentSize)
+
+	s := cu.Scheduler.(*SchedulerImpl)
+
+	for i, wf := range wg.Wfs {
+		location := req.Wavefronts[i]
+		wf.SIMDID = location.SIMDID
+		wf.SRegOffset = location.SGPROffset
+		wf.VRegOffset = location.VGPROffset
+		wf.LDSOffset = location.LDSOffset
+		wf.State = saved.wfs[i].state
+		wf.IsPreempting = true
+
+		if wf.State == wavefront.WfAtBarrier {
+			s.barrierBuffer = append(s.barrierBuffer, wf)
+		}
+
+		cu.WfPools[location.SIMDID].AddWf(wf)
+	}
+
+	r := &wgContextSwitch{
+		wg:       wg,
+		saved:    saved,
+		segments: cu.contextSegments(saved),
+	}
+	for _, seg := range r.segments {
+		seg.accesses = cu.contextReads(wg, seg)
+	}
+
+	cu.restoringWGs = append(cu.restoringWGs, r)
+}
+
+func (cu *ComputeUnit) restoreWGs() bool {
+	madeProgress := false
+
+	stillRestoring := cu.restoringWGs[:0]
+	for _, r := range cu.restoringWGs {
+		madeProgress = cu.sendContextAccesses(r) || madeProgress
+
+		if !isContextTransferred(r) {
+			stillRestoring = append(stillRestoring, r)
+			continue
+		}
+
+		cu.loadContext(r)
+
+		for _, wf := range r.wg.Wfs {
+			wf.IsPreempting = false
+		}
+
+		madeProgress = true
+	}
+	cu.restoringWGs = stillRestoring
+
+	return madeProgress
+}
+
+// loadContext writes the data that the reads of the context-save area return
+// to the registers and the LDS.
+func (cu *ComputeUnit) loadContext(r *wgContextSwitch) {
+	for _, seg := range r.segments {
+		data := make([]byte, 0, seg.byteSize)
+		for _, access := range seg.accesses {
+			data = append(data, access.data...)
+		}
+
+		if seg.wf == nil {
+			copy(r.wg.LDS, data)
+			continue
+		}
+
+		vgprByteSize := int(seg.wf.CodeObject.WIVgprCount) * 4 * 64
+		cu.writeVRegs(seg.wf, data[:vgprByteSize])
+		cu.writeSRegs(seg.wf, data[vgprByteSize:])
+	}
+}
+
+func (cu *ComputeUnit) writeVRegs(wf *wavefront.Wavefront, data []byte) {
+	numRegs := int(wf.CodeObject.WIVgprCount)
+	if numRegs == 0 {
+		return
+	}
+
+	for lane := 0; lane < 64; lane++ {
+		cu.VRegFile[wf.SIMDID].Write(RegisterAccess{
+			Reg:        insts.VReg(0),
+			RegCount:   numRegs,
+			LaneID:     lane,
+			WaveOffset: wf.VRegOffset,
+			Data:       data[lane*numRegs*4 : (lane+1)*numRegs*4],
+		})
+	}
+}
+
+func (cu *ComputeUnit) writeSRegs(wf *wavefront.Wavefront, data []byte) {
+	if len(data) == 0 {
+		return
+	}
+
+	cu.SRegFile.Write(RegisterAccess{
+		Reg:        insts.SReg(0),
+		RegCount:   int(wf.CodeObject.WFSgprCount),
+		WaveOffset: wf.SRegOffset,
+		Data:       data,
+	})
+}
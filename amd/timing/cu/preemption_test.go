@@ -0,0 +1,249 @@
+package cu
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sarchlab/akita/v4/mem/mem"
+	"github.com/sarchlab/akita/v4/sim"
+	"github.com/sarchlab/mgpusim/v4/amd/insts"
+	"github.com/sarchlab/mgpusim/v4/amd/kernels"
+	"github.com/sarchlab/mgpusim/v4/amd/protocol"
+	"github.com/sarchlab/mgpusim/v4/amd/timing/wavefront"
+	"go.uber.org/mock/gomock"
+)
+
+var _ = Describe("Preemption", func() {
+	var (
+		mockCtrl    *gomock.Controller
+		engine      *MockEngine
+		cu          *ComputeUnit
+		toACE       *MockPort
+		toVectorMem *MockPort
+		wg          *wavefront.WorkGroup
+		wf          *wavefront.Wavefront
+		vregs       []byte
+		sregs       []byte
+		lds         []byte
+	)
+
+	pattern := func(n int, seed byte) []byte {
+		data := make([]byte, n)
+		for i := range data {
+			data[i] = byte(i)*3 + seed
+		}
+
+		return data
+	}
+
+	expectSends := func(n int) *[]mem.AccessReq {
+		sent := make([]mem.AccessReq, 0)
+		toVectorMem.EXPECT().Send(gomock.Any()).
+			Do(func(req mem.AccessReq) {
+				sent = append(sent, req)
+			}).
+			Times(n)
+
+		return &sent
+	}
+
+	BeforeEach(func() {
+		mockCtrl = gomock.NewController(GinkgoT())
+		engine = NewMockEngine(mockCtrl)
+		engine.EXPECT().CurrentTime().Return(sim.VTimeInSec(0)).AnyTimes()
+
+		cu = NewComputeUnit("CU", engine)
+		cu.Freq = 1
+		cu.WfPools = []*WavefrontPool{NewWavefrontPool(10)}
+		cu.VRegFile = []RegisterFile{NewSimpleRegisterFile(16384*4, 1024)}
+		cu.SRegFile = NewSimpleRegisterFile(16384, 0)
+		cu.VectorMemModules = &mem.SinglePortMapper{Port: "L1V"}
+		cu.Scheduler = NewScheduler(cu, newMockWfArbitor(), newMockWfArbitor())
+
+		toACE = NewMockPort(mockCtrl)
+		toACE.EXPECT().AsRemote().Return(sim.RemotePort("ToACE")).AnyTimes()
+		cu.ToACE = toACE
+
+		toVectorMem = NewMockPort(mockCtrl)
+		toVectorMem.EXPECT().AsRemote().
+			Return(sim.RemotePort("ToVectorMem")).AnyTimes()
+		cu.ToVectorMem = toVectorMem
+
+		co := insts.NewHsaCo()
+		co.HsaCoHeader = new(insts.HsaCoHeader)
+		co.WIVgprCount = 1
+		co.WFSgprCount = 2
+
+		rawWG := kernels.NewWorkGroup()
+		rawWG.CodeObject = co
+		rawWG.Packet = &kernels.HsaKernelDispatchPacket{
+			WorkgroupSizeX:   64,
+			WorkgroupSizeY:   1,
+			WorkgroupSizeZ:   1,
+			GroupSegmentSize: 16,
+		}
+		rawWf := kernels.NewWavefront()
+		rawWf.CodeObject = co
+		rawWf.WG = rawWG
+		rawWG.Wavefronts = append(rawWG.Wavefronts, rawWf)
+
+		wg = wavefront.NewWorkGroup(rawWG, protocol.MapWGReqBuilder{}.Build())
+		wf = wavefront.NewWavefront(rawWf)
+		wf.WG = wg
+		wf.SetPID(1)
+		wg.Wfs = append(wg.Wfs, wf)
+
+		vregs = pattern(256, 1)
+		sregs = pattern(8, 2)
+		lds = pattern(16, 3)
+	})
+
+	AfterEach(func() {
+		mockCtrl.Finish()
+	})
+
+	It("should write the state to the context-save area", func() {
+		wf.State = wavefront.WfReady
+		wg.LDS = append([]byte{}, lds...)
+		cu.WfPools[0].AddWf(wf)
+		cu.writeVRegs(wf, vregs)
+		cu.writeSRegs(wf, sregs)
+
+		saveReq := protocol.SaveWGReqBuilder{}.
+			WithSrc("Dispatcher").
+			WithMapReqID(wg.MapReq.ID).
+			WithAddress(0x10000).
+			Build()
+		cu.handleSaveWGReq(saveReq)
+
+		cu.doContextSwitch()
+		Expect(cu.WfPools[0].wfs).To(BeEmpty())
+		Expect(cu.readVRegs(wf)).To(Equal(make([]byte, 256)))
+
+		sent := expectSends(6)
+		cu.doContextSwitch()
+
+		writes := *sent
+		addresses := make([]uint64, 0)
+		data := make([]byte, 0)
+		for _, req := range writes[:5] {
+			write := req.(*mem.WriteReq)
+			Expect(write.Dst).To(Equal(sim.RemotePort("L1V")))
+			addresses = append(addresses, write.Address)
+			data = append(data, write.Data...)
+		}
+		Expect(addresses).To(Equal(
+			[]uint64{0x10000, 0x10040, 0x10080, 0x100c0, 0x10100}))
+		Expect(data).To(Equal(append(vregs, sregs...)))
+
+		ldsWrite := writes[5].(*mem.WriteReq)
+		Expect(ldsWrite.Address).To(Equal(uint64(0x10140)))
+		Expect(ldsWrite.Data).To(Equal(lds))
+
+		for _, req := range writes {
+			rsp := mem.WriteDoneRspBuilder{}.WithRspTo(req.Meta().ID).Build()
+			toVectorMem.EXPECT().RetrieveIncoming().Return(rsp)
+			Expect(cu.processInputFromVectorMem()).To(BeTrue())
+
+			if req != writes[len(writes)-1] {
+				cu.doContextSwitch()
+			}
+		}
+
+		toACE.EXPECT().Send(gomock.Any()).
+			Do(func(msg sim.Msg) {
+				rsp := msg.(*protocol.SaveWGRsp)
+				Expect(rsp.Dst).To(Equal(sim.RemotePort("Dispatcher")))
+				Expect(rsp.RspTo).To(Equal(wg.MapReq.ID))
+				Expect(rsp.StateByteSize).To(Equal(uint64(280)))
+			}).
+			Return(nil)
+
+		cu.doContextSwitch()
+
+		Expect(cu.savingWGs).To(BeEmpty())
+	})
+
+	It("should read the state back from the context-save area", func() {
+		saved := &savedWG{
+			wg:      wg,
+			wfs:     []savedWf{{state: wavefront.WfReady}},
+			address: 0x10000,
+		}
+		req := protocol.MapWGReqBuilder{}.
+			WithSavedState(saved).
+			Build()
+		req.Wavefronts = []protocol.WfDispatchLocation{
+			{SIMDID: 0, VGPROffset: 16, SGPROffset: 64},
+		}
+
+		cu.restoreWG(req)
+		Expect(wf.IsPreempting).To(BeTrue())
+		Expect(cu.WfPools[0].wfs).To(ContainElement(wf))
+
+		sent := expectSends(6)
+		cu.doContextSwitch()
+
+		reads := *sent
+		stored := append(append([]byte{}, vregs...), sregs...)
+		for i, req := range reads {
+			read := req.(*mem.ReadReq)
+
+			var data []byte
+			if i < 5 {
+				offset := read.Address - 0x10000
+				data = stored[offset : offset+read.AccessByteSize]
+			} else {
+				Expect(read.Address).To(Equal(uint64(0x10140)))
+				data = lds
+			}
+
+			rsp := mem.DataReadyRspBuilder{}.
+				WithRspTo(read.ID).
+				WithData(data).
+				Build()
+			toVectorMem.EXPECT().RetrieveIncoming().Return(rsp)
+			Expect(cu.processInputFromVectorMem()).To(BeTrue())
+		}
+
+		cu.doContextSwitch()
+
+		Expect(wf.IsPreempting).To(BeFalse())
+		Expect(wf.VRegOffset).To(Equal(16))
+		Expect(cu.readVRegs(wf)).To(Equal(vregs))
+		Expect(cu.readSRegs(wf)).To(Equal(sregs))
+		Expect(wg.LDS).To(Equal(lds))
+		Expect(cu.restoringWGs).To(BeEmpty())
+	})
+
+	It("should send the accesses again after a flush", func() {
+		wf.State = wavefront.WfReady
+		wg.LDS = make([]byte, 16)
+		cu.WfPools[0].AddWf(wf)
+		cu.handleSaveWGReq(protocol.SaveWGReqBuilder{}.
+			WithMapReqID(wg.MapReq.ID).
+			WithAddress(0x10000).
+			Build())
+		cu.doContextSwitch()
+
+		first := expectSends(6)
+		cu.doContextSwitch()
+
+		firstIDs := make([]string, 0)
+		for _, req := range *first {
+			firstIDs = append(firstIDs, req.Meta().ID)
+		}
+
+		cu.flushInternalAccesses()
+		cu.isPaused = true
+		Expect(cu.doContextSwitch()).To(BeFalse())
+
+		cu.isPaused = false
+		second := expectSends(6)
+		cu.doContextSwitch()
+
+		for _, req := range *second {
+			Expect(firstIDs).NotTo(ContainElement(req.Meta().ID))
+		}
+		Expect(cu.internalAccesses).To(HaveLen(6))
+	})
+})
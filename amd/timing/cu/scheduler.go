@@ -1,9 +1,11 @@
 package cu
 
 import (
+	"encoding/binary"
 	"log"
 
 	"github.com/sarchlab/akita/v4/mem/mem"
+	"github.com/sarchlab/akita/v4/sim"
 	"github.com/sarchlab/akita/v4/tracing"
 	"github.com/sarchlab/mgpusim/v4/amd/insts"
 	"github.com/sarchlab/mgpusim/v4/amd/protocol"
@@ -31,6 +33,10 @@ type SchedulerImpl struct {
 	barrierBuffer     []*wavefront.Wavefront
 	barrierBufferSize int
 
+	// gridBarrierWaits tracks the work-groups that have arrived at the grid
+	// barrier.
+	gridBarrierWaits map[*wavefront.WorkGroup]*gridBarrierWait
+
 	cyclesNoProgress                  int
 	stopTickingAfterNCyclesNoProgress int
 
@@ -51,6 +57,7 @@ func NewScheduler(
 
 	s.barrierBufferSize = 16
 	s.barrierBuffer = make([]*wavefront.Wavefront, 0, s.barrierBufferSize)
+	s.gridBarrierWaits = make(map[*wavefront.WorkGroup]*gridBarrierWait)
 
 	s.stopTickingAfterNCyclesNoProgress = 4
 
@@ -103,6 +110,7 @@ func (s *SchedulerImpl) DecodeNextInst() bool {
 			inst, err := s.cu.Decoder.Decode(
 				wf.InstBuffer[wf.PC-wf.InstBufferStartPC:])
 			if err == nil {
+				inst.PC = wf.PC
 				wf.InstToIssue = wavefront.NewInst(inst)
 				// s.cu.logInstTask(now, wf, wf.InstToIssue, false)
 				madeProgress = true
@@ -247,6 +255,14 @@ func (s *SchedulerImpl) EvaluateInternalInst() bool {
 			}
 		case 12: // S_WAITCNT
 			instProgress, instCompleted = s.evalSWaitCnt(executing)
+		case 157: // DS_GWS_BARRIER
+			instProgress, instCompleted, passBarrier =
+				s.evalGridBarrier(executing)
+
+			if passBarrier {
+				s.removeAllWfFromInternalExecuting(executing.WG, &newExecuting)
+				s.removeAllWfFromInternalExecuting(executing.WG, &s.internalExecuting)
+			}
 		default:
 			// The program has to make progress
 			executing.State = wavefront.WfReady
@@ -433,6 +449,154 @@ func (s *SchedulerImpl) evalSBarrier(
 	return false, false, false
 }
 
+// A gridBarrierWait is a work-group that waits at a grid barrier. The
+// work-group writes its increment to the arrival counter and then polls the
+// counter until the grid barrier releases it.
+type gridBarrierWait struct {
+	generation int
+	arrival    *internalMemAccess
+	written    bool
+	poll       *internalMemAccess
+	nextPollAt sim.VTimeInSec
+	released   bool
+}
+
+// evalGridBarrier waits until all the wavefronts of the work-group reach the
+// barrier and then waits for all the work-groups of the grid. The last
+// wavefront that arrives stays in the scheduler and accesses the arrival
+// counter on behalf of the work-group.
+func (s *SchedulerImpl) evalGridBarrier(
+	wf *wavefront.Wavefront,
+) (madeProgress bool, instCompleted bool, passBarrier bool) {
+	if s.cu.GridBarrier == nil {
+		log.Panic("the compute unit does not have a grid barrier")
+	}
+
+	wf.State = wavefront.WfAtBarrier
+	wg := wf.WG
+
+	wait, arrived := s.gridBarrierWaits[wg]
+	if !arrived {
+		if !s.areAllWfInWGAtBarrier(wg) {
+			if len(s.barrierBuffer) < s.barrierBufferSize {
+				s.barrierBuffer = append(s.barrierBuffer, wf)
+				return true, true, false
+			}
+
+			return false, false, false
+		}
+
+		s.gridBarrierWaits[wg] = s.arriveAtGridBarrier(wf)
+
+		return true, false, false
+	}
+
+	madeProgress = s.waitAtGridBarrier(wf, wait)
+	if !wait.released {
+		return madeProgress, false, false
+	}
+
+	s.cu.GridBarrier.Pass(wg.WorkGroup, wait.generation)
+	delete(s.gridBarrierWaits, wg)
+	s.passBarrier(wg)
+
+	return true, true, true
+}
+
+func (s *SchedulerImpl) arriveAtGridBarrier(
+	wf *wavefront.Wavefront,
+) *gridBarrierWait {
+	generation, count := s.cu.GridBarrier.Arrive(wf.WG.WorkGroup)
+
+	data := make([]byte, 4)
+	binary.LittleEndian.PutUint32(data, count)
+
+	write := mem.WriteReqBuilder{}.
+		WithAddress(gridBarrierCounterAddress(wf)).
+		WithPID(wf.PID()).
+		WithData(data).
+		WithInfo(gridBarrierAccessInfo(wf)).
+		Build()
+
+	return &gridBarrierWait{
+		generation: generation,
+		arrival:    &internalMemAccess{req: write, taskID: wf.DynamicInst().ID},
+	}
+}
+
+// waitAtGridBarrier sends the increment of the work-group and the polls of
+// the arrival counter. A poll releases the work-group if it is sent after the
+// last increment has reached the memory.
+func (s *SchedulerImpl) waitAtGridBarrier(
+	wf *wavefront.Wavefront,
+	wait *gridBarrierWait,
+) bool {
+	now := s.cu.CurrentTime()
+
+	switch {
+	case !wait.arrival.sent:
+		return s.cu.sendInternalAccess(wait.arrival)
+	case !wait.arrival.done:
+		return false
+	case !wait.written:
+		wait.written = true
+		wait.released = s.cu.GridBarrier.CounterWritten(
+			wf.WG.WorkGroup, wait.generation, now)
+
+		return true
+	case wait.poll == nil:
+		if now >= wait.nextPollAt {
+			wait.poll = s.gridBarrierPoll(wf)
+		}
+
+		return true
+	case !wait.poll.sent:
+		return s.cu.sendInternalAccess(wait.poll)
+	case !wait.poll.done:
+		return false
+	}
+
+	releaseTime, released := s.cu.GridBarrier.ReleaseTime(
+		wf.WG.WorkGroup, wait.generation)
+	if released && releaseTime <= wait.poll.sentAt {
+		wait.released = true
+		return true
+	}
+
+	wait.poll = nil
+	wait.nextPollAt = s.cu.Freq.NCyclesLater(
+		s.cu.GridBarrier.PollInterval, now)
+
+	return true
+}
+
+func (s *SchedulerImpl) gridBarrierPoll(
+	wf *wavefront.Wavefront,
+) *internalMemAccess {
+	read := mem.ReadReqBuilder{}.
+		WithAddress(gridBarrierCounterAddress(wf)).
+		WithPID(wf.PID()).
+		WithByteSize(4).
+		WithInfo(gridBarrierAccessInfo(wf)).
+		Build()
+
+	return &internalMemAccess{req: read, taskID: wf.DynamicInst().ID}
+}
+
+func gridBarrierCounterAddress(wf *wavefront.Wavefront) uint64 {
+	return wf.WG.PacketAddress + gridBarrierCounterOffset
+}
+
+// gridBarrierAccessInfo sets the GLC bit on the accesses to the arrival
+// counter, so that the polls read the counter from the L2 caches when the CUs
+// follow the cache hints.
+func gridBarrierAccessInfo(wf *wavefront.Wavefront) protocol.AccessInfo {
+	return protocol.AccessInfo{
+		PC:     wf.DynamicInst().PC,
+		Policy: protocol.CachePolicy{GLC: true},
+	}
+}
+
 func (s *SchedulerImpl) areAllWfInWGAtBarrier(wg *wavefront.WorkGroup) bool {
 	for _, wf := range wg.Wfs {
 		if wf.State != wavefront.WfAtBarrier {
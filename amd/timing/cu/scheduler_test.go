@@ -517,6 +517,150 @@ var _ = Describe("Scheduler", func() {
 
 	})
 
+	Context("when the work-groups wait for the grid barrier", func() {
+		var (
+			toVectorMem *MockPort
+			packet      *kernels.HsaKernelDispatchPacket
+			wg          *wavefront.WorkGroup
+			wf          *wavefront.Wavefront
+		)
+
+		BeforeEach(func() {
+			cu.GridBarrier = NewGridBarrier()
+			cu.GridBarrier.PollInterval = 0
+			cu.VectorMemModules = &mem.SinglePortMapper{Port: "L1V"}
+
+			toVectorMem = NewMockPort(mockCtrl)
+			toVectorMem.EXPECT().AsRemote().
+				Return(sim.RemotePort("ToVectorMem")).AnyTimes()
+			cu.ToVectorMem = toVectorMem
+
+			packet = &kernels.HsaKernelDispatchPacket{
+				GridSizeX:      64,
+				GridSizeY:      1,
+				GridSizeZ:      1,
+				WorkgroupSizeX: 64,
+				WorkgroupSizeY: 1,
+				WorkgroupSizeZ: 1,
+			}
+			wg = wavefront.NewWorkGroup(kernels.NewWorkGroup(), nil)
+			wg.Packet = packet
+			wg.PacketAddress = 0x1000
+
+			wf = wavefront.NewWavefront(kernels.NewWavefront())
+			wf.State = wavefront.WfRunning
+			wf.SetDynamicInst(wavefront.NewInst(insts.NewInst()))
+			wf.DynamicInst().Format = insts.FormatTable[insts.DS]
+			wf.DynamicInst().Opcode = 157
+			wf.WG = wg
+			wg.Wfs = append(wg.Wfs, wf)
+
+			scheduler.internalExecuting = []*wavefront.Wavefront{wf}
+		})
+
+		respond := func(req mem.AccessReq) {
+			var rsp sim.Msg
+			switch req := req.(type) {
+			case *mem.ReadReq:
+				rsp = mem.DataReadyRspBuilder{}.
+					WithRspTo(req.ID).
+					WithData(make([]byte, 4)).
+					Build()
+			case *mem.WriteReq:
+				rsp = mem.WriteDoneRspBuilder{}.WithRspTo(req.ID).Build()
+			}
+
+			toVectorMem.EXPECT().RetrieveIncoming().Return(rsp)
+			Expect(cu.processInputFromVectorMem()).To(BeTrue())
+		}
+
+		expectSend := func() *mem.AccessReq {
+			var sent mem.AccessReq
+			toVectorMem.EXPECT().Send(gomock.Any()).
+				Do(func(req mem.AccessReq) {
+					sent = req
+				})
+
+			return &sent
+		}
+
+		It("should write the count to the arrival counter", func() {
+			scheduler.EvaluateInternalInst()
+			Expect(wf.State).To(Equal(wavefront.WfAtBarrier))
+			Expect(scheduler.gridBarrierWaits).To(HaveKey(wg))
+
+			sent := expectSend()
+			scheduler.EvaluateInternalInst()
+
+			write := (*sent).(*mem.WriteReq)
+			Expect(write.Address).To(Equal(uint64(0x1000 + 48)))
+			Expect(write.Data).To(Equal([]byte{1, 0, 0, 0}))
+			Expect(write.Dst).To(Equal(sim.RemotePort("L1V")))
+			Expect(protocol.AccessInfoOf(write).Policy.GLC).To(BeTrue())
+			Expect(scheduler.internalExecuting).To(ContainElement(wf))
+
+			respond(write)
+			scheduler.EvaluateInternalInst()
+
+			Expect(wf.State).To(Equal(wavefront.WfReady))
+			Expect(scheduler.internalExecuting).NotTo(ContainElement(wf))
+			Expect(scheduler.gridBarrierWaits).To(BeEmpty())
+		})
+
+		It("should poll until the other work-groups arrive", func() {
+			packet.GridSizeX = 128
+			other := kernels.NewWorkGroup()
+			other.Packet = packet
+			cu.GridBarrier.Arrive(other)
+
+			scheduler.EvaluateInternalInst()
+			sent := expectSend()
+			scheduler.EvaluateInternalInst()
+			respond(*sent)
+			scheduler.EvaluateInternalInst()
+
+			sent = expectSend()
+			scheduler.EvaluateInternalInst()
+			scheduler.EvaluateInternalInst()
+			poll := (*sent).(*mem.ReadReq)
+			Expect(poll.Address).To(Equal(uint64(0x1000 + 48)))
+			Expect(poll.AccessByteSize).To(Equal(uint64(4)))
+
+			respond(poll)
+			scheduler.EvaluateInternalInst()
+			Expect(wf.State).To(Equal(wavefront.WfAtBarrier))
+
+			cu.GridBarrier.CounterWritten(other, 0, 0)
+
+			sent = expectSend()
+			scheduler.EvaluateInternalInst()
+			scheduler.EvaluateInternalInst()
+			respond(*sent)
+			scheduler.EvaluateInternalInst()
+
+			Expect(wf.State).To(Equal(wavefront.WfReady))
+			Expect(scheduler.gridBarrierWaits).To(BeEmpty())
+		})
+
+		It("should send the increment again after a flush", func() {
+			scheduler.EvaluateInternalInst()
+			sent := expectSend()
+			scheduler.EvaluateInternalInst()
+			firstID := (*sent).Meta().ID
+
+			scheduler.Flush()
+			cu.flushInternalAccesses()
+			Expect(cu.internalAccesses).To(BeEmpty())
+
+			scheduler.internalExecuting = []*wavefront.Wavefront{wf}
+			sent = expectSend()
+			scheduler.EvaluateInternalInst()
+
+			Expect((*sent).Meta().ID).NotTo(Equal(firstID))
+			Expect(cu.internalAccesses).To(HaveLen(1))
+		})
+	})
+
 	It("should flush", func() {
 		wg := new(wavefront.WorkGroup)
 		for i := 0; i < 4; i++ {
@@ -0,0 +1,111 @@
+package dram
+
+import (
+	"log"
+	"math/bits"
+	"strings"
+)
+
+// A location identifies the burst that an address falls into.
+type location struct {
+	channel   int
+	rank      int
+	bankGroup int
+	bank      int
+	row       uint64
+	column    uint64
+}
+
+// A bitField is a group of address bits that selects one item of a location.
+type bitField struct {
+	pos  int
+	mask uint64
+}
+
+func (f bitField) extract(addr uint64) uint64 {
+	return (addr >> f.pos) & f.mask
+}
+
+// An addressMapper maps the internal address to a location by slicing the
+// bits above the access unit.
+type addressMapper struct {
+	channel   bitField
+	rank      bitField
+	bankGroup bitField
+	bank      bitField
+	row       bitField
+	column    bitField
+}
+
+// newAddressMapper creates a mapper for the given mapping, which lists the
+// items from the highest bits to the lowest bits. The counts give the number
+// of each item, which need to be powers of 2. The items that have only one
+// instance take no bits and can be left out of the mapping.
+func newAddressMapper(
+	mapping string,
+	counts map[string]int,
+	accessUnitSize uint64,
+) addressMapper {
+	items := strings.Split(mapping, "-")
+	mappingMustListItemsOnce(mapping, items, counts)
+
+	fields := make(map[string]bitField)
+	pos := numBits(mapping, "access unit", int(accessUnitSize))
+
+	for i := len(items) - 1; i >= 0; i-- {
+		n := numBits(mapping, items[i], counts[items[i]])
+		fields[items[i]] = bitField{pos: pos, mask: 1<<n - 1}
+		pos += n
+	}
+
+	return addressMapper{
+		channel:   fields["channel"],
+		rank:      fields["rank"],
+		bankGroup: fields["bankgroup"],
+		bank:      fields["bank"],
+		row:       fields["row"],
+		column:    fields["column"],
+	}
+}
+
+func mappingMustListItemsOnce(
+	mapping string,
+	items []string,
+	counts map[string]int,
+) {
+	listed := make(map[string]bool)
+	for _, item := range items {
+		if _, ok := counts[item]; !ok || listed[item] {
+			log.Panicf("invalid DRAM address mapping %s", mapping)
+		}
+
+		listed[item] = true
+	}
+
+	for item, count := range counts {
+		if !listed[item] && count != 1 {
+			log.Panicf("DRAM address mapping %s does not map the %s",
+				mapping, item)
+		}
+	}
+}
+
+func numBits(mapping, item string, count int) int {
+	if count <= 0 || count&(count-1) != 0 {
+		log.Panicf("the number of %s in DRAM address mapping %s "+
+			"is not a power of 2", item, mapping)
+	}
+
+	return bits.TrailingZeros(uint(count))
+}
+
+func (m addressMapper) mapAddr(addr uint64) location {
+	return location{
+		channel:   int(m.channel.extract(addr)),
+		rank:      int(m.rank.extract(addr)),
+		bankGroup: int(m.bankGroup.extract(addr)),
+		bank:      int(m.bank.extract(addr)),
+		row:       m.row.extract(addr),
+		column:    m.column.extract(addr),
+	}
+}
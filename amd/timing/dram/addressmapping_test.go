@@ -0,0 +1,85 @@
+package dram
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Address Mapper", func() {
+	counts := map[string]int{
+		"channel":   2,
+		"rank":      2,
+		"bankgroup": 4,
+		"bank":      4,
+		"row":       1024,
+		"column":    8,
+	}
+
+	It("should slice the bits from the highest item to the lowest", func() {
+		m := newAddressMapper(
+			"row-rank-bank-column-bankgroup-channel", counts, 64)
+
+		// channel: bit 6, bank group: bits 7-8, column: bits 9-11,
+		// bank: bits 12-13, rank: bit 14, row: bits 15-24.
+		addr := uint64(1)<<6 | uint64(2)<<7 | uint64(5)<<9 |
+			uint64(3)<<12 | uint64(1)<<14 | uint64(513)<<15
+
+		Expect(m.mapAddr(addr)).To(Equal(location{
+			channel:   1,
+			rank:      1,
+			bankGroup: 2,
+			bank:      3,
+			row:       513,
+			column:    5,
+		}))
+	})
+
+	It("should keep the consecutive bursts in a row", func() {
+		m := newAddressMapper(
+			"row-channel-rank-bank-bankgroup-column", counts, 64)
+
+		first := m.mapAddr(0x1000)
+		second := m.mapAddr(0x1040)
+
+		Expect(second.row).To(Equal(first.row))
+		Expect(second.bank).To(Equal(first.bank))
+		Expect(second.column).To(Equal(first.column + 1))
+	})
+
+	It("should panic if an item is missing", func() {
+		Expect(func() {
+			newAddressMapper("row-rank-bank-bankgroup-column", counts, 64)
+		}).To(Panic())
+	})
+
+	It("should allow leaving out the items that have one instance", func() {
+		m := newAddressMapper("row-bank-column", map[string]int{
+			"channel":   1,
+			"rank":      1,
+			"bankgroup": 1,
+			"bank":      4,
+			"row":       1024,
+			"column":    8,
+		}, 64)
+
+		Expect(m.mapAddr(0xa40)).To(Equal(location{
+			bank:   1,
+			row:    1,
+			column: 1,
+		}))
+	})
+
+	It("should panic if an item is listed twice", func() {
+		Expect(func() {
+			newAddressMapper(
+				"row-row-channel-rank-bank-bankgroup-column", counts, 64)
+		}).To(Panic())
+	})
+
+	It("should panic if a count is not a power of 2", func() {
+		Expect(func() {
+			newAddressMapper(
+				"row-channel-rank-bank-bankgroup-column", counts, 48)
+		}).To(Panic())
+	})
+})
@@ -0,0 +1,300 @@
+package dram
+
+// Timing lists the timing parameters of a DRAM in the cycles of the command
+// clock.
+type Timing struct {
+	// BurstCycles is the number of cycles that the data of a column access
+	// occupies the data bus.
+	BurstCycles int
+
+	TCL    int // read command to the first data
+	TCWL   int // write command to the first data
+	TRCDRD int // activate to read
+	TRCDWR int // activate to write
+	TRP    int // precharge to activate
+	TRAS   int // activate to precharge
+	TRRDS  int // activate to activate in different bank groups
+	TRRDL  int // activate to activate in the same bank group
+	TWTRS  int // end of write data to read in different bank groups
+	TWTRL  int // end of write data to read in the same bank group
+	TWR    int // end of write data to precharge
+	TRTP   int // read to precharge
+	TCCDS  int // column to column in different bank groups
+	TCCDL  int // column to column in the same bank group
+	TRTRS  int // data bus turnaround between ranks or directions
+	TPPD   int // precharge to precharge in the same rank
+	TREFI  int // interval between two refreshes of a rank
+	TRFC   int // refresh to activate
+}
+
+// A bank records its open row and the earliest cycles that it accepts each
+// kind of command.
+type bank struct {
+	isOpen  bool
+	openRow uint64
+
+	nextActivate  uint64
+	nextPrecharge uint64
+	nextRead      uint64
+	nextWrite     uint64
+}
+
+// A rank records the constraints that the banks of a rank share.
+type rank struct {
+	banks [][]*bank
+
+	nextActivate  uint64
+	nextPrecharge uint64
+	nextRead      uint64
+	nextWrite     uint64
+
+	bankGroupNextActivate []uint64
+	bankGroupNextRead     []uint64
+	bankGroupNextWrite    []uint64
+
+	// refreshDue is the cycle that the next refresh of the rank is due. Once
+	// it is due, the controller closes the banks of the rank and refreshes
+	// them before it activates any row of the rank.
+	refreshDue uint64
+}
+
+func newRank(numBankGroup, numBank int) *rank {
+	r := &rank{
+		banks:                 make([][]*bank, numBankGroup),
+		bankGroupNextActivate: make([]uint64, numBankGroup),
+		bankGroupNextRead:     make([]uint64, numBankGroup),
+		bankGroupNextWrite:    make([]uint64, numBankGroup),
+	}
+
+	for i := range r.banks {
+		r.banks[i] = make([]*bank, numBank)
+		for j := range r.banks[i] {
+			r.banks[i][j] = &bank{}
+		}
+	}
+
+	return r
+}
+
+func (r *rank) isRefreshDue(now uint64) bool {
+	return now >= r.refreshDue
+}
+
+// A channel records the constraints of the data bus.
+type channel struct {
+	ranks []*rank
+
+	busFree        uint64
+	lastRank       int
+	lastWasWrite   bool
+	hasTransferred bool
+}
+
+func (c *channel) rank(l location) *rank {
+	return c.ranks[l.rank]
+}
+
+func (c *channel) bank(l location) *bank {
+	return c.ranks[l.rank].banks[l.bankGroup][l.bank]
+}
+
+func (c *channel) canActivate(l location, now uint64) bool {
+	r := c.rank(l)
+	b := c.bank(l)
+
+	return !b.isOpen &&
+		!r.isRefreshDue(now) &&
+		now >= b.nextActivate &&
+		now >= r.nextActivate &&
+		now >= r.bankGroupNextActivate[l.bankGroup]
+}
+
+func (c *channel) activate(l location, now uint64, t Timing) {
+	r := c.rank(l)
+	b := c.bank(l)
+
+	b.isOpen = true
+	b.openRow = l.row
+	b.nextRead = now + uint64(t.TRCDRD)
+	b.nextWrite = now + uint64(t.TRCDWR)
+	b.nextPrecharge = now + uint64(t.TRAS)
+	b.nextActivate = now + uint64(t.TRAS+t.TRP)
+
+	r.nextActivate = now + uint64(t.TRRDS)
+	r.bankGroupNextActivate[l.bankGroup] = now + uint64(t.TRRDL)
+}
+
+func (c *channel) canPrecharge(l location, now uint64) bool {
+	r := c.rank(l)
+	b := c.bank(l)
+
+	return b.isOpen &&
+		now >= b.nextPrecharge &&
+		now >= r.nextPrecharge
+}
+
+func (c *channel) precharge(l location, now uint64, t Timing) {
+	r := c.rank(l)
+	b := c.bank(l)
+
+	b.isOpen = false
+	b.nextActivate = max(b.nextActivate, now+uint64(t.TRP))
+
+	r.nextPrecharge = now + uint64(t.TPPD)
+}
+
+// canAccess returns true if a read or a write to the location can be issued.
+func (c *channel) canAccess(
+	l location,
+	isWrite bool,
+	now uint64,
+	t Timing,
+) bool {
+	r := c.rank(l)
+	b := c.bank(l)
+
+	if !b.isOpen || b.openRow != l.row {
+		return false
+	}
+
+	if isWrite {
+		if now < b.nextWrite || now < r.nextWrite ||
+			now < r.bankGroupNextWrite[l.bankGroup] {
+			return false
+		}
+	} else {
+		if now < b.nextRead || now < r.nextRead ||
+			now < r.bankGroupNextRead[l.bankGroup] {
+			return false
+		}
+	}
+
+	return c.dataStart(l, isWrite, now, t) >= c.earliestDataStart(l, isWrite, t)
+}
+
+func (c *channel) dataStart(
+	l location,
+	isWrite bool,
+	now uint64,
+	t Timing,
+) uint64 {
+	if isWrite {
+		return now + uint64(t.TCWL)
+	}
+
+	return now + uint64(t.TCL)
+}
+
+// earliestDataStart returns the first cycle that the data bus is available
+// for a transfer. Switching the rank or the direction of the bus takes tRTRS.
+func (c *channel) earliestDataStart(
+	l location,
+	isWrite bool,
+	t Timing,
+) uint64 {
+	if !c.hasTransferred {
+		return 0
+	}
+
+	if l.rank != c.lastRank || isWrite != c.lastWasWrite {
+		return c.busFree + uint64(t.TRTRS)
+	}
+
+	return c.busFree
+}
+
+// access issues a read or a write and returns the cycle that the data
+// transfer completes. If autoPrecharge is set, the bank closes the row after
+// the access.
+func (c *channel) access(
+	l location,
+	isWrite bool,
+	autoPrecharge bool,
+	now uint64,
+	t Timing,
+) uint64 {
+	r := c.rank(l)
+	b := c.bank(l)
+
+	dataEnd := c.dataStart(l, isWrite, now, t) + uint64(t.BurstCycles)
+	c.busFree = dataEnd
+	c.lastRank = l.rank
+	c.lastWasWrite = isWrite
+	c.hasTransferred = true
+
+	short := now + uint64(max(t.BurstCycles, t.TCCDS))
+	long := now + uint64(max(t.BurstCycles, t.TCCDL))
+
+	if isWrite {
+		r.nextWrite = max(r.nextWrite, short)
+		r.bankGroupNextWrite[l.bankGroup] = max(
+			r.bankGroupNextWrite[l.bankGroup], long)
+		r.nextRead = max(r.nextRead, dataEnd+uint64(t.TWTRS))
+		r.bankGroupNextRead[l.bankGroup] = max(
+			r.bankGroupNextRead[l.bankGroup], dataEnd+uint64(t.TWTRL))
+		b.nextPrecharge = max(b.nextPrecharge, dataEnd+uint64(t.TWR))
+	} else {
+		r.nextRead = max(r.nextRead, short)
+		r.bankGroupNextRead[l.bankGroup] = max(
+			r.bankGroupNextRead[l.bankGroup], long)
+		r.nextWrite = max(r.nextWrite, short)
+		r.bankGroupNextWrite[l.bankGroup] = max(
+			r.bankGroupNextWrite[l.bankGroup], long)
+		b.nextPrecharge = max(b.nextPrecharge, now+uint64(t.TRTP))
+	}
+
+	if autoPrecharge {
+		b.isOpen = false
+		b.nextActivate = max(b.nextActivate,
+			b.nextPrecharge+uint64(t.TRP))
+	}
+
+	return dataEnd
+}
+
+// canRefresh returns true if all the banks of the rank are closed and
+// precharged.
+func (c *channel) canRefresh(r *rank, now uint64) bool {
+	for _, bankGroup := range r.banks {
+		for _, b := range bankGroup {
+			if b.isOpen || now < b.nextActivate {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func (c *channel) refresh(r *rank, now uint64, t Timing) {
+	for _, bankGroup := range r.banks {
+		for _, b := range bankGroup {
+			b.nextActivate = now + uint64(t.TRFC)
+		}
+	}
+
+	r.refreshDue += uint64(t.TREFI)
+}
+
+// skipIdleRefreshes accounts for the refreshes that are due while the
+// controller has nothing to do and does not tick. The refreshes take place
+// in the idle time, so they only close the rows.
+func (c *channel) skipIdleRefreshes(now uint64, t Timing) {
+	for _, r := range c.ranks {
+		refreshed := false
+		for r.refreshDue+uint64(t.TRFC) <= now {
+			r.refreshDue += uint64(t.TREFI)
+			refreshed = true
+		}
+
+		if !refreshed {
+			continue
+		}
+
+		for _, bankGroup := range r.banks {
+			for _, b := range bankGroup {
+				b.isOpen = false
+			}
+		}
+	}
+}
@@ -0,0 +1,288 @@
+package dram
+
+import (
+	"log"
+
+	"github.com/sarchlab/akita/v4/mem/mem"
+	"github.com/sarchlab/akita/v4/sim"
+)
+
+// A Builder can build DRAM controllers.
+type Builder struct {
+	engine        sim.Engine
+	freq          sim.Freq
+	storage       *mem.Storage
+	addrConverter mem.AddressConverter
+	bufferSize    int
+	queueSize     int
+
+	pagePolicy     string
+	addressMapping string
+
+	busWidth     int
+	burstLength  int
+	deviceWidth  int
+	numChannel   int
+	numRank      int
+	numBankGroup int
+	numBank      int
+	numRow       int
+	numCol       int
+
+	timing Timing
+}
+
+// MakeBuilder creates a new builder with default configuration values. The
+// default organization and timing follow a DDR4-1600 channel.
+func MakeBuilder() Builder {
+	return Builder{
+		freq:           800 * sim.MHz,
+		bufferSize:     64,
+		queueSize:      32,
+		pagePolicy:     "open",
+		addressMapping: "row-channel-rank-bank-bankgroup-column",
+		busWidth:       64,
+		burstLength:    8,
+		deviceWidth:    16,
+		numChannel:     1,
+		numRank:        1,
+		numBankGroup:   4,
+		numBank:        4,
+		numRow:         32768,
+		numCol:         1024,
+		timing: Timing{
+			BurstCycles: 4,
+			TCL:         11,
+			TCWL:        9,
+			TRCDRD:      11,
+			TRCDWR:      11,
+			TRP:         11,
+			TRAS:        28,
+			TRRDS:       4,
+			TRRDL:       5,
+			TWTRS:       2,
+			TWTRL:       6,
+			TWR:         12,
+			TRTP:        6,
+			TCCDS:       4,
+			TCCDL:       5,
+			TRTRS:       1,
+			TREFI:       6240,
+			TRFC:        280,
+		},
+	}
+}
+
+// WithEngine sets the even-driven simulation engine to use.
+func (b Builder) WithEngine(engine sim.Engine) Builder {
+	b.engine = engine
+	return b
+}
+
+// WithFreq sets the frequency of the command clock.
+func (b Builder) WithFreq(freq sim.Freq) Builder {
+	b.freq = freq
+	return b
+}
+
+// WithStorage sets the storage that holds the data. The storage is accessed
+// with the physical address, so that it can be shared by all the controllers.
+// If no storage is given, the controller creates one that is accessed with
+// the internal address.
+func (b Builder) WithStorage(storage *mem.Storage) Builder {
+	b.storage = storage
+	return b
+}
+
+// WithInterleavingAddrConversion removes the bits that interleave the
+// physical address across the controllers before the address is mapped to
+// the banks. The controller is the currentUnitIndex-th of numTotalUnit
+// controllers that interleave at the given granularity, starting from the
+// given lower bound.
+func (b Builder) WithInterleavingAddrConversion(
+	interleaveGranularity uint64,
+	numTotalUnit, currentUnitIndex int,
+	lowerBound uint64,
+) Builder {
+	b.addrConverter = mem.InterleavingConverter{
+		InterleavingSize:    interleaveGranularity,
+		TotalNumOfElements:  numTotalUnit,
+		CurrentElementIndex: currentUnitIndex,
+		Offset:              lowerBound,
+	}
+
+	return b
+}
+
+// WithBufferSize sets the number of messages that the port can buffer.
+func (b Builder) WithBufferSize(n int) Builder {
+	b.bufferSize = n
+	return b
+}
+
+// WithQueueSize sets the number of bursts that the controller can hold while
+// it schedules the commands. A request is split into as many bursts as the
+// access units that it touches.
+func (b Builder) WithQueueSize(n int) Builder {
+	b.queueSize = n
+	return b
+}
+
+// WithPagePolicy sets when the controller closes a row. It can be "open" or
+// "close". With the open-page policy, a row stays open until an access to
+// another row of the bank or a refresh needs the bank, and the controller
+// serves the accesses that hit the open rows first. With the close-page
+// policy, every access precharges the bank after the data transfer.
+func (b Builder) WithPagePolicy(policy string) Builder {
+	b.pagePolicy = policy
+	return b
+}
+
+// WithAddressMapping sets how the address bits above the access unit select
+// the location in the DRAM. The mapping lists "channel", "rank", "bankgroup",
+// "bank", "row", and "column" from the highest bits to the lowest bits,
+// separated by "-". The items that have only one instance can be left out.
+// For example, "row-rank-bank-column-bankgroup" interleaves consecutive bursts
+// across the bank groups.
+func (b Builder) WithAddressMapping(mapping string) Builder {
+	b.addressMapping = mapping
+	return b
+}
+
+// WithBusWidth sets the number of bits that the channel transfers at the same
+// time.
+func (b Builder) WithBusWidth(n int) Builder {
+	b.busWidth = n
+	return b
+}
+
+// WithBurstLength sets the number of transfers of a column access.
+func (b Builder) WithBurstLength(n int) Builder {
+	b.burstLength = n
+	return b
+}
+
+// WithDeviceWidth sets the number of bits that a device transfers at the same
+// time.
+func (b Builder) WithDeviceWidth(n int) Builder {
+	b.deviceWidth = n
+	return b
+}
+
+// WithNumChannel sets the number of channels that the controller drives. Each
+// channel has its own command and data bus.
+func (b Builder) WithNumChannel(n int) Builder {
+	b.numChannel = n
+	return b
+}
+
+// WithNumRank sets the number of ranks in each channel.
+func (b Builder) WithNumRank(n int) Builder {
+	b.numRank = n
+	return b
+}
+
+// WithNumBankGroup sets the number of bank groups in each rank.
+func (b Builder) WithNumBankGroup(n int) Builder {
+	b.numBankGroup = n
+	return b
+}
+
+// WithNumBank sets the number of banks in each bank group.
+func (b Builder) WithNumBank(n int) Builder {
+	b.numBank = n
+	return b
+}
+
+// WithNumRow sets the number of rows in each bank.
+func (b Builder) WithNumRow(n int) Builder {
+	b.numRow = n
+	return b
+}
+
+// WithNumCol sets the number of columns in each row.
+func (b Builder) WithNumCol(n int) Builder {
+	b.numCol = n
+	return b
+}
+
+// WithTiming sets the timing parameters of the DRAM.
+func (b Builder) WithTiming(t Timing) Builder {
+	b.timing = t
+	return b
+}
+
+// Build creates a DRAM controller with the given parameters.
+func (b Builder) Build(name string) *Comp {
+	b.pagePolicyMustBeSupported()
+
+	c := &Comp{}
+	c.TickingComponent = sim.NewTickingComponent(name, b.engine, b.freq, c)
+
+	c.timing = b.timing
+	c.closePage = b.pagePolicy == "close"
+	c.queueSize = b.queueSize
+	c.accessUnitSize = uint64(b.busWidth / 8 * b.burstLength)
+	c.addrConverter = b.addrConverter
+	c.mapper = b.buildAddressMapper()
+	c.channels = b.buildChannels()
+
+	c.storage = b.storage
+	if c.storage == nil {
+		c.storage = mem.NewStorage(b.capacity())
+		c.useInternalAddress = true
+	}
+
+	c.Top = sim.NewPort(c, b.bufferSize, b.bufferSize, name+".Top")
+	c.AddPort("Top", c.Top)
+
+	return c
+}
+
+func (b Builder) pagePolicyMustBeSupported() {
+	switch b.pagePolicy {
+	case "open", "close":
+	default:
+		log.Panicf("unknown page policy %s", b.pagePolicy)
+	}
+}
+
+func (b Builder) buildAddressMapper() addressMapper {
+	return newAddressMapper(b.addressMapping, map[string]int{
+		"channel":   b.numChannel,
+		"rank":      b.numRank,
+		"bankgroup": b.numBankGroup,
+		"bank":      b.numBank,
+		"row":       b.numRow,
+		"column":    b.numCol / b.burstLength,
+	}, uint64(b.busWidth/8*b.burstLength))
+}
+
+func (b Builder) buildChannels() []*channel {
+	channels := make([]*channel, b.numChannel)
+	for i := range channels {
+		ch := &channel{}
+		ch.ranks = make([]*rank, b.numRank)
+
+		for j := range ch.ranks {
+			ch.ranks[j] = newRank(b.numBankGroup, b.numBank)
+
+			// Staggering the refreshes keeps the ranks of a channel from
+			// being unavailable at the same time.
+			ch.ranks[j].refreshDue = uint64(
+				b.timing.TREFI * (j + 1) / b.numRank)
+		}
+
+		channels[i] = ch
+	}
+
+	return channels
+}
+
+func (b Builder) capacity() uint64 {
+	devicePerRank := b.busWidth / b.deviceWidth
+	bankSize := uint64(b.numCol*b.deviceWidth/8) * uint64(b.numRow)
+
+	return bankSize * uint64(devicePerRank*b.numBankGroup*b.numBank) *
+		uint64(b.numRank*b.numChannel)
+}
@@ -0,0 +1,436 @@
+// Package dram provides a DRAM controller that schedules the commands of the
+// banks under the timing constraints of a memory technology.
+package dram
+
+import (
+	"log"
+	"reflect"
+
+	"github.com/sarchlab/akita/v4/mem/mem"
+	"github.com/sarchlab/akita/v4/sim"
+	"github.com/sarchlab/akita/v4/tracing"
+)
+
+// A transaction is a request that the controller serves.
+type transaction struct {
+	req mem.AccessReq
+	rsp sim.Msg
+
+	// numPending is the number of bursts whose column command has not been
+	// issued.
+	numPending int
+
+	// doneCycle is the cycle that the data of the last issued burst finishes
+	// transferring.
+	doneCycle uint64
+}
+
+// A burst is the part of a transaction that one column command serves.
+type burst struct {
+	trans   *transaction
+	loc     location
+	isWrite bool
+}
+
+// A Comp is a DRAM controller. It splits the requests into bursts, maps the
+// bursts to the channels, the ranks, the bank groups, the banks, and the rows,
+// and issues the activate, precharge, read, write, and refresh commands that
+// serve the bursts.
+//
+// The controller issues at most one command per channel in each cycle. With
+// the open-page policy, it first issues the reads and writes that hit the
+// open rows, and then serves the oldest burst of each bank. It refreshes each
+// rank once every tREFI cycles, closing the rows of the rank before the
+// refresh.
+//
+// The controller reports every command to the tracers as a task of kind
+// "cmd", whose What is "Activate", "Precharge", "Read", "ReadPrecharge",
+// "Write", "WritePrecharge", or "Refresh".
+type Comp struct {
+	*sim.TickingComponent
+
+	Top sim.Port
+
+	storage            *mem.Storage
+	useInternalAddress bool
+	addrConverter      mem.AddressConverter
+	mapper             addressMapper
+	accessUnitSize     uint64
+
+	timing    Timing
+	closePage bool
+	queueSize int
+
+	channels     []*channel
+	queue        []*burst
+	transactions []*transaction
+}
+
+// Tick updates the state of the controller.
+func (c *Comp) Tick() bool {
+	now := c.Freq.Cycle(c.CurrentTime())
+
+	madeProgress := false
+
+	if len(c.transactions) == 0 {
+		for _, ch := range c.channels {
+			ch.skipIdleRefreshes(now, c.timing)
+		}
+	}
+
+	madeProgress = c.respond(now) || madeProgress
+	madeProgress = c.issue(now) || madeProgress
+	madeProgress = c.parseTop() || madeProgress
+
+	return madeProgress
+}
+
+// respond sends the response of the first transaction whose data has been
+// transferred. It keeps the controller ticking while there are transactions.
+func (c *Comp) respond(now uint64) bool {
+	for i, t := range c.transactions {
+		if t.numPending > 0 || t.doneCycle > now {
+			continue
+		}
+
+		err := c.Top.Send(t.rsp)
+		if err != nil {
+			return true
+		}
+
+		tracing.TraceReqComplete(t.req, c)
+		c.transactions = append(c.transactions[:i], c.transactions[i+1:]...)
+
+		return true
+	}
+
+	return len(c.transactions) > 0
+}
+
+func (c *Comp) parseTop() bool {
+	msg := c.Top.PeekIncoming()
+	if msg == nil {
+		return false
+	}
+
+	req, ok := msg.(mem.AccessReq)
+	if !ok {
+		log.Panicf("cannot process request of type %s", reflect.TypeOf(msg))
+	}
+
+	bursts := c.split(req)
+	if len(c.queue)+len(bursts) > c.queueSize {
+		return false
+	}
+
+	c.Top.RetrieveIncoming()
+	tracing.TraceReqReceive(req, c)
+
+	t := bursts[0].trans
+	t.rsp = c.access(req)
+	c.transactions = append(c.transactions, t)
+	c.queue = append(c.queue, bursts...)
+
+	return true
+}
+
+// split divides the request into the bursts of the access units that it
+// touches.
+func (c *Comp) split(req mem.AccessReq) []*burst {
+	t := &transaction{req: req}
+
+	_, isWrite := req.(*mem.WriteReq)
+	addr := c.internalAddress(req.GetAddress())
+	start := addr / c.accessUnitSize * c.accessUnitSize
+	end := addr + req.GetByteSize()
+
+	bursts := make([]*burst, 0)
+	for a := start; a < end; a += c.accessUnitSize {
+		bursts = append(bursts, &burst{
+			trans:   t,
+			loc:     c.mapper.mapAddr(a),
+			isWrite: isWrite,
+		})
+	}
+
+	t.numPending = len(bursts)
+
+	return bursts
+}
+
+func (c *Comp) internalAddress(addr uint64) uint64 {
+	if c.addrConverter == nil {
+		return addr
+	}
+
+	return c.addrConverter.ConvertExternalToInternal(addr)
+}
+
+// access reads or writes the storage when the controller accepts the request,
+// so that the requests take effect in the order that they arrive. It returns
+// the response, which is sent when the bursts complete.
+func (c *Comp) access(req mem.AccessReq) sim.Msg {
+	addr := req.GetAddress()
+	if c.useInternalAddress {
+		addr = c.internalAddress(addr)
+	}
+
+	switch req := req.(type) {
+	case *mem.ReadReq:
+		return c.read(req, addr)
+	case *mem.WriteReq:
+		return c.write(req, addr)
+	default:
+		log.Panicf("cannot process request of type %s", reflect.TypeOf(req))
+	}
+
+	return nil
+}
+
+func (c *Comp) read(req *mem.ReadReq, addr uint64) sim.Msg {
+	data, err := c.storage.Read(addr, req.AccessByteSize)
+	if err != nil {
+		panic(err)
+	}
+
+	return mem.DataReadyRspBuilder{}.
+		WithSrc(c.Top.AsRemote()).
+		WithDst(req.Src).
+		WithRspTo(req.ID).
+		WithData(data).
+		Build()
+}
+
+func (c *Comp) write(req *mem.WriteReq, addr uint64) sim.Msg {
+	data := req.Data
+	if req.DirtyMask != nil {
+		var err error
+		data, err = c.storage.Read(addr, uint64(len(req.Data)))
+		if err != nil {
+			panic(err)
+		}
+
+		for i := range req.Data {
+			if req.DirtyMask[i] {
+				data[i] = req.Data[i]
+			}
+		}
+	}
+
+	err := c.storage.Write(addr, data)
+	if err != nil {
+		panic(err)
+	}
+
+	return mem.WriteDoneRspBuilder{}.
+		WithSrc(c.Top.AsRemote()).
+		WithDst(req.Src).
+		WithRspTo(req.ID).
+		Build()
+}
+
+// issue issues at most one command to each channel. It keeps the controller
+// ticking while there are bursts to serve.
+func (c *Comp) issue(now uint64) bool {
+	for i, ch := range c.channels {
+		if c.refresh(i, ch, now) {
+			continue
+		}
+
+		if !c.closePage && c.issueRowHit(i, ch, now) {
+			continue
+		}
+
+		c.issueOldest(i, ch, now)
+	}
+
+	return len(c.queue) > 0
+}
+
+// refresh works towards the refresh of the ranks that are due. It returns
+// true if it issues a command.
+func (c *Comp) refresh(chIndex int, ch *channel, now uint64) bool {
+	for rankIndex, r := range ch.ranks {
+		if !r.isRefreshDue(now) {
+			continue
+		}
+
+		if ch.canRefresh(r, now) {
+			ch.refresh(r, now, c.timing)
+			c.traceCommand("Refresh", nil)
+
+			return true
+		}
+
+		if c.closeRank(chIndex, rankIndex, ch, now) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c *Comp) closeRank(
+	chIndex, rankIndex int,
+	ch *channel,
+	now uint64,
+) bool {
+	for bg, bankGroup := range ch.ranks[rankIndex].banks {
+		for bi := range bankGroup {
+			l := location{
+				channel:   chIndex,
+				rank:      rankIndex,
+				bankGroup: bg,
+				bank:      bi,
+			}
+
+			if ch.canPrecharge(l, now) {
+				ch.precharge(l, now, c.timing)
+				c.traceCommand("Precharge", nil)
+
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// issueRowHit issues the oldest read or write that hits an open row.
+func (c *Comp) issueRowHit(chIndex int, ch *channel, now uint64) bool {
+	for i, b := range c.queue {
+		if !c.isSchedulable(b, chIndex, ch, now) {
+			continue
+		}
+
+		if ch.canAccess(b.loc, b.isWrite, now, c.timing) {
+			c.issueAccess(i, ch, now)
+			return true
+		}
+	}
+
+	return false
+}
+
+// issueOldest issues the next command of the oldest burst of each bank,
+// starting from the oldest burst in the queue.
+func (c *Comp) issueOldest(chIndex int, ch *channel, now uint64) bool {
+	visited := make(map[*bank]bool)
+
+	for i, b := range c.queue {
+		if !c.isSchedulable(b, chIndex, ch, now) {
+			continue
+		}
+
+		bank := ch.bank(b.loc)
+		if visited[bank] {
+			continue
+		}
+
+		visited[bank] = true
+
+		if c.issueNextCommand(i, ch, now) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c *Comp) isSchedulable(
+	b *burst,
+	chIndex int,
+	ch *channel,
+	now uint64,
+) bool {
+	return b.loc.channel == chIndex && !ch.rank(b.loc).isRefreshDue(now)
+}
+
+func (c *Comp) issueNextCommand(i int, ch *channel, now uint64) bool {
+	b := c.queue[i]
+	bank := ch.bank(b.loc)
+
+	switch {
+	case !bank.isOpen:
+		if ch.canActivate(b.loc, now) {
+			ch.activate(b.loc, now, c.timing)
+			c.traceCommand("Activate", b)
+
+			return true
+		}
+	case bank.openRow == b.loc.row:
+		if ch.canAccess(b.loc, b.isWrite, now, c.timing) {
+			c.issueAccess(i, ch, now)
+			return true
+		}
+	default:
+		if !c.hasRowHit(b.loc) && ch.canPrecharge(b.loc, now) {
+			ch.precharge(b.loc, now, c.timing)
+			c.traceCommand("Precharge", b)
+
+			return true
+		}
+	}
+
+	return false
+}
+
+// hasRowHit returns true if a burst in the queue accesses the open row of
+// the bank of the location.
+func (c *Comp) hasRowHit(l location) bool {
+	openRow := c.channels[l.channel].bank(l).openRow
+
+	for _, b := range c.queue {
+		if b.loc.channel == l.channel &&
+			b.loc.rank == l.rank &&
+			b.loc.bankGroup == l.bankGroup &&
+			b.loc.bank == l.bank &&
+			b.loc.row == openRow {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c *Comp) issueAccess(i int, ch *channel, now uint64) {
+	b := c.queue[i]
+
+	doneCycle := ch.access(b.loc, b.isWrite, c.closePage, now, c.timing)
+
+	t := b.trans
+	t.numPending--
+	t.doneCycle = max(t.doneCycle, doneCycle)
+
+	c.queue = append(c.queue[:i], c.queue[i+1:]...)
+
+	c.traceCommand(accessCommandName(b.isWrite, c.closePage), b)
+}
+
+func accessCommandName(isWrite, autoPrecharge bool) string {
+	name := "Read"
+	if isWrite {
+		name = "Write"
+	}
+
+	if autoPrecharge {
+		name += "Precharge"
+	}
+
+	return name
+}
+
+func (c *Comp) traceCommand(what string, b *burst) {
+	if c.NumHooks() == 0 {
+		return
+	}
+
+	parentID := ""
+	if b != nil {
+		parentID = tracing.MsgIDAtReceiver(b.trans.req, c)
+	}
+
+	id := sim.GetIDGenerator().Generate()
+	tracing.StartTask(id, parentID, c, "cmd", what, nil)
+	tracing.EndTask(id, c)
+}
@@ -0,0 +1,290 @@
+package dram
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sarchlab/akita/v4/mem/mem"
+	"github.com/sarchlab/akita/v4/sim"
+	"github.com/sarchlab/akita/v4/tracing"
+	"github.com/sarchlab/mgpusim/v4/amd/timing/dramtracer"
+	"go.uber.org/mock/gomock"
+)
+
+// A commandRecorder records the commands that the controller issues.
+type commandRecorder struct {
+	commands []string
+}
+
+func (r *commandRecorder) StartTask(task tracing.Task) {
+	if task.Kind == "cmd" {
+		r.commands = append(r.commands, task.What)
+	}
+}
+
+func (r *commandRecorder) StepTask(_ tracing.Task) {}
+
+func (r *commandRecorder) AddMilestone(_ tracing.Milestone) {}
+
+func (r *commandRecorder) EndTask(_ tracing.Task) {}
+
+var _ = Describe("Comp", func() {
+	var (
+		mockCtrl *gomock.Controller
+		engine   *MockEngine
+		top      *MockPort
+		storage  *mem.Storage
+		builder  Builder
+		c        *Comp
+		recorder *commandRecorder
+		stats    *dramtracer.Tracer
+		now      uint64
+		rsps     map[string]sim.Msg
+		rspAt    map[string]uint64
+	)
+
+	timing := Timing{
+		BurstCycles: 2,
+		TCL:         4,
+		TCWL:        2,
+		TRCDRD:      3,
+		TRCDWR:      3,
+		TRP:         3,
+		TRAS:        6,
+		TRRDS:       1,
+		TRRDL:       2,
+		TWTRS:       1,
+		TWTRL:       2,
+		TWR:         3,
+		TRTP:        2,
+		TCCDS:       2,
+		TCCDL:       3,
+		TRTRS:       1,
+		TPPD:        1,
+		TREFI:       1000,
+		TRFC:        20,
+	}
+
+	build := func(b Builder) {
+		c = b.Build("DRAM")
+		c.Top = top
+
+		recorder = &commandRecorder{}
+		stats = dramtracer.NewTracer(64e9)
+		tracing.CollectTrace(c, recorder)
+		tracing.CollectTrace(c, stats)
+	}
+
+	accept := func(req mem.AccessReq) {
+		top.EXPECT().PeekIncoming().Return(req)
+		top.EXPECT().RetrieveIncoming().Return(req)
+
+		Expect(c.parseTop()).To(BeTrue())
+	}
+
+	read := func(addr uint64) *mem.ReadReq {
+		req := mem.ReadReqBuilder{}.
+			WithSrc("L2").
+			WithAddress(addr).
+			WithByteSize(64).
+			Build()
+		accept(req)
+
+		return req
+	}
+
+	run := func(from uint64) {
+		for now = from; len(c.transactions) > 0; now++ {
+			Expect(now).To(BeNumerically("<", from+1000))
+
+			c.respond(now)
+			c.issue(now)
+		}
+	}
+
+	BeforeEach(func() {
+		mockCtrl = gomock.NewController(GinkgoT())
+		engine = NewMockEngine(mockCtrl)
+		top = NewMockPort(mockCtrl)
+		storage = mem.NewStorage(1 * mem.MB)
+		rsps = make(map[string]sim.Msg)
+		rspAt = make(map[string]uint64)
+
+		top.EXPECT().AsRemote().Return(sim.RemotePort("DRAM.Top")).AnyTimes()
+		top.EXPECT().Send(gomock.Any()).
+			DoAndReturn(func(msg sim.Msg) *sim.SendError {
+				rspTo := msg.(mem.AccessRsp).GetRspTo()
+				rsps[rspTo] = msg
+				rspAt[rspTo] = now
+
+				return nil
+			}).
+			AnyTimes()
+
+		// Each row has 8 bursts. The bank group is bit 9, the bank is bit 10,
+		// and the row starts from bit 11.
+		builder = MakeBuilder().
+			WithEngine(engine).
+			WithFreq(1 * sim.GHz).
+			WithStorage(storage).
+			WithBusWidth(64).
+			WithBurstLength(8).
+			WithNumChannel(1).
+			WithNumRank(1).
+			WithNumBankGroup(2).
+			WithNumBank(2).
+			WithNumRow(16).
+			WithNumCol(64).
+			WithAddressMapping("row-channel-rank-bank-bankgroup-column").
+			WithTiming(timing)
+	})
+
+	AfterEach(func() {
+		mockCtrl.Finish()
+	})
+
+	It("should serve the accesses that hit the open row", func() {
+		build(builder.WithPagePolicy("open"))
+		Expect(storage.Write(0x40, []byte{1, 2, 3, 4})).To(Succeed())
+
+		first := read(0x0)
+		second := read(0x40)
+		run(0)
+
+		Expect(recorder.commands).To(Equal(
+			[]string{"Activate", "Read", "Read"}))
+		Expect(stats.RowBufferHitRate()).To(Equal(0.5))
+
+		// The first read is issued after tRCDRD and its data takes tCL and
+		// the burst. The second read is in the same bank group, so it waits
+		// for tCCDL.
+		Expect(rspAt[first.ID]).To(Equal(uint64(9)))
+		Expect(rspAt[second.ID]).To(Equal(uint64(12)))
+		Expect(rsps[second.ID].(*mem.DataReadyRsp).Data[:4]).
+			To(Equal([]byte{1, 2, 3, 4}))
+	})
+
+	It("should close the row after each access", func() {
+		build(builder.WithPagePolicy("close"))
+
+		read(0x0)
+		read(0x40)
+		run(0)
+
+		Expect(recorder.commands).To(Equal([]string{
+			"Activate", "ReadPrecharge", "Activate", "ReadPrecharge"}))
+		Expect(stats.RowBufferHitRate()).To(Equal(0.0))
+	})
+
+	It("should precharge the bank to open another row", func() {
+		build(builder)
+
+		read(0x0)
+		read(0x800)
+		run(0)
+
+		Expect(recorder.commands).To(Equal([]string{
+			"Activate", "Read", "Precharge", "Activate", "Read"}))
+	})
+
+	It("should serve the row hits before the row conflicts", func() {
+		build(builder)
+
+		read(0x0)
+		read(0x800)
+		read(0x80)
+		run(0)
+
+		Expect(recorder.commands).To(Equal([]string{
+			"Activate", "Read", "Read", "Precharge", "Activate", "Read"}))
+		Expect(stats.RowBufferHitRate()).To(BeNumerically("~", 1.0/3))
+	})
+
+	It("should serve the banks in parallel", func() {
+		build(builder)
+
+		first := read(0x0)
+		second := read(0x200)
+		run(0)
+
+		Expect(recorder.commands).To(Equal([]string{
+			"Activate", "Activate", "Read", "Read"}))
+		Expect(rspAt[second.ID] - rspAt[first.ID]).To(Equal(uint64(2)))
+	})
+
+	It("should write the data when the request arrives", func() {
+		build(builder)
+
+		write := mem.WriteReqBuilder{}.
+			WithSrc("L2").
+			WithAddress(0x100).
+			WithData([]byte{5, 6, 7, 8}).
+			Build()
+		accept(write)
+		after := read(0x100)
+		run(0)
+
+		Expect(rsps[write.ID]).To(BeAssignableToTypeOf(&mem.WriteDoneRsp{}))
+		Expect(rsps[after.ID].(*mem.DataReadyRsp).Data[:4]).
+			To(Equal([]byte{5, 6, 7, 8}))
+		Expect(rspAt[after.ID]).To(BeNumerically(">", rspAt[write.ID]))
+	})
+
+	It("should refresh the rank when the refresh is due", func() {
+		build(builder)
+
+		read(0x0)
+		run(0)
+
+		second := read(0x0)
+		run(1000)
+
+		// The open row is closed at 1000 and the refresh waits for tRP.
+		Expect(recorder.commands[2:]).To(Equal([]string{
+			"Precharge", "Refresh", "Activate", "Read"}))
+		Expect(rspAt[second.ID]).To(Equal(uint64(1003 + 20 + 3 + 4 + 2)))
+		Expect(c.channels[0].ranks[0].refreshDue).To(Equal(uint64(2000)))
+	})
+
+	It("should not refresh again for the refreshes due while idle", func() {
+		build(builder)
+
+		read(0x0)
+		run(0)
+
+		ch := c.channels[0]
+		ch.skipIdleRefreshes(4500, timing)
+
+		Expect(ch.ranks[0].refreshDue).To(Equal(uint64(5000)))
+		Expect(ch.ranks[0].banks[0][0].isOpen).To(BeFalse())
+	})
+
+	It("should not accept the request if the queue is full", func() {
+		build(builder.WithQueueSize(1))
+
+		read(0x0)
+
+		req := mem.ReadReqBuilder{}.WithAddress(0x40).WithByteSize(64).Build()
+		top.EXPECT().PeekIncoming().Return(req)
+
+		Expect(c.parseTop()).To(BeFalse())
+	})
+
+	It("should remove the bits that interleave the controllers", func() {
+		build(builder.WithInterleavingAddrConversion(128, 4, 1, 0))
+
+		// 0x280 is the second block of the controller, so it follows 0x80 in
+		// the same row once the interleaving bits are removed.
+		read(0x80)
+		read(0x280)
+		run(0)
+
+		Expect(recorder.commands).To(Equal(
+			[]string{"Activate", "Read", "Read"}))
+	})
+
+	It("should panic if the page policy is not supported", func() {
+		Expect(func() {
+			builder.WithPagePolicy("adaptive").Build("DRAM")
+		}).To(Panic())
+	})
+})
@@ -0,0 +1,154 @@
+// Package dramtracer provides a tracer that collects the row-buffer and the
+// bandwidth statistics of a DRAM controller.
+package dramtracer
+
+import (
+	"sync"
+
+	"github.com/sarchlab/akita/v4/mem/mem"
+	"github.com/sarchlab/akita/v4/sim"
+	"github.com/sarchlab/akita/v4/tracing"
+)
+
+// A Tracer counts the commands that a DRAM controller issues and the bytes
+// that the controller serves.
+//
+// The tracer needs to be attached to the controller with
+// tracing.CollectTrace. The tracer also registers itself as a hook of the
+// controller with Register, so that the reporters can find it with Find.
+type Tracer struct {
+	sync.Mutex
+
+	// PeakBandwidth is the maximum number of bytes per second that the
+	// controller can transfer.
+	PeakBandwidth float64
+
+	numAccesses  uint64
+	numActivates uint64
+	numBytes     uint64
+}
+
+// NewTracer creates a Tracer for a controller that has the given peak
+// bandwidth in bytes per second.
+func NewTracer(peakBandwidth float64) *Tracer {
+	return &Tracer{PeakBandwidth: peakBandwidth}
+}
+
+// Register lets the tracer be found on the controller.
+func (t *Tracer) Register(ctrl sim.Hookable) {
+	ctrl.AcceptHook(t)
+}
+
+// Find returns the tracer that is registered on the controller. It returns nil
+// if there is no such tracer.
+func Find(ctrl sim.Hookable) *Tracer {
+	for _, h := range ctrl.Hooks() {
+		if t, ok := h.(*Tracer); ok {
+			return t
+		}
+	}
+
+	return nil
+}
+
+// Func does nothing. The tracer is a hook only so that it can be found on the
+// controller.
+func (t *Tracer) Func(_ sim.HookCtx) {
+	// Do nothing
+}
+
+// StartTask counts the commands and the requests.
+func (t *Tracer) StartTask(task tracing.Task) {
+	t.Lock()
+	defer t.Unlock()
+
+	switch task.Kind {
+	case "cmd":
+		t.countCommand(task.What)
+	case "req_in":
+		t.countBytes(task.Detail)
+	}
+}
+
+func (t *Tracer) countCommand(kind string) {
+	switch kind {
+	case "Activate":
+		t.numActivates++
+	case "Read", "ReadPrecharge", "Write", "WritePrecharge":
+		t.numAccesses++
+	}
+}
+
+func (t *Tracer) countBytes(detail interface{}) {
+	switch req := detail.(type) {
+	case *mem.ReadReq:
+		t.numBytes += req.AccessByteSize
+	case *mem.WriteReq:
+		t.numBytes += uint64(len(req.Data))
+	}
+}
+
+// StepTask does nothing
+func (t *Tracer) StepTask(_ tracing.Task) {
+	// Do nothing
+}
+
+// AddMilestone does nothing
+func (t *Tracer) AddMilestone(_ tracing.Milestone) {
+	// Do nothing
+}
+
+// EndTask does nothing
+func (t *Tracer) EndTask(_ tracing.Task) {
+	// Do nothing
+}
+
+// NumAccesses returns the number of read and write commands.
+func (t *Tracer) NumAccesses() uint64 {
+	t.Lock()
+	defer t.Unlock()
+
+	return t.numAccesses
+}
+
+// NumActivates returns the number of activate commands.
+func (t *Tracer) NumActivates() uint64 {
+	t.Lock()
+	defer t.Unlock()
+
+	return t.numActivates
+}
+
+// NumBytes returns the number of bytes that the controller serves.
+func (t *Tracer) NumBytes() uint64 {
+	t.Lock()
+	defer t.Unlock()
+
+	return t.numBytes
+}
+
+// RowBufferHitRate returns the fraction of the reads and writes that find
+// their rows open and do not need an activate command.
+func (t *Tracer) RowBufferHitRate() float64 {
+	t.Lock()
+	defer t.Unlock()
+
+	if t.numAccesses == 0 || t.numActivates >= t.numAccesses {
+		return 0
+	}
+
+	return float64(t.numAccesses-t.numActivates) / float64(t.numAccesses)
+}
+
+// BandwidthUtilization returns the fraction of the peak bandwidth that the
+// controller uses over the given duration.
+func (t *Tracer) BandwidthUtilization(duration sim.VTimeInSec) float64 {
+	t.Lock()
+	defer t.Unlock()
+
+	if duration <= 0 || t.PeakBandwidth <= 0 {
+		return 0
+	}
+
+	return float64(t.numBytes) / (t.PeakBandwidth * float64(duration))
+}
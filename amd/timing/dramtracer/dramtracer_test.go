@@ -0,0 +1,72 @@
+package dramtracer
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sarchlab/akita/v4/mem/mem"
+	"github.com/sarchlab/akita/v4/sim"
+	"github.com/sarchlab/akita/v4/tracing"
+)
+
+func TestDRAMTracer(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "DRAM Tracer")
+}
+
+var _ = Describe("Tracer", func() {
+	var t *Tracer
+
+	BeforeEach(func() {
+		t = NewTracer(64e9)
+	})
+
+	It("should calculate the row-buffer hit rate", func() {
+		t.StartTask(tracing.Task{Kind: "cmd", What: "Activate"})
+		t.StartTask(tracing.Task{Kind: "cmd", What: "Read"})
+		t.StartTask(tracing.Task{Kind: "cmd", What: "Read"})
+		t.StartTask(tracing.Task{Kind: "cmd", What: "Write"})
+		t.StartTask(tracing.Task{Kind: "cmd", What: "WritePrecharge"})
+		t.StartTask(tracing.Task{Kind: "cmd", What: "Precharge"})
+		t.StartTask(tracing.Task{Kind: "cmd", What: "Refresh"})
+
+		Expect(t.NumAccesses()).To(Equal(uint64(4)))
+		Expect(t.NumActivates()).To(Equal(uint64(1)))
+		Expect(t.RowBufferHitRate()).To(Equal(0.75))
+	})
+
+	It("should not report hits if every access activates a row", func() {
+		t.StartTask(tracing.Task{Kind: "cmd", What: "Activate"})
+		t.StartTask(tracing.Task{Kind: "cmd", What: "ReadPrecharge"})
+
+		Expect(t.RowBufferHitRate()).To(Equal(0.0))
+	})
+
+	It("should calculate the bandwidth utilization", func() {
+		read := mem.ReadReqBuilder{}.WithByteSize(64).Build()
+		write := mem.WriteReqBuilder{}.WithData(make([]byte, 64)).Build()
+		t.StartTask(tracing.Task{Kind: "req_in", Detail: read})
+		t.StartTask(tracing.Task{Kind: "req_in", Detail: write})
+
+		Expect(t.NumBytes()).To(Equal(uint64(128)))
+		Expect(t.BandwidthUtilization(1e-9)).To(BeNumerically("~", 2.0))
+		Expect(t.BandwidthUtilization(0)).To(Equal(0.0))
+	})
+
+	It("should not count the commands as bytes", func() {
+		t.StartTask(tracing.Task{Kind: "cmd", What: "ReadPrecharge"})
+
+		Expect(t.NumBytes()).To(Equal(uint64(0)))
+		Expect(t.NumAccesses()).To(Equal(uint64(1)))
+	})
+
+	It("should be found on the controller", func() {
+		ctrl := sim.NewHookableBase()
+		Expect(Find(ctrl)).To(BeNil())
+
+		t.Register(ctrl)
+
+		Expect(Find(ctrl)).To(BeIdenticalTo(t))
+	})
+})
@@ -0,0 +1,82 @@
+package hostmemory
+
+import (
+	"github.com/sarchlab/akita/v4/mem/mem"
+	"github.com/sarchlab/akita/v4/sim"
+	"github.com/sarchlab/mgpusim/v4/amd/timing/cp"
+)
+
+// A Builder can build host memory components.
+type Builder struct {
+	engine      sim.Engine
+	freq        sim.Freq
+	storage     *mem.Storage
+	hostLink    string
+	bufferSize  int
+	maxInflight int
+}
+
+// MakeBuilder creates a new builder with default configuration values.
+func MakeBuilder() Builder {
+	return Builder{
+		freq:        1 * sim.GHz,
+		hostLink:    "pcie4",
+		bufferSize:  64,
+		maxInflight: 64,
+	}
+}
+
+// WithEngine sets the even-driven simulation engine to use.
+func (b Builder) WithEngine(engine sim.Engine) Builder {
+	b.engine = engine
+	return b
+}
+
+// WithFreq sets the frequency that the host memory works at.
+func (b Builder) WithFreq(freq sim.Freq) Builder {
+	b.freq = freq
+	return b
+}
+
+// WithStorage sets the storage that holds the data of the host memory.
+func (b Builder) WithStorage(storage *mem.Storage) Builder {
+	b.storage = storage
+	return b
+}
+
+// WithHostLink sets the link that the GPUs that do not register their own
+// link access the host memory through. The link can be "ideal", "pcie3",
+// "pcie4", or "pcie5".
+func (b Builder) WithHostLink(link string) Builder {
+	b.hostLink = link
+	return b
+}
+
+// WithBufferSize sets the number of messages that the port can buffer.
+func (b Builder) WithBufferSize(n int) Builder {
+	b.bufferSize = n
+	return b
+}
+
+// WithMaxInflight sets the number of accesses that the host memory can serve
+// at the same time.
+func (b Builder) WithMaxInflight(n int) Builder {
+	b.maxInflight = n
+	return b
+}
+
+// Build creates a host memory component with the given parameters.
+func (b Builder) Build(name string) *Comp {
+	c := &Comp{}
+	c.TickingComponent = sim.NewTickingComponent(name, b.engine, b.freq, c)
+
+	c.Storage = b.storage
+	c.hostLink = b.hostLink
+	c.maxInflight = b.maxInflight
+	c.links = make(map[sim.RemotePort]*cp.HostLink)
+
+	c.Top = sim.NewPort(c, b.bufferSize, b.bufferSize, name+".Top")
+	c.AddPort("Top", c.Top)
+
+	return c
+}
@@ -0,0 +1,178 @@
+// Package hostmemory provides a component that serves the memory accesses
+// that the GPUs make to the host memory.
+package hostmemory
+
+import (
+	"log"
+	"reflect"
+
+	"github.com/sarchlab/akita/v4/mem/mem"
+	"github.com/sarchlab/akita/v4/sim"
+	"github.com/sarchlab/akita/v4/tracing"
+	"github.com/sarchlab/mgpusim/v4/amd/timing/cp"
+)
+
+// A pendingRsp is a response that is sent when its data crosses the host
+// link.
+type pendingRsp struct {
+	req       mem.AccessReq
+	rsp       sim.Msg
+	readyTime sim.VTimeInSec
+}
+
+// A Comp is the host memory as the GPUs see it. The GPUs send the memory
+// accesses to the host memory through their RDMA engines, so that kernels can
+// read and write host memory without copying it first (zero-copy). Every
+// access pays the bandwidth and the latency of the host link of the GPU that
+// makes the access.
+type Comp struct {
+	*sim.TickingComponent
+
+	Top sim.Port
+
+	// Storage holds the data of the host memory.
+	Storage *mem.Storage
+
+	hostLink    string
+	links       map[sim.RemotePort]*cp.HostLink
+	maxInflight int
+	pending     []pendingRsp
+}
+
+// SetLink lets the accesses that come from the given port go through the
+// given link. The GPUs that share the link with their DMA engines compete
+// with their memory copies for bandwidth.
+func (c *Comp) SetLink(src sim.RemotePort, link *cp.HostLink) {
+	c.links[src] = link
+}
+
+// Tick updates the state of the host memory.
+func (c *Comp) Tick() bool {
+	madeProgress := false
+
+	madeProgress = c.respond() || madeProgress
+	madeProgress = c.serve() || madeProgress
+
+	return madeProgress
+}
+
+func (c *Comp) link(src sim.RemotePort) *cp.HostLink {
+	link, ok := c.links[src]
+	if !ok {
+		link = cp.NewHostLink(c.hostLink)
+		c.links[src] = link
+	}
+
+	return link
+}
+
+// respond sends the first response whose data has crossed the host link. It
+// keeps the component ticking while the data is on the link.
+func (c *Comp) respond() bool {
+	if len(c.pending) == 0 {
+		return false
+	}
+
+	now := c.CurrentTime()
+	for i, p := range c.pending {
+		if p.readyTime > now {
+			continue
+		}
+
+		err := c.Top.Send(p.rsp)
+		if err != nil {
+			return true
+		}
+
+		tracing.TraceReqComplete(p.req, c)
+		c.pending = append(c.pending[:i], c.pending[i+1:]...)
+
+		return true
+	}
+
+	return true
+}
+
+func (c *Comp) serve() bool {
+	if len(c.pending) >= c.maxInflight {
+		return false
+	}
+
+	msg := c.Top.RetrieveIncoming()
+	if msg == nil {
+		return false
+	}
+
+	switch req := msg.(type) {
+	case *mem.ReadReq:
+		c.serveRead(req)
+	case *mem.WriteReq:
+		c.serveWrite(req)
+	default:
+		log.Panicf("cannot process request of type %s", reflect.TypeOf(msg))
+	}
+
+	return true
+}
+
+func (c *Comp) serveRead(req *mem.ReadReq) {
+	tracing.TraceReqReceive(req, c)
+
+	data, err := c.Storage.Read(req.Address, req.AccessByteSize)
+	if err != nil {
+		panic(err)
+	}
+
+	rsp := mem.DataReadyRspBuilder{}.
+		WithSrc(c.Top.AsRemote()).
+		WithDst(req.Src).
+		WithRspTo(req.ID).
+		WithData(data).
+		Build()
+
+	readyTime := c.link(req.Src).Transfer(
+		cp.HostToDevice, req.AccessByteSize, c.CurrentTime())
+	c.pending = append(c.pending, pendingRsp{
+		req:       req,
+		rsp:       rsp,
+		readyTime: readyTime,
+	})
+}
+
+func (c *Comp) serveWrite(req *mem.WriteReq) {
+	tracing.TraceReqReceive(req, c)
+
+	data := req.Data
+	if req.DirtyMask != nil {
+		var err error
+		data, err = c.Storage.Read(req.Address, uint64(len(req.Data)))
+		if err != nil {
+			panic(err)
+		}
+
+		for i := range req.Data {
+			if req.DirtyMask[i] {
+				data[i] = req.Data[i]
+			}
+		}
+	}
+
+	err := c.Storage.Write(req.Address, data)
+	if err != nil {
+		panic(err)
+	}
+
+	rsp := mem.WriteDoneRspBuilder{}.
+		WithSrc(c.Top.AsRemote()).
+		WithDst(req.Src).
+		WithRspTo(req.ID).
+		Build()
+
+	readyTime := c.link(req.Src).Transfer(
+		cp.DeviceToHost, uint64(len(req.Data)), c.CurrentTime())
+	c.pending = append(c.pending, pendingRsp{
+		req:       req,
+		rsp:       rsp,
+		readyTime: readyTime,
+	})
+}
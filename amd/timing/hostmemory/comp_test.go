@@ -0,0 +1,106 @@
+package hostmemory
+
+import (
+	"log"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sarchlab/akita/v4/mem/mem"
+	"github.com/sarchlab/akita/v4/sim"
+	"github.com/sarchlab/mgpusim/v4/amd/timing/cp"
+	"go.uber.org/mock/gomock"
+)
+
+//go:generate mockgen -destination "mock_sim_test.go" -package $GOPACKAGE -write_package_comment=false github.com/sarchlab/akita/v4/sim Port,Engine
+
+func TestHostMemory(t *testing.T) {
+	log.SetOutput(GinkgoWriter)
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Host Memory")
+}
+
+var _ = Describe("Comp", func() {
+	var (
+		mockCtrl *gomock.Controller
+		engine   *MockEngine
+		top      *MockPort
+		storage  *mem.Storage
+		c        *Comp
+		now      sim.VTimeInSec
+	)
+
+	BeforeEach(func() {
+		mockCtrl = gomock.NewController(GinkgoT())
+		engine = NewMockEngine(mockCtrl)
+		top = NewMockPort(mockCtrl)
+		storage = mem.NewStorage(4 * mem.KB)
+		now = 0
+
+		engine.EXPECT().CurrentTime().DoAndReturn(func() sim.VTimeInSec {
+			return now
+		}).AnyTimes()
+		top.EXPECT().AsRemote().Return(sim.RemotePort("Host.Top")).AnyTimes()
+
+		c = MakeBuilder().
+			WithEngine(engine).
+			WithStorage(storage).
+			WithMaxInflight(1).
+			Build("Host")
+		c.Top = top
+	})
+
+	AfterEach(func() {
+		mockCtrl.Finish()
+	})
+
+	It("should respond to reads after the data crosses the host link", func() {
+		Expect(storage.Write(0x40, []byte{1, 2, 3, 4})).To(Succeed())
+		c.SetLink("GPU1.RDMA", &cp.HostLink{Bandwidth: 4e9, Latency: 1e-9})
+
+		read := mem.ReadReqBuilder{}.
+			WithSrc("GPU1.RDMA").
+			WithAddress(0x40).
+			WithByteSize(4).
+			Build()
+		top.EXPECT().RetrieveIncoming().Return(read)
+
+		Expect(c.Tick()).To(BeTrue())
+
+		now = 1e-9
+		Expect(c.respond()).To(BeTrue())
+
+		now = 2e-9
+		top.EXPECT().Send(gomock.Any()).Do(func(msg sim.Msg) {
+			rsp := msg.(*mem.DataReadyRsp)
+			Expect(rsp.RespondTo).To(Equal(read.ID))
+			Expect(rsp.Data).To(Equal([]byte{1, 2, 3, 4}))
+		}).Return(nil)
+
+		Expect(c.respond()).To(BeTrue())
+		Expect(c.pending).To(BeEmpty())
+	})
+
+	It("should write the dirty bytes", func() {
+		write := mem.WriteReqBuilder{}.
+			WithSrc("GPU1.RDMA").
+			WithAddress(0x40).
+			WithData([]byte{1, 2, 3, 4}).
+			WithDirtyMask([]bool{true, false, true, false}).
+			Build()
+		top.EXPECT().RetrieveIncoming().Return(write)
+
+		c.serve()
+
+		data, _ := storage.Read(0x40, 4)
+		Expect(data).To(Equal([]byte{1, 0, 3, 0}))
+		Expect(c.pending[0].rsp.(*mem.WriteDoneRsp).RespondTo).
+			To(Equal(write.ID))
+	})
+
+	It("should not serve more than the max number of accesses", func() {
+		c.pending = append(c.pending, pendingRsp{readyTime: 1})
+
+		Expect(c.serve()).To(BeFalse())
+	})
+})
@@ -6,8 +6,76 @@ import (
 
 	"github.com/sarchlab/akita/v4/mem/mem"
 	"github.com/sarchlab/akita/v4/sim"
+	"github.com/sarchlab/mgpusim/v4/amd/timing/rdma"
 )
 
+// A LinkFinder finds the link to the device that owns a port. The RDMA engine
+// of the GPU is a LinkFinder.
+type LinkFinder interface {
+	LinkTo(dst sim.RemotePort) *rdma.Link
+}
+
+// A MigrationRecord is the latency breakdown of a page migration.
+type MigrationRecord struct {
+	PageSize  uint64
+	NumChunks int
+
+	// QueueTime is the time that the migration waits for the PMC to start it.
+	QueueTime sim.VTimeInSec
+
+	// Latency is the time from the start of the migration to the last chunk
+	// being written to the local memory.
+	Latency sim.VTimeInSec
+
+	// ReadTime, LinkWaitTime, TransferTime, and WriteTime are the average time
+	// that a chunk spends reading the remote memory, waiting for the link,
+	// crossing the link, and writing the local memory. The chunks overlap, so
+	// the stages may add up to more than the latency.
+	ReadTime     sim.VTimeInSec
+	LinkWaitTime sim.VTimeInSec
+	TransferTime sim.VTimeInSec
+	WriteTime    sim.VTimeInSec
+}
+
+// migration is a page migration that the PMC performs by pulling the page
+// from the PMC of another GPU in chunks.
+type migration struct {
+	req         *PageMigrationReqToPMC
+	arrivalTime sim.VTimeInSec
+	startTime   sim.VTimeInSec
+
+	numChunks    int
+	numIssued    int
+	numInflight  int
+	numCompleted int
+
+	readTime     sim.VTimeInSec
+	linkWaitTime sim.VTimeInSec
+	transferTime sim.VTimeInSec
+	writeTime    sim.VTimeInSec
+}
+
+// chunk is a piece of a page that is being pulled or written.
+type chunk struct {
+	migration  *migration
+	writeAddr  uint64
+	writeStart sim.VTimeInSec
+}
+
+// servedPull is a pull request from another PMC that is reading the local
+// memory.
+type servedPull struct {
+	req       *DataPullReq
+	readStart sim.VTimeInSec
+}
+
+// linkPacket is a response that travels across the link to the requesting
+// PMC.
+type linkPacket struct {
+	rsp       *DataPullRsp
+	arrivalAt sim.VTimeInSec
+}
+
 // PageMigrationController control page migration
 type PageMigrationController struct {
 	*sim.TickingComponent
@@ -18,37 +86,69 @@ type PageMigrationController struct {
 
 	RemotePMCAddressTable mem.AddressToPortMapper
 
-	currentMigrationRequest      *PageMigrationReqToPMC
+	pendingMigrations []*migration
+	activeMigrations  []*migration
+	pullIDToChunk     map[string]*chunk
+	writeIDToChunk    map[string]*chunk
+
 	currentPullReqFromAnotherPMC []*DataPullReq
+	servedPulls                  map[string]*servedPull
 
 	toPullFromAnotherPMC         []*DataPullReq
 	toSendLocalMemPort           []*mem.ReadReq
 	dataReadyRspFromMemCtrl      []*mem.DataReadyRsp
-	toRspToAnotherPMC            []*DataPullRsp
+	toRspToAnotherPMC            []*linkPacket
 	receivedDataFromAnothePMC    []*DataPullRsp
 	writeReqLocalMemPort         []*mem.WriteReq
-	receivedWriteDoneFromMemCtrl *mem.WriteDoneRsp
-	toSendToCtrlPort             *PageMigrationRspFromPMC
+	receivedWriteDoneFromMemCtrl []*mem.WriteDoneRsp
+	toSendToCtrlPort             []*PageMigrationRspFromPMC
 
 	onDemandPagingDataTransferSize uint64
+	maxOutstandingMigrations       int
+	maxInflightChunks              int
 
-	requestingPMCtrlPort sim.RemotePort
-
-	numDataRspPendingForPageMigration int
-	reqIDToWriteAddressMap            map[string]uint64
+	// linkFinder finds the links that the PMC sends the data to the other
+	// PMCs through. The PMC shares the links with the remote accesses.
+	linkFinder LinkFinder
 
 	MemCtrlFinder mem.AddressToPortMapper
 
-	DataTransferStartTime sim.VTimeInSec
-	DataTransferEndTime   sim.VTimeInSec
+	records               []MigrationRecord
 	TotalDataTransferTime sim.VTimeInSec
+}
+
+// SetDataTransferSize sets the number of bytes that each data pull request
+// carries.
+func (e *PageMigrationController) SetDataTransferSize(n uint64) {
+	e.onDemandPagingDataTransferSize = n
+}
+
+// SetMaxOutstandingMigrations sets the number of page migrations that the
+// PMC performs at the same time.
+func (e *PageMigrationController) SetMaxOutstandingMigrations(n int) {
+	e.maxOutstandingMigrations = n
+}
+
+// SetMaxInflightChunks sets the number of chunks of a page that can be pulled
+// and written at the same time. Keeping several chunks in flight overlaps the
+// reading, the transfer, and the writing of the chunks.
+func (e *PageMigrationController) SetMaxInflightChunks(n int) {
+	e.maxInflightChunks = n
+}
+
+// SetLinkFinder sets where the PMC finds the link to each of the other PMCs.
+// Without a LinkFinder, the data is transferred instantly.
+func (e *PageMigrationController) SetLinkFinder(f LinkFinder) {
+	e.linkFinder = f
+}
 
-	isHandlingPageMigration bool
+// MigrationRecords returns the latency breakdowns of the completed page
+// migrations, in the order that they complete.
+func (e *PageMigrationController) MigrationRecords() []MigrationRecord {
+	return e.records
 }
 
 // Tick updates the status of a PageMigrationController.
-//
-//nolint:gocyclo
 func (e *PageMigrationController) Tick() bool {
 	madeProgress := false
 
@@ -61,6 +161,7 @@ func (e *PageMigrationController) Tick() bool {
 	madeProgress = e.processFromCtrlPort() || madeProgress
 	madeProgress = e.processFromMemCtrl() || madeProgress
 	madeProgress = e.processPageMigrationReqFromCtrlPort() || madeProgress
+	madeProgress = e.issueDataPulls() || madeProgress
 	madeProgress = e.processReadPageReqFromAnotherPMC() || madeProgress
 	madeProgress = e.processDataReadyRspFromMemCtrl() || madeProgress
 	madeProgress = e.processDataPullRsp() || madeProgress
@@ -87,18 +188,11 @@ func (e *PageMigrationController) processFromOutside() bool {
 }
 
 func (e *PageMigrationController) processFromCtrlPort() bool {
-	//PMC handles only one page migration req at a time
-	if e.isHandlingPageMigration {
-		return false
-	}
-
 	req := e.ctrlPort.RetrieveIncoming()
 	if req == nil {
 		return false
 	}
 
-	e.DataTransferStartTime = e.TickingComponent.TickScheduler.CurrentTime()
-
 	switch req := req.(type) {
 	case *PageMigrationReqToPMC:
 		return e.handleMigrationReqFromCtrlPort(req)
@@ -111,45 +205,66 @@ func (e *PageMigrationController) processFromCtrlPort() bool {
 func (e *PageMigrationController) handleMigrationReqFromCtrlPort(
 	req *PageMigrationReqToPMC,
 ) bool {
-	e.currentMigrationRequest = req
+	e.pendingMigrations = append(e.pendingMigrations, &migration{
+		req:         req,
+		arrivalTime: e.CurrentTime(),
+	})
+
 	return true
 }
 
+// processPageMigrationReqFromCtrlPort starts the pending migrations while
+// fewer than the maximum number of migrations are in progress.
 func (e *PageMigrationController) processPageMigrationReqFromCtrlPort() bool {
-	if e.currentMigrationRequest == nil {
-		return false
-	}
+	madeProgress := false
 
-	if e.isHandlingPageMigration {
-		return false
-	}
+	for len(e.pendingMigrations) > 0 &&
+		len(e.activeMigrations) < e.maxOutstandingMigrations {
+		m := e.pendingMigrations[0]
+		e.pendingMigrations = e.pendingMigrations[1:]
 
-	destination := e.currentMigrationRequest.PMCPortOfRemoteGPU
-	pageSize := e.currentMigrationRequest.PageSize
+		//Break down each request into the data transfer size supported by PMC
+		size := e.onDemandPagingDataTransferSize
+		m.numChunks = int((m.req.PageSize + size - 1) / size)
+		m.startTime = e.CurrentTime()
 
-	//Break down each request into the data transfer size supported by PMC
-	numDataTransfersForPage := pageSize / e.onDemandPagingDataTransferSize
-	startingPhysicalAddress := e.currentMigrationRequest.ToReadFromPhysicalAddress
+		e.activeMigrations = append(e.activeMigrations, m)
+		madeProgress = true
+	}
 
-	e.numDataRspPendingForPageMigration = int(numDataTransfersForPage)
-	currentWriteAddress := e.currentMigrationRequest.ToWriteToPhysicalAddress
+	return madeProgress
+}
 
-	for i := 0; i < int(numDataTransfersForPage); i++ {
-		req := DataPullReqBuilder{}.
-			WithSrc(e.remotePort.AsRemote()).
-			WithDst(destination).
-			WithDataTransferSize(e.onDemandPagingDataTransferSize).
-			WithReadFromPhyAddress(startingPhysicalAddress).
-			Build()
-		startingPhysicalAddress = startingPhysicalAddress + e.onDemandPagingDataTransferSize
-		e.toPullFromAnotherPMC = append(e.toPullFromAnotherPMC, req)
-		e.reqIDToWriteAddressMap[req.ID] = currentWriteAddress
-		currentWriteAddress = currentWriteAddress + e.onDemandPagingDataTransferSize
+// issueDataPulls pulls the next chunks of the migrations in progress, keeping
+// at most the maximum number of chunks of each migration in flight.
+func (e *PageMigrationController) issueDataPulls() bool {
+	madeProgress := false
+	size := e.onDemandPagingDataTransferSize
+
+	for _, m := range e.activeMigrations {
+		for m.numInflight < e.maxInflightChunks && m.numIssued < m.numChunks {
+			offset := uint64(m.numIssued) * size
+			transferSize := min(size, m.req.PageSize-offset)
+
+			req := DataPullReqBuilder{}.
+				WithSrc(e.remotePort.AsRemote()).
+				WithDst(m.req.PMCPortOfRemoteGPU).
+				WithDataTransferSize(transferSize).
+				WithReadFromPhyAddress(m.req.ToReadFromPhysicalAddress + offset).
+				Build()
+			e.toPullFromAnotherPMC = append(e.toPullFromAnotherPMC, req)
+			e.pullIDToChunk[req.ID] = &chunk{
+				migration: m,
+				writeAddr: m.req.ToWriteToPhysicalAddress + offset,
+			}
+
+			m.numIssued++
+			m.numInflight++
+			madeProgress = true
+		}
 	}
 
-	e.isHandlingPageMigration = true
-
-	return true
+	return madeProgress
 }
 
 func (e *PageMigrationController) sendMigrationReqToAnotherPMC() bool {
@@ -180,7 +295,6 @@ func (e *PageMigrationController) handleDataPullReq(
 ) bool {
 	e.remotePort.RetrieveIncoming()
 	e.currentPullReqFromAnotherPMC = append(e.currentPullReqFromAnotherPMC, req)
-	e.requestingPMCtrlPort = req.Src
 	return true
 }
 
@@ -190,8 +304,9 @@ func (e *PageMigrationController) processReadPageReqFromAnotherPMC() bool {
 	}
 
 	for i := 0; i < len(e.currentPullReqFromAnotherPMC); i++ {
-		address := e.currentPullReqFromAnotherPMC[i].ToReadFromPhyAddress
-		dataTransferSize := e.currentPullReqFromAnotherPMC[i].DataTransferSize
+		pull := e.currentPullReqFromAnotherPMC[i]
+		address := pull.ToReadFromPhyAddress
+		dataTransferSize := pull.DataTransferSize
 		req := mem.ReadReqBuilder{}.
 			WithSrc(e.localMemPort.AsRemote()).
 			WithDst(e.MemCtrlFinder.Find(address)).
@@ -199,8 +314,12 @@ func (e *PageMigrationController) processReadPageReqFromAnotherPMC() bool {
 			WithByteSize(dataTransferSize).
 			Build()
 
-		req.ID = e.currentPullReqFromAnotherPMC[i].ID
+		req.ID = pull.ID
 		e.toSendLocalMemPort = append(e.toSendLocalMemPort, req)
+		e.servedPulls[pull.ID] = &servedPull{
+			req:       pull,
+			readStart: e.CurrentTime(),
+		}
 	}
 
 	e.currentPullReqFromAnotherPMC = nil
@@ -259,42 +378,89 @@ func (e *PageMigrationController) processDataReadyRspFromMemCtrl() bool {
 		return false
 	}
 
+	now := e.CurrentTime()
+
 	for i := 0; i < len(e.dataReadyRspFromMemCtrl); i++ {
-		data := e.dataReadyRspFromMemCtrl[i].Data
+		dataReady := e.dataReadyRspFromMemCtrl[i]
+		served, found := e.servedPulls[dataReady.RespondTo]
+		if !found {
+			log.Panicf("cannot find the pull request of the data")
+		}
+		delete(e.servedPulls, dataReady.RespondTo)
+
 		rsp := DataPullRspBuilder{}.
 			WithSrc(e.remotePort.AsRemote()).
-			WithDst(e.requestingPMCtrlPort).
-			WithData(data).
+			WithDst(served.req.Src).
+			WithData(dataReady.Data).
 			Build()
-		rsp.ID = e.dataReadyRspFromMemCtrl[i].RespondTo
+		rsp.ID = dataReady.RespondTo
+		rsp.ReadTime = now - served.readStart
 
-		e.toRspToAnotherPMC = append(e.toRspToAnotherPMC, rsp)
+		e.transferOverLink(rsp, now)
 	}
 
 	e.dataReadyRspFromMemCtrl = nil
 	return true
 }
 
+// transferOverLink serializes a response on the link to the requesting PMC
+// after the packets that are already on it, and records the time that the
+// response waits for and spends on the link.
+func (e *PageMigrationController) transferOverLink(
+	rsp *DataPullRsp,
+	now sim.VTimeInSec,
+) {
+	arrivalAt := now
+	rsp.LinkWaitTime = 0
+	rsp.TransferTime = 0
+
+	if link := e.findLink(rsp.Dst); link != nil {
+		var start sim.VTimeInSec
+
+		start, arrivalAt = link.Reserve(uint64(len(rsp.Data)), now)
+		rsp.LinkWaitTime = start - now
+		rsp.TransferTime = arrivalAt - start
+	}
+
+	e.toRspToAnotherPMC = append(e.toRspToAnotherPMC, &linkPacket{
+		rsp:       rsp,
+		arrivalAt: arrivalAt,
+	})
+}
+
+func (e *PageMigrationController) findLink(dst sim.RemotePort) *rdma.Link {
+	if e.linkFinder == nil {
+		return nil
+	}
+
+	return e.linkFinder.LinkTo(dst)
+}
+
+// sendDataReadyRspToRequestingPMC delivers the responses that have crossed
+// the link in order. It keeps the PMC ticking while any response is on the
+// link.
 func (e *PageMigrationController) sendDataReadyRspToRequestingPMC() bool {
 	if len(e.toRspToAnotherPMC) == 0 {
 		return false
 	}
 
-	madeProgress := false
-	newInToSendRspToAnotherPMC := make([]*DataPullRsp, 0)
+	now := e.CurrentTime()
 
-	for i := 0; i < len(e.toRspToAnotherPMC); i++ {
-		sendPacket := e.toRspToAnotherPMC[i]
-		sendErr := e.remotePort.Send(sendPacket)
-		if sendErr == nil {
-			madeProgress = true
-		} else {
-			newInToSendRspToAnotherPMC = append(newInToSendRspToAnotherPMC, sendPacket)
+	for len(e.toRspToAnotherPMC) > 0 {
+		packet := e.toRspToAnotherPMC[0]
+		if packet.arrivalAt > now {
+			break
+		}
+
+		sendErr := e.remotePort.Send(packet.rsp)
+		if sendErr != nil {
+			break
 		}
+
+		e.toRspToAnotherPMC = e.toRspToAnotherPMC[1:]
 	}
 
-	e.toRspToAnotherPMC = newInToSendRspToAnotherPMC
-	return madeProgress
+	return true
 }
 
 func (e *PageMigrationController) handleDataPullRsp(
@@ -311,20 +477,27 @@ func (e *PageMigrationController) processDataPullRsp() bool {
 	}
 
 	for i := 0; i < len(e.receivedDataFromAnothePMC); i++ {
-		data := e.receivedDataFromAnothePMC[i].Data
-		address, found := e.reqIDToWriteAddressMap[e.receivedDataFromAnothePMC[i].ID]
+		rsp := e.receivedDataFromAnothePMC[i]
+		c, found := e.pullIDToChunk[rsp.ID]
 		if !found {
 			log.Panicf("We do not know where the mem controller should write")
 		}
+		delete(e.pullIDToChunk, rsp.ID)
+
+		c.migration.readTime += rsp.ReadTime
+		c.migration.linkWaitTime += rsp.LinkWaitTime
+		c.migration.transferTime += rsp.TransferTime
+
 		req := mem.WriteReqBuilder{}.
 			WithSrc(e.localMemPort.AsRemote()).
-			WithDst(e.MemCtrlFinder.Find(address)).
-			WithData(data).
-			WithAddress(address).
+			WithDst(e.MemCtrlFinder.Find(c.writeAddr)).
+			WithData(rsp.Data).
+			WithAddress(c.writeAddr).
 			Build()
 
+		c.writeStart = e.CurrentTime()
+		e.writeIDToChunk[req.ID] = c
 		e.writeReqLocalMemPort = append(e.writeReqLocalMemPort, req)
-		delete(e.reqIDToWriteAddressMap, e.receivedDataFromAnothePMC[i].ID)
 	}
 
 	e.receivedDataFromAnothePMC = nil
@@ -342,7 +515,6 @@ func (e *PageMigrationController) sendWriteReqLocalMemPort() bool {
 	for i := 0; i < len(e.writeReqLocalMemPort); i++ {
 		err := e.localMemPort.Send(e.writeReqLocalMemPort[i])
 		if err == nil {
-			//log.Printf("Sending write req to mem ctrl with ID %d", e.writeReqLocalMemPort[i].ID)
 			madeProgress = true
 		} else {
 			newInWriteReqLocalMemPort = append(newInWriteReqLocalMemPort, e.writeReqLocalMemPort[i])
@@ -356,7 +528,7 @@ func (e *PageMigrationController) sendWriteReqLocalMemPort() bool {
 func (e *PageMigrationController) handleWriteDoneRspFromMemCtrl(
 	rsp *mem.WriteDoneRsp,
 ) bool {
-	e.receivedWriteDoneFromMemCtrl = rsp
+	e.receivedWriteDoneFromMemCtrl = append(e.receivedWriteDoneFromMemCtrl, rsp)
 	return true
 }
 
@@ -365,44 +537,77 @@ func (e *PageMigrationController) processWriteDoneRspFromMemCtrl() bool {
 		return false
 	}
 
-	e.numDataRspPendingForPageMigration--
-	e.receivedWriteDoneFromMemCtrl = nil
+	now := e.CurrentTime()
 
-	if e.numDataRspPendingForPageMigration < 0 {
-		log.Panicf("Not possible")
-	}
-	if e.numDataRspPendingForPageMigration == 0 {
-		//log.Printf("Sending migration complete rsp to CtrlPort \n")
-		rsp := PageMigrationRspFromPMCBuilder{}.
-			WithSrc(e.ctrlPort.AsRemote()).
-			WithDst(e.currentMigrationRequest.Src).
-			Build()
+	for _, rsp := range e.receivedWriteDoneFromMemCtrl {
+		c, found := e.writeIDToChunk[rsp.RespondTo]
+		if !found {
+			log.Panicf("cannot find the chunk of the write")
+		}
+		delete(e.writeIDToChunk, rsp.RespondTo)
+
+		m := c.migration
+		m.writeTime += now - c.writeStart
+		m.numInflight--
+		m.numCompleted++
 
-		e.toSendToCtrlPort = rsp
-		e.currentMigrationRequest = nil
-		e.numDataRspPendingForPageMigration = -1
+		if m.numCompleted == m.numChunks {
+			e.completeMigration(m, now)
+		}
 	}
 
+	e.receivedWriteDoneFromMemCtrl = nil
 	return true
 }
 
+// completeMigration records the latency breakdown of a migration and prepares
+// the response to the Command Processor.
+func (e *PageMigrationController) completeMigration(
+	m *migration,
+	now sim.VTimeInSec,
+) {
+	numChunks := sim.VTimeInSec(m.numChunks)
+
+	e.records = append(e.records, MigrationRecord{
+		PageSize:     m.req.PageSize,
+		NumChunks:    m.numChunks,
+		QueueTime:    m.startTime - m.arrivalTime,
+		Latency:      now - m.startTime,
+		ReadTime:     m.readTime / numChunks,
+		LinkWaitTime: m.linkWaitTime / numChunks,
+		TransferTime: m.transferTime / numChunks,
+		WriteTime:    m.writeTime / numChunks,
+	})
+	e.TotalDataTransferTime += now - m.arrivalTime
+
+	for i, active := range e.activeMigrations {
+		if active == m {
+			e.activeMigrations = append(e.activeMigrations[:i],
+				e.activeMigrations[i+1:]...)
+			break
+		}
+	}
+
+	rsp := PageMigrationRspFromPMCBuilder{}.
+		WithSrc(e.ctrlPort.AsRemote()).
+		WithDst(m.req.Src).
+		Build()
+	e.toSendToCtrlPort = append(e.toSendToCtrlPort, rsp)
+}
+
 func (e *PageMigrationController) sendMigrationCompleteRspToCtrlPort() bool {
-	if e.toSendToCtrlPort == nil {
+	if len(e.toSendToCtrlPort) == 0 {
 		return false
 	}
 
-	err := e.ctrlPort.Send(e.toSendToCtrlPort)
-
-	if err == nil {
-		e.DataTransferEndTime = e.TickingComponent.TickScheduler.CurrentTime()
-		e.TotalDataTransferTime = e.TotalDataTransferTime + (e.DataTransferEndTime - e.DataTransferStartTime)
-		e.isHandlingPageMigration = false
-		e.currentMigrationRequest = nil
-		e.toSendToCtrlPort = nil
-		return true
+	err := e.ctrlPort.Send(e.toSendToCtrlPort[0])
+	if err != nil {
+		return false
 	}
 
-	return false
+	e.toSendToCtrlPort = e.toSendToCtrlPort[1:]
+
+	return true
 }
 
 // SetFreq sets freq
@@ -427,15 +632,20 @@ func NewPageMigrationController(
 	e.localMemPort = sim.NewPort(e, 1, 1, name+"LocalMemPort")
 	e.AddPort("LocalMem", e.localMemPort)
 
-	e.ctrlPort = sim.NewPort(e, 1, 1, name+"CtrlPort")
+	// The Command Processor may forward several migrations before the PMC
+	// ticks.
+	e.ctrlPort = sim.NewPort(e, 64, 64, name+"CtrlPort")
 	e.AddPort("Control", e.ctrlPort)
 
 	e.RemotePMCAddressTable = remoteModules
 
 	e.onDemandPagingDataTransferSize = 64
-	e.numDataRspPendingForPageMigration = -1
+	e.maxOutstandingMigrations = 4
+	e.maxInflightChunks = 16
 
-	e.reqIDToWriteAddressMap = make(map[string]uint64)
+	e.pullIDToChunk = make(map[string]*chunk)
+	e.writeIDToChunk = make(map[string]*chunk)
+	e.servedPulls = make(map[string]*servedPull)
 
 	return e
 }
@@ -8,6 +8,7 @@ import (
 	. "github.com/onsi/gomega"
 	"github.com/sarchlab/akita/v4/mem/mem"
 	"github.com/sarchlab/akita/v4/sim"
+	"github.com/sarchlab/mgpusim/v4/amd/timing/rdma"
 	"go.uber.org/mock/gomock"
 )
 
@@ -64,6 +65,7 @@ var _ = Describe("PMC", func() {
 		RemotePort.EXPECT().AsRemote().AnyTimes()
 		ctrlPort.EXPECT().AsRemote().AnyTimes()
 		LocalMemPort.EXPECT().AsRemote().AnyTimes()
+		engine.EXPECT().CurrentTime().Return(sim.VTimeInSec(10)).AnyTimes()
 	})
 
 	AfterEach(func() {
@@ -79,29 +81,59 @@ var _ = Describe("PMC", func() {
 				Build()
 
 			ctrlPort.EXPECT().RetrieveIncoming().Return(req)
-			engine.EXPECT().CurrentTime().Return(sim.VTimeInSec(10))
 
 			madeProgress := pmc.processFromCtrlPort()
 
-			Expect(pmc.currentMigrationRequest).To(BeEquivalentTo(req))
+			Expect(pmc.pendingMigrations).To(HaveLen(1))
+			Expect(pmc.pendingMigrations[0].req).To(BeEquivalentTo(req))
 			Expect(madeProgress).To(BeTrue())
 		})
 
-		It("should process the page migration req from Control Port", func() {
-			req := PageMigrationReqToPMCBuilder{}.
-				WithSrc("").
-				WithDst(pmc.ctrlPort.AsRemote()).
-				WithPageSize(4 * mem.KB).
-				Build()
-
-			pmc.currentMigrationRequest = req
+		It("should start at most the maximum number of migrations", func() {
+			pmc.SetMaxOutstandingMigrations(2)
+			for i := 0; i < 3; i++ {
+				req := PageMigrationReqToPMCBuilder{}.
+					WithPageSize(4 * mem.KB).
+					Build()
+				pmc.pendingMigrations = append(pmc.pendingMigrations,
+					&migration{req: req})
+			}
 
 			madeProgress := pmc.processPageMigrationReqFromCtrlPort()
 
-			Expect(pmc.toPullFromAnotherPMC).ToNot(BeNil())
 			Expect(madeProgress).To(BeTrue())
+			Expect(pmc.activeMigrations).To(HaveLen(2))
+			Expect(pmc.pendingMigrations).To(HaveLen(1))
+			Expect(pmc.activeMigrations[0].numChunks).To(Equal(64))
 		})
 
+		It("should pull at most the maximum number of chunks of a page",
+			func() {
+				pmc.SetDataTransferSize(256)
+				pmc.SetMaxInflightChunks(4)
+				req := PageMigrationReqToPMCBuilder{}.
+					WithPageSize(4 * mem.KB).
+					WithReadFrom(0x1000).
+					WithWriteTo(0x8000).
+					WithPMCPortOfRemoteGPU("RemotePMC").
+					Build()
+				pmc.pendingMigrations = append(pmc.pendingMigrations,
+					&migration{req: req})
+				pmc.processPageMigrationReqFromCtrlPort()
+
+				madeProgress := pmc.issueDataPulls()
+
+				Expect(madeProgress).To(BeTrue())
+				Expect(pmc.toPullFromAnotherPMC).To(HaveLen(4))
+				pull := pmc.toPullFromAnotherPMC[1]
+				Expect(pull.Dst).To(Equal(sim.RemotePort("RemotePMC")))
+				Expect(pull.ToReadFromPhyAddress).To(Equal(uint64(0x1100)))
+				Expect(pull.DataTransferSize).To(Equal(uint64(256)))
+				Expect(pmc.pullIDToChunk[pull.ID].writeAddr).
+					To(Equal(uint64(0x8100)))
+				Expect(pmc.issueDataPulls()).To(BeFalse())
+			})
+
 		It("should send a migration req to another PMC", func() {
 			req := DataPullReqBuilder{}.
 				WithSrc(pmc.remotePort.AsRemote()).
@@ -150,6 +182,7 @@ var _ = Describe("PMC", func() {
 			Expect(pmc.toSendLocalMemPort[0].Address).To(BeEquivalentTo(uint64(0x100)))
 			Expect(pmc.toSendLocalMemPort[0].AccessByteSize).To(BeEquivalentTo(uint64(0x100)))
 			Expect(pmc.toSendLocalMemPort[0].ID).To(BeEquivalentTo(req.ID))
+			Expect(pmc.servedPulls).To(HaveKey(req.ID))
 			Expect(madeProgress).To(BeTrue())
 		})
 
@@ -183,11 +216,17 @@ var _ = Describe("PMC", func() {
 		})
 
 		It("process a data ready rsp from Mem Ctrl", func() {
+			pull := DataPullReqBuilder{}.
+				WithSrc("RequestingPMC").
+				Build()
+			pmc.servedPulls[pull.ID] = &servedPull{req: pull, readStart: 4}
+
 			data := make([]byte, 0)
 			data = append(data, 0x04)
 			req := mem.DataReadyRspBuilder{}.
 				WithSrc("").
 				WithDst(pmc.localMemPort.AsRemote()).
+				WithRspTo(pull.ID).
 				WithData(data).
 				Build()
 
@@ -196,10 +235,54 @@ var _ = Describe("PMC", func() {
 
 			pmc.processDataReadyRspFromMemCtrl()
 
-			Expect(pmc.toRspToAnotherPMC[0]).ToNot(BeNil())
-			Expect(pmc.toRspToAnotherPMC[0].Data).To(HaveLen(1))
-			Expect(pmc.toRspToAnotherPMC[0].Data[0]).
-				To(BeEquivalentTo(uint64(0x4)))
+			rsp := pmc.toRspToAnotherPMC[0].rsp
+			Expect(rsp.ID).To(Equal(pull.ID))
+			Expect(rsp.Dst).To(Equal(sim.RemotePort("RequestingPMC")))
+			Expect(rsp.Data).To(HaveLen(1))
+			Expect(rsp.Data[0]).To(BeEquivalentTo(uint64(0x4)))
+			Expect(rsp.ReadTime).To(BeNumerically("~", 6, 1e-12))
+			Expect(pmc.servedPulls).To(BeEmpty())
+		})
+
+		It("should let the responses contend for the link", func() {
+			link := &rdma.Link{Bandwidth: 1e9, Latency: 1, HeaderBytes: 12}
+			rdmaEngine := rdma.MakeBuilder().
+				WithEngine(engine).
+				Build("RDMA")
+			rdmaEngine.SetLink("RequestingPMC", link)
+			pmc.SetLinkFinder(rdmaEngine)
+
+			for i := 0; i < 2; i++ {
+				rsp := DataPullRspBuilder{}.
+					WithDst("RequestingPMC").
+					WithData(make([]byte, 88)).
+					Build()
+				pmc.transferOverLink(rsp, 10)
+			}
+
+			first := pmc.toRspToAnotherPMC[0]
+			second := pmc.toRspToAnotherPMC[1]
+			Expect(first.rsp.LinkWaitTime).To(BeNumerically("~", 0, 1e-12))
+			Expect(first.rsp.TransferTime).
+				To(BeNumerically("~", 1+100e-9, 1e-12))
+			Expect(second.rsp.LinkWaitTime).
+				To(BeNumerically("~", 100e-9, 1e-12))
+			Expect(second.arrivalAt).To(BeNumerically("~", 11+200e-9, 1e-12))
+			Expect(link.Stats().NumBytes).To(Equal(uint64(200)))
+			Expect(link.Stats().NumPackets).To(Equal(uint64(2)))
+		})
+
+		It("should transfer the data instantly without a link", func() {
+			rsp := DataPullRspBuilder{}.
+				WithDst("RequestingPMC").
+				WithData(make([]byte, 88)).
+				Build()
+
+			pmc.transferOverLink(rsp, 10)
+
+			Expect(pmc.toRspToAnotherPMC[0].arrivalAt).
+				To(Equal(sim.VTimeInSec(10)))
+			Expect(rsp.TransferTime).To(Equal(sim.VTimeInSec(0)))
 		})
 
 		It("should send a data ready rsp to requesting PMC", func() {
@@ -211,7 +294,8 @@ var _ = Describe("PMC", func() {
 				WithData(data).
 				Build()
 
-			pmc.toRspToAnotherPMC = append(pmc.toRspToAnotherPMC, req)
+			pmc.toRspToAnotherPMC = append(pmc.toRspToAnotherPMC,
+				&linkPacket{rsp: req, arrivalAt: 10})
 
 			RemotePort.EXPECT().Send(req).Return(nil)
 
@@ -221,6 +305,18 @@ var _ = Describe("PMC", func() {
 			Expect(len(pmc.toRspToAnotherPMC)).To(BeEquivalentTo(0))
 		})
 
+		It("should not send a data ready rsp before it crosses the link",
+			func() {
+				req := DataPullRspBuilder{}.Build()
+				pmc.toRspToAnotherPMC = append(pmc.toRspToAnotherPMC,
+					&linkPacket{rsp: req, arrivalAt: 11})
+
+				madeProgress := pmc.sendDataReadyRspToRequestingPMC()
+
+				Expect(madeProgress).To(BeTrue())
+				Expect(pmc.toRspToAnotherPMC).To(HaveLen(1))
+			})
+
 		It("should receive a data ready rsp from the requested PMC", func() {
 			data := []byte{1, 2, 3, 4}
 			req := DataPullRspBuilder{}.
@@ -239,27 +335,27 @@ var _ = Describe("PMC", func() {
 
 		It("should process a data migration rsp from requested PMC", func() {
 			data := []byte{1, 2}
-			migrationReq := PageMigrationReqToPMCBuilder{}.
-				WithSrc("").
-				WithDst(pmc.ctrlPort.AsRemote()).
-				WithPageSize(4 * mem.KB).
-				Build()
-
+			m := &migration{}
 			req := DataPullRspBuilder{}.
 				WithSrc(pmc.remotePort.AsRemote()).
 				WithDst("").
 				WithData(data).
 				Build()
+			req.ReadTime = 2
+			req.LinkWaitTime = 3
 
-			pmc.reqIDToWriteAddressMap[req.ID] = 0x100
-
-			pmc.currentMigrationRequest = migrationReq
+			pmc.pullIDToChunk[req.ID] = &chunk{migration: m, writeAddr: 0x100}
 			pmc.receivedDataFromAnothePMC = append(pmc.receivedDataFromAnothePMC, req)
 
 			madeProgress := pmc.processDataPullRsp()
 
 			Expect(madeProgress).To(BeTrue())
-			Expect(pmc.writeReqLocalMemPort[0].Data).To(BeEquivalentTo(data))
+			write := pmc.writeReqLocalMemPort[0]
+			Expect(write.Data).To(BeEquivalentTo(data))
+			Expect(write.Address).To(Equal(uint64(0x100)))
+			Expect(pmc.writeIDToChunk).To(HaveKey(write.ID))
+			Expect(m.readTime).To(BeNumerically("~", 2, 1e-12))
+			Expect(m.linkWaitTime).To(BeNumerically("~", 3, 1e-12))
 		})
 
 		It("should send a write req to mem ctrl", func() {
@@ -282,44 +378,63 @@ var _ = Describe("PMC", func() {
 		})
 
 		It("should process a write done rsp from memctrl", func() {
+			m := &migration{numChunks: 10, numInflight: 2}
+			pmc.writeIDToChunk["xx"] = &chunk{migration: m, writeStart: 7}
 			req := mem.WriteDoneRspBuilder{}.
 				WithSrc("").
 				WithDst(pmc.localMemPort.AsRemote()).
 				WithRspTo("xx").
 				Build()
 
-			pmc.receivedWriteDoneFromMemCtrl = req
-
-			pmc.numDataRspPendingForPageMigration = 10
+			pmc.receivedWriteDoneFromMemCtrl = append(
+				pmc.receivedWriteDoneFromMemCtrl, req)
 
 			madeProgress := pmc.processWriteDoneRspFromMemCtrl()
 
 			Expect(madeProgress).To(BeTrue())
-			Expect(pmc.numDataRspPendingForPageMigration).ToNot(BeNil())
-			Expect(pmc.numDataRspPendingForPageMigration).To(BeEquivalentTo(uint64(9)))
+			Expect(m.numCompleted).To(Equal(1))
+			Expect(m.numInflight).To(Equal(1))
+			Expect(m.writeTime).To(BeNumerically("~", 3, 1e-12))
+			Expect(pmc.toSendToCtrlPort).To(BeEmpty())
 		})
 
 		It("should receive the last pending data for the page and prepare response for CP", func() {
-			req := mem.WriteDoneRspBuilder{}.
-				WithSrc("").
-				WithDst(pmc.localMemPort.AsRemote()).
-				WithRspTo("xx").
-				Build()
 			pageMigrationReq := PageMigrationReqToPMCBuilder{}.
 				WithSrc("").
 				WithDst(pmc.ctrlPort.AsRemote()).
 				WithPageSize(4 * mem.KB).
 				Build()
-			pmc.currentMigrationRequest = pageMigrationReq
-			pmc.receivedWriteDoneFromMemCtrl = req
-			pmc.numDataRspPendingForPageMigration = 1
+			m := &migration{
+				req:          pageMigrationReq,
+				arrivalTime:  2,
+				startTime:    4,
+				numChunks:    2,
+				numInflight:  1,
+				numCompleted: 1,
+				readTime:     4,
+			}
+			pmc.activeMigrations = append(pmc.activeMigrations, m)
+			pmc.writeIDToChunk["xx"] = &chunk{migration: m, writeStart: 9}
+			req := mem.WriteDoneRspBuilder{}.
+				WithSrc("").
+				WithDst(pmc.localMemPort.AsRemote()).
+				WithRspTo("xx").
+				Build()
+			pmc.receivedWriteDoneFromMemCtrl = append(
+				pmc.receivedWriteDoneFromMemCtrl, req)
 
 			madeProgress := pmc.processWriteDoneRspFromMemCtrl()
 
 			Expect(madeProgress).To(BeTrue())
-			Expect(pmc.numDataRspPendingForPageMigration).ToNot(BeNil())
-			Expect(pmc.numDataRspPendingForPageMigration).To(BeEquivalentTo(-1))
-			Expect(pmc.toSendToCtrlPort).ToNot(BeNil())
+			Expect(pmc.activeMigrations).To(BeEmpty())
+			Expect(pmc.toSendToCtrlPort).To(HaveLen(1))
+
+			records := pmc.MigrationRecords()
+			Expect(records).To(HaveLen(1))
+			Expect(records[0].QueueTime).To(BeNumerically("~", 2, 1e-12))
+			Expect(records[0].Latency).To(BeNumerically("~", 6, 1e-12))
+			Expect(records[0].ReadTime).To(BeNumerically("~", 2, 1e-12))
+			Expect(pmc.TotalDataTransferTime).To(BeNumerically("~", 8, 1e-12))
 		})
 
 		It("should send migration complete rsp to CP", func() {
@@ -328,16 +443,14 @@ var _ = Describe("PMC", func() {
 				WithDst("").
 				Build()
 
-			pmc.toSendToCtrlPort = req
-			pmc.isHandlingPageMigration = true
+			pmc.toSendToCtrlPort = append(pmc.toSendToCtrlPort, req)
 
 			ctrlPort.EXPECT().Send(req).Return(nil)
-			engine.EXPECT().CurrentTime().Return(sim.VTimeInSec(11))
 
 			madeProgress := pmc.sendMigrationCompleteRspToCtrlPort()
 
 			Expect(madeProgress).To(BeTrue())
-			Expect(pmc.isHandlingPageMigration).To(BeFalse())
+			Expect(pmc.toSendToCtrlPort).To(BeEmpty())
 		})
 	})
 })
@@ -199,6 +199,13 @@ func (b DataPullReqBuilder) Build() *DataPullReq {
 type DataPullRsp struct {
 	sim.MsgMeta
 	Data []byte
+
+	// ReadTime, LinkWaitTime, and TransferTime are the time that the data
+	// spends reading the memory, waiting for the link, and crossing the link.
+	// The PMC that holds the page fills them in.
+	ReadTime     sim.VTimeInSec
+	LinkWaitTime sim.VTimeInSec
+	TransferTime sim.VTimeInSec
 }
 
 // Meta returns the meta data associated with the message.
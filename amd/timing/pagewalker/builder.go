@@ -0,0 +1,149 @@
+package pagewalker
+
+import (
+	"github.com/sarchlab/akita/v4/sim"
+)
+
+// A Builder can build page-table walkers.
+type Builder struct {
+	engine              sim.Engine
+	freq                sim.Freq
+	numThreads          int
+	numLevels           int
+	log2PageSize        uint64
+	bitsPerLevel        uint64
+	levelLatency        int
+	numPWCEntries       int
+	queueSize           int
+	numReqPerCycle      int
+	bufferSize          int
+	translationProvider sim.RemotePort
+}
+
+// MakeBuilder creates a builder with default parameters.
+func MakeBuilder() Builder {
+	return Builder{
+		freq:           1 * sim.GHz,
+		numThreads:     8,
+		numLevels:      4,
+		log2PageSize:   12,
+		bitsPerLevel:   9,
+		levelLatency:   100,
+		queueSize:      64,
+		numReqPerCycle: 4,
+		bufferSize:     64,
+	}
+}
+
+// WithEngine sets the engine to use.
+func (b Builder) WithEngine(engine sim.Engine) Builder {
+	b.engine = engine
+	return b
+}
+
+// WithFreq sets the frequency that the walker works at.
+func (b Builder) WithFreq(freq sim.Freq) Builder {
+	b.freq = freq
+	return b
+}
+
+// WithNumThreads sets the number of walks that can be in progress at the
+// same time.
+func (b Builder) WithNumThreads(n int) Builder {
+	b.numThreads = n
+	return b
+}
+
+// WithNumLevels sets the number of levels of the page table.
+func (b Builder) WithNumLevels(n int) Builder {
+	b.numLevels = n
+	return b
+}
+
+// WithLog2PageSize sets the page size, as a power of 2.
+func (b Builder) WithLog2PageSize(n uint64) Builder {
+	b.log2PageSize = n
+	return b
+}
+
+// WithBitsPerLevel sets the number of bits of the virtual address that each
+// level of the page table translates.
+func (b Builder) WithBitsPerLevel(n uint64) Builder {
+	b.bitsPerLevel = n
+	return b
+}
+
+// WithLevelLatency sets the number of cycles to read an entry from a level of
+// the page table.
+func (b Builder) WithLevelLatency(cycles int) Builder {
+	b.levelLatency = cycles
+	return b
+}
+
+// WithPageWalkCache sets the number of upper-level entries that the page walk
+// cache keeps. 0, the default, disables the page walk cache.
+func (b Builder) WithPageWalkCache(numEntries int) Builder {
+	b.numPWCEntries = numEntries
+	return b
+}
+
+// WithQueueSize sets the number of walks that can wait for a thread.
+func (b Builder) WithQueueSize(n int) Builder {
+	b.queueSize = n
+	return b
+}
+
+// WithNumReqPerCycle sets the number of requests that the walker can accept
+// in each cycle.
+func (b Builder) WithNumReqPerCycle(n int) Builder {
+	b.numReqPerCycle = n
+	return b
+}
+
+// WithBufferSize sets the number of messages that each port can buffer.
+func (b Builder) WithBufferSize(n int) Builder {
+	b.bufferSize = n
+	return b
+}
+
+// WithTranslationProvider sets the port that provides the translations after
+// the walks, usually the MMU.
+func (b Builder) WithTranslationProvider(port sim.RemotePort) Builder {
+	b.translationProvider = port
+	return b
+}
+
+// Build creates a page-table walker with the given parameters.
+func (b Builder) Build(name string) *Comp {
+	c := &Comp{}
+	c.TickingComponent = sim.NewTickingComponent(name, b.engine, b.freq, c)
+
+	c.translationProvider = b.translationProvider
+	c.numThreads = b.numThreads
+	c.numLevels = b.numLevels
+	c.levelLatency = b.levelLatency
+	c.queueSize = b.queueSize
+	c.numReqPerCycle = b.numReqPerCycle
+	c.pending = make(map[string]*walk)
+
+	if b.numPWCEntries > 0 {
+		c.pwc = newWalkCache(b.numPWCEntries, b.numLevels,
+			b.log2PageSize, b.bitsPerLevel)
+	}
+
+	b.createPorts(name, c)
+
+	return c
+}
+
+func (b *Builder) createPorts(name string, c *Comp) {
+	c.topPort = sim.NewPort(c, b.bufferSize, b.bufferSize, name+".TopPort")
+	c.AddPort("Top", c.topPort)
+
+	c.bottomPort = sim.NewPort(
+		c, b.bufferSize, b.bufferSize, name+".BottomPort")
+	c.AddPort("Bottom", c.bottomPort)
+
+	c.controlPort = sim.NewPort(c, 1, 1, name+".ControlPort")
+	c.AddPort("Control", c.controlPort)
+}
@@ -0,0 +1,308 @@
+// Package pagewalker models the page-table walkers that serve the misses of
+// the last-level TLB.
+//
+// A walker has a fixed number of threads, each of which walks the page table
+// for one translation at a time. The requests that find all the threads busy
+// wait in a queue. A walk reads one entry from each level of the page table,
+// and each read takes a fixed number of cycles. An optional page walk cache
+// keeps the upper-level entries, so that the walks that share the upper
+// levels of the page table with a recent walk skip those levels.
+//
+// The walker only models the time of the walks. After a walk, the walker asks
+// the translation provider, usually the MMU, for the translation, and passes
+// the response back. The latency of the provider adds to the latency of the
+// walk.
+//
+// The walker takes the TLB flush and restart requests on its "Control" port,
+// so that the Command Processor can shoot down the page walk cache together
+// with the TLBs.
+package pagewalker
+
+import (
+	"log"
+	"reflect"
+
+	"github.com/sarchlab/akita/v4/mem/vm"
+	"github.com/sarchlab/akita/v4/mem/vm/tlb"
+	"github.com/sarchlab/akita/v4/sim"
+)
+
+// Stats is the statistics of the walks.
+type Stats struct {
+	NumWalks       uint64
+	NumPWCHits     uint64
+	NumPWCMisses   uint64
+	NumLevelReads  uint64
+	MaxQueueLength int
+
+	// TotalQueueTime is the time that the walks wait for a thread.
+	TotalQueueTime sim.VTimeInSec
+
+	// TotalWalkTime is the time that the threads spend on the walks.
+	TotalWalkTime sim.VTimeInSec
+}
+
+// AvgQueueTime returns the average time that a walk waits for a thread.
+func (s Stats) AvgQueueTime() sim.VTimeInSec {
+	if s.NumWalks == 0 {
+		return 0
+	}
+
+	return s.TotalQueueTime / sim.VTimeInSec(s.NumWalks)
+}
+
+// AvgWalkLatency returns the average time that a thread spends on a walk.
+func (s Stats) AvgWalkLatency() sim.VTimeInSec {
+	if s.NumWalks == 0 {
+		return 0
+	}
+
+	return s.TotalWalkTime / sim.VTimeInSec(s.NumWalks)
+}
+
+// PWCHitRate returns the fraction of the walks that hit in the page walk
+// cache.
+func (s Stats) PWCHitRate() float64 {
+	total := s.NumPWCHits + s.NumPWCMisses
+	if total == 0 {
+		return 0
+	}
+
+	return float64(s.NumPWCHits) / float64(total)
+}
+
+type walk struct {
+	req        *vm.TranslationReq
+	arriveTime sim.VTimeInSec
+	startTime  sim.VTimeInSec
+	finishTime sim.VTimeInSec
+}
+
+// Comp is a page-table walker.
+type Comp struct {
+	*sim.TickingComponent
+
+	topPort     sim.Port
+	bottomPort  sim.Port
+	controlPort sim.Port
+
+	translationProvider sim.RemotePort
+
+	numThreads     int
+	numLevels      int
+	levelLatency   int
+	queueSize      int
+	numReqPerCycle int
+	pwc            *walkCache
+
+	queue   []*walk
+	active  []*walk
+	pending map[string]*walk
+
+	stats Stats
+}
+
+// Stats returns the statistics of the walks.
+func (c *Comp) Stats() Stats {
+	return c.stats
+}
+
+// Tick updates the state of the walker.
+func (c *Comp) Tick() bool {
+	madeProgress := false
+
+	madeProgress = c.processControl() || madeProgress
+	madeProgress = c.respond() || madeProgress
+	madeProgress = c.finishWalks() || madeProgress
+	madeProgress = c.startWalks() || madeProgress
+
+	for i := 0; i < c.numReqPerCycle; i++ {
+		madeProgress = c.parseFromTop() || madeProgress
+	}
+
+	return madeProgress
+}
+
+// processControl flushes the page walk cache on the TLB flush requests. The
+// walks in progress continue, as the translation provider returns the
+// updated translations.
+func (c *Comp) processControl() bool {
+	msg := c.controlPort.PeekIncoming()
+	if msg == nil {
+		return false
+	}
+
+	var rsp sim.Msg
+
+	switch req := msg.(type) {
+	case *tlb.FlushReq:
+		rsp = tlb.FlushRspBuilder{}.
+			WithSrc(c.controlPort.AsRemote()).
+			WithDst(req.Src).
+			Build()
+	case *tlb.RestartReq:
+		rsp = tlb.RestartRspBuilder{}.
+			WithSrc(c.controlPort.AsRemote()).
+			WithDst(req.Src).
+			Build()
+	default:
+		log.Panicf("page walker cannot handle message of type %s",
+			reflect.TypeOf(msg))
+	}
+
+	err := c.controlPort.Send(rsp)
+	if err != nil {
+		return false
+	}
+
+	c.controlPort.RetrieveIncoming()
+
+	if req, ok := msg.(*tlb.FlushReq); ok && c.pwc != nil {
+		for _, vAddr := range req.VAddr {
+			c.pwc.invalidate(req.PID, vAddr)
+		}
+	}
+
+	return true
+}
+
+func (c *Comp) parseFromTop() bool {
+	if len(c.queue) >= c.queueSize {
+		return false
+	}
+
+	msg := c.topPort.RetrieveIncoming()
+	if msg == nil {
+		return false
+	}
+
+	req, ok := msg.(*vm.TranslationReq)
+	if !ok {
+		log.Panicf("page walker cannot handle message of type %s",
+			reflect.TypeOf(msg))
+	}
+
+	c.queue = append(c.queue, &walk{
+		req:        req,
+		arriveTime: c.Engine.CurrentTime(),
+	})
+
+	if len(c.queue) > c.stats.MaxQueueLength {
+		c.stats.MaxQueueLength = len(c.queue)
+	}
+
+	return true
+}
+
+// startWalks assigns the queued walks to the free threads.
+func (c *Comp) startWalks() bool {
+	madeProgress := false
+	now := c.Engine.CurrentTime()
+
+	for len(c.active) < c.numThreads && len(c.queue) > 0 {
+		w := c.queue[0]
+		c.queue = c.queue[1:]
+
+		numReads := c.numLevels
+		if c.pwc != nil {
+			skipped := c.pwc.lookup(w.req.PID, w.req.VAddr)
+			if skipped > 0 {
+				c.stats.NumPWCHits++
+			} else {
+				c.stats.NumPWCMisses++
+			}
+
+			numReads -= skipped
+			c.pwc.fill(w.req.PID, w.req.VAddr)
+		}
+
+		w.startTime = now
+		w.finishTime = c.Freq.NCyclesLater(numReads*c.levelLatency, now)
+		c.active = append(c.active, w)
+
+		c.stats.NumLevelReads += uint64(numReads)
+		madeProgress = true
+	}
+
+	return madeProgress
+}
+
+// finishWalks asks the translation provider for the translations of the
+// walks that have read all the levels. The threads of these walks are freed.
+func (c *Comp) finishWalks() bool {
+	if len(c.active) == 0 {
+		return false
+	}
+
+	now := c.Engine.CurrentTime()
+	madeProgress := false
+
+	for i := 0; i < len(c.active); {
+		w := c.active[i]
+		if w.finishTime > now {
+			i++
+			continue
+		}
+
+		req := vm.TranslationReqBuilder{}.
+			WithSrc(c.bottomPort.AsRemote()).
+			WithDst(c.translationProvider).
+			WithPID(w.req.PID).
+			WithVAddr(w.req.VAddr).
+			WithDeviceID(w.req.DeviceID).
+			Build()
+
+		err := c.bottomPort.Send(req)
+		if err != nil {
+			break
+		}
+
+		c.pending[req.ID] = w
+		c.active = append(c.active[:i], c.active[i+1:]...)
+
+		c.stats.NumWalks++
+		c.stats.TotalQueueTime += w.startTime - w.arriveTime
+		c.stats.TotalWalkTime += now - w.startTime
+		madeProgress = true
+	}
+
+	// The walks in progress wait for the levels to be read.
+	return madeProgress || len(c.active) > 0
+}
+
+// respond passes the translations from the translation provider back to the
+// TLBs.
+func (c *Comp) respond() bool {
+	msg := c.bottomPort.PeekIncoming()
+	if msg == nil {
+		return false
+	}
+
+	rsp, ok := msg.(*vm.TranslationRsp)
+	if !ok {
+		log.Panicf("page walker cannot handle message of type %s",
+			reflect.TypeOf(msg))
+	}
+
+	w, found := c.pending[rsp.RespondTo]
+	if !found {
+		log.Panicf("cannot find the walk of translation %s", rsp.RespondTo)
+	}
+
+	rspToTop := vm.TranslationRspBuilder{}.
+		WithSrc(c.topPort.AsRemote()).
+		WithDst(w.req.Src).
+		WithRspTo(w.req.ID).
+		WithPage(rsp.Page).
+		Build()
+
+	err := c.topPort.Send(rspToTop)
+	if err != nil {
+		return false
+	}
+
+	c.bottomPort.RetrieveIncoming()
+	delete(c.pending, rsp.RespondTo)
+
+	return true
+}
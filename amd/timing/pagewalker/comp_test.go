@@ -0,0 +1,199 @@
+package pagewalker
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sarchlab/akita/v4/mem/vm"
+	"github.com/sarchlab/akita/v4/mem/vm/tlb"
+	"github.com/sarchlab/akita/v4/sim"
+	"go.uber.org/mock/gomock"
+)
+
+var _ = Describe("Page Walker", func() {
+	var (
+		mockCtrl    *gomock.Controller
+		engine      *MockEngine
+		topPort     *MockPort
+		bottomPort  *MockPort
+		controlPort *MockPort
+		c           *Comp
+		now         sim.VTimeInSec
+	)
+
+	translation := func(vAddr uint64) *vm.TranslationReq {
+		return vm.TranslationReqBuilder{}.
+			WithSrc("L2TLB").
+			WithPID(1).
+			WithVAddr(vAddr).
+			Build()
+	}
+
+	BeforeEach(func() {
+		mockCtrl = gomock.NewController(GinkgoT())
+		engine = NewMockEngine(mockCtrl)
+		topPort = NewMockPort(mockCtrl)
+		bottomPort = NewMockPort(mockCtrl)
+		controlPort = NewMockPort(mockCtrl)
+		topPort.EXPECT().AsRemote().Return(sim.RemotePort("Top")).AnyTimes()
+		bottomPort.EXPECT().AsRemote().
+			Return(sim.RemotePort("Bottom")).AnyTimes()
+		controlPort.EXPECT().AsRemote().
+			Return(sim.RemotePort("Control")).AnyTimes()
+		now = 0
+		engine.EXPECT().CurrentTime().
+			DoAndReturn(func() sim.VTimeInSec { return now }).AnyTimes()
+
+		c = MakeBuilder().
+			WithEngine(engine).
+			WithNumThreads(1).
+			WithLevelLatency(10).
+			WithPageWalkCache(8).
+			WithTranslationProvider("MMU").
+			Build("Walker")
+		c.topPort = topPort
+		c.bottomPort = bottomPort
+		c.controlPort = controlPort
+	})
+
+	AfterEach(func() {
+		mockCtrl.Finish()
+	})
+
+	It("should queue the walks that find no free thread", func() {
+		c.active = []*walk{{req: translation(0x1000), finishTime: 1}}
+		req := translation(0x2000)
+		topPort.EXPECT().RetrieveIncoming().Return(req)
+
+		Expect(c.parseFromTop()).To(BeTrue())
+		Expect(c.startWalks()).To(BeFalse())
+		Expect(c.queue).To(HaveLen(1))
+		Expect(c.Stats().MaxQueueLength).To(Equal(1))
+	})
+
+	It("should read all the levels on a page walk cache miss", func() {
+		c.queue = []*walk{{req: translation(0x1000)}}
+
+		Expect(c.startWalks()).To(BeTrue())
+		Expect(c.active).To(HaveLen(1))
+		Expect(c.active[0].finishTime).
+			To(BeNumerically("~", 40e-9, 1e-12))
+		Expect(c.Stats().NumPWCMisses).To(Equal(uint64(1)))
+	})
+
+	It("should skip the cached levels on a page walk cache hit", func() {
+		c.pwc.fill(1, 0x1000)
+		c.queue = []*walk{{req: translation(0x2000)}}
+
+		Expect(c.startWalks()).To(BeTrue())
+		Expect(c.active[0].finishTime).
+			To(BeNumerically("~", 10e-9, 1e-12))
+		Expect(c.Stats().NumPWCHits).To(Equal(uint64(1)))
+		Expect(c.Stats().NumLevelReads).To(Equal(uint64(1)))
+	})
+
+	It("should wait for the levels to be read", func() {
+		c.active = []*walk{{req: translation(0x1000), finishTime: 40e-9}}
+		now = 20e-9
+
+		Expect(c.finishWalks()).To(BeTrue())
+		Expect(c.active).To(HaveLen(1))
+	})
+
+	It("should ask the translation provider after the walk", func() {
+		c.active = []*walk{{
+			req:        translation(0x1000),
+			arriveTime: 5e-9,
+			startTime:  10e-9,
+			finishTime: 50e-9,
+		}}
+		now = 50e-9
+		bottomPort.EXPECT().Send(gomock.Any()).
+			DoAndReturn(func(msg sim.Msg) *sim.SendError {
+				req := msg.(*vm.TranslationReq)
+				Expect(req.Dst).To(Equal(sim.RemotePort("MMU")))
+				Expect(req.VAddr).To(Equal(uint64(0x1000)))
+				return nil
+			})
+
+		Expect(c.finishWalks()).To(BeTrue())
+		Expect(c.active).To(BeEmpty())
+		Expect(c.pending).To(HaveLen(1))
+		Expect(c.Stats().NumWalks).To(Equal(uint64(1)))
+		Expect(float64(c.Stats().AvgQueueTime())).
+			To(BeNumerically("~", 5e-9, 1e-12))
+		Expect(float64(c.Stats().AvgWalkLatency())).
+			To(BeNumerically("~", 40e-9, 1e-12))
+	})
+
+	It("should pass the translation back to the TLB", func() {
+		req := translation(0x1000)
+		c.pending["bottom-req"] = &walk{req: req}
+		rsp := vm.TranslationRspBuilder{}.
+			WithRspTo("bottom-req").
+			WithPage(vm.Page{PID: 1, VAddr: 0x1000, PAddr: 0x8000}).
+			Build()
+		bottomPort.EXPECT().PeekIncoming().Return(rsp)
+		bottomPort.EXPECT().RetrieveIncoming().Return(rsp)
+		topPort.EXPECT().Send(gomock.Any()).
+			DoAndReturn(func(msg sim.Msg) *sim.SendError {
+				rspToTop := msg.(*vm.TranslationRsp)
+				Expect(rspToTop.Dst).To(Equal(sim.RemotePort("L2TLB")))
+				Expect(rspToTop.RespondTo).To(Equal(req.ID))
+				Expect(rspToTop.Page.PAddr).To(Equal(uint64(0x8000)))
+				return nil
+			})
+
+		Expect(c.respond()).To(BeTrue())
+		Expect(c.pending).To(BeEmpty())
+	})
+
+	It("should flush the page walk cache on a TLB flush", func() {
+		c.pwc.fill(1, 0x1000)
+		c.pwc.fill(2, 0x1000)
+		req := tlb.FlushReqBuilder{}.
+			WithSrc("CP").
+			WithPID(1).
+			WithVAddrs([]uint64{0x1000}).
+			Build()
+		controlPort.EXPECT().PeekIncoming().Return(req)
+		controlPort.EXPECT().RetrieveIncoming().Return(req)
+		controlPort.EXPECT().Send(gomock.Any()).
+			DoAndReturn(func(msg sim.Msg) *sim.SendError {
+				rsp := msg.(*tlb.FlushRsp)
+				Expect(rsp.Dst).To(Equal(sim.RemotePort("CP")))
+				return nil
+			})
+
+		Expect(c.processControl()).To(BeTrue())
+		Expect(c.pwc.lookup(1, 0x1000)).To(Equal(0))
+		Expect(c.pwc.lookup(2, 0x1000)).To(Equal(3))
+	})
+
+	It("should keep the flush request if the response cannot be sent", func() {
+		c.pwc.fill(1, 0x1000)
+		req := tlb.FlushReqBuilder{}.
+			WithSrc("CP").
+			WithPID(1).
+			WithVAddrs([]uint64{0x1000}).
+			Build()
+		controlPort.EXPECT().PeekIncoming().Return(req)
+		controlPort.EXPECT().Send(gomock.Any()).Return(&sim.SendError{})
+
+		Expect(c.processControl()).To(BeFalse())
+		Expect(c.pwc.lookup(1, 0x1000)).To(Equal(3))
+	})
+
+	It("should respond to the restart requests", func() {
+		req := tlb.RestartReqBuilder{}.WithSrc("CP").Build()
+		controlPort.EXPECT().PeekIncoming().Return(req)
+		controlPort.EXPECT().RetrieveIncoming().Return(req)
+		controlPort.EXPECT().Send(gomock.Any()).
+			DoAndReturn(func(msg sim.Msg) *sim.SendError {
+				rsp := msg.(*tlb.RestartRsp)
+				Expect(rsp.Dst).To(Equal(sim.RemotePort("CP")))
+				return nil
+			})
+
+		Expect(c.processControl()).To(BeTrue())
+	})
+})
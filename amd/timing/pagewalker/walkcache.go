@@ -0,0 +1,117 @@
+package pagewalker
+
+import "github.com/sarchlab/akita/v4/mem/vm"
+
+type walkCacheEntry struct {
+	pid     vm.PID
+	level   int
+	prefix  uint64
+	lastUse uint64
+}
+
+// A walkCache is a fully associative cache with LRU replacement that keeps
+// the upper-level entries of the page table. An entry of level k holds the
+// result of the first k steps of a walk, so that a walk that hits it only
+// needs to read the remaining levels. The leaf entries are left to the TLBs.
+type walkCache struct {
+	numEntries   int
+	numLevels    int
+	log2PageSize uint64
+	bitsPerLevel uint64
+	entries      []walkCacheEntry
+	clock        uint64
+}
+
+func newWalkCache(
+	numEntries, numLevels int,
+	log2PageSize, bitsPerLevel uint64,
+) *walkCache {
+	return &walkCache{
+		numEntries:   numEntries,
+		numLevels:    numLevels,
+		log2PageSize: log2PageSize,
+		bitsPerLevel: bitsPerLevel,
+	}
+}
+
+// prefix returns the part of the virtual address that the first level steps
+// of a walk translate.
+func (c *walkCache) prefix(vAddr uint64, level int) uint64 {
+	shift := c.log2PageSize + c.bitsPerLevel*uint64(c.numLevels-level)
+	return vAddr >> shift
+}
+
+// lookup returns the number of levels that the cache saves for a walk.
+func (c *walkCache) lookup(pid vm.PID, vAddr uint64) int {
+	for level := c.numLevels - 1; level > 0; level-- {
+		prefix := c.prefix(vAddr, level)
+
+		for i := range c.entries {
+			e := &c.entries[i]
+			if e.pid == pid && e.level == level && e.prefix == prefix {
+				c.clock++
+				e.lastUse = c.clock
+
+				return level
+			}
+		}
+	}
+
+	return 0
+}
+
+// fill keeps all the upper-level entries of a walk.
+func (c *walkCache) fill(pid vm.PID, vAddr uint64) {
+	for level := 1; level < c.numLevels; level++ {
+		c.insert(pid, level, c.prefix(vAddr, level))
+	}
+}
+
+func (c *walkCache) insert(pid vm.PID, level int, prefix uint64) {
+	c.clock++
+
+	for i := range c.entries {
+		e := &c.entries[i]
+		if e.pid == pid && e.level == level && e.prefix == prefix {
+			e.lastUse = c.clock
+			return
+		}
+	}
+
+	entry := walkCacheEntry{
+		pid:     pid,
+		level:   level,
+		prefix:  prefix,
+		lastUse: c.clock,
+	}
+
+	if len(c.entries) < c.numEntries {
+		c.entries = append(c.entries, entry)
+		return
+	}
+
+	victim := 0
+	for i := range c.entries {
+		if c.entries[i].lastUse < c.entries[victim].lastUse {
+			victim = i
+		}
+	}
+
+	c.entries[victim] = entry
+}
+
+// invalidate removes the entries that translate the given address, so that
+// the walks to the address read the page table again.
+func (c *walkCache) invalidate(pid vm.PID, vAddr uint64) {
+	kept := c.entries[:0]
+
+	for _, e := range c.entries {
+		if e.pid == pid && e.prefix == c.prefix(vAddr, e.level) {
+			continue
+		}
+
+		kept = append(kept, e)
+	}
+
+	c.entries = kept
+}
@@ -0,0 +1,42 @@
+package pagewalker
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Walk Cache", func() {
+	It("should skip the levels shared with a recent walk", func() {
+		c := newWalkCache(16, 4, 12, 9)
+
+		Expect(c.lookup(1, 0x1000)).To(Equal(0))
+
+		c.fill(1, 0x1000)
+
+		Expect(c.lookup(1, 0x2000)).To(Equal(3))
+		Expect(c.lookup(1, 0x1000_0000)).To(Equal(2))
+		Expect(c.lookup(2, 0x1000)).To(Equal(0))
+	})
+
+	It("should evict the least recently used entry", func() {
+		c := newWalkCache(3, 4, 12, 9)
+		c.fill(1, 0x1000)
+
+		c.insert(1, 3, 0x100)
+
+		Expect(c.entries).To(HaveLen(3))
+		Expect(c.lookup(1, 0x1000)).To(Equal(3))
+		Expect(c.lookup(1, uint64(0x100)<<21)).To(Equal(3))
+	})
+
+	It("should drop the entries that translate an invalidated address", func() {
+		c := newWalkCache(16, 4, 12, 9)
+		c.fill(1, 0x1000)
+		c.fill(1, uint64(1)<<39)
+
+		c.invalidate(1, 0x2000)
+
+		Expect(c.lookup(1, 0x1000)).To(Equal(0))
+		Expect(c.lookup(1, uint64(1)<<39)).To(Equal(3))
+	})
+})
@@ -0,0 +1,180 @@
+package prefetcher
+
+import (
+	"github.com/sarchlab/akita/v4/mem/mem"
+	"github.com/sarchlab/akita/v4/sim"
+)
+
+// A Builder can build prefetchers.
+type Builder struct {
+	engine            sim.Engine
+	freq              sim.Freq
+	policy            string
+	log2LineSize      uint64
+	log2PageSize      uint64
+	numReqPerCycle    int
+	bufferSize        int
+	degree            int
+	maxInflight       int
+	queueSize         int
+	trackingSize      int
+	timeoutCycles     int
+	throttleInterval  uint64
+	accuracyThreshold float64
+	lowModuleFinder   mem.AddressToPortMapper
+}
+
+// MakeBuilder creates a builder with default parameters.
+func MakeBuilder() Builder {
+	return Builder{
+		freq:             1 * sim.GHz,
+		policy:           "next-line",
+		log2LineSize:     6,
+		log2PageSize:     12,
+		numReqPerCycle:   4,
+		bufferSize:       16,
+		degree:           2,
+		maxInflight:      8,
+		queueSize:        16,
+		trackingSize:     256,
+		timeoutCycles:    10000,
+		throttleInterval: 64,
+	}
+}
+
+// WithEngine sets the engine to use.
+func (b Builder) WithEngine(engine sim.Engine) Builder {
+	b.engine = engine
+	return b
+}
+
+// WithFreq sets the frequency that the prefetcher works at.
+func (b Builder) WithFreq(freq sim.Freq) Builder {
+	b.freq = freq
+	return b
+}
+
+// WithPolicy sets the prefetch policy. It can be "next-line", "stride", or
+// "stream".
+func (b Builder) WithPolicy(policy string) Builder {
+	b.policy = policy
+	return b
+}
+
+// WithLog2LineSize sets the cache line size of the cache, as a power of 2.
+func (b Builder) WithLog2LineSize(n uint64) Builder {
+	b.log2LineSize = n
+	return b
+}
+
+// WithLog2PageSize sets the page size, as a power of 2. The prefetches never
+// cross a page boundary.
+func (b Builder) WithLog2PageSize(n uint64) Builder {
+	b.log2PageSize = n
+	return b
+}
+
+// WithNumReqPerCycle sets the number of requests that the prefetcher can
+// forward in each cycle.
+func (b Builder) WithNumReqPerCycle(n int) Builder {
+	b.numReqPerCycle = n
+	return b
+}
+
+// WithBufferSize sets the number of messages that each port can buffer.
+func (b Builder) WithBufferSize(n int) Builder {
+	b.bufferSize = n
+	return b
+}
+
+// WithDegree sets the maximum number of lines to prefetch after each read.
+func (b Builder) WithDegree(n int) Builder {
+	b.degree = n
+	return b
+}
+
+// WithMaxInflightPrefetches sets the number of prefetches that can be sent
+// to the cache and not yet completed.
+func (b Builder) WithMaxInflightPrefetches(n int) Builder {
+	b.maxInflight = n
+	return b
+}
+
+// WithQueueSize sets the number of prefetches that can wait to be issued.
+func (b Builder) WithQueueSize(n int) Builder {
+	b.queueSize = n
+	return b
+}
+
+// WithTrackingSize sets the number of prefetched lines that the prefetcher
+// remembers to tell if the prefetches are useful.
+func (b Builder) WithTrackingSize(n int) Builder {
+	b.trackingSize = n
+	return b
+}
+
+// WithTimeoutCycles sets the number of cycles after which a prefetch that has
+// not completed is considered lost.
+func (b Builder) WithTimeoutCycles(n int) Builder {
+	b.timeoutCycles = n
+	return b
+}
+
+// WithAccuracyThreshold sets the accuracy below which the prefetcher halves
+// the number of lines to prefetch after each read. The accuracy is measured
+// over every interval of issued prefetches. A threshold of 0 disables the
+// throttling.
+func (b Builder) WithAccuracyThreshold(threshold float64) Builder {
+	b.accuracyThreshold = threshold
+	return b
+}
+
+// WithThrottleInterval sets the number of issued prefetches over which the
+// accuracy is measured.
+func (b Builder) WithThrottleInterval(n uint64) Builder {
+	b.throttleInterval = n
+	return b
+}
+
+// WithLowModuleFinder sets the mapper that finds the cache that the requests
+// and the prefetches go to.
+func (b Builder) WithLowModuleFinder(m mem.AddressToPortMapper) Builder {
+	b.lowModuleFinder = m
+	return b
+}
+
+// Build creates a prefetcher with the given parameters.
+func (b Builder) Build(name string) *Comp {
+	c := &Comp{}
+	c.TickingComponent = sim.NewTickingComponent(name, b.engine, b.freq, c)
+
+	c.policy = NewPolicy(b.policy, b.log2LineSize)
+	c.lowModuleFinder = b.lowModuleFinder
+	c.log2LineSize = b.log2LineSize
+	c.log2PageSize = b.log2PageSize
+	c.numReqPerCycle = b.numReqPerCycle
+	c.maxDegree = b.degree
+	c.degree = b.degree
+	c.maxInflight = b.maxInflight
+	c.queueSize = b.queueSize
+	c.trackingSize = b.trackingSize
+	c.timeoutCycles = b.timeoutCycles
+	c.throttleInterval = b.throttleInterval
+	c.accuracyThreshold = b.accuracyThreshold
+	c.demands = make(map[string]mem.AccessReq)
+	c.inflight = make(map[string]*prefetch)
+	c.tracked = make(map[uint64]*prefetch)
+
+	b.createPorts(name, c)
+
+	return c
+}
+
+func (b *Builder) createPorts(name string, c *Comp) {
+	c.topPort = sim.NewPort(c, b.bufferSize, b.bufferSize, name+".TopPort")
+	c.AddPort("Top", c.topPort)
+
+	c.bottomPort = sim.NewPort(
+		c, b.bufferSize, b.bufferSize, name+".BottomPort")
+	c.AddPort("Bottom", c.bottomPort)
+}
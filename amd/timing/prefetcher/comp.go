@@ -0,0 +1,370 @@
+// Package prefetcher fetches the data that the GPU is about to read into the
+// caches before the data is requested.
+//
+// A prefetcher sits in front of a cache. It forwards all the requests to the
+// cache and watches the reads. A policy decides which cache lines to prefetch
+// after each read:
+//
+//   - "next-line": the lines that follow the line that is read.
+//   - "stride": the lines that the same instruction will read next, if the
+//     instruction reads with a constant stride. The caches do not pass the PC
+//     of the instructions on, so a prefetcher in front of an L2 cache sees all
+//     the reads as coming from the same instruction.
+//   - "stream": the lines ahead of a stream of ascending or descending reads.
+//
+// The prefetcher sends the prefetches to the cache as regular reads and drops
+// the responses, so that the cache allocates the data. The prefetches never
+// cross a page boundary, as the addresses are physical.
+//
+// The prefetcher counts a prefetch as useful if a read requests the line
+// later, and as late if the read arrives before the prefetch completes. It
+// throttles itself by halving the number of lines to prefetch after each read
+// if the accuracy falls below a threshold, and doubling it again if the
+// accuracy recovers.
+package prefetcher
+
+import (
+	"log"
+	"reflect"
+
+	"github.com/sarchlab/akita/v4/mem/mem"
+	"github.com/sarchlab/akita/v4/mem/vm"
+	"github.com/sarchlab/akita/v4/sim"
+	"github.com/sarchlab/mgpusim/v4/amd/protocol"
+)
+
+type prefetch struct {
+	line      uint64
+	pid       vm.PID
+	sent      bool
+	arrived   bool
+	issueTime sim.VTimeInSec
+}
+
+// Comp is a prefetcher in front of a cache.
+type Comp struct {
+	*sim.TickingComponent
+
+	topPort    sim.Port
+	bottomPort sim.Port
+
+	policy          Policy
+	lowModuleFinder mem.AddressToPortMapper
+	log2LineSize    uint64
+	log2PageSize    uint64
+	numReqPerCycle  int
+
+	maxDegree         int
+	degree            int
+	maxInflight       int
+	queueSize         int
+	trackingSize      int
+	timeoutCycles     int
+	throttleInterval  uint64
+	accuracyThreshold float64
+
+	demands    map[string]mem.AccessReq
+	inflight   map[string]*prefetch
+	queue      []*prefetch
+	tracked    map[uint64]*prefetch
+	trackOrder []*prefetch
+
+	numIssued      uint64
+	numUseful      uint64
+	numLate        uint64
+	numDemandReads uint64
+	intervalIssued uint64
+	intervalUseful uint64
+}
+
+// NumIssued returns the number of prefetches that have been sent to the
+// cache.
+func (c *Comp) NumIssued() uint64 {
+	return c.numIssued
+}
+
+// NumUseful returns the number of prefetched lines that have been read later.
+func (c *Comp) NumUseful() uint64 {
+	return c.numUseful
+}
+
+// NumLate returns the number of useful prefetches that have not completed
+// when the line is read.
+func (c *Comp) NumLate() uint64 {
+	return c.numLate
+}
+
+// NumDemandReads returns the number of reads that have arrived at the
+// prefetcher.
+func (c *Comp) NumDemandReads() uint64 {
+	return c.numDemandReads
+}
+
+// Accuracy returns the fraction of the issued prefetches that are useful.
+func (c *Comp) Accuracy() float64 {
+	if c.numIssued == 0 {
+		return 0
+	}
+
+	return float64(c.numUseful) / float64(c.numIssued)
+}
+
+// Coverage returns the fraction of the reads that hit the prefetched lines.
+func (c *Comp) Coverage() float64 {
+	if c.numDemandReads == 0 {
+		return 0
+	}
+
+	return float64(c.numUseful) / float64(c.numDemandReads)
+}
+
+// Timeliness returns the fraction of the useful prefetches that complete
+// before the line is read.
+func (c *Comp) Timeliness() float64 {
+	if c.numUseful == 0 {
+		return 0
+	}
+
+	return float64(c.numUseful-c.numLate) / float64(c.numUseful)
+}
+
+// Tick updates the state of the prefetcher.
+func (c *Comp) Tick() bool {
+	madeProgress := false
+
+	c.expireLostPrefetches()
+
+	madeProgress = c.parseFromBottom() || madeProgress
+
+	for i := 0; i < c.numReqPerCycle; i++ {
+		madeProgress = c.parseFromTop() || madeProgress
+	}
+
+	madeProgress = c.issue() || madeProgress
+
+	return madeProgress
+}
+
+// expireLostPrefetches forgets the prefetches that have not completed in time.
+// A cache flush can drop the in-flight requests without responding.
+func (c *Comp) expireLostPrefetches() {
+	now := c.CurrentTime()
+
+	for id, p := range c.inflight {
+		if c.Freq.NCyclesLater(c.timeoutCycles, p.issueTime) <= now {
+			delete(c.inflight, id)
+		}
+	}
+}
+
+func (c *Comp) parseFromBottom() bool {
+	msg := c.bottomPort.PeekIncoming()
+	if msg == nil {
+		return false
+	}
+
+	rsp, ok := msg.(mem.AccessRsp)
+	if !ok {
+		log.Panicf("cannot process message of type %s", reflect.TypeOf(msg))
+	}
+
+	if _, isDemand := c.demands[rsp.GetRspTo()]; isDemand {
+		return c.respond(rsp)
+	}
+
+	c.bottomPort.RetrieveIncoming()
+
+	p, found := c.inflight[rsp.GetRspTo()]
+	if found {
+		p.arrived = true
+		delete(c.inflight, rsp.GetRspTo())
+	}
+
+	return true
+}
+
+func (c *Comp) respond(rsp mem.AccessRsp) bool {
+	req := c.demands[rsp.GetRspTo()]
+
+	rspToTop := c.cloneRsp(rsp, req.Meta().ID)
+	rspToTop.Meta().Src = c.topPort.AsRemote()
+	rspToTop.Meta().Dst = req.Meta().Src
+
+	err := c.topPort.Send(rspToTop)
+	if err != nil {
+		return false
+	}
+
+	c.bottomPort.RetrieveIncoming()
+	delete(c.demands, rsp.GetRspTo())
+
+	return true
+}
+
+func (c *Comp) parseFromTop() bool {
+	msg := c.topPort.PeekIncoming()
+	if msg == nil {
+		return false
+	}
+
+	req, ok := msg.(mem.AccessReq)
+	if !ok {
+		log.Panicf("cannot process message of type %s", reflect.TypeOf(msg))
+	}
+
+	cloned := req.Clone().(mem.AccessReq)
+	cloned.Meta().Src = c.bottomPort.AsRemote()
+	cloned.Meta().Dst = c.lowModuleFinder.Find(req.GetAddress())
+
+	err := c.bottomPort.Send(cloned)
+	if err != nil {
+		return false
+	}
+
+	c.topPort.RetrieveIncoming()
+	c.demands[cloned.Meta().ID] = req
+
+	if read, isRead := req.(*mem.ReadReq); isRead {
+		c.observe(read)
+	}
+
+	return true
+}
+
+// observe checks if a read hits a prefetched line and queues the lines that
+// the policy suggests.
+func (c *Comp) observe(read *mem.ReadReq) {
+	c.numDemandReads++
+
+	line := c.lineAddress(read.Address)
+
+	if p, found := c.tracked[line]; found && p.sent {
+		c.numUseful++
+		c.intervalUseful++
+
+		if !p.arrived {
+			c.numLate++
+		}
+
+		delete(c.tracked, line)
+	}
+
+	pc := protocol.AccessInfoOf(read).PC
+	candidates := c.policy.Observe(pc, read.Address, c.degree)
+
+	for _, candidate := range candidates {
+		if len(c.queue) >= c.queueSize {
+			break
+		}
+
+		candidate = c.lineAddress(candidate)
+		if candidate == line || !c.samePage(candidate, line) {
+			continue
+		}
+
+		if _, found := c.tracked[candidate]; found {
+			continue
+		}
+
+		p := &prefetch{line: candidate, pid: read.PID}
+		c.queue = append(c.queue, p)
+		c.track(p)
+	}
+}
+
+func (c *Comp) track(p *prefetch) {
+	c.tracked[p.line] = p
+	c.trackOrder = append(c.trackOrder, p)
+
+	for len(c.trackOrder) > c.trackingSize {
+		oldest := c.trackOrder[0]
+		c.trackOrder = c.trackOrder[1:]
+
+		if c.tracked[oldest.line] == oldest {
+			delete(c.tracked, oldest.line)
+		}
+	}
+}
+
+// issue sends the first queued prefetch to the cache. The prefetches whose
+// lines have been read or evicted from the tracking table are dropped.
+func (c *Comp) issue() bool {
+	for len(c.queue) > 0 && c.tracked[c.queue[0].line] != c.queue[0] {
+		c.queue = c.queue[1:]
+	}
+
+	if len(c.queue) == 0 || len(c.inflight) >= c.maxInflight {
+		return false
+	}
+
+	p := c.queue[0]
+	req := mem.ReadReqBuilder{}.
+		WithSrc(c.bottomPort.AsRemote()).
+		WithDst(c.lowModuleFinder.Find(p.line)).
+		WithAddress(p.line).
+		WithByteSize(1 << c.log2LineSize).
+		WithPID(p.pid).
+		Build()
+
+	err := c.bottomPort.Send(req)
+	if err != nil {
+		return false
+	}
+
+	c.queue = c.queue[1:]
+	p.sent = true
+	p.issueTime = c.CurrentTime()
+	c.inflight[req.ID] = p
+	c.numIssued++
+	c.intervalIssued++
+
+	c.throttle()
+
+	return true
+}
+
+// throttle adjusts the number of lines to prefetch after each read by the
+// accuracy of the prefetches issued in the last interval.
+func (c *Comp) throttle() {
+	if c.accuracyThreshold <= 0 || c.intervalIssued < c.throttleInterval {
+		return
+	}
+
+	accuracy := float64(c.intervalUseful) / float64(c.intervalIssued)
+	if accuracy < c.accuracyThreshold {
+		c.degree = max(c.degree/2, 1)
+	} else {
+		c.degree = min(c.degree*2, c.maxDegree)
+	}
+
+	c.intervalIssued = 0
+	c.intervalUseful = 0
+}
+
+func (c *Comp) lineAddress(addr uint64) uint64 {
+	return addr >> c.log2LineSize << c.log2LineSize
+}
+
+func (c *Comp) samePage(a, b uint64) bool {
+	return a>>c.log2PageSize == b>>c.log2PageSize
+}
+
+func (c *Comp) cloneRsp(origin mem.AccessRsp, rspTo string) mem.AccessRsp {
+	switch origin := origin.(type) {
+	case *mem.DataReadyRsp:
+		rsp := origin.Clone().(*mem.DataReadyRsp)
+		rsp.RespondTo = rspTo
+
+		return rsp
+	case *mem.WriteDoneRsp:
+		rsp := origin.Clone().(*mem.WriteDoneRsp)
+		rsp.RespondTo = rspTo
+
+		return rsp
+	default:
+		log.Panicf("cannot clone response of type %s",
+			reflect.TypeOf(origin))
+	}
+
+	return nil
+}
@@ -0,0 +1,164 @@
+package prefetcher
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sarchlab/akita/v4/mem/mem"
+	"github.com/sarchlab/akita/v4/mem/vm"
+	"github.com/sarchlab/akita/v4/sim"
+	"go.uber.org/mock/gomock"
+)
+
+var _ = Describe("Prefetcher", func() {
+	var (
+		mockCtrl   *gomock.Controller
+		engine     *MockEngine
+		topPort    *MockPort
+		bottomPort *MockPort
+		c          *Comp
+		now        sim.VTimeInSec
+	)
+
+	read := func(addr uint64) *mem.ReadReq {
+		return mem.ReadReqBuilder{}.
+			WithSrc("L1").
+			WithAddress(addr).
+			WithByteSize(64).
+			WithPID(1).
+			Build()
+	}
+
+	BeforeEach(func() {
+		mockCtrl = gomock.NewController(GinkgoT())
+		engine = NewMockEngine(mockCtrl)
+		topPort = NewMockPort(mockCtrl)
+		bottomPort = NewMockPort(mockCtrl)
+		topPort.EXPECT().AsRemote().Return(sim.RemotePort("Top")).AnyTimes()
+		bottomPort.EXPECT().AsRemote().
+			Return(sim.RemotePort("Bottom")).AnyTimes()
+		now = 0
+		engine.EXPECT().CurrentTime().
+			DoAndReturn(func() sim.VTimeInSec { return now }).AnyTimes()
+
+		c = MakeBuilder().
+			WithEngine(engine).
+			WithDegree(2).
+			WithMaxInflightPrefetches(1).
+			WithLowModuleFinder(&mem.SinglePortMapper{Port: "Cache"}).
+			Build("Prefetcher")
+		c.topPort = topPort
+		c.bottomPort = bottomPort
+	})
+
+	AfterEach(func() {
+		mockCtrl.Finish()
+	})
+
+	It("should forward the reads and queue the prefetches", func() {
+		req := read(0x1000)
+		topPort.EXPECT().PeekIncoming().Return(req)
+		topPort.EXPECT().RetrieveIncoming().Return(req)
+		bottomPort.EXPECT().Send(gomock.Any()).
+			DoAndReturn(func(msg sim.Msg) *sim.SendError {
+				Expect(msg.Meta().Dst).To(Equal(sim.RemotePort("Cache")))
+				Expect(msg.(*mem.ReadReq).Address).To(Equal(uint64(0x1000)))
+				return nil
+			})
+
+		Expect(c.parseFromTop()).To(BeTrue())
+		Expect(c.demands).To(HaveLen(1))
+		Expect(c.queue).To(HaveLen(2))
+		Expect(c.NumDemandReads()).To(Equal(uint64(1)))
+	})
+
+	It("should not prefetch across the page boundary", func() {
+		req := read(0x1fc0)
+		topPort.EXPECT().PeekIncoming().Return(req)
+		topPort.EXPECT().RetrieveIncoming().Return(req)
+		bottomPort.EXPECT().Send(gomock.Any())
+
+		Expect(c.parseFromTop()).To(BeTrue())
+		Expect(c.queue).To(BeEmpty())
+	})
+
+	It("should issue the prefetches up to the limit", func() {
+		c.observe(read(0x1000))
+		bottomPort.EXPECT().Send(gomock.Any()).
+			DoAndReturn(func(msg sim.Msg) *sim.SendError {
+				req := msg.(*mem.ReadReq)
+				Expect(req.Address).To(Equal(uint64(0x1040)))
+				Expect(req.PID).To(Equal(vm.PID(1)))
+				return nil
+			})
+
+		Expect(c.issue()).To(BeTrue())
+		Expect(c.issue()).To(BeFalse())
+		Expect(c.NumIssued()).To(Equal(uint64(1)))
+	})
+
+	It("should drop the responses to the prefetches", func() {
+		p := &prefetch{line: 0x1040, sent: true}
+		c.inflight["prefetch"] = p
+		rsp := mem.DataReadyRspBuilder{}.WithRspTo("prefetch").Build()
+		bottomPort.EXPECT().PeekIncoming().Return(rsp)
+		bottomPort.EXPECT().RetrieveIncoming().Return(rsp)
+
+		Expect(c.parseFromBottom()).To(BeTrue())
+		Expect(p.arrived).To(BeTrue())
+		Expect(c.inflight).To(BeEmpty())
+	})
+
+	It("should return the responses to the reads", func() {
+		req := read(0x1000)
+		c.demands["sent"] = req
+		rsp := mem.DataReadyRspBuilder{}.WithRspTo("sent").Build()
+		bottomPort.EXPECT().PeekIncoming().Return(rsp)
+		bottomPort.EXPECT().RetrieveIncoming().Return(rsp)
+		topPort.EXPECT().Send(gomock.Any()).
+			DoAndReturn(func(msg sim.Msg) *sim.SendError {
+				dr := msg.(*mem.DataReadyRsp)
+				Expect(dr.RespondTo).To(Equal(req.ID))
+				Expect(dr.Dst).To(Equal(sim.RemotePort("L1")))
+				return nil
+			})
+
+		Expect(c.parseFromBottom()).To(BeTrue())
+		Expect(c.demands).To(BeEmpty())
+	})
+
+	It("should count the useful and the late prefetches", func() {
+		c.track(&prefetch{line: 0x1040, sent: true, arrived: true})
+		c.track(&prefetch{line: 0x1080, sent: true})
+		c.numIssued = 2
+
+		c.observe(read(0x1040))
+		c.observe(read(0x1080))
+
+		Expect(c.NumUseful()).To(Equal(uint64(2)))
+		Expect(c.NumLate()).To(Equal(uint64(1)))
+		Expect(c.Accuracy()).To(Equal(1.0))
+		Expect(c.Coverage()).To(Equal(1.0))
+		Expect(c.Timeliness()).To(Equal(0.5))
+	})
+
+	It("should halve the degree when the accuracy is low", func() {
+		c.accuracyThreshold = 0.5
+		c.throttleInterval = 4
+		c.intervalIssued = 4
+		c.intervalUseful = 1
+
+		c.throttle()
+
+		Expect(c.degree).To(Equal(1))
+		Expect(c.intervalIssued).To(Equal(uint64(0)))
+	})
+
+	It("should forget the prefetches that are lost", func() {
+		c.inflight["prefetch"] = &prefetch{issueTime: 0}
+		now = 20e-6
+
+		c.expireLostPrefetches()
+
+		Expect(c.inflight).To(BeEmpty())
+	})
+})
@@ -0,0 +1,206 @@
+package prefetcher
+
+import (
+	"log"
+)
+
+// A Policy decides which cache lines to prefetch.
+type Policy interface {
+	// Observe records a demand read and returns the addresses of the cache
+	// lines to prefetch. It returns at most degree addresses.
+	Observe(pc, addr uint64, degree int) []uint64
+}
+
+// NewPolicy creates a policy by name. The name can be "next-line", "stride",
+// or "stream".
+func NewPolicy(name string, log2LineSize uint64) Policy {
+	switch name {
+	case "next-line":
+		return &nextLinePolicy{log2LineSize: log2LineSize}
+	case "stride":
+		return &stridePolicy{
+			log2LineSize: log2LineSize,
+			tableSize:    64,
+			entries:      make(map[uint64]*strideEntry),
+		}
+	case "stream":
+		return &streamPolicy{
+			log2LineSize: log2LineSize,
+			numStreams:   16,
+			window:       4,
+		}
+	default:
+		log.Panicf("unknown prefetch policy %s", name)
+	}
+
+	return nil
+}
+
+// nextLinePolicy prefetches the lines that follow the line that is read.
+type nextLinePolicy struct {
+	log2LineSize uint64
+}
+
+func (p *nextLinePolicy) Observe(_, addr uint64, degree int) []uint64 {
+	lineSize := uint64(1) << p.log2LineSize
+	line := addr >> p.log2LineSize << p.log2LineSize
+
+	lines := make([]uint64, 0, degree)
+	for i := 1; i <= degree; i++ {
+		lines = append(lines, line+uint64(i)*lineSize)
+	}
+
+	return lines
+}
+
+type strideEntry struct {
+	lastAddr   uint64
+	stride     int64
+	confidence int
+}
+
+// stridePolicy finds the stride between the addresses that each instruction
+// reads. Once an instruction uses the same stride twice in a row, the policy
+// prefetches the lines that the next accesses of the instruction will read.
+type stridePolicy struct {
+	log2LineSize uint64
+	tableSize    int
+	entries      map[uint64]*strideEntry
+	order        []uint64
+}
+
+func (p *stridePolicy) Observe(pc, addr uint64, degree int) []uint64 {
+	e, found := p.entries[pc]
+	if !found {
+		p.allocate(pc, addr)
+		return nil
+	}
+
+	stride := int64(addr - e.lastAddr)
+	if stride == e.stride && stride != 0 {
+		e.confidence = min(e.confidence+1, 3)
+	} else {
+		e.stride = stride
+		e.confidence = 0
+	}
+
+	e.lastAddr = addr
+
+	if e.confidence < 1 {
+		return nil
+	}
+
+	currLine := addr >> p.log2LineSize
+	lines := make([]uint64, 0, degree)
+	next := addr
+
+	for len(lines) < degree {
+		next = uint64(int64(next) + e.stride)
+		line := next >> p.log2LineSize
+
+		if line == currLine {
+			continue
+		}
+
+		currLine = line
+		lines = append(lines, line<<p.log2LineSize)
+	}
+
+	return lines
+}
+
+func (p *stridePolicy) allocate(pc, addr uint64) {
+	if len(p.order) >= p.tableSize {
+		delete(p.entries, p.order[0])
+		p.order = p.order[1:]
+	}
+
+	p.entries[pc] = &strideEntry{lastAddr: addr}
+	p.order = append(p.order, pc)
+}
+
+type stream struct {
+	lastLine   uint64
+	direction  int64
+	confidence int
+}
+
+// streamPolicy tracks the streams of lines that are read in an ascending or a
+// descending order. An access that falls in the window after the last line of
+// a stream extends the stream. Once a stream moves in the same direction
+// twice, the policy prefetches the lines ahead of the stream.
+type streamPolicy struct {
+	log2LineSize uint64
+	numStreams   int
+	window       uint64
+	streams      []*stream
+}
+
+func (p *streamPolicy) Observe(_, addr uint64, degree int) []uint64 {
+	line := addr >> p.log2LineSize
+
+	s := p.find(line)
+	if s == nil {
+		p.allocate(line)
+		return nil
+	}
+
+	if line == s.lastLine {
+		return nil
+	}
+
+	direction := int64(1)
+	if line < s.lastLine {
+		direction = -1
+	}
+
+	if direction == s.direction {
+		s.confidence = min(s.confidence+1, 3)
+	} else {
+		s.direction = direction
+		s.confidence = 0
+	}
+
+	s.lastLine = line
+
+	if s.confidence < 1 {
+		return nil
+	}
+
+	lines := make([]uint64, 0, degree)
+	for i := 1; i <= degree; i++ {
+		next := int64(line) + int64(i)*direction
+		if next < 0 {
+			break
+		}
+
+		lines = append(lines, uint64(next)<<p.log2LineSize)
+	}
+
+	return lines
+}
+
+// find returns the stream that the line extends, and moves the stream to the
+// end of the list as the most recently used one.
+func (p *streamPolicy) find(line uint64) *stream {
+	for i, s := range p.streams {
+		if line+p.window < s.lastLine || line > s.lastLine+p.window {
+			continue
+		}
+
+		p.streams = append(p.streams[:i], p.streams[i+1:]...)
+		p.streams = append(p.streams, s)
+
+		return s
+	}
+
+	return nil
+}
+
+func (p *streamPolicy) allocate(line uint64) {
+	if len(p.streams) >= p.numStreams {
+		p.streams = p.streams[1:]
+	}
+
+	p.streams = append(p.streams, &stream{lastLine: line})
+}
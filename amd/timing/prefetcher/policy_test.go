@@ -0,0 +1,46 @@
+package prefetcher
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Policy", func() {
+	It("should panic on unknown policies", func() {
+		Expect(func() { NewPolicy("markov", 6) }).To(Panic())
+	})
+
+	It("should prefetch the next lines", func() {
+		p := NewPolicy("next-line", 6)
+
+		Expect(p.Observe(0, 0x1010, 2)).To(Equal([]uint64{0x1040, 0x1080}))
+	})
+
+	It("should prefetch by the stride of each instruction", func() {
+		p := NewPolicy("stride", 6)
+
+		Expect(p.Observe(0x40, 0x1000, 2)).To(BeEmpty())
+		Expect(p.Observe(0x80, 0x8000, 2)).To(BeEmpty())
+		Expect(p.Observe(0x40, 0x1100, 2)).To(BeEmpty())
+		Expect(p.Observe(0x40, 0x1200, 2)).To(Equal([]uint64{0x1300, 0x1400}))
+		Expect(p.Observe(0x80, 0x8040, 2)).To(BeEmpty())
+	})
+
+	It("should skip the lines that the stride does not leave", func() {
+		p := NewPolicy("stride", 6)
+
+		p.Observe(0x40, 0x1000, 2)
+		p.Observe(0x40, 0x1020, 2)
+
+		Expect(p.Observe(0x40, 0x1040, 2)).To(Equal([]uint64{0x1080, 0x10c0}))
+	})
+
+	It("should prefetch ahead of descending streams", func() {
+		p := NewPolicy("stream", 6)
+
+		Expect(p.Observe(0, 0x2000, 2)).To(BeEmpty())
+		Expect(p.Observe(0, 0x9000, 2)).To(BeEmpty())
+		Expect(p.Observe(0, 0x1fc0, 2)).To(BeEmpty())
+		Expect(p.Observe(0, 0x1f80, 2)).To(Equal([]uint64{0x1f40, 0x1f00}))
+	})
+})
@@ -3,6 +3,7 @@ package rdma
 import (
 	"github.com/sarchlab/akita/v4/mem/mem"
 	"github.com/sarchlab/akita/v4/sim"
+	"github.com/sarchlab/mgpusim/v4/amd/timing/coherence"
 )
 
 type Builder struct {
@@ -12,6 +13,13 @@ type Builder struct {
 	localModules           mem.AddressToPortMapper
 	RemoteRDMAAddressTable mem.AddressToPortMapper
 	bufferSize             int
+	directory              *coherence.Directory
+	linkPreset             string
+	devices                *DeviceTable
+
+	remoteCacheByteSize     uint64
+	remoteCacheWays         int
+	remoteCacheLog2LineSize uint64
 
 	incomingReqPerCycle int
 	incomingRspPerCycle int
@@ -24,6 +32,7 @@ func MakeBuilder() Builder {
 	return Builder{
 		freq:                1 * sim.GHz,
 		bufferSize:          128,
+		linkPreset:          "none",
 		incomingReqPerCycle: 1,
 		incomingRspPerCycle: 1,
 		outgoingReqPerCycle: 1,
@@ -61,6 +70,49 @@ func (b Builder) WithRemoteModules(m mem.AddressToPortMapper) Builder {
 	return b
 }
 
+// WithDirectory lets the RDMA engine record in the directory which GPUs have
+// read each local cache line and invalidate their copies when the line is
+// written. The RDMA engine also records which local caches have read each
+// line of the other GPUs, so that it only forwards the invalidations from the
+// other GPUs to the listeners of those caches.
+func (b Builder) WithDirectory(directory *coherence.Directory) Builder {
+	b.directory = directory
+	return b
+}
+
+// WithLink sets the link that the RDMA engine sends the packets to each of
+// the other devices through. The link can be "none", "ideal", "pcie3",
+// "pcie4", "pcie5", "nvlink", or "xgmi". With "none", the packets are sent
+// directly, and only the links set with SetLink are modeled.
+func (b Builder) WithLink(preset string) Builder {
+	b.linkPreset = preset
+	return b
+}
+
+// WithDeviceTable sets the table that finds the device that owns each port
+// that the RDMA engine sends to, so that the packets to a device share one
+// link. Without a table, each port is a device by itself.
+func (b Builder) WithDeviceTable(devices *DeviceTable) Builder {
+	b.devices = devices
+	return b
+}
+
+// WithRemoteCache lets the RDMA engine keep the data that the GPU reads from
+// the other GPUs in a set-associative cache. The reads that hit in the cache
+// are replied without crossing the fabric. The cache is invalidated when the
+// engine restarts after a drain, when the Command Processor asks for it at
+// kernel boundaries, and when the other GPUs invalidate the lines.
+func (b Builder) WithRemoteCache(
+	byteSize uint64,
+	wayAssociativity int,
+	log2LineSize uint64,
+) Builder {
+	b.remoteCacheByteSize = byteSize
+	b.remoteCacheWays = wayAssociativity
+	b.remoteCacheLog2LineSize = log2LineSize
+	return b
+}
+
 func (b Builder) WithIncomingReqPerCycle(n int) Builder {
 	b.incomingReqPerCycle = n
 	return b
@@ -93,6 +145,24 @@ func (b Builder) Build(name string) *Comp {
 	rdma.incomingRspPerCycle = b.incomingRspPerCycle
 	rdma.outgoingReqPerCycle = b.outgoingReqPerCycle
 	rdma.outgoingRspPerCycle = b.outgoingRspPerCycle
+	rdma.linkBytes = make(map[string]uint64)
+	rdma.devices = b.devices
+	rdma.linkPreset = b.linkPreset
+	rdma.links = make(map[string]*Link)
+
+	if b.linkPreset != "none" {
+		// Panics on unknown presets before any packet is sent.
+		NewLink(b.linkPreset)
+	}
+
+	rdma.directory = b.directory
+	rdma.invalidationListeners = make(map[sim.RemotePort]sim.RemotePort)
+	rdma.remoteReaders = make(map[uint64]map[sim.RemotePort]bool)
+
+	if b.remoteCacheByteSize > 0 {
+		rdma.remoteCache = newRemoteCache(b.remoteCacheByteSize,
+			b.remoteCacheWays, b.remoteCacheLog2LineSize)
+	}
 
 	rdma.RDMARequestInside = sim.NewPort(rdma, b.bufferSize, b.bufferSize, name+".RDMARequestInside")
 	rdma.RDMARequestOutside = sim.NewPort(rdma, b.bufferSize, b.bufferSize, name+".RDMARequestOutside")
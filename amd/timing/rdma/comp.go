@@ -4,10 +4,12 @@ package rdma
 import (
 	"log"
 	"reflect"
+	"sync"
 
 	"github.com/sarchlab/akita/v4/mem/mem"
 	"github.com/sarchlab/akita/v4/sim"
 	"github.com/sarchlab/akita/v4/tracing"
+	"github.com/sarchlab/mgpusim/v4/amd/timing/coherence"
 )
 
 type transaction struct {
@@ -15,6 +17,9 @@ type transaction struct {
 	fromOutside sim.Msg
 	toInside    sim.Msg
 	toOutside   sim.Msg
+
+	// fill tells whether the response fills the remote-data cache.
+	fill bool
 }
 
 // An Comp is a component that helps one GPU to access the memory on
@@ -40,6 +45,35 @@ type Comp struct {
 	transactionsFromOutside []transaction
 	transactionsFromInside  []transaction
 
+	linkBytes map[string]uint64
+
+	// links model the links to the other devices, indexed by the name of the
+	// device that devices finds for the destination of each packet. Without a
+	// link preset, only the devices with links set explicitly are modeled,
+	// and the packets to the other devices are sent directly. linkLock
+	// guards the links, which other components can look up with LinkTo.
+	devices    *DeviceTable
+	linkPreset string
+	linkLock   sync.Mutex
+	links      map[string]*Link
+	linkOrder  []string
+
+	// directory records the remote ports of the GPUs that have read each
+	// local cache line. It is nil if the directory is not enabled.
+	directory *coherence.Directory
+
+	// invalidationListeners maps each local cache to the port that receives
+	// the invalidations of the lines that the cache reads from the other
+	// GPUs. remoteReaders records the listeners to notify for each line.
+	invalidationListeners  map[sim.RemotePort]sim.RemotePort
+	remoteReaders          map[uint64]map[sim.RemotePort]bool
+	invalidationsToOutside []sim.Msg
+	invalidationsToInside  []sim.Msg
+
+	// remoteCache keeps the data that the GPU has read from the other GPUs.
+	// It is nil if the remote-data cache is not enabled.
+	remoteCache *remoteCache
+
 	incomingReqPerCycle int
 	incomingRspPerCycle int
 	outgoingReqPerCycle int
@@ -51,15 +85,50 @@ func (c *Comp) SetLocalModuleFinder(lmf mem.AddressToPortMapper) {
 	c.localModules = lmf
 }
 
+// LinkBytes returns the number of bytes that the RDMA engine has requested
+// from or sent to each of the remote devices, indexed by the name of the
+// device. The kernels and the memory copies share the links, so both are
+// counted.
+func (c *Comp) LinkBytes() map[string]uint64 {
+	return c.linkBytes
+}
+
+// SetLink lets the packets to the device that owns the given port go through
+// the given link.
+func (c *Comp) SetLink(dst sim.RemotePort, link *Link) {
+	c.linkLock.Lock()
+	defer c.linkLock.Unlock()
+
+	c.setLink(dst, link)
+}
+
+func (c *Comp) setLink(dst sim.RemotePort, link *Link) {
+	device := c.devices.Find(dst)
+	if _, found := c.links[device]; !found {
+		c.linkOrder = append(c.linkOrder, device)
+	}
+
+	c.links[device] = link
+}
+
+// Links returns the links that the RDMA engine sends the packets through,
+// indexed by the name of the device at the other side of each link.
+func (c *Comp) Links() map[string]*Link {
+	return c.links
+}
+
 // Tick checks if make progress
 func (c *Comp) Tick() bool {
 	madeProgress := false
 
+	madeProgress = c.deliverPackets() || madeProgress
 	madeProgress = c.processFromCtrlPort() || madeProgress
 	if c.isDraining {
 		madeProgress = c.drainRDMA() || madeProgress
 	}
 
+	madeProgress = c.sendInvalidations() || madeProgress
+
 	for i := 0; i < c.outgoingReqPerCycle; i++ {
 		madeProgress = c.processFromL1() || madeProgress
 	}
@@ -85,6 +154,10 @@ func (c *Comp) processFromCtrlPort() bool {
 		return false
 	}
 
+	if req, ok := req.(*InvalidateCacheReq); ok {
+		return c.processInvalidateCacheReq(req)
+	}
+
 	req = c.CtrlPort.RetrieveIncoming()
 	switch req := req.(type) {
 	case *DrainReq:
@@ -100,6 +173,27 @@ func (c *Comp) processFromCtrlPort() bool {
 	}
 }
 
+// processInvalidateCacheReq drops the data in the remote-data cache and
+// acknowledges the request. The request waits if the acknowledgement cannot
+// be sent.
+func (c *Comp) processInvalidateCacheReq(req *InvalidateCacheReq) bool {
+	rsp := InvalidateCacheRspBuilder{}.
+		WithSrc(c.CtrlPort.AsRemote()).
+		WithDst(req.Src).
+		WithRspTo(req.ID).
+		Build()
+
+	err := c.CtrlPort.Send(rsp)
+	if err != nil {
+		return false
+	}
+
+	c.CtrlPort.RetrieveIncoming()
+	c.invalidateRemoteCache()
+
+	return true
+}
+
 func (c *Comp) processRDMARestartReq() bool {
 	restartCompleteRsp := RestartRspBuilder{}.
 		WithSrc(c.CtrlPort.AsRemote()).
@@ -113,6 +207,9 @@ func (c *Comp) processRDMARestartReq() bool {
 	c.currentDrainReq = nil
 	c.pauseIncomingReqsFromL1 = false
 
+	// The pages may have migrated while the engine was drained.
+	c.invalidateRemoteCache()
+
 	return true
 }
 
@@ -134,8 +231,20 @@ func (c *Comp) drainRDMA() bool {
 }
 
 func (c *Comp) fullyDrained() bool {
-	return len(c.transactionsFromOutside) == 0 &&
-		len(c.transactionsFromInside) == 0
+	if len(c.transactionsFromOutside) > 0 || len(c.transactionsFromInside) > 0 {
+		return false
+	}
+
+	c.linkLock.Lock()
+	defer c.linkLock.Unlock()
+
+	for _, link := range c.links {
+		if len(link.inflight) > 0 {
+			return false
+		}
+	}
+
+	return true
 }
 
 func (c *Comp) processFromL1() bool {
@@ -157,6 +266,9 @@ func (c *Comp) processFromL1() bool {
 				return madeProgress
 			}
 
+			madeProgress = true
+		case *coherence.InvalidateReq:
+			c.processInvalidateReqFromL1(req)
 			madeProgress = true
 		default:
 			log.Panicf("cannot process request of type %s", reflect.TypeOf(req))
@@ -170,13 +282,23 @@ func (c *Comp) processReqFromL1(
 ) bool {
 	dst := c.RemoteRDMAAddressTable.Find(req.GetAddress())
 
+	c.recordLocalRead(req)
+
+	read, cacheable := c.cacheableRead(req)
+	if cacheable {
+		if data, hit := c.remoteCache.lookup(read); hit {
+			return c.replyFromRemoteCache(read, data, dst)
+		}
+	}
+
 	cloned := c.cloneReq(req)
 	cloned.Meta().Src = c.RDMARequestOutside.AsRemote()
 	cloned.Meta().Dst = dst
 
-	err := c.RDMARequestOutside.Send(cloned)
-	if err == nil {
+	if c.sendOutside(c.RDMARequestOutside, cloned) {
 		c.RDMARequestInside.RetrieveIncoming()
+		c.countLinkBytes(dst, req)
+		c.invalidateWrittenLines(req)
 
 		c.traceInsideOutStart(req, cloned)
 
@@ -184,6 +306,11 @@ func (c *Comp) processReqFromL1(
 			fromInside: req,
 			toOutside:  cloned,
 		}
+
+		if cacheable {
+			c.remoteCache.stats.NumMisses++
+			trans.fill = c.remoteCache.fillable(read)
+		}
 		c.transactionsFromInside = append(c.transactionsFromInside, trans)
 
 		return true
@@ -192,6 +319,80 @@ func (c *Comp) processReqFromL1(
 	return false
 }
 
+func (c *Comp) countLinkBytes(dst sim.RemotePort, req mem.AccessReq) {
+	device := c.devices.Find(dst)
+
+	switch req := req.(type) {
+	case *mem.ReadReq:
+		c.linkBytes[device] += req.AccessByteSize
+	case *mem.WriteReq:
+		c.linkBytes[device] += uint64(len(req.Data))
+	}
+}
+
+// sendOutside sends a message to another device. If the link to the device is
+// modeled, the message is put on the link and delivered after it arrives. It
+// returns false if the message cannot be sent in this cycle.
+func (c *Comp) sendOutside(port sim.Port, msg sim.Msg) bool {
+	link := c.link(msg.Meta().Dst)
+	if link == nil {
+		return port.Send(msg) == nil
+	}
+
+	if !link.hasCredit() {
+		return false
+	}
+
+	link.transfer(msg, port, c.CurrentTime())
+
+	return true
+}
+
+// LinkTo returns the link to the device that owns the given port, so that
+// other components of the GPU can share the link. It returns nil if the link
+// is not modeled.
+func (c *Comp) LinkTo(dst sim.RemotePort) *Link {
+	return c.link(dst)
+}
+
+// link returns the link to the device that owns the given port, or nil if the
+// link is not modeled.
+func (c *Comp) link(dst sim.RemotePort) *Link {
+	c.linkLock.Lock()
+	defer c.linkLock.Unlock()
+
+	link, found := c.links[c.devices.Find(dst)]
+	if found {
+		return link
+	}
+
+	if c.linkPreset == "none" {
+		return nil
+	}
+
+	link = NewLink(c.linkPreset)
+	c.setLink(dst, link)
+
+	return link
+}
+
+// deliverPackets delivers the packets that have arrived at the other side of
+// the links. It keeps the engine ticking while any packet is in flight.
+func (c *Comp) deliverPackets() bool {
+	c.linkLock.Lock()
+	defer c.linkLock.Unlock()
+
+	madeProgress := false
+	now := c.CurrentTime()
+
+	for _, device := range c.linkOrder {
+		delivered, pending := c.links[device].deliver(now)
+		madeProgress = madeProgress || delivered || pending
+	}
+
+	return madeProgress
+}
+
 func (c *Comp) processFromL2() bool {
 	for {
 		req := c.RDMADataInside.PeekIncoming()
@@ -222,8 +423,7 @@ func (c *Comp) processRspFromL2(
 	rspToOutside.Meta().Src = c.RDMADataOutside.AsRemote()
 	rspToOutside.Meta().Dst = trans.fromOutside.Meta().Src
 
-	err := c.RDMADataOutside.Send(rspToOutside)
-	if err == nil {
+	if c.sendOutside(c.RDMADataOutside, rspToOutside) {
 		c.RDMADataInside.RetrieveIncoming()
 
 		c.traceOutsideInEnd(trans)
@@ -251,6 +451,9 @@ func (c *Comp) processIncomingRsp() bool {
 			return madeProgress
 		}
 		madeProgress = true
+	case *coherence.InvalidateReq:
+		c.processInvalidateReqFromOutside(req)
+		madeProgress = true
 	default:
 		log.Panicf("cannot process request of type %s", reflect.TypeOf(req))
 		return false
@@ -274,6 +477,11 @@ func (c *Comp) processRspFromRDMARequestOutside(
 	if err == nil {
 		c.RDMARequestOutside.RetrieveIncoming()
 
+		if dataReady, ok := rsp.(*mem.DataReadyRsp); ok && trans.fill {
+			c.remoteCache.fill(
+				trans.fromInside.(mem.AccessReq).GetAddress(), dataReady.Data)
+		}
+
 		c.traceInsideOutEnd(trans)
 
 		c.transactionsFromInside =
@@ -320,6 +528,7 @@ func (c *Comp) processReqFromRDMADataOutside(
 		c.RDMADataOutside.RetrieveIncoming()
 
 		c.traceOutsideInStart(req, cloned)
+		c.recordRemoteAccess(req)
 
 		trans := transaction{
 			fromOutside: req,
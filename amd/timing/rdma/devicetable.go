@@ -0,0 +1,36 @@
+package rdma
+
+import "github.com/sarchlab/akita/v4/sim"
+
+// A DeviceTable finds the device that owns a port, so that the RDMA engine
+// sends the requests and the responses to a device through the same link.
+//
+// The platform adds each device to the table as it builds the device, so the
+// RDMA engines share the table, like the address tables.
+type DeviceTable struct {
+	devices map[sim.RemotePort]string
+}
+
+// NewDeviceTable creates an empty table.
+func NewDeviceTable() *DeviceTable {
+	return &DeviceTable{devices: make(map[sim.RemotePort]string)}
+}
+
+// AddDevice records that the ports belong to the named device.
+func (t *DeviceTable) AddDevice(name string, ports ...sim.RemotePort) {
+	for _, port := range ports {
+		t.devices[port] = name
+	}
+}
+
+// Find returns the name of the device that owns the port. A port that is not
+// in the table is a device by itself, named after the port.
+func (t *DeviceTable) Find(port sim.RemotePort) string {
+	if t != nil {
+		if name, found := t.devices[port]; found {
+			return name
+		}
+	}
+
+	return string(port)
+}
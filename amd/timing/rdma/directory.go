@@ -0,0 +1,143 @@
+package rdma
+
+import (
+	"sort"
+
+	"github.com/sarchlab/akita/v4/mem/mem"
+	"github.com/sarchlab/akita/v4/sim"
+	"github.com/sarchlab/mgpusim/v4/amd/timing/coherence"
+)
+
+// AddInvalidationListener adds a port that receives the invalidate requests
+// that the other GPUs send to this GPU. The listener only receives the
+// invalidations of the lines that the given cache has read through the RDMA
+// engine.
+func (c *Comp) AddInvalidationListener(listener, cache sim.RemotePort) {
+	c.invalidationListeners[cache] = listener
+}
+
+// NumSharedLines returns the number of local cache lines that the other GPUs
+// may have cached. It is always 0 if the directory is not enabled.
+func (c *Comp) NumSharedLines() int {
+	if c.directory == nil {
+		return 0
+	}
+
+	return c.directory.NumSharedLines()
+}
+
+// recordRemoteAccess updates the directory with an access from another GPU.
+// A read makes the GPU a sharer of the line, while a write invalidates the
+// copies on all the other sharers.
+func (c *Comp) recordRemoteAccess(req mem.AccessReq) {
+	if c.directory == nil {
+		return
+	}
+
+	switch req.(type) {
+	case *mem.ReadReq:
+		c.directory.AddSharer(req.GetAddress(), req.Meta().Src)
+	case *mem.WriteReq:
+		c.invalidateSharers(req.GetAddress(), req.Meta().Src)
+	}
+}
+
+// recordLocalRead records which listener needs to be invalidated when the
+// line that a local cache reads from another GPU is written.
+func (c *Comp) recordLocalRead(req mem.AccessReq) {
+	if c.directory == nil {
+		return
+	}
+
+	if _, isRead := req.(*mem.ReadReq); !isRead {
+		return
+	}
+
+	listener, found := c.invalidationListeners[req.Meta().Src]
+	if !found {
+		return
+	}
+
+	line := c.directory.LineAddress(req.GetAddress())
+	if c.remoteReaders[line] == nil {
+		c.remoteReaders[line] = make(map[sim.RemotePort]bool)
+	}
+
+	c.remoteReaders[line][listener] = true
+}
+
+// invalidateSharers sends invalidate requests to all the sharers of a line
+// except the writer. The writer is empty if the line is written locally.
+func (c *Comp) invalidateSharers(addr uint64, writer sim.RemotePort) {
+	line := c.directory.LineAddress(addr)
+
+	for _, port := range c.directory.RemoveSharers(line, writer) {
+		req := coherence.InvalidateReqBuilder{}.
+			WithSrc(c.RDMARequestOutside.AsRemote()).
+			WithDst(port).
+			WithAddress(line).
+			Build()
+		c.invalidationsToOutside = append(c.invalidationsToOutside, req)
+	}
+}
+
+func (c *Comp) processInvalidateReqFromL1(req *coherence.InvalidateReq) {
+	c.RDMARequestInside.RetrieveIncoming()
+
+	if c.directory == nil {
+		return
+	}
+
+	c.invalidateSharers(req.Address, "")
+}
+
+// processInvalidateReqFromOutside forwards an invalidation to the listeners
+// whose caches have read the line.
+func (c *Comp) processInvalidateReqFromOutside(
+	req *coherence.InvalidateReq,
+) {
+	c.RDMARequestOutside.RetrieveIncoming()
+	c.invalidateRemoteLine(req.Address)
+
+	readers := c.remoteReaders[req.Address]
+	delete(c.remoteReaders, req.Address)
+
+	listeners := make([]sim.RemotePort, 0, len(readers))
+	for listener := range readers {
+		listeners = append(listeners, listener)
+	}
+
+	sort.Slice(listeners, func(i, j int) bool {
+		return listeners[i] < listeners[j]
+	})
+
+	for _, port := range listeners {
+		notice := coherence.InvalidateReqBuilder{}.
+			WithSrc(c.RDMARequestInside.AsRemote()).
+			WithDst(port).
+			WithAddress(req.Address).
+			Build()
+		c.invalidationsToInside = append(c.invalidationsToInside, notice)
+	}
+}
+
+func (c *Comp) sendInvalidations() bool {
+	madeProgress := false
+
+	if len(c.invalidationsToOutside) > 0 {
+		if c.sendOutside(c.RDMARequestOutside, c.invalidationsToOutside[0]) {
+			c.invalidationsToOutside = c.invalidationsToOutside[1:]
+			madeProgress = true
+		}
+	}
+
+	if len(c.invalidationsToInside) > 0 {
+		err := c.RDMARequestInside.Send(c.invalidationsToInside[0])
+		if err == nil {
+			c.invalidationsToInside = c.invalidationsToInside[1:]
+			madeProgress = true
+		}
+	}
+
+	return madeProgress
+}
@@ -0,0 +1,269 @@
+package rdma
+
+import (
+	"log"
+	"math"
+	"sync"
+
+	"github.com/sarchlab/akita/v4/mem/mem"
+	"github.com/sarchlab/akita/v4/sim"
+	"github.com/sarchlab/mgpusim/v4/amd/timing/coherence"
+)
+
+// numLatencyBuckets is the number of buckets of the latency histogram of a
+// link. Bucket i counts the packets that take less than 2^i ns, and the last
+// bucket also counts all the slower packets.
+const numLatencyBuckets = 24
+
+type packet struct {
+	msg       sim.Msg
+	port      sim.Port
+	sendTime  sim.VTimeInSec
+	arrivalAt sim.VTimeInSec
+}
+
+// A Link models the direction of the link from the GPU to another device.
+// The link serializes one packet at a time. Each packet carries a header in
+// addition to its data. The packets travel across the link with a fixed
+// latency after they are serialized.
+//
+// The link uses credit-based flow control. Each packet in flight takes a
+// credit, which returns when the receiver accepts the packet. The RDMA engine
+// stops sending to the device when the link runs out of credits.
+//
+// Other components, such as the page migration controller, can share the link
+// with the RDMA engine by reserving the link for their own packets.
+type Link struct {
+	// Bandwidth is the number of bytes that the link transfers per second. A
+	// bandwidth of 0 transfers data instantly.
+	Bandwidth float64
+
+	// Latency is the time that a packet takes to travel across the link.
+	Latency sim.VTimeInSec
+
+	// HeaderBytes is the number of bytes that each packet carries in addition
+	// to its data.
+	HeaderBytes uint64
+
+	// NumCredits is the number of packets that can be in flight on the link.
+	// 0 means unlimited.
+	NumCredits int
+
+	inflight []*packet
+
+	// lock guards the busy time and the statistics, which the components that
+	// share the link update.
+	lock      sync.Mutex
+	busyUntil sim.VTimeInSec
+	stats     LinkStats
+}
+
+// LinkStats is the statistics of a link.
+type LinkStats struct {
+	NumPackets   uint64
+	NumBytes     uint64
+	BusyTime     sim.VTimeInSec
+	TotalLatency sim.VTimeInSec
+	MaxLatency   sim.VTimeInSec
+
+	latencyBuckets [numLatencyBuckets]uint64
+}
+
+// MeanLatency returns the average time from a packet entering the link to the
+// packet being delivered, including the time that the packet waits for the
+// link.
+func (s LinkStats) MeanLatency() sim.VTimeInSec {
+	if s.NumPackets == 0 {
+		return 0
+	}
+
+	return s.TotalLatency / sim.VTimeInSec(s.NumPackets)
+}
+
+// LatencyPercentile returns an upper bound of the latency that the given
+// fraction of the packets do not exceed. The bound is a power of 2 in ns.
+func (s LinkStats) LatencyPercentile(p float64) sim.VTimeInSec {
+	if s.NumPackets == 0 {
+		return 0
+	}
+
+	target := uint64(math.Ceil(p * float64(s.NumPackets)))
+	count := uint64(0)
+
+	for i, n := range s.latencyBuckets {
+		count += n
+		if count >= target {
+			return sim.VTimeInSec(float64(uint64(1)<<i) * 1e-9)
+		}
+	}
+
+	return s.MaxLatency
+}
+
+// Utilization returns the fraction of the given duration that the link has
+// spent serializing packets.
+func (s LinkStats) Utilization(duration sim.VTimeInSec) float64 {
+	if duration <= 0 {
+		return 0
+	}
+
+	return float64(s.BusyTime / duration)
+}
+
+func (s *LinkStats) recordLatency(latency sim.VTimeInSec) {
+	s.NumPackets++
+	s.TotalLatency += latency
+	s.MaxLatency = max(s.MaxLatency, latency)
+
+	ns := float64(latency) * 1e9
+	bucket := 0
+
+	for bucket < numLatencyBuckets-1 && ns >= float64(uint64(1)<<bucket) {
+		bucket++
+	}
+
+	s.latencyBuckets[bucket]++
+}
+
+// NewLink creates a link by name. The preset can be "ideal", "pcie3",
+// "pcie4", "pcie5", "nvlink", or "xgmi". The PCIe links have 16 lanes. The
+// ideal link transfers data instantly and never runs out of credits.
+func NewLink(preset string) *Link {
+	switch preset {
+	case "ideal":
+		return &Link{}
+	case "pcie3":
+		return &Link{
+			Bandwidth: 15.75e9, Latency: 1e-6, HeaderBytes: 24, NumCredits: 32,
+		}
+	case "pcie4":
+		return &Link{
+			Bandwidth: 31.5e9, Latency: 1e-6, HeaderBytes: 24, NumCredits: 32,
+		}
+	case "pcie5":
+		return &Link{
+			Bandwidth: 63e9, Latency: 1e-6, HeaderBytes: 24, NumCredits: 32,
+		}
+	case "nvlink":
+		return &Link{
+			Bandwidth: 150e9, Latency: 500e-9, HeaderBytes: 16, NumCredits: 64,
+		}
+	case "xgmi":
+		return &Link{
+			Bandwidth: 50e9, Latency: 600e-9, HeaderBytes: 16, NumCredits: 64,
+		}
+	default:
+		log.Panicf("unknown link preset %s", preset)
+	}
+
+	return nil
+}
+
+// Stats returns the statistics of the link.
+func (l *Link) Stats() LinkStats {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return l.stats
+}
+
+func (l *Link) hasCredit() bool {
+	return l.NumCredits == 0 || len(l.inflight) < l.NumCredits
+}
+
+// transfer puts a message on the link. The message is delivered through the
+// port after it arrives at the other side of the link.
+func (l *Link) transfer(msg sim.Msg, port sim.Port, now sim.VTimeInSec) {
+	_, arrivalAt := l.serialize(payloadBytes(msg), now)
+
+	l.inflight = append(l.inflight, &packet{
+		msg:       msg,
+		port:      port,
+		sendTime:  now,
+		arrivalAt: arrivalAt,
+	})
+}
+
+// Reserve serializes a packet that carries the given number of data bytes on
+// the link, for a component that delivers the packet by itself. The packet
+// does not take a credit. Reserve returns the time that the link starts to
+// serialize the packet and the time that the packet arrives at the other side
+// of the link.
+func (l *Link) Reserve(
+	dataBytes uint64,
+	now sim.VTimeInSec,
+) (start, arrivalAt sim.VTimeInSec) {
+	start, arrivalAt = l.serialize(dataBytes, now)
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.stats.recordLatency(arrivalAt - now)
+
+	return start, arrivalAt
+}
+
+// serialize occupies the link with a packet after the packets that are
+// already on it.
+func (l *Link) serialize(
+	dataBytes uint64,
+	now sim.VTimeInSec,
+) (start, arrivalAt sim.VTimeInSec) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	byteSize := l.HeaderBytes + dataBytes
+	start = max(now, l.busyUntil)
+
+	duration := sim.VTimeInSec(0)
+	if l.Bandwidth > 0 {
+		duration = sim.VTimeInSec(float64(byteSize) / l.Bandwidth)
+	}
+
+	l.busyUntil = start + duration
+	l.stats.BusyTime += duration
+	l.stats.NumBytes += byteSize
+
+	return start, start + duration + l.Latency
+}
+
+// deliver sends the packets that have arrived to the receiver in order. It
+// returns whether any packet is delivered and whether any packet is still in
+// flight.
+func (l *Link) deliver(now sim.VTimeInSec) (delivered, pending bool) {
+	for len(l.inflight) > 0 {
+		p := l.inflight[0]
+		if p.arrivalAt > now {
+			return delivered, true
+		}
+
+		err := p.port.Send(p.msg)
+		if err != nil {
+			return delivered, true
+		}
+
+		l.lock.Lock()
+		l.stats.recordLatency(now - p.sendTime)
+		l.lock.Unlock()
+
+		l.inflight = l.inflight[1:]
+		delivered = true
+	}
+
+	return delivered, false
+}
+
+func payloadBytes(msg sim.Msg) uint64 {
+	switch msg := msg.(type) {
+	case *mem.WriteReq:
+		return uint64(len(msg.Data))
+	case *mem.DataReadyRsp:
+		return uint64(len(msg.Data))
+	case *mem.ReadReq, *mem.WriteDoneRsp, *coherence.InvalidateReq:
+		return 0
+	default:
+		log.Panicf("cannot send message of type %T over a link", msg)
+	}
+
+	return 0
+}
@@ -8,6 +8,7 @@ import (
 	. "github.com/onsi/gomega"
 	"github.com/sarchlab/akita/v4/mem/mem"
 	"github.com/sarchlab/akita/v4/sim"
+	"github.com/sarchlab/mgpusim/v4/amd/timing/coherence"
 	"go.uber.org/mock/gomock"
 )
 
@@ -104,6 +105,8 @@ var _ = Describe("Engine", func() {
 			rdmaEngine.processFromL1()
 
 			Expect(rdmaEngine.transactionsFromInside).To(HaveLen(1))
+			Expect(rdmaEngine.LinkBytes()).
+				To(HaveKeyWithValue(string(remoteGPU.AsRemote()), uint64(64)))
 		})
 
 		It("should wait if outside connection is busy", func() {
@@ -115,6 +118,7 @@ var _ = Describe("Engine", func() {
 			rdmaEngine.processFromL1()
 
 			Expect(rdmaEngine.transactionsFromInside).To(HaveLen(0))
+			Expect(rdmaEngine.LinkBytes()).To(BeEmpty())
 		})
 	})
 
@@ -268,6 +272,360 @@ var _ = Describe("Engine", func() {
 			Expect(rdmaEngine.transactionsFromOutside).To(HaveLen(1))
 		})
 	})
+	Context("Link", func() {
+		var link *Link
+
+		BeforeEach(func() {
+			link = &Link{
+				Bandwidth:   64e9,
+				Latency:     1e-9,
+				HeaderBytes: 16,
+				NumCredits:  1,
+			}
+			rdmaEngine.SetLink(remoteGPU.AsRemote(), link)
+		})
+
+		It("should put the requests on the link until it runs out of credits",
+			func() {
+				write := mem.WriteReqBuilder{}.
+					WithSrc(localCache.AsRemote()).
+					WithAddress(0x100).
+					WithData(make([]byte, 48)).
+					Build()
+				engine.EXPECT().CurrentTime().Return(sim.VTimeInSec(0))
+				RDMARequestInside.EXPECT().PeekIncoming().Return(write).Times(2)
+				RDMARequestInside.EXPECT().RetrieveIncoming().Return(write)
+
+				rdmaEngine.processFromL1()
+
+				Expect(rdmaEngine.transactionsFromInside).To(HaveLen(1))
+				Expect(link.inflight).To(HaveLen(1))
+				Expect(link.inflight[0].arrivalAt).
+					To(BeNumerically("~", 2e-9, 1e-15))
+				Expect(link.Stats().NumBytes).To(Equal(uint64(64)))
+			})
+
+		It("should deliver the packets after they arrive", func() {
+			read := mem.ReadReqBuilder{}.
+				WithAddress(0x100).
+				WithByteSize(64).
+				Build()
+			link.transfer(read, RDMARequestOutside, 0)
+			engine.EXPECT().CurrentTime().Return(sim.VTimeInSec(1e-9))
+			engine.EXPECT().CurrentTime().Return(sim.VTimeInSec(2e-9))
+			RDMARequestOutside.EXPECT().Send(read).Return(nil)
+
+			Expect(rdmaEngine.deliverPackets()).To(BeTrue())
+			Expect(link.inflight).To(HaveLen(1))
+			Expect(rdmaEngine.deliverPackets()).To(BeTrue())
+			Expect(link.inflight).To(BeEmpty())
+			Expect(link.Stats().NumPackets).To(Equal(uint64(1)))
+			Expect(link.Stats().MaxLatency).
+				To(BeNumerically("~", 2e-9, 1e-15))
+		})
+
+		It("should report the latency distribution", func() {
+			stats := LinkStats{}
+			stats.recordLatency(3e-9)
+			stats.recordLatency(3e-9)
+			stats.recordLatency(100e-9)
+
+			Expect(stats.MeanLatency()).
+				To(BeNumerically("~", 106e-9/3, 1e-15))
+			Expect(stats.LatencyPercentile(0.5)).
+				To(BeNumerically("~", 4e-9, 1e-15))
+			Expect(stats.LatencyPercentile(0.99)).
+				To(BeNumerically("~", 128e-9, 1e-15))
+		})
+
+		It("should panic on unknown presets", func() {
+			Expect(func() { NewLink("infiniband") }).To(Panic())
+		})
+
+		It("should send the requests and the responses to a device through "+
+			"the same link", func() {
+			devices := NewDeviceTable()
+			devices.AddDevice("GPU[2]",
+				"GPU[2].RDMARequestOutside", "GPU[2].RDMADataOutside")
+			rdmaEngine.devices = devices
+			rdmaEngine.SetLink("GPU[2].RDMADataOutside", link)
+
+			Expect(rdmaEngine.link("GPU[2].RDMARequestOutside")).To(Equal(link))
+			Expect(rdmaEngine.Links()).To(HaveKey("GPU[2]"))
+		})
+
+		It("should create one link for each device", func() {
+			devices := NewDeviceTable()
+			devices.AddDevice("GPU[2]",
+				"GPU[2].RDMARequestOutside", "GPU[2].RDMADataOutside")
+			rdmaEngine.devices = devices
+			rdmaEngine.linkPreset = "pcie4"
+
+			toData := rdmaEngine.link("GPU[2].RDMADataOutside")
+			toRequest := rdmaEngine.link("GPU[2].RDMARequestOutside")
+
+			Expect(toData).NotTo(BeNil())
+			Expect(toRequest).To(BeIdenticalTo(toData))
+			Expect(rdmaEngine.linkOrder).To(HaveLen(2))
+		})
+	})
+
+	Context("Remote cache", func() {
+		var read *mem.ReadReq
+
+		BeforeEach(func() {
+			rdmaEngine.remoteCache = newRemoteCache(256, 2, 6)
+			read = mem.ReadReqBuilder{}.
+				WithSrc(localCache.AsRemote()).
+				WithAddress(0x100).
+				WithByteSize(64).
+				Build()
+		})
+
+		It("should fill the cache with the data of the misses", func() {
+			RDMARequestInside.EXPECT().PeekIncoming().Return(read)
+			RDMARequestOutside.EXPECT().
+				Send(gomock.AssignableToTypeOf(&mem.ReadReq{})).
+				Return(nil)
+			RDMARequestInside.EXPECT().RetrieveIncoming().Return(read)
+			RDMARequestInside.EXPECT().PeekIncoming().Return(nil)
+
+			rdmaEngine.processFromL1()
+
+			trans := rdmaEngine.transactionsFromInside[0]
+			Expect(trans.fill).To(BeTrue())
+
+			data := []byte{1, 2, 3, 4}
+			rsp := mem.DataReadyRspBuilder{}.
+				WithRspTo(trans.toOutside.Meta().ID).
+				WithData(append(data, make([]byte, 60)...)).
+				Build()
+			RDMARequestInside.EXPECT().
+				Send(gomock.AssignableToTypeOf(&mem.DataReadyRsp{})).
+				Return(nil)
+			RDMARequestOutside.EXPECT().RetrieveIncoming().Return(rsp)
+
+			rdmaEngine.processRspFromRDMARequestOutside(rsp)
+
+			hit := mem.ReadReqBuilder{}.
+				WithAddress(0x102).
+				WithByteSize(2).
+				Build()
+			cached, found := rdmaEngine.remoteCache.lookup(hit)
+			Expect(found).To(BeTrue())
+			Expect(cached).To(Equal([]byte{3, 4}))
+			Expect(rdmaEngine.RemoteCacheStats().NumMisses).
+				To(Equal(uint64(1)))
+		})
+
+		It("should reply the hits without sending to outside", func() {
+			rdmaEngine.remoteCache.fill(0x100, make([]byte, 64))
+
+			var rsp *mem.DataReadyRsp
+			RDMARequestInside.EXPECT().PeekIncoming().Return(read)
+			RDMARequestInside.EXPECT().
+				Send(gomock.AssignableToTypeOf(&mem.DataReadyRsp{})).
+				Do(func(msg sim.Msg) { rsp = msg.(*mem.DataReadyRsp) }).
+				Return(nil)
+			RDMARequestInside.EXPECT().RetrieveIncoming().Return(read)
+			RDMARequestInside.EXPECT().PeekIncoming().Return(nil)
+
+			rdmaEngine.processFromL1()
+
+			Expect(rsp.RespondTo).To(Equal(read.ID))
+			Expect(rsp.Data).To(HaveLen(64))
+			Expect(rdmaEngine.transactionsFromInside).To(BeEmpty())
+			Expect(rdmaEngine.LinkBytes()).To(BeEmpty())
+			Expect(rdmaEngine.RemoteCacheStats().HitRate()).To(Equal(1.0))
+			Expect(rdmaEngine.RemoteCacheStats().SavedBytes).
+				To(Equal(uint64(64)))
+		})
+
+		It("should evict the least recently used line", func() {
+			rdmaEngine.remoteCache.fill(0x000, make([]byte, 64))
+			rdmaEngine.remoteCache.fill(0x080, make([]byte, 64))
+			rdmaEngine.remoteCache.lookup(mem.ReadReqBuilder{}.
+				WithAddress(0x000).WithByteSize(64).Build())
+			rdmaEngine.remoteCache.fill(0x100, make([]byte, 64))
+
+			_, found := rdmaEngine.remoteCache.lookup(mem.ReadReqBuilder{}.
+				WithAddress(0x080).WithByteSize(64).Build())
+			Expect(found).To(BeFalse())
+			_, found = rdmaEngine.remoteCache.lookup(mem.ReadReqBuilder{}.
+				WithAddress(0x000).WithByteSize(64).Build())
+			Expect(found).To(BeTrue())
+		})
+
+		It("should not fill the lines written while the read is pending",
+			func() {
+				rdmaEngine.transactionsFromInside = append(
+					rdmaEngine.transactionsFromInside,
+					transaction{fromInside: read, toOutside: read, fill: true})
+				rdmaEngine.remoteCache.fill(0x100, make([]byte, 64))
+
+				write := mem.WriteReqBuilder{}.
+					WithSrc(localCache.AsRemote()).
+					WithAddress(0x110).
+					WithData(make([]byte, 4)).
+					Build()
+				RDMARequestInside.EXPECT().PeekIncoming().Return(write)
+				RDMARequestOutside.EXPECT().
+					Send(gomock.AssignableToTypeOf(&mem.WriteReq{})).
+					Return(nil)
+				RDMARequestInside.EXPECT().RetrieveIncoming().Return(write)
+				RDMARequestInside.EXPECT().PeekIncoming().Return(nil)
+
+				rdmaEngine.processFromL1()
+
+				_, found := rdmaEngine.remoteCache.lookup(read)
+				Expect(found).To(BeFalse())
+				Expect(rdmaEngine.transactionsFromInside[0].fill).To(BeFalse())
+			})
+
+		It("should invalidate all the lines when asked", func() {
+			rdmaEngine.remoteCache.fill(0x100, make([]byte, 64))
+			req := InvalidateCacheReqBuilder{}.
+				WithSrc(controllingComponent.AsRemote()).
+				Build()
+			ctrlPort.EXPECT().PeekIncoming().Return(req)
+			ctrlPort.EXPECT().RetrieveIncoming().Return(req)
+			ctrlPort.EXPECT().
+				Send(gomock.AssignableToTypeOf(&InvalidateCacheRsp{})).
+				DoAndReturn(func(msg sim.Msg) *sim.SendError {
+					Expect(msg.(*InvalidateCacheRsp).RespondTo).
+						To(Equal(req.ID))
+					return nil
+				})
+
+			Expect(rdmaEngine.processFromCtrlPort()).To(BeTrue())
+
+			_, found := rdmaEngine.remoteCache.lookup(read)
+			Expect(found).To(BeFalse())
+			Expect(rdmaEngine.RemoteCacheStats().NumInvalidations).
+				To(Equal(uint64(1)))
+		})
+
+		It("should wait if the invalidation cannot be acknowledged", func() {
+			rdmaEngine.remoteCache.fill(0x100, make([]byte, 64))
+			req := InvalidateCacheReqBuilder{}.
+				WithSrc(controllingComponent.AsRemote()).
+				Build()
+			ctrlPort.EXPECT().PeekIncoming().Return(req)
+			ctrlPort.EXPECT().
+				Send(gomock.AssignableToTypeOf(&InvalidateCacheRsp{})).
+				Return(sim.NewSendError())
+
+			Expect(rdmaEngine.processFromCtrlPort()).To(BeFalse())
+
+			_, found := rdmaEngine.remoteCache.lookup(read)
+			Expect(found).To(BeTrue())
+		})
+	})
+
+	Context("Directory", func() {
+		BeforeEach(func() {
+			rdmaEngine.directory = coherence.NewDirectory(6)
+		})
+
+		read := func(src sim.RemotePort) *mem.ReadReq {
+			return mem.ReadReqBuilder{}.
+				WithSrc(src).
+				WithAddress(0x104).
+				WithByteSize(4).
+				Build()
+		}
+
+		It("should record the GPUs that read a line", func() {
+			req := read("GPU2")
+			RDMADataOutside.EXPECT().PeekIncoming().Return(req)
+			RDMADataInside.EXPECT().
+				Send(gomock.AssignableToTypeOf(&mem.ReadReq{})).
+				Return(nil)
+			RDMADataOutside.EXPECT().RetrieveIncoming().Return(req)
+
+			rdmaEngine.processIncomingReq()
+
+			Expect(rdmaEngine.NumSharedLines()).To(Equal(1))
+			Expect(rdmaEngine.directory.Sharers(0x100)).
+				To(ConsistOf(sim.RemotePort("GPU2")))
+		})
+
+		It("should invalidate the other sharers on remote writes", func() {
+			rdmaEngine.recordRemoteAccess(read("GPU2"))
+			rdmaEngine.recordRemoteAccess(read("GPU3"))
+
+			write := mem.WriteReqBuilder{}.
+				WithSrc("GPU2").
+				WithAddress(0x108).
+				WithData(make([]byte, 4)).
+				Build()
+			rdmaEngine.recordRemoteAccess(write)
+
+			Expect(rdmaEngine.invalidationsToOutside).To(HaveLen(1))
+			req := rdmaEngine.invalidationsToOutside[0].(*coherence.InvalidateReq)
+			Expect(req.Dst).To(Equal(sim.RemotePort("GPU3")))
+			Expect(req.Address).To(Equal(uint64(0x100)))
+			Expect(rdmaEngine.directory.Sharers(0x100)).To(HaveLen(1))
+		})
+
+		It("should invalidate all the sharers on local writes", func() {
+			rdmaEngine.recordRemoteAccess(read("GPU2"))
+			rdmaEngine.recordRemoteAccess(read("GPU3"))
+
+			notice := coherence.InvalidateReqBuilder{}.
+				WithAddress(0x110).
+				Build()
+			RDMARequestInside.EXPECT().PeekIncoming().Return(notice)
+			RDMARequestInside.EXPECT().RetrieveIncoming().Return(notice)
+			RDMARequestInside.EXPECT().PeekIncoming().Return(nil)
+
+			rdmaEngine.processFromL1()
+
+			Expect(rdmaEngine.invalidationsToOutside).To(HaveLen(2))
+			Expect(rdmaEngine.NumSharedLines()).To(Equal(0))
+
+			RDMARequestOutside.EXPECT().Send(gomock.Any()).Return(nil)
+
+			Expect(rdmaEngine.sendInvalidations()).To(BeTrue())
+			Expect(rdmaEngine.invalidationsToOutside).To(HaveLen(1))
+		})
+
+		It("should forward invalidations to the listeners that read the line",
+			func() {
+				rdmaEngine.AddInvalidationListener("L1VFilter[0]", "L1V[0]")
+				rdmaEngine.AddInvalidationListener("L1VFilter[1]", "L1V[1]")
+				rdmaEngine.recordLocalRead(read("L1V[1]"))
+
+				notice := coherence.InvalidateReqBuilder{}.
+					WithAddress(0x100).
+					Build()
+				RDMARequestOutside.EXPECT().PeekIncoming().Return(notice)
+				RDMARequestOutside.EXPECT().RetrieveIncoming().Return(notice)
+
+				rdmaEngine.processIncomingRsp()
+
+				Expect(rdmaEngine.invalidationsToInside).To(HaveLen(1))
+				Expect(rdmaEngine.invalidationsToInside[0].Meta().Dst).
+					To(Equal(sim.RemotePort("L1VFilter[1]")))
+				Expect(rdmaEngine.remoteReaders).To(BeEmpty())
+			})
+
+		It("should not forward invalidations of lines that are not read",
+			func() {
+				rdmaEngine.AddInvalidationListener("L1VFilter[0]", "L1V[0]")
+
+				notice := coherence.InvalidateReqBuilder{}.
+					WithAddress(0x100).
+					Build()
+				RDMARequestOutside.EXPECT().PeekIncoming().Return(notice)
+				RDMARequestOutside.EXPECT().RetrieveIncoming().Return(notice)
+
+				rdmaEngine.processIncomingRsp()
+
+				Expect(rdmaEngine.invalidationsToInside).To(BeEmpty())
+			})
+	})
+
 	Context("Drain related handling", func() {
 
 		var (
@@ -179,3 +179,114 @@ func (b RestartRspBuilder) Build() *RestartRsp {
 	r.Dst = b.dst
 	return r
 }
+
+// InvalidateCacheReq asks the rdma to drop all the data in its remote-data
+// cache. The rdma responds with an InvalidateCacheRsp once the data is
+// dropped.
+type InvalidateCacheReq struct {
+	sim.MsgMeta
+}
+
+// Meta returns the meta data associated with the message.
+func (r *InvalidateCacheReq) Meta() *sim.MsgMeta {
+	return &r.MsgMeta
+}
+
+// Clone returns a clone of the InvalidateCacheReq with different ID.
+func (r *InvalidateCacheReq) Clone() sim.Msg {
+	cloneMsg := *r
+	cloneMsg.ID = sim.GetIDGenerator().Generate()
+
+	return &cloneMsg
+}
+
+// InvalidateCacheReqBuilder can build RDMA cache invalidation requests
+type InvalidateCacheReqBuilder struct {
+	src, dst sim.RemotePort
+}
+
+// WithSrc sets the source of the request to build.
+func (b InvalidateCacheReqBuilder) WithSrc(
+	src sim.RemotePort,
+) InvalidateCacheReqBuilder {
+	b.src = src
+	return b
+}
+
+// WithDst sets the destination of the request to build.
+func (b InvalidateCacheReqBuilder) WithDst(
+	dst sim.RemotePort,
+) InvalidateCacheReqBuilder {
+	b.dst = dst
+	return b
+}
+
+// Build creates a new InvalidateCacheReq
+func (b InvalidateCacheReqBuilder) Build() *InvalidateCacheReq {
+	r := &InvalidateCacheReq{}
+	r.ID = sim.GetIDGenerator().Generate()
+	r.Src = b.src
+	r.Dst = b.dst
+	return r
+}
+
+// InvalidateCacheRsp tells that the rdma has dropped all the data in its
+// remote-data cache.
+type InvalidateCacheRsp struct {
+	sim.MsgMeta
+
+	RespondTo string
+}
+
+// Meta returns the meta data associated with the message.
+func (r *InvalidateCacheRsp) Meta() *sim.MsgMeta {
+	return &r.MsgMeta
+}
+
+// Clone returns a clone of the InvalidateCacheRsp with different ID.
+func (r *InvalidateCacheRsp) Clone() sim.Msg {
+	cloneMsg := *r
+	cloneMsg.ID = sim.GetIDGenerator().Generate()
+
+	return &cloneMsg
+}
+
+// InvalidateCacheRspBuilder can build RDMA cache invalidation responses
+type InvalidateCacheRspBuilder struct {
+	src, dst sim.RemotePort
+	rspTo    string
+}
+
+// WithSrc sets the source of the response to build.
+func (b InvalidateCacheRspBuilder) WithSrc(
+	src sim.RemotePort,
+) InvalidateCacheRspBuilder {
+	b.src = src
+	return b
+}
+
+// WithDst sets the destination of the response to build.
+func (b InvalidateCacheRspBuilder) WithDst(
+	dst sim.RemotePort,
+) InvalidateCacheRspBuilder {
+	b.dst = dst
+	return b
+}
+
+// WithRspTo sets the ID of the request that the response responds to.
+func (b InvalidateCacheRspBuilder) WithRspTo(
+	id string,
+) InvalidateCacheRspBuilder {
+	b.rspTo = id
+	return b
+}
+
+// Build creates a new InvalidateCacheRsp
+func (b InvalidateCacheRspBuilder) Build() *InvalidateCacheRsp {
+	r := &InvalidateCacheRsp{}
+	r.ID = sim.GetIDGenerator().Generate()
+	r.Src = b.src
+	r.Dst = b.dst
+	r.RespondTo = b.rspTo
+	return r
+}
@@ -0,0 +1,277 @@
+package rdma
+
+import (
+	"log"
+
+	"github.com/sarchlab/akita/v4/mem/mem"
+	"github.com/sarchlab/akita/v4/sim"
+)
+
+// RemoteCacheStats is the statistics of the remote-data cache.
+type RemoteCacheStats struct {
+	NumHits          uint64
+	NumMisses        uint64
+	NumFills         uint64
+	NumInvalidations uint64
+
+	// SavedBytes is the number of bytes that the hits have kept off the
+	// fabric, including the headers of the packets if the links are modeled.
+	SavedBytes uint64
+}
+
+// HitRate returns the fraction of the remote reads that hit in the cache.
+func (s RemoteCacheStats) HitRate() float64 {
+	total := s.NumHits + s.NumMisses
+	if total == 0 {
+		return 0
+	}
+
+	return float64(s.NumHits) / float64(total)
+}
+
+type remoteCacheLine struct {
+	valid   bool
+	tag     uint64
+	data    []byte
+	lastUse uint64
+}
+
+// A remoteCache is a set-associative cache with LRU replacement that keeps
+// the data that the GPU has read from the other GPUs.
+type remoteCache struct {
+	log2LineSize uint64
+	numSets      uint64
+	sets         [][]remoteCacheLine
+	clock        uint64
+	stats        RemoteCacheStats
+}
+
+func newRemoteCache(
+	byteSize uint64,
+	wayAssociativity int,
+	log2LineSize uint64,
+) *remoteCache {
+	lineSize := uint64(1) << log2LineSize
+	numLines := byteSize / lineSize
+
+	if wayAssociativity <= 0 || numLines < uint64(wayAssociativity) {
+		log.Panicf("cannot build a %d-way remote cache of %d bytes",
+			wayAssociativity, byteSize)
+	}
+
+	c := &remoteCache{
+		log2LineSize: log2LineSize,
+		numSets:      numLines / uint64(wayAssociativity),
+	}
+
+	c.sets = make([][]remoteCacheLine, c.numSets)
+	for i := range c.sets {
+		c.sets[i] = make([]remoteCacheLine, wayAssociativity)
+	}
+
+	return c
+}
+
+func (c *remoteCache) lineAddress(addr uint64) uint64 {
+	return addr >> c.log2LineSize << c.log2LineSize
+}
+
+func (c *remoteCache) set(line uint64) []remoteCacheLine {
+	return c.sets[(line>>c.log2LineSize)%c.numSets]
+}
+
+// cacheable returns whether a read only touches a single line.
+func (c *remoteCache) cacheable(req *mem.ReadReq) bool {
+	return req.AccessByteSize > 0 &&
+		c.lineAddress(req.Address) ==
+			c.lineAddress(req.Address+req.AccessByteSize-1)
+}
+
+// fillable returns whether a read brings a whole line.
+func (c *remoteCache) fillable(req *mem.ReadReq) bool {
+	return req.Address == c.lineAddress(req.Address) &&
+		req.AccessByteSize == uint64(1)<<c.log2LineSize
+}
+
+// lookup returns the data of a read if the line is in the cache.
+func (c *remoteCache) lookup(req *mem.ReadReq) ([]byte, bool) {
+	line := c.lineAddress(req.Address)
+
+	for i := range c.set(line) {
+		l := &c.set(line)[i]
+		if l.valid && l.tag == line {
+			c.clock++
+			l.lastUse = c.clock
+
+			offset := req.Address - line
+			data := make([]byte, req.AccessByteSize)
+			copy(data, l.data[offset:offset+req.AccessByteSize])
+
+			return data, true
+		}
+	}
+
+	return nil, false
+}
+
+// fill puts a line in the cache, evicting the least recently used line of the
+// set.
+func (c *remoteCache) fill(line uint64, data []byte) {
+	set := c.set(line)
+	victim := &set[0]
+
+	for i := range set {
+		l := &set[i]
+		if l.valid && l.tag == line {
+			victim = l
+			break
+		}
+
+		if victim.valid && (!l.valid || l.lastUse < victim.lastUse) {
+			victim = l
+		}
+	}
+
+	c.clock++
+	victim.valid = true
+	victim.tag = line
+	victim.data = append([]byte(nil), data...)
+	victim.lastUse = c.clock
+	c.stats.NumFills++
+}
+
+// invalidate removes a line from the cache.
+func (c *remoteCache) invalidate(line uint64) {
+	for i := range c.set(line) {
+		l := &c.set(line)[i]
+		if l.valid && l.tag == line {
+			l.valid = false
+			l.data = nil
+			c.stats.NumInvalidations++
+		}
+	}
+}
+
+// invalidateAll removes all the lines from the cache.
+func (c *remoteCache) invalidateAll() {
+	for _, set := range c.sets {
+		for i := range set {
+			if set[i].valid {
+				set[i].valid = false
+				set[i].data = nil
+				c.stats.NumInvalidations++
+			}
+		}
+	}
+}
+
+// HasRemoteCache returns whether the RDMA engine caches the data that the GPU
+// reads from the other GPUs.
+func (c *Comp) HasRemoteCache() bool {
+	return c.remoteCache != nil
+}
+
+// RemoteCacheStats returns the statistics of the remote-data cache.
+func (c *Comp) RemoteCacheStats() RemoteCacheStats {
+	if c.remoteCache == nil {
+		return RemoteCacheStats{}
+	}
+
+	return c.remoteCache.stats
+}
+
+// cacheableRead returns the request as a read if the remote-data cache can
+// serve it.
+func (c *Comp) cacheableRead(req mem.AccessReq) (*mem.ReadReq, bool) {
+	if c.remoteCache == nil {
+		return nil, false
+	}
+
+	read, ok := req.(*mem.ReadReq)
+	if !ok || !c.remoteCache.cacheable(read) {
+		return nil, false
+	}
+
+	return read, true
+}
+
+// replyFromRemoteCache replies a read from L1 with the cached data without
+// sending the read to the other GPU.
+func (c *Comp) replyFromRemoteCache(
+	read *mem.ReadReq,
+	data []byte,
+	dst sim.RemotePort,
+) bool {
+	rsp := mem.DataReadyRspBuilder{}.
+		WithSrc(c.RDMARequestInside.AsRemote()).
+		WithDst(read.Src).
+		WithRspTo(read.ID).
+		WithData(data).
+		Build()
+
+	err := c.RDMARequestInside.Send(rsp)
+	if err != nil {
+		return false
+	}
+
+	c.RDMARequestInside.RetrieveIncoming()
+
+	c.remoteCache.stats.NumHits++
+	c.remoteCache.stats.SavedBytes += read.AccessByteSize
+	c.linkLock.Lock()
+	if link, found := c.links[c.devices.Find(dst)]; found {
+		c.remoteCache.stats.SavedBytes += 2 * link.HeaderBytes
+	}
+	c.linkLock.Unlock()
+
+	return true
+}
+
+// invalidateWrittenLines removes the lines that a write from L1 touches from
+// the remote-data cache.
+func (c *Comp) invalidateWrittenLines(req mem.AccessReq) {
+	write, ok := req.(*mem.WriteReq)
+	if !ok || c.remoteCache == nil || len(write.Data) == 0 {
+		return
+	}
+
+	lineSize := uint64(1) << c.remoteCache.log2LineSize
+	first := c.remoteCache.lineAddress(write.Address)
+	last := write.Address + uint64(len(write.Data)) - 1
+
+	for line := first; line <= last; line += lineSize {
+		c.invalidateRemoteLine(line)
+	}
+}
+
+// invalidateRemoteLine removes a line from the remote-data cache and stops
+// the pending reads of the line from filling the cache with stale data.
+func (c *Comp) invalidateRemoteLine(addr uint64) {
+	if c.remoteCache == nil {
+		return
+	}
+
+	line := c.remoteCache.lineAddress(addr)
+	c.remoteCache.invalidate(line)
+
+	for i := range c.transactionsFromInside {
+		trans := &c.transactionsFromInside[i]
+		addr := trans.fromInside.(mem.AccessReq).GetAddress()
+		if trans.fill && c.remoteCache.lineAddress(addr) == line {
+			trans.fill = false
+		}
+	}
+}
+
+// invalidateRemoteCache removes all the lines from the remote-data cache.
+func (c *Comp) invalidateRemoteCache() {
+	if c.remoteCache == nil {
+		return
+	}
+
+	c.remoteCache.invalidateAll()
+
+	for i := range c.transactionsFromInside {
+		c.transactionsFromInside[i].fill = false
+	}
+}
@@ -279,6 +279,7 @@ func (b *ReorderBuffer) duplicateReadReq(req *mem.ReadReq) *mem.ReadReq {
 		WithAddress(req.Address).
 		WithByteSize(req.AccessByteSize).
 		WithPID(req.PID).
+		WithInfo(req.Info).
 		WithDst(b.BottomUnit.AsRemote()).
 		Build()
 }
@@ -289,6 +290,7 @@ func (b *ReorderBuffer) duplicateWriteReq(req *mem.WriteReq) *mem.WriteReq {
 		WithPID(req.PID).
 		WithData(req.Data).
 		WithDirtyMask(req.DirtyMask).
+		WithInfo(req.Info).
 		WithDst(b.BottomUnit.AsRemote()).
 		Build()
 }
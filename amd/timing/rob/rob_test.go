@@ -90,6 +90,7 @@ var _ = Describe("Reorder Buffer", func() {
 		})
 
 		It("should accept request from top and forward to bottom", func() {
+			read.Info = "info"
 			topPort.EXPECT().PeekIncoming().Return(read)
 			topPort.EXPECT().RetrieveIncoming()
 			bottomPort.EXPECT().
@@ -97,6 +98,7 @@ var _ = Describe("Reorder Buffer", func() {
 				Do(func(req *mem.ReadReq) {
 					Expect(req.Src).To(BeIdenticalTo(rob.bottomPort.AsRemote()))
 					Expect(req.Dst).To(BeIdenticalTo(rob.BottomUnit.AsRemote()))
+					Expect(req.Info).To(Equal("info"))
 				}).
 				Return(nil)
 
@@ -0,0 +1,108 @@
+package sharedtlb
+
+import (
+	"fmt"
+
+	"github.com/sarchlab/akita/v4/sim"
+)
+
+// A Builder can build shootdown controllers.
+type Builder struct {
+	engine         sim.Engine
+	freq           sim.Freq
+	numGPUs        int
+	numReqPerCycle int
+	bufferSize     int
+	tlb            sim.RemotePort
+	tlbCtrl        sim.RemotePort
+	flushTargets   []sim.RemotePort
+}
+
+// MakeBuilder creates a builder with default parameters.
+func MakeBuilder() Builder {
+	return Builder{
+		freq:           1 * sim.GHz,
+		numGPUs:        1,
+		numReqPerCycle: 16,
+		bufferSize:     64,
+	}
+}
+
+// WithEngine sets the engine to use.
+func (b Builder) WithEngine(engine sim.Engine) Builder {
+	b.engine = engine
+	return b
+}
+
+// WithFreq sets the frequency that the controller works at.
+func (b Builder) WithFreq(freq sim.Freq) Builder {
+	b.freq = freq
+	return b
+}
+
+// WithNumGPUs sets the number of GPUs that share the TLB. Each GPU has its
+// own control port.
+func (b Builder) WithNumGPUs(n int) Builder {
+	b.numGPUs = n
+	return b
+}
+
+// WithNumReqPerCycle sets the number of requests that the controller can
+// forward in each cycle.
+func (b Builder) WithNumReqPerCycle(n int) Builder {
+	b.numReqPerCycle = n
+	return b
+}
+
+// WithBufferSize sets the number of messages that the top and the bottom
+// ports can buffer.
+func (b Builder) WithBufferSize(n int) Builder {
+	b.bufferSize = n
+	return b
+}
+
+// WithTLB sets the top port and the control port of the shared TLB.
+func (b Builder) WithTLB(top, ctrl sim.RemotePort) Builder {
+	b.tlb = top
+	b.tlbCtrl = ctrl
+	return b
+}
+
+// WithFlushTarget lets the shootdowns also flush the component behind the
+// shared TLB that owns the given control port, such as a page walker. The
+// component must take the TLB flush and restart requests.
+func (b Builder) WithFlushTarget(ctrl sim.RemotePort) Builder {
+	b.flushTargets = append(b.flushTargets, ctrl)
+	return b
+}
+
+// Build creates a shootdown controller with the given parameters.
+func (b Builder) Build(name string) *Comp {
+	c := &Comp{}
+	c.TickingComponent = sim.NewTickingComponent(name, b.engine, b.freq, c)
+
+	c.tlb = b.tlb
+	c.flushTargets = append([]sim.RemotePort{b.tlbCtrl}, b.flushTargets...)
+	c.numReqPerCycle = b.numReqPerCycle
+
+	c.topPort = sim.NewPort(c, b.bufferSize, b.bufferSize, name+".TopPort")
+	c.AddPort("Top", c.topPort)
+
+	c.bottomPort = sim.NewPort(
+		c, b.bufferSize, b.bufferSize, name+".BottomPort")
+	c.AddPort("Bottom", c.bottomPort)
+
+	c.toCtrlPort = sim.NewPort(c, 4, 4, name+".ToControlPort")
+	c.AddPort("ToControl", c.toCtrlPort)
+
+	for i := 0; i < b.numGPUs; i++ {
+		port := sim.NewPort(c, 1, 1,
+			fmt.Sprintf("%s.ControlPort[%d]", name, i))
+		c.AddPort(fmt.Sprintf("Control[%d]", i), port)
+		c.gpuCtrlPorts = append(c.gpuCtrlPorts, port)
+	}
+
+	c.stoppedGPUs = make([]bool, b.numGPUs)
+
+	return c
+}
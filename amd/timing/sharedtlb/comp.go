@@ -0,0 +1,397 @@
+// Package sharedtlb lets several GPUs share a TLB, such as the TLB of an
+// IOMMU.
+//
+// The akita TLBs drop the misses in flight when they are flushed and the
+// requests that wait in their buffers when they are restarted. A GPU can do
+// so to its own TLBs, as it has flushed its pipelines first, but a shared TLB
+// would lose the translations of the other GPUs. The shootdown controller
+// sits in front of the shared TLB and keeps the translation requests that it
+// has forwarded. Each GPU shoots down the shared TLB through a "Control[i]"
+// port of the controller, with the same flush and restart requests as its
+// own TLBs.
+//
+// On a flush, the controller holds the new requests and flushes the shared
+// TLB and the components behind it, such as a page walker. They stay flushed
+// until every GPU that has shot them down restarts, as the pages are still
+// being migrated until then, and a translation of a migrating page would
+// bring the old physical address back into the shared TLB. When the last of
+// those GPUs restarts, the controller restarts the shared TLB, forwards the
+// requests in flight again, and responds to the GPU. The other GPUs get their
+// restart responses right away.
+package sharedtlb
+
+import (
+	"log"
+	"reflect"
+
+	"github.com/sarchlab/akita/v4/mem/vm"
+	"github.com/sarchlab/akita/v4/mem/vm/tlb"
+	"github.com/sarchlab/akita/v4/sim"
+)
+
+type transaction struct {
+	id  string
+	req *vm.TranslationReq
+}
+
+// Comp is a shootdown controller in front of a shared TLB.
+type Comp struct {
+	*sim.TickingComponent
+
+	topPort      sim.Port
+	bottomPort   sim.Port
+	toCtrlPort   sim.Port
+	gpuCtrlPorts []sim.Port
+
+	tlb            sim.RemotePort
+	flushTargets   []sim.RemotePort
+	numReqPerCycle int
+
+	inflight []transaction
+	retries  []*vm.TranslationReq
+
+	// state is "" when the controller forwards the requests, "flushing",
+	// "stopped", "restarting", or "responding" during a shootdown.
+	state       string
+	currReq     sim.Msg
+	currReqPort sim.Port
+	stoppedGPUs []bool
+	toCtrl      []sim.Msg
+	numAcks     int
+	nextGPU     int
+
+	numShootdowns uint64
+}
+
+// NumShootdowns returns the number of times that the GPUs have flushed the
+// shared TLB.
+func (c *Comp) NumShootdowns() uint64 {
+	return c.numShootdowns
+}
+
+// Tick updates the state of the controller.
+func (c *Comp) Tick() bool {
+	madeProgress := false
+
+	madeProgress = c.sendToCtrl() || madeProgress
+	madeProgress = c.parseCtrlRsp() || madeProgress
+	madeProgress = c.respond() || madeProgress
+	madeProgress = c.parseGPUCtrl() || madeProgress
+	madeProgress = c.parseFromBottom() || madeProgress
+
+	for i := 0; i < c.numReqPerCycle; i++ {
+		madeProgress = c.forward() || madeProgress
+	}
+
+	return madeProgress
+}
+
+func (c *Comp) sendToCtrl() bool {
+	madeProgress := false
+
+	for len(c.toCtrl) > 0 {
+		err := c.toCtrlPort.Send(c.toCtrl[0])
+		if err != nil {
+			break
+		}
+
+		c.toCtrl = c.toCtrl[1:]
+		madeProgress = true
+	}
+
+	return madeProgress
+}
+
+// parseCtrlRsp responds to the GPU once the flushed components have all been
+// flushed, and forwards the requests in flight again once they have all been
+// restarted.
+func (c *Comp) parseCtrlRsp() bool {
+	msg := c.toCtrlPort.RetrieveIncoming()
+	if msg == nil {
+		return false
+	}
+
+	switch msg.(type) {
+	case *tlb.FlushRsp:
+		c.numAcks--
+		if c.numAcks == 0 {
+			c.state = "responding"
+		}
+	case *tlb.RestartRsp:
+		c.numAcks--
+		if c.numAcks == 0 {
+			c.retryInflight()
+		}
+	default:
+		log.Panicf("cannot process message of type %s", reflect.TypeOf(msg))
+	}
+
+	return true
+}
+
+func (c *Comp) restartTargets(req *tlb.RestartReq, port sim.Port) {
+	for _, dst := range c.flushTargets {
+		restart := tlb.RestartReqBuilder{}.
+			WithSrc(c.toCtrlPort.AsRemote()).
+			WithDst(dst).
+			Build()
+		c.toCtrl = append(c.toCtrl, restart)
+	}
+
+	c.currReq = req
+	c.currReqPort = port
+	c.numAcks = len(c.flushTargets)
+	c.state = "restarting"
+}
+
+// retryInflight forwards the requests in flight again, as the shared TLB may
+// have dropped them. The late responses to the dropped requests are ignored.
+func (c *Comp) retryInflight() {
+	for _, t := range c.inflight {
+		c.retries = append(c.retries, t.req)
+	}
+
+	c.inflight = nil
+	c.state = "responding"
+}
+
+// respond responds to the flush or the restart request of the GPU that the
+// controller is serving.
+func (c *Comp) respond() bool {
+	if c.state != "responding" {
+		return false
+	}
+
+	var rsp sim.Msg
+
+	switch req := c.currReq.(type) {
+	case *tlb.FlushReq:
+		rsp = tlb.FlushRspBuilder{}.
+			WithSrc(c.currReqPort.AsRemote()).
+			WithDst(req.Src).
+			Build()
+	case *tlb.RestartReq:
+		rsp = tlb.RestartRspBuilder{}.
+			WithSrc(c.currReqPort.AsRemote()).
+			WithDst(req.Src).
+			Build()
+	}
+
+	err := c.currReqPort.Send(rsp)
+	if err != nil {
+		return false
+	}
+
+	if _, ok := c.currReq.(*tlb.FlushReq); ok {
+		c.state = "stopped"
+		c.numShootdowns++
+	} else {
+		c.state = ""
+	}
+
+	c.currReq = nil
+	c.currReqPort = nil
+
+	return true
+}
+
+// parseGPUCtrl takes the flush and restart requests of the GPUs in turn.
+func (c *Comp) parseGPUCtrl() bool {
+	if c.state != "" && c.state != "stopped" {
+		return false
+	}
+
+	for i := range c.gpuCtrlPorts {
+		gpu := (c.nextGPU + i) % len(c.gpuCtrlPorts)
+		port := c.gpuCtrlPorts[gpu]
+
+		msg := port.PeekIncoming()
+		if msg == nil {
+			continue
+		}
+
+		c.nextGPU = (gpu + 1) % len(c.gpuCtrlPorts)
+
+		switch req := msg.(type) {
+		case *tlb.FlushReq:
+			port.RetrieveIncoming()
+			c.startShootdown(req, gpu)
+
+			return true
+		case *tlb.RestartReq:
+			return c.restartGPU(req, gpu)
+		default:
+			log.Panicf("cannot process message of type %s",
+				reflect.TypeOf(msg))
+		}
+	}
+
+	return false
+}
+
+func (c *Comp) startShootdown(req *tlb.FlushReq, gpu int) {
+	for _, dst := range c.flushTargets {
+		flush := tlb.FlushReqBuilder{}.
+			WithSrc(c.toCtrlPort.AsRemote()).
+			WithDst(dst).
+			WithPID(req.PID).
+			WithVAddrs(req.VAddr).
+			Build()
+		c.toCtrl = append(c.toCtrl, flush)
+	}
+
+	c.stoppedGPUs[gpu] = true
+	c.currReq = req
+	c.currReqPort = c.gpuCtrlPorts[gpu]
+	c.numAcks = len(c.flushTargets)
+	c.state = "flushing"
+}
+
+// restartGPU restarts the shared TLB if the GPU is the last one that has shot
+// it down. Otherwise, the GPU gets its response right away.
+func (c *Comp) restartGPU(req *tlb.RestartReq, gpu int) bool {
+	port := c.gpuCtrlPorts[gpu]
+
+	if c.state == "" || c.isOtherGPUStopped(gpu) {
+		if !c.respondRestart(req, port) {
+			return false
+		}
+
+		c.stoppedGPUs[gpu] = false
+
+		return true
+	}
+
+	c.stoppedGPUs[gpu] = false
+	port.RetrieveIncoming()
+	c.restartTargets(req, port)
+
+	return true
+}
+
+func (c *Comp) isOtherGPUStopped(gpu int) bool {
+	for i, stopped := range c.stoppedGPUs {
+		if i != gpu && stopped {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c *Comp) respondRestart(req *tlb.RestartReq, port sim.Port) bool {
+	rsp := tlb.RestartRspBuilder{}.
+		WithSrc(port.AsRemote()).
+		WithDst(req.Src).
+		Build()
+
+	err := port.Send(rsp)
+	if err != nil {
+		return false
+	}
+
+	port.RetrieveIncoming()
+
+	return true
+}
+
+func (c *Comp) parseFromBottom() bool {
+	msg := c.bottomPort.PeekIncoming()
+	if msg == nil {
+		return false
+	}
+
+	rsp, ok := msg.(*vm.TranslationRsp)
+	if !ok {
+		log.Panicf("cannot process message of type %s", reflect.TypeOf(msg))
+	}
+
+	index := c.findInflight(rsp.RespondTo)
+	if index < 0 {
+		c.bottomPort.RetrieveIncoming()
+		return true
+	}
+
+	req := c.inflight[index].req
+	rspToTop := vm.TranslationRspBuilder{}.
+		WithSrc(c.topPort.AsRemote()).
+		WithDst(req.Src).
+		WithRspTo(req.ID).
+		WithPage(rsp.Page).
+		Build()
+
+	err := c.topPort.Send(rspToTop)
+	if err != nil {
+		return false
+	}
+
+	c.bottomPort.RetrieveIncoming()
+	c.inflight = append(c.inflight[:index], c.inflight[index+1:]...)
+
+	return true
+}
+
+func (c *Comp) findInflight(id string) int {
+	for i, t := range c.inflight {
+		if t.id == id {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// forward sends a request to the shared TLB, starting with the requests to
+// retry. The requests wait until the shared TLB is running again.
+func (c *Comp) forward() bool {
+	if c.state != "" {
+		return false
+	}
+
+	if len(c.retries) > 0 {
+		if !c.sendToTLB(c.retries[0]) {
+			return false
+		}
+
+		c.retries = c.retries[1:]
+
+		return true
+	}
+
+	msg := c.topPort.PeekIncoming()
+	if msg == nil {
+		return false
+	}
+
+	req, ok := msg.(*vm.TranslationReq)
+	if !ok {
+		log.Panicf("cannot process message of type %s", reflect.TypeOf(msg))
+	}
+
+	if !c.sendToTLB(req) {
+		return false
+	}
+
+	c.topPort.RetrieveIncoming()
+
+	return true
+}
+
+func (c *Comp) sendToTLB(req *vm.TranslationReq) bool {
+	reqToTLB := vm.TranslationReqBuilder{}.
+		WithSrc(c.bottomPort.AsRemote()).
+		WithDst(c.tlb).
+		WithPID(req.PID).
+		WithVAddr(req.VAddr).
+		WithDeviceID(req.DeviceID).
+		Build()
+
+	err := c.bottomPort.Send(reqToTLB)
+	if err != nil {
+		return false
+	}
+
+	c.inflight = append(c.inflight, transaction{id: reqToTLB.ID, req: req})
+
+	return true
+}
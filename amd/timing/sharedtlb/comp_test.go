@@ -0,0 +1,258 @@
+package sharedtlb
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sarchlab/akita/v4/mem/vm"
+	"github.com/sarchlab/akita/v4/mem/vm/tlb"
+	"github.com/sarchlab/akita/v4/sim"
+	"go.uber.org/mock/gomock"
+)
+
+var _ = Describe("Shootdown Controller", func() {
+	var (
+		mockCtrl   *gomock.Controller
+		engine     *MockEngine
+		topPort    *MockPort
+		bottomPort *MockPort
+		toCtrlPort *MockPort
+		gpuCtrl    *MockPort
+		c          *Comp
+	)
+
+	translation := func(vAddr uint64) *vm.TranslationReq {
+		return vm.TranslationReqBuilder{}.
+			WithSrc("GPU[1].L2TLB").
+			WithPID(1).
+			WithVAddr(vAddr).
+			Build()
+	}
+
+	BeforeEach(func() {
+		mockCtrl = gomock.NewController(GinkgoT())
+		engine = NewMockEngine(mockCtrl)
+		topPort = NewMockPort(mockCtrl)
+		bottomPort = NewMockPort(mockCtrl)
+		toCtrlPort = NewMockPort(mockCtrl)
+		gpuCtrl = NewMockPort(mockCtrl)
+		topPort.EXPECT().AsRemote().Return(sim.RemotePort("Top")).AnyTimes()
+		bottomPort.EXPECT().AsRemote().
+			Return(sim.RemotePort("Bottom")).AnyTimes()
+		toCtrlPort.EXPECT().AsRemote().
+			Return(sim.RemotePort("ToControl")).AnyTimes()
+		gpuCtrl.EXPECT().AsRemote().
+			Return(sim.RemotePort("Control[0]")).AnyTimes()
+
+		c = MakeBuilder().
+			WithEngine(engine).
+			WithTLB("TLB.Top", "TLB.Control").
+			WithFlushTarget("Walker.Control").
+			Build("IOMMU.ShootdownCtrl")
+		c.topPort = topPort
+		c.bottomPort = bottomPort
+		c.toCtrlPort = toCtrlPort
+		c.gpuCtrlPorts = []sim.Port{gpuCtrl}
+	})
+
+	AfterEach(func() {
+		mockCtrl.Finish()
+	})
+
+	It("should forward the translations to the shared TLB", func() {
+		req := translation(0x1000)
+		topPort.EXPECT().PeekIncoming().Return(req)
+		topPort.EXPECT().RetrieveIncoming().Return(req)
+		bottomPort.EXPECT().Send(gomock.Any()).
+			DoAndReturn(func(msg sim.Msg) *sim.SendError {
+				reqToTLB := msg.(*vm.TranslationReq)
+				Expect(reqToTLB.Dst).To(Equal(sim.RemotePort("TLB.Top")))
+				Expect(reqToTLB.VAddr).To(Equal(uint64(0x1000)))
+				return nil
+			})
+
+		Expect(c.forward()).To(BeTrue())
+		Expect(c.inflight).To(HaveLen(1))
+	})
+
+	It("should pass the translations back to the GPUs", func() {
+		req := translation(0x1000)
+		c.inflight = []transaction{{id: "to-tlb", req: req}}
+		rsp := vm.TranslationRspBuilder{}.
+			WithRspTo("to-tlb").
+			WithPage(vm.Page{PID: 1, VAddr: 0x1000, PAddr: 0x8000}).
+			Build()
+		bottomPort.EXPECT().PeekIncoming().Return(rsp)
+		bottomPort.EXPECT().RetrieveIncoming().Return(rsp)
+		topPort.EXPECT().Send(gomock.Any()).
+			DoAndReturn(func(msg sim.Msg) *sim.SendError {
+				rspToTop := msg.(*vm.TranslationRsp)
+				Expect(rspToTop.Dst).To(Equal(sim.RemotePort("GPU[1].L2TLB")))
+				Expect(rspToTop.RespondTo).To(Equal(req.ID))
+				return nil
+			})
+
+		Expect(c.parseFromBottom()).To(BeTrue())
+		Expect(c.inflight).To(BeEmpty())
+	})
+
+	It("should drop the responses to the dropped translations", func() {
+		rsp := vm.TranslationRspBuilder{}.WithRspTo("dropped").Build()
+		bottomPort.EXPECT().PeekIncoming().Return(rsp)
+		bottomPort.EXPECT().RetrieveIncoming().Return(rsp)
+
+		Expect(c.parseFromBottom()).To(BeTrue())
+	})
+
+	It("should flush the shared TLB and the flush targets", func() {
+		req := tlb.FlushReqBuilder{}.
+			WithSrc("GPU[1].CP").
+			WithPID(1).
+			WithVAddrs([]uint64{0x1000}).
+			Build()
+		gpuCtrl.EXPECT().PeekIncoming().Return(req)
+		gpuCtrl.EXPECT().RetrieveIncoming().Return(req)
+
+		Expect(c.parseGPUCtrl()).To(BeTrue())
+		Expect(c.state).To(Equal("flushing"))
+		Expect(c.stoppedGPUs).To(Equal([]bool{true}))
+		Expect(c.toCtrl).To(HaveLen(2))
+		Expect(c.toCtrl[0].Meta().Dst).To(Equal(sim.RemotePort("TLB.Control")))
+		Expect(c.toCtrl[1].Meta().Dst).
+			To(Equal(sim.RemotePort("Walker.Control")))
+		Expect(c.toCtrl[1].(*tlb.FlushReq).VAddr).
+			To(Equal([]uint64{0x1000}))
+	})
+
+	It("should hold the translations during a shootdown", func() {
+		c.state = "flushing"
+
+		Expect(c.forward()).To(BeFalse())
+	})
+
+	It("should hold the translations until the GPUs restart", func() {
+		c.state = "stopped"
+
+		Expect(c.forward()).To(BeFalse())
+	})
+
+	It("should respond to the GPU after the targets are flushed", func() {
+		c.state = "flushing"
+		c.numAcks = 2
+		toCtrlPort.EXPECT().RetrieveIncoming().
+			Return(tlb.FlushRspBuilder{}.Build()).Times(2)
+
+		Expect(c.parseCtrlRsp()).To(BeTrue())
+		Expect(c.state).To(Equal("flushing"))
+		Expect(c.parseCtrlRsp()).To(BeTrue())
+		Expect(c.state).To(Equal("responding"))
+		Expect(c.toCtrl).To(BeEmpty())
+	})
+
+	It("should keep the targets flushed after the shootdown", func() {
+		c.state = "responding"
+		c.currReq = tlb.FlushReqBuilder{}.WithSrc("GPU[1].CP").Build()
+		c.currReqPort = gpuCtrl
+		gpuCtrl.EXPECT().Send(gomock.Any()).
+			DoAndReturn(func(msg sim.Msg) *sim.SendError {
+				rsp := msg.(*tlb.FlushRsp)
+				Expect(rsp.Dst).To(Equal(sim.RemotePort("GPU[1].CP")))
+				return nil
+			})
+
+		Expect(c.respond()).To(BeTrue())
+		Expect(c.state).To(Equal("stopped"))
+		Expect(c.toCtrl).To(BeEmpty())
+		Expect(c.NumShootdowns()).To(Equal(uint64(1)))
+	})
+
+	It("should respond right away while other GPUs are stopped", func() {
+		otherGPUCtrl := NewMockPort(mockCtrl)
+		c.gpuCtrlPorts = []sim.Port{gpuCtrl, otherGPUCtrl}
+		c.stoppedGPUs = []bool{true, true}
+		c.state = "stopped"
+
+		req := tlb.RestartReqBuilder{}.WithSrc("GPU[1].CP").Build()
+		gpuCtrl.EXPECT().PeekIncoming().Return(req)
+		gpuCtrl.EXPECT().RetrieveIncoming().Return(req)
+		gpuCtrl.EXPECT().Send(gomock.Any()).
+			DoAndReturn(func(msg sim.Msg) *sim.SendError {
+				rsp := msg.(*tlb.RestartRsp)
+				Expect(rsp.Dst).To(Equal(sim.RemotePort("GPU[1].CP")))
+				return nil
+			})
+
+		Expect(c.parseGPUCtrl()).To(BeTrue())
+		Expect(c.state).To(Equal("stopped"))
+		Expect(c.stoppedGPUs).To(Equal([]bool{false, true}))
+		Expect(c.toCtrl).To(BeEmpty())
+	})
+
+	It("should restart the targets when the last GPU restarts", func() {
+		c.stoppedGPUs = []bool{true}
+		c.state = "stopped"
+
+		req := tlb.RestartReqBuilder{}.WithSrc("GPU[1].CP").Build()
+		gpuCtrl.EXPECT().PeekIncoming().Return(req)
+		gpuCtrl.EXPECT().RetrieveIncoming().Return(req)
+
+		Expect(c.parseGPUCtrl()).To(BeTrue())
+		Expect(c.state).To(Equal("restarting"))
+		Expect(c.stoppedGPUs).To(Equal([]bool{false}))
+		Expect(c.currReq).To(BeIdenticalTo(req))
+		Expect(c.toCtrl).To(HaveLen(2))
+		Expect(c.toCtrl[0]).To(BeAssignableToTypeOf(&tlb.RestartReq{}))
+		Expect(c.toCtrl[0].Meta().Dst).To(Equal(sim.RemotePort("TLB.Control")))
+	})
+
+	It("should retry the translations in flight after a restart", func() {
+		req := translation(0x1000)
+		c.inflight = []transaction{{id: "to-tlb", req: req}}
+		c.state = "restarting"
+		c.currReq = tlb.RestartReqBuilder{}.WithSrc("GPU[1].CP").Build()
+		c.currReqPort = gpuCtrl
+		c.numAcks = 1
+		toCtrlPort.EXPECT().RetrieveIncoming().
+			Return(tlb.RestartRspBuilder{}.Build())
+
+		Expect(c.parseCtrlRsp()).To(BeTrue())
+		Expect(c.state).To(Equal("responding"))
+		Expect(c.inflight).To(BeEmpty())
+
+		gpuCtrl.EXPECT().Send(gomock.Any()).
+			DoAndReturn(func(msg sim.Msg) *sim.SendError {
+				rsp := msg.(*tlb.RestartRsp)
+				Expect(rsp.Dst).To(Equal(sim.RemotePort("GPU[1].CP")))
+				return nil
+			})
+
+		Expect(c.respond()).To(BeTrue())
+		Expect(c.state).To(Equal(""))
+
+		bottomPort.EXPECT().Send(gomock.Any()).
+			DoAndReturn(func(msg sim.Msg) *sim.SendError {
+				reqToTLB := msg.(*vm.TranslationReq)
+				Expect(reqToTLB.ID).NotTo(Equal("to-tlb"))
+				Expect(reqToTLB.VAddr).To(Equal(uint64(0x1000)))
+				return nil
+			})
+
+		Expect(c.forward()).To(BeTrue())
+		Expect(c.retries).To(BeEmpty())
+		Expect(c.inflight[0].req).To(BeIdenticalTo(req))
+	})
+
+	It("should respond to the restart requests right away", func() {
+		req := tlb.RestartReqBuilder{}.WithSrc("GPU[1].CP").Build()
+		gpuCtrl.EXPECT().PeekIncoming().Return(req)
+		gpuCtrl.EXPECT().RetrieveIncoming().Return(req)
+		gpuCtrl.EXPECT().Send(gomock.Any()).
+			DoAndReturn(func(msg sim.Msg) *sim.SendError {
+				rsp := msg.(*tlb.RestartRsp)
+				Expect(rsp.Dst).To(Equal(sim.RemotePort("GPU[1].CP")))
+				return nil
+			})
+
+		Expect(c.parseGPUCtrl()).To(BeTrue())
+		Expect(c.toCtrl).To(BeEmpty())
+	})
+})
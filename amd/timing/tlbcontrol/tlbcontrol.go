@@ -0,0 +1,49 @@
+// Package tlbcontrol lets the akita TLBs take the shootdown requests of the
+// Command Processor.
+//
+// The akita TLB checks the messages on its "Control" port twice. Its main
+// middleware handles the flush, the restart, and the control messages, but a
+// control middleware that runs first panics on anything but a control message.
+// As a result, the first TLB shootdown of a page migration crashes the
+// simulation.
+package tlbcontrol
+
+import (
+	"reflect"
+
+	"github.com/sarchlab/akita/v4/mem/vm/tlb"
+	"github.com/sarchlab/akita/v4/sim"
+)
+
+// noopMiddleware takes the place of the control middleware of the TLB.
+type noopMiddleware struct{}
+
+func (noopMiddleware) Tick() bool {
+	return false
+}
+
+// AcceptShootdowns removes the control middleware of the TLB, so that the
+// flush and the restart requests reach the middleware that handles them. The
+// control middleware only checks the incoming messages, so no behavior is
+// lost.
+func AcceptShootdowns(t *tlb.Comp) {
+	middlewares := t.Middlewares()
+	for i, m := range middlewares {
+		if isControlMiddleware(m) {
+			middlewares[i] = noopMiddleware{}
+		}
+	}
+}
+
+// isControlMiddleware checks if the middleware is the control middleware of
+// the akita TLB. The type is unexported, so it is recognized by its name. If a
+// later version of akita renames or drops it, the TLB is left untouched.
+func isControlMiddleware(m sim.Middleware) bool {
+	t := reflect.TypeOf(m)
+	if t.Kind() != reflect.Ptr {
+		return false
+	}
+
+	return t.Elem().Name() == "ctrlMiddleware" &&
+		t.Elem().PkgPath() == reflect.TypeOf(tlb.Comp{}).PkgPath()
+}
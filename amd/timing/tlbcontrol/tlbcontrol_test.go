@@ -0,0 +1,42 @@
+package tlbcontrol
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sarchlab/akita/v4/mem/mem"
+	"github.com/sarchlab/akita/v4/mem/vm/tlb"
+	"go.uber.org/mock/gomock"
+)
+
+var _ = Describe("AcceptShootdowns", func() {
+	var (
+		mockCtrl *gomock.Controller
+		engine   *MockEngine
+	)
+
+	BeforeEach(func() {
+		mockCtrl = gomock.NewController(GinkgoT())
+		engine = NewMockEngine(mockCtrl)
+	})
+
+	AfterEach(func() {
+		mockCtrl.Finish()
+	})
+
+	It("should replace the control middleware of the TLB", func() {
+		t := tlb.MakeBuilder().
+			WithEngine(engine).
+			WithTranslationProviderMapper(&mem.SinglePortMapper{Port: "MMU"}).
+			Build("TLB")
+		numMiddlewares := len(t.Middlewares())
+		Expect(t.Middlewares()).To(ContainElement(
+			Satisfy(isControlMiddleware)))
+
+		AcceptShootdowns(t)
+
+		Expect(t.Middlewares()).To(HaveLen(numMiddlewares))
+		Expect(t.Middlewares()).NotTo(ContainElement(
+			Satisfy(isControlMiddleware)))
+		Expect(t.Middlewares()).To(ContainElement(noopMiddleware{}))
+	})
+})
@@ -43,6 +43,10 @@ type Wavefront struct {
 	IsFetching        bool
 	InstToIssue       *Inst
 
+	// IsPreempting marks that the state of the wavefront is being saved or
+	// restored. The wavefront does not fetch or issue instructions.
+	IsPreempting bool
+
 	SIMDID     int
 	SRegOffset int
 	VRegOffset int